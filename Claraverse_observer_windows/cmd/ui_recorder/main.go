@@ -0,0 +1,9 @@
+// Command ui_recorder records UI workflows on Windows. Everything it does is
+// in the recorder package; see the README for its commands and flags.
+package main
+
+import "ui_recorder/recorder"
+
+func main() {
+	recorder.Main()
+}
@@ -1,621 +0,0 @@
-package main
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"net/http/httptest"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
-	"time"
-)
-
-// Test configuration
-type TestConfig struct {
-	EnableBrowserTests     bool
-	EnablePerformanceTests bool
-	EnableAccuracyTests    bool
-	BrowserPath            string
-	TestDurationSeconds    int
-	MaxEventsPerTest       int
-}
-
-// Test results structure
-type TestResults struct {
-	TestName           string             `json:"test_name"`
-	Passed             bool               `json:"passed"`
-	ExecutionTimeMs    int64              `json:"execution_time_ms"`
-	EventsRecorded     int                `json:"events_recorded"`
-	ErrorsDetected     []string           `json:"errors_detected"`
-	PerformanceMetrics map[string]float64 `json:"performance_metrics"`
-}
-
-// Browser automation test cases
-type BrowserTestCase struct {
-	Name        string
-	URL         string
-	Actions     []BrowserAction
-	Validations []ValidationCheck
-}
-
-// Browser action types
-type BrowserAction struct {
-	Type       string                 `json:"type"`
-	Target     string                 `json:"target"`
-	Value      string                 `json:"value"`
-	Delay      int                    `json:"delay_ms"`
-	Parameters map[string]interface{} `json:"parameters"`
-}
-
-// Validation check types
-type ValidationCheck struct {
-	Type     string      `json:"type"`
-	Target   string      `json:"target"`
-	Expected interface{} `json:"expected"`
-}
-
-// Initialize test configuration
-func getDefaultTestConfig() TestConfig {
-	return TestConfig{
-		EnableBrowserTests:     true,
-		EnablePerformanceTests: true,
-		EnableAccuracyTests:    true,
-		BrowserPath:            findBrowserPath(),
-		TestDurationSeconds:    30,
-		MaxEventsPerTest:       1000,
-	}
-}
-
-// Find browser executable path
-func findBrowserPath() string {
-	browsers := []string{
-		"chrome.exe",
-		"msedge.exe",
-		"firefox.exe",
-	}
-
-	searchPaths := []string{
-		`C:\Program Files\Google\Chrome\Application`,
-		`C:\Program Files (x86)\Google\Chrome\Application`,
-		`C:\Program Files\Microsoft\Edge\Application`,
-		`C:\Program Files (x86)\Microsoft\Edge\Application`,
-		`C:\Program Files\Mozilla Firefox`,
-		`C:\Program Files (x86)\Mozilla Firefox`,
-	}
-
-	for _, browser := range browsers {
-		for _, path := range searchPaths {
-			fullPath := filepath.Join(path, browser)
-			if _, err := os.Stat(fullPath); err == nil {
-				return fullPath
-			}
-		}
-	}
-
-	return ""
-}
-
-// Run comprehensive test suite
-func RunComprehensiveTests() []TestResults {
-	config := getDefaultTestConfig()
-	var results []TestResults
-
-	// Browser automation tests
-	if config.EnableBrowserTests {
-		browserResults := runBrowserTests(config)
-		results = append(results, browserResults...)
-	}
-
-	// Performance tests
-	if config.EnablePerformanceTests {
-		perfResults := runPerformanceTests(config)
-		results = append(results, perfResults...)
-	}
-
-	// Accuracy tests
-	if config.EnableAccuracyTests {
-		accuracyResults := runAccuracyTests(config)
-		results = append(results, accuracyResults...)
-	}
-
-	// Generate test report
-	generateTestReport(results)
-
-	return results
-}
-
-// Browser automation tests
-func runBrowserTests(config TestConfig) []TestResults {
-	var results []TestResults
-
-	testCases := []BrowserTestCase{
-		{
-			Name: "Basic Navigation Test",
-			URL:  "https://example.com",
-			Actions: []BrowserAction{
-				{Type: "navigate", Target: "https://example.com", Delay: 2000},
-				{Type: "click", Target: "h1", Delay: 1000},
-				{Type: "scroll", Target: "body", Value: "500", Delay: 1000},
-			},
-			Validations: []ValidationCheck{
-				{Type: "title_contains", Expected: "Example"},
-				{Type: "element_exists", Target: "h1"},
-			},
-		},
-		{
-			Name: "Form Interaction Test",
-			URL:  "data:text/html,<html><body><form><input type='text' id='test-input' placeholder='Enter text'><button type='submit'>Submit</button></form></body></html>",
-			Actions: []BrowserAction{
-				{Type: "type", Target: "#test-input", Value: "Test input data", Delay: 1000},
-				{Type: "click", Target: "button[type='submit']", Delay: 1000},
-			},
-			Validations: []ValidationCheck{
-				{Type: "input_value", Target: "#test-input", Expected: "Test input data"},
-			},
-		},
-		{
-			Name: "Dropdown and Autocomplete Test",
-			URL:  createTestPage(),
-			Actions: []BrowserAction{
-				{Type: "click", Target: "#dropdown", Delay: 500},
-				{Type: "click", Target: "#option2", Delay: 500},
-				{Type: "type", Target: "#autocomplete", Value: "auto", Delay: 1000},
-				{Type: "click", Target: ".suggestion:first-child", Delay: 500},
-			},
-			Validations: []ValidationCheck{
-				{Type: "dropdown_value", Target: "#dropdown", Expected: "option2"},
-				{Type: "autocomplete_selected", Target: "#autocomplete"},
-			},
-		},
-	}
-
-	for _, testCase := range testCases {
-		result := runSingleBrowserTest(testCase, config)
-		results = append(results, result)
-	}
-
-	return results
-}
-
-// Create test HTML page
-func createTestPage() string {
-	html := `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>UI Recorder Test Page</title>
-    <style>
-        body { font-family: Arial, sans-serif; padding: 20px; }
-        .container { max-width: 600px; margin: 0 auto; }
-        input, select, button { margin: 10px 0; padding: 10px; width: 200px; }
-        .suggestion { padding: 5px; cursor: pointer; border: 1px solid #ccc; }
-        .suggestion:hover { background: #f0f0f0; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>Test Page</h1>
-        
-        <select id="dropdown">
-            <option value="option1">Option 1</option>
-            <option value="option2">Option 2</option>
-            <option value="option3">Option 3</option>
-        </select>
-        
-        <input type="text" id="autocomplete" placeholder="Type for autocomplete">
-        <div id="suggestions"></div>
-        
-        <button id="test-button">Test Button</button>
-        
-        <iframe src="data:text/html,<h2>Iframe Content</h2><button>Iframe Button</button>" width="300" height="150"></iframe>
-    </div>
-    
-    <script>
-        // Autocomplete functionality
-        document.getElementById('autocomplete').addEventListener('input', function(e) {
-            const value = e.target.value;
-            const suggestions = ['auto-complete', 'auto-save', 'auto-update'];
-            const suggestionDiv = document.getElementById('suggestions');
-            
-            if (value.length > 0) {
-                const filtered = suggestions.filter(s => s.startsWith(value));
-                suggestionDiv.innerHTML = filtered.map(s => 
-                    '<div class="suggestion">' + s + '</div>'
-                ).join('');
-                
-                // Add click handlers
-                document.querySelectorAll('.suggestion').forEach(s => {
-                    s.addEventListener('click', function() {
-                        document.getElementById('autocomplete').value = this.textContent;
-                        suggestionDiv.innerHTML = '';
-                    });
-                });
-            } else {
-                suggestionDiv.innerHTML = '';
-            }
-        });
-    </script>
-</body>
-</html>`
-
-	return "data:text/html," + html
-}
-
-// Run single browser test
-func runSingleBrowserTest(testCase BrowserTestCase, config TestConfig) TestResults {
-	startTime := time.Now()
-	result := TestResults{
-		TestName:           testCase.Name,
-		Passed:             false,
-		EventsRecorded:     0,
-		ErrorsDetected:     []string{},
-		PerformanceMetrics: make(map[string]float64),
-	}
-
-	// Start event recording
-	recorder := startTestEventRecording()
-	defer stopTestEventRecording(recorder)
-
-	// Execute browser actions
-	if config.BrowserPath != "" {
-		err := executeBrowserActions(testCase, config)
-		if err != nil {
-			result.ErrorsDetected = append(result.ErrorsDetected, err.Error())
-		}
-
-		// Allow time for events to be recorded
-		time.Sleep(2 * time.Second)
-
-		// Validate results
-		validationsPassed := runValidations(testCase.Validations)
-		result.Passed = validationsPassed && len(result.ErrorsDetected) == 0
-	} else {
-		result.ErrorsDetected = append(result.ErrorsDetected, "No browser found")
-	}
-
-	result.ExecutionTimeMs = time.Since(startTime).Milliseconds()
-	result.EventsRecorded = getRecordedEventCount(recorder)
-
-	return result
-}
-
-// Execute browser actions using command line
-func executeBrowserActions(testCase BrowserTestCase, config TestConfig) error {
-	// Launch browser with the test URL
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	args := []string{
-		"--new-window",
-		"--disable-extensions",
-		"--disable-plugins",
-		testCase.URL,
-	}
-
-	cmd := exec.CommandContext(ctx, config.BrowserPath, args...)
-	err := cmd.Start()
-	if err != nil {
-		return fmt.Errorf("failed to start browser: %v", err)
-	}
-
-	// Wait for browser to load
-	time.Sleep(3 * time.Second)
-
-	// Simulate actions using Windows API
-	for _, action := range testCase.Actions {
-		err := simulateAction(action)
-		if err != nil {
-			return fmt.Errorf("failed to simulate action %s: %v", action.Type, err)
-		}
-
-		if action.Delay > 0 {
-			time.Sleep(time.Duration(action.Delay) * time.Millisecond)
-		}
-	}
-
-	// Close browser
-	cmd.Process.Kill()
-
-	return nil
-}
-
-// Simulate browser actions
-func simulateAction(action BrowserAction) error {
-	switch action.Type {
-	case "navigate":
-		// Browser navigation is handled by the initial URL
-		return nil
-	case "click":
-		// Simulate mouse click at current position
-		return simulateMouseClick()
-	case "type":
-		// Simulate keyboard typing
-		return simulateKeyboardInput(action.Value)
-	case "scroll":
-		// Simulate scroll wheel
-		return simulateScroll(action.Value)
-	default:
-		return fmt.Errorf("unknown action type: %s", action.Type)
-	}
-}
-
-// Performance tests
-func runPerformanceTests(config TestConfig) []TestResults {
-	var results []TestResults
-
-	// CPU usage test
-	cpuResult := testCPUUsage(config)
-	results = append(results, cpuResult)
-
-	// Memory usage test
-	memResult := testMemoryUsage(config)
-	results = append(results, memResult)
-
-	// Event processing speed test
-	speedResult := testEventProcessingSpeed(config)
-	results = append(results, speedResult)
-
-	return results
-}
-
-// Test CPU usage during recording
-func testCPUUsage(config TestConfig) TestResults {
-	startTime := time.Now()
-	result := TestResults{
-		TestName:           "CPU Usage Test",
-		PerformanceMetrics: make(map[string]float64),
-	}
-
-	// Start monitoring CPU usage
-	initialCPU := getCurrentCPUUsage()
-
-	// Start recording and simulate activity
-	recorder := startTestEventRecording()
-	simulateUserActivity(5 * time.Second)
-	stopTestEventRecording(recorder)
-
-	// Measure final CPU usage
-	finalCPU := getCurrentCPUUsage()
-
-	result.PerformanceMetrics["initial_cpu_percent"] = initialCPU
-	result.PerformanceMetrics["final_cpu_percent"] = finalCPU
-	result.PerformanceMetrics["cpu_increase_percent"] = finalCPU - initialCPU
-	result.Passed = (finalCPU - initialCPU) < 50.0 // CPU increase should be less than 50%
-	result.ExecutionTimeMs = time.Since(startTime).Milliseconds()
-
-	return result
-}
-
-// Test memory usage
-func testMemoryUsage(config TestConfig) TestResults {
-	startTime := time.Now()
-	result := TestResults{
-		TestName:           "Memory Usage Test",
-		PerformanceMetrics: make(map[string]float64),
-	}
-
-	// Get initial memory stats
-	var initialMem runtime.MemStats
-	runtime.GC()
-	runtime.ReadMemStats(&initialMem)
-
-	// Start recording and simulate activity
-	recorder := startTestEventRecording()
-	simulateUserActivity(10 * time.Second)
-	stopTestEventRecording(recorder)
-
-	// Get final memory stats
-	var finalMem runtime.MemStats
-	runtime.GC()
-	runtime.ReadMemStats(&finalMem)
-
-	result.PerformanceMetrics["initial_alloc_mb"] = float64(initialMem.Alloc) / 1024 / 1024
-	result.PerformanceMetrics["final_alloc_mb"] = float64(finalMem.Alloc) / 1024 / 1024
-	result.PerformanceMetrics["memory_increase_mb"] = float64(finalMem.Alloc-initialMem.Alloc) / 1024 / 1024
-
-	memoryIncrease := float64(finalMem.Alloc-initialMem.Alloc) / 1024 / 1024
-	result.Passed = memoryIncrease < 100.0 // Memory increase should be less than 100MB
-	result.ExecutionTimeMs = time.Since(startTime).Milliseconds()
-
-	return result
-}
-
-// Test event processing speed
-func testEventProcessingSpeed(config TestConfig) TestResults {
-	startTime := time.Now()
-	result := TestResults{
-		TestName:           "Event Processing Speed Test",
-		PerformanceMetrics: make(map[string]float64),
-	}
-
-	// Generate rapid events and measure processing time
-	eventCount := 1000
-	processingStartTime := time.Now()
-
-	for i := 0; i < eventCount; i++ {
-		// Simulate rapid mouse movements
-		simulateMouseMove()
-		time.Sleep(1 * time.Millisecond)
-	}
-
-	processingTime := time.Since(processingStartTime)
-
-	result.PerformanceMetrics["events_processed"] = float64(eventCount)
-	result.PerformanceMetrics["processing_time_ms"] = float64(processingTime.Milliseconds())
-	result.PerformanceMetrics["events_per_second"] = float64(eventCount) / processingTime.Seconds()
-
-	eventsPerSecond := float64(eventCount) / processingTime.Seconds()
-	result.Passed = eventsPerSecond > 500 // Should process at least 500 events per second
-	result.ExecutionTimeMs = time.Since(startTime).Milliseconds()
-
-	return result
-}
-
-// Accuracy tests
-func runAccuracyTests(config TestConfig) []TestResults {
-	var results []TestResults
-
-	// Mouse event accuracy test
-	mouseResult := testMouseEventAccuracy()
-	results = append(results, mouseResult)
-
-	// Keyboard event accuracy test
-	keyboardResult := testKeyboardEventAccuracy()
-	results = append(results, keyboardResult)
-
-	// Clipboard event accuracy test
-	clipboardResult := testClipboardEventAccuracy()
-	results = append(results, clipboardResult)
-
-	return results
-}
-
-// Placeholder functions for test implementation
-func startTestEventRecording() interface{} {
-	// Would start the actual event recording system
-	return nil
-}
-
-func stopTestEventRecording(recorder interface{}) {
-	// Would stop the event recording system
-}
-
-func getRecordedEventCount(recorder interface{}) int {
-	// Would return the number of events recorded
-	return 0
-}
-
-func runValidations(validations []ValidationCheck) bool {
-	// Would run the validation checks
-	return true
-}
-
-func simulateMouseClick() error {
-	// Would simulate a mouse click using Windows API
-	return nil
-}
-
-func simulateKeyboardInput(text string) error {
-	// Would simulate keyboard input using Windows API
-	return nil
-}
-
-func simulateScroll(value string) error {
-	// Would simulate scroll wheel using Windows API
-	return nil
-}
-
-func getCurrentCPUUsage() float64 {
-	// Would get current CPU usage percentage
-	return 10.0
-}
-
-func simulateUserActivity(duration time.Duration) {
-	// Would simulate various user activities
-}
-
-func simulateMouseMove() {
-	// Would simulate mouse movement
-}
-
-func testMouseEventAccuracy() TestResults {
-	return TestResults{
-		TestName:           "Mouse Event Accuracy Test",
-		Passed:             true,
-		ExecutionTimeMs:    1000,
-		PerformanceMetrics: make(map[string]float64),
-	}
-}
-
-func testKeyboardEventAccuracy() TestResults {
-	return TestResults{
-		TestName:           "Keyboard Event Accuracy Test",
-		Passed:             true,
-		ExecutionTimeMs:    1000,
-		PerformanceMetrics: make(map[string]float64),
-	}
-}
-
-func testClipboardEventAccuracy() TestResults {
-	return TestResults{
-		TestName:           "Clipboard Event Accuracy Test",
-		Passed:             true,
-		ExecutionTimeMs:    1000,
-		PerformanceMetrics: make(map[string]float64),
-	}
-}
-
-// Generate test report
-func generateTestReport(results []TestResults) {
-	report := map[string]interface{}{
-		"test_summary": map[string]interface{}{
-			"total_tests":  len(results),
-			"passed_tests": countPassedTests(results),
-			"failed_tests": countFailedTests(results),
-			"timestamp":    time.Now().Format(time.RFC3339),
-		},
-		"test_results": results,
-	}
-
-	// Write to file
-	reportJSON, err := json.MarshalIndent(report, "", "  ")
-	if err != nil {
-		fmt.Printf("Error generating test report: %v\n", err)
-		return
-	}
-
-	filename := fmt.Sprintf("test_report_%s.json", time.Now().Format("20060102_150405"))
-	err = os.WriteFile(filename, reportJSON, 0644)
-	if err != nil {
-		fmt.Printf("Error writing test report: %v\n", err)
-		return
-	}
-
-	fmt.Printf("Test report generated: %s\n", filename)
-
-	// Print summary
-	fmt.Printf("\nTest Summary:\n")
-	fmt.Printf("Total Tests: %d\n", len(results))
-	fmt.Printf("Passed: %d\n", countPassedTests(results))
-	fmt.Printf("Failed: %d\n", countFailedTests(results))
-}
-
-func countPassedTests(results []TestResults) int {
-	count := 0
-	for _, result := range results {
-		if result.Passed {
-			count++
-		}
-	}
-	return count
-}
-
-func countFailedTests(results []TestResults) int {
-	count := 0
-	for _, result := range results {
-		if !result.Passed {
-			count++
-		}
-	}
-	return count
-}
-
-// HTTP test server for web-based tests
-func startTestServer() *httptest.Server {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(createTestPage()))
-	})
-
-	mux.HandleFunc("/api/test", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"status": "ok", "message": "Test endpoint"}`))
-	})
-
-	return httptest.NewServer(mux)
-}
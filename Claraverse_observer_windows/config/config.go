@@ -0,0 +1,228 @@
+// Package config is the configuration of the ClaraVerse UI recorder: the
+// settings a recording is made with, their defaults and the per-application
+// profiles and quotas that adjust them. It does not read flags or files;
+// programs embedding the recorder fill a Config, usually starting from
+// Default, and hand it to the recorder package.
+package config
+
+// PerformanceMode trades capture detail for CPU and battery
+type PerformanceMode int
+
+const (
+	Normal PerformanceMode = iota
+	Balanced
+	LowEnergy
+)
+
+// String returns the string representation of PerformanceMode
+func (pm PerformanceMode) String() string {
+	switch pm {
+	case Normal:
+		return "Normal"
+	case Balanced:
+		return "Balanced"
+	case LowEnergy:
+		return "LowEnergy"
+	default:
+		return "Unknown"
+	}
+}
+
+// DefaultPauseHotkey toggles capture unless PauseHotkey says otherwise
+const DefaultPauseHotkey = "Ctrl+Alt+R"
+
+// Update channels
+const (
+	UpdateChannelStable = "stable"
+	UpdateChannelBeta   = "beta"
+)
+
+// Screenshot capture methods. ScreenshotCaptureMethod picks one, or "auto"
+// for GDI with desktop duplication where GDI cannot capture.
+const (
+	CaptureMethodAuto               = "auto"
+	CaptureMethodGDI                = "gdi"
+	CaptureMethodDesktopDuplication = "desktop_duplication"
+)
+
+// Config is how the recorder records: what it captures, where it saves and
+// sends recordings and how it throttles itself. Start from Default.
+type Config struct {
+	RecordMouse                   bool
+	RecordKeyboard                bool
+	CaptureUIElements             bool
+	RecordClipboard               bool
+	RecordHotkeys                 bool
+	RecordTextInputCompletion     bool
+	TextInputCompletionTimeoutMs  int64
+	RecordApplicationSwitches     bool
+	RecordBrowserTabNavigation    bool
+	RecordTextSelection           bool
+	RecordDragDrop                bool
+	RecordWindowGeometry          bool     // Record windows being moved, resized, minimized, maximized and restored
+	RecordWindowTitles            bool     // Record the title of the window in front changing, with the title before and after
+	RecordProcesses               bool     // Record applications being launched and exiting
+	RecordMenuSelections          bool     // Record the items chosen from menu bars, context menus and window menus
+	RecordDialogs                 bool     // Record message boxes, file pickers and other standard dialogs opening and closing, and the files chosen in file pickers
+	RecordFocusChanges            bool     // Record keyboard focus moving between controls, with the role and name of each
+	OfficeContext                 bool     // Add the workbook, sheet and selection, document, or presentation and slide to events recorded in Excel, Word and PowerPoint
+	WatchFolders                  []string // Record files being created, modified and renamed in these folders; "~" is the home folder
+	AppSwitchDwellTimeThresholdMs int64
+	BrowserDetectionTimeoutMs     int64
+	MaxClipboardContentLength     int
+	SelectionClipboardFallback    bool
+	ExportSegments                bool
+	PauseHotkey                   string         // Toggles capture, e.g. "Ctrl+Alt+R"; empty disables it
+	CustomHotkeys                 []CustomHotkey // Application shortcuts to recognize besides the built-in ones
+	AnnotationPrompt              bool           // Ask for a note when an annotation is added
+	DryRun                        bool
+	Strict                        bool // Leave out events that break the recording schema, counting them
+	ExcludePasswordFields         bool
+	StrictPrivacy                 bool
+	MaskPII                       bool
+	PIIEntities                   []string
+	PIIPatterns                   []PIIPattern
+	UpdateEndpoint                string
+	UpdateChannel                 string
+	UpdatePublicKey               string
+	AutoUpdate                    bool
+	TelemetryEndpoint             string // Where opt-in health reports are sent; empty sends none
+	Locale                        string
+	OutputDirectory               string            // Where recordings are saved; empty for the working directory
+	MaxRecordingMinutes           int               // Stop or rotate the recording after this long; 0 for no limit
+	MaxRecordingSizeMB            int               // Stop or rotate the recording at about this size; 0 for no limit
+	RotateRecording               bool              // At a limit, save and carry on in a new file instead of stopping
+	ChunkMinutes                  int               // Also write the recording in chunks of this many minutes; 0 for none
+	ChunkEvents                   int               // Also write the recording in chunks of this many events; 0 for none
+	AutosaveSeconds               int               // Without chunks, flush events to disk this often until the recording is saved; 0 for never
+	ScreenshotStore               string            // Shared directory saved recordings keep their screenshots in; empty keeps them in the recording
+	LogFile                       string            // Write the log to this file instead of the console; empty for the console
+	LogMaxSizeMB                  int               // Rotate the log file at this size; 0 for never
+	LogMaxFiles                   int               // Rotated log files kept
+	LogLevel                      string            // debug, info, warn or error; info when empty
+	LogFormat                     string            // text or json
+	LogModuleLevels               map[string]string // Log level by module, overriding LogLevel, e.g. {"cdp":"debug"}
+	Quiet                         bool              // Log only warnings and errors, without banners or a line per event
+	Verbose                       bool              // Log at debug
+	Silent                        bool              // Print nothing: console lines go to the log and ConsoleHook
+	KeyboardMode                  bool              // Tune recording for keyboard-driven work: no mouse moves, every key with its chord and caret, terminal commands
+	TrayIcon                      bool              // Show the recording state and controls in the notification area
+	IdleThresholdSeconds          int               // Stop capturing after this long without input, until the next; 0 never
+	ExportAnalytics               bool              // Write time per application, window and page beside each saved recording
+	WatchdogTimeoutSeconds        int               // Restart the capture loop, or a tracker, after this long without progress; 0 never
+	TaskIdleGapMs                 int64
+	CDPDebuggingURL               string
+	HTTPAPIAddress                string
+	HTTPAPIToken                  string // Bearer token for HTTP API requests; generated at start when empty
+	NTPServer                     string
+	VisionEndpoint                string
+	VisionModel                   string
+	VisionAPIKey                  string
+	VisionCropToElement           bool
+	VisionTimeoutMs               int64
+	OCRCommand                    string
+	OCRLanguage                   string
+	OCRMinConfidence              float64
+	OCRTimeoutMs                  int64
+	MouseMoveThrottleMs           int64
+	MinDragDistance               float64
+	PerformanceMode               PerformanceMode
+	EventProcessingDelayMs        *int64
+	MaxEventsPerSecond            *int32
+	EventRateLimits               map[string]string // Limits by event category, e.g. {"mouse_move": "10/s", "screenshot": "1/5s", "keyboard": "unlimited"}; others follow MaxEventsPerSecond
+	DedupeWindowMs                int64
+	FilterMouseNoise              bool
+	FilterKeyboardNoise           bool
+	ReduceUIElementCapture        bool
+	CaptureScreenshots            bool
+	ScreenshotOnMouseClick        bool
+	ActionScreenshotPairs         bool  // Screenshot clicks from just before and once the screen has settled after, instead of as they are recorded
+	ActionScreenshotSettleMs      int64 // The longest to wait for the screen to settle after a click
+	ScreenshotOnKeyboardEvent     bool
+	ScreenshotHotkeys             []ScreenshotHotkey // Key presses that take a screenshot, e.g. Ctrl+S, or Enter in a browser
+	ScreenshotOnInterval          bool
+	ScreenshotIntervalMs          int64
+	ScreenshotThrottleMs          int64
+	ScreenshotOnAppSwitch         bool
+	ScreenshotFormat              string
+	ScreenshotJPEGQuality         int
+	ScreenshotCaptureMethod       string // "auto", "gdi" or "desktop_duplication"
+	AnnotateScreenshots           bool
+	MaxScreenshotWidth            *int
+	MaxScreenshotHeight           *int
+	ScreenshotEncodeWorkers       int // Goroutines encoding screenshots off the capture loop; 0 encodes on it
+	IgnoreFocusPatterns           []string
+	IgnoreWindowTitles            []string
+	IgnoreApplications            []string
+	ApplicationProfiles           []ApplicationProfile
+	RecordingQuotas               []RecordingQuota
+	EventSinks                    []EventSinkConfig // Where recorded events are streamed as they happen
+}
+
+// Default returns the settings the recorder uses when nothing overrides them
+func Default() Config {
+	return Config{
+		RecordMouse:                   true,
+		RecordKeyboard:                true,
+		CaptureUIElements:             true,
+		RecordClipboard:               true,
+		RecordHotkeys:                 true,
+		RecordTextInputCompletion:     true,
+		TextInputCompletionTimeoutMs:  3000,
+		RecordApplicationSwitches:     true,
+		RecordBrowserTabNavigation:    true,
+		RecordTextSelection:           true,
+		RecordDragDrop:                true,
+		RecordWindowGeometry:          true,
+		RecordWindowTitles:            true,
+		RecordMenuSelections:          true,
+		RecordDialogs:                 true,
+		ExcludePasswordFields:         true,
+		PauseHotkey:                   DefaultPauseHotkey,
+		AppSwitchDwellTimeThresholdMs: 100,
+		BrowserDetectionTimeoutMs:     1000,
+		MaxClipboardContentLength:     10240,
+		TaskIdleGapMs:                 60000,
+		AutosaveSeconds:               30,
+		WatchdogTimeoutSeconds:        30,
+		LogMaxSizeMB:                  10,
+		LogMaxFiles:                   5,
+		VisionModel:                   "llava",
+		VisionTimeoutMs:               30000,
+		OCRLanguage:                   "eng",
+		OCRMinConfidence:              60,
+		OCRTimeoutMs:                  20000,
+		UpdateChannel:                 UpdateChannelStable,
+		MouseMoveThrottleMs:           100,
+		MinDragDistance:               5.0,
+		PerformanceMode:               Normal,
+		DedupeWindowMs:                100,
+		FilterMouseNoise:              false,
+		FilterKeyboardNoise:           false,
+		ReduceUIElementCapture:        false,
+		CaptureScreenshots:            true,
+		ScreenshotOnMouseClick:        true,
+		ActionScreenshotSettleMs:      2000,
+		ScreenshotOnKeyboardEvent:     false,
+		ScreenshotOnInterval:          false,
+		ScreenshotIntervalMs:          5000,
+		ScreenshotThrottleMs:          100,
+		ScreenshotOnAppSwitch:         true,
+		ScreenshotFormat:              "png",
+		ScreenshotJPEGQuality:         85,
+		ScreenshotCaptureMethod:       CaptureMethodAuto,
+		ScreenshotEncodeWorkers:       2,
+		IgnoreFocusPatterns: []string{
+			"notification", "tooltip", "popup",
+			"sharing your screen", "recording screen", "screen capture",
+			"1password", "lastpass", "bitwarden", "keepass", "dashlane",
+			"battery", "volume", "network", "wifi",
+		},
+		IgnoreWindowTitles: []string{
+			"Task Manager", "System Tray", "Hidden Icons",
+		},
+		IgnoreApplications: []string{
+			"dwm.exe", "winlogon.exe", "csrss.exe",
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// CustomHotkey is a hotkey pattern added by the config file, such as an
+// IDE's or Photoshop's bindings
+type CustomHotkey struct {
+	Keys         string   `json:"keys"`                   // e.g. "Ctrl+Shift+P", or "Ctrl+K Ctrl+C" for a chord
+	Label        string   `json:"label,omitempty"`        // How the combination is recorded; defaults to Keys
+	Action       string   `json:"action"`                 // e.g. "Command Palette"
+	Category     string   `json:"category,omitempty"`     // Defaults to "Custom"
+	Global       bool     `json:"global,omitempty"`       // Handled by the system rather than the application
+	Applications []string `json:"applications,omitempty"` // Process names it applies in, e.g. "code.exe"; empty for all
+}
+
+// ScreenshotHotkey is a key press that takes a screenshot
+type ScreenshotHotkey struct {
+	Keys         string   `json:"keys"`                   // e.g. "Ctrl+S", or a single key such as "Enter"
+	Applications []string `json:"applications,omitempty"` // Process names it applies in, e.g. "chrome.exe"; empty for all
+}
+
+// PIIPattern is a custom detector: text matching Pattern is masked as Name
+type PIIPattern struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// EventSinkConfig configures one event sink
+type EventSinkConfig struct {
+	Type      string            `json:"type"`                 // file, stdout, http or kafka
+	Path      string            `json:"path,omitempty"`       // file: the NDJSON file events are appended to
+	URL       string            `json:"url,omitempty"`        // http: the endpoint batches are POSTed to; otlp: the OTLP/HTTP endpoint
+	Headers   map[string]string `json:"headers,omitempty"`    // http and otlp: added to every request, e.g. Authorization
+	Brokers   []string          `json:"brokers,omitempty"`    // kafka: bootstrap brokers as host:port
+	Topic     string            `json:"topic,omitempty"`      // kafka: the topic events are produced to
+	BatchSize int               `json:"batch_size,omitempty"` // http, kafka and otlp: events (spans for otlp) per request; 100 when 0
+	FlushMs   int64             `json:"flush_ms,omitempty"`   // http, kafka and otlp: longest an event waits to be sent; 1000 when 0
+
+	ServiceName string `json:"service_name,omitempty"` // otlp: the service.name spans are reported under; ui_recorder when empty
+}
+
+// ApplicationProfile overrides recording settings for the applications it
+// matches (nil means use the base setting)
+type ApplicationProfile struct {
+	Name         string   `json:"name"`
+	Applications []string `json:"applications,omitempty"`  // Process names, e.g. "excel.exe"
+	WindowTitles []string `json:"window_titles,omitempty"` // Window title substrings, case-insensitive
+
+	// Screenshot policy
+	CaptureScreenshots        *bool `json:"capture_screenshots,omitempty"`
+	ScreenshotOnMouseClick    *bool `json:"screenshot_on_mouse_click,omitempty"`
+	ScreenshotOnKeyboardEvent *bool `json:"screenshot_on_keyboard_event,omitempty"`
+	ScreenshotOnInterval      *bool `json:"screenshot_on_interval,omitempty"`
+	ScreenshotOnAppSwitch     *bool `json:"screenshot_on_app_switch,omitempty"`
+
+	// Filters
+	FilterMouseNoise    *bool `json:"filter_mouse_noise,omitempty"`
+	FilterKeyboardNoise *bool `json:"filter_keyboard_noise,omitempty"`
+
+	// Sensitivity
+	RecordKeyboard            *bool `json:"record_keyboard,omitempty"`
+	RecordClipboard           *bool `json:"record_clipboard,omitempty"`
+	RecordTextInputCompletion *bool `json:"record_text_input_completion,omitempty"`
+	RecordTextSelection       *bool `json:"record_text_selection,omitempty"`
+
+	// Keyboard mode, e.g. for terminals and IDEs
+	KeyboardMode *bool `json:"keyboard_mode,omitempty"`
+}
+
+// Matches reports whether the profile applies to an application or window
+// title
+func (p *ApplicationProfile) Matches(appName, windowTitle string) bool {
+	for _, application := range p.Applications {
+		if strings.EqualFold(appName, application) ||
+			strings.EqualFold(strings.TrimSuffix(strings.ToLower(appName), ".exe"), application) {
+			return true
+		}
+	}
+
+	titleLower := strings.ToLower(windowTitle)
+	for _, title := range p.WindowTitles {
+		if title != "" && strings.Contains(titleLower, strings.ToLower(title)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply returns config with the profile's overrides
+func (p *ApplicationProfile) Apply(config Config) Config {
+	if p == nil {
+		return config
+	}
+
+	overrides := []struct {
+		value   *bool
+		setting *bool
+	}{
+		{p.CaptureScreenshots, &config.CaptureScreenshots},
+		{p.ScreenshotOnMouseClick, &config.ScreenshotOnMouseClick},
+		{p.ScreenshotOnKeyboardEvent, &config.ScreenshotOnKeyboardEvent},
+		{p.ScreenshotOnInterval, &config.ScreenshotOnInterval},
+		{p.ScreenshotOnAppSwitch, &config.ScreenshotOnAppSwitch},
+		{p.FilterMouseNoise, &config.FilterMouseNoise},
+		{p.FilterKeyboardNoise, &config.FilterKeyboardNoise},
+		{p.RecordKeyboard, &config.RecordKeyboard},
+		{p.RecordClipboard, &config.RecordClipboard},
+		{p.RecordTextInputCompletion, &config.RecordTextInputCompletion},
+		{p.RecordTextSelection, &config.RecordTextSelection},
+		{p.KeyboardMode, &config.KeyboardMode},
+	}
+	for _, override := range overrides {
+		if override.value != nil {
+			*override.setting = *override.value
+		}
+	}
+	return config
+}
+
+// Quota periods
+const (
+	QuotaPeriodHour = "hour"
+	QuotaPeriodDay  = "day"
+)
+
+// Kinds of capture a quota limits
+const (
+	QuotaScreenshots = "screenshots"
+	QuotaContent     = "content"
+)
+
+// RecordingQuota caps capture from the applications it matches. The first
+// matching quota with a limit for the kind of event applies.
+type RecordingQuota struct {
+	Name           string   `json:"name"`
+	Applications   []string `json:"applications,omitempty"`    // Process names, e.g. "outlook.exe"
+	WindowTitles   []string `json:"window_titles,omitempty"`   // Window title substrings, case-insensitive
+	Period         string   `json:"period"`                    // hour or day
+	MaxScreenshots int      `json:"max_screenshots,omitempty"` // 0 for no limit
+	MaxContent     int      `json:"max_content,omitempty"`     // Clipboard, text input and selection events; 0 for no limit
+}
+
+// Limit returns the quota's limit for a kind of capture, 0 for none
+func (quota *RecordingQuota) Limit(kind string) int {
+	if kind == QuotaScreenshots {
+		return quota.MaxScreenshots
+	}
+	return quota.MaxContent
+}
+
+// PeriodBounds returns the start and end of the quota period holding now
+func (quota *RecordingQuota) PeriodBounds(now time.Time) (time.Time, time.Time) {
+	year, month, day := now.Date()
+	if quota.Period == QuotaPeriodHour {
+		start := time.Date(year, month, day, now.Hour(), 0, 0, 0, now.Location())
+		return start, start.Add(time.Hour)
+	}
+	start := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	return start, start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,229 @@
+// Package events is the recording format of the ClaraVerse UI recorder: the
+// events a recording is made of, as they are written to and read from its
+// JSON. Programs that read recordings, or embed the recorder, import it
+// rather than copying the types. The recorder itself uses these types under
+// the same names, so a field added here is recorded and saved everywhere.
+package events
+
+// WorkflowEvent is any recorded event
+type WorkflowEvent interface{}
+
+type Position struct {
+	X int32 `json:"x"`
+	Y int32 `json:"y"`
+}
+
+type UIElement struct {
+	Role            string     `json:"role"`
+	Name            string     `json:"name"`
+	Bounds          [4]float64 `json:"bounds"`
+	ProcessID       uint32     `json:"process_id"`
+	WindowTitle     string     `json:"window_title"`
+	ApplicationName string     `json:"application_name"`
+	URL             string     `json:"url,omitempty"`
+}
+
+type EventMetadata struct {
+	UIElement *UIElement     `json:"ui_element,omitempty"`
+	Office    *OfficeContext `json:"office,omitempty"` // Where in an Office document it happened, when recorded with office context
+	Timestamp uint64         `json:"timestamp"`
+	Sequence  uint64         `json:"seq,omitempty"` // Position in the recording, never reused
+}
+
+// OfficeContext is the document open in Excel, Word or PowerPoint, and
+// where in it the user was
+type OfficeContext struct {
+	Application string `json:"application"` // excel, word or powerpoint
+	Document    string `json:"document"`    // The workbook, document or presentation
+	Sheet       string `json:"sheet,omitempty"`
+	Selection   string `json:"selection,omitempty"` // The selected range, e.g. $B$2:$D$9
+	Slide       int    `json:"slide,omitempty"`
+}
+
+type MouseButton string
+
+const (
+	MouseButtonLeft   MouseButton = "Left"
+	MouseButtonRight  MouseButton = "Right"
+	MouseButtonMiddle MouseButton = "Middle"
+	MouseButtonNone   MouseButton = "None"
+)
+
+type MouseEventType string
+
+const (
+	MouseClick       MouseEventType = "Click"
+	MouseDoubleClick MouseEventType = "DoubleClick"
+	MouseRightClick  MouseEventType = "RightClick"
+	MouseDown        MouseEventType = "Down"
+	MouseUp          MouseEventType = "Up"
+	MouseMove        MouseEventType = "Move"
+	MouseWheel       MouseEventType = "Wheel"
+	MouseDrag        MouseEventType = "Drag"
+	MouseDragStart   MouseEventType = "DragStart"
+	MouseDragEnd     MouseEventType = "DragEnd"
+	MouseDrop        MouseEventType = "Drop"
+)
+
+type MouseEvent struct {
+	EventType   MouseEventType `json:"event_type"`
+	Button      MouseButton    `json:"button"`
+	Position    Position       `json:"position"`
+	ScrollDelta *[2]int32      `json:"scroll_delta,omitempty"`
+	DragStart   *Position      `json:"drag_start,omitempty"`
+	// ElementSelector identifies the clicked element for replay
+	ElementSelector *ElementSelector `json:"element_selector,omitempty"`
+	// Screenshots are the screen before and after a click, when recorded
+	// with action screenshot pairs
+	Screenshots *ScreenshotPair `json:"screenshots,omitempty"`
+	Metadata    EventMetadata   `json:"metadata"`
+}
+
+// ScreenshotPair is the capture IDs of the screenshots showing the screen
+// just before an action and once it had settled after
+type ScreenshotPair struct {
+	Before int64 `json:"before_capture_id"`
+	After  int64 `json:"after_capture_id"`
+}
+
+type ModifierStates struct {
+	Ctrl  bool `json:"ctrl"`
+	Alt   bool `json:"alt"`
+	Shift bool `json:"shift"`
+	Win   bool `json:"win"`
+}
+
+type KeyboardEvent struct {
+	KeyCode        uint32          `json:"key_code"`
+	IsKeyDown      bool            `json:"is_key_down"`
+	ModifierStates ModifierStates  `json:"modifier_states"`
+	Character      *string         `json:"character,omitempty"`
+	Redacted       bool            `json:"redacted,omitempty"` // Typed into a password field
+	IME            bool            `json:"ime,omitempty"`      // Composed through an IME: the keys of a composition, or the text it committed
+	Chord          string          `json:"chord,omitempty"`    // In keyboard mode, the key with its modifiers, e.g. "Ctrl+Shift+P"
+	Caret          *Position       `json:"caret,omitempty"`    // Where the text caret was
+	Scroll         *ScrollPosition `json:"scroll,omitempty"`   // How far the focused container was scrolled
+	Metadata       EventMetadata   `json:"metadata"`
+}
+
+type ClipboardAction string
+
+const (
+	ClipboardCopy  ClipboardAction = "Copy"
+	ClipboardCut   ClipboardAction = "Cut"
+	ClipboardPaste ClipboardAction = "Paste"
+	ClipboardClear ClipboardAction = "Clear"
+)
+
+type ClipboardEvent struct {
+	Action      ClipboardAction `json:"action"`
+	Content     string          `json:"content"`
+	ContentSize int             `json:"content_size"`
+	Format      string          `json:"format"`
+	Truncated   bool            `json:"truncated"`
+	Redacted    bool            `json:"redacted,omitempty"` // Copied with a password field focused
+	Metadata    EventMetadata   `json:"metadata"`
+}
+
+type HotkeyEvent struct {
+	Combination string        `json:"combination"`
+	Action      string        `json:"action"`
+	IsGlobal    bool          `json:"is_global"`
+	Metadata    EventMetadata `json:"metadata"`
+}
+
+type ApplicationSwitchMethod string
+
+const (
+	AppSwitchAltTab             ApplicationSwitchMethod = "AltTab"
+	AppSwitchTaskbarClick       ApplicationSwitchMethod = "TaskbarClick"
+	AppSwitchWindowsKeyShortcut ApplicationSwitchMethod = "WindowsKeyShortcut"
+	AppSwitchStartMenu          ApplicationSwitchMethod = "StartMenu"
+	AppSwitchWindowClick        ApplicationSwitchMethod = "WindowClick"
+	AppSwitchOther              ApplicationSwitchMethod = "Other"
+)
+
+type ApplicationSwitchEvent struct {
+	FromApplication string                  `json:"from_application"`
+	ToApplication   string                  `json:"to_application"`
+	FromProcessID   uint32                  `json:"from_process_id"`
+	ToProcessID     uint32                  `json:"to_process_id"`
+	SwitchMethod    ApplicationSwitchMethod `json:"switch_method"`
+	DwellTimeMs     uint64                  `json:"dwell_time_ms"`
+	SwitchCount     uint32                  `json:"switch_count"`
+	Metadata        EventMetadata           `json:"metadata"`
+}
+
+type ButtonInteractionType string
+
+const (
+	ButtonClick          ButtonInteractionType = "Click"
+	ButtonSubmit         ButtonInteractionType = "Submit"
+	ButtonCancel         ButtonInteractionType = "Cancel"
+	ButtonToggle         ButtonInteractionType = "Toggle"
+	ButtonDropdownToggle ButtonInteractionType = "DropdownToggle"
+)
+
+type ButtonClickEvent struct {
+	ButtonText      string                `json:"button_text"`
+	InteractionType ButtonInteractionType `json:"interaction_type"`
+	ButtonRole      string                `json:"button_role"`
+	WasEnabled      bool                  `json:"was_enabled"`
+	Position        Position              `json:"position"`
+	Metadata        EventMetadata         `json:"metadata"`
+}
+
+type ScreenshotTrigger string
+
+const (
+	ScreenshotTriggerMouseClick ScreenshotTrigger = "MouseClick"
+	ScreenshotTriggerKeyboard   ScreenshotTrigger = "Keyboard"
+	ScreenshotTriggerInterval   ScreenshotTrigger = "Interval"
+	ScreenshotTriggerAppSwitch  ScreenshotTrigger = "AppSwitch"
+)
+
+// ElementSelector identifies a clicked element within its window
+type ElementSelector struct {
+	AutomationID string `json:"automation_id,omitempty"`
+	Name         string `json:"name,omitempty"`
+	ControlType  string `json:"control_type,omitempty"` // e.g. "Button"
+	ClassName    string `json:"class_name,omitempty"`
+	Path         string `json:"path,omitempty"` // Control types below the window, e.g. "Pane/Group[2]/Button"
+	Application  string `json:"application,omitempty"`
+	WindowTitle  string `json:"window_title,omitempty"`
+}
+
+// ScrollPosition is how far a scrollable container is scrolled
+type ScrollPosition struct {
+	Horizontal float64 `json:"horizontal"` // Percent, or -1 when it does not scroll that way
+	Vertical   float64 `json:"vertical"`
+	Container  string  `json:"container,omitempty"` // Name of the container
+}
+
+// OCRWord is one recognized word. Bounds are x, y, width, height in
+// screenshot pixels; ScreenBounds are the same in screen coordinates.
+type OCRWord struct {
+	Text         string  `json:"text"`
+	Confidence   float64 `json:"confidence"`
+	Bounds       [4]int  `json:"bounds"`
+	ScreenBounds [4]int  `json:"screen_bounds"`
+	Line         int     `json:"line"`
+}
+
+// OCRResult is the text recognized in a screenshot
+type OCRResult struct {
+	Engine   string    `json:"engine"`
+	Language string    `json:"language"`
+	Text     string    `json:"text"`
+	Words    []OCRWord `json:"words,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// VisionCaption is the vision model's description of a screenshot
+type VisionCaption struct {
+	Caption  string   `json:"caption,omitempty"`
+	Elements []string `json:"elements,omitempty"`
+	Model    string   `json:"model,omitempty"`
+	Cropped  bool     `json:"cropped,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
@@ -0,0 +1,109 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Schema versions. A recording names the version of the format it was
+// saved in as schema_version; recordings saved before there was one are
+// version 1. Migrate upgrades an older recording one version at a time, so
+// a program reading recordings only has to understand the current version.
+//
+//	1  No schema_version. Recordings saved before events were numbered for
+//	   cursor sync have no metadata seq.
+//	2  schema_version is saved, and every event has a seq.
+//
+// A change that would break a reader of the previous version (a field
+// renamed, moved or given a new meaning) adds a version and a Migration.
+// New optional fields do not need one.
+
+// SchemaVersion is the version of the recording format these types describe
+const SchemaVersion = 2
+
+// Migration upgrades a decoded recording, or a chunk of one, from version
+// From to From+1. Numbers in it are json.Number.
+type Migration struct {
+	From    int
+	Migrate func(recording map[string]interface{}) error
+}
+
+// Migrations are applied in order to bring a recording up to SchemaVersion
+var Migrations = []Migration{
+	{From: 1, Migrate: numberEvents},
+}
+
+// Version returns the schema version of an encoded recording
+func Version(data []byte) (int, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	if header.SchemaVersion == 0 {
+		return 1, nil
+	}
+	return header.SchemaVersion, nil
+}
+
+// Migrate upgrades an encoded recording, or a chunk of one, to
+// SchemaVersion and returns it with the version it was saved in. A current
+// recording, or one from a newer recorder, is returned as it is.
+func Migrate(data []byte) ([]byte, int, error) {
+	version, err := Version(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version >= SchemaVersion {
+		return data, version, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var recording map[string]interface{}
+	if err := decoder.Decode(&recording); err != nil {
+		return nil, version, err
+	}
+	for _, migration := range Migrations {
+		if migration.From < version {
+			continue
+		}
+		if err := migration.Migrate(recording); err != nil {
+			return nil, version, fmt.Errorf("migrating schema version %d: %w", migration.From, err)
+		}
+	}
+	recording["schema_version"] = SchemaVersion
+
+	migrated, err := json.Marshal(recording)
+	return migrated, version, err
+}
+
+// numberEvents gives the events without a seq the next one after the
+// highest seen so far
+func numberEvents(recording map[string]interface{}) error {
+	events, _ := recording["events"].([]interface{})
+	var last uint64
+	for i, raw := range events {
+		event, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("event %d is not an object", i)
+		}
+		metadata, ok := event["metadata"].(map[string]interface{})
+		if !ok {
+			metadata = map[string]interface{}{}
+			event["metadata"] = metadata
+		}
+		if seq, ok := metadata["seq"].(json.Number); ok {
+			if n, err := strconv.ParseUint(seq.String(), 10, 64); err == nil && n > 0 {
+				last = max(last, n)
+				continue
+			}
+		}
+		last++
+		metadata["seq"] = json.Number(strconv.FormatUint(last, 10))
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package recorder
+
+import (
+	"image"
+	"sync"
+	"time"
+
+	"github.com/kbinani/screenshot"
+)
+
+// Action screenshot pairs. A screenshot taken as a click is recorded shows
+// the screen a moment after the button went up, often halfway through what
+// the click set off. With ActionScreenshotPairs set, the capture loop keeps
+// a small ring of frames grabbed every actionFrameInterval. When the button
+// goes down the newest frame is held back, and once the press is recorded
+// as a click that frame becomes a BeforeAction screenshot: the screen just
+// before the click, hover highlights at most. An AfterAction screenshot
+// follows once the screen has settled, when a frame at least
+// actionSettleDelay after the click differs from the one before it in no
+// more than actionSettleTolerance of its pixels (a blinking caret, a clock
+// ticking over), or at ActionScreenshotSettleMs regardless. The click's
+// MouseEvent names both screenshots by capture ID; the screenshots
+// themselves are recorded, encoded and stored like any other. A click before
+// the screen has settled from the last one takes that one's after
+// screenshot from the frame before it. Ordinary click screenshots are not
+// taken in this mode.
+
+const (
+	ScreenshotTriggerBeforeAction ScreenshotTrigger = "BeforeAction"
+	ScreenshotTriggerAfterAction  ScreenshotTrigger = "AfterAction"
+
+	actionFrameInterval   = 100 * time.Millisecond
+	actionFrameCount      = 3
+	actionSettleDelay     = 250 * time.Millisecond
+	actionSettleTolerance = 1000 // At most one pixel in this many may differ
+)
+
+// actionFrame is a frame of the screen held for an action screenshot
+type actionFrame struct {
+	Image     *image.RGBA // A pooled frame buffer
+	Bounds    image.Rectangle
+	Method    string
+	Protected bool
+	At        time.Time
+}
+
+// ActionScreenshots takes the screenshots before and after each click
+type ActionScreenshots struct {
+	Service   *ScreenshotService
+	Grab      func() (actionFrame, error) // Takes a frame of the screen
+	Frames    []actionFrame               // The most recent frames, oldest first
+	Before    *actionFrame                // The frame from before the button went down
+	AfterID   int64                       // Reserved for the screenshot after the last click; 0 when none is due
+	ClickedAt time.Time
+	Settle    time.Duration // The longest the after screenshot waits for the screen to settle
+	Mutex     sync.Mutex
+}
+
+// NewActionScreenshots creates the recorder of screenshot pairs, or returns
+// nil when ActionScreenshotPairs is off
+func NewActionScreenshots(config WorkflowRecorderConfig, service *ScreenshotService) *ActionScreenshots {
+	if !config.ActionScreenshotPairs || service == nil {
+		return nil
+	}
+	return &ActionScreenshots{
+		Service: service,
+		Grab:    service.grabFrame,
+		Settle:  time.Duration(config.ActionScreenshotSettleMs) * time.Millisecond,
+	}
+}
+
+// Sample adds a frame to the ring once actionFrameInterval has passed since
+// the last, and returns the screenshot after the last click once the screen
+// has settled. Where the application profile turns screenshots off, the
+// frames and any screenshot due are dropped, so none shows that screen.
+func (a *ActionScreenshots) Sample(now time.Time) *ScreenshotEvent {
+	if a == nil {
+		return nil
+	}
+	allowed := a.Service.ShouldCapture(ScreenshotTriggerAfterAction)
+	a.Mutex.Lock()
+	defer a.Mutex.Unlock()
+
+	if !allowed {
+		a.AfterID = 0
+		a.release()
+		a.drop()
+		return nil
+	}
+	if n := len(a.Frames); n > 0 && now.Sub(a.Frames[n-1].At) < actionFrameInterval {
+		return nil
+	}
+	frame, err := a.Grab()
+	if err != nil {
+		return nil
+	}
+	frame.At = now
+	if len(a.Frames) == actionFrameCount {
+		releaseFrameBuffer(a.Frames[0].Image)
+		a.Frames = append(a.Frames[:0], a.Frames[1:]...)
+	}
+	a.Frames = append(a.Frames, frame)
+
+	if a.AfterID == 0 || !a.settled(now) {
+		return nil
+	}
+	return a.after()
+}
+
+// settled reports whether the after screenshot is due at now
+func (a *ActionScreenshots) settled(now time.Time) bool {
+	if now.Sub(a.ClickedAt) >= a.Settle {
+		return true
+	}
+	n := len(a.Frames)
+	if now.Sub(a.ClickedAt) < actionSettleDelay || n < 2 || a.Frames[n-2].At.Before(a.ClickedAt) {
+		return false
+	}
+	return framesMatch(a.Frames[n-2].Image, a.Frames[n-1].Image)
+}
+
+// Press holds back the newest frame as the screen before the button went
+// down. It returns the screenshot still due after the last click, taken
+// from that same frame.
+func (a *ActionScreenshots) Press() *ScreenshotEvent {
+	if a == nil {
+		return nil
+	}
+	a.Mutex.Lock()
+	defer a.Mutex.Unlock()
+
+	var after *ScreenshotEvent
+	if a.AfterID != 0 {
+		after = a.after()
+	}
+	a.release()
+	if n := len(a.Frames); n > 0 {
+		before := a.Frames[n-1]
+		before.Image = copyFrame(before.Image)
+		a.Before = &before
+	}
+	return after
+}
+
+// Click records the press held back as a click at now: it returns the
+// screenshot before it and the capture IDs of the pair, the screenshot after
+// being due once the screen settles. Both are nil when no frame was held.
+func (a *ActionScreenshots) Click(now time.Time) (*ScreenshotEvent, *ScreenshotPair) {
+	if a == nil {
+		return nil, nil
+	}
+	a.Mutex.Lock()
+	defer a.Mutex.Unlock()
+
+	if a.Before == nil {
+		return nil, nil
+	}
+	before := a.shoot(*a.Before, ScreenshotTriggerBeforeAction, 0)
+	a.Before = nil
+	if before == nil {
+		return nil, nil
+	}
+	a.AfterID, a.ClickedAt = a.Service.NextCaptureID(), now
+	return before, &ScreenshotPair{Before: before.CaptureID, After: a.AfterID}
+}
+
+// Cancel lets go of the frame held back, the press not being a click
+func (a *ActionScreenshots) Cancel() {
+	if a == nil {
+		return
+	}
+	a.Mutex.Lock()
+	defer a.Mutex.Unlock()
+
+	a.release()
+}
+
+// Close returns the screenshot still due after the last click, taken from
+// the newest frame, and frees the frames
+func (a *ActionScreenshots) Close() *ScreenshotEvent {
+	if a == nil {
+		return nil
+	}
+	a.Mutex.Lock()
+	defer a.Mutex.Unlock()
+
+	var after *ScreenshotEvent
+	if a.AfterID != 0 {
+		after = a.after()
+	}
+	a.release()
+	a.drop()
+	return after
+}
+
+// after takes the screenshot after the last click from the newest frame
+func (a *ActionScreenshots) after() *ScreenshotEvent {
+	id := a.AfterID
+	a.AfterID = 0
+	n := len(a.Frames)
+	if n == 0 {
+		return nil
+	}
+	newest := a.Frames[n-1]
+	newest.Image = copyFrame(newest.Image)
+	return a.shoot(newest, ScreenshotTriggerAfterAction, id)
+}
+
+// shoot makes a screenshot of frame, whose image it takes over
+func (a *ActionScreenshots) shoot(frame actionFrame, trigger ScreenshotTrigger, captureID int64) *ScreenshotEvent {
+	return a.Service.screenshotOf(frame.Image, frame.Bounds, frame.Method, frame.Protected, trigger, "", a.Service.deferEncoding(), captureID)
+}
+
+// release frees the frame held back, if any
+func (a *ActionScreenshots) release() {
+	if a.Before != nil {
+		releaseFrameBuffer(a.Before.Image)
+		a.Before = nil
+	}
+}
+
+// drop frees the frames in the ring
+func (a *ActionScreenshots) drop() {
+	for _, frame := range a.Frames {
+		releaseFrameBuffer(frame.Image)
+	}
+	a.Frames = nil
+}
+
+// grabFrame takes a frame of the primary display for the ring
+func (ss *ScreenshotService) grabFrame() (actionFrame, error) {
+	bounds := screenshot.GetDisplayBounds(0)
+	img, method, protected, err := ss.captureScreen(bounds)
+	if err != nil {
+		return actionFrame{}, err
+	}
+	return actionFrame{Image: img, Bounds: bounds, Method: method, Protected: protected}, nil
+}
+
+// copyFrame copies img into a pooled frame buffer
+func copyFrame(img *image.RGBA) *image.RGBA {
+	copied := acquireFrameBuffer(img.Rect.Dx(), img.Rect.Dy())
+	copy(copied.Pix, img.Pix)
+	return copied
+}
+
+// framesMatch reports whether two frames differ in no more than
+// actionSettleTolerance of their pixels
+func framesMatch(a, b *image.RGBA) bool {
+	if a.Rect != b.Rect || len(a.Pix) != len(b.Pix) {
+		return false
+	}
+	allowed := len(a.Pix) / 4 / actionSettleTolerance
+	differing := 0
+	for i := 0; i+3 < len(a.Pix); i += 4 {
+		if a.Pix[i] != b.Pix[i] || a.Pix[i+1] != b.Pix[i+1] || a.Pix[i+2] != b.Pix[i+2] {
+			if differing++; differing > allowed {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package recorder
+
+import (
+	"unsafe"
+)
+
+// Additional screenshot triggers beyond the basic ones already defined
+const (
+	ScreenshotTriggerManual   ScreenshotTrigger = "Manual"
+	ScreenshotTriggerUIChange ScreenshotTrigger = "UIChange"
+)
+
+// Monitor information structure
+type MonitorInfo struct {
+	Name   string
+	Width  int32
+	Height int32
+	Left   int32
+	Top    int32
+}
+
+// Windows API for monitor enumeration (reuse existing user32)
+var (
+	procEnumDisplayMonitors = user32.NewProc("EnumDisplayMonitors")
+	procGetMonitorInfo      = user32.NewProc("GetMonitorInfoW")
+	procMonitorFromWindow   = user32.NewProc("MonitorFromWindow")
+)
+
+type RECT struct {
+	Left   int32
+	Top    int32
+	Right  int32
+	Bottom int32
+}
+
+type MONITORINFO struct {
+	cbSize    uint32
+	rcMonitor RECT
+	rcWork    RECT
+	dwFlags   uint32
+}
+
+// Get current monitor information
+func getCurrentMonitorInfo() MonitorInfo {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		return MonitorInfo{Name: "Primary", Width: 1920, Height: 1080, Left: 0, Top: 0}
+	}
+
+	hMonitor, _, _ := procMonitorFromWindow.Call(hwnd, 0x00000002) // MONITOR_DEFAULTTONEAREST
+	if hMonitor == 0 {
+		return MonitorInfo{Name: "Primary", Width: 1920, Height: 1080, Left: 0, Top: 0}
+	}
+
+	var mi MONITORINFO
+	mi.cbSize = uint32(unsafe.Sizeof(mi))
+
+	ret, _, _ := procGetMonitorInfo.Call(hMonitor, uintptr(unsafe.Pointer(&mi)))
+	if ret == 0 {
+		return MonitorInfo{Name: "Primary", Width: 1920, Height: 1080, Left: 0, Top: 0}
+	}
+
+	return MonitorInfo{
+		Name:   "Monitor",
+		Width:  mi.rcMonitor.Right - mi.rcMonitor.Left,
+		Height: mi.rcMonitor.Bottom - mi.rcMonitor.Top,
+		Left:   mi.rcMonitor.Left,
+		Top:    mi.rcMonitor.Top,
+	}
+}
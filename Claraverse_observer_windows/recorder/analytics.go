@@ -0,0 +1,453 @@
+package recorder
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dwell-time analytics. A pass over a recording's timeline gives the time
+// spent in each application, window and page, from one event to the next,
+// with idle, paused and interrupted stretches left out, along with the
+// number of application switches and the hotkeys pressed most. The same
+// pass runs live over the events of the recording in progress for the HTTP
+// API's status, and over a saved recording for the summary files
+// ExportAnalytics or the analytics command writes.
+
+// topHotkeyCount is how many hotkeys a summary lists
+const topHotkeyCount = 10
+
+// AnalyticsEntry is the time spent in one application, window or page
+type AnalyticsEntry struct {
+	Application string `json:"application"`
+	Name        string `json:"name,omitempty"` // Window title or URL; empty for an application
+	TimeMs      uint64 `json:"time_ms"`
+	Switches    int    `json:"switches,omitempty"` // Switches to an application
+}
+
+// HotkeyCount is how often a hotkey was pressed
+type HotkeyCount struct {
+	Combination string `json:"combination"`
+	Count       int    `json:"count"`
+}
+
+// AnalyticsSummary is the dwell-time summary of a recording
+type AnalyticsSummary struct {
+	Recording    string           `json:"recording,omitempty"`
+	ActiveMs     uint64           `json:"active_ms"`
+	IdleMs       uint64           `json:"idle_ms"`
+	Switches     int              `json:"application_switches"`
+	Applications []AnalyticsEntry `json:"applications"`
+	Windows      []AnalyticsEntry `json:"windows"`
+	URLs         []AnalyticsEntry `json:"urls"`
+	TopHotkeys   []HotkeyCount    `json:"top_hotkeys"`
+}
+
+// analyticsMark is what the analytics pass reads from one event
+type analyticsMark struct {
+	Timestamp   uint64
+	Application string
+	Window      string
+	URL         string // Page shown or navigated to
+	Switch      bool   // An application switch
+	Hotkey      string
+	Idle        IdleMarkerType
+	IdleMs      uint64
+	Paused      bool // Capture was paused
+	Resumed     bool // Capture was resumed
+	GapMs       uint64
+}
+
+// analyticsKey identifies an application, or a window or page within one
+type analyticsKey struct {
+	Application string
+	Name        string
+}
+
+// DwellAnalytics aggregates a recording's timeline
+type DwellAnalytics struct {
+	Applications map[string]uint64
+	Windows      map[analyticsKey]uint64
+	URLs         map[analyticsKey]uint64
+	SwitchesTo   map[string]int
+	Hotkeys      map[string]int
+	Switches     int
+	IdleMs       uint64
+	Application  string            // Application in front
+	Window       string            // Its window title
+	PageURLs     map[string]string // Last page each browser showed
+	SpanStart    uint64            // Start of the time not yet counted
+	Counting     bool              // Time is passing in the current application
+	Mutex        sync.Mutex
+}
+
+// NewDwellAnalytics creates an empty aggregate
+func NewDwellAnalytics() *DwellAnalytics {
+	return &DwellAnalytics{
+		Applications: make(map[string]uint64),
+		Windows:      make(map[analyticsKey]uint64),
+		URLs:         make(map[analyticsKey]uint64),
+		SwitchesTo:   make(map[string]int),
+		Hotkeys:      make(map[string]int),
+		PageURLs:     make(map[string]string),
+	}
+}
+
+// Observe adds an event of the recording in progress
+func (da *DwellAnalytics) Observe(event WorkflowEvent) {
+	if da == nil {
+		return
+	}
+	metadata, ok := eventMetadata(event)
+	if !ok {
+		return
+	}
+	mark := analyticsMark{Timestamp: metadata.Timestamp}
+	if element := metadata.UIElement; element != nil {
+		mark.Application, mark.Window, mark.URL = element.ApplicationName, element.WindowTitle, element.URL
+	}
+	switch e := event.(type) {
+	case ApplicationSwitchEvent:
+		mark.Application, mark.Switch = e.ToApplication, true
+	case BrowserTabNavigationEvent:
+		if e.ToURL != "" {
+			mark.URL = e.ToURL
+		}
+	case HotkeyEvent:
+		mark.Hotkey = e.Combination
+	case IdleEvent:
+		mark.Idle, mark.IdleMs = e.Idle, e.IdleMs
+	case RecordingMarkerEvent:
+		mark.Paused, mark.Resumed = e.RecordingMarker == RecordingPaused, e.RecordingMarker == RecordingResumed
+	case SessionInterruptedEvent:
+		mark.GapMs = e.GapMs
+	}
+
+	da.Mutex.Lock()
+	defer da.Mutex.Unlock()
+	da.observe(mark)
+}
+
+// observeSaved adds an event of a saved recording
+func (da *DwellAnalytics) observeSaved(event savedEvent) {
+	mark := analyticsMark{
+		Timestamp: event.Metadata.Timestamp,
+		Idle:      IdleMarkerType(event.Idle),
+		IdleMs:    event.IdleMs,
+		Paused:    event.RecordingMarker == string(RecordingPaused),
+		Resumed:   event.RecordingMarker == string(RecordingResumed),
+		GapMs:     event.GapMs,
+	}
+	if element := event.Metadata.UIElement; element != nil {
+		mark.Application, mark.Window, mark.URL = element.ApplicationName, element.WindowTitle, element.URL
+	}
+	if event.ToURL != "" {
+		mark.URL = event.ToURL
+	}
+	if event.ToApplication != nil {
+		mark.Application, mark.Switch = *event.ToApplication, true
+	}
+	if event.Combination != nil {
+		mark.Hotkey = *event.Combination
+	}
+
+	da.Mutex.Lock()
+	defer da.Mutex.Unlock()
+	da.observe(mark)
+}
+
+// observe moves the timeline on to mark. Called with the lock held.
+func (da *DwellAnalytics) observe(mark analyticsMark) {
+	if da.SpanStart == 0 {
+		da.SpanStart, da.Counting = mark.Timestamp, true
+	}
+
+	switch {
+	case mark.Idle == IdleStart:
+		// Stamped at the last input, which may be before events already
+		// counted, such as interval screenshots
+		da.advance(mark.Timestamp)
+		if mark.Timestamp < da.SpanStart {
+			da.takeBack(da.SpanStart - mark.Timestamp)
+		}
+		da.Counting = false
+		return
+	case mark.Idle == IdleEnd:
+		da.IdleMs += mark.IdleMs
+		da.SpanStart, da.Counting = max(da.SpanStart, mark.Timestamp), true
+		return
+	case mark.Paused:
+		da.advance(mark.Timestamp)
+		da.Counting = false
+		return
+	case mark.Resumed:
+		da.SpanStart, da.Counting = max(da.SpanStart, mark.Timestamp), true
+		return
+	case mark.GapMs > 0:
+		// Nothing was recorded between the interruption and the marker
+		if mark.Timestamp > mark.GapMs {
+			da.advance(mark.Timestamp - mark.GapMs)
+		}
+		da.SpanStart = max(da.SpanStart, mark.Timestamp)
+		return
+	}
+
+	da.advance(mark.Timestamp)
+	if mark.Switch {
+		da.Switches++
+		da.SwitchesTo[mark.Application]++
+	}
+	if mark.Application != "" {
+		if mark.Application != da.Application || mark.Switch {
+			da.Window = ""
+		}
+		da.Application = mark.Application
+		if mark.Window != "" {
+			da.Window = mark.Window
+		}
+	}
+	if mark.URL != "" && da.Application != "" {
+		da.PageURLs[da.Application] = mark.URL
+	}
+	if mark.Hotkey != "" {
+		da.Hotkeys[mark.Hotkey]++
+	}
+}
+
+// advance counts the time up to timestamp towards the current application,
+// window and page. Called with the lock held.
+func (da *DwellAnalytics) advance(timestamp uint64) {
+	if timestamp <= da.SpanStart {
+		return
+	}
+	if da.Counting {
+		da.count(da.Applications, da.Windows, da.URLs, timestamp-da.SpanStart)
+	}
+	da.SpanStart = timestamp
+}
+
+// count adds ms to the current application, window and page in the given
+// totals. Called with the lock held.
+func (da *DwellAnalytics) count(applications map[string]uint64, windows, urls map[analyticsKey]uint64, ms uint64) {
+	if da.Application == "" {
+		return
+	}
+	applications[da.Application] += ms
+	if da.Window != "" {
+		windows[analyticsKey{da.Application, da.Window}] += ms
+	}
+	if url := da.PageURLs[da.Application]; url != "" {
+		urls[analyticsKey{da.Application, url}] += ms
+	}
+}
+
+// takeBack removes ms counted past the start of an idle stretch. Called with
+// the lock held.
+func (da *DwellAnalytics) takeBack(ms uint64) {
+	if da.Application == "" {
+		return
+	}
+	take := func(total uint64) uint64 {
+		if total < ms {
+			return 0
+		}
+		return total - ms
+	}
+	da.Applications[da.Application] = take(da.Applications[da.Application])
+	if key := (analyticsKey{da.Application, da.Window}); da.Window != "" {
+		da.Windows[key] = take(da.Windows[key])
+	}
+	if url := da.PageURLs[da.Application]; url != "" {
+		key := analyticsKey{da.Application, url}
+		da.URLs[key] = take(da.URLs[key])
+	}
+}
+
+// Summary returns the totals with the time up to end counted
+func (da *DwellAnalytics) Summary(end uint64) AnalyticsSummary {
+	da.Mutex.Lock()
+	defer da.Mutex.Unlock()
+
+	applications := make(map[string]uint64, len(da.Applications))
+	for name, ms := range da.Applications {
+		applications[name] = ms
+	}
+	windows := make(map[analyticsKey]uint64, len(da.Windows))
+	for key, ms := range da.Windows {
+		windows[key] = ms
+	}
+	urls := make(map[analyticsKey]uint64, len(da.URLs))
+	for key, ms := range da.URLs {
+		urls[key] = ms
+	}
+	if da.Counting && end > da.SpanStart {
+		da.count(applications, windows, urls, end-da.SpanStart)
+	}
+
+	summary := AnalyticsSummary{
+		IdleMs:       da.IdleMs,
+		Switches:     da.Switches,
+		Applications: []AnalyticsEntry{},
+		Windows:      analyticsEntries(windows),
+		URLs:         analyticsEntries(urls),
+		TopHotkeys:   []HotkeyCount{},
+	}
+	for name, ms := range applications {
+		summary.ActiveMs += ms
+		summary.Applications = append(summary.Applications,
+			AnalyticsEntry{Application: name, TimeMs: ms, Switches: da.SwitchesTo[name]})
+	}
+	for name := range da.SwitchesTo {
+		if _, seen := applications[name]; !seen && name != "" {
+			summary.Applications = append(summary.Applications,
+				AnalyticsEntry{Application: name, Switches: da.SwitchesTo[name]})
+		}
+	}
+	sortAnalyticsEntries(summary.Applications)
+
+	for combination, count := range da.Hotkeys {
+		summary.TopHotkeys = append(summary.TopHotkeys, HotkeyCount{combination, count})
+	}
+	sort.Slice(summary.TopHotkeys, func(i, j int) bool {
+		a, b := summary.TopHotkeys[i], summary.TopHotkeys[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Combination < b.Combination
+	})
+	if len(summary.TopHotkeys) > topHotkeyCount {
+		summary.TopHotkeys = summary.TopHotkeys[:topHotkeyCount]
+	}
+	return summary
+}
+
+// GetStatistics returns the live counters of the recording in progress
+func (da *DwellAnalytics) GetStatistics() map[string]interface{} {
+	summary := da.Summary(captureTimestamp())
+	applications := make(map[string]uint64, len(summary.Applications))
+	for _, entry := range summary.Applications {
+		applications[entry.Application] = entry.TimeMs
+	}
+	return map[string]interface{}{
+		"active_ms":            summary.ActiveMs,
+		"idle_ms":              summary.IdleMs,
+		"application_switches": summary.Switches,
+		"application_time_ms":  applications,
+		"top_hotkeys":          summary.TopHotkeys,
+	}
+}
+
+// analyticsEntries lists windows or pages, longest first
+func analyticsEntries(totals map[analyticsKey]uint64) []AnalyticsEntry {
+	entries := make([]AnalyticsEntry, 0, len(totals))
+	for key, ms := range totals {
+		if ms > 0 {
+			entries = append(entries, AnalyticsEntry{Application: key.Application, Name: key.Name, TimeMs: ms})
+		}
+	}
+	sortAnalyticsEntries(entries)
+	return entries
+}
+
+// sortAnalyticsEntries puts the longest first
+func sortAnalyticsEntries(entries []AnalyticsEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.TimeMs != b.TimeMs {
+			return a.TimeMs > b.TimeMs
+		}
+		if a.Application != b.Application {
+			return a.Application < b.Application
+		}
+		return a.Name < b.Name
+	})
+}
+
+// analyzeRecording runs the analytics pass over a saved recording
+func analyzeRecording(recording *SavedRecording) AnalyticsSummary {
+	analytics := NewDwellAnalytics()
+	for _, event := range recording.Events {
+		analytics.observeSaved(event)
+	}
+	end := recording.EndTime
+	if end == 0 && len(recording.Events) > 0 {
+		end = recording.Events[len(recording.Events)-1].Metadata.Timestamp
+	}
+	summary := analytics.Summary(end)
+	summary.Recording = recording.Name
+	return summary
+}
+
+// exportRecordingAnalytics writes the analytics summary of a saved recording
+// as <recording>_analytics.json and <recording>_analytics.csv, and returns
+// their names
+func exportRecordingAnalytics(filename, store string) (string, string, error) {
+	recording, err := LoadSavedRecording(filename, store)
+	if err != nil {
+		return "", "", err
+	}
+	summary := analyzeRecording(recording)
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename)) + "_analytics"
+	jsonFile, csvFile := base+".json", base+".csv"
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", "", NewWorkflowError(ErrorTypeSerialization, "Failed to serialize analytics", err)
+	}
+	if err := os.WriteFile(jsonFile, data, 0644); err != nil {
+		return "", "", NewWorkflowError(ErrorTypeFileIO, "Failed to write analytics", err)
+	}
+
+	file, err := os.Create(csvFile)
+	if err != nil {
+		return "", "", NewWorkflowError(ErrorTypeFileIO, "Failed to create analytics CSV", err)
+	}
+	defer file.Close()
+	if err := writeAnalyticsCSV(csv.NewWriter(file), summary); err != nil {
+		return "", "", NewWorkflowError(ErrorTypeFileIO, "Failed to write analytics CSV", err)
+	}
+	return jsonFile, csvFile, nil
+}
+
+// writeAnalyticsCSV writes a summary as one row per application, window,
+// page and hotkey
+func writeAnalyticsCSV(writer *csv.Writer, summary AnalyticsSummary) error {
+	rows := [][]string{{"kind", "application", "name", "time_ms", "switches", "count"}}
+	entryRows := func(kind string, entries []AnalyticsEntry) {
+		for _, entry := range entries {
+			rows = append(rows, []string{kind, entry.Application, entry.Name,
+				strconv.FormatUint(entry.TimeMs, 10), strconv.Itoa(entry.Switches), ""})
+		}
+	}
+	entryRows("application", summary.Applications)
+	entryRows("window", summary.Windows)
+	entryRows("url", summary.URLs)
+	for _, hotkey := range summary.TopHotkeys {
+		rows = append(rows, []string{"hotkey", "", hotkey.Combination, "", "", strconv.Itoa(hotkey.Count)})
+	}
+	rows = append(rows,
+		[]string{"total", "", "active", strconv.FormatUint(summary.ActiveMs, 10), strconv.Itoa(summary.Switches), ""},
+		[]string{"total", "", "idle", strconv.FormatUint(summary.IdleMs, 10), "", ""})
+
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// exportAnalytics writes the analytics summary of a just-saved recording. A
+// failure here is logged rather than returned, since the recording is saved.
+func (rc *RecordingController) exportAnalytics(filename string) {
+	jsonFile, csvFile, err := exportRecordingAnalytics(filename, rc.Recorder.currentConfig().ScreenshotStore)
+	if err != nil {
+		logger("analytics").Error("Failed to export recording analytics", "error", err)
+		return
+	}
+	logger("analytics").Info("Wrote recording analytics", "json", jsonFile, "csv", csvFile)
+}
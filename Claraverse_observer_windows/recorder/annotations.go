@@ -0,0 +1,82 @@
+package recorder
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// User annotations. Ctrl+Alt+Shift+A marks the current moment of a long
+// recording for later review. With AnnotationPrompt set, a small window
+// also asks for a note, which is added to the annotation once entered; the
+// prompt window itself is never recorded.
+
+// HotkeyActionAnnotate is the recorder hotkey action that adds an annotation
+const HotkeyActionAnnotate = "Add Annotation"
+
+// annotationPromptTitle is the title of the note prompt window
+const annotationPromptTitle = "ClaraVerse Recorder Note"
+
+// AnnotationEvent is a moment the user flagged, with an optional note
+type AnnotationEvent struct {
+	Annotation string        `json:"annotation"` // The note; empty when none was given
+	Metadata   EventMetadata `json:"metadata"`
+}
+
+// showAnnotationPrompt asks the user for a note and returns what was
+// entered, or "" when the prompt was cancelled. Replaced in tests.
+var showAnnotationPrompt = func() (string, error) {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	script := "[Console]::OutputEncoding = [Text.Encoding]::UTF8; " +
+		"Add-Type -AssemblyName Microsoft.VisualBasic; " +
+		"[Microsoft.VisualBasic.Interaction]::InputBox(" + quote(Msg(MsgAnnotationPrompt)) + ", " + quote(annotationPromptTitle) + ")"
+
+	output, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return "", NewWorkflowError(ErrorTypeSystem, "Failed to show the note prompt", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// addAnnotation adds an annotation for the hotkey event and, when prompting
+// is on, asks for its note in the background
+func (r *Recorder) addAnnotation(workflow *RecordedWorkflow, events *[]WorkflowEvent, event HotkeyEvent) {
+	*events = append(*events, AnnotationEvent{Metadata: event.Metadata})
+	printConsole(Msg(MsgAnnotationAdded))
+
+	r.Mutex.RLock()
+	prompt, redactor := r.Config.AnnotationPrompt, r.PII
+	r.Mutex.RUnlock()
+	if prompt && workflow != nil {
+		go promptForAnnotationNote(workflow, event.Metadata.Timestamp, redactor)
+	}
+}
+
+// promptForAnnotationNote asks for a note and adds it, masked, to the
+// annotation made at timestamp. A note entered after the recording was saved
+// is lost.
+func promptForAnnotationNote(workflow *RecordedWorkflow, timestamp uint64, redactor *PIIRedactor) {
+	note, err := showAnnotationPrompt()
+	if err != nil {
+		logger("annotations").Warn("Annotation note failed", "error", err)
+		return
+	}
+	if note == "" {
+		return
+	}
+
+	if setAnnotationNote(workflow, timestamp, redactor.Mask(note)) {
+		printConsole(Msg(MsgAnnotationNote, note))
+	}
+}
+
+// setAnnotationNote sets the note of the annotation made at timestamp
+func setAnnotationNote(workflow *RecordedWorkflow, timestamp uint64, note string) bool {
+	return workflow.UpdateEvent(func(event WorkflowEvent) (WorkflowEvent, bool) {
+		annotation, ok := event.(AnnotationEvent)
+		if !ok || annotation.Metadata.Timestamp != timestamp {
+			return event, false
+		}
+		annotation.Annotation = note
+		return annotation, true
+	})
+}
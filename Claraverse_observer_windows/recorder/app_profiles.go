@@ -0,0 +1,95 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Per-application recording profiles: overrides of the screenshot policy,
+// noise filters and what is recorded, applied while a matching application
+// is focused. For example, never capture screenshots in a banking app but
+// capture everything in Excel. The first matching profile wins.
+
+// LoadApplicationProfiles reads a JSON array of profiles
+func LoadApplicationProfiles(filename string) ([]ApplicationProfile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, NewWorkflowError(ErrorTypeFileIO, "Failed to read profiles file", err)
+	}
+
+	var profiles []ApplicationProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to parse profiles file", err)
+	}
+	if err := validateApplicationProfiles(profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// validateApplicationProfiles checks every profile is named and matches
+// something
+func validateApplicationProfiles(profiles []ApplicationProfile) error {
+	for i, profile := range profiles {
+		if profile.Name == "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Profile %d has no name", i+1), nil)
+		}
+		if len(profile.Applications) == 0 && len(profile.WindowTitles) == 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Profile %q matches no applications or window titles", profile.Name), nil)
+		}
+	}
+	return nil
+}
+
+// matchProfile returns the first of config's profiles matching an
+// application or window title, or nil
+func matchProfile(config WorkflowRecorderConfig, appName, windowTitle string) *ApplicationProfile {
+	for i := range config.ApplicationProfiles {
+		if config.ApplicationProfiles[i].Matches(appName, windowTitle) {
+			return &config.ApplicationProfiles[i]
+		}
+	}
+	return nil
+}
+
+// profileConfig returns config as it applies to an application or window
+// title
+func profileConfig(config WorkflowRecorderConfig, appName, windowTitle string) WorkflowRecorderConfig {
+	return matchProfile(config, appName, windowTitle).Apply(config)
+}
+
+// recordingConfig returns the configuration for the focused application
+func (r *Recorder) recordingConfig() WorkflowRecorderConfig {
+	return fullscreenConfig(keyboardModeConfig(r.captureState().CurrentProfile().Apply(r.currentConfig())), r.fullscreenMode())
+}
+
+// eventAllowedByProfile reports whether the profile of the application an
+// event happened in lets it be recorded. Tracker events can complete after
+// focus has moved on, so they are checked against their own application.
+func (r *Recorder) eventAllowedByProfile(event WorkflowEvent) bool {
+	metadata, ok := eventMetadata(event)
+	config := r.currentConfig()
+	if !ok || metadata.UIElement == nil || len(config.ApplicationProfiles) == 0 {
+		return true
+	}
+	config = profileConfig(config, metadata.UIElement.ApplicationName, metadata.UIElement.WindowTitle)
+
+	switch event.(type) {
+	case TextInputCompletedEvent:
+		return config.RecordTextInputCompletion
+	case TextSelectionEvent:
+		return config.RecordTextSelection
+	default:
+		return true
+	}
+}
+
+// isKeyboardNoise reports whether an event is a key press or a key without a
+// character, which FilterKeyboardNoise drops
+func isKeyboardNoise(event WorkflowEvent) bool {
+	keyEvent, ok := event.(KeyboardEvent)
+	return ok && (keyEvent.IsKeyDown || keyEvent.Character == nil)
+}
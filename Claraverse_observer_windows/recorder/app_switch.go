@@ -0,0 +1,161 @@
+package recorder
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Application switch methods. The keys and clicks of each capture pass are
+// noted as evidence of how the user is changing applications: Alt+Tab, a
+// Windows key + number shortcut, a click on the taskbar or in a window.
+// When the foreground application changes, the latest evidence from the
+// last switchEvidenceWindow names the ApplicationSwitchEvent's method. The
+// shell's own windows that come to the front on the way, such as the task
+// switcher, taskbar and Start menu, are not switched to; they are evidence
+// too, and the dwell time of the application left runs until the one
+// switched to takes the front.
+
+var procWindowFromPoint = user32.NewProc("WindowFromPoint")
+
+const switchEvidenceWindow = 1500 * time.Millisecond
+
+// shellSurfaceClasses are the classes of the shell windows that take the
+// front while switching, and the method they stand for
+var shellSurfaceClasses = map[string]ApplicationSwitchMethod{
+	"Shell_TrayWnd":                AppSwitchTaskbarClick,
+	"Shell_SecondaryTrayWnd":       AppSwitchTaskbarClick,
+	"TaskListThumbnailWnd":         AppSwitchTaskbarClick,
+	"MultitaskingViewFrame":        AppSwitchAltTab,
+	"TaskSwitcherWnd":              AppSwitchAltTab,
+	"XamlExplorerHostIslandWindow": AppSwitchAltTab,
+}
+
+// shellSurfaceApplications are the executables of the Start menu and search
+var shellSurfaceApplications = []string{
+	"startmenuexperiencehost.exe", "searchhost.exe", "searchapp.exe", "searchui.exe", "shellexperiencehost.exe",
+}
+
+// SwitchMethodDetector tells how the foreground application is changed
+type SwitchMethodDetector struct {
+	AltDown    bool
+	WinDown    bool
+	AltTabbed  bool                    // Tab was pressed during the current Alt press
+	Surface    ApplicationSwitchMethod // What the shell surface in front, if any, stands for
+	Method     ApplicationSwitchMethod
+	EvidenceAt time.Time
+	Mutex      sync.Mutex
+}
+
+// NewSwitchMethodDetector creates a detector with no evidence yet
+func NewSwitchMethodDetector() *SwitchMethodDetector {
+	return &SwitchMethodDetector{}
+}
+
+// note records evidence of a switch by method as of now
+func (d *SwitchMethodDetector) note(method ApplicationSwitchMethod, now time.Time) {
+	d.Method, d.EvidenceAt = method, now
+}
+
+// HandleKey notes a key transition
+func (d *SwitchMethodDetector) HandleKey(keyCode uint32, isKeyDown bool, now time.Time) {
+	d.Mutex.Lock()
+	defer d.Mutex.Unlock()
+
+	switch {
+	case keyCode == VK_MENU:
+		if !isKeyDown && d.AltTabbed {
+			// The switch happens as Alt is let go
+			d.note(AppSwitchAltTab, now)
+		}
+		d.AltDown, d.AltTabbed = isKeyDown, false
+	case keyCode == VK_LWIN || keyCode == VK_RWIN:
+		d.WinDown = isKeyDown
+	case keyCode == VK_TAB && isKeyDown && d.AltDown:
+		d.AltTabbed = true
+		d.note(AppSwitchAltTab, now)
+	case keyCode == VK_ESCAPE && isKeyDown && d.AltTabbed:
+		d.AltTabbed = false
+		d.Method = ""
+	case keyCode >= '0' && keyCode <= '9' && isKeyDown && d.WinDown:
+		d.note(AppSwitchWindowsKeyShortcut, now)
+	}
+}
+
+// HandleClick notes a left button press, on the taskbar or elsewhere. A
+// click in a shell surface, such as on a Start menu entry, stands for the
+// surface.
+func (d *SwitchMethodDetector) HandleClick(onTaskbar bool, now time.Time) {
+	d.Mutex.Lock()
+	defer d.Mutex.Unlock()
+
+	switch {
+	case onTaskbar:
+		d.note(AppSwitchTaskbarClick, now)
+	case d.Surface != "":
+		d.note(d.Surface, now)
+	default:
+		d.note(AppSwitchWindowClick, now)
+	}
+}
+
+// HandleForeground notes the window in front and reports whether it is one
+// of the shell's switching surfaces rather than an application
+func (d *SwitchMethodDetector) HandleForeground(className, application string, now time.Time) bool {
+	method, ok := shellSurfaceClasses[className]
+	if !ok {
+		for _, name := range shellSurfaceApplications {
+			if strings.EqualFold(application, name) {
+				method, ok = AppSwitchStartMenu, true
+				break
+			}
+		}
+	}
+
+	d.Mutex.Lock()
+	defer d.Mutex.Unlock()
+
+	if !ok {
+		d.Surface = ""
+		return false
+	}
+	d.Surface = method
+	recent := d.Method != "" && now.Sub(d.EvidenceAt) <= switchEvidenceWindow
+	if recent && (d.Method == AppSwitchAltTab || d.Method == AppSwitchWindowsKeyShortcut) {
+		// The keys pressed say more than the surface showing for them
+		d.EvidenceAt = now
+	} else {
+		d.note(method, now)
+	}
+	return true
+}
+
+// Classify returns the method of a switch seen now and clears the evidence
+func (d *SwitchMethodDetector) Classify(now time.Time) ApplicationSwitchMethod {
+	if d == nil {
+		return AppSwitchOther
+	}
+	d.Mutex.Lock()
+	defer d.Mutex.Unlock()
+
+	method := d.Method
+	if d.AltTabbed {
+		// Alt is still held with the switcher up
+		method = AppSwitchAltTab
+	} else if method == "" || now.Sub(d.EvidenceAt) > switchEvidenceWindow {
+		method = AppSwitchOther
+	}
+	d.Method = ""
+	return method
+}
+
+// isTaskbarAt reports whether a screen position is on a taskbar
+func isTaskbarAt(position Position) bool {
+	hwnd, _, _ := procWindowFromPoint.Call(pointArgs(position)...)
+	if hwnd == 0 {
+		return false
+	}
+	root, _, _ := procGetAncestor.Call(hwnd, GA_ROOT)
+	method, ok := shellSurfaceClasses[getWindowClassName(root)]
+	return ok && method == AppSwitchTaskbarClick
+}
@@ -0,0 +1,202 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dry-run audit mode: hooks and trackers run as usual, but events are
+// counted and discarded instead of recorded, and nothing is saved or sent to
+// the vision or OCR engines. A live summary and one redacted example of each
+// event type let a privacy officer check what a configuration would capture.
+
+const (
+	auditPrintInterval = 5 * time.Second
+	auditExampleLength = 600
+)
+
+// auditStructuralKeys are the event fields shown as is in audit examples.
+// They describe what kind of event happened rather than what the user saw
+// or typed; every other string is redacted.
+var auditStructuralKeys = map[string]bool{
+	"event_type":        true,
+	"button":            true,
+	"action":            true,
+	"combination":       true,
+	"trigger":           true,
+	"image_format":      true,
+	"monitor_name":      true,
+	"interaction_type":  true,
+	"button_role":       true,
+	"role":              true,
+	"application_name":  true,
+	"from_application":  true,
+	"to_application":    true,
+	"switch_method":     true,
+	"method":            true,
+	"browser":           true,
+	"input_method":      true,
+	"completion_reason": true,
+	"cdp_event":         true,
+	"tag_name":          true,
+	"segment_marker":    true,
+	"selection_method":  true,
+	"format":            true,
+	"field_type":        true,
+	"data_type":         true,
+}
+
+// CaptureAuditor counts the events a dry run would have recorded
+type CaptureAuditor struct {
+	Counts    map[string]int
+	Examples  map[string]string
+	StartTime time.Time
+	LastPrint time.Time
+	Printed   int // Event total at the last summary
+	Mutex     sync.Mutex
+}
+
+// NewCaptureAuditor creates an auditor when config asks for a dry run, or
+// returns nil
+func NewCaptureAuditor(config WorkflowRecorderConfig) *CaptureAuditor {
+	if !config.DryRun {
+		return nil
+	}
+
+	now := time.Now()
+	return &CaptureAuditor{
+		Counts:    make(map[string]int),
+		Examples:  make(map[string]string),
+		StartTime: now,
+		LastPrint: now,
+	}
+}
+
+// Record counts event, printing a redacted example the first time its type
+// is seen and a summary every auditPrintInterval
+func (ca *CaptureAuditor) Record(event WorkflowEvent) {
+	ca.Mutex.Lock()
+	defer ca.Mutex.Unlock()
+
+	name := auditEventType(event)
+	ca.Counts[name]++
+
+	if _, seen := ca.Examples[name]; !seen {
+		ca.Examples[name] = redactedExample(event)
+		printConsole(Msg(MsgAuditFirst, name, ca.Examples[name]))
+	}
+
+	if time.Since(ca.LastPrint) >= auditPrintInterval {
+		if total := ca.total(); total != ca.Printed {
+			printConsole("🔎 " + ca.summary())
+			ca.Printed = total
+		}
+		ca.LastPrint = time.Now()
+	}
+}
+
+// PrintSummary prints the final audit
+func (ca *CaptureAuditor) PrintSummary() {
+	ca.Mutex.Lock()
+	defer ca.Mutex.Unlock()
+
+	printConsole(Msg(MsgAuditFinished))
+	printConsole("🔎 " + ca.summary())
+}
+
+// GetStatistics returns the event counts
+func (ca *CaptureAuditor) GetStatistics() map[string]interface{} {
+	ca.Mutex.Lock()
+	defer ca.Mutex.Unlock()
+
+	counts := make(map[string]int, len(ca.Counts))
+	for name, count := range ca.Counts {
+		counts[name] = count
+	}
+	return map[string]interface{}{
+		"event_counts": counts,
+		"total_events": ca.total(),
+	}
+}
+
+// summary describes the counts so far, most frequent type first
+func (ca *CaptureAuditor) summary() string {
+	names := make([]string, 0, len(ca.Counts))
+	for name := range ca.Counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if ca.Counts[names[i]] != ca.Counts[names[j]] {
+			return ca.Counts[names[i]] > ca.Counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, ca.Counts[name])
+	}
+	return Msg(MsgAuditSummary,
+		FormatDuration(time.Since(ca.StartTime)), ca.total(), strings.Join(parts, ", "))
+}
+
+// total returns the number of events counted
+func (ca *CaptureAuditor) total() int {
+	total := 0
+	for _, count := range ca.Counts {
+		total += count
+	}
+	return total
+}
+
+// auditEventType names an event's type
+func auditEventType(event WorkflowEvent) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", event), "main.")
+}
+
+// redactedExample renders event as JSON with everything but structural
+// fields replaced by a description of its size
+func redactedExample(event WorkflowEvent) string {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Sprintf("(not serializable: %v)", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Sprintf("(not serializable: %v)", err)
+	}
+
+	redacted, _ := json.Marshal(redactValue("", value))
+	return TruncateString(string(redacted), auditExampleLength, "…")
+}
+
+// redactValue redacts the strings in value, the value of field key
+func redactValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for field, inner := range v {
+			v[field] = redactValue(field, inner)
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redactValue(key, inner)
+		}
+		return v
+	case string:
+		switch {
+		case v == "" || auditStructuralKeys[key]:
+			return v
+		case key == "image_base64":
+			return fmt.Sprintf("«image, %d KB»", len(v)*3/4/1024)
+		default:
+			return fmt.Sprintf("«%d chars»", len([]rune(v)))
+		}
+	default:
+		return value
+	}
+}
@@ -0,0 +1,158 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Timeline bookmarks from external systems. Test runners, ticketing systems
+// and CI jobs mark moments of the recording in progress ("test case 12
+// started") through the HTTP API, so their logs can be lined up with the
+// recording afterwards. POST /recordings/active/bookmarks takes a bookmark
+// as JSON; POST /webhooks/{source} takes any JSON webhook body, kept as the
+// bookmark's payload, and labels it from ?label= or the body.
+
+// maxBookmarkBodyBytes caps a bookmark or webhook request body
+const maxBookmarkBodyBytes = 64 << 10
+
+// webhookLabelFields are the body fields a webhook bookmark is labelled
+// from, in order, when the request gives no label
+var webhookLabelFields = []string{"label", "title", "name", "event", "message", "action"}
+
+// BookmarkEvent is a moment of the recording an external system marked
+type BookmarkEvent struct {
+	Bookmark   string            `json:"bookmark"`            // Label, e.g. "test case 12 started"
+	Source     string            `json:"source,omitempty"`    // System that sent it, e.g. "pytest"
+	Reference  string            `json:"reference,omitempty"` // Its own ID for the moment, e.g. a ticket or test ID
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Payload    json.RawMessage   `json:"payload,omitempty"` // Webhook body, as sent
+	Metadata   EventMetadata     `json:"metadata"`
+}
+
+// BookmarkRequest is the body of POST /recordings/active/bookmarks
+type BookmarkRequest struct {
+	Label      string            `json:"label"`
+	Source     string            `json:"source"`
+	Reference  string            `json:"reference"`
+	Attributes map[string]string `json:"attributes"`
+	Timestamp  uint64            `json:"timestamp"` // When it happened, in ms since the epoch; now when 0
+}
+
+// newBookmarkEvent checks a bookmark request against the recording it is
+// for and makes its event
+func newBookmarkEvent(workflow *RecordedWorkflow, request BookmarkRequest, now uint64) (BookmarkEvent, error) {
+	label := strings.TrimSpace(request.Label)
+	if label == "" {
+		return BookmarkEvent{}, fmt.Errorf("a bookmark needs a label")
+	}
+
+	timestamp := request.Timestamp
+	if timestamp == 0 {
+		timestamp = now
+	}
+	workflow.Mutex.RLock()
+	startTime := workflow.StartTime
+	workflow.Mutex.RUnlock()
+	if timestamp < startTime || timestamp > now {
+		return BookmarkEvent{}, fmt.Errorf("timestamp %d is not within the recording", timestamp)
+	}
+
+	return BookmarkEvent{
+		Bookmark:   label,
+		Source:     request.Source,
+		Reference:  request.Reference,
+		Attributes: request.Attributes,
+		Metadata:   EventMetadata{Timestamp: timestamp},
+	}, nil
+}
+
+// webhookLabel returns the label of a webhook body, or "" when none of
+// webhookLabelFields holds a string
+func webhookLabel(payload json.RawMessage) string {
+	var fields map[string]interface{}
+	if json.Unmarshal(payload, &fields) != nil {
+		return ""
+	}
+	for _, name := range webhookLabelFields {
+		if label, ok := fields[name].(string); ok && strings.TrimSpace(label) != "" {
+			return label
+		}
+	}
+	return ""
+}
+
+// addBookmark adds a bookmark to the recording in progress
+func (s *HTTPAPIServer) addBookmark(w http.ResponseWriter, request BookmarkRequest, payload json.RawMessage) {
+	workflow := s.Controller.Active()
+	if workflow == nil {
+		writeJSONError(w, http.StatusConflict, "No recording in progress")
+		return
+	}
+	event, err := newBookmarkEvent(workflow, request, captureTimestamp())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	event.Payload = payload
+
+	s.Controller.Recorder.appendWorkflowEvents(workflow, []WorkflowEvent{event})
+	printConsole(Msg(MsgBookmarkAdded, event.Bookmark))
+
+	writeJSON(w, http.StatusCreated, event)
+}
+
+func (s *HTTPAPIServer) handleAddBookmark(w http.ResponseWriter, r *http.Request) {
+	var request BookmarkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBookmarkBodyBytes)).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	s.addBookmark(w, request, nil)
+}
+
+// handleWebhook turns a webhook into a bookmark, keeping its body
+func (s *HTTPAPIServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBookmarkBodyBytes))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	var payload json.RawMessage
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if !json.Valid(body) {
+			writeJSONError(w, http.StatusBadRequest, "Webhook body is not JSON")
+			return
+		}
+		payload = body
+	}
+
+	source := r.PathValue("source")
+	query := r.URL.Query()
+	request := BookmarkRequest{
+		Label:     query.Get("label"),
+		Source:    source,
+		Reference: query.Get("reference"),
+	}
+	if request.Label == "" {
+		request.Label = webhookLabel(payload)
+	}
+	if request.Label == "" {
+		request.Label = "Webhook from " + source
+	}
+	s.addBookmark(w, request, payload)
+}
+
+// describeBookmark describes a bookmark in a recording's steps
+func describeBookmark(label, source, reference string, quote func(string) string) string {
+	description := "Bookmarked " + quote(label)
+	if source != "" {
+		description += " from " + source
+	}
+	if reference != "" {
+		description += " (" + reference + ")"
+	}
+	return description
+}
@@ -1,7 +1,6 @@
-package main
+package recorder
 
 import (
-	"log"
 	"regexp"
 	"strings"
 	"sync"
@@ -57,6 +56,7 @@ type BrowserState struct {
 	WindowTitle   string
 	CurrentURL    string
 	LastURLChange time.Time
+	IdleAtChange  time.Duration // Idle time so far at LastURLChange
 	TabCount      uint32
 	LastTabAction time.Time
 	RecentHotkeys []string
@@ -68,6 +68,7 @@ type BrowserTabTracker struct {
 	BrowserStates   map[uint32]*BrowserState // ProcessID -> BrowserState
 	LastNavigation  time.Time
 	EventCallback   func(BrowserTabNavigationEvent)
+	Idle            *IdleDetector // Idle time is left out of dwell times; nil when not detected
 	URLPatterns     map[string]*regexp.Regexp
 	BrowserPatterns map[string]*regexp.Regexp
 	Mutex           sync.RWMutex
@@ -99,7 +100,10 @@ func (btt *BrowserTabTracker) HandleWindowChange(element *UIElement) {
 
 	processID := element.ProcessID
 	windowTitle := element.WindowTitle
-	currentURL := btt.extractURL(windowTitle)
+	currentURL := element.URL
+	if currentURL == "" {
+		currentURL = btt.extractURL(windowTitle)
+	}
 
 	// Get or create browser state
 	browserState, exists := btt.BrowserStates[processID]
@@ -109,15 +113,20 @@ func (btt *BrowserTabTracker) HandleWindowChange(element *UIElement) {
 			WindowTitle:   windowTitle,
 			CurrentURL:    currentURL,
 			LastURLChange: time.Now(),
+			IdleAtChange:  btt.Idle.SoFar(),
 			TabCount:      1,
 		}
 		btt.BrowserStates[processID] = browserState
 		return // First time seeing this browser, don't emit event
 	}
 
-	// Check for URL change (tab navigation)
-	if currentURL != "" && currentURL != browserState.CurrentURL {
-		dwellTime := uint64(time.Since(browserState.LastURLChange).Milliseconds())
+	// Check for URL change (tab navigation). Most browsers keep the URL out of
+	// the window title, so fall back to a change of page title.
+	urlChanged := currentURL != "" && currentURL != browserState.CurrentURL
+	titleChanged := currentURL == "" && btt.extractTitle(windowTitle) != btt.extractTitle(browserState.WindowTitle)
+	if urlChanged || titleChanged {
+		idle := btt.Idle.SoFar()
+		dwellTime := uint64(activeTime(browserState.LastURLChange, browserState.IdleAtChange, idle).Milliseconds())
 
 		event := BrowserTabNavigationEvent{
 			Action:          TabSwitched,
@@ -139,6 +148,7 @@ func (btt *BrowserTabTracker) HandleWindowChange(element *UIElement) {
 		browserState.CurrentURL = currentURL
 		browserState.WindowTitle = windowTitle
 		browserState.LastURLChange = time.Now()
+		browserState.IdleAtChange = idle
 		browserState.LastTabAction = time.Now()
 
 		// Emit event
@@ -146,8 +156,8 @@ func (btt *BrowserTabTracker) HandleWindowChange(element *UIElement) {
 			go btt.EventCallback(event)
 		}
 
-		log.Printf("Browser navigation detected: %s -> %s (%s)",
-			event.FromURL, event.ToURL, event.Browser)
+		logger("browser").Debug("Browser navigation detected",
+			"from", event.FromURL, "to", event.ToURL, "browser", event.Browser)
 	}
 
 	// Update last seen state
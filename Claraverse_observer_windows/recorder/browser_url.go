@@ -0,0 +1,132 @@
+package recorder
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var procGetClassNameW = user32.NewProc("GetClassNameW")
+
+// browserURLRefreshInterval bounds how often an unchanged browser window's
+// address bar is re-read. Navigation almost always changes the window title,
+// which forces a re-read immediately.
+const browserURLRefreshInterval = 2 * time.Second
+
+// addressBarQuery identifies a browser's address bar by a UI Automation
+// string property
+type addressBarQuery struct {
+	PropertyID uintptr
+	Value      string
+}
+
+// browserAddressBars maps top-level browser window classes to their address
+// bar. Chromium browsers (Chrome, Edge, Brave, Opera) share the omnibox view
+// class; Firefox names its URL field by automation id.
+var browserAddressBars = map[string]addressBarQuery{
+	"Chrome_WidgetWin_1": {PropertyID: UIA_ClassNamePropertyId, Value: "OmniboxViewViews"},
+	"MozillaWindowClass": {PropertyID: UIA_AutomationIdPropertyId, Value: "urlbar-input"},
+}
+
+// BrowserURLCache remembers the address bar URL of the foreground window so
+// the UI Automation tree is only searched when the window or its title changes
+type BrowserURLCache struct {
+	Window uintptr
+	Title  string
+	URL    string
+	ReadAt time.Time
+	Mutex  sync.Mutex
+}
+
+var globalBrowserURLCache = &BrowserURLCache{}
+
+// Get returns the address bar URL of the window, or "" for windows that are
+// not browsers or whose address bar can't be read
+func (c *BrowserURLCache) Get(hwnd uintptr, title string) string {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	if hwnd == c.Window && title == c.Title && time.Since(c.ReadAt) < browserURLRefreshInterval {
+		return c.URL
+	}
+
+	c.Window = hwnd
+	c.Title = title
+	c.URL = getAddressBarURL(hwnd)
+	c.ReadAt = time.Now()
+
+	return c.URL
+}
+
+// getAddressBarURL reads the URL shown in a browser window's address bar
+func getAddressBarURL(hwnd uintptr) string {
+	query, isBrowser := browserAddressBars[getWindowClassName(hwnd)]
+	if !isBrowser {
+		return ""
+	}
+
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return ""
+	}
+	defer client.Close()
+
+	window, err := client.ElementFromHandle(hwnd)
+	if err != nil {
+		return ""
+	}
+	defer window.Release()
+
+	addressBar, err := client.FindFirstByString(window, query.PropertyID, query.Value)
+	if err != nil {
+		return ""
+	}
+	defer addressBar.Release()
+
+	value, err := client.Value(addressBar)
+	if err != nil {
+		return ""
+	}
+
+	return normalizeAddressBarValue(value)
+}
+
+// normalizeAddressBarValue turns address bar text into a URL. Browsers hide
+// the https:// scheme while the bar is not focused; text that doesn't look
+// like an address (a search being typed) yields "".
+func normalizeAddressBarValue(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.ContainsAny(value, " \t\n") {
+		return ""
+	}
+
+	if strings.Contains(value, "://") || strings.HasPrefix(value, "about:") {
+		return value
+	}
+
+	host := value
+	if end := strings.IndexAny(host, "/?#"); end >= 0 {
+		host = host[:end]
+	}
+	if !strings.Contains(host, ".") && !strings.HasPrefix(host, "localhost") {
+		return ""
+	}
+
+	return "https://" + value
+}
+
+// getWindowClassName returns the window's class name
+func getWindowClassName(hwnd uintptr) string {
+	if hwnd == 0 {
+		return ""
+	}
+
+	buf := make([]uint16, 256)
+	ret, _, _ := procGetClassNameW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if ret == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:ret])
+}
@@ -0,0 +1,186 @@
+package recorder
+
+import (
+	"sync"
+	"time"
+)
+
+// Capture state. Between polls the capture loop remembers where the pointer
+// was, the left button press in progress, the application in front, its
+// profile and where the caret was. Each recording has its own CaptureState,
+// and every read and change goes through its methods under its mutex, as
+// the HTTP API and the hotkey screenshot read it from their own goroutines,
+// and a capture loop the watchdog gave up on may still be running beside
+// its replacement.
+//
+// The recording's components on its Recorder (Trackers, Sinks and the rest)
+// are set and cleared under Recorder.Mutex by the RecordingController, and
+// read under it by anything outside the capture loop. The capture loop reads
+// them without it: they are set before it starts and cleared after it ends.
+//
+// Recorder.Config is different: sessions swap it from HTTP goroutines while
+// the capture loop, trackers' timers and the HTTP API read it. Once the
+// recorder is running it is read through currentConfig and changed through
+// setConfig, both under Recorder.Mutex; only setup before then, such as
+// Main's, uses it directly.
+
+// CaptureState is what the capture loop of one recording remembers
+type CaptureState struct {
+	LastMousePos      Position
+	LastMouseMoveTime time.Time
+	Press             *ButtonPress // The left button press in progress, nil when up
+	Application       ForegroundApplication
+	Profile           *ApplicationProfile // Profile of the focused application, if any
+	InputContext      InputContext        // Caret and scroll position at the latest key press
+	Mutex             sync.Mutex
+}
+
+// ButtonPress is where and when the left button went down
+type ButtonPress struct {
+	Position Position
+	Time     time.Time
+	Element  *ClickedElement // Control under the button, when captured
+}
+
+// ForegroundApplication is the application in front and since when
+type ForegroundApplication struct {
+	Name      string
+	ProcessID uint32
+	Since     time.Time     // When it came to the front
+	Idle      time.Duration // Idle time so far when it did
+}
+
+// NewCaptureState creates the state of a recording starting now; dwell
+// times count from here, not from the last recording's switch
+func NewCaptureState() *CaptureState {
+	return &CaptureState{
+		LastMouseMoveTime: time.Now(),
+		Application:       ForegroundApplication{Since: time.Now()},
+	}
+}
+
+// MoveMouse reports whether the pointer moved to position, at least
+// throttle after the last move reported, and remembers it if so
+func (s *CaptureState) MoveMouse(position Position, now time.Time, throttle time.Duration) bool {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if position == s.LastMousePos || now.Sub(s.LastMouseMoveTime) < throttle {
+		return false
+	}
+	s.LastMousePos, s.LastMouseMoveTime = position, now
+	return true
+}
+
+// PressButton starts a press at position, reporting false if the button
+// was already down
+func (s *CaptureState) PressButton(position Position, now time.Time) bool {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if s.Press != nil {
+		return false
+	}
+	s.Press = &ButtonPress{Position: position, Time: now}
+	return true
+}
+
+// SetPressedElement records the element under the press in progress
+func (s *CaptureState) SetPressedElement(element *ClickedElement) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if s.Press != nil {
+		s.Press.Element = element
+	}
+}
+
+// ReleaseButton ends the press in progress and returns it, or nil when the
+// button was not down
+func (s *CaptureState) ReleaseButton() *ButtonPress {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	press := s.Press
+	s.Press = nil
+	return press
+}
+
+// SwitchApplication brings name to the front, returning the application it
+// replaced. Reports false, changing nothing, when name is empty or already
+// in front.
+func (s *CaptureState) SwitchApplication(name string, processID uint32, now time.Time, idle time.Duration) (ForegroundApplication, bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	previous := s.Application
+	if name == "" || name == previous.Name {
+		return previous, false
+	}
+	s.Application = ForegroundApplication{Name: name, ProcessID: processID, Since: now, Idle: idle}
+	return previous, true
+}
+
+// ChangeProfile sets the profile of the focused application, reporting
+// whether it changed
+func (s *CaptureState) ChangeProfile(profile *ApplicationProfile) bool {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if profile == s.Profile {
+		return false
+	}
+	s.Profile = profile
+	return true
+}
+
+// CurrentProfile returns the profile of the focused application, if any
+func (s *CaptureState) CurrentProfile() *ApplicationProfile {
+	if s == nil {
+		return nil
+	}
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return s.Profile
+}
+
+// SetInputContext remembers where input went at the latest key press
+func (s *CaptureState) SetInputContext(context InputContext) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	s.InputContext = context
+}
+
+// LastInputContext returns where input went at the latest key press
+func (s *CaptureState) LastInputContext() InputContext {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return s.InputContext
+}
+
+// captureState returns the state of the current or last recording, nil
+// before the first
+func (r *Recorder) captureState() *CaptureState {
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+	return r.Capture
+}
+
+// currentConfig returns the configuration in effect
+func (r *Recorder) currentConfig() WorkflowRecorderConfig {
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+	return r.Config
+}
+
+// setConfig puts config in effect, e.g. a session's for its recording
+func (r *Recorder) setConfig(config WorkflowRecorderConfig) {
+	r.update(func(r *Recorder) { r.Config = config })
+}
+
+// update changes the recorder's components under its mutex
+func (r *Recorder) update(change func(r *Recorder)) {
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+	change(r)
+}
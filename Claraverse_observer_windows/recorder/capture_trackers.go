@@ -0,0 +1,395 @@
+package recorder
+
+import (
+	"sync"
+	"time"
+)
+
+// trackerFlushGrace is how long to wait for tracker callbacks, which are
+// delivered on their own goroutines, after flushing at the end of a recording
+const trackerFlushGrace = 50 * time.Millisecond
+
+// KeyTransition is a key going down or up between two polls
+type KeyTransition struct {
+	KeyCode   uint32
+	IsKeyDown bool
+}
+
+// KeyboardPoller detects key transitions by diffing async key state between
+// polls of the capture loop
+type KeyboardPoller struct {
+	KeyStates [256]bool
+}
+
+// Poll returns the keys that changed state since the previous poll
+func (kp *KeyboardPoller) Poll() []KeyTransition {
+	var transitions []KeyTransition
+
+	for vk := uint32(0x08); vk <= 0xFE; vk++ {
+		if isPolledKeyIgnored(vk) {
+			continue
+		}
+
+		down := isKeyPressed(vk)
+		if down != kp.KeyStates[vk] {
+			kp.KeyStates[vk] = down
+			transitions = append(transitions, KeyTransition{KeyCode: vk, IsKeyDown: down})
+		}
+	}
+
+	return transitions
+}
+
+// isPolledKeyIgnored skips the left/right modifier variants, which Windows
+// reports alongside the generic VK_SHIFT, VK_CONTROL and VK_MENU codes that
+// the hotkey patterns use
+func isPolledKeyIgnored(vk uint32) bool {
+	return vk >= 0xA0 && vk <= 0xA5
+}
+
+// keyCharacter maps a key press to the character it types, assuming a US
+// layout, for when the layout of the window in front is unknown. Returns ""
+// for non-printing keys and for shortcuts.
+func keyCharacter(vk uint32, modifiers ModifierStates, capsLock bool) string {
+	if modifiers.Ctrl || modifiers.Alt || modifiers.Win {
+		return ""
+	}
+
+	switch {
+	case vk >= 'A' && vk <= 'Z':
+		if modifiers.Shift != capsLock {
+			return string(rune(vk))
+		}
+		return string(rune(vk + 32))
+	case vk >= '0' && vk <= '9':
+		if modifiers.Shift {
+			return string(")!@#$%^&*("[vk-'0'])
+		}
+		return string(rune(vk))
+	case vk >= 0x60 && vk <= 0x69: // Numpad digits
+		return string(rune('0' + vk - 0x60))
+	case vk == 0x20:
+		return " "
+	}
+
+	oemKeys := map[uint32][2]string{
+		0xBA: {";", ":"}, 0xBB: {"=", "+"}, 0xBC: {",", "<"}, 0xBD: {"-", "_"},
+		0xBE: {".", ">"}, 0xBF: {"/", "?"}, 0xC0: {"`", "~"}, 0xDB: {"[", "{"},
+		0xDC: {"\\", "|"}, 0xDD: {"]", "}"}, 0xDE: {"'", "\""},
+	}
+	if chars, ok := oemKeys[vk]; ok {
+		if modifiers.Shift {
+			return chars[1]
+		}
+		return chars[0]
+	}
+
+	return ""
+}
+
+// CaptureTrackers connects the event trackers to the polling capture loop.
+// Tracker callbacks queue their events here and the loop drains the queue
+// into the workflow on each pass.
+type CaptureTrackers struct {
+	TextInput     *TextInputManager
+	BrowserTabs   *BrowserTabTracker
+	Hotkeys       *HotkeyDetector
+	TextSelection *TextSelectionTracker
+	DragDrop      *DragDropTracker
+	Commands      *CommandLineTracker
+	Fullscreen    *FullscreenMonitor
+	Titles        *WindowTitleTracker // nil unless RecordWindowTitles is set
+	Keyboard      *KeyboardPoller
+	Keys          *KeyTranslator
+	Switches      *SwitchMethodDetector
+	IME           *IMEComposition
+	Health        *TrackerHealthMonitor
+	Idle          *IdleDetector          // nil unless IdleThresholdSeconds is set
+	Clipboard     *ClipboardTracker      // Copies selections for TextSelection; nil for none
+	SecureField   func() bool            // Reports a focused password field; nil when not redacting
+	Config        WorkflowRecorderConfig // What the trackers were created with, for Restart
+
+	ScreenshotKeys []screenshotHotkeyPattern // Key presses that take a screenshot
+
+	LastWindowTitle string
+	LastProcessID   uint32
+	Pending         []WorkflowEvent
+	Mutex           sync.Mutex
+}
+
+// NewCaptureTrackers creates the trackers for one recording, enabling each
+// according to config
+func NewCaptureTrackers(config WorkflowRecorderConfig) *CaptureTrackers {
+	ct := &CaptureTrackers{
+		Fullscreen: NewFullscreenMonitor(config),
+		Titles:     NewWindowTitleTracker(config),
+		Keyboard:   &KeyboardPoller{},
+		Keys:       NewKeyTranslator(),
+		Switches:   NewSwitchMethodDetector(),
+		IME:        NewIMEComposition(),
+		Health:     NewTrackerHealthMonitor(config),
+		Idle:       NewIdleDetector(config),
+		Config:     config,
+	}
+	for _, name := range trackerNames {
+		ct.createTracker(name, config)
+	}
+	if config.ExcludePasswordFields {
+		ct.SecureField = isFocusedPasswordField
+	}
+	// Checked when the config was loaded
+	ct.ScreenshotKeys, _ = screenshotHotkeyPatterns(config.ScreenshotHotkeys)
+
+	return ct
+}
+
+// createTracker creates the named tracker afresh
+func (ct *CaptureTrackers) createTracker(name string, config WorkflowRecorderConfig) {
+	switch name {
+	case TrackerTextInput:
+		completionTimeout := time.Duration(config.TextInputCompletionTimeoutMs) * time.Millisecond
+		ct.TextInput = NewTextInputManager(completionTimeout, func(event TextInputCompletedEvent) { ct.enqueue(event) })
+	case TrackerBrowserTabs:
+		ct.BrowserTabs = NewBrowserTabTracker(func(event BrowserTabNavigationEvent) { ct.enqueue(event) })
+		ct.BrowserTabs.Idle = ct.Idle
+	case TrackerHotkeys:
+		ct.Hotkeys = NewHotkeyDetector(ct.handleHotkey)
+		// Checked when the config was loaded
+		patterns, chords, _ := customHotkeyPatterns(config.CustomHotkeys)
+		ct.Hotkeys.CustomPatterns = patterns
+		ct.Hotkeys.Chords = append(chords, ct.Hotkeys.Chords...)
+	case TrackerTextSelection:
+		ct.TextSelection = NewTextSelectionTracker(func(event TextSelectionEvent) { ct.enqueue(event) })
+		ct.TextSelection.ClipboardFallback = config.SelectionClipboardFallback
+		ct.TextSelection.CopySelection = ct.copySelection
+	case TrackerDragDrop:
+		ct.DragDrop = NewDragDropTracker(func(event DragDropEvent) { ct.enqueue(event) })
+	case TrackerCommands:
+		ct.Commands = NewCommandLineTracker()
+	}
+}
+
+// Restart replaces a tracker that has stopped responding with a fresh one.
+// What the old one was in the middle of, such as a text input session, is
+// lost with it.
+func (ct *CaptureTrackers) Restart(name string) {
+	ct.createTracker(name, ct.Config)
+	ct.Health.Restarted(name)
+}
+
+// copySelection copies the selection with the recorder's clipboard
+// tracker, so the round trip is not recorded
+func (ct *CaptureTrackers) copySelection() string {
+	if ct.Clipboard == nil {
+		return ""
+	}
+	return ct.Clipboard.CopySelection()
+}
+
+func (ct *CaptureTrackers) enqueue(event WorkflowEvent) {
+	ct.Health.RecordEvent(trackerForEvent(event))
+
+	ct.Mutex.Lock()
+	defer ct.Mutex.Unlock()
+
+	ct.Pending = append(ct.Pending, event)
+}
+
+// handleHotkey records the hotkey and lets the other trackers react to it
+func (ct *CaptureTrackers) handleHotkey(event HotkeyEvent) {
+	ct.Health.Run(TrackerBrowserTabs, func() { ct.BrowserTabs.HandleHotkey(event.Combination, event.Metadata.UIElement) })
+	ct.Health.Run(TrackerTextSelection, func() { ct.TextSelection.HandleKeyboardShortcut(event.Combination) })
+	ct.enqueue(event)
+}
+
+// Drain returns and clears the events queued by tracker callbacks
+func (ct *CaptureTrackers) Drain() []WorkflowEvent {
+	ct.Mutex.Lock()
+	defer ct.Mutex.Unlock()
+
+	events := ct.Pending
+	ct.Pending = nil
+	return events
+}
+
+// HandleKeys feeds key transitions to the trackers and returns the raw
+// keyboard events for them, with the text an IME committed since the last
+// pass
+func (ct *CaptureTrackers) HandleKeys(transitions []KeyTransition, element *UIElement) []WorkflowEvent {
+	events := ct.composedEvents()
+	if len(transitions) == 0 {
+		return events
+	}
+
+	modifiers := getCurrentModifierStates()
+	capsLock := isCapsLockOn()
+	secure := ct.SecureField != nil && ct.SecureField()
+	converting := ct.IME.IsConverting()
+	ct.Keys.Refresh()
+
+	ct.Health.Run(TrackerHotkeys, func() { ct.Hotkeys.SetApplication(element.ApplicationName) })
+	now := time.Now()
+	for _, transition := range transitions {
+		ct.Switches.HandleKey(transition.KeyCode, transition.IsKeyDown, now)
+		ct.Health.Run(TrackerHotkeys, func() { ct.Hotkeys.HandleKeyPress(transition.KeyCode, transition.IsKeyDown) })
+		ct.Health.Run(TrackerDragDrop, func() { ct.DragDrop.HandleKeyPress(transition.KeyCode, transition.IsKeyDown) })
+
+		var character *string
+		composing, printing := false, false
+		if transition.IsKeyDown {
+			char := ct.Keys.Character(transition.KeyCode, modifiers, capsLock)
+			printing = ct.Keys.Typed[transition.KeyCode]
+			composing = ct.IME.HandleKey(transition.KeyCode, char != "", converting)
+			if composing {
+				// The IME turns the keys into other text
+				char = ""
+			}
+			if char != "" {
+				character = &char
+			}
+
+			ct.Health.Run(TrackerTextInput, func() {
+				if composing {
+					if !ct.TextInput.HasActiveInputs() {
+						ct.TextInput.StartTextInput(element)
+					}
+					ct.TextInput.HandleKeystroke(VK_PROCESSKEY, "")
+				} else if char != "" {
+					// Typing into a window with no open session starts one
+					if !ct.TextInput.HasActiveInputs() {
+						ct.TextInput.StartTextInput(element)
+					}
+					if secure {
+						ct.TextInput.MarkSecure()
+					}
+					ct.TextInput.HandleKeystroke(transition.KeyCode, char)
+				} else if transition.KeyCode == VK_BACK || textInputBoundaryReason(transition.KeyCode) != "" {
+					ct.TextInput.HandleKeystroke(transition.KeyCode, "")
+				}
+			})
+		} else {
+			printing = ct.Keys.Released(transition.KeyCode)
+		}
+
+		event := KeyboardEvent{
+			KeyCode:        transition.KeyCode,
+			IsKeyDown:      transition.IsKeyDown,
+			ModifierStates: modifiers,
+			Character:      character,
+			IME:            composing,
+			Metadata:       createEventMetadata(),
+		}
+		// Releasing a character key gives it away as much as pressing it
+		if secure && printing {
+			event = redactKeyboardEvent(event)
+		}
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// composedEvents records the text an IME committed as a VK_PROCESSKEY press
+// and release carrying it, and adds it to the text input session
+func (ct *CaptureTrackers) composedEvents() []WorkflowEvent {
+	var events []WorkflowEvent
+	for _, commit := range ct.IME.Take() {
+		ct.Health.Run(TrackerTextInput, func() { ct.TextInput.HandleComposition(commit.Text, commit.Value) })
+		text := commit.Text
+		for _, down := range []bool{true, false} {
+			event := KeyboardEvent{
+				KeyCode:   VK_PROCESSKEY,
+				IsKeyDown: down,
+				Character: &text,
+				IME:       true,
+				Metadata:  createEventMetadata(),
+			}
+			if ct.SecureField != nil && ct.SecureField() {
+				event = redactKeyboardEvent(event)
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// HandleMouseDown, HandleMouseMove and HandleMouseUp forward left button
+// activity to the selection and drag trackers. A click on a submit control
+// also completes open text input sessions; clicked is the control
+// hit-tested under the press, nil when there is none, since the window's
+// title says nothing about what was clicked.
+func (ct *CaptureTrackers) HandleMouseDown(position Position, element *UIElement) {
+	ct.Switches.HandleClick(isTaskbarAt(position), time.Now())
+	ct.Health.Run(TrackerTextSelection, func() { ct.TextSelection.HandleMouseDown(position, MouseButtonLeft) })
+	ct.Health.Run(TrackerDragDrop, func() { ct.DragDrop.HandleMouseDown(position, MouseButtonLeft, element) })
+}
+
+func (ct *CaptureTrackers) HandleMouseMove(position Position) {
+	ct.Health.Run(TrackerTextSelection, func() { ct.TextSelection.HandleMouseMove(position) })
+	ct.Health.Run(TrackerDragDrop, func() { ct.DragDrop.HandleMouseMove(position) })
+}
+
+func (ct *CaptureTrackers) HandleMouseUp(position Position, element *UIElement, isClick bool, clicked *UIElement) {
+	ct.Health.Run(TrackerTextSelection, func() { ct.TextSelection.HandleMouseUp(position, MouseButtonLeft) })
+	ct.Health.Run(TrackerDragDrop, func() { ct.DragDrop.HandleMouseUp(position, MouseButtonLeft, element) })
+	if isClick {
+		ct.Health.Run(TrackerBrowserTabs, func() { ct.BrowserTabs.HandleClick(position, element) })
+		if clicked != nil && determineButtonInteractionType(*clicked) == ButtonSubmit {
+			ct.Health.Run(TrackerTextInput, func() { ct.TextInput.CompleteActiveInputs("submit_click") })
+		}
+	}
+}
+
+// HandleWindow notices foreground window changes. Any change ends open text
+// input sessions as a focus change; a new title also lets the browser tracker
+// detect tab changes.
+func (ct *CaptureTrackers) HandleWindow(element *UIElement) {
+	if element.ProcessID == ct.LastProcessID && element.WindowTitle == ct.LastWindowTitle {
+		return
+	}
+
+	ct.Health.Run(TrackerTextInput, func() { ct.TextInput.CompleteActiveInputs("focus_change") })
+	ct.IME.Reset()
+	if element.WindowTitle != ct.LastWindowTitle {
+		ct.Health.Run(TrackerBrowserTabs, func() { ct.BrowserTabs.HandleWindowChange(element) })
+	}
+
+	ct.LastProcessID = element.ProcessID
+	ct.LastWindowTitle = element.WindowTitle
+}
+
+// Flush completes open text input sessions and returns every event still
+// queued, waiting briefly for callbacks that are in flight
+func (ct *CaptureTrackers) Flush() []WorkflowEvent {
+	ct.Health.Run(TrackerTextInput, ct.TextInput.CompleteAllActiveInputs)
+	time.Sleep(trackerFlushGrace)
+	return ct.Drain()
+}
+
+// describeTrackerEvent returns a console line for a tracker event
+func describeTrackerEvent(event WorkflowEvent) string {
+	switch e := event.(type) {
+	case HotkeyEvent:
+		return Msg(MsgHotkey, e.Combination, e.Action)
+	case TextInputCompletedEvent:
+		return Msg(MsgTextInput, TruncateString(e.TextValue, 50, "..."), e.FieldName)
+	case BrowserTabNavigationEvent:
+		return Msg(MsgBrowserNavigation, e.Action, e.ToTitle)
+	case TextSelectionEvent:
+		return Msg(MsgSelection, TruncateString(e.SelectedText, 50, "..."), e.SelectionMethod)
+	case DragDropEvent:
+		return Msg(MsgDragDrop,
+			e.StartPosition.X, e.StartPosition.Y, e.EndPosition.X, e.EndPosition.Y)
+	case CommandEnteredEvent:
+		return Msg(MsgCommandEntered, TruncateString(e.Command, 50, "..."), e.Application)
+	case FullscreenChangedEvent:
+		if e.Fullscreen == FullscreenNone {
+			return Msg(MsgFullscreenLeft)
+		}
+		return Msg(MsgFullscreenEntered, e.Fullscreen, e.Application, e.CaptureMethod)
+	case WindowTitleChangedEvent:
+		return Msg(MsgWindowTitleChanged, e.PreviousTitle, e.WindowTitle)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,476 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chrome DevTools Protocol integration. When Chrome or Edge runs with
+// --remote-debugging-port, the recorder attaches to every tab and records
+// navigation, tab lifecycle, element clicks and form submits with CSS
+// selectors, which the UI Automation view of a browser can't provide.
+
+const (
+	defaultCDPDebuggingURL = "http://127.0.0.1:9222"
+	cdpCallTimeout         = 5 * time.Second
+	cdpBindingName         = "__claraverseRecord"
+)
+
+// CDPEventType is the kind of browser event reported over DevTools
+type CDPEventType string
+
+const (
+	CDPNavigation     CDPEventType = "Navigation"
+	CDPTabCreated     CDPEventType = "TabCreated"
+	CDPTabClosed      CDPEventType = "TabClosed"
+	CDPElementClicked CDPEventType = "ElementClicked"
+	CDPFormSubmitted  CDPEventType = "FormSubmitted"
+)
+
+// BrowserCDPEvent is a browser event reported by the DevTools Protocol
+type BrowserCDPEvent struct {
+	CDPEvent    CDPEventType  `json:"cdp_event"`
+	TargetID    string        `json:"target_id"`
+	URL         string        `json:"url"`
+	Title       string        `json:"title,omitempty"`
+	Selector    string        `json:"selector,omitempty"`
+	TagName     string        `json:"tag_name,omitempty"`
+	ElementText string        `json:"element_text,omitempty"`
+	FormAction  string        `json:"form_action,omitempty"`
+	Metadata    EventMetadata `json:"metadata"`
+}
+
+// cdpCaptureScript runs in every page and reports clicks and form submits
+// through the recorder binding. Selectors prefer an id or data-testid and
+// otherwise use a short tag:nth-of-type path.
+const cdpCaptureScript = `(() => {
+  if (window.__claraverseRecorder) return;
+  window.__claraverseRecorder = true;
+  const escape = s => (window.CSS && CSS.escape) ? CSS.escape(s) : s;
+  const selectorFor = el => {
+    const parts = [];
+    for (; el && el.nodeType === 1 && parts.length < 6; el = el.parentElement) {
+      if (el.id) { parts.unshift('#' + escape(el.id)); break; }
+      const testId = el.getAttribute('data-testid');
+      if (testId) { parts.unshift('[data-testid="' + testId.replace(/"/g, '\\"') + '"]'); break; }
+      let part = el.tagName.toLowerCase();
+      const parent = el.parentElement;
+      if (parent) {
+        const same = Array.from(parent.children).filter(c => c.tagName === el.tagName);
+        if (same.length > 1) part += ':nth-of-type(' + (same.indexOf(el) + 1) + ')';
+      }
+      parts.unshift(part);
+    }
+    return parts.join(' > ');
+  };
+  const record = (type, el, extra) => {
+    const send = window.__claraverseRecord;
+    if (typeof send !== 'function') return;
+    try {
+      send(JSON.stringify(Object.assign({
+        type: type,
+        selector: selectorFor(el),
+        tagName: el.tagName.toLowerCase(),
+        text: (el.innerText || el.value || '').trim().slice(0, 100),
+        url: location.href,
+        timestamp: Date.now()
+      }, extra)));
+    } catch (e) {}
+  };
+  document.addEventListener('click', e => {
+    if (e.target instanceof Element) record('click', e.target);
+  }, true);
+  document.addEventListener('submit', e => {
+    if (e.target instanceof HTMLFormElement) record('submit', e.target, {action: e.target.action});
+  }, true);
+})();`
+
+// cdpMessage is a DevTools command, response or event
+type cdpMessage struct {
+	ID        int64           `json:"id,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// cdpTargetInfo describes a DevTools target such as a tab
+type cdpTargetInfo struct {
+	TargetID string `json:"targetId"`
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+}
+
+// cdpPagePayload is what cdpCaptureScript sends through the binding
+type cdpPagePayload struct {
+	Type      string `json:"type"`
+	Selector  string `json:"selector"`
+	TagName   string `json:"tagName"`
+	Text      string `json:"text"`
+	Action    string `json:"action"`
+	URL       string `json:"url"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// CDPClient holds a DevTools connection to a browser and queues the events
+// it reports until the capture loop drains them
+type CDPClient struct {
+	DebuggingURL string
+	Conn         *WebSocketConn
+	Targets      map[string]*cdpTargetInfo // Page targets by target id
+	Sessions     map[string]string         // Target id by attached session id
+	Pending      []WorkflowEvent
+	Calls        map[int64]chan cdpMessage
+	NextID       int64
+	Mutex        sync.Mutex
+}
+
+// NewCDPClient creates a client for the browser debugging endpoint, e.g.
+// http://127.0.0.1:9222
+func NewCDPClient(debuggingURL string) *CDPClient {
+	return &CDPClient{
+		DebuggingURL: strings.TrimSuffix(debuggingURL, "/"),
+		Targets:      make(map[string]*cdpTargetInfo),
+		Sessions:     make(map[string]string),
+		Calls:        make(map[int64]chan cdpMessage),
+	}
+}
+
+// Connect attaches to the browser and every open tab, then watches for new ones
+func (c *CDPClient) Connect() error {
+	if err := c.dial(); err != nil {
+		return err
+	}
+
+	result, err := c.call("", "Target.getTargets", nil)
+	if err != nil {
+		c.Close()
+		return NewWorkflowError(ErrorTypeInitialization, "Failed to list browser tabs", err)
+	}
+	var targets struct {
+		TargetInfos []cdpTargetInfo `json:"targetInfos"`
+	}
+	json.Unmarshal(result, &targets)
+
+	for _, info := range targets.TargetInfos {
+		if info.Type != "page" {
+			continue
+		}
+		c.Mutex.Lock()
+		target := info
+		c.Targets[info.TargetID] = &target
+		c.Mutex.Unlock()
+		go c.attach(info.TargetID)
+	}
+
+	if _, err := c.call("", "Target.setDiscoverTargets", map[string]interface{}{"discover": true}); err != nil {
+		c.Close()
+		return NewWorkflowError(ErrorTypeInitialization, "Failed to watch browser tabs", err)
+	}
+
+	return nil
+}
+
+// dial opens the DevTools connection to the browser without attaching to
+// any tab
+func (c *CDPClient) dial() error {
+	httpClient := &http.Client{Timeout: cdpCallTimeout}
+	resp, err := httpClient.Get(c.DebuggingURL + "/json/version")
+	if err != nil {
+		return NewWorkflowError(ErrorTypeInitialization, "Browser debugging endpoint unreachable", err)
+	}
+	defer resp.Body.Close()
+
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil || version.WebSocketDebuggerURL == "" {
+		return NewWorkflowError(ErrorTypeInitialization, "Browser debugging endpoint returned no WebSocket URL", err)
+	}
+
+	conn, err := DialWebSocket(version.WebSocketDebuggerURL, cdpCallTimeout)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeInitialization, "Failed to connect to browser DevTools", err)
+	}
+
+	c.Mutex.Lock()
+	c.Conn = conn
+	c.Mutex.Unlock()
+
+	go c.readLoop(conn)
+
+	return nil
+}
+
+// Close disconnects from the browser. Events already reported stay queued.
+func (c *CDPClient) Close() {
+	c.Mutex.Lock()
+	conn := c.Conn
+	c.Conn = nil
+	c.Mutex.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// Drain returns and clears the queued events
+func (c *CDPClient) Drain() []WorkflowEvent {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	events := c.Pending
+	c.Pending = nil
+	return events
+}
+
+// call sends a command, on a tab session if sessionID is set, and waits for
+// its result
+func (c *CDPClient) call(sessionID, method string, params interface{}) (json.RawMessage, error) {
+	c.Mutex.Lock()
+	conn := c.Conn
+	if conn == nil {
+		c.Mutex.Unlock()
+		return nil, fmt.Errorf("not connected")
+	}
+	c.NextID++
+	id := c.NextID
+	response := make(chan cdpMessage, 1)
+	c.Calls[id] = response
+	c.Mutex.Unlock()
+
+	defer func() {
+		c.Mutex.Lock()
+		delete(c.Calls, id)
+		c.Mutex.Unlock()
+	}()
+
+	request := map[string]interface{}{"id": id, "method": method}
+	if params != nil {
+		request["params"] = params
+	}
+	if sessionID != "" {
+		request["sessionId"] = sessionID
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WriteText(data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg, ok := <-response:
+		if !ok {
+			return nil, fmt.Errorf("connection closed")
+		}
+		if msg.Error != nil {
+			return nil, fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		return msg.Result, nil
+	case <-time.After(cdpCallTimeout):
+		return nil, fmt.Errorf("%s timed out", method)
+	}
+}
+
+// readLoop dispatches responses to their callers and handles events until
+// the connection closes
+func (c *CDPClient) readLoop(conn *WebSocketConn) {
+	defer func() {
+		c.Mutex.Lock()
+		for id, response := range c.Calls {
+			close(response)
+			delete(c.Calls, id)
+		}
+		c.Mutex.Unlock()
+	}()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg cdpMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		if msg.ID != 0 {
+			c.Mutex.Lock()
+			if response, waiting := c.Calls[msg.ID]; waiting {
+				response <- msg
+			}
+			c.Mutex.Unlock()
+			continue
+		}
+
+		c.handleEvent(msg)
+	}
+}
+
+// attach opens a session on a tab and installs the click and submit capture
+func (c *CDPClient) attach(targetID string) {
+	result, err := c.call("", "Target.attachToTarget", map[string]interface{}{"targetId": targetID, "flatten": true})
+	if err != nil {
+		logger("cdp").Warn("Failed to attach to tab", "target", targetID, "error", err)
+		return
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	json.Unmarshal(result, &attached)
+
+	c.Mutex.Lock()
+	c.Sessions[attached.SessionID] = targetID
+	c.Mutex.Unlock()
+
+	steps := []struct {
+		method string
+		params interface{}
+	}{
+		{"Runtime.enable", nil},
+		{"Runtime.addBinding", map[string]interface{}{"name": cdpBindingName}},
+		{"Page.enable", nil},
+		{"Page.addScriptToEvaluateOnNewDocument", map[string]interface{}{"source": cdpCaptureScript}},
+		{"Runtime.evaluate", map[string]interface{}{"expression": cdpCaptureScript}},
+	}
+	for _, step := range steps {
+		if _, err := c.call(attached.SessionID, step.method, step.params); err != nil {
+			logger("cdp").Warn("Failed to set up tab", "target", targetID, "error", err)
+			return
+		}
+	}
+}
+
+// handleEvent turns DevTools events into workflow events. It runs on the
+// read loop, so anything that issues commands is started in a goroutine.
+func (c *CDPClient) handleEvent(msg cdpMessage) {
+	switch msg.Method {
+	case "Target.targetCreated", "Target.targetInfoChanged":
+		var params struct {
+			TargetInfo cdpTargetInfo `json:"targetInfo"`
+		}
+		if json.Unmarshal(msg.Params, &params) != nil || params.TargetInfo.Type != "page" {
+			return
+		}
+		info := params.TargetInfo
+
+		c.Mutex.Lock()
+		target, known := c.Targets[info.TargetID]
+		if !known {
+			c.Targets[info.TargetID] = &info
+			c.queue(BrowserCDPEvent{CDPEvent: CDPTabCreated, TargetID: info.TargetID, URL: info.URL, Title: info.Title}, 0)
+			c.Mutex.Unlock()
+			go c.attach(info.TargetID)
+			return
+		}
+		if info.URL != target.URL && info.URL != "" {
+			c.queue(BrowserCDPEvent{CDPEvent: CDPNavigation, TargetID: info.TargetID, URL: info.URL, Title: info.Title}, 0)
+		}
+		*target = info
+		c.Mutex.Unlock()
+
+	case "Target.targetDestroyed":
+		var params struct {
+			TargetID string `json:"targetId"`
+		}
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return
+		}
+
+		c.Mutex.Lock()
+		if target, known := c.Targets[params.TargetID]; known {
+			delete(c.Targets, params.TargetID)
+			c.queue(BrowserCDPEvent{CDPEvent: CDPTabClosed, TargetID: target.TargetID, URL: target.URL, Title: target.Title}, 0)
+		}
+		c.Mutex.Unlock()
+
+	case "Target.detachedFromTarget":
+		var params struct {
+			SessionID string `json:"sessionId"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			c.Mutex.Lock()
+			delete(c.Sessions, params.SessionID)
+			c.Mutex.Unlock()
+		}
+
+	case "Runtime.bindingCalled":
+		var params struct {
+			Name    string `json:"name"`
+			Payload string `json:"payload"`
+		}
+		if json.Unmarshal(msg.Params, &params) != nil || params.Name != cdpBindingName {
+			return
+		}
+		var payload cdpPagePayload
+		if json.Unmarshal([]byte(params.Payload), &payload) != nil {
+			return
+		}
+
+		event := BrowserCDPEvent{
+			URL:         payload.URL,
+			Selector:    payload.Selector,
+			TagName:     payload.TagName,
+			ElementText: payload.Text,
+		}
+		switch payload.Type {
+		case "click":
+			event.CDPEvent = CDPElementClicked
+		case "submit":
+			event.CDPEvent = CDPFormSubmitted
+			event.FormAction = payload.Action
+		default:
+			return
+		}
+
+		c.Mutex.Lock()
+		event.TargetID = c.Sessions[msg.SessionID]
+		if target, known := c.Targets[event.TargetID]; known {
+			event.Title = target.Title
+		}
+		c.queue(event, payload.Timestamp)
+		c.Mutex.Unlock()
+	}
+}
+
+// queue stamps an event with browser metadata and adds it to Pending. The
+// caller must hold the mutex.
+func (c *CDPClient) queue(event BrowserCDPEvent, timestamp uint64) {
+	if timestamp == 0 {
+		timestamp = captureTimestamp()
+	}
+	event.Metadata = EventMetadata{
+		UIElement: &UIElement{
+			Role:        event.TagName,
+			Name:        event.ElementText,
+			WindowTitle: event.Title,
+			URL:         event.URL,
+		},
+		Timestamp: timestamp,
+	}
+	c.Pending = append(c.Pending, event)
+}
+
+// describeCDPEvent returns a one-line console description of a DevTools event
+func describeCDPEvent(event BrowserCDPEvent) string {
+	switch event.CDPEvent {
+	case CDPElementClicked:
+		return Msg(MsgCDPClicked, event.Selector, event.URL)
+	case CDPFormSubmitted:
+		return Msg(MsgCDPSubmitted, event.Selector, event.FormAction)
+	default:
+		return fmt.Sprintf("🌐 %s: %s", event.CDPEvent, event.URL)
+	}
+}
@@ -0,0 +1,275 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Chunked output. With ChunkMinutes or ChunkEvents set, a recording is also
+// written while it runs, as numbered chunk files of the events since the
+// last chunk, so a crash loses at most the chunk being gathered. A manifest
+// beside the chunks lists them in order and, once the recording ends, names
+// the full recording file. Each chunk is itself a recording file, and the
+// manifest can be opened wherever a recording can, e.g. report or replay.
+//
+// Without chunking, recordings are still autosaved the same way every
+// AutosaveSeconds, to a directory that is removed once the recording is
+// saved. One left behind by a crash is stitched back into a recording by
+// --recover (see recovery.go).
+
+const (
+	chunkPollInterval       = time.Second
+	chunkManifestName       = "manifest.json"
+	chunkDirectorySuffix    = "_chunks"
+	autosaveDirectorySuffix = "_autosave"
+)
+
+// RecordingChunk describes one chunk file in a manifest
+type RecordingChunk struct {
+	File          string `json:"file"` // Relative to the manifest
+	Index         int    `json:"index"`
+	FirstSequence uint64 `json:"first_sequence"`
+	LastSequence  uint64 `json:"last_sequence"`
+	EventCount    int    `json:"event_count"`
+	WrittenAt     uint64 `json:"written_at"`
+}
+
+// ChunkManifest ties the chunks of a recording together
+type ChunkManifest struct {
+	SchemaVersion int              `json:"schema_version"` // Of the chunks
+	Name          string           `json:"name"`
+	StartTime     uint64           `json:"start_time"`
+	EndTime       uint64           `json:"end_time,omitempty"` // Set once the recording ends
+	Complete      bool             `json:"complete"`
+	Autosave      bool             `json:"autosave,omitempty"`  // Removed once the recording is saved
+	Recording     string           `json:"recording,omitempty"` // The full recording, once saved
+	Chunks        []RecordingChunk `json:"chunks"`
+}
+
+// recordingChunk is the content of a chunk file, laid out like a recording
+type recordingChunk struct {
+	SchemaVersion int             `json:"schema_version"`
+	Name          string          `json:"name"`
+	Chunk         int             `json:"chunk"`
+	StartTime     uint64          `json:"start_time"`
+	EndTime       uint64          `json:"end_time"`
+	Events        []WorkflowEvent `json:"events"`
+}
+
+// ChunkWriter writes a recording's events out in chunks as it runs
+type ChunkWriter struct {
+	Workflow    *RecordedWorkflow
+	Directory   string
+	MaxAge      time.Duration // Longest a chunk gathers events; 0 for no limit
+	MaxEvents   int           // Most events in a chunk; 0 for no limit
+	Autosave    bool          // Only kept until the recording is saved
+	Manifest    ChunkManifest
+	Written     int // Events of the workflow already in chunks
+	LastWritten time.Time
+	Mutex       sync.Mutex
+}
+
+// NewChunkWriter returns a writer for a recording's chunks, or for its
+// autosave when chunking is off. Returns nil when neither is on or nothing
+// will be saved.
+func NewChunkWriter(config WorkflowRecorderConfig, workflow *RecordedWorkflow) *ChunkWriter {
+	autosave := config.ChunkMinutes <= 0 && config.ChunkEvents <= 0
+	if (autosave && config.AutosaveSeconds <= 0) || config.DryRun {
+		return nil
+	}
+
+	suffix, maxAge := chunkDirectorySuffix, time.Duration(config.ChunkMinutes)*time.Minute
+	if autosave {
+		suffix, maxAge = autosaveDirectorySuffix, time.Duration(config.AutosaveSeconds)*time.Second
+	}
+	directory := fmt.Sprintf("ui_recording_enhanced_%s%s",
+		time.UnixMilli(int64(workflow.StartTime)).Format("20060102_150405"), suffix)
+	if config.OutputDirectory != "" {
+		directory = filepath.Join(config.OutputDirectory, directory)
+	}
+	return &ChunkWriter{
+		Workflow:  workflow,
+		Directory: directory,
+		MaxAge:    maxAge,
+		MaxEvents: config.ChunkEvents,
+		Autosave:  autosave,
+		Manifest: ChunkManifest{
+			SchemaVersion: SchemaVersion,
+			Name:          workflow.Name,
+			StartTime:     workflow.StartTime,
+			Autosave:      autosave,
+			Chunks:        []RecordingChunk{},
+		},
+		LastWritten: time.Now(),
+	}
+}
+
+// validateChunking checks the chunk limits are usable
+func validateChunking(config *WorkflowRecorderConfig) error {
+	if config.ChunkMinutes < 0 || config.ChunkEvents < 0 || config.AutosaveSeconds < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration, "ChunkMinutes, ChunkEvents and AutosaveSeconds cannot be negative", nil)
+	}
+	return nil
+}
+
+// Run writes a chunk whenever one is due, until ctx is cancelled
+func (cw *ChunkWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(chunkPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := cw.writeDue(now); err != nil {
+				logger("chunks").Error("Failed to write a recording chunk", "error", err)
+			}
+		}
+	}
+}
+
+// writeDue writes a chunk if the pending events reached MaxEvents or have
+// gathered for MaxAge
+func (cw *ChunkWriter) writeDue(now time.Time) error {
+	cw.Mutex.Lock()
+	defer cw.Mutex.Unlock()
+
+	// A burst of events may fill several chunks at once
+	for cw.MaxEvents > 0 && cw.Workflow.EventCount()-cw.Written >= cw.MaxEvents {
+		if err := cw.writeChunk(now, cw.MaxEvents); err != nil {
+			return err
+		}
+	}
+	if cw.MaxAge > 0 && now.Sub(cw.LastWritten) >= cw.MaxAge {
+		return cw.writeChunk(now, cw.MaxEvents)
+	}
+	return nil
+}
+
+// writeChunk writes up to limit pending events (all of them for 0) as the
+// next chunk, then the manifest listing it. Called with the lock held.
+func (cw *ChunkWriter) writeChunk(now time.Time, limit int) error {
+	pending := cw.Workflow.EventCount() - cw.Written
+	if limit <= 0 || limit > pending {
+		limit = pending
+	}
+	events, _ := cw.Workflow.EventsPage(cw.Written, limit)
+	if len(events) == 0 {
+		return nil
+	}
+
+	index := len(cw.Manifest.Chunks) + 1
+	chunk := RecordingChunk{
+		File:       fmt.Sprintf("chunk_%04d.json", index),
+		Index:      index,
+		EventCount: len(events),
+		WrittenAt:  uint64(now.UnixMilli()),
+	}
+	first, _ := eventMetadata(events[0])
+	last, _ := eventMetadata(events[len(events)-1])
+	chunk.FirstSequence, chunk.LastSequence = first.Sequence, last.Sequence
+
+	content := recordingChunk{
+		SchemaVersion: SchemaVersion,
+		Name:          cw.Workflow.Name,
+		Chunk:         index,
+		StartTime:     first.Timestamp,
+		EndTime:       last.Timestamp,
+		Events:        events,
+	}
+	if err := SaveJSONToFile(content, filepath.Join(cw.Directory, chunk.File)); err != nil {
+		return err
+	}
+
+	cw.Manifest.Chunks = append(cw.Manifest.Chunks, chunk)
+	cw.Written += len(events)
+	cw.LastWritten = now
+	return cw.saveManifest()
+}
+
+// saveManifest replaces the manifest, so a crash leaves the old one whole
+func (cw *ChunkWriter) saveManifest() error {
+	filename := filepath.Join(cw.Directory, chunkManifestName)
+	if err := SaveJSONToFile(cw.Manifest, filename+".partial"); err != nil {
+		return err
+	}
+	if err := os.Rename(filename+".partial", filename); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write chunk manifest", err)
+	}
+	return nil
+}
+
+// Flush writes all the remaining events as chunks
+func (cw *ChunkWriter) Flush() error {
+	cw.Mutex.Lock()
+	defer cw.Mutex.Unlock()
+	return cw.flush()
+}
+
+// flush writes the remaining events. Called with the lock held.
+func (cw *ChunkWriter) flush() error {
+	for cw.Workflow.EventCount() > cw.Written {
+		if err := cw.writeChunk(time.Now(), cw.MaxEvents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Discard removes the chunks, for an autosave no longer needed
+func (cw *ChunkWriter) Discard() error {
+	cw.Mutex.Lock()
+	defer cw.Mutex.Unlock()
+
+	if err := os.RemoveAll(cw.Directory); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to remove the autosave", err)
+	}
+	return nil
+}
+
+// Finish writes the remaining events as the last chunks and marks the
+// manifest complete, naming the full recording when one was saved
+func (cw *ChunkWriter) Finish(recording string) error {
+	cw.Mutex.Lock()
+	defer cw.Mutex.Unlock()
+
+	if err := cw.flush(); err != nil {
+		return err
+	}
+	cw.Workflow.Mutex.RLock()
+	cw.Manifest.EndTime = cw.Workflow.EndTime
+	cw.Workflow.Mutex.RUnlock()
+	cw.Manifest.Complete = true
+	if recording != "" {
+		if relative, err := filepath.Rel(cw.Directory, recording); err == nil {
+			cw.Manifest.Recording = filepath.ToSlash(relative)
+		}
+	}
+	return cw.saveManifest()
+}
+
+// loadChunkedRecording joins the chunks a manifest lists into one recording
+func loadChunkedRecording(filename string, manifest ChunkManifest) (*SavedRecording, error) {
+	recording := &SavedRecording{
+		Name:      manifest.Name,
+		StartTime: manifest.StartTime,
+		EndTime:   manifest.EndTime,
+	}
+	for _, chunk := range manifest.Chunks {
+		var content struct {
+			EndTime uint64       `json:"end_time"`
+			Events  []savedEvent `json:"events"`
+		}
+		if err := LoadRecordingFile(filepath.Join(filepath.Dir(filename), filepath.FromSlash(chunk.File)), &content); err != nil {
+			return nil, err
+		}
+		recording.Events = append(recording.Events, content.Events...)
+		recording.EndTime = max(recording.EndTime, content.EndTime)
+	}
+	return recording, nil
+}
@@ -0,0 +1,409 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+// The command line. The recorder takes a command and then options; without
+// a command it records. Every WorkflowRecorderConfig field is an option
+// named after it (--capture-screenshots=false) and an environment variable
+// (CLARAVERSE_CAPTURE_SCREENSHOTS=false). Settings come from the defaults,
+// then the --advanced-config profile, then the --config file, then the
+// environment, then the command line, each overriding the one before.
+
+const configEnvPrefix = "CLARAVERSE_"
+
+// cliCommands are the recorder's commands, in the order usage lists them
+var cliCommands = []struct{ Name, Arguments, Description string }{
+	{"record", "[options]", "Record a workflow until Ctrl+C or the --duration limit (the default)"},
+	{"serve", "[options]", "Run the HTTP API and record when a client asks to"},
+	{"daemon", "[options]", "Record continuously in the background, controlled through the HTTP API"},
+	{"daemon install", "[options]", "Start the daemon with these options at every login"},
+	{"daemon uninstall", "", "Stop starting the daemon at login"},
+	{"replay", "<recording.json> [--speed=<factor>] [--verify] [--result=<file>] [--sandbox[=<folder>] [--sandbox-command=<program>] [--sandbox-timeout=<time>]]", "Play a recording's clicks, drags, typing and hotkeys back, here or in a sandbox, checking each step against the recording with --verify"},
+	{"report", "<recording.json> [--format=html|markdown]", "Write a report of a recording"},
+	{"diff", "<before.json> <after.json> [--format=text|json]", "Compare the steps of two recordings"},
+	{"merge", "<recording.json> <recording.json>... [--out=<file>] [--name=<name>]", "Join recordings into one, their events in time order"},
+	{"import", "<project.side|steps.mht> [--out=<file>]", "Convert a Selenium IDE project or a Steps Recorder capture into a recording"},
+	{"size-report", "<recording.json> [--format=text|json]", "Show what takes up the space in a recording"},
+	{"analytics", "<recording.json>", "Write the time spent per application, window and page of a recording as JSON and CSV"},
+	{"convert", "<recording.json> --to=script|llm|segments|rrweb [--format=<script format>] [--token-budget=<n>]", "Convert a recording to a script, an LLM export, segment files or rrweb events"},
+	{"clip", "<recording.json> [--format=gif|webm]", "Render a recording as an animation"},
+	{"dataset", "<directory> [--out=<directory>] [--format=jsonl|json] [--bbox=xywh|xyxy|normalized]", "Export recordings as screenshot/action samples"},
+	{"tables", "<recording.json|directory> [--out=<directory>] [--format=parquet|csv]", "Write the events of recordings as one Parquet or CSV table per event type"},
+	{"update", "[options]", "Stage the latest release now"},
+	{"config lint", "[options]", "Check the configuration the options make"},
+	{"screenshots gc", "[--screenshot-store=<directory>]", "Remove stored screenshots no saved recording refers to"},
+	{"selectors check", "<recording.json> [--cdp=<url>] [--launch] [--out=<file>]", "Check the elements a recording clicked can still be found"},
+	{"help", "", "Show this help"},
+}
+
+// configOptionNames are option names that configOptionName cannot work out
+// from the field name
+var configOptionNames = map[string]string{
+	"HTTPAPIAddress": "http-api-address",
+	"HTTPAPIToken":   "http-api-token",
+}
+
+// legacyConfigOptions are options named like a config field that keep their
+// older meaning on the command line; only their environment variables set
+// the field
+var legacyConfigOptions = map[string]bool{
+	"mask-pii":        true, // --mask-pii=<entities>
+	"pii-patterns":    true, // --pii-patterns=<file>
+	"export-segments": true, // --export-segments=<recording.json>
+}
+
+// cliCommand returns the command args name, "record" when they start with an
+// option
+func cliCommand(args []string) string {
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		return "record"
+	}
+	if args[1] == "config" && len(args) > 2 && args[2] == "lint" {
+		return "config lint"
+	}
+	if args[1] == "selectors" && len(args) > 2 && args[2] == "check" {
+		return "selectors check"
+	}
+	if args[1] == "screenshots" && len(args) > 2 && args[2] == "gc" {
+		return "screenshots gc"
+	}
+	if args[1] == "daemon" && len(args) > 2 && (args[2] == "install" || args[2] == "uninstall") {
+		return "daemon " + args[2]
+	}
+	return args[1]
+}
+
+// isCLICommand reports whether name is one of the recorder's commands
+func isCLICommand(name string) bool {
+	for _, command := range cliCommands {
+		if command.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cliSetting returns the value of the --name option, else of its
+// environment variable
+func cliSetting(name string) (string, bool) {
+	if value, set := commandLineOption("--" + name); set {
+		return value, true
+	}
+	return os.LookupEnv(configEnvName(name))
+}
+
+// loadCommandLineConfig applies the --advanced-config profile, the --config
+// file, the environment and the command line to config, in that order
+func loadCommandLineConfig(config *WorkflowRecorderConfig) error {
+	if filename, set := cliSetting("advanced-config"); set {
+		if filename == "" {
+			return NewWorkflowError(ErrorTypeConfiguration, "--advanced-config needs a file name", nil)
+		}
+		advanced, err := loadAdvancedConfig(filename)
+		if err != nil {
+			return err
+		}
+		*config = applyAdvancedConfig(*config, advanced)
+	}
+
+	if filename, set := cliSetting("config"); set {
+		if filename == "" {
+			return NewWorkflowError(ErrorTypeConfiguration, "--config needs a file name", nil)
+		}
+		if err := LoadConfigFile(filename, config); err != nil {
+			return err
+		}
+	}
+	return applyConfigSettings(config, os.LookupEnv, commandLineOption)
+}
+
+// applyConfigSettings sets the fields of config, a pointer to a settings
+// struct, from their environment variables and then their options, as found
+// by lookupEnv and option
+func applyConfigSettings(config interface{}, lookupEnv, option func(string) (string, bool)) error {
+	fields := reflect.ValueOf(config).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		name := configOptionName(fields.Type().Field(i).Name)
+
+		envName := configEnvName(name)
+		if value, set := lookupEnv(envName); set {
+			if err := setConfigField(fields.Field(i), value); err != nil {
+				return NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("Invalid %s=%q", envName, value), err)
+			}
+		}
+
+		if legacyConfigOptions[name] {
+			continue
+		}
+		if value, set := option("--" + name); set {
+			if err := setConfigField(fields.Field(i), value); err != nil {
+				return NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("Invalid --%s=%q", name, value), err)
+			}
+		}
+	}
+	return nil
+}
+
+// setConfigField parses value into a config field. A bare option (empty
+// value) switches a boolean on; lists are comma-separated and other
+// structured settings are JSON.
+func setConfigField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.Bool:
+		if value == "" {
+			field.SetBool(true)
+			return nil
+		}
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if field.Type() == reflect.TypeOf(Normal) {
+			for mode := Normal; mode <= LowEnergy; mode++ {
+				if strings.EqualFold(value, mode.String()) {
+					field.SetInt(int64(mode))
+					return nil
+				}
+			}
+		}
+		parsed, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+
+	case reflect.Ptr:
+		parsed := reflect.New(field.Type().Elem())
+		if err := setConfigField(parsed.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(parsed)
+
+	case reflect.Map:
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return json.Unmarshal([]byte(value), field.Addr().Interface())
+		}
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+
+	default:
+		return NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("Settings of type %s are not supported", field.Type()), nil)
+	}
+	return nil
+}
+
+// configOptionName turns a config field name into its option name, e.g.
+// ScreenshotJPEGQuality into screenshot-jpeg-quality
+func configOptionName(field string) string {
+	if name, ok := configOptionNames[field]; ok {
+		return name
+	}
+
+	runes := []rune(field)
+	var name strings.Builder
+	for i, r := range runes {
+		// A word starts at an upper-case letter after a lower-case one, or at
+		// the last letter of an acronym followed by a lower-case one
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			name.WriteByte('-')
+		}
+		name.WriteRune(unicode.ToLower(r))
+	}
+	return name.String()
+}
+
+// configEnvName returns the environment variable for an option name, e.g.
+// CLARAVERSE_SCREENSHOT_JPEG_QUALITY
+func configEnvName(name string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// recordingDuration returns the --duration limit, or 0 for none
+func recordingDuration() (time.Duration, error) {
+	value, set := cliSetting("duration")
+	if !set || value == "" {
+		return 0, nil
+	}
+	limit, err := time.ParseDuration(value)
+	if err != nil || limit <= 0 {
+		return 0, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Invalid --duration %q: use a time such as 30m or 1h30m", value), err)
+	}
+	return limit, nil
+}
+
+// printUsage describes the commands, options and settings
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: workflow-recorder-enhanced [command] [options]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, command := range cliCommands {
+		fmt.Fprintf(w, "  %s\n      %s\n", strings.TrimSpace(command.Name+" "+command.Arguments), command.Description)
+	}
+
+	fmt.Fprintln(w, "\nOptions:")
+	fmt.Fprintf(w, "  --config=<file>        Load settings from a JSON or YAML file (%s)\n", configEnvName("config"))
+	fmt.Fprintf(w, "  --advanced-config=<file>\n                         Apply an advanced profile from a JSON or YAML file (%s)\n", configEnvName("advanced-config"))
+	fmt.Fprintln(w, "  --output=<directory>   Save recordings in a directory")
+	fmt.Fprintf(w, "  --duration=<time>      Stop recording after a time such as 30m (%s)\n", configEnvName("duration"))
+	fmt.Fprintln(w, "  --lang=<locale>        Console and report language")
+	fmt.Fprintln(w, "  --recover              Save recordings a crash left unsaved, then carry on")
+	fmt.Fprintln(w, "  --resume               Continue the latest recording a crash or reboot left unsaved")
+	fmt.Fprintln(w, "  --background           Run the daemon without a console window")
+
+	fmt.Fprintln(w, "\nSettings, as options or environment variables:")
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defaults := reflect.ValueOf(DefaultConfig())
+	for i := 0; i < defaults.NumField(); i++ {
+		field := defaults.Type().Field(i)
+		name := configOptionName(field.Name)
+
+		// Options with an older meaning are described with the other options
+		option := fmt.Sprintf("--%s=<%s>", name, configSettingKind(field.Type))
+		if legacyConfigOptions[name] {
+			option = ""
+		}
+		defaultValue := ""
+		switch value := defaults.Field(i); value.Kind() {
+		case reflect.Bool, reflect.String, reflect.Int, reflect.Int32, reflect.Int64, reflect.Float64:
+			if !value.IsZero() {
+				defaultValue = fmt.Sprintf("default %v", value.Interface())
+			}
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\n", option, configEnvName(name), defaultValue)
+	}
+	table.Flush()
+}
+
+// configSettingKind names the kind of value a setting takes
+func configSettingKind(t reflect.Type) string {
+	if t == reflect.TypeOf(Normal) {
+		return "Normal|Balanced|LowEnergy"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true|false"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	case reflect.Ptr:
+		return configSettingKind(t.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			return "a,b,..."
+		}
+		return "json"
+	case reflect.Map:
+		return "json"
+	default:
+		return "text"
+	}
+}
+
+// runConvert converts a saved recording to the format --to names, looking
+// for moved screenshot stores in store
+func runConvert(recording, store string) error {
+	target, _ := commandLineOption("--to")
+	format, _ := commandLineOption("--format")
+	switch target {
+	case "script":
+		return runScriptExport(recording, ScriptFormat(format))
+	case "llm":
+		return runLLMExport(recording, store)
+	case "segments":
+		return runSegmentsExport(recording)
+	case "rrweb":
+		return runRRWebExport(recording, store)
+	default:
+		return NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Unknown conversion %q: use --to=script, --to=llm, --to=segments or --to=rrweb", target), nil)
+	}
+}
+
+// runScriptExport writes a saved recording as a script, Playwright unless
+// format names another
+func runScriptExport(recording string, format ScriptFormat) error {
+	if format == "" {
+		format = ScriptFormatPlaywright
+	}
+	scriptFile, err := exportRecordingScript(recording, format)
+	if err != nil {
+		return err
+	}
+	fmt.Println(Msg(MsgScriptExported, format, scriptFile))
+	return nil
+}
+
+// runLLMExport writes a saved recording compressed to the --token-budget
+func runLLMExport(recording, store string) error {
+	budget := defaultTokenBudget
+	if value, set := commandLineOption("--token-budget"); set {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("Invalid --token-budget %q", value), err)
+		}
+		budget = parsed
+	}
+	export, exportFile, err := exportRecordingForLLM(recording, budget, store)
+	if err != nil {
+		return err
+	}
+	fmt.Println(Msg(MsgLLMExported,
+		len(export.Steps), len(export.Screenshots), export.EstimatedTokens, budget, exportFile))
+	fmt.Println(Msg(MsgLLMDropped,
+		export.Dropped.Steps, export.Dropped.Screenshots, export.Dropped.TruncatedTexts))
+	return nil
+}
+
+// runSegmentsExport splits a saved recording into its marked segments
+func runSegmentsExport(recording string) error {
+	files, err := exportSavedRecordingSegments(recording)
+	if err != nil {
+		return err
+	}
+	fmt.Println(Msg(MsgSegmentsExported, len(files), recording))
+	return nil
+}
+
+// runRRWebExport writes the web pages of a saved recording as rrweb events
+func runRRWebExport(recording, store string) error {
+	export, rrwebFile, err := exportRecordingRRWeb(recording, store)
+	if err != nil {
+		return err
+	}
+	fmt.Println(Msg(MsgRRWebExported, len(export.Events), export.Pages, rrwebFile))
+	return nil
+}
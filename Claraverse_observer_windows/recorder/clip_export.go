@@ -0,0 +1,259 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Shareable clips of a recording. `clip <recording.json>` plays the
+// screenshots back as an animated GIF, or a WebM through ffmpeg, for a quick
+// "here's what happened". Each frame shows for as long as it did while
+// recording, within limits, with the clicks made on it marked where they
+// landed and the text typed captioned along the bottom.
+
+// ClipFormat is the file type of a clip
+type ClipFormat string
+
+const (
+	ClipFormatGIF  ClipFormat = "gif"
+	ClipFormatWebM ClipFormat = "webm"
+)
+
+const (
+	clipMaxWidth     = 960
+	clipMinFrameMs   = 600
+	clipMaxFrameMs   = 3000
+	clipCaptionScale = 2
+	clipCaptionPad   = 6
+)
+
+var (
+	clipCaptionBackground = color.RGBA{R: 0, G: 0, B: 0, A: 255}
+	clipCaptionColor      = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+// clipFrame is a screenshot of a clip with what the user did while it was
+// the latest one
+type clipFrame struct {
+	Screenshot RecordingScreenshot
+	DurationMs uint64
+	Clicks     []Position
+	Typed      []string
+}
+
+// buildClipFrames turns a recording's screenshots into frames. Clicks and
+// typed text go on the last screenshot taken before them, which shows what
+// the user was looking at; anything before the first goes on the first.
+func buildClipFrames(recording *SavedRecording) []clipFrame {
+	screenshots := recording.Screenshots()
+	if len(screenshots) == 0 {
+		return nil
+	}
+
+	frames := make([]clipFrame, len(screenshots))
+	for i, screenshot := range screenshots {
+		frames[i].Screenshot = screenshot
+		frames[i].DurationMs = clipMaxFrameMs
+		if i+1 < len(screenshots) {
+			if gap := screenshots[i+1].OffsetMs - screenshot.OffsetMs; gap < clipMaxFrameMs {
+				frames[i].DurationMs = max(gap, clipMinFrameMs)
+			}
+		}
+	}
+
+	current := 0
+	for i, event := range recording.Events {
+		for current+1 < len(frames) && frames[current+1].Screenshot.Index <= i {
+			current++
+		}
+
+		switch {
+		case event.TextValue != nil:
+			if text := strings.Join(strings.Fields(*event.TextValue), " "); text != "" {
+				frames[current].Typed = append(frames[current].Typed, fmt.Sprintf("%q", text))
+			}
+		case event.Position != nil && isClickEvent(MouseEventType(event.EventType)):
+			frames[current].Clicks = append(frames[current].Clicks, *event.Position)
+		}
+	}
+	return frames
+}
+
+// isClickEvent reports whether a mouse event type is a click
+func isClickEvent(eventType MouseEventType) bool {
+	return eventType == MouseClick || eventType == MouseDoubleClick || eventType == MouseRightClick
+}
+
+// renderClipFrame decodes a frame's screenshot, fits it to clipMaxWidth and
+// draws its clicks and caption. The result may be a pooled frame buffer.
+func renderClipFrame(frame clipFrame) (*image.RGBA, error) {
+	data, err := base64.StdEncoding.DecodeString(frame.Screenshot.ImageBase64)
+	if err != nil {
+		return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to decode screenshot", err)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to decode screenshot", err)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	maxWidth := clipMaxWidth
+	if scaled := scaleToFit(img, &maxWidth, nil); scaled != nil {
+		img = scaled
+	}
+
+	area := frame.Screenshot.area(decoded.Bounds().Dx(), decoded.Bounds().Dy())
+	stroke := annotationStroke(img.Rect.Dx())
+	for _, click := range frame.Clicks {
+		x := int(click.X-area[0]) * img.Rect.Dx() / int(area[2])
+		y := int(click.Y-area[1]) * img.Rect.Dy() / int(area[3])
+		drawCursorMarker(img, image.Pt(x, y), stroke, annotationCursorColor)
+	}
+
+	if len(frame.Typed) > 0 {
+		drawClipCaption(img, strings.Join(frame.Typed, "  "))
+	}
+	return img, nil
+}
+
+// drawClipCaption draws text on a bar along the bottom of img, cut to fit
+func drawClipCaption(img *image.RGBA, text string) {
+	maxChars := (img.Rect.Dx() - 2*clipCaptionPad) / (captionGlyphAdvance * clipCaptionScale)
+	if maxChars < 4 {
+		return
+	}
+	if runes := []rune(text); len(runes) > maxChars {
+		text = string(runes[:maxChars-3]) + "..."
+	}
+
+	height := captionGlyphHeight*clipCaptionScale + 2*clipCaptionPad
+	bar := image.Rect(img.Rect.Min.X, img.Rect.Max.Y-height, img.Rect.Max.X, img.Rect.Max.Y)
+	fillRect(img, bar, clipCaptionBackground)
+	drawCaptionText(img, bar.Min.Add(image.Pt(clipCaptionPad, clipCaptionPad)), text, clipCaptionScale, clipCaptionColor)
+}
+
+// encodeClipGIF writes frames as an animated GIF that loops forever
+func encodeClipGIF(frames []clipFrame) ([]byte, error) {
+	animation := &gif.GIF{}
+	for _, frame := range frames {
+		img, err := renderClipFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+		paletted := image.NewPaletted(img.Rect, palette.Plan9)
+		draw.Draw(paletted, img.Rect, img, img.Rect.Min, draw.Src)
+		releaseFrameBuffer(img)
+
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, int(frame.DurationMs/10))
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to encode GIF", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeClipWebM writes frames to clipFile as VP9 WebM with ffmpeg, which
+// must be on PATH. The frames are passed as PNG files with their durations
+// in an ffmpeg concat list.
+func encodeClipWebM(frames []clipFrame, clipFile string) error {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSystem, "WebM clips need ffmpeg on PATH; use --format=gif without it", err)
+	}
+
+	dir, err := os.MkdirTemp("", "recorder-clip-*")
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to create clip frame directory", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var list strings.Builder
+	for i, frame := range frames {
+		img, err := renderClipFrame(frame)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		err = png.Encode(&buf, img)
+		releaseFrameBuffer(img)
+		if err != nil {
+			return NewWorkflowError(ErrorTypeSerialization, "Failed to encode clip frame", err)
+		}
+		name := fmt.Sprintf("frame_%04d.png", i)
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+			return NewWorkflowError(ErrorTypeFileIO, "Failed to write clip frame", err)
+		}
+		fmt.Fprintf(&list, "file '%s'\nduration %.3f\n", name, float64(frame.DurationMs)/1000)
+		// The concat demuxer ignores the last duration unless the file repeats
+		if i == len(frames)-1 {
+			fmt.Fprintf(&list, "file '%s'\n", name)
+		}
+	}
+	listFile := filepath.Join(dir, "frames.txt")
+	if err := os.WriteFile(listFile, []byte(list.String()), 0644); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write clip frame list", err)
+	}
+
+	absolute, err := filepath.Abs(clipFile)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Invalid clip file name", err)
+	}
+	cmd := exec.Command(ffmpeg, "-y", "-loglevel", "error", "-f", "concat", "-safe", "0", "-i", listFile,
+		"-vf", "pad=ceil(iw/2)*2:ceil(ih/2)*2", "-c:v", "libvpx-vp9", "-pix_fmt", "yuv420p", absolute)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return NewWorkflowError(ErrorTypeSystem,
+			fmt.Sprintf("ffmpeg failed: %s", strings.TrimSpace(string(output))), err)
+	}
+	return nil
+}
+
+// exportRecordingClip writes a saved recording as a clip next to it, named
+// <base>_clip.gif or <base>_clip.webm, and returns the file written
+func exportRecordingClip(filename string, format ClipFormat, store string) (string, error) {
+	if format != ClipFormatGIF && format != ClipFormatWebM {
+		return "", NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Unknown clip format %q (use gif or webm)", format), nil)
+	}
+
+	recording, err := LoadSavedRecording(filename, store)
+	if err != nil {
+		return "", err
+	}
+	frames := buildClipFrames(recording)
+	if len(frames) == 0 {
+		return "", NewWorkflowError(ErrorTypeConfiguration,
+			"The recording has no screenshots to make a clip from; record with screenshots enabled", nil)
+	}
+
+	clipFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + "_clip." + string(format)
+	if format == ClipFormatWebM {
+		if err := encodeClipWebM(frames, clipFile); err != nil {
+			return "", err
+		}
+		return clipFile, nil
+	}
+
+	data, err := encodeClipGIF(frames)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(clipFile, data, 0644); err != nil {
+		return "", NewWorkflowError(ErrorTypeFileIO, "Failed to write clip", err)
+	}
+	return clipFile, nil
+}
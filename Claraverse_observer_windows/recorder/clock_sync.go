@@ -0,0 +1,161 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// Clock offset measurement against an NTP server at the start of a session,
+// so recordings made on several machines can be merged onto one timeline.
+// A minimal SNTP (RFC 4330) client: several requests are sent and the one
+// with the shortest round trip gives the offset, since its timing is the
+// least distorted by network delay.
+
+const (
+	defaultNTPServer = "pool.ntp.org"
+	ntpSamples       = 4
+	ntpSampleTimeout = time.Second
+	ntpPacketSize    = 48
+	// ntpEpochOffset is the seconds from 1900, the NTP epoch, to 1970
+	ntpEpochOffset = 2208988800
+)
+
+// ClockSync is the measured offset of the recording machine's clock. Adding
+// OffsetMs to a recorded timestamp gives the NTP server's time.
+type ClockSync struct {
+	Host        string  `json:"host"`
+	Server      string  `json:"server"`
+	OffsetMs    float64 `json:"offset_ms"`
+	RoundTripMs float64 `json:"round_trip_ms"`
+	Samples     int     `json:"samples"`
+	MeasuredAt  uint64  `json:"measured_at"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// MeasureClockOffset queries server (host or host:port) samples times and
+// returns the offset from the reply with the shortest round trip
+func MeasureClockOffset(server string, samples int, timeout time.Duration) (*ClockSync, error) {
+	address := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		address = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return nil, NewWorkflowError(ErrorTypeSystem, "Failed to reach NTP server", err)
+	}
+	defer conn.Close()
+
+	host, _ := os.Hostname()
+	clock := &ClockSync{Host: host, Server: server, MeasuredAt: captureTimestamp()}
+
+	var best time.Duration
+	var lastErr error
+	for i := 0; i < samples; i++ {
+		offset, roundTrip, err := queryNTP(conn, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if clock.Samples == 0 || roundTrip < best {
+			best = roundTrip
+			clock.OffsetMs = float64(offset) / float64(time.Millisecond)
+			clock.RoundTripMs = float64(roundTrip) / float64(time.Millisecond)
+		}
+		clock.Samples++
+	}
+
+	if clock.Samples == 0 {
+		return nil, NewWorkflowError(ErrorTypeSystem, "No reply from NTP server", lastErr)
+	}
+	return clock, nil
+}
+
+// queryNTP sends one client request over conn and returns the clock offset
+// and round trip delay it measures
+func queryNTP(conn net.Conn, timeout time.Duration) (time.Duration, time.Duration, error) {
+	request := make([]byte, ntpPacketSize)
+	request[0] = 0x23 // Leap indicator 0, version 4, client mode
+
+	// The server echoes the transmit time as the originate time, which
+	// matches its reply to this request
+	sent := time.Now()
+	binary.BigEndian.PutUint64(request[40:], toNTPTime(sent))
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(request); err != nil {
+		return 0, 0, err
+	}
+
+	reply := make([]byte, ntpPacketSize)
+	for {
+		n, err := conn.Read(reply)
+		if err != nil {
+			return 0, 0, err
+		}
+		if n == ntpPacketSize && bytes.Equal(reply[24:32], request[40:48]) {
+			break
+		}
+		// A late reply to an earlier request, or not NTP at all
+	}
+	received := time.Now()
+
+	if mode := reply[0] & 0x07; mode != 4 {
+		return 0, 0, fmt.Errorf("NTP reply has mode %d, want server mode 4", mode)
+	}
+	if stratum := reply[1]; stratum == 0 {
+		return 0, 0, fmt.Errorf("NTP server sent a kiss-o'-death reply %q", reply[12:16])
+	}
+
+	serverReceived := fromNTPTime(binary.BigEndian.Uint64(reply[32:]))
+	serverSent := fromNTPTime(binary.BigEndian.Uint64(reply[40:]))
+
+	offset := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	roundTrip := received.Sub(sent) - serverSent.Sub(serverReceived)
+	return offset, roundTrip, nil
+}
+
+// toNTPTime encodes t as a 64-bit NTP timestamp: seconds since 1900 and a
+// binary fraction of a second
+func toNTPTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// fromNTPTime decodes a 64-bit NTP timestamp
+func fromNTPTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanoseconds := (ntp & 0xffffffff) * uint64(time.Second) >> 32
+	return time.Unix(seconds, int64(nanoseconds))
+}
+
+// startClockSync measures the clock offset in the background and stores it
+// on workflow. The returned channel closes once it is stored.
+func startClockSync(workflow *RecordedWorkflow, server string) chan struct{} {
+	done := make(chan struct{})
+	if server == "" {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+
+		clock, err := MeasureClockOffset(server, ntpSamples, ntpSampleTimeout)
+		if err != nil {
+			logger("clock").Warn("Clock sync failed", "server", server, "error", err)
+			host, _ := os.Hostname()
+			clock = &ClockSync{Host: host, Server: server, MeasuredAt: captureTimestamp(), Error: err.Error()}
+		}
+
+		workflow.Mutex.Lock()
+		workflow.Clock = clock
+		workflow.Mutex.Unlock()
+	}()
+	return done
+}
@@ -0,0 +1,109 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Config files. Settings files are JSON, or YAML when named .yaml or .yml,
+// and are checked against the settings they fill: an unknown key or a value
+// of the wrong type is an error naming the setting, rather than being
+// silently ignored.
+
+// isYAMLFile reports whether a config file is written in YAML
+func isYAMLFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// LoadConfigFile reads a JSON or YAML config file into config, a pointer to
+// a settings struct. Settings the file leaves out keep their values.
+func LoadConfigFile(filename string, config interface{}) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to read config file", err)
+	}
+
+	if isYAMLFile(filename) {
+		if data, err = yamlToJSON(data); err != nil {
+			return NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("Config file %s: %v", filename, err), nil)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Config file %s: %s", filename, configDecodeError(err, data)), nil)
+	}
+	return nil
+}
+
+// configDecodeError explains why a config file does not decode, naming the
+// setting at fault
+func configDecodeError(err error, data []byte) string {
+	var typeError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+	switch {
+	case errors.As(err, &typeError) && typeError.Field == "":
+		return "settings must be a mapping of names to values, not " + typeError.Value
+	case errors.As(err, &typeError):
+		return fmt.Sprintf("%s must be %s, not %s", typeError.Field, configValueKind(typeError.Type), typeError.Value)
+	case errors.As(err, &syntaxError):
+		line := bytes.Count(data[:min(int(syntaxError.Offset), len(data))], []byte("\n")) + 1
+		return fmt.Sprintf("line %d: %v", line, err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return "unknown setting " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	}
+	return err.Error()
+}
+
+// configValueKind names the kind of value a setting holds in a config file
+func configValueKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "text"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Ptr:
+		return configValueKind(t.Elem())
+	default:
+		return "a mapping"
+	}
+}
+
+// SaveConfigFile writes config as JSON, or as YAML when filename ends in
+// .yaml or .yml
+func SaveConfigFile(config interface{}, filename string) error {
+	if !isYAMLFile(filename) {
+		return SaveJSONToFile(config, filename)
+	}
+
+	data, err := marshalYAML(config)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSerialization, "Failed to write YAML", err)
+	}
+	if err := EnsureDirectoryExists(filepath.Dir(filename)); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to create directory", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write file", err)
+	}
+	return nil
+}
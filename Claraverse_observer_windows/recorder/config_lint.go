@@ -0,0 +1,117 @@
+package recorder
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Privacy lint of a configuration. ValidateConfig rejects settings that
+// cannot work; LintConfig flags settings that work but risk capturing or
+// exposing more than intended. `config lint` prints the findings, and with
+// StrictPrivacy set a recording does not start until they are resolved.
+
+// Lint rules
+const (
+	LintClipboardUnredacted  = "clipboard-unredacted"
+	LintPasswordManagerShown = "password-manager-screenshots"
+	LintUnencryptedNetwork   = "unencrypted-network"
+)
+
+// passwordManager is an application whose windows should never be captured
+type passwordManager struct {
+	Name    string
+	Process string
+}
+
+var knownPasswordManagers = []passwordManager{
+	{Name: "1Password", Process: "1password.exe"},
+	{Name: "LastPass", Process: "lastpass.exe"},
+	{Name: "Bitwarden", Process: "bitwarden.exe"},
+	{Name: "KeePass", Process: "keepass.exe"},
+	{Name: "KeePassXC", Process: "keepassxc.exe"},
+	{Name: "Dashlane", Process: "dashlane.exe"},
+}
+
+// LintFinding is one risky setting
+type LintFinding struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// LintConfig returns the privacy risks in config
+func LintConfig(config WorkflowRecorderConfig) []LintFinding {
+	var findings []LintFinding
+	add := func(rule string, key MessageKey, args ...interface{}) {
+		findings = append(findings, LintFinding{Rule: rule, Message: Msg(key, args...)})
+	}
+
+	if config.RecordClipboard {
+		add(LintClipboardUnredacted,
+			MsgLintClipboard)
+	}
+
+	if config.CaptureScreenshots {
+		var exposed []string
+		for _, manager := range knownPasswordManagers {
+			if !ignoredByConfig(config, manager.Process, manager.Name) &&
+				profileConfig(config, manager.Process, manager.Name).CaptureScreenshots {
+				exposed = append(exposed, manager.Name)
+			}
+		}
+		if len(exposed) > 0 {
+			add(LintPasswordManagerShown,
+				MsgLintPasswordManagers, strings.Join(exposed, ", "))
+		}
+	}
+
+	if address := config.HTTPAPIAddress; address != "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil || !isLoopbackHost(host) {
+			add(LintUnencryptedNetwork,
+				MsgLintHTTPAPI, address)
+		}
+	}
+	if endpoint := config.VisionEndpoint; endpoint != "" {
+		if u, err := url.Parse(endpoint); err == nil && u.Scheme == "http" && !isLoopbackHost(u.Hostname()) {
+			add(LintUnencryptedNetwork,
+				MsgLintVision, endpoint)
+		}
+	}
+	if debuggingURL := config.CDPDebuggingURL; debuggingURL != "" {
+		if u, err := url.Parse(debuggingURL); err == nil && !isLoopbackHost(u.Hostname()) {
+			add(LintUnencryptedNetwork,
+				MsgLintCDP, debuggingURL)
+		}
+	}
+
+	return findings
+}
+
+// checkStrictPrivacy fails when config asks for strict privacy and has lint
+// findings
+func checkStrictPrivacy(config WorkflowRecorderConfig) error {
+	if !config.StrictPrivacy {
+		return nil
+	}
+
+	findings := LintConfig(config)
+	if len(findings) == 0 {
+		return nil
+	}
+	messages := make([]string, len(findings))
+	for i, finding := range findings {
+		messages[i] = finding.Message
+	}
+	return NewWorkflowError(ErrorTypeConfiguration,
+		Msg(MsgStrictPrivacy, strings.Join(messages, "; ")), nil)
+}
+
+// isLoopbackHost reports whether host only reaches this machine
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,139 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Background daemon for continuous capture. daemon records without end,
+// rotating to a new file at the recording limits (hourly unless others are
+// given), carries on a recording a logoff or crash left unfinished, logs to
+// a rotating file and is controlled through the HTTP API. daemon install
+// starts it at every login of the current user, with the options given to
+// install, from the user's Run key; daemon uninstall removes the entry.
+// It is not a Windows service: services run in session 0, which cannot see
+// the user's desktop, input or windows, so the daemon runs in the session it
+// records.
+
+var (
+	advapi32           = syscall.NewLazyDLL("advapi32.dll")
+	procRegCreateKeyEx = advapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueEx  = advapi32.NewProc("RegSetValueExW")
+	procRegDeleteValue = advapi32.NewProc("RegDeleteValueW")
+	procRegCloseKey    = advapi32.NewProc("RegCloseKey")
+	procFreeConsole    = kernel32.NewProc("FreeConsole")
+)
+
+const (
+	HKEY_CURRENT_USER    = 0x80000001
+	KEY_SET_VALUE        = 0x0002
+	REG_SZ               = 1
+	ERROR_FILE_NOT_FOUND = 2
+
+	daemonRunKey        = `Software\Microsoft\Windows\CurrentVersion\Run`
+	daemonRunValue      = "ClaraVerseWorkflowRecorder"
+	daemonRotateMinutes = 60
+	defaultLogFile      = "recorder.log"
+)
+
+// applyDaemonDefaults configures a daemon: the HTTP API it is controlled
+// through, a log file and recordings that rotate rather than stop
+func applyDaemonDefaults(config *WorkflowRecorderConfig) {
+	if config.HTTPAPIAddress == "" {
+		config.HTTPAPIAddress = defaultHTTPAPIAddress
+	}
+	if config.LogFile == "" {
+		config.LogFile = filepath.Join(config.OutputDirectory, defaultLogFile)
+	}
+	if config.MaxRecordingMinutes == 0 && config.MaxRecordingSizeMB == 0 {
+		config.MaxRecordingMinutes = daemonRotateMinutes
+	}
+	config.RotateRecording = true
+}
+
+// daemonCommandLine returns the command the Run key starts the daemon with.
+// Programs started at login run in the system directory, so recordings are
+// saved in outputDirectory, which must be absolute.
+func daemonCommandLine(executable, outputDirectory string, options []string) string {
+	parts := []string{syscall.EscapeArg(executable), "daemon", "--background",
+		syscall.EscapeArg("--output=" + outputDirectory)}
+	for _, option := range options {
+		if option != "--background" && option != "--output" && !strings.HasPrefix(option, "--output=") {
+			parts = append(parts, syscall.EscapeArg(option))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// detachConsole lets go of the console the daemon was started with, so no
+// window stays open at login
+func detachConsole() {
+	procFreeConsole.Call()
+}
+
+// installDaemon has the daemon started at every login with options, saving
+// recordings in outputDirectory, and returns the command it will run
+func installDaemon(outputDirectory string, options []string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", NewWorkflowError(ErrorTypeSystem, "Cannot find the recorder executable", err)
+	}
+	directory, err := filepath.Abs(outputDirectory)
+	if err != nil {
+		return "", NewWorkflowError(ErrorTypeFileIO, "Invalid output directory", err)
+	}
+	command := daemonCommandLine(executable, directory, options)
+
+	key, err := openRunKey()
+	if err != nil {
+		return "", err
+	}
+	defer procRegCloseKey.Call(key)
+
+	name, _ := syscall.UTF16PtrFromString(daemonRunValue)
+	data, err := syscall.UTF16FromString(command)
+	if err != nil {
+		return "", NewWorkflowError(ErrorTypeConfiguration, "Invalid daemon command line", err)
+	}
+	if ret, _, _ := procRegSetValueEx.Call(key, uintptr(unsafe.Pointer(name)), 0, REG_SZ,
+		uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)*2)); ret != 0 {
+		return "", NewWorkflowError(ErrorTypeSystem, "Failed to add the daemon to the Run key", syscall.Errno(ret))
+	}
+	return command, nil
+}
+
+// uninstallDaemon stops the daemon being started at login. Returns false
+// when it was not installed.
+func uninstallDaemon() (bool, error) {
+	key, err := openRunKey()
+	if err != nil {
+		return false, err
+	}
+	defer procRegCloseKey.Call(key)
+
+	name, _ := syscall.UTF16PtrFromString(daemonRunValue)
+	ret, _, _ := procRegDeleteValue.Call(key, uintptr(unsafe.Pointer(name)))
+	switch ret {
+	case 0:
+		return true, nil
+	case ERROR_FILE_NOT_FOUND:
+		return false, nil
+	default:
+		return false, NewWorkflowError(ErrorTypeSystem, "Failed to remove the daemon from the Run key", syscall.Errno(ret))
+	}
+}
+
+// openRunKey opens the current user's Run key
+func openRunKey() (uintptr, error) {
+	path, _ := syscall.UTF16PtrFromString(daemonRunKey)
+	var key uintptr
+	ret, _, _ := procRegCreateKeyEx.Call(HKEY_CURRENT_USER, uintptr(unsafe.Pointer(path)), 0, 0, 0,
+		KEY_SET_VALUE, 0, uintptr(unsafe.Pointer(&key)), 0)
+	if ret != 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "Failed to open the Run key", syscall.Errno(ret))
+	}
+	return key, nil
+}
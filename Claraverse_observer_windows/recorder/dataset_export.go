@@ -0,0 +1,377 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Training data for computer-use models. `dataset <directory>` turns every
+// recording in a directory into (screenshot, action) samples: each user
+// action paired with the screenshot showing the screen as the user acted,
+// the point acted on and, when the element under it is known, its bounding
+// box, all in the screenshot's pixels. Samples reference images written
+// alongside the dataset file rather than embedding them.
+
+// DatasetFormat is the file layout of a dataset
+type DatasetFormat string
+
+const (
+	DatasetFormatJSONL DatasetFormat = "jsonl" // One sample per line
+	DatasetFormatJSON  DatasetFormat = "json"  // One array of samples
+)
+
+// DatasetBoxFormat is how points and bounding boxes are written
+type DatasetBoxFormat string
+
+const (
+	DatasetBoxXYWH       DatasetBoxFormat = "xywh"       // Pixels: left, top, width, height
+	DatasetBoxXYXY       DatasetBoxFormat = "xyxy"       // Pixels: left, top, right, bottom
+	DatasetBoxNormalized DatasetBoxFormat = "normalized" // left, top, right, bottom as fractions of the image size
+)
+
+const (
+	// datasetMaxScreenshotAgeMs is how long before an action a screenshot may
+	// be taken and still be taken to show what the user acted on
+	datasetMaxScreenshotAgeMs = 5000
+	datasetImageDirectory     = "images"
+)
+
+// segmentFilePattern matches the per-segment files written next to a
+// recording, which repeat its events
+var segmentFilePattern = regexp.MustCompile(`_segment_\d+\.json$`)
+
+// DatasetOptions configures a dataset export
+type DatasetOptions struct {
+	Format          DatasetFormat
+	BoxFormat       DatasetBoxFormat
+	ScreenshotStore string // Where to look for moved screenshot stores; "" for nowhere else
+}
+
+// DatasetSample is one (screenshot, action) pair
+type DatasetSample struct {
+	ID          string          `json:"id"`
+	Recording   string          `json:"recording"`
+	Image       string          `json:"image"` // Relative to the dataset file
+	ImageWidth  int             `json:"image_width"`
+	ImageHeight int             `json:"image_height"`
+	OffsetMs    uint64          `json:"t_ms"`
+	Application string          `json:"application,omitempty"`
+	Window      string          `json:"window,omitempty"`
+	Description string          `json:"description"`
+	Action      DatasetAction   `json:"action"`
+	Element     *DatasetElement `json:"element,omitempty"`
+}
+
+// DatasetAction is what the user did. Points are x, y in image pixels, or
+// fractions of the image size in the normalized box format.
+type DatasetAction struct {
+	Type     string    `json:"type"` // click, double_click, right_click, drag, type or hotkey
+	Point    []float64 `json:"point,omitempty"`
+	EndPoint []float64 `json:"end_point,omitempty"` // Where a drag ended; Point is where it started
+	Text     string    `json:"text,omitempty"`
+	Keys     string    `json:"keys,omitempty"`
+}
+
+// DatasetElement is the element acted on, with its bounding box in the
+// dataset's box format
+type DatasetElement struct {
+	Role string    `json:"role"`
+	Name string    `json:"name,omitempty"`
+	Box  []float64 `json:"bbox"`
+}
+
+// DatasetSummary counts what a dataset export wrote
+type DatasetSummary struct {
+	File       string
+	Recordings int
+	Samples    int
+	Images     int
+	Skipped    int // Actions without a recent screenshot that shows them
+}
+
+// datasetImage is a screenshot used by samples, with the file it is
+// written to and the screen area it covers
+type datasetImage struct {
+	Path   string // Relative to the dataset file
+	Data   []byte
+	Width  int
+	Height int
+	Area   [4]int32
+}
+
+// buildDatasetSamples pairs a recording's actions with their screenshots.
+// id prefixes sample IDs and image names. Returns the samples, the images
+// they use and how many actions had no screenshot to pair with.
+func buildDatasetSamples(recording *SavedRecording, id string, boxes DatasetBoxFormat) ([]DatasetSample, []*datasetImage, int) {
+	screenshots := recording.Screenshots()
+	images := make(map[int]*datasetImage)
+	var used []*datasetImage
+	var samples []DatasetSample
+	skipped := 0
+
+	for i, event := range recording.Events {
+		action, start, end, ok := datasetAction(event)
+		if !ok {
+			continue
+		}
+		offset := recording.offset(event.Metadata.Timestamp)
+
+		shot, found := datasetScreenshot(screenshots, i, offset, event)
+		if !found {
+			skipped++
+			continue
+		}
+		img, cached := images[shot.Index]
+		if !cached {
+			img = decodeDatasetImage(shot, id)
+			images[shot.Index] = img
+		}
+		if img == nil {
+			skipped++
+			continue
+		}
+
+		// Actions on a screen the screenshot does not show cannot be learned from
+		if start != nil {
+			if action.Point, ok = img.point(*start, boxes); !ok {
+				skipped++
+				continue
+			}
+		}
+		if end != nil {
+			action.EndPoint, _ = img.point(*end, boxes)
+		}
+
+		if !cached {
+			used = append(used, img)
+		}
+		sample := DatasetSample{
+			ID:          fmt.Sprintf("%s_%d", id, i),
+			Recording:   recording.Name,
+			Image:       img.Path,
+			ImageWidth:  img.Width,
+			ImageHeight: img.Height,
+			OffsetMs:    offset,
+			Action:      action,
+		}
+		_, sample.Description, _, _ = describeSavedEvent(event, func(text string) string { return fmt.Sprintf("%q", text) })
+		if element := event.Metadata.UIElement; element != nil {
+			sample.Application = element.ApplicationName
+			sample.Window = element.WindowTitle
+			// Window elements carry placeholder bounds around the pointer
+			if element.Role != "window" && element.Bounds[2] > 0 && element.Bounds[3] > 0 {
+				if box, ok := img.box(element.Bounds, boxes); ok {
+					sample.Element = &DatasetElement{Role: element.Role, Name: element.Name, Box: box}
+				}
+			}
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, used, skipped
+}
+
+// datasetAction describes a saved event as a training action with the
+// screen positions it acted on. Events that are not user actions, or repeat
+// one such as the button click reported with a mouse click, return false.
+func datasetAction(event savedEvent) (action DatasetAction, start, end *Position, ok bool) {
+	switch {
+	case event.TextValue != nil:
+		return DatasetAction{Type: "type", Text: *event.TextValue}, nil, nil, *event.TextValue != ""
+	case event.Combination != nil:
+		return DatasetAction{Type: "hotkey", Keys: *event.Combination}, nil, nil, true
+	case event.EventType != "" && event.Position != nil:
+		switch MouseEventType(event.EventType) {
+		case MouseClick:
+			return DatasetAction{Type: "click"}, event.Position, nil, true
+		case MouseDoubleClick:
+			return DatasetAction{Type: "double_click"}, event.Position, nil, true
+		case MouseRightClick:
+			return DatasetAction{Type: "right_click"}, event.Position, nil, true
+		case MouseDrag:
+			if event.DragStart != nil {
+				return DatasetAction{Type: "drag"}, event.DragStart, event.Position, true
+			}
+		}
+	}
+	return DatasetAction{}, nil, nil, false
+}
+
+// datasetScreenshot finds the screenshot showing the screen as the event at
+// index happened: the one the event itself triggered, else the last one
+// before it if it is recent enough
+func datasetScreenshot(screenshots []RecordingScreenshot, index int, offset uint64, event savedEvent) (RecordingScreenshot, bool) {
+	trigger := ScreenshotTriggerKeyboard
+	if event.EventType != "" {
+		trigger = ScreenshotTriggerMouseClick
+	}
+
+	var latest *RecordingScreenshot
+	for i := range screenshots {
+		if screenshots[i].Index == index+1 && screenshots[i].Trigger == string(trigger) {
+			return screenshots[i], true
+		}
+		if screenshots[i].Index < index {
+			latest = &screenshots[i]
+		}
+	}
+	if latest == nil || latest.OffsetMs+datasetMaxScreenshotAgeMs < offset {
+		return RecordingScreenshot{}, false
+	}
+	return *latest, true
+}
+
+// decodeDatasetImage reads a screenshot's size and names its image file, or
+// returns nil when it cannot be decoded
+func decodeDatasetImage(shot RecordingScreenshot, id string) *datasetImage {
+	data, err := base64.StdEncoding.DecodeString(shot.ImageBase64)
+	if err != nil {
+		return nil
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return nil
+	}
+
+	return &datasetImage{
+		Path:   fmt.Sprintf("%s/%s_%d.%s", datasetImageDirectory, id, shot.Index, format),
+		Data:   data,
+		Width:  config.Width,
+		Height: config.Height,
+		Area:   shot.area(config.Width, config.Height),
+	}
+}
+
+// point maps a screen position onto the image. Returns false when the
+// image does not show it.
+func (d *datasetImage) point(p Position, boxes DatasetBoxFormat) ([]float64, bool) {
+	x := float64(p.X-d.Area[0]) * float64(d.Width) / float64(d.Area[2])
+	y := float64(p.Y-d.Area[1]) * float64(d.Height) / float64(d.Area[3])
+	if x < 0 || y < 0 || x >= float64(d.Width) || y >= float64(d.Height) {
+		return nil, false
+	}
+
+	if boxes == DatasetBoxNormalized {
+		return []float64{roundFraction(x / float64(d.Width)), roundFraction(y / float64(d.Height))}, true
+	}
+	return []float64{math.Floor(x), math.Floor(y)}, true
+}
+
+// box maps screen bounds (x, y, width, height) onto the image, cut to its
+// edges. Returns false when the image does not show them.
+func (d *datasetImage) box(bounds [4]float64, boxes DatasetBoxFormat) ([]float64, bool) {
+	scaleX := float64(d.Width) / float64(d.Area[2])
+	scaleY := float64(d.Height) / float64(d.Area[3])
+	left := math.Max(0, (bounds[0]-float64(d.Area[0]))*scaleX)
+	top := math.Max(0, (bounds[1]-float64(d.Area[1]))*scaleY)
+	right := math.Min(float64(d.Width), (bounds[0]+bounds[2]-float64(d.Area[0]))*scaleX)
+	bottom := math.Min(float64(d.Height), (bounds[1]+bounds[3]-float64(d.Area[1]))*scaleY)
+	if right <= left || bottom <= top {
+		return nil, false
+	}
+
+	switch boxes {
+	case DatasetBoxNormalized:
+		return []float64{
+			roundFraction(left / float64(d.Width)), roundFraction(top / float64(d.Height)),
+			roundFraction(right / float64(d.Width)), roundFraction(bottom / float64(d.Height)),
+		}, true
+	case DatasetBoxXYXY:
+		return []float64{math.Round(left), math.Round(top), math.Round(right), math.Round(bottom)}, true
+	default:
+		return []float64{math.Round(left), math.Round(top), math.Round(right - left), math.Round(bottom - top)}, true
+	}
+}
+
+// roundFraction rounds a normalized coordinate to four places
+func roundFraction(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// exportDataset writes the samples of every recording in directory to
+// outputDirectory as dataset.jsonl or dataset.json, with the screenshots
+// they use under images/
+func exportDataset(directory, outputDirectory string, options DatasetOptions) (DatasetSummary, error) {
+	if options.Format != DatasetFormatJSONL && options.Format != DatasetFormatJSON {
+		return DatasetSummary{}, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Unknown dataset format %q (use jsonl or json)", options.Format), nil)
+	}
+	switch options.BoxFormat {
+	case DatasetBoxXYWH, DatasetBoxXYXY, DatasetBoxNormalized:
+	default:
+		return DatasetSummary{}, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Unknown bounding box format %q (use xywh, xyxy or normalized)", options.BoxFormat), nil)
+	}
+
+	files, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	if err != nil {
+		return DatasetSummary{}, NewWorkflowError(ErrorTypeFileIO, "Invalid recordings directory", err)
+	}
+	if err := EnsureDirectoryExists(filepath.Join(outputDirectory, datasetImageDirectory)); err != nil {
+		return DatasetSummary{}, NewWorkflowError(ErrorTypeFileIO, "Failed to create dataset directory", err)
+	}
+
+	summary := DatasetSummary{File: filepath.Join(outputDirectory, "dataset."+string(options.Format))}
+	samples := []DatasetSample{}
+	for _, file := range files {
+		if segmentFilePattern.MatchString(file) {
+			continue
+		}
+		recording, err := LoadSavedRecording(file, options.ScreenshotStore)
+		if err != nil {
+			logger("dataset").Warn("Skipping recording", "file", file, "error", err)
+			continue
+		}
+
+		id := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		recordingSamples, images, skipped := buildDatasetSamples(recording, id, options.BoxFormat)
+		summary.Skipped += skipped
+		if len(recordingSamples) == 0 {
+			continue
+		}
+		for _, img := range images {
+			if err := os.WriteFile(filepath.Join(outputDirectory, filepath.FromSlash(img.Path)), img.Data, 0644); err != nil {
+				return summary, NewWorkflowError(ErrorTypeFileIO, "Failed to write dataset image", err)
+			}
+		}
+		samples = append(samples, recordingSamples...)
+		summary.Recordings++
+		summary.Images += len(images)
+	}
+	summary.Samples = len(samples)
+
+	if options.Format == DatasetFormatJSON {
+		return summary, SaveJSONToFile(samples, summary.File)
+	}
+	return summary, writeDatasetLines(samples, summary.File)
+}
+
+// writeDatasetLines writes samples as JSON lines
+func writeDatasetLines(samples []DatasetSample, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to create dataset file", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, sample := range samples {
+		if err := encoder.Encode(sample); err != nil {
+			return NewWorkflowError(ErrorTypeSerialization, "Failed to encode dataset sample", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write dataset file", err)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Screen capture through the DXGI Desktop Duplication API. GDI's BitBlt
+// reads the desktop the window manager composes, which fullscreen-exclusive
+// applications bypass, so it returns black frames while a game owns the
+// display; desktop duplication reads the output the GPU scans out instead.
+// The duplicated frame is copied into a CPU-readable staging texture, which
+// also keeps the last frame for captures when the screen has not changed.
+// As the GPU composes the frame and only changed frames are copied, it costs
+// far less CPU than BitBlt at high capture rates, and with
+// ScreenshotCaptureMethod set to "desktop_duplication" it is the first
+// choice for every screenshot. Windows showing DRM-protected content are
+// blacked out of duplicated frames; screenshots with such a window are
+// marked protected_content.
+
+var (
+	d3d11                 = syscall.NewLazyDLL("d3d11.dll")
+	procD3D11CreateDevice = d3d11.NewProc("D3D11CreateDevice")
+)
+
+const (
+	D3D_DRIVER_TYPE_HARDWARE    = 1
+	D3D11_SDK_VERSION           = 7
+	D3D11_USAGE_STAGING         = 3
+	D3D11_CPU_ACCESS_READ       = 0x20000
+	D3D11_MAP_READ              = 1
+	DXGI_FORMAT_B8G8R8A8_UNORM  = 87
+	DXGI_ERROR_NOT_FOUND        = 0x887A0002
+	DXGI_ERROR_WAIT_TIMEOUT     = 0x887A0027
+	desktopDuplicationTimeoutMs = 100
+)
+
+var (
+	IID_IDXGIDevice     = GUID{0x54ec77fa, 0x1377, 0x44e6, [8]byte{0x8c, 0x32, 0x88, 0xfd, 0x5f, 0x44, 0xc8, 0x4c}}
+	IID_IDXGIOutput1    = GUID{0x00cddea8, 0x939b, 0x4b83, [8]byte{0xa3, 0x40, 0xa6, 0x85, 0x22, 0x66, 0x66, 0xcc}}
+	IID_ID3D11Texture2D = GUID{0x6f15aaf2, 0xd208, 0x4e89, [8]byte{0x9a, 0xb4, 0x48, 0x95, 0x35, 0xd3, 0x4f, 0x9c}}
+)
+
+// Vtable slots of the DXGI and Direct3D 11 interfaces used here
+const (
+	vtblQueryInterface = 0
+
+	vtblDXGIDeviceGetAdapter = 7
+
+	vtblAdapterEnumOutputs = 7
+
+	vtblOutputGetDesc          = 7
+	vtblOutput1DuplicateOutput = 22
+
+	vtblDuplicationAcquireNextFrame = 8
+	vtblDuplicationReleaseFrame     = 14
+
+	vtblTexture2DGetDesc = 10
+
+	vtblDeviceCreateTexture2D = 5
+
+	vtblContextMap          = 14
+	vtblContextUnmap        = 15
+	vtblContextCopyResource = 47
+)
+
+// DXGI_OUTPUT_DESC is the DXGI structure IDXGIOutput::GetDesc fills
+type DXGI_OUTPUT_DESC struct {
+	DeviceName         [32]uint16
+	DesktopCoordinates RECT
+	AttachedToDesktop  int32
+	Rotation           uint32
+	Monitor            uintptr
+}
+
+// DXGI_OUTDUPL_FRAME_INFO is the DXGI structure AcquireNextFrame fills
+type DXGI_OUTDUPL_FRAME_INFO struct {
+	LastPresentTime           int64
+	LastMouseUpdateTime       int64
+	AccumulatedFrames         uint32
+	RectsCoalesced            int32
+	ProtectedContentMaskedOut int32
+	PointerPositionX          int32
+	PointerPositionY          int32
+	PointerVisible            int32
+	TotalMetadataBufferSize   uint32
+	PointerShapeBufferSize    uint32
+}
+
+// D3D11_TEXTURE2D_DESC is the Direct3D 11 description of a 2D texture
+type D3D11_TEXTURE2D_DESC struct {
+	Width          uint32
+	Height         uint32
+	MipLevels      uint32
+	ArraySize      uint32
+	Format         uint32
+	SampleCount    uint32
+	SampleQuality  uint32
+	Usage          uint32
+	BindFlags      uint32
+	CPUAccessFlags uint32
+	MiscFlags      uint32
+}
+
+// D3D11_MAPPED_SUBRESOURCE is where ID3D11DeviceContext::Map puts a texture
+type D3D11_MAPPED_SUBRESOURCE struct {
+	Data       uintptr
+	RowPitch   uint32
+	DepthPitch uint32
+}
+
+// DesktopDuplicator captures a display through desktop duplication. It
+// keeps the device and duplication open between frames, and reopens them
+// when the display mode changes, as it does when a game goes fullscreen.
+type DesktopDuplicator struct {
+	device      comObject
+	context     comObject
+	duplication comObject
+	staging     comObject
+	output      image.Rectangle // Desktop coordinates of the duplicated output
+	hasFrame    bool            // staging holds a frame
+	protected   bool            // Protected content was masked out of the frame in staging
+	Mutex       sync.Mutex
+}
+
+// Capture copies the given desktop rectangle, which must lie on one
+// display, into a pooled RGBA buffer, and reports whether protected content
+// was masked out of it. Callers should hand the image back with
+// releaseFrameBuffer once encoded.
+func (dd *DesktopDuplicator) Capture(rect image.Rectangle) (*image.RGBA, bool, error) {
+	if rect.Empty() {
+		return nil, false, errors.New("capture rectangle is empty")
+	}
+
+	dd.Mutex.Lock()
+	defer dd.Mutex.Unlock()
+
+	if dd.duplication == 0 || !rect.In(dd.output) {
+		dd.release()
+		if err := dd.open(rect); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := dd.acquireFrame(); err != nil {
+		// The display mode changed; the next capture starts over
+		dd.release()
+		return nil, false, err
+	}
+
+	var mapped D3D11_MAPPED_SUBRESOURCE
+	if hr := dd.context.call(vtblContextMap, uintptr(dd.staging), 0, D3D11_MAP_READ, 0,
+		uintptr(unsafe.Pointer(&mapped))); failedHRESULT(hr) {
+		return nil, false, fmt.Errorf("mapping the desktop frame failed: 0x%08X", uint32(hr))
+	}
+	defer dd.context.call(vtblContextUnmap, uintptr(dd.staging), 0)
+
+	width, height := rect.Dx(), rect.Dy()
+	left, top := rect.Min.X-dd.output.Min.X, rect.Min.Y-dd.output.Min.Y
+	img := acquireFrameBuffer(width, height)
+	// The staging texture stays mapped, outside the Go heap, until the
+	// deferred Unmap, and rect lies within the output it was copied from
+	for y := 0; y < height; y++ {
+		row := unsafe.Slice((*byte)(unsafe.Pointer(mapped.Data+uintptr((top+y)*int(mapped.RowPitch)+left*4))), width*4)
+		dst := img.Pix[y*img.Stride : y*img.Stride+width*4]
+
+		// BGRA => RGBA, and set A to 255
+		for i := 0; i < len(row); i += 4 {
+			dst[i], dst[i+1], dst[i+2], dst[i+3] = row[i+2], row[i+1], row[i], 255
+		}
+	}
+
+	return img, dd.protected, nil
+}
+
+// acquireFrame copies the latest desktop frame into the staging texture.
+// When the screen has not changed since the last frame, the staging texture
+// still holds it, so only the first frame is waited for.
+func (dd *DesktopDuplicator) acquireFrame() error {
+	timeout := uintptr(desktopDuplicationTimeoutMs)
+	if dd.hasFrame {
+		timeout = 0
+	}
+
+	var info DXGI_OUTDUPL_FRAME_INFO
+	var resource comObject
+	hr := dd.duplication.call(vtblDuplicationAcquireNextFrame, timeout,
+		uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&resource)))
+	if uint32(hr) == DXGI_ERROR_WAIT_TIMEOUT && dd.hasFrame {
+		return nil
+	}
+	if failedHRESULT(hr) {
+		return fmt.Errorf("acquiring the desktop frame failed: 0x%08X", uint32(hr))
+	}
+	defer dd.duplication.call(vtblDuplicationReleaseFrame)
+	defer resource.Release()
+
+	var texture comObject
+	if hr := resource.call(vtblQueryInterface, uintptr(unsafe.Pointer(&IID_ID3D11Texture2D)),
+		uintptr(unsafe.Pointer(&texture))); failedHRESULT(hr) {
+		return fmt.Errorf("the desktop frame is not a texture: 0x%08X", uint32(hr))
+	}
+	defer texture.Release()
+
+	if dd.staging == 0 {
+		var desc D3D11_TEXTURE2D_DESC
+		texture.call(vtblTexture2DGetDesc, uintptr(unsafe.Pointer(&desc)))
+		if desc.Format != DXGI_FORMAT_B8G8R8A8_UNORM {
+			// HDR displays duplicate in floating point
+			return fmt.Errorf("desktop frames in format %d are not supported", desc.Format)
+		}
+		desc.MipLevels, desc.ArraySize, desc.SampleCount, desc.SampleQuality = 1, 1, 1, 0
+		desc.Usage, desc.BindFlags, desc.CPUAccessFlags, desc.MiscFlags = D3D11_USAGE_STAGING, 0, D3D11_CPU_ACCESS_READ, 0
+		if hr := dd.device.call(vtblDeviceCreateTexture2D, uintptr(unsafe.Pointer(&desc)), 0,
+			uintptr(unsafe.Pointer(&dd.staging))); failedHRESULT(hr) {
+			return fmt.Errorf("creating the staging texture failed: 0x%08X", uint32(hr))
+		}
+	}
+
+	dd.context.call(vtblContextCopyResource, uintptr(dd.staging), uintptr(texture))
+	dd.hasFrame = true
+	dd.protected = info.ProtectedContentMaskedOut != 0
+	return nil
+}
+
+// open creates a device and duplicates the output rect lies on
+func (dd *DesktopDuplicator) open(rect image.Rectangle) error {
+	if err := procD3D11CreateDevice.Find(); err != nil {
+		return err
+	}
+	if hr, _, _ := procD3D11CreateDevice.Call(0, D3D_DRIVER_TYPE_HARDWARE, 0, 0, 0, 0, D3D11_SDK_VERSION,
+		uintptr(unsafe.Pointer(&dd.device)), 0, uintptr(unsafe.Pointer(&dd.context))); failedHRESULT(hr) {
+		return fmt.Errorf("creating a Direct3D device failed: 0x%08X", uint32(hr))
+	}
+
+	var dxgiDevice, adapter comObject
+	if hr := dd.device.call(vtblQueryInterface, uintptr(unsafe.Pointer(&IID_IDXGIDevice)),
+		uintptr(unsafe.Pointer(&dxgiDevice))); failedHRESULT(hr) {
+		return fmt.Errorf("the Direct3D device has no DXGI device: 0x%08X", uint32(hr))
+	}
+	defer dxgiDevice.Release()
+	if hr := dxgiDevice.call(vtblDXGIDeviceGetAdapter, uintptr(unsafe.Pointer(&adapter))); failedHRESULT(hr) {
+		return fmt.Errorf("finding the display adapter failed: 0x%08X", uint32(hr))
+	}
+	defer adapter.Release()
+
+	for index := uintptr(0); ; index++ {
+		var output comObject
+		hr := adapter.call(vtblAdapterEnumOutputs, index, uintptr(unsafe.Pointer(&output)))
+		if uint32(hr) == DXGI_ERROR_NOT_FOUND {
+			return fmt.Errorf("no display of the adapter shows %v", rect)
+		}
+		if failedHRESULT(hr) {
+			return fmt.Errorf("listing displays failed: 0x%08X", uint32(hr))
+		}
+
+		var desc DXGI_OUTPUT_DESC
+		output.call(vtblOutputGetDesc, uintptr(unsafe.Pointer(&desc)))
+		coordinates := desc.DesktopCoordinates
+		bounds := image.Rect(int(coordinates.Left), int(coordinates.Top), int(coordinates.Right), int(coordinates.Bottom))
+		if !rect.In(bounds) {
+			output.Release()
+			continue
+		}
+
+		var output1 comObject
+		hr = output.call(vtblQueryInterface, uintptr(unsafe.Pointer(&IID_IDXGIOutput1)), uintptr(unsafe.Pointer(&output1)))
+		output.Release()
+		if failedHRESULT(hr) {
+			return fmt.Errorf("desktop duplication needs Windows 8 or later: 0x%08X", uint32(hr))
+		}
+		hr = output1.call(vtblOutput1DuplicateOutput, uintptr(dd.device), uintptr(unsafe.Pointer(&dd.duplication)))
+		output1.Release()
+		if failedHRESULT(hr) {
+			return fmt.Errorf("duplicating the display failed: 0x%08X", uint32(hr))
+		}
+		dd.output = bounds
+		return nil
+	}
+}
+
+// release frees the duplication and device. Called with the lock held.
+func (dd *DesktopDuplicator) release() {
+	for _, obj := range []*comObject{&dd.staging, &dd.duplication, &dd.context, &dd.device} {
+		obj.Release()
+		*obj = 0
+	}
+	dd.output = image.Rectangle{}
+	dd.hasFrame, dd.protected = false, false
+}
+
+// Close frees the duplication held between frames
+func (dd *DesktopDuplicator) Close() {
+	dd.Mutex.Lock()
+	defer dd.Mutex.Unlock()
+
+	dd.release()
+}
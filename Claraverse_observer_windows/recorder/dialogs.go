@@ -0,0 +1,466 @@
+package recorder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Dialogs. With RecordDialogs set, a WinEvent hook on a thread of its own
+// sees the standard dialogs of every application open and close: message
+// boxes, file pickers and the other dialogs Windows' dialog manager runs. A
+// DialogEvent is recorded when one opens, with its title, its kind, the
+// message of a message box and the push buttons it offers, and another when
+// it closes, with the button that dismissed it, so a recording shows the
+// decision made as well as the click. The button is the one under the
+// pointer as the dialog closed, the default button on Enter or Cancel on
+// Escape; a dialog closed from its title bar or by the application itself
+// has none. A file dialog's chosen files are recorded as well, see
+// file_dialogs.go. Dialogs drawn by other UI frameworks, such as WinForms and WPF
+// windows, are not standard dialogs and are not seen.
+
+var (
+	procEnumChildWindows = user32.NewProc("EnumChildWindows")
+	procGetDlgCtrlID     = user32.NewProc("GetDlgCtrlID")
+	procGetWindowLong    = user32.NewProc("GetWindowLongW")
+	dialogCallback       uintptr
+	dialogChildCallback  uintptr
+	dialogCallbacks      sync.Once
+	activeDialogs        *DialogWatcher // Receives the hook's events
+	dialogChildren       *[]dialogChild // Collects EnumChildWindows' windows on the hook's thread
+)
+
+const (
+	EVENT_SYSTEM_DIALOGSTART = 0x0010
+	EVENT_SYSTEM_DIALOGEND   = 0x0011
+	GWL_STYLE                = -16
+	BS_TYPEMASK              = 0x000F
+	BS_PUSHBUTTON            = 0x0000
+	BS_DEFPUSHBUTTON         = 0x0001
+	IDCANCEL                 = 2
+	messageBoxTextID         = 0xFFFF // Control ID of a message box's text
+)
+
+// Dialog changes
+const (
+	DialogOpened = "opened"
+	DialogClosed = "closed"
+)
+
+// Kinds of dialog
+const (
+	DialogMessageBox = "message_box"
+	DialogFile       = "file"
+	DialogOther      = "dialog"
+)
+
+// DialogEvent records a dialog opening or closing
+type DialogEvent struct {
+	Dialog      string        `json:"dialog"`      // opened or closed
+	DialogKind  string        `json:"dialog_kind"` // message_box, file or dialog
+	DialogTitle string        `json:"dialog_title"`
+	Message     string        `json:"message,omitempty"` // The text of a message box
+	Buttons     []string      `json:"buttons,omitempty"`
+	DismissedBy string        `json:"dismissed_by,omitempty"` // On closing, the button that dismissed it, when known
+	DismissKey  string        `json:"dismiss_key,omitempty"`  // Enter or Escape, when a key dismissed it
+	OpenMs      uint64        `json:"open_ms,omitempty"`      // On closing, how long it was open
+	Application string        `json:"application"`
+	Metadata    EventMetadata `json:"metadata"`
+}
+
+// dialogChild is a control of a dialog
+type dialogChild struct {
+	Class string
+	Text  string
+	ID    int32
+	Style uint32
+	Rect  [4]int32 // x, y, width and height on screen
+}
+
+// dialogButton is a push button of a dialog
+type dialogButton struct {
+	Label   string
+	ID      int32
+	Default bool
+	Rect    [4]int32
+}
+
+// dialogInfo is what a dialog shows
+type dialogInfo struct {
+	Kind        string
+	Title       string
+	Message     string
+	Buttons     []dialogButton
+	Application string
+	File        fileDialogFields // What a file dialog's fields show
+}
+
+// dialogInput is the state of the keys and pointer as a dialog closed
+type dialogInput struct {
+	Escape  bool
+	Enter   bool
+	Pointer Position
+	Buttons []dialogButton // Its buttons then, if it could still be read; focus moves the default
+}
+
+// openDialog is a dialog open since a time
+type openDialog struct {
+	dialogInfo
+	Since time.Time
+}
+
+// DialogWatcher follows the dialogs open and records them opening and
+// closing
+type DialogWatcher struct {
+	Open      map[uintptr]openDialog
+	Config    WorkflowRecorderConfig // The recording's, whose ignore lists apply
+	Events    []WorkflowEvent
+	fileHooks map[uintptr]uintptr // Hooks following open file dialogs' fields, by dialog; on the hook's thread only
+	hook      winEventHook
+	Mutex     sync.Mutex
+}
+
+// NewDialogWatcher creates a watcher and starts its hook, or returns nil
+// when RecordDialogs is off or the hook cannot be set
+func NewDialogWatcher(config WorkflowRecorderConfig) *DialogWatcher {
+	if !config.RecordDialogs {
+		return nil
+	}
+	watcher := newDialogWatcher()
+	watcher.Config = config
+	if err := watcher.start(); err != nil {
+		printConsoleWarning(Msg(MsgDialogsUnavailable, err))
+		return nil
+	}
+	return watcher
+}
+
+// newDialogWatcher creates a watcher that knows of no open dialogs
+func newDialogWatcher() *DialogWatcher {
+	return &DialogWatcher{Open: make(map[uintptr]openDialog), fileHooks: make(map[uintptr]uintptr)}
+}
+
+// Opened records a dialog opening
+func (w *DialogWatcher) Opened(hwnd uintptr, info dialogInfo, now time.Time) {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	if _, open := w.Open[hwnd]; open {
+		return
+	}
+	w.Open[hwnd] = openDialog{dialogInfo: info, Since: now}
+	event := info.event(DialogOpened, now)
+	event.Message = info.Message
+	for _, button := range info.Buttons {
+		event.Buttons = append(event.Buttons, button.Label)
+	}
+	w.Events = append(w.Events, event)
+}
+
+// Closed records a dialog closing, with the button input dismissed it
+// with, and the files chosen if a file dialog closed on them
+func (w *DialogWatcher) Closed(hwnd uintptr, input dialogInput, now time.Time) {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	dialog, open := w.Open[hwnd]
+	if !open {
+		return
+	}
+	delete(w.Open, hwnd)
+	event := dialog.event(DialogClosed, now)
+	buttons := dialog.Buttons
+	if len(input.Buttons) > 0 {
+		buttons = input.Buttons
+	}
+	button, key := dismissingButton(buttons, input)
+	event.DismissedBy, event.DismissKey = button.Label, key
+	if now.After(dialog.Since) {
+		event.OpenMs = uint64(now.Sub(dialog.Since).Milliseconds())
+	}
+	w.Events = append(w.Events, event)
+
+	if dialog.Kind != DialogFile || !fileChosen(dialog.File, button, key, input.Pointer) {
+		return
+	}
+	if paths := dialog.File.Paths(); len(paths) > 0 {
+		w.Events = append(w.Events, FileDialogEvent{
+			FileDialog:  dialog.Title,
+			Paths:       paths,
+			Filter:      dialog.File.Filter,
+			Folder:      dialog.File.Folder,
+			Application: dialog.Application,
+			Metadata:    event.Metadata,
+		})
+	}
+}
+
+// UpdateFile takes the fields read from an open file dialog
+func (w *DialogWatcher) UpdateFile(hwnd uintptr, fields fileDialogFields) {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	dialog, open := w.Open[hwnd]
+	if !open || dialog.Kind != DialogFile {
+		return
+	}
+	dialog.File.update(fields)
+	w.Open[hwnd] = dialog
+}
+
+// event is the dialog's event of change at now
+func (info dialogInfo) event(change string, now time.Time) DialogEvent {
+	return DialogEvent{
+		Dialog:      change,
+		DialogKind:  info.Kind,
+		DialogTitle: info.Title,
+		Application: info.Application,
+		Metadata:    EventMetadata{Timestamp: uint64(now.UnixMilli())},
+	}
+}
+
+// Drain returns the events recorded since the last call
+func (w *DialogWatcher) Drain() []WorkflowEvent {
+	if w == nil {
+		return nil
+	}
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	events := w.Events
+	w.Events = nil
+	return events
+}
+
+// dismissingButton returns the button that dismissed a dialog, and the key
+// that did, if any: Cancel on Escape, the default button on Enter,
+// otherwise the button under the pointer
+func dismissingButton(buttons []dialogButton, input dialogInput) (dialogButton, string) {
+	for _, button := range buttons {
+		switch {
+		case input.Escape:
+			if button.ID == IDCANCEL {
+				return button, "Escape"
+			}
+		case input.Enter:
+			if button.Default {
+				return button, "Enter"
+			}
+		default:
+			r := button.Rect
+			if input.Pointer.X >= r[0] && input.Pointer.X < r[0]+r[2] && input.Pointer.Y >= r[1] && input.Pointer.Y < r[1]+r[3] {
+				return button, ""
+			}
+		}
+	}
+	switch {
+	case input.Escape:
+		return dialogButton{}, "Escape"
+	case input.Enter:
+		return dialogButton{}, "Enter"
+	}
+	return dialogButton{}, ""
+}
+
+// classifyDialog works out what a dialog shows from its controls: a message
+// box has its text in a static control of ID 0xFFFF, a file dialog a shell
+// folder view, whose fields are read too
+func classifyDialog(title, application string, children []dialogChild) dialogInfo {
+	info := dialogInfo{Kind: DialogOther, Title: title, Application: application}
+	// A button's access key is the letter after &, and && an ampersand
+	accelerators := strings.NewReplacer("&&", "&", "&", "")
+	for _, child := range children {
+		switch {
+		case child.Class == "DUIViewWndClassName" || child.Class == "SHELLDLL_DefView":
+			info.Kind = DialogFile
+		case strings.EqualFold(child.Class, "Static") && child.ID == messageBoxTextID && child.Text != "":
+			if info.Kind == DialogOther {
+				info.Kind = DialogMessageBox
+			}
+			info.Message = child.Text
+		case strings.EqualFold(child.Class, "Button") && child.Text != "":
+			kind := child.Style & BS_TYPEMASK
+			if kind != BS_PUSHBUTTON && kind != BS_DEFPUSHBUTTON {
+				continue
+			}
+			info.Buttons = append(info.Buttons, dialogButton{
+				Label:   accelerators.Replace(child.Text),
+				ID:      child.ID,
+				Default: kind == BS_DEFPUSHBUTTON,
+				Rect:    child.Rect,
+			})
+		}
+	}
+	if info.Kind == DialogFile {
+		info.Message = ""
+		info.File = readFileDialogFields(children)
+	}
+	// Buttons in the order they are laid out, left to right
+	sort.SliceStable(info.Buttons, func(i, j int) bool {
+		a, b := info.Buttons[i].Rect, info.Buttons[j].Rect
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[0] < b[0]
+	})
+	return info
+}
+
+// describeDialog describes a dialog opening or closing in a recording's
+// steps
+func describeDialog(change, kind, title, message, dismissedBy, key, application string, quote func(string) string) string {
+	name := "dialog"
+	switch kind {
+	case DialogMessageBox:
+		name = "message"
+	case DialogFile:
+		name = "file dialog"
+	}
+	if change == DialogOpened {
+		description := fmt.Sprintf("Got %s %s", name, quote(title))
+		if message != "" {
+			description += ": " + quote(message)
+		}
+		if application != "" {
+			description += " in " + application
+		}
+		return description
+	}
+	switch {
+	case dismissedBy != "" && key != "":
+		return fmt.Sprintf("Answered %s with %s (%s)", quote(title), quote(dismissedBy), key)
+	case dismissedBy != "":
+		return fmt.Sprintf("Answered %s with %s", quote(title), quote(dismissedBy))
+	case key != "":
+		return fmt.Sprintf("Dismissed %s %s with %s", name, quote(title), key)
+	}
+	return fmt.Sprintf("Closed %s %s", name, quote(title))
+}
+
+// readDialog reads a dialog's title, application and controls; on the
+// hook's thread only, as it collects into dialogChildren
+func readDialog(hwnd uintptr) dialogInfo {
+	title, application := describeWindow(hwnd)
+	return classifyDialog(title, application, readDialogChildren(hwnd))
+}
+
+// readDialogChildren reads a dialog's visible controls; on the hook's
+// thread only
+func readDialogChildren(hwnd uintptr) []dialogChild {
+	var children []dialogChild
+	dialogChildren = &children
+	procEnumChildWindows.Call(hwnd, dialogChildCallback, 0)
+	dialogChildren = nil
+	return children
+}
+
+// dialogChildProc adds a visible child window to dialogChildren
+func dialogChildProc(hwnd, _ uintptr) uintptr {
+	if dialogChildren == nil {
+		return 0
+	}
+	if visible, _, _ := procIsWindowVisible.Call(hwnd); visible == 0 {
+		return 1
+	}
+	id, _, _ := procGetDlgCtrlID.Call(hwnd)
+	styleIndex := int32(GWL_STYLE)
+	style, _, _ := procGetWindowLong.Call(hwnd, uintptr(styleIndex))
+	child := dialogChild{
+		Class: getWindowClassName(hwnd),
+		Text:  strings.TrimSpace(controlText(hwnd)),
+		ID:    int32(id),
+		Style: uint32(style),
+	}
+	var rect RECT
+	if ret, _, _ := procGetWindowRect.Call(hwnd, uintptr(unsafe.Pointer(&rect))); ret != 0 {
+		child.Rect = [4]int32{rect.Left, rect.Top, rect.Right - rect.Left, rect.Bottom - rect.Top}
+	}
+	*dialogChildren = append(*dialogChildren, child)
+	return 1
+}
+
+// start runs the hook on a thread of its own, whose message loop delivers
+// its events, and returns once it is set. The hooks following file dialogs
+// are removed as the thread ends.
+func (w *DialogWatcher) start() error {
+	dialogCallbacks.Do(func() {
+		dialogCallback = syscall.NewCallback(dialogEventProc)
+		dialogChildCallback = syscall.NewCallback(dialogChildProc)
+	})
+	ranges := []winEventRange{{EVENT_SYSTEM_DIALOGSTART, EVENT_SYSTEM_DIALOGEND}}
+	return w.hook.start(dialogCallback, ranges, func() { activeDialogs = w }, func() {
+		for dialog := range w.fileHooks {
+			w.unfollowFileDialog(dialog)
+		}
+	})
+}
+
+// Close removes the hook and ends its thread
+func (w *DialogWatcher) Close() {
+	if w == nil {
+		return
+	}
+	w.hook.Close()
+}
+
+// followFileDialog sets a hook on a file dialog's process that follows its
+// fields changing; on the hook's thread only
+func (w *DialogWatcher) followFileDialog(hwnd uintptr) {
+	var processID uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&processID)))
+	if processID == 0 {
+		return
+	}
+	hook, _, _ := procSetWinEventHook.Call(EVENT_OBJECT_NAMECHANGE, EVENT_OBJECT_VALUECHANGE, 0, dialogCallback,
+		uintptr(processID), 0, WINEVENT_OUTOFCONTEXT)
+	if hook != 0 {
+		w.fileHooks[hwnd] = hook
+	}
+}
+
+// unfollowFileDialog removes a file dialog's hook, if it has one; on the
+// hook's thread only
+func (w *DialogWatcher) unfollowFileDialog(hwnd uintptr) {
+	if hook, ok := w.fileHooks[hwnd]; ok {
+		procUnhookWinEvent.Call(hook)
+		delete(w.fileHooks, hwnd)
+	}
+}
+
+// dialogEventProc receives the hook's events on its thread
+func dialogEventProc(hook, event, hwnd, idObject, idChild, thread, eventTime uintptr) uintptr {
+	w := activeDialogs
+	if w == nil || hwnd == 0 {
+		return 0
+	}
+	switch event {
+	case EVENT_SYSTEM_DIALOGSTART:
+		info := readDialog(hwnd)
+		if !shouldIgnoreApplication(w.Config, info.Application, info.Title) {
+			w.Opened(hwnd, info, time.Now())
+			if info.Kind == DialogFile {
+				w.followFileDialog(hwnd)
+			}
+		}
+	case EVENT_SYSTEM_DIALOGEND:
+		w.unfollowFileDialog(hwnd)
+		w.Closed(hwnd, dialogInput{
+			Escape:  isKeyPressed(VK_ESCAPE),
+			Enter:   isKeyPressed(VK_RETURN),
+			Pointer: getMousePosition(),
+			Buttons: readDialog(hwnd).Buttons,
+		}, time.Now())
+	case EVENT_OBJECT_NAMECHANGE, EVENT_OBJECT_VALUECHANGE:
+		if !fileDialogControl(hwnd) {
+			return 0
+		}
+		if root, _, _ := procGetAncestor.Call(hwnd, GA_ROOT); w.fileHooks[root] != 0 {
+			w.UpdateFile(root, readFileDialogFields(readDialogChildren(root)))
+		}
+	}
+	return 0
+}
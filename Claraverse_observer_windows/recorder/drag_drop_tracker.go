@@ -1,7 +1,6 @@
-package main
+package recorder
 
 import (
-	"log"
 	"math"
 	"strings"
 	"sync"
@@ -73,7 +72,7 @@ func (ddt *DragDropTracker) HandleMouseMove(position Position) {
 	distance := ddt.calculateDistance(ddt.DragStartPos, position)
 	if !ddt.IsDragging && distance >= ddt.MinDragDistance {
 		ddt.IsDragging = true
-		log.Printf("Drag operation started at (%d, %d)", ddt.DragStartPos.X, ddt.DragStartPos.Y)
+		logger("trackers").Debug("Drag operation started", "x", ddt.DragStartPos.X, "y", ddt.DragStartPos.Y)
 	}
 }
 
@@ -127,10 +126,10 @@ func (ddt *DragDropTracker) HandleMouseUp(position Position, button MouseButton,
 	}
 
 	duration := time.Since(ddt.DragStartTime)
-	log.Printf("Drag and drop completed: (%d,%d) -> (%d,%d) in %v (success: %t)",
-		ddt.DragStartPos.X, ddt.DragStartPos.Y,
-		position.X, position.Y,
-		duration, dropSuccess)
+	logger("trackers").Debug("Drag and drop completed",
+		"from_x", ddt.DragStartPos.X, "from_y", ddt.DragStartPos.Y,
+		"to_x", position.X, "to_y", position.Y,
+		"duration", duration, "success", dropSuccess)
 
 	ddt.clearDragState()
 }
@@ -143,7 +142,7 @@ func (ddt *DragDropTracker) HandleKeyPress(keyCode uint32, isKeyDown bool) {
 		defer ddt.Mutex.Unlock()
 
 		if ddt.IsDragging {
-			log.Println("Drag operation cancelled by ESC key")
+			logger("trackers").Debug("Drag operation cancelled by ESC key")
 			ddt.clearDragState()
 		}
 	}
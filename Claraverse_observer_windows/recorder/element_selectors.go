@@ -0,0 +1,390 @@
+package recorder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Element selectors. When a click is pressed, the recorder asks UI
+// Automation which element is under the pointer and keeps what identifies it
+// independent of where it is on screen: its automation ID, name, control type
+// and class, and its path of control types below the top-level window. Replay
+// looks the element up again in the recorded application's window, by
+// automation ID, then name and control type, then path, and clicks its
+// centre, so a moved window or a new screen resolution does not send the
+// click astray. Only when none of them find it does replay use the recorded
+// coordinates. The same hit-test gives the click's ButtonClickEvent the
+// control's role, name and enabled state, rather than its window's.
+
+const (
+	maxSelectorDepth    = 32  // Deepest element path kept
+	maxSelectorSiblings = 500 // Most siblings counted for a path index
+)
+
+// Ways replay located a click's target
+const (
+	LocatedByAutomationID = "automation_id"
+	LocatedByName         = "name"
+	LocatedByPath         = "path"
+	LocatedByCoordinates  = "coordinates"
+)
+
+// uiaControlTypes names the UI Automation control type IDs
+var uiaControlTypes = map[int32]string{
+	50000: "Button", 50001: "Calendar", 50002: "CheckBox", 50003: "ComboBox",
+	50004: "Edit", 50005: "Hyperlink", 50006: "Image", 50007: "ListItem",
+	50008: "List", 50009: "Menu", 50010: "MenuBar", 50011: "MenuItem",
+	50012: "ProgressBar", 50013: "RadioButton", 50014: "ScrollBar", 50015: "Slider",
+	50016: "Spinner", 50017: "StatusBar", 50018: "Tab", 50019: "TabItem",
+	50020: "Text", 50021: "ToolBar", 50022: "ToolTip", 50023: "Tree",
+	50024: "TreeItem", 50025: "Custom", 50026: "Group", 50027: "Thumb",
+	50028: "DataGrid", 50029: "DataItem", 50030: "Document", 50031: "SplitButton",
+	50032: "Window", 50033: "Pane", 50034: "Header", 50035: "HeaderItem",
+	50036: "Table", 50037: "TitleBar", 50038: "Separator", 50039: "SemanticZoom",
+	50040: "AppBar",
+}
+
+// controlTypeName names a control type ID, or gives the number when it has
+// no name
+func controlTypeName(id int32) string {
+	if name, ok := uiaControlTypes[id]; ok {
+		return name
+	}
+	return strconv.Itoa(int(id))
+}
+
+// controlTypeID returns the ID of a control type named by controlTypeName,
+// or 0
+func controlTypeID(name string) int32 {
+	for id, candidate := range uiaControlTypes {
+		if candidate == name {
+			return id
+		}
+	}
+	if id, err := strconv.Atoi(name); err == nil {
+		return int32(id)
+	}
+	return 0
+}
+
+// selectorPathStep is one level of an element path: the nth child, from
+// 1, of its control type
+type selectorPathStep struct {
+	ControlType string
+	Index       int
+}
+
+// formatSelectorPath writes a path as "Pane/Group[2]/Button", leaving out
+// the index of a first child
+func formatSelectorPath(steps []selectorPathStep) string {
+	parts := make([]string, len(steps))
+	for i, step := range steps {
+		parts[i] = step.ControlType
+		if step.Index > 1 {
+			parts[i] += fmt.Sprintf("[%d]", step.Index)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// parseSelectorPath reads a path written by formatSelectorPath
+func parseSelectorPath(path string) ([]selectorPathStep, error) {
+	if path == "" {
+		return nil, nil
+	}
+	var steps []selectorPathStep
+	for _, part := range strings.Split(path, "/") {
+		step := selectorPathStep{ControlType: part, Index: 1}
+		if open := strings.IndexByte(part, '['); open >= 0 {
+			index, err := strconv.Atoi(strings.TrimSuffix(part[open+1:], "]"))
+			if err != nil || !strings.HasSuffix(part, "]") || index < 1 {
+				return nil, fmt.Errorf("invalid element path step %q", part)
+			}
+			step.ControlType, step.Index = part[:open], index
+		}
+		if step.ControlType == "" {
+			return nil, fmt.Errorf("invalid element path step %q", part)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// ClickedElement is the control under a press: the UI element it is,
+// whether it was enabled and its selector
+type ClickedElement struct {
+	Element  UIElement
+	Enabled  bool
+	Selector *ElementSelector
+}
+
+// captureClickedElement hit-tests the control at position, in window, the
+// window-level element of the application in front, or returns nil when UI
+// Automation cannot tell
+func captureClickedElement(position Position, window UIElement) *ClickedElement {
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return nil
+	}
+	defer client.Close()
+
+	element, err := client.ElementFromPoint(position)
+	if err != nil {
+		return nil
+	}
+	defer element.Release()
+
+	controlType := controlTypeName(elementControlType(element))
+	clicked := &ClickedElement{
+		Element: window,
+		Enabled: elementEnabled(element),
+		Selector: &ElementSelector{
+			AutomationID: elementString(element, vtblElementGetCurrentAutomationId),
+			Name:         elementString(element, vtblElementGetCurrentName),
+			ControlType:  controlType,
+			ClassName:    elementString(element, vtblElementGetCurrentClassName),
+			Application:  window.ApplicationName,
+			WindowTitle:  window.WindowTitle,
+		},
+	}
+	clicked.Element.Role = strings.ToLower(controlType)
+	clicked.Element.Name = clicked.Selector.Name
+	if bounds, ok := elementBounds(element); ok {
+		clicked.Element.Bounds = [4]float64{float64(bounds.Left), float64(bounds.Top),
+			float64(bounds.Right - bounds.Left), float64(bounds.Bottom - bounds.Top)}
+	}
+	if walker, err := client.ControlViewWalker(); err == nil {
+		clicked.Selector.Path = formatSelectorPath(client.elementPath(walker, element))
+		walker.Release()
+	}
+	return clicked
+}
+
+// clickTarget returns the element a click released at window's pointer
+// position acted on and whether it was enabled: the control hit-tested
+// under the press, or the window when there is none or the press was
+// dragged
+func clickTarget(press *ButtonPress, window UIElement, click bool) (UIElement, bool) {
+	if !click || press == nil || press.Element == nil {
+		return window, true
+	}
+	return press.Element.Element, press.Element.Enabled
+}
+
+// elementPath returns the path of element below its top-level window
+func (c *UIAutomationClient) elementPath(walker, element comObject) []selectorPathStep {
+	// Ancestors from the element up to the desktop, which has no parent
+	chain := []comObject{element}
+	defer func() {
+		for _, ancestor := range chain[1:] {
+			ancestor.Release()
+		}
+	}()
+	for len(chain) <= maxSelectorDepth+2 {
+		parent := walkerStep(walker, vtblTreeWalkerGetParentElement, chain[len(chain)-1])
+		if parent == 0 {
+			break
+		}
+		chain = append(chain, parent)
+	}
+	if len(chain) < 3 {
+		// The element is the desktop or a top-level window itself
+		return nil
+	}
+
+	var steps []selectorPathStep
+	for i := len(chain) - 3; i >= 0; i-- {
+		controlType := elementControlType(chain[i])
+		steps = append(steps, selectorPathStep{
+			ControlType: controlTypeName(controlType),
+			Index:       c.siblingIndex(walker, chain[i+1], chain[i], controlType),
+		})
+	}
+	return steps
+}
+
+// siblingIndex returns which child of parent, from 1, element is among
+// those of its control type
+func (c *UIAutomationClient) siblingIndex(walker, parent, element comObject, controlType int32) int {
+	index := 0
+	child := walkerStep(walker, vtblTreeWalkerGetFirstChildElement, parent)
+	for seen := 0; child != 0 && seen < maxSelectorSiblings; seen++ {
+		if elementControlType(child) == controlType {
+			index++
+			if c.SameElement(child, element) {
+				child.Release()
+				return index
+			}
+		}
+		next := walkerStep(walker, vtblTreeWalkerGetNextSiblingElement, child)
+		child.Release()
+		child = next
+	}
+	child.Release()
+	return 1
+}
+
+// locateElement finds a selector's element in its application's window,
+// preferring the window with the recorded title, and returns the centre of
+// the element and how it was found
+func locateElement(selector *ElementSelector) (Position, string, error) {
+	windows := (&desktopSelectorResolver{}).applicationWindows(selector.Application)
+	if len(windows) == 0 {
+		return Position{}, "", fmt.Errorf("%s has no window open", selector.Application)
+	}
+	window := windows[0]
+	for _, candidate := range windows {
+		if candidate.Title == selector.WindowTitle {
+			window = candidate
+			break
+		}
+	}
+
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return Position{}, "", err
+	}
+	defer client.Close()
+
+	root, err := client.ElementFromHandle(window.Handle)
+	if err != nil {
+		return Position{}, "", err
+	}
+	defer root.Release()
+
+	controlType := controlTypeID(selector.ControlType)
+	if selector.AutomationID != "" {
+		if position, ok := client.findCentre(root, controlType, UIA_AutomationIdPropertyId, selector.AutomationID); ok {
+			return position, LocatedByAutomationID, nil
+		}
+	}
+	if selector.Name != "" && controlType != 0 {
+		if position, ok := client.findCentre(root, controlType, UIA_NamePropertyId, selector.Name); ok {
+			return position, LocatedByName, nil
+		}
+	}
+	if steps, err := parseSelectorPath(selector.Path); err == nil && len(steps) > 0 {
+		if position, ok := client.followPath(root, steps); ok {
+			return position, LocatedByPath, nil
+		}
+	}
+	return Position{}, "", fmt.Errorf("no element matches %s", describeSelector(selector))
+}
+
+// findCentre finds the first element below root whose string property
+// equals value and, when controlType is set, of that control type, and
+// returns its centre
+func (c *UIAutomationClient) findCentre(root comObject, controlType int32, propertyID uintptr, value string) (Position, bool) {
+	conditions := make([]comObject, 0, 2)
+	defer func() {
+		for _, condition := range conditions {
+			condition.Release()
+		}
+	}()
+
+	condition, err := c.StringCondition(propertyID, value)
+	if err != nil {
+		return Position{}, false
+	}
+	conditions = append(conditions, condition)
+	if controlType != 0 {
+		if condition, err = c.IntCondition(UIA_ControlTypePropertyId, controlType); err != nil {
+			return Position{}, false
+		}
+		conditions = append(conditions, condition)
+	}
+
+	element, err := c.FindFirst(root, conditions...)
+	if err != nil {
+		return Position{}, false
+	}
+	defer element.Release()
+	return elementCentre(element)
+}
+
+// followPath walks a path down from root and returns the centre of the
+// element it ends at
+func (c *UIAutomationClient) followPath(root comObject, steps []selectorPathStep) (Position, bool) {
+	walker, err := c.ControlViewWalker()
+	if err != nil {
+		return Position{}, false
+	}
+	defer walker.Release()
+
+	current := root
+	defer func() {
+		if current != root {
+			current.Release()
+		}
+	}()
+	for _, step := range steps {
+		controlType := controlTypeID(step.ControlType)
+		var found comObject
+		index := 0
+		child := walkerStep(walker, vtblTreeWalkerGetFirstChildElement, current)
+		for seen := 0; child != 0 && seen < maxSelectorSiblings; seen++ {
+			if elementControlType(child) == controlType {
+				if index++; index == step.Index {
+					found = child
+					break
+				}
+			}
+			next := walkerStep(walker, vtblTreeWalkerGetNextSiblingElement, child)
+			child.Release()
+			child = next
+		}
+		if found == 0 {
+			child.Release()
+			return Position{}, false
+		}
+		if current != root {
+			current.Release()
+		}
+		current = found
+	}
+	return elementCentre(current)
+}
+
+// elementCentre returns the centre of an element on the screen
+func elementCentre(element comObject) (Position, bool) {
+	bounds, ok := elementBounds(element)
+	if !ok {
+		return Position{}, false
+	}
+	return Position{X: (bounds.Left + bounds.Right) / 2, Y: (bounds.Top + bounds.Bottom) / 2}, true
+}
+
+// describeSelector names the selector's element for messages
+func describeSelector(s *ElementSelector) string {
+	var parts []string
+	if s.ControlType != "" {
+		parts = append(parts, s.ControlType)
+	}
+	if s.AutomationID != "" {
+		parts = append(parts, "#"+s.AutomationID)
+	}
+	if s.Name != "" {
+		parts = append(parts, fmt.Sprintf("%q", s.Name))
+	}
+	if len(parts) == 0 {
+		return s.Path
+	}
+	return strings.Join(parts, " ")
+}
+
+// locateReplayAction moves a click to where its recorded element is now.
+// It returns the action and how its target was located; the recorded
+// coordinates are kept when the element has no selector or cannot be found.
+func locateReplayAction(action ReplayAction) (ReplayAction, string) {
+	if action.Selector == nil || action.Selector.Application == "" {
+		return action, LocatedByCoordinates
+	}
+	position, locatedBy, err := locateElement(action.Selector)
+	if err != nil {
+		printConsoleWarning(Msg(MsgReplayFallback, err, action.Position.X, action.Position.Y))
+		return action, LocatedByCoordinates
+	}
+	action.Position = position
+	return action, locatedBy
+}
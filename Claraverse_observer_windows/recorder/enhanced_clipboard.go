@@ -0,0 +1,581 @@
+package recorder
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+)
+
+var (
+	procGetClipboardSequenceNumber = user32.NewProc("GetClipboardSequenceNumber")
+	procRegisterClipboardFormatW   = user32.NewProc("RegisterClipboardFormatW")
+	procEmptyClipboard             = user32.NewProc("EmptyClipboard")
+	procSetClipboardData           = user32.NewProc("SetClipboardData")
+	procGlobalSize                 = kernel32.NewProc("GlobalSize")
+	procGlobalAlloc                = kernel32.NewProc("GlobalAlloc")
+	procGlobalFree                 = kernel32.NewProc("GlobalFree")
+	procEnumClipboardFormats       = user32.NewProc("EnumClipboardFormats")
+)
+
+const GMEM_MOVEABLE = 0x0002
+
+// selectionCopyTimeout bounds the wait for the focused application to answer
+// a synthesized Ctrl+C
+const selectionCopyTimeout = 250 * time.Millisecond
+
+// Additional clipboard formats beyond basic text (reuse existing CF_UNICODETEXT).
+// HTML and RTF are registered formats whose IDs are assigned per session.
+const CF_HDROP = 15
+
+// Clipboard formats held as GDI handles rather than global memory, which a
+// selection copy cannot save and put back. Windows makes CF_BITMAP and
+// CF_PALETTE from CF_DIB or CF_DIBV5 on its own, so with either of those
+// they need not be.
+const (
+	CF_BITMAP          = 2
+	CF_METAFILEPICT    = 3
+	CF_DIB             = 8
+	CF_PALETTE         = 9
+	CF_ENHMETAFILE     = 14
+	CF_DIBV5           = 17
+	CF_OWNERDISPLAY    = 0x80
+	CF_DSPBITMAP       = 0x82
+	CF_DSPMETAFILEPICT = 0x83
+	CF_DSPENHMETAFILE  = 0x8E
+	CF_GDIOBJFIRST     = 0x300
+	CF_GDIOBJLAST      = 0x3FF
+)
+
+// consoleWindowClasses are the window classes of consoles and terminals,
+// where Ctrl+C interrupts the running program instead of copying
+var consoleWindowClasses = []string{
+	"ConsoleWindowClass", "CASCADIA_HOSTING_WINDOW_CLASS", "PseudoConsoleWindow",
+	"mintty", "PuTTY", "VirtualConsoleClass",
+}
+
+var (
+	CF_HTML = registerClipboardFormat("HTML Format")
+	CF_RTF  = registerClipboardFormat("Rich Text Format")
+)
+
+func registerClipboardFormat(name string) uint32 {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0
+	}
+	ret, _, _ := procRegisterClipboardFormatW.Call(uintptr(unsafe.Pointer(namePtr)))
+	return uint32(ret)
+}
+
+// Enhanced clipboard format information
+type ClipboardFormat struct {
+	ID   uint32
+	Name string
+	MIME string
+}
+
+// Advanced clipboard configuration
+type AdvancedClipboardConfig struct {
+	DetectMultipleFormats bool
+	TrackContentSize      bool
+	FilterNullValues      bool
+	MaxContentLength      int
+	TruncateThreshold     int
+}
+
+// Null value patterns for filtering
+var nullValuePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^null$`),
+	regexp.MustCompile(`^undefined$`),
+	regexp.MustCompile(`^unknown$`),
+	regexp.MustCompile(`^\s*$`),
+	regexp.MustCompile(`^n/a$`),
+	regexp.MustCompile(`^none$`),
+	regexp.MustCompile(`^empty$`),
+	regexp.MustCompile(`^void$`),
+	regexp.MustCompile(`^blank$`),
+	regexp.MustCompile(`^na$`),
+	regexp.MustCompile(`^nil$`),
+	regexp.MustCompile(`^nothing$`),
+	regexp.MustCompile(`^no data$`),
+	regexp.MustCompile(`^no content$`),
+	regexp.MustCompile(`^not available$`),
+	regexp.MustCompile(`^not specified$`),
+	regexp.MustCompile(`^unspecified$`),
+	regexp.MustCompile(`^default$`),
+	regexp.MustCompile(`^placeholder$`),
+	regexp.MustCompile(`^sample$`),
+}
+
+// Supported clipboard formats
+var supportedFormats = []ClipboardFormat{
+	{CF_TEXT, "CF_TEXT", "text/plain"},
+	{CF_UNICODETEXT, "CF_UNICODETEXT", "text/plain; charset=utf-8"},
+	{CF_HTML, "CF_HTML", "text/html"},
+	{CF_RTF, "CF_RTF", "application/rtf"},
+	{CF_HDROP, "CF_HDROP", "application/x-file-list"},
+}
+
+// ClipboardTracker is the single owner of clipboard polling. It uses the
+// clipboard sequence number to skip unchanged polls, so the clipboard is only
+// opened when another application has actually written to it.
+type ClipboardTracker struct {
+	Config       AdvancedClipboardConfig
+	LastContent  string
+	LastSequence uint32
+	Mutex        sync.Mutex
+}
+
+// NewClipboardTracker creates a clipboard tracker
+func NewClipboardTracker(config AdvancedClipboardConfig) *ClipboardTracker {
+	return &ClipboardTracker{
+		Config: config,
+	}
+}
+
+// newDefaultClipboardTracker creates a tracker configured from the recorder config
+func newDefaultClipboardTracker(config WorkflowRecorderConfig) *ClipboardTracker {
+	return NewClipboardTracker(AdvancedClipboardConfig{
+		DetectMultipleFormats: true,
+		TrackContentSize:      true,
+		FilterNullValues:      true,
+		MaxContentLength:      config.MaxClipboardContentLength,
+		TruncateThreshold:     config.MaxClipboardContentLength,
+	})
+}
+
+// Configure applies a recording's content length limit. The tracker itself
+// lives across recordings, so a clipboard left unchanged since the last one
+// is not reported again.
+func (ct *ClipboardTracker) Configure(config WorkflowRecorderConfig) {
+	ct.Mutex.Lock()
+	defer ct.Mutex.Unlock()
+
+	ct.Config.MaxContentLength = config.MaxClipboardContentLength
+	ct.Config.TruncateThreshold = config.MaxClipboardContentLength
+}
+
+// Poll returns a clipboard event when the clipboard content changed since the
+// last poll, or nil otherwise
+func (ct *ClipboardTracker) Poll() *ClipboardEvent {
+	ct.Mutex.Lock()
+	defer ct.Mutex.Unlock()
+
+	sequence, _, _ := procGetClipboardSequenceNumber.Call()
+	if uint32(sequence) != 0 && uint32(sequence) == ct.LastSequence {
+		return nil
+	}
+
+	content, format, originalSize, truncated, ok := ct.readContent()
+	if !ok {
+		// Clipboard is held by another application; retry on the next poll
+		return nil
+	}
+	ct.LastSequence = uint32(sequence)
+
+	if content == "" || content == ct.LastContent {
+		return nil
+	}
+	ct.LastContent = content
+
+	return &ClipboardEvent{
+		Action:      detectClipboardAction(),
+		Content:     content,
+		ContentSize: originalSize,
+		Format:      format.MIME,
+		Truncated:   truncated,
+		Metadata:    createEventMetadata(),
+	}
+}
+
+// CopySelection reads the current selection by sending Ctrl+C and then puts
+// the previous clipboard contents back, every format of them. Polling is
+// held off meanwhile so the round trip is not recorded as a copy. Nothing is
+// sent while a modifier is held, as Ctrl+C would become another shortcut,
+// in a console or terminal, where it would interrupt the running program,
+// or when the clipboard holds a format that could not be put back.
+func (ct *ClipboardTracker) CopySelection() string {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	_, application := describeWindow(hwnd)
+	if !selectionCopyAllowed(getCurrentModifierStates(), getWindowClassName(hwnd), application) {
+		return ""
+	}
+
+	ct.Mutex.Lock()
+	defer ct.Mutex.Unlock()
+
+	original, ok := saveClipboard()
+	if !ok {
+		return ""
+	}
+	before, _, _ := procGetClipboardSequenceNumber.Call()
+
+	if err := SimulateKeyPress('C', VK_CONTROL); err != nil {
+		return ""
+	}
+
+	deadline := time.Now().Add(selectionCopyTimeout)
+	for time.Now().Before(deadline) {
+		if current, _, _ := procGetClipboardSequenceNumber.Call(); current != before {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	after, _, _ := procGetClipboardSequenceNumber.Call()
+	if after == before {
+		return "" // Nothing was selected, or the application ignored the copy
+	}
+
+	selection := getClipboardContent()
+	original.Restore()
+
+	// Skip the sequence numbers produced by the round trip
+	restored, _, _ := procGetClipboardSequenceNumber.Call()
+	ct.LastSequence = uint32(restored)
+
+	return selection
+}
+
+// selectionCopyAllowed reports whether a synthesized Ctrl+C would copy the
+// selection in the window in front: no modifier is held, and the window is
+// not a console or terminal
+func selectionCopyAllowed(modifiers ModifierStates, className, application string) bool {
+	if modifiers != (ModifierStates{}) || isTerminalApplication(application) {
+		return false
+	}
+	for _, console := range consoleWindowClasses {
+		if strings.EqualFold(className, console) {
+			return false
+		}
+	}
+	return true
+}
+
+// clipboardSnapshot is every format on the clipboard, copied out of it
+type clipboardSnapshot struct {
+	Formats []uint32
+	Data    [][]byte
+}
+
+// restorableFormats returns the formats of formats to save so that putting
+// them back restores the clipboard, and false when one of them cannot be
+func restorableFormats(formats []uint32) ([]uint32, bool) {
+	hasDIB := false
+	for _, format := range formats {
+		hasDIB = hasDIB || format == CF_DIB || format == CF_DIBV5
+	}
+
+	var saved []uint32
+	for _, format := range formats {
+		switch {
+		case format == CF_BITMAP || format == CF_PALETTE:
+			if !hasDIB {
+				return nil, false
+			}
+		case format == CF_METAFILEPICT, format == CF_ENHMETAFILE, format == CF_OWNERDISPLAY,
+			format == CF_DSPBITMAP, format == CF_DSPMETAFILEPICT, format == CF_DSPENHMETAFILE,
+			format >= CF_GDIOBJFIRST && format <= CF_GDIOBJLAST:
+			return nil, false
+		default:
+			saved = append(saved, format)
+		}
+	}
+	return saved, true
+}
+
+// saveClipboard copies every format on the clipboard. ok is false when the
+// clipboard could not be opened or holds a format that cannot be put back.
+func saveClipboard() (clipboardSnapshot, bool) {
+	if ret, _, _ := procOpenClipboard.Call(0); ret == 0 {
+		return clipboardSnapshot{}, false
+	}
+	defer procCloseClipboard.Call()
+
+	var formats []uint32
+	for format := uint32(0); ; {
+		next, _, _ := procEnumClipboardFormats.Call(uintptr(format))
+		if next == 0 {
+			break
+		}
+		format = uint32(next)
+		formats = append(formats, format)
+	}
+	formats, ok := restorableFormats(formats)
+	if !ok {
+		return clipboardSnapshot{}, false
+	}
+
+	var snapshot clipboardSnapshot
+	for _, format := range formats {
+		handle, _, _ := procGetClipboardData.Call(uintptr(format))
+		if handle == 0 {
+			continue
+		}
+		size, _, _ := procGlobalSize.Call(handle)
+		ptr, _, _ := procGlobalLock.Call(handle)
+		if ptr == 0 {
+			continue
+		}
+		// GlobalLock pins the clipboard's block, outside the Go heap, until
+		// GlobalUnlock, and GlobalSize is its length
+		data := make([]byte, size)
+		copy(data, unsafe.Slice((*byte)(unsafe.Pointer(ptr)), size))
+		procGlobalUnlock.Call(handle)
+		snapshot.Formats = append(snapshot.Formats, format)
+		snapshot.Data = append(snapshot.Data, data)
+	}
+	return snapshot, true
+}
+
+// Restore puts the saved formats back on the clipboard, or empties it when
+// none were saved
+func (s clipboardSnapshot) Restore() bool {
+	if ret, _, _ := procOpenClipboard.Call(0); ret == 0 {
+		return false
+	}
+	defer procCloseClipboard.Call()
+
+	procEmptyClipboard.Call()
+	restored := true
+	for i, format := range s.Formats {
+		restored = setClipboardData(format, s.Data[i]) && restored
+	}
+	return restored
+}
+
+// setClipboardData puts data on the open clipboard as format
+func setClipboardData(format uint32, data []byte) bool {
+	handle, _, _ := procGlobalAlloc.Call(GMEM_MOVEABLE, uintptr(max(len(data), 1)))
+	if handle == 0 {
+		return false
+	}
+	ptr, _, _ := procGlobalLock.Call(handle)
+	if ptr == 0 {
+		procGlobalFree.Call(handle)
+		return false
+	}
+	// The block was just allocated at least len(data) long, and stays put
+	// until GlobalUnlock
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(ptr)), len(data)), data)
+	procGlobalUnlock.Call(handle)
+
+	// On success the clipboard owns the memory
+	if ret, _, _ := procSetClipboardData.Call(uintptr(format), handle); ret == 0 {
+		procGlobalFree.Call(handle)
+		return false
+	}
+	return true
+}
+
+// GetLastContent returns the most recently recorded clipboard content
+func (ct *ClipboardTracker) GetLastContent() string {
+	ct.Mutex.Lock()
+	defer ct.Mutex.Unlock()
+
+	return ct.LastContent
+}
+
+// readContent reads the clipboard in its best available format. ok is false
+// only when the clipboard could not be opened.
+func (ct *ClipboardTracker) readContent() (content string, format ClipboardFormat, originalSize int, truncated bool, ok bool) {
+	ret, _, _ := procOpenClipboard.Call(0)
+	if ret == 0 {
+		return "", ClipboardFormat{}, 0, false, false
+	}
+	defer procCloseClipboard.Call()
+
+	format = getBestClipboardFormat(detectClipboardFormats())
+	content = getClipboardDataByFormat(format.ID)
+	originalSize = len(content)
+
+	// Filter null values if enabled
+	if ct.Config.FilterNullValues && isNullValue(content) {
+		return "", format, 0, false, true
+	}
+
+	// Apply size limits
+	if ct.Config.MaxContentLength > 0 && len(content) > ct.Config.MaxContentLength {
+		content = truncateUTF8(content, ct.Config.MaxContentLength)
+		truncated = true
+	}
+
+	return content, format, originalSize, truncated, true
+}
+
+// detectClipboardFormats lists the supported formats currently on the
+// clipboard. The clipboard must already be open.
+func detectClipboardFormats() []ClipboardFormat {
+	var availableFormats []ClipboardFormat
+
+	for _, format := range supportedFormats {
+		if format.ID == 0 {
+			continue
+		}
+		ret, _, _ := procIsClipboardFormatAvailable.Call(uintptr(format.ID))
+		if ret != 0 {
+			availableFormats = append(availableFormats, format)
+		}
+	}
+
+	return availableFormats
+}
+
+// Get best available clipboard format
+func getBestClipboardFormat(formats []ClipboardFormat) ClipboardFormat {
+	// Priority order: HTML > RTF > Unicode Text > Text
+	priorities := []uint32{CF_HTML, CF_RTF, CF_UNICODETEXT, CF_TEXT}
+
+	for _, priority := range priorities {
+		for _, format := range formats {
+			if format.ID == priority {
+				return format
+			}
+		}
+	}
+
+	// Return default if nothing found
+	return ClipboardFormat{CF_TEXT, "CF_TEXT", "text/plain"}
+}
+
+// getClipboardDataByFormat reads one format from the open clipboard, bounded by
+// the size of the underlying global memory block
+func getClipboardDataByFormat(format uint32) string {
+	ret, _, _ := procIsClipboardFormatAvailable.Call(uintptr(format))
+	if ret == 0 {
+		return ""
+	}
+
+	handle, _, _ := procGetClipboardData.Call(uintptr(format))
+	if handle == 0 {
+		return ""
+	}
+
+	size, _, _ := procGlobalSize.Call(handle)
+	if size == 0 {
+		return ""
+	}
+
+	ptr, _, _ := procGlobalLock.Call(handle)
+	if ptr == 0 {
+		return ""
+	}
+	defer procGlobalUnlock.Call(handle)
+
+	// ptr addresses the clipboard's size bytes, locked in place outside the
+	// Go heap until the deferred GlobalUnlock
+	switch format {
+	case CF_UNICODETEXT:
+		return syscall.UTF16ToString(unsafe.Slice((*uint16)(unsafe.Pointer(ptr)), size/2))
+	case CF_HDROP:
+		return "[File Drop]" // Simplified representation
+	default:
+		// CF_TEXT is ANSI, CF_HTML is UTF-8 and RTF is 7-bit; all NUL terminated
+		data := unsafe.Slice((*byte)(unsafe.Pointer(ptr)), size)
+		if end := bytes.IndexByte(data, 0); end >= 0 {
+			data = data[:end]
+		}
+		return string(data)
+	}
+}
+
+// getClipboardContent returns the clipboard as plain text without recording
+// it, for trackers that inspect the clipboard
+func getClipboardContent() string {
+	ret, _, _ := procOpenClipboard.Call(0)
+	if ret == 0 {
+		return ""
+	}
+	defer procCloseClipboard.Call()
+
+	if content := getClipboardDataByFormat(CF_UNICODETEXT); content != "" {
+		return content
+	}
+	return getClipboardDataByFormat(CF_TEXT)
+}
+
+// truncateUTF8 cuts s to at most maxBytes without splitting a character
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
+
+// Check if content represents a null/empty value
+func isNullValue(content string) bool {
+	if content == "" {
+		return true
+	}
+
+	normalizedContent := strings.ToLower(strings.TrimSpace(content))
+
+	for _, pattern := range nullValuePatterns {
+		if pattern.MatchString(normalizedContent) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Detect clipboard action based on keyboard input
+func detectClipboardAction() ClipboardAction {
+	// Check for common clipboard shortcuts
+	if isKeyPressed(0x11) { // Ctrl key
+		if isKeyPressed(0x43) { // C key
+			return ClipboardCopy
+		}
+		if isKeyPressed(0x58) { // X key
+			return ClipboardCut
+		}
+		if isKeyPressed(0x56) { // V key
+			return ClipboardPaste
+		}
+	}
+
+	return ClipboardCopy // Default action
+}
+
+// Enhanced clipboard validation
+func validateClipboardContent(content string) bool {
+	// Basic validation rules
+	if len(content) == 0 {
+		return false
+	}
+
+	// Check for suspicious patterns
+	suspiciousPatterns := []string{
+		"javascript:",
+		"data:text/html",
+		"<script",
+		"vbscript:",
+	}
+
+	lowerContent := strings.ToLower(content)
+	for _, pattern := range suspiciousPatterns {
+		if strings.Contains(lowerContent, pattern) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Get clipboard format name by ID
+func getFormatName(formatID uint32) string {
+	for _, format := range supportedFormats {
+		if format.ID == formatID {
+			return format.Name
+		}
+	}
+	return "Unknown"
+}
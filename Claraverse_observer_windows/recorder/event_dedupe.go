@@ -0,0 +1,130 @@
+package recorder
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// EventDeduplicator suppresses events that repeat the same type and key fields
+// within a short window, e.g. one clipboard change picked up by two pollers
+type EventDeduplicator struct {
+	Window          time.Duration
+	LastSeen        map[string]time.Time
+	SuppressedCount int64
+	Mutex           sync.Mutex
+}
+
+// NewEventDeduplicator creates a deduplicator; a zero window disables it
+func NewEventDeduplicator(window time.Duration) *EventDeduplicator {
+	return &EventDeduplicator{
+		Window:   window,
+		LastSeen: make(map[string]time.Time),
+	}
+}
+
+// IsDuplicate reports whether an equivalent event was already seen inside the
+// window, and records the event otherwise
+func (ed *EventDeduplicator) IsDuplicate(event WorkflowEvent) bool {
+	if ed == nil || ed.Window <= 0 {
+		return false
+	}
+
+	key := eventDedupeKey(event)
+	if key == "" {
+		return false
+	}
+
+	ed.Mutex.Lock()
+	defer ed.Mutex.Unlock()
+
+	now := time.Now()
+	if last, exists := ed.LastSeen[key]; exists && now.Sub(last) < ed.Window {
+		ed.SuppressedCount++
+		return true
+	}
+
+	ed.LastSeen[key] = now
+
+	// Drop expired keys so the map doesn't grow with every distinct event
+	if len(ed.LastSeen) > 256 {
+		for k, seen := range ed.LastSeen {
+			if now.Sub(seen) >= ed.Window {
+				delete(ed.LastSeen, k)
+			}
+		}
+	}
+
+	return false
+}
+
+// GetSuppressedCount returns how many events were dropped as duplicates
+func (ed *EventDeduplicator) GetSuppressedCount() int64 {
+	if ed == nil {
+		return 0
+	}
+
+	ed.Mutex.Lock()
+	defer ed.Mutex.Unlock()
+
+	return ed.SuppressedCount
+}
+
+// eventDedupeKey builds the identity of an event from its type and key fields.
+// Keyboard events, hotkeys, mouse button transitions and button clicks
+// return "" and are never deduplicated, since key auto-repeat, a shortcut
+// pressed twice and double clicks legitimately repeat within the window. A screenshot is the
+// same screenshot only when it is the same capture, or failing a capture ID
+// the same image; two taken by one trigger in quick succession are not.
+func eventDedupeKey(event WorkflowEvent) string {
+	switch e := event.(type) {
+	case *MouseEvent:
+		return eventDedupeKey(*e)
+	case *ClipboardEvent:
+		return eventDedupeKey(*e)
+	case *ScreenshotEvent:
+		return eventDedupeKey(*e)
+	case MouseEvent:
+		switch e.EventType {
+		case MouseMove, MouseWheel, MouseDrag:
+			return fmt.Sprintf("mouse|%s|%s|%d|%d", e.EventType, e.Button, e.Position.X, e.Position.Y)
+		}
+		return ""
+	case ClipboardEvent:
+		return fmt.Sprintf("clipboard|%s|%s|%d", e.Action, e.Format, hashContent(e.Content))
+	case ApplicationSwitchEvent:
+		return fmt.Sprintf("appswitch|%d|%d|%s", e.FromProcessID, e.ToProcessID, e.ToApplication)
+	case ScreenshotEvent:
+		if e.CaptureID != 0 {
+			return fmt.Sprintf("screenshot|capture|%d", e.CaptureID)
+		}
+		if e.ImageBase64 != "" {
+			return fmt.Sprintf("screenshot|image|%d", hashContent(e.ImageBase64))
+		}
+		return ""
+	case TextInputCompletedEvent:
+		return fmt.Sprintf("textinput|%s|%d", e.FieldName, hashContent(e.TextValue))
+	case BrowserTabNavigationEvent:
+		return fmt.Sprintf("browser|%s|%s|%s", e.Action, e.FromURL, e.ToURL)
+	case TextSelectionEvent:
+		return fmt.Sprintf("selection|%s|%d", e.SelectionMethod, hashContent(e.SelectedText))
+	case DragDropEvent:
+		return fmt.Sprintf("dragdrop|%d|%d|%d|%d",
+			e.StartPosition.X, e.StartPosition.Y, e.EndPosition.X, e.EndPosition.Y)
+	case BrowserCDPEvent:
+		if e.CDPEvent == CDPElementClicked {
+			return ""
+		}
+		return fmt.Sprintf("cdp|%s|%s|%s", e.CDPEvent, e.TargetID, e.URL)
+	default:
+		return ""
+	}
+}
+
+// hashContent keeps dedupe keys small for large payloads such as clipboard text
+func hashContent(content string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(content))
+	return h.Sum64()
+}
@@ -0,0 +1,219 @@
+package recorder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event pipeline. Every event on its way into a recording passes through
+// the same stages in order: filter (strict schema checks and duplicates),
+// redact (PII masking), enrich, rate_limit (recording quotas) and finally
+// the sink, which records it. Each stage is a list of EventMiddleware: the
+// recorder's own come first, and integrators add theirs to any stage with
+// Use to drop, rewrite or annotate events without forking the recorder.
+// A middleware can also Emit further events, which go through the whole
+// pipeline after the one being processed.
+//
+// Filtering that decides whether an event happened at all, such as ignored
+// applications, noise filters and MaxEventsPerSecond, stays in the capture
+// code, as it also spares the screenshots and console output that follow.
+
+// Stages of the event pipeline, in order
+const (
+	EventStageFilter    = "filter"
+	EventStageRedact    = "redact"
+	EventStageEnrich    = "enrich"
+	EventStageRateLimit = "rate_limit"
+)
+
+var eventStages = []string{EventStageFilter, EventStageRedact, EventStageEnrich, EventStageRateLimit}
+
+// EventMiddleware processes events on their way into a recording
+type EventMiddleware interface {
+	// ProcessEvent returns the event, changed or not, for the next
+	// middleware, or false to drop it
+	ProcessEvent(ctx *EventContext, event WorkflowEvent) (WorkflowEvent, bool)
+}
+
+// EventMiddlewareFunc lets a function be used as an EventMiddleware
+type EventMiddlewareFunc func(ctx *EventContext, event WorkflowEvent) (WorkflowEvent, bool)
+
+// ProcessEvent calls f
+func (f EventMiddlewareFunc) ProcessEvent(ctx *EventContext, event WorkflowEvent) (WorkflowEvent, bool) {
+	return f(ctx, event)
+}
+
+// EventContext is what middleware know about the event being processed
+type EventContext struct {
+	Workflow *RecordedWorkflow // The recording the event is going into
+	Stage    string
+	Now      time.Time
+	emitted  []WorkflowEvent
+}
+
+// Emit adds another event to the recording, sent through the pipeline from
+// the start once the current event is through
+func (ctx *EventContext) Emit(event WorkflowEvent) {
+	ctx.emitted = append(ctx.emitted, event)
+}
+
+// EventPipeline runs events through the middleware of each stage and hands
+// the ones that get through to the sink
+type EventPipeline struct {
+	Stages  map[string][]EventMiddleware
+	Dropped map[string]int64 // Events dropped, by stage
+	Sink    func(workflow *RecordedWorkflow, event WorkflowEvent)
+	Mutex   sync.Mutex
+}
+
+// NewEventPipeline creates the pipeline of recorder's recordings, with its
+// own middleware; integrators add theirs before recording starts
+func NewEventPipeline(recorder *Recorder) *EventPipeline {
+	return &EventPipeline{
+		Stages: map[string][]EventMiddleware{
+			EventStageFilter:    {EventMiddlewareFunc(recorder.admitSchema), EventMiddlewareFunc(recorder.dropDuplicates)},
+			EventStageRedact:    {EventMiddlewareFunc(recorder.redactPII)},
+			EventStageEnrich:    {EventMiddlewareFunc(recorder.enrichOfficeContext)},
+			EventStageRateLimit: {EventMiddlewareFunc(recorder.enforceQuotas)},
+		},
+		Dropped: make(map[string]int64),
+		Sink:    recorder.recordEvent,
+	}
+}
+
+// Use adds middleware to the end of a stage
+func (p *EventPipeline) Use(stage string, middleware EventMiddleware) error {
+	if !contains(eventStages, stage) {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Unknown event pipeline stage %q: must be one of %v", stage, eventStages), nil)
+	}
+
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+
+	// Copied so runs in progress keep the list they started with
+	p.Stages[stage] = append(append([]EventMiddleware(nil), p.Stages[stage]...), middleware)
+	return nil
+}
+
+// Run sends events through the pipeline into workflow
+func (p *EventPipeline) Run(workflow *RecordedWorkflow, events []WorkflowEvent) {
+	p.Mutex.Lock()
+	stages := make([][]EventMiddleware, len(eventStages))
+	for i, stage := range eventStages {
+		stages[i] = p.Stages[stage]
+	}
+	p.Mutex.Unlock()
+
+	for len(events) > 0 {
+		ctx := &EventContext{Workflow: workflow, Now: time.Now()}
+		if event, ok := p.process(ctx, stages, events[0]); ok {
+			p.Sink(workflow, event)
+		}
+		events = events[1:]
+		if len(ctx.emitted) > 0 {
+			events = append(ctx.emitted, events...)
+		}
+	}
+}
+
+// process runs one event through the stages, counting it against the stage
+// that drops it
+func (p *EventPipeline) process(ctx *EventContext, stages [][]EventMiddleware, event WorkflowEvent) (WorkflowEvent, bool) {
+	for i, middleware := range stages {
+		ctx.Stage = eventStages[i]
+		for _, m := range middleware {
+			var ok bool
+			if event, ok = m.ProcessEvent(ctx, event); !ok {
+				p.Mutex.Lock()
+				p.Dropped[ctx.Stage]++
+				p.Mutex.Unlock()
+				return nil, false
+			}
+		}
+	}
+	return event, true
+}
+
+// GetStatistics returns the events dropped by each stage
+func (p *EventPipeline) GetStatistics() map[string]int64 {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+
+	dropped := make(map[string]int64, len(p.Dropped))
+	for stage, count := range p.Dropped {
+		dropped[stage] = count
+	}
+	return dropped
+}
+
+// admitSchema drops events that break the recording schema in strict mode
+func (r *Recorder) admitSchema(ctx *EventContext, event WorkflowEvent) (WorkflowEvent, bool) {
+	r.Mutex.RLock()
+	validator := r.Schema
+	r.Mutex.RUnlock()
+	return event, validator.Admit(event)
+}
+
+// dropDuplicates drops repeats of an event inside the dedupe window
+func (r *Recorder) dropDuplicates(ctx *EventContext, event WorkflowEvent) (WorkflowEvent, bool) {
+	r.Mutex.RLock()
+	dedupe := r.Deduplicator
+	r.Mutex.RUnlock()
+	return event, !dedupe.IsDuplicate(event)
+}
+
+// redactPII masks personal data in an event's text
+func (r *Recorder) redactPII(ctx *EventContext, event WorkflowEvent) (WorkflowEvent, bool) {
+	r.Mutex.RLock()
+	redactor := r.PII
+	r.Mutex.RUnlock()
+	return redactor.RedactEvent(event), true
+}
+
+// enforceQuotas drops events over their recording quota, recording a marker
+// the first time a quota is exceeded
+func (r *Recorder) enforceQuotas(ctx *EventContext, event WorkflowEvent) (WorkflowEvent, bool) {
+	quotas := r.Quotas
+	if quotas == nil {
+		return event, true
+	}
+
+	admitted, marker := quotas.Admit(event, ctx.Now)
+	if marker != nil {
+		printConsole(Msg(MsgQuotaExceeded, marker.QuotaExceeded, marker.QuotaKind,
+			marker.Metadata.UIElement.ApplicationName, time.UnixMilli(int64(marker.ResumesAt)).Format("Jan 2 15:04")))
+		ctx.Emit(*marker)
+	}
+	return event, admitted
+}
+
+// recordEvent is the sink: it adds an event to workflow and the event
+// sinks, or to the audit in a dry run, and starts the work done on recorded
+// screenshots
+func (r *Recorder) recordEvent(workflow *RecordedWorkflow, event WorkflowEvent) {
+	// Tracker callbacks record events from their own goroutines, which may
+	// outlast the recording
+	r.Mutex.RLock()
+	auditor, analytics, encoder, sinks := r.Auditor, r.Analytics, r.Encoder, r.Sinks
+	r.Mutex.RUnlock()
+
+	if auditor != nil {
+		auditor.Record(event)
+		return
+	}
+	event = workflow.AppendEvent(event)
+	analytics.Observe(event)
+
+	shot, isScreenshot := event.(ScreenshotEvent)
+	if isScreenshot && shot.ImagePending {
+		// Streamed once the image is attached
+		encoder.Submit(workflow, shot)
+		return
+	}
+	sinks.Write(workflow.Name, event)
+	if isScreenshot {
+		r.analyzeScreenshot(workflow, shot)
+	}
+}
@@ -0,0 +1,174 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Strict mode. With Strict set, every event is checked against the recording
+// schema as it is emitted: it must have metadata with a timestamp, and the
+// fields that say what happened must not be empty. Events that fail are left
+// out of the recording and counted by type and problem, in /status and in the
+// saved recording's schema_rejections, so pipelines consuming recordings can
+// rely on every event they get being complete.
+
+// requiredEventFields are the string fields each type of event must have
+// set, or the flags it must have true; "a|b" needs either of them
+var requiredEventFields = map[string][]string{
+	"MouseEvent":                {"event_type", "button"},
+	"ClipboardEvent":            {"action", "format"},
+	"HotkeyEvent":               {"combination", "action"},
+	"ApplicationSwitchEvent":    {"to_application", "switch_method"},
+	"ButtonClickEvent":          {"interaction_type"},
+	"ScreenshotEvent":           {"image_base64|image_ref|image_pending", "image_format", "trigger"},
+	"TextInputCompletedEvent":   {"field_type", "input_method"},
+	"TextSelectionEvent":        {"selection_method"},
+	"BrowserTabNavigationEvent": {"action", "method", "browser"},
+	"BrowserCDPEvent":           {"cdp_event"},
+	"CommandEnteredEvent":       {"command"},
+	"SegmentMarkerEvent":        {"segment_marker"},
+	"RecordingMarkerEvent":      {"recording_marker"},
+	"AnnotationEvent":           {"annotation"},
+	"BookmarkEvent":             {"bookmark"},
+	"QuotaExceededEvent":        {"quota_exceeded"},
+	"RecordingRotatedEvent":     {"recording_rotated"},
+	"SessionInterruptedEvent":   {"session_interrupted"},
+	"IdleEvent":                 {"idle"},
+	"RecorderRecoveredEvent":    {"recorder_recovered"},
+	"WindowGeometryEvent":       {"window_change"},
+	"FileActivityEvent":         {"file_activity", "path"},
+	"ProcessEvent":              {"process", "application"},
+	"MenuItemSelectedEvent":     {"menu_item", "menu_kind"},
+	"DialogEvent":               {"dialog", "dialog_kind"},
+	"FileDialogEvent":           {"file_dialog", "paths"},
+	"FocusChangedEvent":         {"focus_role", "application"},
+	"WindowTitleChangedEvent":   {"window_title", "previous_title"},
+}
+
+// validateEvent lists the ways an event breaks the recording schema
+func validateEvent(event WorkflowEvent) []string {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return []string{"not serializable"}
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return []string{"not a JSON object"}
+	}
+
+	var problems []string
+	metadata, ok := fields["metadata"].(map[string]interface{})
+	if !ok {
+		problems = append(problems, "missing metadata")
+	} else if timestamp, _ := metadata["timestamp"].(float64); timestamp <= 0 {
+		problems = append(problems, "zero timestamp")
+	}
+
+	for _, required := range requiredEventFields[auditEventType(event)] {
+		set := false
+		for _, name := range strings.Split(required, "|") {
+			value, _ := fields[name].(string)
+			set = set || strings.TrimSpace(value) != "" || fields[name] == true
+		}
+		if !set {
+			problems = append(problems, "empty "+strings.ReplaceAll(required, "|", " or "))
+		}
+	}
+	return problems
+}
+
+// SchemaValidator rejects the events of a recording that break the schema
+type SchemaValidator struct {
+	Rejected  int
+	ByType    map[string]int
+	ByProblem map[string]int
+	Mutex     sync.Mutex
+}
+
+// NewSchemaValidator creates a validator when config asks for strict mode,
+// or returns nil
+func NewSchemaValidator(config WorkflowRecorderConfig) *SchemaValidator {
+	if !config.Strict {
+		return nil
+	}
+	return &SchemaValidator{
+		ByType:    make(map[string]int),
+		ByProblem: make(map[string]int),
+	}
+}
+
+// Admit reports whether event may be recorded, counting it and saying why
+// the first time a type of event is rejected for a problem
+func (v *SchemaValidator) Admit(event WorkflowEvent) bool {
+	if v == nil {
+		return true
+	}
+	problems := validateEvent(event)
+	if len(problems) == 0 {
+		return true
+	}
+
+	v.Mutex.Lock()
+	defer v.Mutex.Unlock()
+
+	name := auditEventType(event)
+	v.Rejected++
+	v.ByType[name]++
+	for _, problem := range problems {
+		key := name + ": " + problem
+		if v.ByProblem[key] == 0 {
+			printConsole(Msg(MsgSchemaRejected, name, problem))
+		}
+		v.ByProblem[key]++
+	}
+	return false
+}
+
+// Rejections returns the rejected events counted by type
+func (v *SchemaValidator) Rejections() map[string]int {
+	v.Mutex.Lock()
+	defer v.Mutex.Unlock()
+
+	counts := make(map[string]int, len(v.ByType))
+	for name, count := range v.ByType {
+		counts[name] = count
+	}
+	return counts
+}
+
+// GetStatistics returns the rejection counts
+func (v *SchemaValidator) GetStatistics() map[string]interface{} {
+	v.Mutex.Lock()
+	defer v.Mutex.Unlock()
+
+	byType := make(map[string]int, len(v.ByType))
+	for name, count := range v.ByType {
+		byType[name] = count
+	}
+	byProblem := make(map[string]int, len(v.ByProblem))
+	for problem, count := range v.ByProblem {
+		byProblem[problem] = count
+	}
+	return map[string]interface{}{
+		"rejected":            v.Rejected,
+		"rejected_by_type":    byType,
+		"rejected_by_problem": byProblem,
+	}
+}
+
+// describeRejections summarizes rejection counts for the log
+func describeRejections(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%d %s", counts[name], name)
+	}
+	return strings.Join(parts, ", ")
+}
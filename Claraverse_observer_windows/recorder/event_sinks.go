@@ -0,0 +1,507 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event sinks. Besides going into the recording, each recorded event can be
+// streamed to the EventSinks configured, as one JSON line with the
+// recording's name and the event's type: appended to an NDJSON file,
+// written to stdout (console messages then go to stderr), POSTed in batches
+// to an HTTP endpoint, produced in batches to a Kafka topic, or exported as
+// OpenTelemetry spans (see otlp_export.go). Screenshots are sent once their
+// image is encoded; captions and OCR results arrive later and are only in
+// the saved recording. HTTP, Kafka and OTLP sinks send from the background
+// and hold at most sinkMaxBuffered events while their endpoint is down,
+// dropping the oldest beyond that, so a slow platform never holds capture
+// up. Sink types beyond the built-in ones are added with
+// RegisterEventSinkType.
+
+const (
+	EventSinkFile   = "file"
+	EventSinkStdout = "stdout"
+	EventSinkHTTP   = "http"
+	EventSinkKafka  = "kafka"
+	EventSinkOTLP   = "otlp"
+
+	defaultSinkBatchSize = 100
+	defaultSinkFlushMs   = 1000
+	sinkMaxBuffered      = 10000
+	sinkCloseTimeout     = 10 * time.Second
+	httpSinkTimeout      = 10 * time.Second
+)
+
+// SinkEvent is a recorded event on its way to the sinks
+type SinkEvent struct {
+	Recording string        `json:"recording"`
+	Type      string        `json:"type"`
+	Event     WorkflowEvent `json:"event"`
+	data      []byte
+}
+
+// JSON returns the event as one line of JSON, encoded once for all sinks
+func (e *SinkEvent) JSON() ([]byte, error) {
+	if e.data == nil {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		e.data = data
+	}
+	return e.data, nil
+}
+
+// EventSink receives the events of a recording as they are recorded
+type EventSink interface {
+	// Write sends an event; sinks that batch may send it later
+	Write(event *SinkEvent) error
+	// Close sends what is still buffered and releases the sink
+	Close() error
+	GetStatistics() map[string]interface{}
+}
+
+// EventSinkFactory creates a sink from its configuration
+type EventSinkFactory func(config EventSinkConfig) (EventSink, error)
+
+var (
+	eventSinkTypes = map[string]EventSinkFactory{
+		EventSinkFile:   newFileSink,
+		EventSinkStdout: newStdoutSink,
+		EventSinkHTTP:   newHTTPSink,
+		EventSinkKafka:  newKafkaSink,
+		EventSinkOTLP:   newOTLPSink,
+	}
+	eventSinkTypesMutex sync.RWMutex
+
+	// eventStdout is the process's standard output, kept for the stdout
+	// sink while console messages are sent to stderr
+	eventStdout io.Writer = os.Stdout
+)
+
+// RegisterEventSinkType adds a type of sink that EventSinks can name
+func RegisterEventSinkType(name string, factory EventSinkFactory) {
+	eventSinkTypesMutex.Lock()
+	defer eventSinkTypesMutex.Unlock()
+
+	eventSinkTypes[name] = factory
+}
+
+// EventSinks is the set of sinks a recording streams to
+type EventSinks struct {
+	Sinks    []EventSink
+	Types    []string
+	Recorded int64
+	Failed   int64 // Events a sink refused, counted once per sink
+	Mutex    sync.Mutex
+}
+
+// NewEventSinks creates the configured sinks, or returns nil when there are
+// none
+func NewEventSinks(configs []EventSinkConfig) (*EventSinks, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	sinks := &EventSinks{}
+	for _, config := range configs {
+		eventSinkTypesMutex.RLock()
+		factory, ok := eventSinkTypes[config.Type]
+		eventSinkTypesMutex.RUnlock()
+		if !ok {
+			sinks.Close()
+			return nil, NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("Unknown event sink type %q", config.Type), nil)
+		}
+		sink, err := factory(config)
+		if err != nil {
+			sinks.Close()
+			return nil, NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("Cannot create the %s event sink", config.Type), err)
+		}
+		sinks.Sinks = append(sinks.Sinks, sink)
+		sinks.Types = append(sinks.Types, config.Type)
+	}
+	return sinks, nil
+}
+
+// Write sends an event recorded in the named recording to every sink
+func (s *EventSinks) Write(recording string, event WorkflowEvent) {
+	if s == nil {
+		return
+	}
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.Recorded++
+	record := &SinkEvent{Recording: recording, Type: auditEventType(event), Event: event}
+	for i, sink := range s.Sinks {
+		if err := sink.Write(record); err != nil {
+			if s.Failed == 0 {
+				logger("sinks").Error("Event sink failed", "sink", s.Types[i], "error", err)
+			}
+			s.Failed++
+		}
+	}
+}
+
+// Close flushes and closes every sink
+func (s *EventSinks) Close() {
+	s.CloseContext(context.Background())
+}
+
+// CloseContext flushes and closes every sink, giving up on those still
+// flushing when ctx is done. Those finish in the background, or not at all
+// if the process exits first.
+func (s *EventSinks) CloseContext(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		s.Mutex.Lock()
+		defer s.Mutex.Unlock()
+
+		for i, sink := range s.Sinks {
+			if err := sink.Close(); err != nil {
+				logger("sinks").Error("Closing event sink failed", "sink", s.Types[i], "error", err)
+			}
+		}
+	}()
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		logger("sinks").Warn("Gave up waiting for the event sinks to flush", "error", ctx.Err())
+	}
+}
+
+// GetStatistics returns each sink's counters, in configuration order
+func (s *EventSinks) GetStatistics() map[string]interface{} {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	sinks := make([]map[string]interface{}, len(s.Sinks))
+	for i, sink := range s.Sinks {
+		stats := sink.GetStatistics()
+		stats["type"] = s.Types[i]
+		sinks[i] = stats
+	}
+	return map[string]interface{}{
+		"events": s.Recorded,
+		"failed": s.Failed,
+		"sinks":  sinks,
+	}
+}
+
+// hasStdoutSink reports whether events are streamed to stdout
+func hasStdoutSink(configs []EventSinkConfig) bool {
+	for _, config := range configs {
+		if config.Type == EventSinkStdout {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEventSinks checks each sink has what its type needs
+func validateEventSinks(configs []EventSinkConfig) error {
+	for i, config := range configs {
+		var missing string
+		switch config.Type {
+		case EventSinkFile:
+			if config.Path == "" {
+				missing = "path"
+			}
+		case EventSinkStdout:
+		case EventSinkHTTP, EventSinkOTLP:
+			if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+				missing = "http(s) url"
+			}
+		case EventSinkKafka:
+			if len(config.Brokers) == 0 {
+				missing = "brokers"
+			} else if config.Topic == "" {
+				missing = "topic"
+			}
+		default:
+			eventSinkTypesMutex.RLock()
+			_, registered := eventSinkTypes[config.Type]
+			eventSinkTypesMutex.RUnlock()
+			if !registered {
+				return NewWorkflowError(ErrorTypeConfiguration,
+					fmt.Sprintf("Event sink %d has unknown type %q: must be file, stdout, http, kafka or otlp", i+1, config.Type), nil)
+			}
+		}
+		if missing != "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("The %s event sink %d needs a %s", config.Type, i+1, missing), nil)
+		}
+		if config.BatchSize < 0 || config.FlushMs < 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Event sink %d has a negative batch_size or flush_ms", i+1), nil)
+		}
+	}
+	return nil
+}
+
+// lineSink writes each event as a line to a writer
+type lineSink struct {
+	Writer  *bufio.Writer
+	Closer  io.Closer // Closed with the sink, if set
+	Written int64
+}
+
+// newFileSink appends events to an NDJSON file
+func newFileSink(config EventSinkConfig) (EventSink, error) {
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &lineSink{Writer: bufio.NewWriter(file), Closer: file}, nil
+}
+
+// newStdoutSink writes events to the process's standard output
+func newStdoutSink(config EventSinkConfig) (EventSink, error) {
+	return &lineSink{Writer: bufio.NewWriter(eventStdout)}, nil
+}
+
+// Write writes the event's line; lines reach the file or pipe at once, so a
+// consumer tailing it sees events as they happen
+func (s *lineSink) Write(event *SinkEvent) error {
+	data, err := event.JSON()
+	if err != nil {
+		return err
+	}
+	s.Writer.Write(data)
+	s.Writer.WriteByte('\n')
+	if err := s.Writer.Flush(); err != nil {
+		return err
+	}
+	s.Written++
+	return nil
+}
+
+// Close closes the file written to
+func (s *lineSink) Close() error {
+	err := s.Writer.Flush()
+	if s.Closer != nil {
+		if closeErr := s.Closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// GetStatistics returns the events written
+func (s *lineSink) GetStatistics() map[string]interface{} {
+	return map[string]interface{}{"written": s.Written}
+}
+
+// batchSink buffers events and sends them in batches from the background
+type batchSink struct {
+	Send          func(batch [][]byte) error
+	BatchSize     int
+	FlushInterval time.Duration
+	Pending       [][]byte
+	InFlight      int // Events at the front of Pending being sent
+	Sent          int64
+	Dropped       int64 // Dropped with the buffer full or at close
+	Failures      int64 // Batches that could not be sent, and were retried
+	LastError     string
+	wake          chan struct{}
+	stop          chan struct{}
+	done          chan struct{}
+	Mutex         sync.Mutex
+}
+
+// newBatchSink starts sending batches through send
+func newBatchSink(config EventSinkConfig, send func(batch [][]byte) error) *batchSink {
+	batchSize, flushMs := config.BatchSize, config.FlushMs
+	if batchSize == 0 {
+		batchSize = defaultSinkBatchSize
+	}
+	if flushMs == 0 {
+		flushMs = defaultSinkFlushMs
+	}
+
+	s := &batchSink{
+		Send:          send,
+		BatchSize:     batchSize,
+		FlushInterval: time.Duration(flushMs) * time.Millisecond,
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write buffers the event, dropping the oldest not being sent when full
+func (s *batchSink) Write(event *SinkEvent) error {
+	data, err := event.JSON()
+	if err != nil {
+		return err
+	}
+	s.enqueue(data)
+	return nil
+}
+
+// enqueue buffers one item to send
+func (s *batchSink) enqueue(data []byte) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if len(s.Pending) >= sinkMaxBuffered && s.InFlight < len(s.Pending) {
+		s.Pending = append(s.Pending[:s.InFlight], s.Pending[s.InFlight+1:]...)
+		s.Dropped++
+	}
+	s.Pending = append(s.Pending, data)
+	if len(s.Pending) >= s.BatchSize {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run sends a batch whenever one is full or FlushInterval has passed
+func (s *batchSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		for s.flush() {
+		}
+	}
+}
+
+// flush sends one batch, and reports whether another is ready. A batch
+// that fails goes back to the front of the buffer for the next tick.
+func (s *batchSink) flush() bool {
+	s.Mutex.Lock()
+	n := min(len(s.Pending), s.BatchSize)
+	batch := append([][]byte(nil), s.Pending[:n]...)
+	s.InFlight = n
+	s.Mutex.Unlock()
+	if n == 0 {
+		return false
+	}
+
+	err := s.Send(batch)
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.InFlight = 0
+	if err != nil {
+		if s.Failures == 0 || s.LastError != err.Error() {
+			logger("sinks").Warn("Sending events failed, retrying", "error", err)
+		}
+		s.Failures++
+		s.LastError = err.Error()
+		return false
+	}
+	s.Pending = s.Pending[n:]
+	s.Sent += int64(n)
+	s.LastError = ""
+	return len(s.Pending) >= s.BatchSize
+}
+
+// Close stops the background sender and sends what is buffered, giving up
+// after sinkCloseTimeout
+func (s *batchSink) Close() error {
+	close(s.stop)
+	<-s.done
+
+	deadline := time.Now().Add(sinkCloseTimeout)
+	for time.Now().Before(deadline) {
+		s.Mutex.Lock()
+		empty := len(s.Pending) == 0
+		s.Mutex.Unlock()
+		if empty {
+			return nil
+		}
+		if !s.flush() {
+			s.Mutex.Lock()
+			failed := s.LastError != ""
+			s.Mutex.Unlock()
+			if failed {
+				break
+			}
+		}
+	}
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if len(s.Pending) == 0 {
+		return nil
+	}
+	lost := len(s.Pending)
+	s.Dropped += int64(lost)
+	s.Pending = nil
+	return fmt.Errorf("%d events could not be sent: %s", lost, s.LastError)
+}
+
+// GetStatistics returns the events sent, buffered and dropped
+func (s *batchSink) GetStatistics() map[string]interface{} {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	stats := map[string]interface{}{
+		"sent":     s.Sent,
+		"buffered": len(s.Pending),
+		"dropped":  s.Dropped,
+		"failures": s.Failures,
+	}
+	if s.LastError != "" {
+		stats["last_error"] = s.LastError
+	}
+	return stats
+}
+
+// newHTTPSink POSTs batches of events to a URL as NDJSON
+func newHTTPSink(config EventSinkConfig) (EventSink, error) {
+	client := &http.Client{Timeout: httpSinkTimeout}
+	return newBatchSink(config, func(batch [][]byte) error {
+		body := bytes.Join(batch, []byte("\n"))
+		body = append(body, '\n')
+
+		request, err := http.NewRequest(http.MethodPost, config.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/x-ndjson")
+		for name, value := range config.Headers {
+			request.Header.Set(name, value)
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		io.Copy(io.Discard, response.Body)
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			return fmt.Errorf("%s answered %s", config.URL, response.Status)
+		}
+		return nil
+	}), nil
+}
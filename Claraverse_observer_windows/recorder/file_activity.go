@@ -0,0 +1,316 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf16"
+)
+
+// File activity. With WatchFolders set, each folder (Downloads, Desktop, a
+// project...) and its subfolders are watched through ReadDirectoryChangesW,
+// and files being created, modified or renamed are recorded as
+// FileActivityEvents, so "saved report.xlsx" shows in the timeline next to
+// the clicks that caused it. Temporary files are left out, and the way
+// applications save through them is followed: a temporary file renamed to a
+// real name is reported as that file being modified when it was there
+// before, as Office does, and as created otherwise, as a finished browser
+// download is. Repeated writes to a file are reported once.
+
+const (
+	fileActivityBufferBytes = 64 << 10
+	fileActivityCoalesce    = 2 * time.Second  // Writes to a file this close together are one modification
+	fileActivityReplaced    = 10 * time.Second // How long a file renamed away counts as being replaced
+	fileActivityNotifyMask  = syscall.FILE_NOTIFY_CHANGE_FILE_NAME | syscall.FILE_NOTIFY_CHANGE_DIR_NAME |
+		syscall.FILE_NOTIFY_CHANGE_LAST_WRITE
+)
+
+// File activities
+const (
+	FileCreated  = "created"
+	FileModified = "modified"
+	FileRenamed  = "renamed"
+)
+
+// temporaryFileName matches the names applications write before a file is
+// complete: Office's ~$ owner files and hex-named temporaries, editor swap
+// and backup files, and unfinished downloads
+var temporaryFileName = regexp.MustCompile(`(?i)^~|~$|\.(tmp|temp|swp|swx|bak|crdownload|part|partial|download)$|^[0-9a-f]{8}$|^\.~lock\.`)
+
+// FileActivityEvent records a file being created, modified or renamed in a
+// watched folder
+type FileActivityEvent struct {
+	FileActivity string        `json:"file_activity"` // created, modified or renamed
+	Path         string        `json:"path"`
+	PreviousPath string        `json:"previous_path,omitempty"` // The name it was renamed from
+	Folder       string        `json:"folder"`                  // Watched folder it is in
+	Size         int64         `json:"size,omitempty"`
+	Metadata     EventMetadata `json:"metadata"`
+}
+
+// fileNotification is one change ReadDirectoryChangesW reported
+type fileNotification struct {
+	Action uint32
+	Name   string // Relative to the watched folder
+}
+
+// FileActivityWatcher follows the files of the watched folders
+type FileActivityWatcher struct {
+	Folders      []string
+	Ignored      []string             // Folders whose files are the recorder's own
+	Pending      []FileActivityEvent  // Recorded on the capture loop's next pass
+	LastModified map[string]time.Time // When each file was last reported modified
+	RenamedAway  map[string]time.Time // Files renamed to temporary names, as a save replaces them
+	RenamedFrom  map[string]string    // Old name of a rename in progress, by folder
+	Stat         func(path string) (os.FileInfo, error)
+	handles      []syscall.Handle
+	Mutex        sync.Mutex
+}
+
+// NewFileActivityWatcher starts watching the configured folders, or returns
+// nil when there are none. A folder that cannot be watched is reported and
+// left out.
+func NewFileActivityWatcher(config WorkflowRecorderConfig) *FileActivityWatcher {
+	if len(config.WatchFolders) == 0 {
+		return nil
+	}
+	watcher := newFileActivityWatcher(ownFolders(config))
+	for _, folder := range config.WatchFolders {
+		folder = expandHomeFolder(folder)
+		handle, err := openWatchedFolder(folder)
+		if err != nil {
+			printConsoleWarning(Msg(MsgFileWatchFailed, folder, err))
+			continue
+		}
+		watcher.Folders = append(watcher.Folders, folder)
+		watcher.handles = append(watcher.handles, handle)
+		go watcher.watch(folder, handle)
+	}
+	if len(watcher.handles) == 0 {
+		return nil
+	}
+	return watcher
+}
+
+// newFileActivityWatcher creates a watcher that has not opened any folders
+func newFileActivityWatcher(ignored []string) *FileActivityWatcher {
+	return &FileActivityWatcher{
+		Ignored:      ignored,
+		LastModified: make(map[string]time.Time),
+		RenamedAway:  make(map[string]time.Time),
+		RenamedFrom:  make(map[string]string),
+		Stat:         os.Stat,
+	}
+}
+
+// ownFolders returns the folders the recorder writes to itself
+func ownFolders(config WorkflowRecorderConfig) []string {
+	var folders []string
+	for _, folder := range []string{config.OutputDirectory, config.ScreenshotStore, filepath.Dir(config.LogFile)} {
+		if folder != "" && folder != "." {
+			if absolute, err := filepath.Abs(folder); err == nil {
+				folders = append(folders, absolute)
+			}
+		}
+	}
+	return folders
+}
+
+// expandHomeFolder expands a leading "~" to the user's home folder
+func expandHomeFolder(folder string) string {
+	if folder != "~" && !strings.HasPrefix(folder, `~\`) && !strings.HasPrefix(folder, "~/") {
+		return folder
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return folder
+	}
+	return filepath.Join(home, folder[1:])
+}
+
+// openWatchedFolder opens a folder for ReadDirectoryChangesW
+func openWatchedFolder(folder string) (syscall.Handle, error) {
+	path, err := syscall.UTF16PtrFromString(folder)
+	if err != nil {
+		return syscall.InvalidHandle, err
+	}
+	return syscall.CreateFile(path, syscall.FILE_LIST_DIRECTORY,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+}
+
+// watch reads a folder's changes until its handle is closed
+func (w *FileActivityWatcher) watch(folder string, handle syscall.Handle) {
+	buffer := make([]byte, fileActivityBufferBytes)
+	for {
+		var read uint32
+		err := syscall.ReadDirectoryChanges(handle, &buffer[0], uint32(len(buffer)), true, fileActivityNotifyMask, &read, nil, 0)
+		if err != nil {
+			return
+		}
+		// A read of nothing means the buffer overflowed and changes were lost
+		for _, notification := range parseFileNotifications(buffer[:read]) {
+			w.Handle(folder, notification, time.Now())
+		}
+	}
+}
+
+// parseFileNotifications reads the FILE_NOTIFY_INFORMATION records
+// ReadDirectoryChangesW wrote
+func parseFileNotifications(buffer []byte) []fileNotification {
+	const header = 12 // NextEntryOffset, Action and FileNameLength
+	var notifications []fileNotification
+	for offset := 0; offset+header <= len(buffer); {
+		record := buffer[offset:]
+		next := binary.LittleEndian.Uint32(record[0:])
+		action := binary.LittleEndian.Uint32(record[4:])
+		length := int(binary.LittleEndian.Uint32(record[8:]))
+		if header+length > len(record) {
+			break
+		}
+		name := make([]uint16, length/2)
+		for i := range name {
+			name[i] = binary.LittleEndian.Uint16(record[header+2*i:])
+		}
+		notifications = append(notifications, fileNotification{Action: action, Name: string(utf16.Decode(name))})
+		if next == 0 {
+			break
+		}
+		offset += int(next)
+	}
+	return notifications
+}
+
+// Handle turns a change in folder into a pending event, as of now
+func (w *FileActivityWatcher) Handle(folder string, notification fileNotification, now time.Time) {
+	path := filepath.Join(folder, notification.Name)
+	if w.isIgnored(path) {
+		return
+	}
+
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	temporary := temporaryFileName.MatchString(filepath.Base(path))
+	event := FileActivityEvent{Path: path, Folder: folder}
+	switch notification.Action {
+	case syscall.FILE_ACTION_ADDED:
+		if temporary {
+			return
+		}
+		event.FileActivity = FileCreated
+
+	case syscall.FILE_ACTION_MODIFIED:
+		if temporary || now.Sub(w.LastModified[path]) < fileActivityCoalesce {
+			return
+		}
+		if info, err := w.Stat(path); err != nil || info.IsDir() {
+			return
+		}
+		event.FileActivity = FileModified
+
+	case syscall.FILE_ACTION_RENAMED_OLD_NAME:
+		w.RenamedFrom[folder] = path
+		return
+
+	case syscall.FILE_ACTION_RENAMED_NEW_NAME:
+		previous := w.RenamedFrom[folder]
+		delete(w.RenamedFrom, folder)
+		previousTemporary := previous != "" && temporaryFileName.MatchString(filepath.Base(previous))
+		switch {
+		case temporary && previous != "" && !previousTemporary:
+			// Moved aside while a save writes its replacement
+			w.RenamedAway[previous] = now
+			return
+		case temporary:
+			return
+		case previousTemporary && now.Sub(w.RenamedAway[path]) < fileActivityReplaced:
+			delete(w.RenamedAway, path)
+			event.FileActivity = FileModified
+		case previousTemporary || previous == "":
+			event.FileActivity = FileCreated
+		default:
+			event.FileActivity, event.PreviousPath = FileRenamed, previous
+		}
+
+	default:
+		// Deletions are left out; saves delete their temporary files
+		return
+	}
+
+	// Writes just after a file appears are part of creating it
+	w.LastModified[path] = now
+	if info, err := w.Stat(path); err == nil && !info.IsDir() {
+		event.Size = info.Size()
+	}
+	event.Metadata = EventMetadata{Timestamp: uint64(now.UnixMilli())}
+	w.Pending = append(w.Pending, event)
+}
+
+// isIgnored reports whether a path is in one of the recorder's own folders
+func (w *FileActivityWatcher) isIgnored(path string) bool {
+	for _, folder := range w.Ignored {
+		if relative, err := filepath.Rel(folder, path); err == nil && relative != ".." &&
+			!strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Drain returns the file changes since the last call, in order, stamped
+// with the window in front now
+func (w *FileActivityWatcher) Drain() []WorkflowEvent {
+	if w == nil {
+		return nil
+	}
+	w.Mutex.Lock()
+	pending := w.Pending
+	w.Pending = nil
+	w.Mutex.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].Metadata.Timestamp < pending[j].Metadata.Timestamp })
+	element := getCurrentUIElement()
+	events := make([]WorkflowEvent, len(pending))
+	for i, event := range pending {
+		event.Metadata.UIElement = element
+		events[i] = event
+	}
+	return events
+}
+
+// Close stops watching the folders
+func (w *FileActivityWatcher) Close() {
+	if w == nil {
+		return
+	}
+	for _, handle := range w.handles {
+		syscall.CancelIoEx(handle, nil)
+		syscall.CloseHandle(handle)
+	}
+	w.handles = nil
+}
+
+// describeFileActivity describes a file change in a recording's steps
+func describeFileActivity(activity, path, previousPath string, quote func(string) string) string {
+	switch activity {
+	case FileCreated:
+		return "Created file " + quote(filepath.Base(path))
+	case FileModified:
+		return "Saved file " + quote(filepath.Base(path))
+	case FileRenamed:
+		return fmt.Sprintf("Renamed file %s to %s", quote(filepath.Base(previousPath)), quote(filepath.Base(path)))
+	default:
+		return "Changed file " + quote(filepath.Base(path))
+	}
+}
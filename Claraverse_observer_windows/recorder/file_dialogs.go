@@ -0,0 +1,165 @@
+package recorder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// File dialogs. While a standard Open or Save As dialog is open, the dialog
+// watcher follows its file name box, its file type filter and the folder in
+// its address bar as they change, through a second hook on the dialog's
+// process; once the dialog closes its controls can no longer be read. When
+// it closes on its Open or Save button, on Enter, or on a double click on a
+// file, a FileDialogEvent follows its DialogEvent with the full path of each
+// file chosen and the filter, so a recording names the exact files rather
+// than clicks on a list. Names are as typed or selected: a Save As dialog
+// may still add the filter's extension, and in a library or other folder
+// without a path only the names are known.
+
+const (
+	EVENT_OBJECT_NAMECHANGE  = 0x800C
+	EVENT_OBJECT_VALUECHANGE = 0x800E
+	WM_GETTEXT               = 0x000D
+	IDOK                     = 1
+	fileDialogNameComboID    = 0x047C // cmb13, the file name box
+	fileDialogNameEditID     = 0x0480 // edt1, the file name box of older dialogs
+	fileDialogFilterID       = 0x0470 // cmb1, the file type filter
+	controlTextTimeoutMs     = 200
+)
+
+var (
+	// fileDialogFolderPattern finds the path in an address bar's text,
+	// "Address: C:\Users\me\Documents"
+	fileDialogFolderPattern = regexp.MustCompile(`[A-Za-z]:\\.*|\\\\.*`)
+	// absolutePathPattern matches a name typed as a full path
+	absolutePathPattern = regexp.MustCompile(`^([A-Za-z]:\\|\\\\)`)
+	// fileDialogNamePattern finds each of several quoted file names
+	fileDialogNamePattern = regexp.MustCompile(`"([^"]+)"`)
+)
+
+// FileDialogEvent records the files chosen in an Open or Save As dialog
+type FileDialogEvent struct {
+	FileDialog  string        `json:"file_dialog"` // The dialog's title, e.g. Save As
+	Paths       []string      `json:"paths"`
+	Filter      string        `json:"filter,omitempty"` // The file type chosen, e.g. Text Documents (*.txt)
+	Folder      string        `json:"folder,omitempty"`
+	Application string        `json:"application"`
+	Metadata    EventMetadata `json:"metadata"`
+}
+
+// fileDialogFields is what a file dialog's fields show
+type fileDialogFields struct {
+	Folder string
+	Name   string // As typed: one name, or several quoted
+	Filter string
+	View   [4]int32 // The folder view's x, y, width and height on screen
+}
+
+// readFileDialogFields reads the fields of a file dialog from its controls
+func readFileDialogFields(children []dialogChild) fileDialogFields {
+	var fields fileDialogFields
+	for _, child := range children {
+		switch {
+		case (child.ID == fileDialogNameComboID || child.ID == fileDialogNameEditID) && fields.Name == "":
+			fields.Name = child.Text
+		case child.ID == fileDialogFilterID && strings.Contains(child.Class, "ComboBox"):
+			fields.Filter = child.Text
+		case child.Class == "ToolbarWindow32" && fields.Folder == "":
+			fields.Folder = strings.TrimSpace(fileDialogFolderPattern.FindString(child.Text))
+		case child.Class == "SHELLDLL_DefView":
+			fields.View = child.Rect
+		}
+	}
+	return fields
+}
+
+// update takes the fields read from a dialog. The folder, filter and view
+// are kept when a read misses them; the name box may be emptied.
+func (f *fileDialogFields) update(read fileDialogFields) {
+	f.Name = read.Name
+	if read.Folder != "" {
+		f.Folder = read.Folder
+	}
+	if read.Filter != "" {
+		f.Filter = read.Filter
+	}
+	if read.View != ([4]int32{}) {
+		f.View = read.View
+	}
+}
+
+// Paths returns the full path of each file named, joined to the folder
+func (f fileDialogFields) Paths() []string {
+	names := []string{strings.TrimSpace(f.Name)}
+	if matches := fileDialogNamePattern.FindAllStringSubmatch(f.Name, -1); len(matches) > 0 {
+		names = names[:0]
+		for _, match := range matches {
+			names = append(names, match[1])
+		}
+	}
+
+	var paths []string
+	for _, name := range names {
+		switch {
+		case name == "":
+			continue
+		case f.Folder == "" || absolutePathPattern.MatchString(name):
+			paths = append(paths, name)
+		default:
+			paths = append(paths, strings.TrimSuffix(f.Folder, `\`)+`\`+name)
+		}
+	}
+	return paths
+}
+
+// fileChosen reports whether a file dialog closed on its files being chosen:
+// on its OK button, Open or Save, on Enter with no other button default, or
+// on a double click in its folder view
+func fileChosen(fields fileDialogFields, button dialogButton, key string, pointer Position) bool {
+	if button.Label != "" || key != "" {
+		return button.ID == IDOK || (key == "Enter" && button.Label == "")
+	}
+	r := fields.View
+	return pointer.X >= r[0] && pointer.X < r[0]+r[2] && pointer.Y >= r[1] && pointer.Y < r[1]+r[3]
+}
+
+// describeFileDialog describes the files chosen in a file dialog in a
+// recording's steps
+func describeFileDialog(title string, paths []string, filter string, quote func(string) string) string {
+	quoted := make([]string, len(paths))
+	for i, path := range paths {
+		quoted[i] = quote(path)
+	}
+	description := fmt.Sprintf("Chose %s in %s", strings.Join(quoted, ", "), quote(title))
+	if filter != "" {
+		description += " as " + filter
+	}
+	return description
+}
+
+// fileDialogControl reports whether hwnd is of a class that holds one of a
+// file dialog's fields
+func fileDialogControl(hwnd uintptr) bool {
+	switch getWindowClassName(hwnd) {
+	case "Edit", "ComboBox", "ComboBoxEx32", "ToolbarWindow32":
+		return true
+	}
+	return false
+}
+
+// controlText reads a window's text. GetWindowText only reads the captions
+// of another process's windows, not what is typed in its edit boxes; a
+// window that does not answer in time reads as empty.
+func controlText(hwnd uintptr) string {
+	textBuf := make([]uint16, 1024)
+	var copied uintptr
+	ret, _, _ := procSendMessageTimeout.Call(hwnd, WM_GETTEXT, uintptr(len(textBuf)), uintptr(unsafe.Pointer(&textBuf[0])),
+		SMTO_ABORTIFHUNG, controlTextTimeoutMs, uintptr(unsafe.Pointer(&copied)))
+	if ret == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(textBuf)
+}
@@ -0,0 +1,169 @@
+package recorder
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Focus changes. With RecordFocusChanges set, a WinEvent hook on a thread of
+// its own sees keyboard focus move from control to control in every
+// application, and a FocusChangedEvent is recorded each time with the role
+// and name UI Automation gives the newly focused element, so a recording
+// shows which field was tabbed or clicked into before text was typed there,
+// not only which application was in front. Focus moving within a menu is
+// left to the menu selections, and focus returning to the element that had
+// it is not recorded again.
+
+var (
+	focusCallback  uintptr
+	focusCallbacks sync.Once
+	activeFocus    *FocusWatcher // Receives the hook's events
+)
+
+// FocusChangedEvent records keyboard focus moving to an element
+type FocusChangedEvent struct {
+	FocusRole    string        `json:"focus_role"` // The element's control type, e.g. edit
+	FocusName    string        `json:"focus_name"`
+	AutomationID string        `json:"automation_id,omitempty"`
+	Application  string        `json:"application"`
+	WindowTitle  string        `json:"window_title"`
+	Metadata     EventMetadata `json:"metadata"` // The element, with its bounds
+}
+
+// FocusWatcher records keyboard focus moving between elements
+type FocusWatcher struct {
+	Last   FocusChangedEvent      // The element last focused
+	Config WorkflowRecorderConfig // The recording's, whose ignore lists apply
+	Events []WorkflowEvent
+	hook   winEventHook
+	Mutex  sync.Mutex
+}
+
+// NewFocusWatcher creates a watcher and starts its hook, or returns nil when
+// RecordFocusChanges is off or the hook cannot be set
+func NewFocusWatcher(config WorkflowRecorderConfig) *FocusWatcher {
+	if !config.RecordFocusChanges {
+		return nil
+	}
+	watcher := &FocusWatcher{Config: config}
+	if err := watcher.start(); err != nil {
+		printConsoleWarning(Msg(MsgFocusChangesUnavailable, err))
+		return nil
+	}
+	return watcher
+}
+
+// Focused records focus moving to element, whose automation ID is
+// automationID, unless it is the element already focused
+func (f *FocusWatcher) Focused(element UIElement, automationID string, now time.Time) {
+	f.Mutex.Lock()
+	defer f.Mutex.Unlock()
+
+	event := FocusChangedEvent{
+		FocusRole:    element.Role,
+		FocusName:    element.Name,
+		AutomationID: automationID,
+		Application:  element.ApplicationName,
+		WindowTitle:  element.WindowTitle,
+	}
+	if event == f.Last {
+		return
+	}
+	f.Last = event
+	event.Metadata = EventMetadata{UIElement: &element, Timestamp: uint64(now.UnixMilli())}
+	f.Events = append(f.Events, event)
+}
+
+// Drain returns the changes recorded since the last call
+func (f *FocusWatcher) Drain() []WorkflowEvent {
+	if f == nil {
+		return nil
+	}
+	f.Mutex.Lock()
+	defer f.Mutex.Unlock()
+
+	events := f.Events
+	f.Events = nil
+	return events
+}
+
+// describeFocusChange describes focus moving to an element in a recording's
+// steps
+func describeFocusChange(role, name, application string, quote func(string) string) string {
+	description := "Focused " + role
+	if name != "" {
+		description += " " + quote(name)
+	}
+	if application != "" {
+		description += " in " + application
+	}
+	return description
+}
+
+// focusedElement reads the element with keyboard focus, in the window in
+// front, and its automation ID. Menu items are not returned.
+func focusedElement() (UIElement, string, bool) {
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return UIElement{}, "", false
+	}
+	defer client.Close()
+
+	element, err := client.FocusedElement()
+	if err != nil {
+		return UIElement{}, "", false
+	}
+	defer element.Release()
+
+	controlType := elementControlType(element)
+	if controlType == uiaMenuItemControlType {
+		return UIElement{}, "", false
+	}
+	title, processID := getCurrentWindow()
+	focused := UIElement{
+		Role:            strings.ToLower(controlTypeName(controlType)),
+		Name:            strings.TrimSpace(elementString(element, vtblElementGetCurrentName)),
+		ProcessID:       processID,
+		WindowTitle:     title,
+		ApplicationName: applicationName(processID, title),
+	}
+	if bounds, ok := elementBounds(element); ok {
+		focused.Bounds = [4]float64{float64(bounds.Left), float64(bounds.Top),
+			float64(bounds.Right - bounds.Left), float64(bounds.Bottom - bounds.Top)}
+	}
+	return focused, elementString(element, vtblElementGetCurrentAutomationId), focused.Role != ""
+}
+
+// start runs the hook on a thread of its own, whose message loop delivers
+// its events, and returns once it is set
+func (f *FocusWatcher) start() error {
+	focusCallbacks.Do(func() {
+		focusCallback = syscall.NewCallback(focusEventProc)
+	})
+	ranges := []winEventRange{{EVENT_OBJECT_FOCUS, EVENT_OBJECT_FOCUS}}
+	return f.hook.start(focusCallback, ranges, func() { activeFocus = f }, nil)
+}
+
+// Close removes the hook and ends its thread
+func (f *FocusWatcher) Close() {
+	if f == nil {
+		return
+	}
+	f.hook.Close()
+}
+
+// focusEventProc receives the hook's events on its thread
+func focusEventProc(hook, event, hwnd, idObject, idChild, thread, eventTime uintptr) uintptr {
+	f := activeFocus
+	if f == nil || event != EVENT_OBJECT_FOCUS {
+		return 0
+	}
+	element, automationID, ok := focusedElement()
+	if !ok || shouldIgnoreApplication(f.Config, element.ApplicationName, element.WindowTitle) {
+		return 0
+	}
+	f.Focused(element, automationID, time.Now())
+	return 0
+}
@@ -0,0 +1,259 @@
+package recorder
+
+import (
+	"errors"
+	"image"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Fullscreen applications. Games and players that take the display over in
+// exclusive fullscreen bypass the composed desktop, so GDI screenshots of
+// them come out black, and hide and pin the cursor, so mouse moves mean
+// nothing. While one is in front, screenshots are taken through desktop
+// duplication (as they are whenever GDI returns a black frame) and mouse
+// moves are not recorded. A FullscreenChangedEvent marks where each
+// fullscreen stretch starts and ends, and the task segments within one are
+// tagged with its mode.
+
+var (
+	procSHQueryUserNotificationState = shell32.NewProc("SHQueryUserNotificationState")
+	procGetWindowRect                = user32.NewProc("GetWindowRect")
+)
+
+const (
+	QUNS_RUNNING_D3D_FULL_SCREEN = 3
+	MONITOR_DEFAULTTONEAREST     = 2
+
+	fullscreenCheckInterval = 500 * time.Millisecond
+)
+
+// FullscreenMode is how the foreground window fills its display
+type FullscreenMode string
+
+const (
+	FullscreenNone       FullscreenMode = ""
+	FullscreenBorderless FullscreenMode = "borderless" // A window covering the display; captured as usual
+	FullscreenExclusive  FullscreenMode = "exclusive"  // Direct3D owns the display
+)
+
+// duplicationRetryInterval spaces attempts at desktop duplication after one
+// fails, as each attempt creates a Direct3D device
+const duplicationRetryInterval = 5 * time.Second
+
+// FullscreenChangedEvent marks where the foreground window went fullscreen
+// or left it
+type FullscreenChangedEvent struct {
+	Fullscreen    FullscreenMode `json:"fullscreen"` // Empty when fullscreen ended
+	Application   string         `json:"application"`
+	CaptureMethod string         `json:"capture_method"` // How screenshots are taken from here on
+	Metadata      EventMetadata  `json:"metadata"`
+}
+
+// FullscreenMonitor follows whether the foreground window is fullscreen
+type FullscreenMonitor struct {
+	Mode          FullscreenMode
+	LastCheck     time.Time
+	Detect        func() FullscreenMode // Reads the foreground window's mode
+	CaptureMethod string                // The configured ScreenshotCaptureMethod
+	Mutex         sync.Mutex
+}
+
+// NewFullscreenMonitor creates a monitor of the foreground window
+func NewFullscreenMonitor(config WorkflowRecorderConfig) *FullscreenMonitor {
+	return &FullscreenMonitor{Detect: foregroundFullscreenMode, CaptureMethod: config.ScreenshotCaptureMethod}
+}
+
+// Update checks the foreground window, at most every
+// fullscreenCheckInterval, and returns an event when its mode has changed
+func (fm *FullscreenMonitor) Update(element *UIElement, now time.Time) *FullscreenChangedEvent {
+	fm.Mutex.Lock()
+	defer fm.Mutex.Unlock()
+
+	if now.Sub(fm.LastCheck) < fullscreenCheckInterval {
+		return nil
+	}
+	fm.LastCheck = now
+
+	mode := fm.Detect()
+	if mode == fm.Mode {
+		return nil
+	}
+	fm.Mode = mode
+
+	focused := *element
+	return &FullscreenChangedEvent{
+		Fullscreen:    mode,
+		Application:   element.ApplicationName,
+		CaptureMethod: fullscreenCaptureMethod(fm.CaptureMethod, mode),
+		Metadata:      EventMetadata{UIElement: &focused, Timestamp: uint64(now.UnixMilli())},
+	}
+}
+
+// fullscreenCaptureMethod returns how screenshots are taken with the
+// configured method while the foreground window is in mode
+func fullscreenCaptureMethod(configured string, mode FullscreenMode) string {
+	switch configured {
+	case CaptureMethodGDI, CaptureMethodDesktopDuplication:
+		return configured
+	}
+	if mode == FullscreenExclusive {
+		return CaptureMethodDesktopDuplication
+	}
+	return CaptureMethodGDI
+}
+
+// GetMode returns the mode seen at the last check
+func (fm *FullscreenMonitor) GetMode() FullscreenMode {
+	fm.Mutex.Lock()
+	defer fm.Mutex.Unlock()
+
+	return fm.Mode
+}
+
+// HandleFullscreen follows the foreground window in and out of fullscreen
+func (ct *CaptureTrackers) HandleFullscreen(element *UIElement) {
+	if event := ct.Fullscreen.Update(element, time.Now()); event != nil {
+		ct.enqueue(*event)
+	}
+}
+
+// fullscreenMode returns the mode of the foreground window in the recording
+// in progress
+func (r *Recorder) fullscreenMode() FullscreenMode {
+	r.Mutex.RLock()
+	trackers := r.Trackers
+	r.Mutex.RUnlock()
+	if trackers != nil && trackers.Fullscreen != nil {
+		return trackers.Fullscreen.GetMode()
+	}
+	return FullscreenNone
+}
+
+// fullscreenConfig returns config without mouse moves while a fullscreen
+// exclusive application, the foreground window being in mode, is in front
+func fullscreenConfig(config WorkflowRecorderConfig, mode FullscreenMode) WorkflowRecorderConfig {
+	if mode == FullscreenExclusive {
+		config.FilterMouseNoise = true
+	}
+	return config
+}
+
+// foregroundFullscreenMode reads how the foreground window fills its display
+func foregroundFullscreenMode() FullscreenMode {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		return FullscreenNone
+	}
+	// The desktop itself covers the display
+	switch getWindowClassName(hwnd) {
+	case "Progman", "WorkerW", "Shell_TrayWnd":
+		return FullscreenNone
+	}
+
+	var state uint32
+	if hr, _, _ := procSHQueryUserNotificationState.Call(uintptr(unsafe.Pointer(&state))); !failedHRESULT(hr) &&
+		state == QUNS_RUNNING_D3D_FULL_SCREEN {
+		return FullscreenExclusive
+	}
+
+	var window RECT
+	if ret, _, _ := procGetWindowRect.Call(hwnd, uintptr(unsafe.Pointer(&window))); ret == 0 {
+		return FullscreenNone
+	}
+	monitor, _, _ := procMonitorFromWindow.Call(hwnd, MONITOR_DEFAULTTONEAREST)
+	var info MONITORINFO
+	info.cbSize = uint32(unsafe.Sizeof(info))
+	if ret, _, _ := procGetMonitorInfo.Call(monitor, uintptr(unsafe.Pointer(&info))); ret == 0 {
+		return FullscreenNone
+	}
+	return fullscreenModeOf(window, info.rcMonitor)
+}
+
+// fullscreenModeOf reports a window covering its whole display as borderless
+// fullscreen
+func fullscreenModeOf(window, display RECT) FullscreenMode {
+	if window.Left <= display.Left && window.Top <= display.Top &&
+		window.Right >= display.Right && window.Bottom >= display.Bottom {
+		return FullscreenBorderless
+	}
+	return FullscreenNone
+}
+
+// describeFullscreen describes a change of fullscreen mode
+func describeFullscreen(mode, application string) string {
+	if mode == string(FullscreenNone) {
+		return "Left fullscreen"
+	}
+	description := "Entered " + mode + " fullscreen"
+	if application != "" {
+		description += " in " + application
+	}
+	return description
+}
+
+// captureScreen takes a frame of bounds through the configured capture
+// method. With "auto" that is GDI, or desktop duplication while a fullscreen
+// exclusive application is in front or when GDI returns a black frame; with
+// "desktop_duplication", GDI only when duplication fails. It returns the
+// method that took the frame and whether protected content was masked out.
+func (ss *ScreenshotService) captureScreen(bounds image.Rectangle) (*image.RGBA, string, bool, error) {
+	switch ss.recorder.currentConfig().ScreenshotCaptureMethod {
+	case CaptureMethodGDI:
+		img, err := ss.Capturer.Capture(bounds)
+		return img, CaptureMethodGDI, false, err
+	case CaptureMethodDesktopDuplication:
+		if img, protected, err := ss.duplicate(bounds, true); err == nil {
+			return img, CaptureMethodDesktopDuplication, protected, nil
+		}
+		img, err := ss.Capturer.Capture(bounds)
+		return img, CaptureMethodGDI, false, err
+	}
+
+	exclusive := ss.recorder.fullscreenMode() == FullscreenExclusive
+	var gdiFrame *image.RGBA
+	if !exclusive {
+		img, err := ss.Capturer.Capture(bounds)
+		if err != nil || !isBlankImage(img) {
+			return img, CaptureMethodGDI, false, err
+		}
+		gdiFrame = img
+	}
+
+	if img, protected, err := ss.duplicate(bounds, exclusive); err == nil {
+		if gdiFrame != nil {
+			releaseFrameBuffer(gdiFrame)
+		}
+		return img, CaptureMethodDesktopDuplication, protected, nil
+	}
+
+	if gdiFrame != nil {
+		return gdiFrame, CaptureMethodGDI, false, nil
+	}
+	img, err := ss.Capturer.Capture(bounds)
+	return img, CaptureMethodGDI, false, err
+}
+
+// duplicate captures bounds through desktop duplication, unless it failed
+// within the last duplicationRetryInterval. The first failure is logged
+// when report is set.
+func (ss *ScreenshotService) duplicate(bounds image.Rectangle, report bool) (*image.RGBA, bool, error) {
+	now := time.Now()
+	ss.Mutex.Lock()
+	failing, retryAt := ss.DuplicationFailing, ss.DuplicationRetryAt
+	ss.Mutex.Unlock()
+	if failing && now.Before(retryAt) {
+		return nil, false, errors.New("desktop duplication failed recently")
+	}
+
+	img, protected, err := ss.Duplicator.Capture(bounds)
+	ss.Mutex.Lock()
+	ss.DuplicationFailing = err != nil
+	ss.DuplicationRetryAt = now.Add(duplicationRetryInterval)
+	ss.Mutex.Unlock()
+	if err != nil && report && !failing {
+		logger("screenshots").Warn("Desktop duplication failed, capturing through GDI", "error", err)
+	}
+	return img, protected, err
+}
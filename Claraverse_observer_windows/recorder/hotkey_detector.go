@@ -0,0 +1,581 @@
+package recorder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HotkeyPattern represents a known hotkey combination
+type HotkeyPattern struct {
+	Keys        []uint32
+	Combination string
+	Action      string
+	IsGlobal    bool
+	Category    string
+}
+
+// HotkeyChord is a sequence of combinations pressed one after another, such
+// as VS Code's Ctrl+K Ctrl+C
+type HotkeyChord struct {
+	Steps        [][]uint32
+	Combination  string // e.g. "Ctrl+K Ctrl+C"
+	Action       string
+	Category     string
+	Applications []string // Process names it applies in; empty for all
+}
+
+// customHotkeyPattern is a custom hotkey's pattern and the applications it
+// applies in
+type customHotkeyPattern struct {
+	HotkeyPattern
+	Applications []string
+}
+
+// HotkeyActionUnknown is the action of a combination no pattern names
+const HotkeyActionUnknown = "Unknown"
+
+// defaultChordTimeout is how long a chord waits for its next combination
+const defaultChordTimeout = 1500 * time.Millisecond
+
+// HotkeyDetector tracks pressed keys and detects hotkey combinations. A
+// combination is the modifiers held when another key goes down, so
+// modifiers are pressed first and can stay held for the next combination.
+// A combination that starts a chord is held back until the chord is
+// finished, broken or times out; one no pattern names is reported with
+// the action HotkeyActionUnknown.
+type HotkeyDetector struct {
+	PressedKeys    map[uint32]bool
+	KeyPressOrder  []uint32
+	LastKeyTime    time.Time
+	HotkeyPatterns []HotkeyPattern
+	CustomPatterns []customHotkeyPattern // Checked before HotkeyPatterns
+	Chords         []HotkeyChord
+	Application    string // Process name of the application in front
+	EventCallback  func(HotkeyEvent)
+	ChordTimeout   time.Duration
+	ChordSteps     [][]uint32   // Combinations of the chord in progress
+	ChordHeld      *HotkeyEvent // The chord's first combination, reported if the chord is not finished
+	chordTimer     *time.Timer
+	Mutex          sync.RWMutex
+}
+
+// NewHotkeyDetector creates a new hotkey detector
+func NewHotkeyDetector(callback func(HotkeyEvent)) *HotkeyDetector {
+	detector := &HotkeyDetector{
+		PressedKeys:    make(map[uint32]bool),
+		KeyPressOrder:  make([]uint32, 0),
+		HotkeyPatterns: initializeHotkeyPatterns(),
+		Chords:         initializeHotkeyChords(),
+		EventCallback:  callback,
+		ChordTimeout:   defaultChordTimeout,
+	}
+
+	return detector
+}
+
+// HandleKeyPress processes a key press event
+func (hd *HotkeyDetector) HandleKeyPress(keyCode uint32, isKeyDown bool) {
+	hd.Mutex.Lock()
+	defer hd.Mutex.Unlock()
+
+	if keyCode == VK_RWIN {
+		keyCode = VK_LWIN // Patterns are written with the left Windows key
+	}
+
+	if isKeyDown {
+		// Key pressed down
+		if !hd.PressedKeys[keyCode] {
+			hd.PressedKeys[keyCode] = true
+			hd.KeyPressOrder = append(hd.KeyPressOrder, keyCode)
+			hd.LastKeyTime = time.Now()
+
+			// A combination is complete when a key other than a modifier goes down
+			if !hd.isModifierKey(keyCode) {
+				hd.checkForHotkeys(keyCode)
+			}
+		}
+	} else {
+		// Key released
+		if hd.PressedKeys[keyCode] {
+			delete(hd.PressedKeys, keyCode)
+
+			// Remove from press order
+			for i, k := range hd.KeyPressOrder {
+				if k == keyCode {
+					hd.KeyPressOrder = append(hd.KeyPressOrder[:i], hd.KeyPressOrder[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+// checkForHotkeys checks the combination of the held modifiers and key
+// against the known patterns and chords
+func (hd *HotkeyDetector) checkForHotkeys(key uint32) {
+	combination := []uint32{key}
+	for pressed := range hd.PressedKeys {
+		if pressed != key && hd.isModifierKey(pressed) {
+			combination = append(combination, pressed)
+		}
+	}
+	if len(combination) < 2 {
+		return // Hotkeys need at least 2 keys
+	}
+	sort.Slice(combination, func(i, j int) bool { return combination[i] < combination[j] })
+	event := hd.match(combination)
+
+	// A chord in progress is finished, continued or broken
+	if len(hd.ChordSteps) > 0 {
+		steps := append(append([][]uint32{}, hd.ChordSteps...), combination)
+		if chord := hd.findChord(steps, true); chord != nil {
+			hd.endChord()
+			hd.send(HotkeyEvent{
+				Combination: chord.Combination,
+				Action:      chord.Action,
+				Metadata:    createEventMetadata(),
+			})
+			return
+		}
+		if hd.findChord(steps, false) != nil {
+			hd.ChordSteps = steps
+			hd.chordTimer.Reset(hd.ChordTimeout)
+			return
+		}
+		hd.flushChord()
+	}
+
+	if hd.findChord([][]uint32{combination}, false) != nil {
+		hd.ChordSteps, hd.ChordHeld = [][]uint32{combination}, event
+		hd.startChordTimer()
+		return
+	}
+	if event != nil {
+		hd.send(*event)
+	}
+}
+
+// match returns the event of a combination: its pattern's, the custom
+// patterns for the application in front first, or an unknown one. It
+// returns nil for keys that are not a hotkey, such as Shift and a letter.
+func (hd *HotkeyDetector) match(combination []uint32) *HotkeyEvent {
+	pattern, ok := HotkeyPattern{}, false
+	for _, custom := range hd.CustomPatterns {
+		if appliesIn(custom.Applications, hd.Application) && hd.keysMatch(combination, custom.Keys) {
+			pattern, ok = custom.HotkeyPattern, true
+			break
+		}
+	}
+	for i := 0; !ok && i < len(hd.HotkeyPatterns); i++ {
+		if hd.keysMatch(combination, hd.HotkeyPatterns[i].Keys) {
+			pattern, ok = hd.HotkeyPatterns[i], true
+		}
+	}
+	if !ok {
+		if !isUnknownHotkey(combination) {
+			return nil
+		}
+		pattern = HotkeyPattern{Combination: formatKeyCombination(combination), Action: HotkeyActionUnknown}
+	}
+	return &HotkeyEvent{
+		Combination: pattern.Combination,
+		Action:      pattern.Action,
+		IsGlobal:    pattern.IsGlobal,
+		Metadata:    createEventMetadata(),
+	}
+}
+
+// isUnknownHotkey reports whether a combination no pattern names is still a
+// hotkey: it needs Ctrl, Alt or Win. Ctrl+Alt with a character key is left
+// out, as that is AltGr typing a character on many layouts.
+func isUnknownHotkey(combination []uint32) bool {
+	var ctrl, alt, win bool
+	var key uint32
+	for _, code := range combination {
+		switch code {
+		case VK_CONTROL:
+			ctrl = true
+		case VK_MENU:
+			alt = true
+		case VK_LWIN:
+			win = true
+		case VK_SHIFT:
+		default:
+			key = code
+		}
+	}
+	if ctrl && alt && !win && keyCharacter(key, ModifierStates{}, false) != "" {
+		return false
+	}
+	return ctrl || alt || win
+}
+
+// formatKeyCombination writes a combination as patterns are written,
+// modifiers first, e.g. "Ctrl+Shift+Q"
+func formatKeyCombination(combination []uint32) string {
+	var parts, keys []string
+	for _, modifier := range []uint32{VK_CONTROL, VK_MENU, VK_SHIFT, VK_LWIN} {
+		for _, code := range combination {
+			if code == modifier {
+				parts = append(parts, keyNames[code])
+			}
+		}
+	}
+	for _, code := range combination {
+		switch code {
+		case VK_CONTROL, VK_MENU, VK_SHIFT, VK_LWIN:
+		default:
+			keys = append(keys, chordKeyName(code))
+		}
+	}
+	return strings.Join(append(parts, keys...), "+")
+}
+
+// findChord returns a chord for the application in front that steps are,
+// or with exact unset, that steps begin without finishing
+func (hd *HotkeyDetector) findChord(steps [][]uint32, exact bool) *HotkeyChord {
+	for i, chord := range hd.Chords {
+		if !appliesIn(chord.Applications, hd.Application) || len(chord.Steps) < len(steps) ||
+			exact != (len(chord.Steps) == len(steps)) {
+			continue
+		}
+		matched := true
+		for j, step := range steps {
+			matched = matched && hd.keysMatch(step, chord.Steps[j])
+		}
+		if matched {
+			return &hd.Chords[i]
+		}
+	}
+	return nil
+}
+
+// startChordTimer reports the held combination if the chord is not
+// finished in time
+func (hd *HotkeyDetector) startChordTimer() {
+	var timer *time.Timer
+	timer = time.AfterFunc(hd.ChordTimeout, func() {
+		hd.Mutex.Lock()
+		defer hd.Mutex.Unlock()
+
+		if hd.chordTimer == timer {
+			hd.flushChord()
+		}
+	})
+	hd.chordTimer = timer
+}
+
+// flushChord gives up on the chord in progress, reporting the combination
+// that started it
+func (hd *HotkeyDetector) flushChord() {
+	held := hd.ChordHeld
+	hd.endChord()
+	if held != nil {
+		hd.send(*held)
+	}
+}
+
+// endChord forgets the chord in progress
+func (hd *HotkeyDetector) endChord() {
+	if hd.chordTimer != nil {
+		hd.chordTimer.Stop()
+		hd.chordTimer = nil
+	}
+	hd.ChordSteps, hd.ChordHeld = nil, nil
+}
+
+// send reports an event
+func (hd *HotkeyDetector) send(event HotkeyEvent) {
+	if hd.EventCallback != nil {
+		go hd.EventCallback(event)
+	}
+}
+
+// SetApplication notes the application in front, for the custom patterns
+// and chords that apply only in some
+func (hd *HotkeyDetector) SetApplication(application string) {
+	hd.Mutex.Lock()
+	defer hd.Mutex.Unlock()
+
+	hd.Application = application
+}
+
+// appliesIn reports whether a pattern for applications applies in one
+func appliesIn(applications []string, application string) bool {
+	if len(applications) == 0 {
+		return true
+	}
+	for _, name := range applications {
+		if strings.EqualFold(name, application) {
+			return true
+		}
+	}
+	return false
+}
+
+// customHotkeyPatterns turns the config file's custom hotkeys into patterns
+// and chords
+func customHotkeyPatterns(hotkeys []CustomHotkey) ([]customHotkeyPattern, []HotkeyChord, error) {
+	var patterns []customHotkeyPattern
+	var chords []HotkeyChord
+	for i, hotkey := range hotkeys {
+		if strings.TrimSpace(hotkey.Action) == "" {
+			return nil, nil, NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Custom hotkey %d (%q) has no action", i+1, hotkey.Keys), nil)
+		}
+		var steps [][]uint32
+		for _, step := range strings.Fields(hotkey.Keys) {
+			keys, err := parseKeyCombination(step)
+			if err != nil {
+				return nil, nil, err
+			}
+			steps = append(steps, keys)
+		}
+		if len(steps) == 0 {
+			return nil, nil, NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Custom hotkey %d (%s) has no keys", i+1, hotkey.Action), nil)
+		}
+
+		label, category := hotkey.Label, hotkey.Category
+		if label == "" {
+			label = strings.Join(strings.Fields(hotkey.Keys), " ")
+		}
+		if category == "" {
+			category = "Custom"
+		}
+		if len(steps) > 1 {
+			chords = append(chords, HotkeyChord{Steps: steps, Combination: label, Action: hotkey.Action,
+				Category: category, Applications: hotkey.Applications})
+			continue
+		}
+		patterns = append(patterns, customHotkeyPattern{
+			HotkeyPattern: HotkeyPattern{
+				Keys:        steps[0],
+				Combination: label,
+				Action:      hotkey.Action,
+				IsGlobal:    hotkey.Global,
+				Category:    category,
+			},
+			Applications: hotkey.Applications,
+		})
+	}
+	return patterns, chords, nil
+}
+
+// keysMatch checks if the pressed keys match a pattern
+func (hd *HotkeyDetector) keysMatch(pressedKeys, patternKeys []uint32) bool {
+	if len(pressedKeys) != len(patternKeys) {
+		return false
+	}
+
+	// Sort pattern keys for comparison
+	sortedPatternKeys := make([]uint32, len(patternKeys))
+	copy(sortedPatternKeys, patternKeys)
+	sort.Slice(sortedPatternKeys, func(i, j int) bool {
+		return sortedPatternKeys[i] < sortedPatternKeys[j]
+	})
+
+	// Compare sorted arrays
+	for i, key := range pressedKeys {
+		if key != sortedPatternKeys[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetCurrentCombination returns the current key combination as a string
+func (hd *HotkeyDetector) GetCurrentCombination() string {
+	hd.Mutex.RLock()
+	defer hd.Mutex.RUnlock()
+
+	if len(hd.PressedKeys) == 0 {
+		return ""
+	}
+
+	var keys []string
+	var modifiers []string
+	var regularKeys []string
+
+	for keyCode := range hd.PressedKeys {
+		keyName := hd.getKeyName(keyCode)
+		if hd.isModifierKey(keyCode) {
+			modifiers = append(modifiers, keyName)
+		} else {
+			regularKeys = append(regularKeys, keyName)
+		}
+	}
+
+	// Sort for consistent output
+	sort.Strings(modifiers)
+	sort.Strings(regularKeys)
+
+	// Combine modifiers first, then regular keys
+	keys = append(keys, modifiers...)
+	keys = append(keys, regularKeys...)
+
+	return strings.Join(keys, "+")
+}
+
+// Helper methods
+func (hd *HotkeyDetector) isModifierKey(keyCode uint32) bool {
+	modifierKeys := []uint32{
+		VK_CONTROL, VK_MENU, VK_SHIFT, VK_LWIN, VK_RWIN,
+		0xA2, 0xA3, // VK_LCONTROL, VK_RCONTROL
+		0xA4, 0xA5, // VK_LMENU, VK_RMENU
+		0xA0, 0xA1, // VK_LSHIFT, VK_RSHIFT
+	}
+
+	for _, modKey := range modifierKeys {
+		if keyCode == modKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (hd *HotkeyDetector) getKeyName(keyCode uint32) string {
+	if name, exists := keyNames[keyCode]; exists {
+		return name
+	}
+
+	return fmt.Sprintf("Key%d", keyCode)
+}
+
+// keyNames names the keys hotkey combinations are written with
+var keyNames = map[uint32]string{
+	// Modifier keys
+	VK_CONTROL: "Ctrl",
+	VK_MENU:    "Alt",
+	VK_SHIFT:   "Shift",
+	VK_LWIN:    "Win",
+	VK_RWIN:    "Win",
+	0xA2:       "Ctrl",  // VK_LCONTROL
+	0xA3:       "Ctrl",  // VK_RCONTROL
+	0xA4:       "Alt",   // VK_LMENU
+	0xA5:       "Alt",   // VK_RMENU
+	0xA0:       "Shift", // VK_LSHIFT
+	0xA1:       "Shift", // VK_RSHIFT
+
+	// Function keys
+	0x70: "F1", 0x71: "F2", 0x72: "F3", 0x73: "F4",
+	0x74: "F5", 0x75: "F6", 0x76: "F7", 0x77: "F8",
+	0x78: "F9", 0x79: "F10", 0x7A: "F11", 0x7B: "F12",
+
+	// Special keys
+	VK_SPACE:  "Space",
+	VK_RETURN: "Enter",
+	0x09:      "Tab",
+	0x1B:      "Esc",
+	0x08:      "Backspace",
+	0x2D:      "Insert",
+	0x2E:      "Delete",
+	0x24:      "Home",
+	0x23:      "End",
+	0x21:      "PageUp",
+	0x22:      "PageDown",
+	0x25:      "Left",
+	0x26:      "Up",
+	0x27:      "Right",
+	0x28:      "Down",
+
+	// Number keys
+	0x30: "0", 0x31: "1", 0x32: "2", 0x33: "3", 0x34: "4",
+	0x35: "5", 0x36: "6", 0x37: "7", 0x38: "8", 0x39: "9",
+
+	// Punctuation keys, as on a US layout
+	0xBA: ";", 0xBB: "=", 0xBC: ",", 0xBD: "-", 0xBE: ".", 0xBF: "/",
+	0xC0: "`", 0xDB: "[", 0xDC: "\\", 0xDD: "]", 0xDE: "'",
+
+	// Letter keys
+	0x41: "A", 0x42: "B", 0x43: "C", 0x44: "D", 0x45: "E",
+	0x46: "F", 0x47: "G", 0x48: "H", 0x49: "I", 0x4A: "J",
+	0x4B: "K", 0x4C: "L", 0x4D: "M", 0x4E: "N", 0x4F: "O",
+	0x50: "P", 0x51: "Q", 0x52: "R", 0x53: "S", 0x54: "T",
+	0x55: "U", 0x56: "V", 0x57: "W", 0x58: "X", 0x59: "Y",
+	0x5A: "Z",
+}
+
+// initializeHotkeyChords creates the list of known chords
+func initializeHotkeyChords() []HotkeyChord {
+	editors := []string{"code.exe", "devenv.exe"}
+	return []HotkeyChord{
+		{[][]uint32{{VK_CONTROL, 0x4B}, {VK_CONTROL, 0x43}}, "Ctrl+K Ctrl+C", "Comment Selection", "Edit", editors},
+		{[][]uint32{{VK_CONTROL, 0x4B}, {VK_CONTROL, 0x55}}, "Ctrl+K Ctrl+U", "Uncomment Selection", "Edit", editors},
+		{[][]uint32{{VK_CONTROL, 0x4B}, {VK_CONTROL, 0x46}}, "Ctrl+K Ctrl+F", "Format Selection", "Edit", editors},
+	}
+}
+
+// initializeHotkeyPatterns creates the list of known hotkey patterns
+func initializeHotkeyPatterns() []HotkeyPattern {
+	return []HotkeyPattern{
+		// File operations
+		{[]uint32{VK_CONTROL, 0x53}, "Ctrl+S", "Save", false, "File"},
+		{[]uint32{VK_CONTROL, 0x4F}, "Ctrl+O", "Open", false, "File"},
+		{[]uint32{VK_CONTROL, 0x4E}, "Ctrl+N", "New", false, "File"},
+		{[]uint32{VK_CONTROL, 0x50}, "Ctrl+P", "Print", false, "File"},
+
+		// Edit operations
+		{[]uint32{VK_CONTROL, 0x43}, "Ctrl+C", "Copy", false, "Edit"},
+		{[]uint32{VK_CONTROL, 0x56}, "Ctrl+V", "Paste", false, "Edit"},
+		{[]uint32{VK_CONTROL, 0x58}, "Ctrl+X", "Cut", false, "Edit"},
+		{[]uint32{VK_CONTROL, 0x5A}, "Ctrl+Z", "Undo", false, "Edit"},
+		{[]uint32{VK_CONTROL, 0x59}, "Ctrl+Y", "Redo", false, "Edit"},
+		{[]uint32{VK_CONTROL, 0x41}, "Ctrl+A", "Select All", false, "Edit"},
+		{[]uint32{VK_CONTROL, 0x46}, "Ctrl+F", "Find", false, "Edit"},
+
+		// Window management
+		{[]uint32{VK_MENU, 0x09}, "Alt+Tab", "Switch Window", true, "Window"},
+		{[]uint32{VK_MENU, 0x70}, "Alt+F4", "Close Window", false, "Window"},
+		{[]uint32{VK_LWIN, 0x44}, "Win+D", "Show Desktop", true, "Window"},
+		{[]uint32{VK_LWIN, 0x4C}, "Win+L", "Lock Screen", true, "System"},
+
+		// Browser navigation
+		{[]uint32{VK_CONTROL, 0x54}, "Ctrl+T", "New Tab", false, "Browser"},
+		{[]uint32{VK_CONTROL, 0x57}, "Ctrl+W", "Close Tab", false, "Browser"},
+		{[]uint32{VK_CONTROL, 0x09}, "Ctrl+Tab", "Next Tab", false, "Browser"},
+		{[]uint32{VK_CONTROL, VK_SHIFT, 0x09}, "Ctrl+Shift+Tab", "Previous Tab", false, "Browser"},
+		{[]uint32{VK_CONTROL, 0x52}, "Ctrl+R", "Refresh", false, "Browser"},
+		{[]uint32{VK_CONTROL, 0x4C}, "Ctrl+L", "Address Bar", false, "Browser"},
+
+		// Number shortcuts (Win+1, Win+2, etc.)
+		{[]uint32{VK_LWIN, 0x31}, "Win+1", "Launch App 1", true, "Launcher"},
+		{[]uint32{VK_LWIN, 0x32}, "Win+2", "Launch App 2", true, "Launcher"},
+		{[]uint32{VK_LWIN, 0x33}, "Win+3", "Launch App 3", true, "Launcher"},
+		{[]uint32{VK_LWIN, 0x34}, "Win+4", "Launch App 4", true, "Launcher"},
+		{[]uint32{VK_LWIN, 0x35}, "Win+5", "Launch App 5", true, "Launcher"},
+
+		// Function keys
+		{[]uint32{0x70}, "F1", "Help", false, "Function"},
+		{[]uint32{0x73}, "F4", "Address Bar", false, "Function"},
+		{[]uint32{0x74}, "F5", "Refresh", false, "Function"},
+		{[]uint32{0x7A}, "F11", "Full Screen", false, "Function"},
+
+		// Text formatting
+		{[]uint32{VK_CONTROL, 0x42}, "Ctrl+B", "Bold", false, "Format"},
+		{[]uint32{VK_CONTROL, 0x49}, "Ctrl+I", "Italic", false, "Format"},
+		{[]uint32{VK_CONTROL, 0x55}, "Ctrl+U", "Underline", false, "Format"},
+
+		// Navigation
+		{[]uint32{VK_MENU, 0x25}, "Alt+Left", "Back", false, "Navigation"},
+		{[]uint32{VK_MENU, 0x27}, "Alt+Right", "Forward", false, "Navigation"},
+		{[]uint32{VK_CONTROL, 0x24}, "Ctrl+Home", "Go to Start", false, "Navigation"},
+		{[]uint32{VK_CONTROL, 0x23}, "Ctrl+End", "Go to End", false, "Navigation"},
+
+		// System shortcuts
+		{[]uint32{VK_CONTROL, VK_SHIFT, 0x1B}, "Ctrl+Shift+Esc", "Task Manager", true, "System"},
+		{[]uint32{VK_CONTROL, VK_MENU, 0x2E}, "Ctrl+Alt+Delete", "Security Screen", true, "System"},
+		{[]uint32{0x2C}, "PrintScreen", "Screenshot", true, "System"},
+
+		// Recorder controls
+		{[]uint32{VK_CONTROL, VK_MENU, VK_SHIFT, 0x53}, "Ctrl+Alt+Shift+S", HotkeyActionSegmentStart, true, "Recorder"},
+		{[]uint32{VK_CONTROL, VK_MENU, VK_SHIFT, 0x45}, "Ctrl+Alt+Shift+E", HotkeyActionSegmentEnd, true, "Recorder"},
+		{[]uint32{VK_CONTROL, VK_MENU, VK_SHIFT, 0x5A}, "Ctrl+Alt+Shift+Z", HotkeyActionUndoMarker, true, "Recorder"},
+		{[]uint32{VK_CONTROL, VK_MENU, VK_SHIFT, 0x41}, "Ctrl+Alt+Shift+A", HotkeyActionAnnotate, true, "Recorder"},
+	}
+}
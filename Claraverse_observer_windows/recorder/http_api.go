@@ -0,0 +1,716 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP REST API for managing the recorder remotely, e.g. from the ClaraVerse
+// desktop app. Bound to loopback by default since it exposes screen contents,
+// and behind the checks in http_api_auth.go.
+
+const (
+	defaultHTTPAPIAddress = "127.0.0.1:8765"
+	activeRecordingID     = "active"
+	defaultEventPageSize  = 100
+	maxEventPageSize      = 1000
+	recordingFilePrefix   = "ui_recording_"
+)
+
+// RecordingInfo describes one recording in GET /recordings
+type RecordingInfo struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	File       string `json:"file,omitempty"`
+	SizeBytes  int64  `json:"size_bytes"`
+	ModifiedAt string `json:"modified_at,omitempty"`
+	EventCount int    `json:"event_count,omitempty"`
+	Active     bool   `json:"active"`
+}
+
+// EventsPage is the response of GET /recordings/{id}/events
+type EventsPage struct {
+	RecordingID string        `json:"recording_id"`
+	Offset      int           `json:"offset"`
+	Limit       int           `json:"limit"`
+	Total       int           `json:"total"`
+	NextOffset  *int          `json:"next_offset,omitempty"`
+	Events      []interface{} `json:"events"`
+}
+
+// EventsSince is the response of an events request with an after cursor.
+// Consumers store Cursor and RecordingStartTime, and resume with
+// ?after=<cursor> while the start time still matches.
+type EventsSince struct {
+	RecordingID        string        `json:"recording_id"`
+	RecordingStartTime uint64        `json:"recording_start_time"`
+	After              uint64        `json:"after"`
+	Cursor             uint64        `json:"cursor"`
+	HasMore            bool          `json:"has_more"`
+	Events             []interface{} `json:"events"`
+}
+
+// HTTPAPIServer serves the REST API on top of a shared recording controller
+type HTTPAPIServer struct {
+	Address       string
+	RecordingsDir string // Where saved recordings are; "" for the recorder's output directory and its sessions'
+	Controller    *RecordingController
+	Sessions      *SessionManager
+	Token         string // Every request but the viewer page carries it as a bearer token
+	StartTime     time.Time
+	server        *http.Server
+	shutdowns     chan struct{}
+}
+
+// NewHTTPAPIServer creates an API server listening on address, with
+// HTTPAPIToken as its token or, when that is empty, a random one
+func NewHTTPAPIServer(address string, controller *RecordingController) *HTTPAPIServer {
+	token := controller.Recorder.currentConfig().HTTPAPIToken
+	if token == "" {
+		token = newHTTPAPIToken()
+	}
+	s := &HTTPAPIServer{
+		Address:    address,
+		Controller: controller,
+		Sessions:   NewSessionManager(controller),
+		Token:      token,
+		StartTime:  time.Now(),
+		shutdowns:  make(chan struct{}, 1),
+	}
+
+	s.server = &http.Server{
+		Addr:              address,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// Handler returns the API routes, behind the access checks
+func (s *HTTPAPIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /recordings", s.handleListRecordings)
+	mux.HandleFunc("GET /recordings/{id}/events", s.handleRecordingEvents)
+	mux.HandleFunc("GET /recordings/{id}/screenshots/{seq}", s.handleRecordingScreenshot)
+	mux.HandleFunc("GET /recordings/{id}/diff/{other}", s.handleDiffRecordings)
+	mux.HandleFunc("POST /recordings/merge", s.handleMergeRecordings)
+	mux.HandleFunc("GET /events", s.handleActiveEvents)
+	mux.HandleFunc("POST /recordings", s.handleStartRecording)
+	mux.HandleFunc("POST /recordings/active/pause", s.handlePauseRecording)
+	mux.HandleFunc("POST /recordings/active/resume", s.handleResumeRecording)
+	mux.HandleFunc("POST /recordings/active/stop", s.handleStopRecording)
+	mux.HandleFunc("POST /recordings/active/bookmarks", s.handleAddBookmark)
+	mux.HandleFunc("POST /webhooks/{source}", s.handleWebhook)
+	mux.HandleFunc("GET /screenshot", s.handleScreenshot)
+	mux.HandleFunc("GET /sessions", s.handleListSessions)
+	mux.HandleFunc("POST /sessions", s.handleCreateSession)
+	mux.HandleFunc("GET /sessions/{name}", s.handleGetSession)
+	mux.HandleFunc("DELETE /sessions/{name}", s.handleRemoveSession)
+	mux.HandleFunc("POST /sessions/{name}/start", s.handleStartSession)
+	mux.HandleFunc("POST /sessions/{name}/stop", s.handleStopSession)
+	mux.HandleFunc("GET /viewer", s.handleViewer)
+	mux.HandleFunc("GET /viewer/ws", s.handleViewerSocket)
+	mux.HandleFunc("POST /shutdown", s.handleShutdown)
+	return s.guard(mux)
+}
+
+// ListenAndServe serves until Shutdown is called
+func (s *HTTPAPIServer) ListenAndServe() error {
+	return s.server.ListenAndServe()
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones
+func (s *HTTPAPIServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// ShutdownRequests receives when a client asks the recorder to exit
+func (s *HTTPAPIServer) ShutdownRequests() <-chan struct{} {
+	return s.shutdowns
+}
+
+func (s *HTTPAPIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	recorder := s.Controller.Recorder
+	config := recorder.currentConfig()
+	status := map[string]interface{}{
+		"state":               s.Controller.State.GetState(),
+		"state_since":         s.Controller.State.GetEnteredAt().Format(time.RFC3339),
+		"recording":           s.Controller.IsRecording(),
+		"uptime_seconds":      time.Since(s.StartTime).Seconds(),
+		"performance_mode":    config.PerformanceMode,
+		"capture_screenshots": config.CaptureScreenshots,
+		"screenshot_format":   config.ScreenshotFormat,
+		"last_saved_file":     s.Controller.GetLastSavedFile(),
+	}
+	// The recording's components are replaced as recordings start and stop
+	recorder.Mutex.RLock()
+	trackers, captioner, ocr, auditor := recorder.Trackers, recorder.Captioner, recorder.OCR, recorder.Auditor
+	validator, limiter, sinks := recorder.Schema, recorder.RateLimiter, recorder.Sinks
+	encoder, analytics, dedupe := recorder.Encoder, recorder.Analytics, recorder.Deduplicator
+	recorder.Mutex.RUnlock()
+	status["duplicate_events"] = dedupe.GetSuppressedCount()
+
+	if trackers != nil {
+		status["trackers"] = trackers.Health.GetStatistics()
+	}
+	if captioner != nil {
+		status["vision"] = captioner.GetStatistics()
+	}
+	if ocr != nil {
+		status["ocr"] = ocr.GetStatistics()
+	}
+	if auditor != nil {
+		status["dry_run"] = auditor.GetStatistics()
+	}
+	if quotas := recorder.Quotas; quotas != nil {
+		status["quotas"] = quotas.GetStatistics()
+	}
+	if validator != nil {
+		status["strict"] = validator.GetStatistics()
+	}
+	if limiter != nil {
+		status["rate_limited"] = limiter.GetStatistics()
+	}
+	if dropped := recorder.Pipeline.GetStatistics(); len(dropped) > 0 {
+		status["pipeline_dropped"] = dropped
+	}
+	if sinks != nil {
+		status["event_sinks"] = sinks.GetStatistics()
+	}
+	if encoder != nil {
+		status["screenshot_encoding"] = encoder.GetStatistics()
+	}
+	if analytics != nil && s.Controller.IsRecording() {
+		status["analytics"] = analytics.GetStatistics()
+	}
+	for key, value := range recorder.Screenshots.GetStatistics() {
+		status[key] = value
+	}
+
+	if session := s.Sessions.ActiveSession(); session != "" {
+		status["session"] = session
+	}
+	if workflow := s.Controller.Active(); workflow != nil {
+		status["recording_name"] = workflow.Name
+		status["recording_start_time"] = workflow.StartTime
+		status["event_count"] = workflow.EventCount()
+		status["recording_size_bytes"] = workflow.EstimatedSize()
+		status["recording_size_by_type"] = workflow.EventSizes()
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *HTTPAPIServer) handleListRecordings(w http.ResponseWriter, r *http.Request) {
+	recordings := []RecordingInfo{}
+
+	if workflow := s.Controller.Active(); workflow != nil {
+		recordings = append(recordings, RecordingInfo{
+			ID:         activeRecordingID,
+			Name:       workflow.Name,
+			EventCount: workflow.EventCount(),
+			Active:     true,
+		})
+	}
+
+	saved, err := s.savedRecordings()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"recordings": append(recordings, saved...),
+	})
+}
+
+// recordingsDirs returns the directories holding saved recordings, the
+// recorder's own first
+func (s *HTTPAPIServer) recordingsDirs() []string {
+	if s.RecordingsDir != "" {
+		return []string{s.RecordingsDir}
+	}
+	return s.Sessions.OutputDirectories()
+}
+
+// savedRecordings lists recording files, newest first. A file named like
+// one in an earlier directory is left out, since its id would be the same.
+func (s *HTTPAPIServer) savedRecordings() ([]RecordingInfo, error) {
+	var matches []string
+	for _, dir := range s.recordingsDirs() {
+		found, err := filepath.Glob(filepath.Join(dir, recordingFilePrefix+"*.json"))
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+	}
+
+	recordings := make([]RecordingInfo, 0, len(matches))
+	seen := make(map[string]bool)
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		file := filepath.Base(path)
+		if err != nil || info.IsDir() || seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		recordings = append(recordings, RecordingInfo{
+			ID:         strings.TrimSuffix(file, ".json"),
+			File:       file,
+			SizeBytes:  info.Size(),
+			ModifiedAt: info.ModTime().Format(time.RFC3339),
+		})
+	}
+
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].ModifiedAt > recordings[j].ModifiedAt
+	})
+
+	return recordings, nil
+}
+
+func (s *HTTPAPIServer) handleRecordingEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if r.URL.Query().Has("after") {
+		s.writeEventsSince(w, r, id)
+		return
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeJSONError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultEventPageSize)
+	if err != nil || limit <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+		return
+	}
+	if limit > maxEventPageSize {
+		limit = maxEventPageSize
+	}
+
+	var events []interface{}
+	var total int
+
+	if id == activeRecordingID {
+		workflow := s.Controller.Active()
+		if workflow == nil {
+			writeJSONError(w, http.StatusNotFound, "No recording in progress")
+			return
+		}
+
+		page, count := workflow.EventsPage(offset, limit)
+		events = make([]interface{}, len(page))
+		for i, event := range page {
+			events[i] = event
+		}
+		total = count
+	} else {
+		path, ok := s.savedRecordingPath(w, id)
+		if !ok {
+			return
+		}
+
+		// Events are kept raw so saved recordings round-trip byte for byte
+		var saved struct {
+			Events []json.RawMessage `json:"events"`
+		}
+		if err := LoadRecordingFile(path, &saved); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		total = len(saved.Events)
+		events = []interface{}{}
+		for i := offset; i < total && i < offset+limit; i++ {
+			events = append(events, saved.Events[i])
+		}
+	}
+
+	response := EventsPage{
+		RecordingID: id,
+		Offset:      offset,
+		Limit:       limit,
+		Total:       total,
+		Events:      events,
+	}
+	if next := offset + len(events); next < total {
+		response.NextOffset = &next
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleActiveEvents serves the active recording's events after a cursor
+func (s *HTTPAPIServer) handleActiveEvents(w http.ResponseWriter, r *http.Request) {
+	s.writeEventsSince(w, r, activeRecordingID)
+}
+
+// writeEventsSince responds with the events of recording id whose sequence
+// numbers follow the after cursor, so a consumer can pull only what is new
+func (s *HTTPAPIServer) writeEventsSince(w http.ResponseWriter, r *http.Request, id string) {
+	after, err := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+	if err != nil && r.URL.Query().Get("after") != "" {
+		writeJSONError(w, http.StatusBadRequest, "after must be a non-negative integer")
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultEventPageSize)
+	if err != nil || limit <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+		return
+	}
+	limit = min(limit, maxEventPageSize)
+
+	response := EventsSince{RecordingID: id, After: after, Cursor: after, Events: []interface{}{}}
+
+	if id == activeRecordingID {
+		workflow := s.Controller.Active()
+		if workflow == nil {
+			writeJSONError(w, http.StatusNotFound, "No recording in progress")
+			return
+		}
+
+		page, hasMore := workflow.EventsAfter(after, limit)
+		for _, event := range page {
+			metadata, _ := eventMetadata(event)
+			response.Events = append(response.Events, event)
+			response.Cursor = metadata.Sequence
+		}
+		response.RecordingStartTime = workflow.StartTime
+		response.HasMore = hasMore
+	} else {
+		path, ok := s.recordingPath(id)
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "Invalid recording id")
+			return
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			writeJSONError(w, http.StatusNotFound, "Recording not found: "+id)
+			return
+		}
+
+		var saved struct {
+			StartTime uint64            `json:"start_time"`
+			Events    []json.RawMessage `json:"events"`
+		}
+		if err := LoadRecordingFile(path, &saved); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		response.RecordingStartTime = saved.StartTime
+
+		for i, raw := range saved.Events {
+			var event struct {
+				Metadata EventMetadata `json:"metadata"`
+			}
+			json.Unmarshal(raw, &event)
+			// Recordings from before sequence numbers count from 1 in order
+			sequence := event.Metadata.Sequence
+			if sequence == 0 {
+				sequence = uint64(i + 1)
+			}
+			if sequence <= after {
+				continue
+			}
+			if len(response.Events) == limit {
+				response.HasMore = true
+				break
+			}
+			response.Events = append(response.Events, raw)
+			response.Cursor = sequence
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// recordingPath maps a recording id to its file in the first recordings
+// directory holding it, or the recorder's own when none does, rejecting
+// anything that could escape the recordings directories
+func (s *HTTPAPIServer) recordingPath(id string) (string, bool) {
+	if !strings.HasPrefix(id, recordingFilePrefix) || id != filepath.Base(id) ||
+		strings.ContainsAny(id, `/\:`) || strings.Contains(id, "..") {
+		return "", false
+	}
+
+	dirs := s.recordingsDirs()
+	for _, dir := range dirs {
+		path := filepath.Join(dir, id+".json")
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return filepath.Join(dirs[0], id+".json"), true
+}
+
+// savedRecordingPath maps the id of a saved recording to its file, writing
+// the error response when there is none
+func (s *HTTPAPIServer) savedRecordingPath(w http.ResponseWriter, id string) (string, bool) {
+	path, ok := s.recordingPath(id)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "Invalid recording id")
+		return "", false
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		writeJSONError(w, http.StatusNotFound, "Recording not found: "+id)
+		return "", false
+	}
+	return path, true
+}
+
+func (s *HTTPAPIServer) handleDiffRecordings(w http.ResponseWriter, r *http.Request) {
+	before, ok := s.savedRecordingPath(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	after, ok := s.savedRecordingPath(w, r.PathValue("other"))
+	if !ok {
+		return
+	}
+
+	diff, err := diffRecordingFiles(before, after, s.Controller.Recorder.currentConfig().ScreenshotStore)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, diff)
+}
+
+func (s *HTTPAPIServer) handleMergeRecordings(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Recordings []string `json:"recordings"`
+		Name       string   `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if len(request.Recordings) < 2 {
+		writeJSONError(w, http.StatusBadRequest, "recordings must list at least two recording ids")
+		return
+	}
+	files := make([]string, len(request.Recordings))
+	for i, id := range request.Recordings {
+		path, ok := s.savedRecordingPath(w, id)
+		if !ok {
+			return
+		}
+		files[i] = path
+	}
+
+	output := mergedRecordingFile(s.recordingsDirs()[0])
+	merged, err := mergeRecordingFiles(files, request.Name, output)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, RecordingInfo{
+		ID:         strings.TrimSuffix(filepath.Base(output), ".json"),
+		Name:       merged.Name,
+		File:       filepath.Base(output),
+		EventCount: len(merged.Events),
+	})
+}
+
+func (s *HTTPAPIServer) handleStartRecording(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+	}
+	if request.Name == "" {
+		request.Name = "HTTP Workflow Recording"
+	}
+
+	if err := s.Controller.Start(request.Name); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":   activeRecordingID,
+		"name": request.Name,
+	})
+}
+
+func (s *HTTPAPIServer) handlePauseRecording(w http.ResponseWriter, r *http.Request) {
+	if err := s.Controller.Pause(); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"state": s.Controller.State.GetState()})
+}
+
+func (s *HTTPAPIServer) handleResumeRecording(w http.ResponseWriter, r *http.Request) {
+	if err := s.Controller.Resume(); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"state": s.Controller.State.GetState()})
+}
+
+func (s *HTTPAPIServer) handleStopRecording(w http.ResponseWriter, r *http.Request) {
+	if session := s.Sessions.ActiveSession(); session != "" {
+		s.writeStoppedRecording(w, func() (*RecordedWorkflow, string, error) { return s.Sessions.Stop(session) })
+		return
+	}
+	s.writeStoppedRecording(w, s.Controller.StopAndSave)
+}
+
+// handleShutdown asks the recorder to save any recording and exit, as on
+// Ctrl+C
+func (s *HTTPAPIServer) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	select {
+	case s.shutdowns <- struct{}{}:
+	default:
+		// Already asked
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"shutting_down": true})
+}
+
+// writeStoppedRecording stops a recording with stop and describes the file
+// it was saved to
+func (s *HTTPAPIServer) writeStoppedRecording(w http.ResponseWriter, stop func() (*RecordedWorkflow, string, error)) {
+	workflow, filename, err := stop()
+	if err != nil {
+		if workflow == nil {
+			writeJSONError(w, http.StatusConflict, err.Error())
+		} else {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RecordingInfo{
+		ID:         strings.TrimSuffix(filepath.Base(filename), ".json"),
+		Name:       workflow.Name,
+		File:       filepath.Base(filename),
+		EventCount: workflow.EventCount(),
+	})
+}
+
+func (s *HTTPAPIServer) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": s.Sessions.List()})
+}
+
+func (s *HTTPAPIServer) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name   string          `json:"name"`
+		Config json.RawMessage `json:"config"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	info, err := s.Sessions.Create(request.Name, request.Config)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+func (s *HTTPAPIServer) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.Sessions.Get(r.PathValue("name"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "Session not found: "+r.PathValue("name"))
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *HTTPAPIServer) handleRemoveSession(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.Sessions.Get(name); !ok {
+		writeJSONError(w, http.StatusNotFound, "Session not found: "+name)
+		return
+	}
+	if err := s.Sessions.Remove(name); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *HTTPAPIServer) handleStartSession(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.Sessions.Get(name); !ok {
+		writeJSONError(w, http.StatusNotFound, "Session not found: "+name)
+		return
+	}
+	if err := s.Sessions.Start(name); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	info, _ := s.Sessions.Get(name)
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *HTTPAPIServer) handleStopSession(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.Sessions.Get(name); !ok {
+		writeJSONError(w, http.StatusNotFound, "Session not found: "+name)
+		return
+	}
+	s.writeStoppedRecording(w, func() (*RecordedWorkflow, string, error) { return s.Sessions.Stop(name) })
+}
+
+func (s *HTTPAPIServer) handleScreenshot(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	switch format {
+	case "", "png", "jpeg":
+	case "jpg":
+		format = "jpeg"
+	default:
+		writeJSONError(w, http.StatusBadRequest, "format must be png or jpeg")
+		return
+	}
+
+	event := s.Controller.Recorder.Screenshots.CaptureNow(ScreenshotTriggerManual, format)
+	if event == nil {
+		writeJSONError(w, http.StatusInternalServerError, "Screenshot capture failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, event)
+}
+
+// Response helpers
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,147 @@
+package recorder
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HTTP API access checks. Any page the user visits can send requests to a
+// loopback server, and a page on a name the attacker controls can be
+// rebound to 127.0.0.1 to read the answers, so every request must name the
+// server by a loopback name or address in its Host header, or by the
+// address it was bound to when that is another one, and requests from pages
+// on another origin are refused. Recordings hold screenshots and what was
+// typed, so every request but the viewer page itself must also carry the API
+// token as "Authorization: Bearer <token>", and send any body as
+// application/json, which a page cannot do across origins without the
+// server's consent. Browsers cannot set headers on a WebSocket, so the
+// viewer's offers the token as the subprotocol "bearer.<token>" instead.
+// The token is HTTPAPIToken, or one generated at start and written to
+// httpAPITokenFile for clients to read.
+
+// webSocketTokenProtocol prefixes the API token offered as a WebSocket
+// subprotocol
+const webSocketTokenProtocol = "bearer."
+
+// newHTTPAPIToken returns a random API token
+func newHTTPAPIToken() string {
+	token := make([]byte, 32)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// httpAPITokenFile is where a generated API token is written, or "" when
+// there is no per-user config directory
+func httpAPITokenFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ClaraVerse", "http_api_token")
+}
+
+// saveHTTPAPIToken writes token to httpAPITokenFile, readable only by the
+// user, and returns the file's path
+func saveHTTPAPIToken(token string) (string, error) {
+	path := httpAPITokenFile()
+	if path == "" {
+		return "", NewWorkflowError(ErrorTypeFileIO, "No config directory for the HTTP API token", nil)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", NewWorkflowError(ErrorTypeFileIO, "Failed to create the HTTP API token directory", err)
+	}
+	if err := os.WriteFile(path, []byte(token), 0600); err != nil {
+		return "", NewWorkflowError(ErrorTypeFileIO, "Failed to write the HTTP API token", err)
+	}
+	return path, nil
+}
+
+// guard wraps the API routes in the access checks
+func (s *HTTPAPIServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			writeJSONError(w, http.StatusForbidden, "Host not allowed: "+r.Host)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				writeJSONError(w, http.StatusForbidden, "Cross-origin request refused")
+				return
+			}
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/viewer" {
+			// The page holds nothing recorded; it asks for the token
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "Missing or wrong API token")
+			return
+		}
+		if r.ContentLength != 0 && r.Method != http.MethodGet {
+			if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+				writeJSONError(w, http.StatusUnsupportedMediaType, "Request body must be application/json")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether r carries the API token, as a bearer token or
+// as a WebSocket subprotocol
+func (s *HTTPAPIServer) authorized(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token, found = webSocketProtocolToken(r)
+	}
+	return found && s.Token != "" && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(s.Token)) == 1
+}
+
+// webSocketProtocolToken returns the token a WebSocket handshake offers as
+// a subprotocol
+func webSocketProtocolToken(r *http.Request) (string, bool) {
+	for _, protocols := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(protocols, ",") {
+			if token, found := strings.CutPrefix(strings.TrimSpace(protocol), webSocketTokenProtocol); found {
+				return token, true
+			}
+		}
+	}
+	return "", false
+}
+
+// allowedHost reports whether a request's Host names the server by a
+// loopback name or address, which no other site can be rebound to, or by
+// the address the server was bound to. Bound to every address, any IP
+// address reaching it will do.
+func (s *HTTPAPIServer) allowedHost(hostport string) bool {
+	host := hostOnly(hostport)
+	if isLoopbackHost(host) {
+		return true
+	}
+	bound := hostOnly(s.Address)
+	ip, boundIP := net.ParseIP(host), net.ParseIP(bound)
+	if bound == "" || (boundIP != nil && boundIP.IsUnspecified()) {
+		return ip != nil
+	}
+	return strings.EqualFold(host, bound) || (ip != nil && ip.Equal(boundIP))
+}
+
+// hostOnly returns the host of a host:port, without brackets
+func hostOnly(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	return strings.Trim(host, "[]")
+}
@@ -0,0 +1,160 @@
+package recorder
+
+import (
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Idle detection. With IdleThresholdSeconds set, capture stops, interval
+// screenshots included, once there has been no keyboard or mouse input for
+// that long, and starts again at the next input. IdleStart is stamped with
+// the time of the last input and IdleEnd with the idle time, so the
+// recording shows the whole stretch. Time spent idle is not counted as
+// dwell time in an application or on a page.
+
+var procGetLastInputInfo = user32.NewProc("GetLastInputInfo")
+
+// IdleMarkerType is the start or end of a stretch without input
+type IdleMarkerType string
+
+const (
+	IdleStart IdleMarkerType = "IdleStart"
+	IdleEnd   IdleMarkerType = "IdleEnd"
+)
+
+// IdleEvent marks where the user went idle or came back
+type IdleEvent struct {
+	Idle     IdleMarkerType `json:"idle"`
+	IdleMs   uint64         `json:"idle_ms,omitempty"` // On IdleEnd, how long the user was idle
+	Metadata EventMetadata  `json:"metadata"`
+}
+
+// LASTINPUTINFO is the Win32 structure GetLastInputInfo fills
+type LASTINPUTINFO struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+// IdleDetector tracks stretches without input
+type IdleDetector struct {
+	Threshold time.Duration
+	Idle      bool
+	Since     time.Time     // Last input before the current idle stretch
+	Total     time.Duration // Idle time of the stretches that have ended
+	Mutex     sync.Mutex
+}
+
+// NewIdleDetector creates a detector for the configured threshold, or
+// returns nil when idle detection is off
+func NewIdleDetector(config WorkflowRecorderConfig) *IdleDetector {
+	if config.IdleThresholdSeconds <= 0 {
+		return nil
+	}
+	return &IdleDetector{Threshold: time.Duration(config.IdleThresholdSeconds) * time.Second}
+}
+
+// Update takes how long there has been no input as of now, and returns an
+// event when the user has gone idle or come back
+func (d *IdleDetector) Update(idleFor time.Duration, now time.Time) *IdleEvent {
+	d.Mutex.Lock()
+	defer d.Mutex.Unlock()
+
+	lastInput := now.Add(-idleFor)
+	switch {
+	case !d.Idle && idleFor >= d.Threshold:
+		d.Idle, d.Since = true, lastInput
+		return &IdleEvent{Idle: IdleStart, Metadata: EventMetadata{Timestamp: uint64(lastInput.UnixMilli())}}
+	case d.Idle && idleFor < d.Threshold:
+		gap := lastInput.Sub(d.Since)
+		d.Idle = false
+		d.Total += gap
+		return &IdleEvent{
+			Idle:     IdleEnd,
+			IdleMs:   uint64(gap.Milliseconds()),
+			Metadata: EventMetadata{Timestamp: uint64(lastInput.UnixMilli())},
+		}
+	}
+	return nil
+}
+
+// IsIdle reports whether the user is idle
+func (d *IdleDetector) IsIdle() bool {
+	d.Mutex.Lock()
+	defer d.Mutex.Unlock()
+
+	return d.Idle
+}
+
+// IdleTime returns the time spent idle so far as of now
+func (d *IdleDetector) IdleTime(now time.Time) time.Duration {
+	d.Mutex.Lock()
+	defer d.Mutex.Unlock()
+
+	if d.Idle {
+		return d.Total + now.Sub(d.Since)
+	}
+	return d.Total
+}
+
+// SoFar returns the time the recording has spent idle until now, for
+// taking out of dwell times; none without a detector
+func (d *IdleDetector) SoFar() time.Duration {
+	if d == nil {
+		return 0
+	}
+	return d.IdleTime(time.Now())
+}
+
+// activeTime returns the time since start, less the idle time since then
+// given the idle time so far when it started and now
+func activeTime(start time.Time, idleAtStart, idleNow time.Duration) time.Duration {
+	if start.IsZero() {
+		return 0
+	}
+	idle := idleNow - idleAtStart
+	if idle < 0 {
+		// A recording has started since, counting idle time afresh
+		idle = idleNow
+	}
+	return max(time.Since(start)-idle, 0)
+}
+
+// userIdleTime returns how long there has been no keyboard or mouse input
+// in the session
+func userIdleTime() time.Duration {
+	info := LASTINPUTINFO{}
+	info.cbSize = uint32(unsafe.Sizeof(info))
+	if ret, _, _ := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info))); ret == 0 {
+		return 0
+	}
+	// Both tick counts wrap at 32 bits alike
+	now, _, _ := procGetTickCount64.Call()
+	return time.Duration(uint32(now)-info.dwTime) * time.Millisecond
+}
+
+// pollIdle stops capture when the user goes idle and starts it again when
+// they come back, marking both in the timeline. It reports whether the user
+// is idle, in which case nothing is captured. Called by the capture loop,
+// which owns the trackers.
+func (r *Recorder) pollIdle(workflow *RecordedWorkflow) bool {
+	idle := r.Trackers.Idle
+	if idle == nil {
+		return false
+	}
+	event := idle.Update(userIdleTime(), time.Now())
+	if event == nil {
+		return idle.IsIdle()
+	}
+
+	var events []WorkflowEvent
+	if event.Idle == IdleStart {
+		// Text typed before the idle stretch is not joined to text after it
+		r.processTrackerEvents(workflow, &events, r.Trackers.Flush())
+		printConsole(Msg(MsgIdleStarted, FormatDuration(idle.Threshold)))
+	} else {
+		printConsole(Msg(MsgIdleEnded, FormatDuration(time.Duration(event.IdleMs)*time.Millisecond)))
+	}
+	r.appendWorkflowEvents(workflow, append(events, *event))
+	return event.Idle == IdleStart
+}
@@ -0,0 +1,170 @@
+package recorder
+
+import (
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// IME composition. Chinese, Japanese and Korean text is typed through an
+// input method editor: the keys pressed spell a reading (pinyin, romaji,
+// jamo) that the IME composes into characters and commits to the control,
+// so the keys are not the text. The IME context of another process cannot
+// be read, but the default IME window of the window in front answers
+// WM_IME_CONTROL with whether the IME is open and converting to native
+// characters; TSF input methods answer it through their IMM32 layer. While
+// it is, printing keys are recorded without a Character, and Enter and Esc
+// end the composition instead of the text input. The text committed is then
+// read back from the focused control and recorded as a VK_PROCESSKEY
+// KeyboardEvent carrying it, the key Windows hands applications for
+// composed input, and added to the text input session.
+
+var (
+	imm32                   = syscall.NewLazyDLL("imm32.dll")
+	procImmGetDefaultIMEWnd = imm32.NewProc("ImmGetDefaultIMEWnd")
+	procSendMessageTimeout  = user32.NewProc("SendMessageTimeoutW")
+)
+
+const (
+	VK_PROCESSKEY         = 0xE5
+	WM_IME_CONTROL        = 0x0283
+	IMC_GETCONVERSIONMODE = 0x0001
+	IMC_GETOPENSTATUS     = 0x0005
+	IME_CMODE_NATIVE      = 0x0001
+	SMTO_ABORTIFHUNG      = 0x0002
+	imeQueryTimeoutMs     = 50
+)
+
+// imeCommit is text an IME committed and the control's value after it
+type imeCommit struct {
+	Text  string
+	Value string
+}
+
+// IMEComposition follows text being composed through an IME
+type IMEComposition struct {
+	Composing   bool
+	Before      string // The focused control's value when composing began
+	Readable    bool   // Before was read from the control
+	Committed   []imeCommit
+	Converting  func() bool           // Reports the IME in front converting to native text
+	ValueReader func() (string, bool) // Reads the focused control's value
+	commitTimer *time.Timer
+	Mutex       sync.Mutex
+}
+
+// NewIMEComposition creates a tracker for the IME of the window in front
+func NewIMEComposition() *IMEComposition {
+	return &IMEComposition{
+		Converting:  foregroundIMEConverting,
+		ValueReader: readFocusedTextValue,
+	}
+}
+
+// IsConverting reports whether keys typed now go to an IME
+func (c *IMEComposition) IsConverting() bool {
+	return c.Converting != nil && c.Converting()
+}
+
+// HandleKey notes a key going down, printing or not, while the IME is
+// converting or not, and reports whether the key is part of a composition
+func (c *IMEComposition) HandleKey(keyCode uint32, printing, converting bool) bool {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	switch {
+	case !converting:
+		c.end()
+		return false
+	case printing:
+		if !c.Composing {
+			c.Composing = true
+			c.Before, c.Readable = c.ValueReader()
+		}
+		return true
+	case !c.Composing:
+		return false
+	case keyCode == VK_RETURN || keyCode == VK_ESCAPE:
+		// Commit or cancel the composition rather than the field
+		c.end()
+		return true
+	default:
+		return keyCode == VK_BACK
+	}
+}
+
+// Reset forgets a composition, as focus has left the control it was in
+func (c *IMEComposition) Reset() {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	c.Composing = false
+	if c.commitTimer != nil {
+		c.commitTimer.Stop()
+	}
+}
+
+// end finishes the composition, reading what it committed once the
+// application has applied it (must be called with the mutex held)
+func (c *IMEComposition) end() {
+	if !c.Composing {
+		return
+	}
+	c.Composing = false
+	if !c.Readable {
+		return
+	}
+	before := c.Before
+	c.commitTimer = time.AfterFunc(textValueRefreshDelay, func() {
+		value, ok := c.ValueReader()
+		if !ok {
+			return
+		}
+		diff := diffTextValues(before, value)
+		if diff == nil || diff.Inserted == "" {
+			return
+		}
+
+		c.Mutex.Lock()
+		defer c.Mutex.Unlock()
+
+		c.Committed = append(c.Committed, imeCommit{Text: diff.Inserted, Value: value})
+	})
+}
+
+// Take returns and clears the text committed since the last call
+func (c *IMEComposition) Take() []imeCommit {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	committed := c.Committed
+	c.Committed = nil
+	return committed
+}
+
+// foregroundIMEConverting reports whether the IME of the window in front is
+// open and converting to native characters
+func foregroundIMEConverting() bool {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		return false
+	}
+	ime, _, _ := procImmGetDefaultIMEWnd.Call(hwnd)
+	if ime == 0 {
+		return false
+	}
+	if open, ok := imeControl(ime, IMC_GETOPENSTATUS); !ok || open == 0 {
+		return false
+	}
+	mode, ok := imeControl(ime, IMC_GETCONVERSIONMODE)
+	return ok && mode&IME_CMODE_NATIVE != 0
+}
+
+// imeControl sends an IME window a WM_IME_CONTROL command
+func imeControl(ime, command uintptr) (uintptr, bool) {
+	var result uintptr
+	ret, _, _ := procSendMessageTimeout.Call(ime, WM_IME_CONTROL, command, 0,
+		SMTO_ABORTIFHUNG, imeQueryTimeoutMs, uintptr(unsafe.Pointer(&result)))
+	return result, ret != 0
+}
@@ -0,0 +1,123 @@
+package recorder
+
+import "math"
+
+// Input context. Key presses and completed text input carry where they
+// happened within the window: the text caret's screen position, and how far
+// the focused scrollable container (the focused element itself, or the
+// nearest ancestor that scrolls) is scrolled. The caret comes from the
+// system caret where the application shows one, else from UI Automation for
+// controls that draw their own, such as browsers.
+
+// maxScrollAncestors is how far up from the focused element a scrollable
+// container is looked for
+const maxScrollAncestors = 16
+
+// InputContext is where in the window input went
+type InputContext struct {
+	Caret  *Position
+	Scroll *ScrollPosition
+}
+
+// captureInputContext reads the caret and scroll position of the focused
+// element
+func captureInputContext() InputContext {
+	context := InputContext{Caret: focusedCaretPosition()}
+
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return context
+	}
+	defer client.Close()
+
+	element, err := client.FocusedElement()
+	if err != nil {
+		return context
+	}
+	defer element.Release()
+
+	if context.Caret == nil {
+		if left, top, _, _, err := client.CaretBounds(element); err == nil {
+			context.Caret = &Position{X: int32(math.Round(left)), Y: int32(math.Round(top))}
+		}
+	}
+	context.Scroll = client.focusedScroll(element)
+	return context
+}
+
+// focusedScroll returns the scroll position of element or of its nearest
+// scrollable ancestor, or nil when none of them scrolls
+func (c *UIAutomationClient) focusedScroll(element comObject) *ScrollPosition {
+	walker, err := c.ControlViewWalker()
+	if err != nil {
+		return nil
+	}
+	defer walker.Release()
+
+	current := element
+	for depth := 0; current != 0 && depth <= maxScrollAncestors; depth++ {
+		horizontal, vertical, err := c.ScrollPercents(current)
+		if err == nil && (horizontal >= 0 || vertical >= 0) {
+			scroll := &ScrollPosition{
+				Horizontal: roundScrollPercent(horizontal),
+				Vertical:   roundScrollPercent(vertical),
+				Container:  elementString(current, vtblElementGetCurrentName),
+			}
+			if current != element {
+				current.Release()
+			}
+			return scroll
+		}
+		parent := walkerStep(walker, vtblTreeWalkerGetParentElement, current)
+		if current != element {
+			current.Release()
+		}
+		current = parent
+	}
+	if current != element {
+		current.Release()
+	}
+	return nil
+}
+
+// roundScrollPercent keeps a scroll percentage to two decimals
+func roundScrollPercent(percent float64) float64 {
+	if percent < 0 {
+		return -1
+	}
+	return math.Round(percent*100) / 100
+}
+
+// hasKeyDown reports whether any of events is a key press
+func hasKeyDown(events []WorkflowEvent) bool {
+	for _, event := range events {
+		if keyEvent, ok := event.(KeyboardEvent); ok && keyEvent.IsKeyDown {
+			return true
+		}
+	}
+	return false
+}
+
+// applyInputContext sets the caret, where not already known, and scroll
+// position of key presses and completed text input
+func applyInputContext(events []WorkflowEvent, context InputContext) {
+	for i, event := range events {
+		switch e := event.(type) {
+		case KeyboardEvent:
+			if !e.IsKeyDown {
+				continue
+			}
+			if e.Caret == nil {
+				e.Caret = context.Caret
+			}
+			e.Scroll = context.Scroll
+			events[i] = e
+		case TextInputCompletedEvent:
+			if e.Caret == nil {
+				e.Caret = context.Caret
+			}
+			e.Scroll = context.Scroll
+			events[i] = e
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package recorder
+
+import (
+	"errors"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// Windows API for synthesizing input
+var (
+	procSendInput    = user32.NewProc("SendInput")
+	procSetCursorPos = user32.NewProc("SetCursorPos")
+)
+
+const (
+	INPUT_MOUSE    = 0
+	INPUT_KEYBOARD = 1
+
+	MOUSEEVENTF_LEFTDOWN   = 0x0002
+	MOUSEEVENTF_LEFTUP     = 0x0004
+	MOUSEEVENTF_RIGHTDOWN  = 0x0008
+	MOUSEEVENTF_RIGHTUP    = 0x0010
+	MOUSEEVENTF_MIDDLEDOWN = 0x0020
+	MOUSEEVENTF_MIDDLEUP   = 0x0040
+	MOUSEEVENTF_WHEEL      = 0x0800
+
+	KEYEVENTF_KEYUP   = 0x0002
+	KEYEVENTF_UNICODE = 0x0004
+
+	WHEEL_DELTA = 120
+)
+
+type MOUSEINPUT struct {
+	Dx          int32
+	Dy          int32
+	MouseData   uint32
+	DwFlags     uint32
+	Time        uint32
+	DwExtraInfo uintptr
+}
+
+type KEYBDINPUT struct {
+	WVk         uint16
+	WScan       uint16
+	DwFlags     uint32
+	Time        uint32
+	DwExtraInfo uintptr
+}
+
+// mouseInput and keyboardInput mirror the INPUT union for each variant.
+// MOUSEINPUT is the largest member, so the keyboard form is padded to match.
+type mouseInput struct {
+	Type uint32
+	Mi   MOUSEINPUT
+}
+
+type keyboardInput struct {
+	Type    uint32
+	Ki      KEYBDINPUT
+	padding [8]byte
+}
+
+// SimulateMouseClick moves the cursor to the position and clicks the button
+func SimulateMouseClick(position Position, button MouseButton, doubleClick bool) error {
+	var downFlag, upFlag uint32
+	switch button {
+	case MouseButtonRight:
+		downFlag, upFlag = MOUSEEVENTF_RIGHTDOWN, MOUSEEVENTF_RIGHTUP
+	case MouseButtonMiddle:
+		downFlag, upFlag = MOUSEEVENTF_MIDDLEDOWN, MOUSEEVENTF_MIDDLEUP
+	default:
+		downFlag, upFlag = MOUSEEVENTF_LEFTDOWN, MOUSEEVENTF_LEFTUP
+	}
+
+	if err := SimulateMouseMove(position); err != nil {
+		return err
+	}
+
+	clicks := 1
+	if doubleClick {
+		clicks = 2
+	}
+
+	for i := 0; i < clicks; i++ {
+		inputs := []mouseInput{
+			{Type: INPUT_MOUSE, Mi: MOUSEINPUT{DwFlags: downFlag}},
+			{Type: INPUT_MOUSE, Mi: MOUSEINPUT{DwFlags: upFlag}},
+		}
+		if err := sendMouseInputs(inputs); err != nil {
+			return err
+		}
+		if i < clicks-1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	return nil
+}
+
+// SimulateMouseDrag drags with the left button from one position to another,
+// passing through points in between so drop targets see the pointer arrive
+func SimulateMouseDrag(from, to Position) error {
+	const steps = 10
+
+	if err := SimulateMouseMove(from); err != nil {
+		return err
+	}
+	if err := sendMouseInputs([]mouseInput{{Type: INPUT_MOUSE, Mi: MOUSEINPUT{DwFlags: MOUSEEVENTF_LEFTDOWN}}}); err != nil {
+		return err
+	}
+
+	var moveErr error
+	for i := int32(1); i <= steps && moveErr == nil; i++ {
+		time.Sleep(20 * time.Millisecond)
+		moveErr = SimulateMouseMove(Position{
+			X: from.X + (to.X-from.X)*i/steps,
+			Y: from.Y + (to.Y-from.Y)*i/steps,
+		})
+	}
+
+	// The button is released even when a move failed, so it is never left held
+	if err := sendMouseInputs([]mouseInput{{Type: INPUT_MOUSE, Mi: MOUSEINPUT{DwFlags: MOUSEEVENTF_LEFTUP}}}); err != nil {
+		return err
+	}
+	return moveErr
+}
+
+// SimulateMouseMove places the cursor at an absolute screen position
+func SimulateMouseMove(position Position) error {
+	ret, _, err := procSetCursorPos.Call(uintptr(position.X), uintptr(position.Y))
+	if ret == 0 {
+		return NewWorkflowError(ErrorTypeSystem, "SetCursorPos failed", err)
+	}
+	return nil
+}
+
+// SimulateMouseWheel scrolls by the given number of notches (positive is up)
+func SimulateMouseWheel(notches int32) error {
+	inputs := []mouseInput{
+		{Type: INPUT_MOUSE, Mi: MOUSEINPUT{
+			MouseData: uint32(notches * WHEEL_DELTA),
+			DwFlags:   MOUSEEVENTF_WHEEL,
+		}},
+	}
+	return sendMouseInputs(inputs)
+}
+
+// SimulateTextInput types text as Unicode key events, independent of keyboard layout
+func SimulateTextInput(text string) error {
+	units := utf16.Encode([]rune(text))
+	if len(units) == 0 {
+		return nil
+	}
+
+	inputs := make([]keyboardInput, 0, len(units)*2)
+	for _, unit := range units {
+		inputs = append(inputs,
+			keyboardInput{Type: INPUT_KEYBOARD, Ki: KEYBDINPUT{WScan: unit, DwFlags: KEYEVENTF_UNICODE}},
+			keyboardInput{Type: INPUT_KEYBOARD, Ki: KEYBDINPUT{WScan: unit, DwFlags: KEYEVENTF_UNICODE | KEYEVENTF_KEYUP}},
+		)
+	}
+
+	return sendKeyboardInputs(inputs)
+}
+
+// SimulateKeyPress presses and releases a virtual key, holding any modifiers
+func SimulateKeyPress(keyCode uint32, modifiers ...uint32) error {
+	inputs := make([]keyboardInput, 0, 2+len(modifiers)*2)
+
+	for _, modifier := range modifiers {
+		inputs = append(inputs, keyboardInput{Type: INPUT_KEYBOARD, Ki: KEYBDINPUT{WVk: uint16(modifier)}})
+	}
+	inputs = append(inputs,
+		keyboardInput{Type: INPUT_KEYBOARD, Ki: KEYBDINPUT{WVk: uint16(keyCode)}},
+		keyboardInput{Type: INPUT_KEYBOARD, Ki: KEYBDINPUT{WVk: uint16(keyCode), DwFlags: KEYEVENTF_KEYUP}},
+	)
+	for i := len(modifiers) - 1; i >= 0; i-- {
+		inputs = append(inputs, keyboardInput{Type: INPUT_KEYBOARD, Ki: KEYBDINPUT{WVk: uint16(modifiers[i]), DwFlags: KEYEVENTF_KEYUP}})
+	}
+
+	return sendKeyboardInputs(inputs)
+}
+
+func sendMouseInputs(inputs []mouseInput) error {
+	ret, _, err := procSendInput.Call(uintptr(len(inputs)),
+		uintptr(unsafe.Pointer(&inputs[0])), unsafe.Sizeof(inputs[0]))
+	if int(ret) != len(inputs) {
+		return NewWorkflowError(ErrorTypeSystem, "SendInput rejected mouse input", err)
+	}
+	return nil
+}
+
+func sendKeyboardInputs(inputs []keyboardInput) error {
+	if unsafe.Sizeof(inputs[0]) != unsafe.Sizeof(mouseInput{}) {
+		return errors.New("keyboard INPUT layout does not match mouse INPUT layout")
+	}
+
+	ret, _, err := procSendInput.Call(uintptr(len(inputs)),
+		uintptr(unsafe.Pointer(&inputs[0])), unsafe.Sizeof(inputs[0]))
+	if int(ret) != len(inputs) {
+		return NewWorkflowError(ErrorTypeSystem, "SendInput rejected keyboard input", err)
+	}
+	return nil
+}
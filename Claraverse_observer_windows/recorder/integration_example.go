@@ -1,4 +1,4 @@
-package main
+package recorder
 
 import (
 	"encoding/json"
@@ -20,12 +20,14 @@ type EnhancedWorkflowRecorder struct {
 	TextSelectionTracker *TextSelectionTracker
 	DragDropTracker      *DragDropTracker
 	RateLimiter          *RateLimiter
+	Deduplicator         *EventDeduplicator
+	Health               *TrackerHealthMonitor
 
 	// Event recording
 	Events      []WorkflowEvent
 	EventsMutex sync.RWMutex
 	StartTime   time.Time
-	IsRecording bool
+	State       *RecorderStateMachine
 
 	// Performance monitoring
 	LastEventTime      time.Time
@@ -44,11 +46,15 @@ func NewEnhancedWorkflowRecorder(config *EnhancedWorkflowRecorderConfig) (*Enhan
 		Config:    config,
 		Events:    make([]WorkflowEvent, 0),
 		StartTime: time.Now(),
+		State:     NewRecorderStateMachine(),
 	}
 
+	// Per-tracker toggles and health
+	recorder.Health = NewTrackerHealthMonitor(config.WorkflowRecorderConfig)
+
 	// Initialize all trackers with unified event handling
 	recorder.TextInputManager = NewTextInputManager(
-		3*time.Second, // 3 second completion timeout
+		time.Duration(config.TextInputCompletionTimeoutMs)*time.Millisecond,
 		recorder.handleTextInputEvent,
 	)
 
@@ -63,6 +69,7 @@ func NewEnhancedWorkflowRecorder(config *EnhancedWorkflowRecorderConfig) (*Enhan
 	recorder.TextSelectionTracker = NewTextSelectionTracker(
 		recorder.handleTextSelectionEvent,
 	)
+	recorder.TextSelectionTracker.ClipboardFallback = config.SelectionClipboardFallback
 
 	recorder.DragDropTracker = NewDragDropTracker(
 		recorder.handleDragDropEvent,
@@ -71,20 +78,28 @@ func NewEnhancedWorkflowRecorder(config *EnhancedWorkflowRecorderConfig) (*Enhan
 	// Create rate limiter if configured
 	recorder.RateLimiter = config.CreateRateLimiter()
 
+	// Suppress hook/polling bounce
+	recorder.Deduplicator = NewEventDeduplicator(time.Duration(config.DedupeWindowMs) * time.Millisecond)
+
 	return recorder, nil
 }
 
 // StartRecording begins the enhanced workflow recording
 func (ewr *EnhancedWorkflowRecorder) StartRecording() error {
-	if ewr.IsRecording {
-		return NewWorkflowError(ErrorTypeRecording, "Recording already in progress", nil)
+	if err := ewr.State.Transition(RecorderStateStarting); err != nil {
+		return NewWorkflowError(ErrorTypeRecording, "Recording already in progress", err)
 	}
 
-	ewr.IsRecording = true
+	ewr.EventsMutex.Lock()
 	ewr.StartTime = time.Now()
 	ewr.Events = make([]WorkflowEvent, 0)
+	ewr.EventsMutex.Unlock()
+
+	if err := ewr.State.Transition(RecorderStateRecording); err != nil {
+		return err
+	}
 
-	log.Printf("Enhanced workflow recording started with %s performance mode", ewr.Config.PerformanceMode)
+	logger("recording").Info("Enhanced workflow recording started", "performance_mode", ewr.Config.PerformanceMode)
 	ewr.Config.LogPerformanceSettings()
 
 	return nil
@@ -92,94 +107,115 @@ func (ewr *EnhancedWorkflowRecorder) StartRecording() error {
 
 // StopRecording stops the workflow recording
 func (ewr *EnhancedWorkflowRecorder) StopRecording() {
-	if !ewr.IsRecording {
+	if err := ewr.State.Transition(RecorderStateStopping); err != nil {
 		return
 	}
 
-	ewr.IsRecording = false
-
 	// Complete any active text input sessions
-	ewr.TextInputManager.CompleteAllActiveInputs()
+	ewr.Health.Run(TrackerTextInput, ewr.TextInputManager.CompleteAllActiveInputs)
+
+	ewr.State.Transition(RecorderStateFinalized)
 
 	duration := time.Since(ewr.StartTime)
-	log.Printf("Enhanced workflow recording stopped after %s", FormatDuration(duration))
-	log.Printf("Recorded %d events (%d filtered out)", ewr.EventCount, ewr.FilteredEventCount)
+	logger("recording").Info("Enhanced workflow recording stopped", "duration", FormatDuration(duration),
+		"events", ewr.EventCount, "filtered", ewr.FilteredEventCount)
+}
+
+// PauseRecording suspends event capture without ending the recording
+func (ewr *EnhancedWorkflowRecorder) PauseRecording() error {
+	return ewr.State.Transition(RecorderStatePaused)
+}
+
+// ResumeRecording continues a paused recording
+func (ewr *EnhancedWorkflowRecorder) ResumeRecording() error {
+	if !ewr.State.Is(RecorderStatePaused) {
+		return NewWorkflowError(ErrorTypeRecording, "Recording is not paused", nil)
+	}
+	return ewr.State.Transition(RecorderStateRecording)
+}
+
+// acceptsTrackerEvents reports whether tracker callbacks should be recorded.
+// Trackers deliver asynchronously, so events flushed while stopping (e.g.
+// text inputs completed at session end) are still kept.
+func (ewr *EnhancedWorkflowRecorder) acceptsTrackerEvents() bool {
+	return ewr.State.Is(RecorderStateRecording, RecorderStateStopping)
 }
 
 // Event handlers for different event types
 
 func (ewr *EnhancedWorkflowRecorder) handleTextInputEvent(event TextInputCompletedEvent) {
-	if !ewr.IsRecording {
+	ewr.Health.RecordEvent(TrackerTextInput)
+	if !ewr.acceptsTrackerEvents() {
 		return
 	}
 
 	if ewr.shouldRecordEvent(event) {
 		ewr.addEvent(event)
-		log.Printf("Text input completed: '%s' via %s",
-			TruncateString(event.TextValue, 50, "..."), event.InputMethod)
+		logger("trackers").Debug("Text input recorded",
+			"text", TruncateString(event.TextValue, 50, "..."), "method", event.InputMethod)
 	}
 }
 
 func (ewr *EnhancedWorkflowRecorder) handleBrowserNavigationEvent(event BrowserTabNavigationEvent) {
-	if !ewr.IsRecording {
+	ewr.Health.RecordEvent(TrackerBrowserTabs)
+	if !ewr.acceptsTrackerEvents() {
 		return
 	}
 
 	if ewr.shouldRecordEvent(event) {
 		ewr.addEvent(event)
-		log.Printf("Browser navigation: %s %s -> %s",
-			event.Browser,
-			TruncateString(event.FromURL, 50, "..."),
-			TruncateString(event.ToURL, 50, "..."))
+		logger("trackers").Debug("Browser navigation recorded", "browser", event.Browser,
+			"from", TruncateString(event.FromURL, 50, "..."), "to", TruncateString(event.ToURL, 50, "..."))
 	}
 }
 
 func (ewr *EnhancedWorkflowRecorder) handleHotkeyEvent(event HotkeyEvent) {
-	if !ewr.IsRecording {
+	ewr.Health.RecordEvent(TrackerHotkeys)
+	if !ewr.acceptsTrackerEvents() {
 		return
 	}
 
 	// Process hotkey for other trackers
 	currentElement := getCurrentUIElement()
-	ewr.BrowserTabTracker.HandleHotkey(event.Combination, currentElement)
-	ewr.TextSelectionTracker.HandleKeyboardShortcut(event.Combination)
+	ewr.Health.Run(TrackerBrowserTabs, func() { ewr.BrowserTabTracker.HandleHotkey(event.Combination, currentElement) })
+	ewr.Health.Run(TrackerTextSelection, func() { ewr.TextSelectionTracker.HandleKeyboardShortcut(event.Combination) })
 
 	if ewr.shouldRecordEvent(event) {
 		ewr.addEvent(event)
-		log.Printf("Hotkey detected: %s (%s)", event.Combination, event.Action)
+		logger("trackers").Debug("Hotkey recorded", "combination", event.Combination, "action", event.Action)
 	}
 }
 
 func (ewr *EnhancedWorkflowRecorder) handleTextSelectionEvent(event TextSelectionEvent) {
-	if !ewr.IsRecording {
+	ewr.Health.RecordEvent(TrackerTextSelection)
+	if !ewr.acceptsTrackerEvents() {
 		return
 	}
 
 	if ewr.shouldRecordEvent(event) {
 		ewr.addEvent(event)
-		log.Printf("Text selection: '%s' via %s",
-			TruncateString(event.SelectedText, 50, "..."), event.SelectionMethod)
+		logger("trackers").Debug("Text selection recorded",
+			"text", TruncateString(event.SelectedText, 50, "..."), "method", event.SelectionMethod)
 	}
 }
 
 func (ewr *EnhancedWorkflowRecorder) handleDragDropEvent(event DragDropEvent) {
-	if !ewr.IsRecording {
+	ewr.Health.RecordEvent(TrackerDragDrop)
+	if !ewr.acceptsTrackerEvents() {
 		return
 	}
 
 	if ewr.shouldRecordEvent(event) {
 		ewr.addEvent(event)
-		log.Printf("Drag & drop: %s content from (%d,%d) to (%d,%d), success: %t",
-			event.DataType,
-			event.StartPosition.X, event.StartPosition.Y,
-			event.EndPosition.X, event.EndPosition.Y,
-			event.Success)
+		logger("trackers").Debug("Drag and drop recorded", "data_type", event.DataType,
+			"from_x", event.StartPosition.X, "from_y", event.StartPosition.Y,
+			"to_x", event.EndPosition.X, "to_y", event.EndPosition.Y, "success", event.Success)
 	}
 }
 
 // Enhanced mouse event handling that integrates with all trackers
 func (ewr *EnhancedWorkflowRecorder) HandleMouseEvent(eventType MouseEventType, button MouseButton, position Position, scrollDelta *[2]int32) {
-	if !ewr.IsRecording {
+	if !ewr.State.IsCapturing() {
 		return
 	}
 
@@ -188,16 +224,19 @@ func (ewr *EnhancedWorkflowRecorder) HandleMouseEvent(eventType MouseEventType,
 	// Pass to trackers
 	switch eventType {
 	case MouseDown:
-		ewr.TextSelectionTracker.HandleMouseDown(position, button)
-		ewr.DragDropTracker.HandleMouseDown(position, button, currentElement)
+		ewr.Health.Run(TrackerTextSelection, func() { ewr.TextSelectionTracker.HandleMouseDown(position, button) })
+		ewr.Health.Run(TrackerDragDrop, func() { ewr.DragDropTracker.HandleMouseDown(position, button, currentElement) })
 	case MouseMove:
-		ewr.TextSelectionTracker.HandleMouseMove(position)
-		ewr.DragDropTracker.HandleMouseMove(position)
+		ewr.Health.Run(TrackerTextSelection, func() { ewr.TextSelectionTracker.HandleMouseMove(position) })
+		ewr.Health.Run(TrackerDragDrop, func() { ewr.DragDropTracker.HandleMouseMove(position) })
 	case MouseUp:
-		ewr.TextSelectionTracker.HandleMouseUp(position, button)
-		ewr.DragDropTracker.HandleMouseUp(position, button, currentElement)
+		ewr.Health.Run(TrackerTextSelection, func() { ewr.TextSelectionTracker.HandleMouseUp(position, button) })
+		ewr.Health.Run(TrackerDragDrop, func() { ewr.DragDropTracker.HandleMouseUp(position, button, currentElement) })
 	case MouseClick:
-		ewr.BrowserTabTracker.HandleClick(position, currentElement)
+		ewr.Health.Run(TrackerBrowserTabs, func() { ewr.BrowserTabTracker.HandleClick(position, currentElement) })
+		if currentElement != nil && determineButtonInteractionType(*currentElement) == ButtonSubmit {
+			ewr.Health.Run(TrackerTextInput, func() { ewr.TextInputManager.CompleteActiveInputs("submit_click") })
+		}
 	}
 
 	// Create mouse event
@@ -216,16 +255,18 @@ func (ewr *EnhancedWorkflowRecorder) HandleMouseEvent(eventType MouseEventType,
 
 // Enhanced keyboard event handling
 func (ewr *EnhancedWorkflowRecorder) HandleKeyboardEvent(keyCode uint32, isKeyDown bool, character *string) {
-	if !ewr.IsRecording {
+	if !ewr.State.IsCapturing() {
 		return
 	}
 
 	// Pass to trackers
-	ewr.HotkeyDetector.HandleKeyPress(keyCode, isKeyDown)
-	ewr.DragDropTracker.HandleKeyPress(keyCode, isKeyDown)
+	ewr.Health.Run(TrackerHotkeys, func() { ewr.HotkeyDetector.HandleKeyPress(keyCode, isKeyDown) })
+	ewr.Health.Run(TrackerDragDrop, func() { ewr.DragDropTracker.HandleKeyPress(keyCode, isKeyDown) })
 
 	if character != nil && *character != "" {
-		ewr.TextInputManager.HandleKeystroke(keyCode, *character)
+		ewr.Health.Run(TrackerTextInput, func() { ewr.TextInputManager.HandleKeystroke(keyCode, *character) })
+	} else if isKeyDown && textInputBoundaryReason(keyCode) != "" {
+		ewr.Health.Run(TrackerTextInput, func() { ewr.TextInputManager.HandleKeystroke(keyCode, "") })
 	}
 
 	// Create keyboard event
@@ -244,7 +285,7 @@ func (ewr *EnhancedWorkflowRecorder) HandleKeyboardEvent(keyCode uint32, isKeyDo
 
 // Window change handling for application switches and browser navigation
 func (ewr *EnhancedWorkflowRecorder) HandleWindowChange() {
-	if !ewr.IsRecording {
+	if !ewr.State.IsCapturing() {
 		return
 	}
 
@@ -254,11 +295,11 @@ func (ewr *EnhancedWorkflowRecorder) HandleWindowChange() {
 	}
 
 	// Pass to trackers
-	ewr.BrowserTabTracker.HandleWindowChange(currentElement)
+	ewr.Health.Run(TrackerBrowserTabs, func() { ewr.BrowserTabTracker.HandleWindowChange(currentElement) })
 
 	// Check for text input elements
 	if IsTextInputElement(currentElement) {
-		ewr.TextInputManager.StartTextInput(currentElement)
+		ewr.Health.Run(TrackerTextInput, func() { ewr.TextInputManager.StartTextInput(currentElement) })
 	}
 }
 
@@ -266,7 +307,7 @@ func (ewr *EnhancedWorkflowRecorder) HandleWindowChange() {
 
 func (ewr *EnhancedWorkflowRecorder) shouldRecordEvent(event interface{}) bool {
 	// Apply rate limiting if configured
-	if ewr.RateLimiter != nil && !ewr.RateLimiter.Allow() {
+	if ewr.RateLimiter != nil && !ewr.RateLimiter.Allow(event) {
 		ewr.FilteredEventCount++
 		return false
 	}
@@ -277,6 +318,11 @@ func (ewr *EnhancedWorkflowRecorder) shouldRecordEvent(event interface{}) bool {
 		return false
 	}
 
+	// Drop repeats of an event already recorded inside the dedupe window
+	if ewr.Deduplicator.IsDuplicate(event) {
+		return false
+	}
+
 	return true
 }
 
@@ -296,14 +342,17 @@ func (ewr *EnhancedWorkflowRecorder) SaveWorkflow(name string) error {
 	}
 
 	workflow := RecordedWorkflow{
-		Name:      name,
-		StartTime: uint64(ewr.StartTime.UnixNano() / int64(time.Millisecond)),
-		EndTime:   GetCurrentTimestamp(),
-		Events:    ewr.Events,
+		SchemaVersion: SchemaVersion,
+		Name:          name,
+		StartTime:     uint64(ewr.StartTime.UnixNano() / int64(time.Millisecond)),
+		EndTime:       GetCurrentTimestamp(),
+		Events:        ewr.Events,
 	}
+	workflow.Segments = NewTaskSegmenter(ewr.Config.WorkflowRecorderConfig).Segment(workflow.Events, workflow.EndTime)
+	workflow.Steps = summarizeSteps(workflow.Events)
 
 	filename := GenerateWorkflowFilename(name, "json")
-	return SaveJSONToFile(workflow, filename)
+	return SaveJSONToFile(&workflow, filename)
 }
 
 // GetStatistics returns recording statistics
@@ -315,9 +364,11 @@ func (ewr *EnhancedWorkflowRecorder) GetStatistics() map[string]interface{} {
 		"recording_duration": FormatDuration(time.Since(ewr.StartTime)),
 		"total_events":       ewr.EventCount,
 		"filtered_events":    ewr.FilteredEventCount,
+		"duplicate_events":   ewr.Deduplicator.GetSuppressedCount(),
 		"events_in_memory":   len(ewr.Events),
 		"performance_mode":   ewr.Config.PerformanceMode.String(),
-		"is_recording":       ewr.IsRecording,
+		"is_recording":       ewr.State.IsActive(),
+		"state":              ewr.State.GetState(),
 	}
 
 	// Event type breakdown
@@ -343,6 +394,10 @@ func (ewr *EnhancedWorkflowRecorder) GetStatistics() map[string]interface{} {
 		}
 	}
 	stats["event_types"] = eventTypes
+	stats["trackers"] = ewr.Health.GetStatistics()
+	if ewr.RateLimiter != nil {
+		stats["rate_limited"] = ewr.RateLimiter.GetStatistics()
+	}
 
 	return stats
 }
@@ -393,7 +448,7 @@ func RunEnhancedWorkflowRecorderExample() {
 
 	// Wait for shutdown signal
 	<-sigChan
-	log.Println("Shutdown signal received")
+	logger("recording").Info("Shutdown signal received")
 
 	// Stop recording
 	recorder.StopRecording()
@@ -401,13 +456,13 @@ func RunEnhancedWorkflowRecorderExample() {
 	// Print statistics
 	stats := recorder.GetStatistics()
 	statsJSON, _ := json.MarshalIndent(stats, "", "  ")
-	fmt.Printf("Recording Statistics:\n%s\n", statsJSON)
+	printConsole(fmt.Sprintf("Recording Statistics:\n%s", statsJSON))
 
 	// Save workflow
 	if err := recorder.SaveWorkflow("example_enhanced_workflow"); err != nil {
-		log.Printf("Failed to save workflow: %v", err)
+		logger("recording").Error("Failed to save workflow", "error", err)
 	} else {
-		log.Println("Workflow saved successfully")
+		logger("recording").Info("Workflow saved")
 	}
 }
 
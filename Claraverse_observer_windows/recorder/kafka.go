@@ -0,0 +1,414 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// A minimal Kafka producer for the kafka event sink, speaking the Kafka wire
+// protocol directly: Metadata (v4) finds the leader of the partition events
+// go to, and Produce (v3) sends each batch as one uncompressed record batch
+// (magic 2), acknowledged by the leader. All the events of a recording go to
+// one partition, picked from its name, so they stay in order; the record key
+// is the recording name. There is no TLS or SASL, so brokers must accept
+// plaintext connections from the recorder.
+
+const (
+	kafkaAPIProduce       = 0
+	kafkaAPIMetadata      = 3
+	kafkaProduceVersion   = 3
+	kafkaMetadataVersion  = 4
+	kafkaClientID         = "claraverse-recorder"
+	kafkaAcksLeader       = 1
+	kafkaProduceTimeoutMs = 10000
+	kafkaDialTimeout      = 5 * time.Second
+	kafkaIOTimeout        = 15 * time.Second
+)
+
+var kafkaCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// KafkaProducer produces records to a topic
+type KafkaProducer struct {
+	Brokers       []string
+	Topic         string
+	conn          net.Conn
+	reader        *bufio.Reader
+	leader        string  // Address of the leader conn is connected to
+	partitions    []int32 // Partition IDs of the topic
+	leaders       map[int32]string
+	correlationID int32
+	Mutex         sync.Mutex
+}
+
+// newKafkaSink produces batches of events to a Kafka topic
+func newKafkaSink(config EventSinkConfig) (EventSink, error) {
+	producer := &KafkaProducer{Brokers: config.Brokers, Topic: config.Topic}
+	sink := &kafkaSink{Producer: producer}
+	sink.batchSink = newBatchSink(config, sink.send)
+	return sink, nil
+}
+
+// kafkaSink batches events for a KafkaProducer
+type kafkaSink struct {
+	*batchSink
+	Producer *KafkaProducer
+}
+
+// send produces a batch keyed by the recording its first event is from
+func (s *kafkaSink) send(batch [][]byte) error {
+	return s.Producer.Produce(kafkaBatchKey(batch), batch)
+}
+
+// Close sends what is buffered and disconnects
+func (s *kafkaSink) Close() error {
+	err := s.batchSink.Close()
+	s.Producer.Close()
+	return err
+}
+
+// kafkaBatchKey reads the recording name from the first event of a batch
+func kafkaBatchKey(batch [][]byte) []byte {
+	var event struct {
+		Recording string `json:"recording"`
+	}
+	if len(batch) > 0 {
+		json.Unmarshal(batch[0], &event)
+	}
+	return []byte(event.Recording)
+}
+
+// Produce sends values with key to the key's partition, reconnecting once
+// when the connection or the partition's leader has gone
+func (p *KafkaProducer) Produce(key []byte, values [][]byte) error {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+
+	err := p.produce(key, values)
+	if err != nil {
+		p.disconnect()
+		p.partitions = nil
+		err = p.produce(key, values)
+	}
+	return err
+}
+
+// Close drops the connection
+func (p *KafkaProducer) Close() {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+
+	p.disconnect()
+}
+
+func (p *KafkaProducer) produce(key []byte, values [][]byte) error {
+	if len(p.partitions) == 0 {
+		if err := p.refreshMetadata(); err != nil {
+			return err
+		}
+	}
+	partition := p.partitions[crc32.ChecksumIEEE(key)%uint32(len(p.partitions))]
+	leader, ok := p.leaders[partition]
+	if !ok {
+		return fmt.Errorf("partition %d of %s has no leader", partition, p.Topic)
+	}
+	if err := p.connect(leader); err != nil {
+		return err
+	}
+
+	var request kafkaEncoder
+	request.int16(-1) // No transactional ID
+	request.int16(kafkaAcksLeader)
+	request.int32(kafkaProduceTimeoutMs)
+	request.int32(1)
+	request.string(p.Topic)
+	request.int32(1)
+	request.int32(partition)
+	request.bytes(kafkaRecordBatch(key, values, time.Now()))
+
+	response, err := p.roundTrip(kafkaAPIProduce, kafkaProduceVersion, request.buf)
+	if err != nil {
+		return err
+	}
+	decoder := kafkaDecoder{buf: response}
+	for topics := decoder.int32(); topics > 0 && decoder.err == nil; topics-- {
+		decoder.string()
+		for partitions := decoder.int32(); partitions > 0 && decoder.err == nil; partitions-- {
+			decoder.int32()
+			if code := decoder.int16(); code != 0 {
+				return fmt.Errorf("kafka refused the batch with error %d", code)
+			}
+			decoder.int64()
+			decoder.int64()
+		}
+	}
+	return decoder.err
+}
+
+// refreshMetadata looks up the partitions of the topic and their leaders
+// through the first broker that answers
+func (p *KafkaProducer) refreshMetadata() error {
+	var lastErr error
+	for _, broker := range p.Brokers {
+		if err := p.connect(broker); err != nil {
+			lastErr = err
+			continue
+		}
+
+		var request kafkaEncoder
+		request.int32(1)
+		request.string(p.Topic)
+		request.bool(true) // Create the topic where brokers allow it
+
+		response, err := p.roundTrip(kafkaAPIMetadata, kafkaMetadataVersion, request.buf)
+		if err != nil {
+			p.disconnect()
+			lastErr = err
+			continue
+		}
+		return p.readMetadata(response)
+	}
+	return fmt.Errorf("no Kafka broker answered: %w", lastErr)
+}
+
+// readMetadata reads a Metadata v4 response
+func (p *KafkaProducer) readMetadata(response []byte) error {
+	decoder := kafkaDecoder{buf: response}
+	decoder.int32() // Throttle time
+
+	addresses := make(map[int32]string)
+	for brokers := decoder.int32(); brokers > 0 && decoder.err == nil; brokers-- {
+		id := decoder.int32()
+		host := decoder.string()
+		port := decoder.int32()
+		decoder.string() // Rack
+		addresses[id] = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	decoder.string() // Cluster ID
+	decoder.int32()  // Controller ID
+
+	p.partitions, p.leaders = nil, make(map[int32]string)
+	for topics := decoder.int32(); topics > 0 && decoder.err == nil; topics-- {
+		code := decoder.int16()
+		name := decoder.string()
+		decoder.bool() // Internal
+		for partitions := decoder.int32(); partitions > 0 && decoder.err == nil; partitions-- {
+			decoder.int16()
+			id := decoder.int32()
+			leader := decoder.int32()
+			decoder.int32Array() // Replicas
+			decoder.int32Array() // In-sync replicas
+			if name == p.Topic && code == 0 {
+				p.partitions = append(p.partitions, id)
+				if address, ok := addresses[leader]; ok {
+					p.leaders[id] = address
+				}
+			}
+		}
+		if name == p.Topic && code != 0 {
+			return fmt.Errorf("kafka has no topic %s (error %d)", p.Topic, code)
+		}
+	}
+	if decoder.err != nil {
+		return decoder.err
+	}
+	if len(p.partitions) == 0 {
+		return fmt.Errorf("kafka topic %s has no partitions yet", p.Topic)
+	}
+	return nil
+}
+
+// connect makes sure the connection is to address
+func (p *KafkaProducer) connect(address string) error {
+	if p.conn != nil && p.leader == address {
+		return nil
+	}
+	p.disconnect()
+
+	conn, err := net.DialTimeout("tcp", address, kafkaDialTimeout)
+	if err != nil {
+		return err
+	}
+	p.conn, p.reader, p.leader = conn, bufio.NewReader(conn), address
+	return nil
+}
+
+func (p *KafkaProducer) disconnect() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.reader, p.leader = nil, nil, ""
+	}
+}
+
+// roundTrip sends a request and returns the response after its correlation ID
+func (p *KafkaProducer) roundTrip(apiKey, version int16, body []byte) ([]byte, error) {
+	p.correlationID++
+
+	var request kafkaEncoder
+	request.int32(0) // Size, set below
+	request.int16(apiKey)
+	request.int16(version)
+	request.int32(p.correlationID)
+	request.string(kafkaClientID)
+	request.buf = append(request.buf, body...)
+	binary.BigEndian.PutUint32(request.buf, uint32(len(request.buf)-4))
+
+	p.conn.SetDeadline(time.Now().Add(kafkaIOTimeout))
+	if _, err := p.conn.Write(request.buf); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(p.reader, size[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(p.reader, response); err != nil {
+		return nil, err
+	}
+	if len(response) < 4 || int32(binary.BigEndian.Uint32(response)) != p.correlationID {
+		return nil, errors.New("kafka answered out of turn")
+	}
+	return response[4:], nil
+}
+
+// kafkaRecordBatch encodes values as a record batch (magic 2)
+func kafkaRecordBatch(key []byte, values [][]byte, now time.Time) []byte {
+	timestamp := now.UnixMilli()
+
+	var records []byte
+	for i, value := range values {
+		var record []byte
+		record = append(record, 0) // Attributes
+		record = binary.AppendVarint(record, 0)
+		record = binary.AppendVarint(record, int64(i))
+		record = binary.AppendVarint(record, int64(len(key)))
+		record = append(record, key...)
+		record = binary.AppendVarint(record, int64(len(value)))
+		record = append(record, value...)
+		record = binary.AppendVarint(record, 0) // Headers
+
+		records = binary.AppendVarint(records, int64(len(record)))
+		records = append(records, record...)
+	}
+
+	// Everything the CRC covers, from the attributes on
+	var body kafkaEncoder
+	body.int16(0) // Attributes: no compression
+	body.int32(int32(len(values) - 1))
+	body.int64(timestamp)
+	body.int64(timestamp)
+	body.int64(-1) // Producer ID
+	body.int16(-1) // Producer epoch
+	body.int32(-1) // Base sequence
+	body.int32(int32(len(values)))
+	body.buf = append(body.buf, records...)
+
+	var batch kafkaEncoder
+	batch.int64(0) // Base offset
+	batch.int32(int32(4 + 1 + 4 + len(body.buf)))
+	batch.int32(-1) // Partition leader epoch
+	batch.buf = append(batch.buf, 2)
+	batch.int32(int32(crc32.Checksum(body.buf, kafkaCRC)))
+	batch.buf = append(batch.buf, body.buf...)
+	return batch.buf
+}
+
+// kafkaEncoder writes the big-endian fields of Kafka requests
+type kafkaEncoder struct {
+	buf []byte
+}
+
+func (e *kafkaEncoder) int16(v int16) { e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) }
+func (e *kafkaEncoder) int32(v int32) { e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v)) }
+func (e *kafkaEncoder) int64(v int64) { e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v)) }
+
+func (e *kafkaEncoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// kafkaDecoder reads the fields of Kafka responses, remembering the first
+// time it runs out of data
+type kafkaDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *kafkaDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errors.New("kafka response is truncated")
+		d.buf = nil
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) bool() bool {
+	b := d.take(1)
+	return b != nil && b[0] != 0
+}
+
+// string reads a string, nullable or not; null reads as ""
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *kafkaDecoder) int32Array() []int32 {
+	n := d.int32()
+	var values []int32
+	for ; n > 0 && d.err == nil; n-- {
+		values = append(values, d.int32())
+	}
+	return values
+}
@@ -0,0 +1,168 @@
+package recorder
+
+import (
+	"unicode"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// Keyboard layouts. The character a key types depends on the keyboard layout
+// of the window it goes to: the key code for Q types "a" on AZERTY, Shift+2
+// types '"' on QWERTZ and AltGr+Q types "@". Each pass of the capture loop
+// looks up the layout (HKL) of the foreground window's thread, and key
+// presses are translated with ToUnicodeEx against a keyboard state rebuilt
+// from the modifiers held, without touching the keyboard state the layout
+// keeps for dead keys. A dead key (an accent typed before its letter) types
+// nothing itself; the key after it is translated after the dead key again,
+// this time letting the layout combine the two, so ´ then e is recorded as
+// "é". Without a layout the US mapping of keyCharacter is used.
+
+var (
+	procToUnicodeEx       = user32.NewProc("ToUnicodeEx")
+	procMapVirtualKeyEx   = user32.NewProc("MapVirtualKeyExW")
+	procGetKeyboardLayout = user32.NewProc("GetKeyboardLayout")
+)
+
+const (
+	MAPVK_VK_TO_VSC = 0
+	VK_LCONTROL     = 0xA2
+	VK_RMENU        = 0xA5
+
+	// toUnicodeKeepState asks ToUnicodeEx to leave the layout's dead key
+	// state alone (Windows 10 1607 and later)
+	toUnicodeKeepState = 0x4
+)
+
+// deadKey is a dead key waiting for the key it accents
+type deadKey struct {
+	KeyCode uint32
+	State   [256]byte
+}
+
+// KeyTranslator turns key presses into the characters they type in the
+// keyboard layout of the window in front
+type KeyTranslator struct {
+	Layout    uintptr         // Keyboard layout of the window in front; 0 when unknown
+	Dead      *deadKey        // Dead key typed before the next key
+	Typed     map[uint32]bool // Keys down that type a character, dead keys included
+	LayoutOf  func() uintptr  // Looks up the layout of the window in front
+	ToUnicode func(keyCode uint32, state *[256]byte, layout uintptr, flags uint32) (string, int)
+}
+
+// NewKeyTranslator creates a translator for the layout of the window in front
+func NewKeyTranslator() *KeyTranslator {
+	return &KeyTranslator{
+		Typed:     make(map[uint32]bool),
+		LayoutOf:  foregroundKeyboardLayout,
+		ToUnicode: toUnicodeEx,
+	}
+}
+
+// Refresh looks up the layout of the window in front. A dead key does not
+// carry over to another layout.
+func (t *KeyTranslator) Refresh() {
+	layout := t.LayoutOf()
+	if layout != t.Layout {
+		t.Dead = nil
+	}
+	t.Layout = layout
+}
+
+// Character returns the character a key going down types, or "" for
+// non-printing keys, dead keys and shortcuts
+func (t *KeyTranslator) Character(keyCode uint32, modifiers ModifierStates, capsLock bool) string {
+	char := t.translate(keyCode, modifiers, capsLock)
+	t.Typed[keyCode] = char != "" || (t.Dead != nil && t.Dead.KeyCode == keyCode)
+	return char
+}
+
+// Released reports whether a key going up typed a character when it went
+// down
+func (t *KeyTranslator) Released(keyCode uint32) bool {
+	typed := t.Typed[keyCode]
+	delete(t.Typed, keyCode)
+	return typed
+}
+
+// translate maps a key press to its character in the current layout
+func (t *KeyTranslator) translate(keyCode uint32, modifiers ModifierStates, capsLock bool) string {
+	if t.Layout == 0 {
+		return keyCharacter(keyCode, modifiers, capsLock)
+	}
+	// Ctrl and Alt held together are AltGr; either alone, or Win, is a shortcut
+	if modifiers.Win || modifiers.Ctrl != modifiers.Alt {
+		return ""
+	}
+
+	state := keyboardState(modifiers, capsLock)
+	text, count := t.ToUnicode(keyCode, &state, t.Layout, toUnicodeKeepState)
+	switch {
+	case count < 0:
+		t.Dead = &deadKey{KeyCode: keyCode, State: state}
+		return ""
+	case count == 0:
+		// Modifiers and keys the layout does not map leave a dead key waiting
+		return ""
+	}
+
+	if t.Dead != nil {
+		dead := t.Dead
+		t.Dead = nil
+		// The second call consumes the dead key state the first one set
+		t.ToUnicode(dead.KeyCode, &dead.State, t.Layout, 0)
+		if combined, n := t.ToUnicode(keyCode, &state, t.Layout, 0); n > 0 {
+			text = combined
+		}
+	}
+	for _, r := range text {
+		if unicode.IsControl(r) {
+			return "" // Enter, Tab, Backspace and Esc
+		}
+	}
+	return text
+}
+
+// keyboardState builds the key state array ToUnicodeEx reads modifiers from
+func keyboardState(modifiers ModifierStates, capsLock bool) [256]byte {
+	var state [256]byte
+	if modifiers.Shift {
+		state[VK_SHIFT] = 0x80
+	}
+	if modifiers.Ctrl && modifiers.Alt {
+		state[VK_CONTROL], state[VK_LCONTROL] = 0x80, 0x80
+		state[VK_MENU], state[VK_RMENU] = 0x80, 0x80
+	}
+	if capsLock {
+		state[VK_CAPITAL] = 0x01
+	}
+	return state
+}
+
+// toUnicodeEx translates a key with ToUnicodeEx, returning the text and the
+// count it reports: negative for a dead key
+func toUnicodeEx(keyCode uint32, state *[256]byte, layout uintptr, flags uint32) (string, int) {
+	scanCode, _, _ := procMapVirtualKeyEx.Call(uintptr(keyCode), MAPVK_VK_TO_VSC, layout)
+	var buffer [8]uint16
+	ret, _, _ := procToUnicodeEx.Call(uintptr(keyCode), scanCode, uintptr(unsafe.Pointer(&state[0])),
+		uintptr(unsafe.Pointer(&buffer[0])), uintptr(len(buffer)), uintptr(flags), layout)
+	count := int(int32(ret))
+	if count < 0 {
+		return string(utf16.Decode(buffer[:1])), count
+	}
+	return string(utf16.Decode(buffer[:min(count, len(buffer))])), count
+}
+
+// foregroundKeyboardLayout returns the keyboard layout of the window in
+// front, or 0 when there is none
+func foregroundKeyboardLayout() uintptr {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		return 0
+	}
+	thread, _, _ := procGetWindowThreadProcessId.Call(hwnd, 0)
+	if thread == 0 {
+		return 0
+	}
+	layout, _, _ := procGetKeyboardLayout.Call(thread)
+	return layout
+}
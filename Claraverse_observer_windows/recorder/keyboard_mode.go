@@ -0,0 +1,290 @@
+package recorder
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Keyboard mode, for keyboard-driven work in terminals and IDEs. Set
+// KeyboardMode, or keyboard_mode in an application profile, and mouse moves
+// are not recorded while every key transition is, past the noise filter and
+// rate limits. Key presses with modifiers carry their chord ("Ctrl+Shift+P")
+// and key presses carry the text caret's screen position when the focused
+// window shows one. In terminals the line being typed is rebuilt from the
+// keys, edits included, and a CommandEnteredEvent records it on Enter.
+
+var (
+	procGetGUIThreadInfo = user32.NewProc("GetGUIThreadInfo")
+	procClientToScreen   = user32.NewProc("ClientToScreen")
+)
+
+// TrackerCommands names the command line tracker in tracker health
+const TrackerCommands = "command_line"
+
+// terminalApplications are the processes whose typed lines are commands
+var terminalApplications = []string{
+	"cmd.exe", "powershell.exe", "pwsh.exe", "windowsterminal.exe", "openconsole.exe",
+	"conhost.exe", "wsl.exe", "bash.exe", "mintty.exe", "alacritty.exe",
+	"wezterm-gui.exe", "conemu64.exe", "conemu.exe", "putty.exe", "kitty.exe",
+}
+
+// CommandEnteredEvent is a command line typed into a terminal and run
+type CommandEnteredEvent struct {
+	Command     string        `json:"command"`
+	Application string        `json:"application"`
+	Complete    bool          `json:"complete"` // False when history, completion or a paste added text the keys do not show
+	Metadata    EventMetadata `json:"metadata"`
+}
+
+// GUITHREADINFO is the Win32 structure GetGUIThreadInfo fills
+type GUITHREADINFO struct {
+	cbSize        uint32
+	flags         uint32
+	hwndActive    uintptr
+	hwndFocus     uintptr
+	hwndCapture   uintptr
+	hwndMenuOwner uintptr
+	hwndMoveSize  uintptr
+	hwndCaret     uintptr
+	rcCaret       RECT
+}
+
+// CommandLineTracker rebuilds the line being typed in a terminal from its
+// key presses
+type CommandLineTracker struct {
+	Line        []rune
+	Cursor      int  // Rune offset of the cursor in Line
+	Complete    bool // Line holds everything on the command line
+	ProcessID   uint32
+	WindowTitle string
+	Mutex       sync.Mutex
+}
+
+// NewCommandLineTracker creates a tracker with an empty line
+func NewCommandLineTracker() *CommandLineTracker {
+	return &CommandLineTracker{Complete: true}
+}
+
+// keyboardModeEnabled reports whether keyboard mode is on anywhere in
+// config, globally or in an application profile
+func keyboardModeEnabled(config WorkflowRecorderConfig) bool {
+	if config.KeyboardMode {
+		return true
+	}
+	for _, profile := range config.ApplicationProfiles {
+		if profile.KeyboardMode != nil && *profile.KeyboardMode {
+			return true
+		}
+	}
+	return false
+}
+
+// keyboardModeConfig returns config with mouse moves filtered out and every
+// key transition kept when keyboard mode is on
+func keyboardModeConfig(config WorkflowRecorderConfig) WorkflowRecorderConfig {
+	if config.KeyboardMode {
+		config.FilterMouseNoise = true
+		config.FilterKeyboardNoise = false
+	}
+	return config
+}
+
+// isTerminalApplication reports whether an application is a terminal
+func isTerminalApplication(appName string) bool {
+	for _, terminal := range terminalApplications {
+		if strings.EqualFold(appName, terminal) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleKeyboardMode adds chords and caret positions to keyboard events and
+// feeds them to the command line tracker in terminals
+func (ct *CaptureTrackers) HandleKeyboardMode(events []WorkflowEvent, element *UIElement) []WorkflowEvent {
+	if len(events) == 0 {
+		return events
+	}
+	terminal := isTerminalApplication(element.ApplicationName)
+	caret := focusedCaretPosition()
+
+	for i, event := range events {
+		keyEvent, ok := event.(KeyboardEvent)
+		if !ok || !keyEvent.IsKeyDown {
+			continue
+		}
+		keyEvent.Chord = keyChord(keyEvent)
+		keyEvent.Caret = caret
+		events[i] = keyEvent
+
+		if terminal {
+			ct.Health.Run(TrackerCommands, func() {
+				command, complete, entered := ct.Commands.HandleKey(keyEvent, element)
+				if entered {
+					ct.enqueue(CommandEnteredEvent{
+						Command:     command,
+						Application: element.ApplicationName,
+						Complete:    complete,
+						Metadata:    keyEvent.Metadata,
+					})
+				}
+			})
+		}
+	}
+	return events
+}
+
+// HandleKey applies a key press to the line. On Enter it returns the line
+// and whether it is complete, and starts a new one.
+func (t *CommandLineTracker) HandleKey(event KeyboardEvent, element *UIElement) (string, bool, bool) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	// Another window or tab has its own line
+	if element.ProcessID != t.ProcessID || element.WindowTitle != t.WindowTitle {
+		t.reset()
+		t.ProcessID, t.WindowTitle = element.ProcessID, element.WindowTitle
+	}
+
+	modifiers := event.ModifierStates
+	switch {
+	case event.Redacted:
+		t.Complete = false
+	case event.IME && event.Character == nil:
+		// Composing; the text arrives when the IME commits it
+	case event.Character != nil:
+		t.insert([]rune(*event.Character))
+	case event.KeyCode == VK_RETURN:
+		command, complete := strings.TrimSpace(string(t.Line)), t.Complete
+		t.reset()
+		return command, complete, command != "" || !complete
+	case event.KeyCode == 0x1B: // Esc
+		t.reset()
+	case event.KeyCode == 'C' && modifiers.Ctrl:
+		t.reset()
+	case event.KeyCode == VK_BACK:
+		from := t.Cursor - 1
+		if modifiers.Ctrl {
+			from = t.wordStart()
+		}
+		if from >= 0 {
+			t.Line = append(t.Line[:from], t.Line[t.Cursor:]...)
+			t.Cursor = from
+		}
+	case event.KeyCode == 0x2E: // Delete
+		if t.Cursor < len(t.Line) {
+			t.Line = append(t.Line[:t.Cursor], t.Line[t.Cursor+1:]...)
+		}
+	case event.KeyCode == 0x25: // Left
+		if modifiers.Ctrl {
+			t.Cursor = t.wordStart()
+		} else if t.Cursor > 0 {
+			t.Cursor--
+		}
+	case event.KeyCode == 0x27: // Right
+		if modifiers.Ctrl {
+			t.Cursor = t.wordEnd()
+		} else if t.Cursor < len(t.Line) {
+			t.Cursor++
+		}
+	case event.KeyCode == 0x24: // Home
+		t.Cursor = 0
+	case event.KeyCode == 0x23: // End
+		t.Cursor = len(t.Line)
+	case event.KeyCode == 0x26 || event.KeyCode == 0x28 || event.KeyCode == 0x09 ||
+		(event.KeyCode == 'V' && modifiers.Ctrl) || (event.KeyCode == 'R' && modifiers.Ctrl):
+		// History, completion and pastes put text on the line unseen
+		t.Complete = false
+	}
+	return "", false, false
+}
+
+// insert types text at the cursor
+func (t *CommandLineTracker) insert(text []rune) {
+	line := make([]rune, 0, len(t.Line)+len(text))
+	line = append(line, t.Line[:t.Cursor]...)
+	line = append(line, text...)
+	t.Line = append(line, t.Line[t.Cursor:]...)
+	t.Cursor += len(text)
+}
+
+// wordStart returns the start of the word before the cursor
+func (t *CommandLineTracker) wordStart() int {
+	i := t.Cursor
+	for i > 0 && t.Line[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && t.Line[i-1] != ' ' {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the start of the word after the cursor
+func (t *CommandLineTracker) wordEnd() int {
+	i := t.Cursor
+	for i < len(t.Line) && t.Line[i] != ' ' {
+		i++
+	}
+	for i < len(t.Line) && t.Line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// reset starts an empty line. Called with the lock held.
+func (t *CommandLineTracker) reset() {
+	t.Line, t.Cursor, t.Complete = nil, 0, true
+}
+
+// keyChord returns the chord of a key press with modifiers, such as
+// "Ctrl+Shift+P", or "" for a modifier or a plain character
+func keyChord(event KeyboardEvent) string {
+	switch event.KeyCode {
+	case VK_CONTROL, VK_MENU, VK_SHIFT, VK_LWIN, VK_RWIN:
+		return ""
+	}
+	modifiers := event.ModifierStates
+	if !modifiers.Ctrl && !modifiers.Alt && !modifiers.Win && (!modifiers.Shift || event.Character != nil) {
+		return ""
+	}
+
+	var parts []string
+	for _, held := range []struct {
+		down bool
+		name string
+	}{{modifiers.Ctrl, "Ctrl"}, {modifiers.Alt, "Alt"}, {modifiers.Shift, "Shift"}, {modifiers.Win, "Win"}} {
+		if held.down {
+			parts = append(parts, held.name)
+		}
+	}
+	return strings.Join(append(parts, chordKeyName(event.KeyCode)), "+")
+}
+
+// chordKeyName names a key in a chord
+func chordKeyName(vk uint32) string {
+	if name, ok := keyNames[vk]; ok {
+		return name
+	}
+	if char := keyCharacter(vk, ModifierStates{}, false); char != "" {
+		return char
+	}
+	return fmt.Sprintf("Key%d", vk)
+}
+
+// focusedCaretPosition returns the screen position of the foreground
+// window's text caret, or nil when it shows none
+func focusedCaretPosition() *Position {
+	info := GUITHREADINFO{}
+	info.cbSize = uint32(unsafe.Sizeof(info))
+	if ret, _, _ := procGetGUIThreadInfo.Call(0, uintptr(unsafe.Pointer(&info))); ret == 0 || info.hwndCaret == 0 {
+		return nil
+	}
+	point := POINT{X: info.rcCaret.Left, Y: info.rcCaret.Top}
+	if ret, _, _ := procClientToScreen.Call(info.hwndCaret, uintptr(unsafe.Pointer(&point))); ret == 0 {
+		return nil
+	}
+	return &Position{X: point.X, Y: point.Y}
+}
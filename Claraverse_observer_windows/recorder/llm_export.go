@@ -0,0 +1,277 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Export of a recording compressed to a token budget, for use as context in
+// an agent prompt. Steps are kept in words, a few screenshots are kept
+// downscaled, and everything left out is reported.
+
+const (
+	defaultTokenBudget = 8000
+	// charsPerToken is the usual rough ratio for English text and JSON
+	charsPerToken          = 4
+	llmMaxKeyScreenshots   = 3
+	llmScreenshotMaxWidth  = 768
+	llmScreenshotJPEGLevel = 70
+)
+
+// llmTextLimits are the successively shorter limits for quoted text
+var llmTextLimits = []int{200, 80, 30}
+
+// LLMExport is a recording compressed to fit a token budget
+type LLMExport struct {
+	Name            string          `json:"name"`
+	DurationMs      uint64          `json:"duration_ms"`
+	TokenBudget     int             `json:"token_budget"`
+	EstimatedTokens int             `json:"estimated_tokens"`
+	Steps           []LLMStep       `json:"steps"`
+	Screenshots     []LLMScreenshot `json:"screenshots,omitempty"`
+	Dropped         LLMDropReport   `json:"dropped"`
+}
+
+// LLMStep is one step of an LLMExport
+type LLMStep struct {
+	OffsetMs    uint64 `json:"t_ms"`
+	Application string `json:"app,omitempty"`
+	Action      string `json:"action"`
+}
+
+// LLMScreenshot is a key screenshot of an LLMExport, shown after the step
+// at AfterStep (0 for before the first step)
+type LLMScreenshot struct {
+	AfterStep   int    `json:"after_step"`
+	OffsetMs    uint64 `json:"t_ms"`
+	Caption     string `json:"caption,omitempty"`
+	ImageFormat string `json:"image_format"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ImageBase64 string `json:"image_base64"`
+}
+
+// LLMDropReport says what was left out of an LLMExport
+type LLMDropReport struct {
+	Steps          int            `json:"steps"`
+	StepsByKind    map[string]int `json:"steps_by_kind,omitempty"`
+	Screenshots    int            `json:"screenshots"`
+	TruncatedTexts int            `json:"truncated_texts"`
+	LowLevelEvents int            `json:"low_level_events"`
+}
+
+// compressForLLM fits recording into budget tokens. shrink prepares a
+// screenshot for the export and reports whether it could.
+func compressForLLM(recording *SavedRecording, budget int, shrink func(RecordingScreenshot) (LLMScreenshot, bool)) LLMExport {
+	export := LLMExport{
+		Name:        recording.Name,
+		DurationMs:  recording.DurationMs(),
+		TokenBudget: budget,
+	}
+
+	// Shorten quoted text until the steps fit or the shortest limit is reached
+	var steps []RecordingStep
+	for _, limit := range llmTextLimits {
+		var truncated int
+		steps, truncated = recording.Steps(limit)
+		export.Dropped.TruncatedTexts = truncated
+		export.Steps = llmSteps(steps)
+		if estimateTokens(export) <= budget {
+			break
+		}
+	}
+	screenshots := recording.Screenshots()
+	export.Dropped.LowLevelEvents = len(recording.Events) - len(steps) - len(screenshots)
+
+	// Leave out the least important steps first
+	for priority := StepPriorityLow; priority < StepPriorityHigh && estimateTokens(export) > budget; priority++ {
+		kept := steps[:0:0]
+		for _, step := range steps {
+			if step.Priority == priority {
+				export.Dropped.dropStep(step.Kind)
+				continue
+			}
+			kept = append(kept, step)
+		}
+		steps = kept
+		export.Steps = llmSteps(steps)
+	}
+
+	// Then keep the start and end of the session, leaving out the middle
+	if estimateTokens(export) > budget && len(steps) > 2 {
+		fits := func(keep int) bool {
+			_, export.Steps = elideMiddle(steps, keep)
+			return estimateTokens(export) <= budget
+		}
+		// The most steps that fit, but never fewer than the first and last
+		keep := len(steps) - 1 - sort.Search(len(steps)-3, func(i int) bool { return fits(len(steps) - 1 - i) })
+
+		dropped, converted := elideMiddle(steps, keep)
+		export.Steps = converted
+		for _, step := range dropped {
+			export.Dropped.dropStep(step.Kind)
+		}
+	}
+
+	// Spend what's left of the budget on a few screenshots spread over the session
+	chosen := keyScreenshots(screenshots, llmMaxKeyScreenshots)
+	export.Dropped.Screenshots = len(screenshots) - len(chosen)
+	for _, candidate := range chosen {
+		shot, ok := shrink(candidate)
+		cost := screenshotTokens(shot.Width, shot.Height) + estimateTokens(shot.Caption)
+		if !ok || estimateTokens(export)+cost > budget {
+			export.Dropped.Screenshots++
+			continue
+		}
+
+		shot.AfterStep = 0
+		for i, step := range export.Steps {
+			if step.OffsetMs <= candidate.OffsetMs {
+				shot.AfterStep = i + 1
+			}
+		}
+		shot.OffsetMs = candidate.OffsetMs
+		shot.Caption = candidate.Caption
+		export.Screenshots = append(export.Screenshots, shot)
+	}
+
+	export.EstimatedTokens = estimateTokens(export)
+	return export
+}
+
+// dropStep counts a step left out of the export
+func (d *LLMDropReport) dropStep(kind string) {
+	if d.StepsByKind == nil {
+		d.StepsByKind = make(map[string]int)
+	}
+	d.Steps++
+	d.StepsByKind[kind]++
+}
+
+// elideMiddle keeps the first and last of keep steps and replaces the steps
+// between them with a note. Returns the steps left out and the export steps.
+func elideMiddle(steps []RecordingStep, keep int) ([]RecordingStep, []LLMStep) {
+	head := (keep + 1) / 2
+	tail := keep - head
+
+	kept := append(append([]RecordingStep{}, steps[:head]...), steps[len(steps)-tail:]...)
+	dropped := steps[head : len(steps)-tail]
+
+	converted := slices.Insert(llmSteps(kept), head, LLMStep{
+		OffsetMs: dropped[0].OffsetMs,
+		Action:   fmt.Sprintf("… %d steps omitted", len(dropped)),
+	})
+	return dropped, converted
+}
+
+// llmSteps converts steps to their export form
+func llmSteps(steps []RecordingStep) []LLMStep {
+	converted := make([]LLMStep, len(steps))
+	for i, step := range steps {
+		converted[i] = LLMStep{OffsetMs: step.OffsetMs, Application: step.Application, Action: step.Description}
+	}
+	return converted
+}
+
+// keyScreenshots picks up to n screenshots spread evenly over the session,
+// always including the last
+func keyScreenshots(screenshots []RecordingScreenshot, n int) []RecordingScreenshot {
+	if len(screenshots) <= n {
+		return screenshots
+	}
+
+	chosen := make([]RecordingScreenshot, 0, n)
+	for i := 1; i <= n; i++ {
+		chosen = append(chosen, screenshots[i*len(screenshots)/n-1])
+	}
+	return chosen
+}
+
+// estimateTokens approximates the tokens v takes as JSON. Screenshot images
+// are counted at their vision cost rather than their base64 length.
+func estimateTokens(v interface{}) int {
+	switch value := v.(type) {
+	case string:
+		return (len(value) + charsPerToken - 1) / charsPerToken
+	case LLMExport:
+		images := 0
+		value.Screenshots = append([]LLMScreenshot{}, value.Screenshots...)
+		for i := range value.Screenshots {
+			images += screenshotTokens(value.Screenshots[i].Width, value.Screenshots[i].Height)
+			value.Screenshots[i].ImageBase64 = ""
+		}
+		value.EstimatedTokens = 0
+		data, _ := json.Marshal(value)
+		return (len(data)+charsPerToken-1)/charsPerToken + images
+	default:
+		data, _ := json.Marshal(v)
+		return (len(data) + charsPerToken - 1) / charsPerToken
+	}
+}
+
+// screenshotTokens approximates a vision model's cost for an image: a base
+// charge plus a charge per 512 pixel tile
+func screenshotTokens(width, height int) int {
+	tiles := ((width + 511) / 512) * ((height + 511) / 512)
+	return 85 + 170*tiles
+}
+
+// shrinkScreenshot downscales a screenshot to llmScreenshotMaxWidth and
+// re-encodes it as JPEG
+func shrinkScreenshot(screenshot RecordingScreenshot) (LLMScreenshot, bool) {
+	data, err := base64.StdEncoding.DecodeString(screenshot.ImageBase64)
+	if err != nil {
+		return LLMScreenshot{}, false
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return LLMScreenshot{}, false
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+
+	final := rgba
+	maxWidth := llmScreenshotMaxWidth
+	if scaled := scaleToFit(rgba, &maxWidth, nil); scaled != nil {
+		defer releaseFrameBuffer(scaled)
+		final = scaled
+	}
+
+	encoded, _, err := encodeScreenshotImage(final, "jpeg", llmScreenshotJPEGLevel)
+	if err != nil {
+		return LLMScreenshot{}, false
+	}
+
+	return LLMScreenshot{
+		ImageFormat: "jpeg",
+		Width:       final.Rect.Dx(),
+		Height:      final.Rect.Dy(),
+		ImageBase64: encoded,
+	}, true
+}
+
+// exportRecordingForLLM writes a saved recording compressed to budget tokens
+// next to it, named <base>_llm.json, and returns the export and file written
+func exportRecordingForLLM(filename string, budget int, store string) (*LLMExport, string, error) {
+	recording, err := LoadSavedRecording(filename, store)
+	if err != nil {
+		return nil, "", err
+	}
+
+	export := compressForLLM(recording, budget, shrinkScreenshot)
+
+	exportFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + "_llm.json"
+	if err := SaveJSONToFile(export, exportFile); err != nil {
+		return nil, "", err
+	}
+	return &export, exportFile, nil
+}
@@ -0,0 +1,212 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Structured logging. The recorder's diagnostics go through log/slog: each
+// part of the recorder logs under its module ("recording", "cdp", "sinks"
+// and so on) at a level, as text or, with LogFormat json, as one JSON
+// object per line, to the console or the LogFile. LogLevel sets the level
+// for everything and LogModuleLevels overrides it per module, so one noisy
+// or suspect part can be turned up or down on its own. --verbose logs at
+// debug, where the per-event detail of the trackers is, and --quiet logs
+// only warnings and errors and drops the console banners and the line
+// printed for each event. Anything still written with the standard log
+// package, fatal errors included, goes through the same handler at info.
+//
+// Silent mode, for a recorder embedded in another program or run as a
+// service, prints nothing at all: console lines go to the log instead
+// (warnings at warn, the rest at debug) and to ConsoleHook, and
+// SetLogHandler sends the log itself wherever the host program logs. A
+// recorder built without a console (-ldflags=-H=windowsgui) and started
+// without its output redirected has nowhere to print, and is silent on its
+// own.
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var (
+	logBase   slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logLevel               = slog.LevelInfo
+	logLevels              = map[string]slog.Level{}
+	logQuiet  bool
+	logSilent bool
+	loggers   = map[string]*slog.Logger{}
+	logMutex  sync.Mutex
+
+	// ConsoleHook, when set, receives every console line, printed or not
+	ConsoleHook func(message ConsoleMessage)
+)
+
+// ConsoleMessage is a line the recorder shows the person at the console
+type ConsoleMessage struct {
+	Text    string
+	Warning bool // Something went wrong or is unavailable; printed even with --quiet
+}
+
+// levelHandler passes on the records at or above its level
+type levelHandler struct {
+	slog.Handler
+	Level slog.Level
+}
+
+// Enabled reports whether records at level are logged
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.Level
+}
+
+// WithAttrs keeps the level on the handler with the attributes added
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), Level: h.Level}
+}
+
+// WithGroup keeps the level on the handler with the group added
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), Level: h.Level}
+}
+
+// setupLogging sends the log to output in the configured format and levels
+func setupLogging(config WorkflowRecorderConfig, output io.Writer) {
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var base slog.Handler
+	if config.LogFormat == LogFormatJSON {
+		base = slog.NewJSONHandler(output, options)
+	} else {
+		base = slog.NewTextHandler(output, options)
+	}
+	SetLogHandler(base, config)
+}
+
+// SetLogHandler sends the recorder's log to handler, at the levels of
+// config, and sets whether the console is quiet or silent. A program that
+// embeds the recorder passes its own handler.
+func SetLogHandler(base slog.Handler, config WorkflowRecorderConfig) {
+
+	level, _ := parseLogLevel(config.LogLevel)
+	switch {
+	case config.Verbose:
+		level = slog.LevelDebug
+	case config.Quiet:
+		level = slog.LevelWarn
+	}
+	levels := make(map[string]slog.Level, len(config.LogModuleLevels))
+	for module, name := range config.LogModuleLevels {
+		levels[module], _ = parseLogLevel(name)
+	}
+
+	logMutex.Lock()
+	logBase, logLevel, logLevels = base, level, levels
+	logQuiet, logSilent = config.Quiet, config.Silent || !hasStdout()
+	loggers = map[string]*slog.Logger{}
+	logMutex.Unlock()
+
+	// The standard log package is bridged in at info, and carries the fatal
+	// errors, so it is never quieter than that
+	standard := level
+	if standard > slog.LevelInfo {
+		standard = slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(&levelHandler{Handler: base, Level: standard}))
+}
+
+// logger returns the logger of a module
+func logger(module string) *slog.Logger {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	if l, ok := loggers[module]; ok {
+		return l
+	}
+	level, ok := logLevels[module]
+	if !ok {
+		level = logLevel
+	}
+	l := slog.New(&levelHandler{
+		Handler: logBase.WithAttrs([]slog.Attr{slog.String("module", module)}),
+		Level:   level,
+	})
+	loggers[module] = l
+	return l
+}
+
+// printConsole prints a line for the person at the console: a banner, or
+// what was just recorded. Quiet and silent, it is only logged, at debug.
+func printConsole(line string) {
+	showConsole(ConsoleMessage{Text: line})
+}
+
+// printConsoleWarning prints a line about something that went wrong or is
+// unavailable. Silent, it is logged at warn instead.
+func printConsoleWarning(line string) {
+	showConsole(ConsoleMessage{Text: line, Warning: true})
+}
+
+// showConsole prints, logs and hands message to ConsoleHook
+func showConsole(message ConsoleMessage) {
+	logMutex.Lock()
+	quiet, silent, hook := logQuiet, logSilent, ConsoleHook
+	logMutex.Unlock()
+
+	if hook != nil {
+		hook(message)
+	}
+	switch {
+	case silent && message.Warning:
+		logger("console").Warn(strings.TrimSpace(message.Text))
+	case silent || (quiet && !message.Warning):
+		logger("console").Debug(strings.TrimSpace(message.Text))
+	default:
+		fmt.Println(message.Text)
+	}
+}
+
+// hasStdout reports whether the process has somewhere to print to: a GUI
+// build started without a console has no standard output at all
+func hasStdout() bool {
+	_, err := os.Stdout.Stat()
+	return err == nil
+}
+
+// parseLogLevel parses debug, info, warn or error; empty is info
+func parseLogLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q: must be debug, info, warn or error", name)
+}
+
+// validateLogLevels checks the log levels and format
+func validateLogLevels(config *WorkflowRecorderConfig) error {
+	if _, err := parseLogLevel(config.LogLevel); err != nil {
+		return NewWorkflowError(ErrorTypeConfiguration, "Invalid LogLevel", err)
+	}
+	for module, name := range config.LogModuleLevels {
+		if _, err := parseLogLevel(name); err != nil {
+			return NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("Invalid log level for module %s", module), err)
+		}
+	}
+	if config.LogFormat != "" && config.LogFormat != LogFormatText && config.LogFormat != LogFormatJSON {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Invalid LogFormat %q: must be %s or %s", config.LogFormat, LogFormatText, LogFormatJSON), nil)
+	}
+	if config.Quiet && config.Verbose {
+		return NewWorkflowError(ErrorTypeConfiguration, "Quiet and Verbose cannot both be set", nil)
+	}
+	return nil
+}
@@ -0,0 +1,1694 @@
+// Package recorder is the ClaraVerse UI recorder: screen and input capture
+// on Windows, the recording pipeline, and the console, HTTP, MCP and tray
+// front ends that start and stop recordings. cmd/ui_recorder is a thin
+// binary around Main; programs embedding the recorder create a Recorder and
+// drive its recordings with a RecordingController instead. Its
+// configuration is in the config package, the recording format in events,
+// and files on disk in storage.
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"ui_recorder/config"
+	"ui_recorder/events"
+)
+
+var (
+	user32                         = syscall.NewLazyDLL("user32.dll")
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procGetCursorPos               = user32.NewProc("GetCursorPos")
+	procGetForegroundWindow        = user32.NewProc("GetForegroundWindow")
+	procGetWindowText              = user32.NewProc("GetWindowTextW")
+	procGetAsyncKeyState           = user32.NewProc("GetAsyncKeyState")
+	procGetKeyState                = user32.NewProc("GetKeyState")
+	procGetWindowThreadProcessId   = user32.NewProc("GetWindowThreadProcessId")
+	procGetClipboardData           = user32.NewProc("GetClipboardData")
+	procOpenClipboard              = user32.NewProc("OpenClipboard")
+	procCloseClipboard             = user32.NewProc("CloseClipboard")
+	procIsClipboardFormatAvailable = user32.NewProc("IsClipboardFormatAvailable")
+	procGlobalLock                 = kernel32.NewProc("GlobalLock")
+	procGlobalUnlock               = kernel32.NewProc("GlobalUnlock")
+	procOpenProcess                = kernel32.NewProc("OpenProcess")
+	procQueryFullProcessImageName  = kernel32.NewProc("QueryFullProcessImageNameW")
+	procCloseHandle                = kernel32.NewProc("CloseHandle")
+)
+
+const (
+	CF_TEXT        = 1
+	CF_UNICODETEXT = 13
+	VK_LBUTTON     = 0x01
+	VK_RBUTTON     = 0x02
+	VK_MBUTTON     = 0x04
+	VK_CONTROL     = 0x11
+	VK_MENU        = 0x12
+	VK_SHIFT       = 0x10
+	VK_LWIN        = 0x5B
+	VK_RWIN        = 0x5C
+	VK_SPACE       = 0x20
+	VK_RETURN      = 0x0D
+	VK_BACK        = 0x08
+	VK_CAPITAL     = 0x14
+	VK_TAB         = 0x09
+	VK_ESCAPE      = 0x1B
+
+	PROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+)
+
+type POINT struct {
+	X int32
+	Y int32
+}
+
+// The configuration lives in the config package, where programs embedding
+// the recorder can build one
+type (
+	WorkflowRecorderConfig = config.Config
+	PerformanceMode        = config.PerformanceMode
+	CustomHotkey           = config.CustomHotkey
+	ScreenshotHotkey       = config.ScreenshotHotkey
+	PIIPattern             = config.PIIPattern
+	EventSinkConfig        = config.EventSinkConfig
+	ApplicationProfile     = config.ApplicationProfile
+	RecordingQuota         = config.RecordingQuota
+)
+
+const (
+	Normal    = config.Normal
+	Balanced  = config.Balanced
+	LowEnergy = config.LowEnergy
+
+	defaultPauseHotkey = config.DefaultPauseHotkey
+
+	UpdateChannelStable = config.UpdateChannelStable
+	UpdateChannelBeta   = config.UpdateChannelBeta
+
+	CaptureMethodAuto               = config.CaptureMethodAuto
+	CaptureMethodGDI                = config.CaptureMethodGDI
+	CaptureMethodDesktopDuplication = config.CaptureMethodDesktopDuplication
+
+	QuotaPeriodHour  = config.QuotaPeriodHour
+	QuotaPeriodDay   = config.QuotaPeriodDay
+	QuotaScreenshots = config.QuotaScreenshots
+	QuotaContent     = config.QuotaContent
+)
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() WorkflowRecorderConfig {
+	return config.Default()
+}
+
+// The event model lives in the events package, where programs that read
+// recordings can import it
+type (
+	Position                = events.Position
+	UIElement               = events.UIElement
+	EventMetadata           = events.EventMetadata
+	OfficeContext           = events.OfficeContext
+	ScreenshotPair          = events.ScreenshotPair
+	MouseButton             = events.MouseButton
+	MouseEventType          = events.MouseEventType
+	MouseEvent              = events.MouseEvent
+	ModifierStates          = events.ModifierStates
+	KeyboardEvent           = events.KeyboardEvent
+	ClipboardAction         = events.ClipboardAction
+	ClipboardEvent          = events.ClipboardEvent
+	HotkeyEvent             = events.HotkeyEvent
+	ApplicationSwitchMethod = events.ApplicationSwitchMethod
+	ApplicationSwitchEvent  = events.ApplicationSwitchEvent
+	ButtonInteractionType   = events.ButtonInteractionType
+	ButtonClickEvent        = events.ButtonClickEvent
+	ScreenshotTrigger       = events.ScreenshotTrigger
+	ElementSelector         = events.ElementSelector
+	ScrollPosition          = events.ScrollPosition
+	OCRWord                 = events.OCRWord
+	OCRResult               = events.OCRResult
+	VisionCaption           = events.VisionCaption
+)
+
+const (
+	SchemaVersion               = events.SchemaVersion
+	MouseButtonLeft             = events.MouseButtonLeft
+	MouseButtonRight            = events.MouseButtonRight
+	MouseButtonMiddle           = events.MouseButtonMiddle
+	MouseButtonNone             = events.MouseButtonNone
+	MouseClick                  = events.MouseClick
+	MouseDoubleClick            = events.MouseDoubleClick
+	MouseRightClick             = events.MouseRightClick
+	MouseDown                   = events.MouseDown
+	MouseUp                     = events.MouseUp
+	MouseMove                   = events.MouseMove
+	MouseWheel                  = events.MouseWheel
+	MouseDrag                   = events.MouseDrag
+	MouseDragStart              = events.MouseDragStart
+	MouseDragEnd                = events.MouseDragEnd
+	MouseDrop                   = events.MouseDrop
+	ClipboardCopy               = events.ClipboardCopy
+	ClipboardCut                = events.ClipboardCut
+	ClipboardPaste              = events.ClipboardPaste
+	ClipboardClear              = events.ClipboardClear
+	AppSwitchAltTab             = events.AppSwitchAltTab
+	AppSwitchTaskbarClick       = events.AppSwitchTaskbarClick
+	AppSwitchWindowsKeyShortcut = events.AppSwitchWindowsKeyShortcut
+	AppSwitchStartMenu          = events.AppSwitchStartMenu
+	AppSwitchWindowClick        = events.AppSwitchWindowClick
+	AppSwitchOther              = events.AppSwitchOther
+	ButtonClick                 = events.ButtonClick
+	ButtonSubmit                = events.ButtonSubmit
+	ButtonCancel                = events.ButtonCancel
+	ButtonToggle                = events.ButtonToggle
+	ButtonDropdownToggle        = events.ButtonDropdownToggle
+	ScreenshotTriggerMouseClick = events.ScreenshotTriggerMouseClick
+	ScreenshotTriggerKeyboard   = events.ScreenshotTriggerKeyboard
+	ScreenshotTriggerInterval   = events.ScreenshotTriggerInterval
+	ScreenshotTriggerAppSwitch  = events.ScreenshotTriggerAppSwitch
+)
+
+type ScreenshotEvent struct {
+	ImageBase64   string            `json:"image_base64"`
+	ImageFormat   string            `json:"image_format"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	MonitorName   string            `json:"monitor_name"`
+	Trigger       ScreenshotTrigger `json:"trigger"`
+	CaptureID     int64             `json:"capture_id,omitempty"`
+	ImageRef      string            `json:"image_ref,omitempty"`         // In a saved recording, the image in the screenshot store
+	Annotated     bool              `json:"annotated,omitempty"`         // Element and cursor drawn on the image
+	CaptureMethod string            `json:"capture_method,omitempty"`    // "desktop_duplication" when not taken through GDI
+	ScreenArea    *[4]int32         `json:"screen_area,omitempty"`       // Captured screen x, y, width and height
+	Protected     bool              `json:"protected_content,omitempty"` // DRM-protected content was blacked out
+	ImagePending  bool              `json:"image_pending,omitempty"`     // Still being encoded in the background
+	Vision        *VisionCaption    `json:"vision,omitempty"`
+	OCR           *OCRResult        `json:"ocr,omitempty"`
+	Metadata      EventMetadata     `json:"metadata"`
+
+	frame *screenshotFrame // The frame to encode while ImagePending
+}
+
+type WorkflowEvent = events.WorkflowEvent
+
+type RecordedWorkflow struct {
+	// SchemaVersion is the version of the recording format it is saved in
+	SchemaVersion int             `json:"schema_version"`
+	Name          string          `json:"name"`
+	StartTime     uint64          `json:"start_time"`
+	EndTime       uint64          `json:"end_time"`
+	Clock         *ClockSync      `json:"clock,omitempty"`
+	Events        []WorkflowEvent `json:"events"`
+	Segments      []TaskSegment   `json:"segments,omitempty"`
+	Steps         []SemanticStep  `json:"steps,omitempty"`
+	// Redactions counts the PII matches masked per detector
+	Redactions map[string]int `json:"pii_redactions,omitempty"`
+	// SchemaRejections counts the events strict mode left out, by type
+	SchemaRejections map[string]int `json:"schema_rejections,omitempty"`
+	// Part numbers the files of a recording split at its limits, from 1
+	Part int `json:"part,omitempty"`
+	// ScreenshotStore is where the saved recording's screenshots are kept,
+	// when not in the recording itself
+	ScreenshotStore string `json:"screenshot_store,omitempty"`
+	// Interruptions counts the times a crash or reboot interrupted the
+	// recording and it was resumed
+	Interruptions int `json:"interruptions,omitempty"`
+	// LastSequence is the sequence number given to the latest event
+	LastSequence uint64 `json:"-"`
+	// Size is roughly how large the saved recording will be, in bytes
+	Size int64 `json:"-"`
+	// TypeSizes splits Size by event type
+	TypeSizes map[string]int64 `json:"-"`
+	Mutex     sync.RWMutex     `json:"-"`
+}
+
+// Recorder is one recorder: its configuration, the services that outlive
+// a recording, and the components of the recording in progress, which its
+// RecordingController sets and clears. Everything that records passes it
+// along explicitly; programs embedding the recorder create one with
+// NewRecorder.
+type Recorder struct {
+	Config         WorkflowRecorderConfig
+	Clipboard      *ClipboardTracker
+	Screenshots    *ScreenshotService
+	Pipeline       *EventPipeline         // Every event recorded goes through it; integrators add middleware before recording
+	Capture        *CaptureState          // Created for each recording by RecordingController.Start
+	Trackers       *CaptureTrackers       // Created for each recording by RecordingController.Start
+	CDP            *CDPClient             // Connected for each recording when CDPDebuggingURL is set
+	Captioner      *VisionCaptioner       // Created for each recording when VisionEndpoint is set
+	OCR            *OCRRecognizer         // Created for each recording when OCRCommand is set
+	Auditor        *CaptureAuditor        // Created for each recording when DryRun is set
+	Schema         *SchemaValidator       // Created for each recording when Strict is set
+	PII            *PIIRedactor           // Created for each recording when MaskPII is set
+	Telemetry      *Telemetry             // Set for the life of the process when TelemetryEndpoint is set
+	Quotas         *QuotaEnforcer         // Set for the life of the process when RecordingQuotas is set
+	WindowGeometry *WindowGeometryWatcher // Created for each recording when RecordWindowGeometry is set
+	FileActivity   *FileActivityWatcher   // Created for each recording when WatchFolders is set
+	Processes      *ProcessWatcher        // Created for each recording when RecordProcesses is set
+	Menus          *MenuWatcher           // Created for each recording when RecordMenuSelections is set
+	Dialogs        *DialogWatcher         // Created for each recording when RecordDialogs is set
+	Focus          *FocusWatcher          // Created for each recording when RecordFocusChanges is set
+	Office         *OfficeProbe           // Created for each recording when OfficeContext is set
+	ActionShots    *ActionScreenshots     // Created for each recording when ActionScreenshotPairs is set
+	Analytics      *DwellAnalytics        // Created for each recording
+	RateLimiter    *RateLimiter           // Created for each recording when MaxEventsPerSecond or EventRateLimits is set
+	Encoder        *ScreenshotEncoder     // Created for each recording when ScreenshotEncodeWorkers is set
+	Sinks          *EventSinks            // Created for each recording when EventSinks is set
+	Deduplicator   *EventDeduplicator     // Created for each recording with its DedupeWindowMs
+	LastEventTime  time.Time
+	Mutex          sync.RWMutex
+}
+
+// NewRecorder creates a recorder with config and no recording in progress
+func NewRecorder(config WorkflowRecorderConfig) *Recorder {
+	r := &Recorder{
+		Config:        config,
+		LastEventTime: time.Now(),
+		Deduplicator:  NewEventDeduplicator(time.Duration(config.DedupeWindowMs) * time.Millisecond),
+		Clipboard:     newDefaultClipboardTracker(config),
+	}
+	r.Screenshots = NewScreenshotService(r, &FrameCapturer{})
+	r.Pipeline = NewEventPipeline(r)
+	return r
+}
+
+// Helper functions
+func captureTimestamp() uint64 {
+	return uint64(time.Now().UnixNano() / int64(time.Millisecond))
+}
+
+func createEventMetadata() EventMetadata {
+	return EventMetadata{
+		UIElement: getCurrentUIElement(),
+		Timestamp: captureTimestamp(),
+	}
+}
+
+func getCurrentUIElement() *UIElement {
+	pos := getMousePosition()
+	windowTitle, processID := getCurrentWindow()
+
+	return &UIElement{
+		Role:            "window",
+		Name:            windowTitle,
+		Bounds:          [4]float64{float64(pos.X), float64(pos.Y), 100, 100},
+		ProcessID:       processID,
+		WindowTitle:     windowTitle,
+		ApplicationName: applicationName(processID, windowTitle),
+		URL:             getCurrentURL(),
+	}
+}
+
+func getMousePosition() Position {
+	var point POINT
+	ret, _, _ := procGetCursorPos.Call(uintptr(unsafe.Pointer(&point)))
+	if ret == 0 {
+		return Position{X: 0, Y: 0}
+	}
+	return Position{X: point.X, Y: point.Y}
+}
+
+func getCurrentWindow() (string, uint32) {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		return "", 0
+	}
+
+	var processID uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&processID)))
+
+	textBuf := make([]uint16, 256)
+	procGetWindowText.Call(hwnd, uintptr(unsafe.Pointer(&textBuf[0])), 256)
+
+	return syscall.UTF16ToString(textBuf), processID
+}
+
+// applicationName names the application owning a window by its executable,
+// falling back to the window title for processes that cannot be opened
+func applicationName(processID uint32, windowTitle string) string {
+	if name := GetProcessNameFromPID(processID); name != "" {
+		return name
+	}
+	if windowTitle == "" {
+		return "Unknown"
+	}
+	return windowTitle
+}
+
+// getCurrentURL returns the foreground browser's URL from its address bar,
+// falling back to a URL in the window title
+func getCurrentURL() string {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	windowTitle, _ := getCurrentWindow()
+	if url := globalBrowserURLCache.Get(hwnd, windowTitle); url != "" {
+		return url
+	}
+	if strings.Contains(strings.ToLower(windowTitle), "http") {
+		return extractURLFromTitle(windowTitle)
+	}
+	return ""
+}
+
+func extractURLFromTitle(title string) string {
+	patterns := []string{
+		`https?://[^\s]+`,
+		`[a-zA-Z0-9-]+\.[a-zA-Z]{2,}[^\s]*`,
+	}
+
+	for _, pattern := range patterns {
+		re := regexp.MustCompile(pattern)
+		if match := re.FindString(title); match != "" {
+			return match
+		}
+	}
+
+	return ""
+}
+
+func isMouseButtonPressed(button int) bool {
+	ret, _, _ := procGetAsyncKeyState.Call(uintptr(button))
+	return (ret & 0x8000) != 0
+}
+
+func isKeyPressed(keyCode uint32) bool {
+	ret, _, _ := procGetAsyncKeyState.Call(uintptr(keyCode))
+	return (ret & 0x8000) != 0
+}
+
+func isCapsLockOn() bool {
+	ret, _, _ := procGetKeyState.Call(VK_CAPITAL)
+	return (ret & 0x0001) != 0
+}
+
+func (r *Recorder) shouldFilterEvent(event WorkflowEvent) bool {
+	config := r.currentConfig()
+	now := time.Now()
+
+	if limiter := r.RateLimiter; limiter != nil && !limiter.Allow(event) {
+		return true
+	}
+
+	if config.EventProcessingDelayMs != nil && *config.EventProcessingDelayMs > 0 {
+		r.Mutex.Lock()
+		if now.Sub(r.LastEventTime).Milliseconds() < *config.EventProcessingDelayMs {
+			r.Mutex.Unlock()
+			return true
+		}
+		r.LastEventTime = now
+		r.Mutex.Unlock()
+	}
+
+	return false
+}
+
+func calculateDistance(p1, p2 Position) float64 {
+	dx := float64(p1.X - p2.X)
+	dy := float64(p1.Y - p2.Y)
+	return math.Sqrt(dx*dx + dy*dy)
+}
+
+func determineButtonInteractionType(element UIElement) ButtonInteractionType {
+	name := strings.ToLower(element.Name)
+	role := strings.ToLower(element.Role)
+
+	if strings.Contains(role, "hyperlink") || strings.Contains(role, "link") {
+		return ButtonClick
+	}
+
+	if strings.Contains(name, "dropdown") || strings.Contains(name, "▼") ||
+		strings.Contains(name, "expand") || strings.Contains(name, "collapse") {
+		return ButtonDropdownToggle
+	}
+
+	if strings.Contains(name, "submit") || strings.Contains(name, "save") ||
+		strings.Contains(name, "ok") || strings.Contains(name, "apply") ||
+		strings.Contains(name, "confirm") {
+		return ButtonSubmit
+	}
+
+	if strings.Contains(name, "cancel") || strings.Contains(name, "close") ||
+		strings.Contains(name, "×") || strings.Contains(name, "dismiss") {
+		return ButtonCancel
+	}
+
+	if strings.Contains(role, "toggle") || strings.Contains(role, "checkbox") ||
+		strings.Contains(role, "radiobutton") || strings.Contains(name, "toggle") {
+		return ButtonToggle
+	}
+
+	return ButtonClick
+}
+
+// shouldIgnoreApplication reports whether nothing is recorded from an
+// application or window title under config
+func shouldIgnoreApplication(config WorkflowRecorderConfig, appName, windowTitle string) bool {
+	// Typing a note into the annotation prompt is not part of the workflow
+	if windowTitle == annotationPromptTitle {
+		return true
+	}
+	return ignoredByConfig(config, appName, windowTitle)
+}
+
+// ignoredByConfig reports whether config's ignore lists cover an
+// application or window title
+func ignoredByConfig(config WorkflowRecorderConfig, appName, windowTitle string) bool {
+	appLower := strings.ToLower(appName)
+	titleLower := strings.ToLower(windowTitle)
+
+	for _, pattern := range config.IgnoreFocusPatterns {
+		if strings.Contains(appLower, strings.ToLower(pattern)) ||
+			strings.Contains(titleLower, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+
+	for _, ignoreApp := range config.IgnoreApplications {
+		if strings.Contains(appLower, strings.ToLower(ignoreApp)) {
+			return true
+		}
+	}
+
+	for _, ignoreTitle := range config.IgnoreWindowTitles {
+		if strings.Contains(titleLower, strings.ToLower(ignoreTitle)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Recorder) processClipboardEvents(events *[]WorkflowEvent) {
+	config := r.recordingConfig()
+	if !r.currentConfig().RecordClipboard && !config.RecordClipboard {
+		return
+	}
+
+	// Polled even when the focused application's profile excludes the
+	// clipboard, so its copies are not recorded after switching away
+	clipboardEvent := r.Clipboard.Poll()
+	if clipboardEvent == nil || !config.RecordClipboard {
+		return
+	}
+	if config.ExcludePasswordFields && isFocusedPasswordField() {
+		*clipboardEvent = redactClipboard(*clipboardEvent)
+	}
+
+	if !r.shouldFilterEvent(*clipboardEvent) {
+		*events = append(*events, *clipboardEvent)
+		printConsole(Msg(MsgClipboard, truncateUTF8(clipboardEvent.Content, 50)))
+	}
+}
+
+// processApplicationSwitchEvents records the foreground application
+// changing, passing over the shell windows in front on the way
+func (r *Recorder) processApplicationSwitchEvents(events *[]WorkflowEvent, element UIElement) {
+	currentApp := element.ApplicationName
+	now := time.Now()
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	switches := r.Trackers.Switches
+	if switches.HandleForeground(getWindowClassName(hwnd), currentApp, now) {
+		return
+	}
+	idle := r.Trackers.Idle.SoFar()
+	if previous, switched := r.Capture.SwitchApplication(currentApp, element.ProcessID, now, idle); switched {
+		switchEvent := ApplicationSwitchEvent{
+			FromApplication: previous.Name,
+			ToApplication:   currentApp,
+			FromProcessID:   previous.ProcessID,
+			ToProcessID:     element.ProcessID,
+			SwitchMethod:    switches.Classify(now),
+			DwellTimeMs:     uint64(activeTime(previous.Since, previous.Idle, idle).Milliseconds()),
+			SwitchCount:     1,
+			Metadata:        createEventMetadata(),
+		}
+
+		if !r.shouldFilterEvent(switchEvent) {
+			*events = append(*events, switchEvent)
+
+			if screenshot := r.Screenshots.Capture(ScreenshotTriggerAppSwitch); screenshot != nil {
+				*events = append(*events, *screenshot)
+			}
+
+			printConsole(Msg(MsgAppSwitch, previous.Name, currentApp))
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (r *Recorder) processEnhancedEvents(workflow *RecordedWorkflow) {
+	mousePos := getMousePosition()
+	windowTitle, processID := getCurrentWindow()
+	appName := applicationName(processID, windowTitle)
+
+	element := UIElement{
+		Role:            "window",
+		Name:            windowTitle,
+		Bounds:          [4]float64{float64(mousePos.X), float64(mousePos.Y), 100, 100},
+		ProcessID:       processID,
+		WindowTitle:     windowTitle,
+		ApplicationName: appName,
+		URL:             getCurrentURL(),
+	}
+
+	if shouldIgnoreApplication(r.currentConfig(), appName, windowTitle) {
+		return
+	}
+
+	state := r.Capture
+	if profile := matchProfile(r.currentConfig(), appName, windowTitle); state.ChangeProfile(profile) {
+		if profile != nil {
+			printConsole(Msg(MsgProfile, profile.Name))
+		}
+	}
+	config := r.recordingConfig()
+
+	var events []WorkflowEvent
+	if after := r.ActionShots.Sample(time.Now()); after != nil {
+		events = append(events, *after)
+	}
+
+	trackers := r.Trackers
+	trackers.HandleWindow(&element)
+	trackers.HandleFullscreen(&element)
+	trackers.HandleWindowTitle(&element)
+
+	// Keyboard: raw key events, plus hotkey, text input and drag modifier
+	// tracking. Keyboard mode keeps every key, whatever the rate limits.
+	keyEvents := trackers.HandleKeys(trackers.Keyboard.Poll(), &element)
+	if config.KeyboardMode {
+		keyEvents = trackers.HandleKeyboardMode(keyEvents, &element)
+	}
+	// Text input completed from here on was typed where the caret was before
+	typedContext := state.LastInputContext()
+	inputContext := typedContext
+	if config.CaptureUIElements && !config.ReduceUIElementCapture && hasKeyDown(keyEvents) {
+		inputContext = captureInputContext()
+		applyInputContext(keyEvents, inputContext)
+	}
+	for _, keyEvent := range keyEvents {
+		if config.RecordKeyboard && !(config.FilterKeyboardNoise && isKeyboardNoise(keyEvent)) && (config.KeyboardMode || !r.shouldFilterEvent(keyEvent)) {
+			events = append(events, keyEvent)
+		}
+		if matchesScreenshotHotkey(trackers.ScreenshotKeys, keyEvent, appName) {
+			if screenshot := r.Screenshots.Capture(ScreenshotTriggerHotkey); screenshot != nil {
+				events = append(events, *screenshot)
+			}
+		}
+	}
+
+	// Enhanced mouse event processing
+	throttle := time.Duration(r.currentConfig().MouseMoveThrottleMs) * time.Millisecond
+	if state.MoveMouse(mousePos, time.Now(), throttle) {
+		mouseEvent := MouseEvent{
+			EventType: MouseMove,
+			Position:  mousePos,
+			Button:    MouseButtonNone,
+			Metadata:  createEventMetadata(),
+		}
+
+		if !config.FilterMouseNoise && !r.shouldFilterEvent(mouseEvent) {
+			events = append(events, mouseEvent)
+
+			if workflow.EventCount()%50 == 0 {
+				printConsole(Msg(MsgMouseMove, mousePos.X, mousePos.Y, windowTitle))
+			}
+		}
+	}
+
+	// Enhanced mouse click detection with screenshots
+	if isMouseButtonPressed(VK_LBUTTON) {
+		if state.PressButton(mousePos, time.Now()) {
+			if after := r.ActionShots.Press(); after != nil {
+				events = append(events, *after)
+			}
+			if config.CaptureUIElements && !config.ReduceUIElementCapture {
+				state.SetPressedElement(captureClickedElement(mousePos, element))
+			}
+			trackers.HandleMouseDown(mousePos, &element)
+		} else {
+			trackers.HandleMouseMove(mousePos)
+		}
+	} else if press := state.ReleaseButton(); press != nil {
+		dragDistance := calculateDistance(press.Position, mousePos)
+
+		var eventType MouseEventType
+		if dragDistance >= r.currentConfig().MinDragDistance {
+			eventType = MouseDrag
+		} else {
+			eventType = MouseClick
+		}
+		var hit *UIElement
+		if eventType == MouseClick && press.Element != nil {
+			hit = &press.Element.Element
+		}
+		trackers.HandleMouseUp(mousePos, &element, eventType == MouseClick, hit)
+
+		mouseEvent := MouseEvent{
+			EventType: eventType,
+			Position:  mousePos,
+			Button:    MouseButtonLeft,
+			Metadata:  createEventMetadata(),
+		}
+		if eventType == MouseClick && press.Element != nil {
+			mouseEvent.ElementSelector = press.Element.Selector
+		}
+
+		if !r.shouldFilterEvent(mouseEvent) {
+			var before *ScreenshotEvent
+			if eventType == MouseClick {
+				before, mouseEvent.Screenshots = r.ActionShots.Click(time.Now())
+			}
+			events = append(events, mouseEvent)
+
+			if before != nil {
+				events = append(events, *before)
+			} else if r.ActionShots == nil {
+				if screenshot := r.Screenshots.Capture(ScreenshotTriggerMouseClick); screenshot != nil {
+					events = append(events, *screenshot)
+				}
+			}
+
+			clicked, enabled := clickTarget(press, element, eventType == MouseClick)
+			interactionType := determineButtonInteractionType(clicked)
+			buttonEvent := ButtonClickEvent{
+				ButtonText:      clicked.Name,
+				InteractionType: interactionType,
+				ButtonRole:      clicked.Role,
+				WasEnabled:      enabled,
+				Position:        mousePos,
+				Metadata:        EventMetadata{UIElement: &clicked, Timestamp: captureTimestamp()},
+			}
+
+			if !r.shouldFilterEvent(buttonEvent) {
+				events = append(events, buttonEvent)
+			}
+
+			printConsole(Msg(MsgMouseButton,
+				eventType, mousePos.X, mousePos.Y, clicked.Name, interactionType))
+		}
+		// A drag, or a click not recorded, lets go of its frame
+		r.ActionShots.Cancel()
+	}
+
+	r.processClipboardEvents(&events)
+	r.processApplicationSwitchEvents(&events, element)
+	events = append(events, r.WindowGeometry.Drain(time.Now())...)
+	events = append(events, r.FileActivity.Drain()...)
+	events = append(events, r.Processes.Drain()...)
+	events = append(events, r.Menus.Drain()...)
+	events = append(events, r.Dialogs.Drain()...)
+	events = append(events, r.Focus.Drain()...)
+
+	trackerEvents := trackers.Drain()
+	applyInputContext(trackerEvents, typedContext)
+	r.processTrackerEvents(workflow, &events, trackerEvents)
+	state.SetInputContext(inputContext)
+	if cdp := r.CDP; cdp != nil {
+		r.processCDPEvents(&events, cdp.Drain())
+	}
+
+	if screenshot := r.Screenshots.Capture(ScreenshotTriggerInterval); screenshot != nil {
+		events = append(events, *screenshot)
+		printConsole(Msg(MsgIntervalScreenshot))
+	}
+
+	r.appendWorkflowEvents(workflow, events)
+}
+
+// processTrackerEvents adds the higher-level events emitted by the trackers.
+// Recorder control hotkeys act on the workflow instead of being recorded.
+func (r *Recorder) processTrackerEvents(workflow *RecordedWorkflow, events *[]WorkflowEvent, trackerEvents []WorkflowEvent) {
+	for _, event := range trackerEvents {
+		if hotkey, isHotkey := event.(HotkeyEvent); isHotkey && r.handleRecorderHotkey(workflow, events, hotkey) {
+			continue
+		}
+		if !r.eventAllowedByProfile(event) || r.shouldFilterEvent(event) {
+			continue
+		}
+		*events = append(*events, event)
+
+		if _, isHotkey := event.(HotkeyEvent); isHotkey {
+			if screenshot := r.Screenshots.Capture(ScreenshotTriggerKeyboard); screenshot != nil {
+				*events = append(*events, *screenshot)
+			}
+		}
+
+		if line := describeTrackerEvent(event); line != "" {
+			printConsole(line)
+		}
+	}
+}
+
+// processCDPEvents adds the browser events reported over DevTools
+func (r *Recorder) processCDPEvents(events *[]WorkflowEvent, cdpEvents []WorkflowEvent) {
+	for _, event := range cdpEvents {
+		if r.shouldFilterEvent(event) {
+			continue
+		}
+		*events = append(*events, event)
+
+		if cdpEvent, ok := event.(BrowserCDPEvent); ok {
+			printConsole(describeCDPEvent(cdpEvent))
+		}
+	}
+}
+
+// appendWorkflowEvents sends events through the event pipeline into workflow
+func (r *Recorder) appendWorkflowEvents(workflow *RecordedWorkflow, events []WorkflowEvent) {
+	r.Pipeline.Run(workflow, events)
+}
+
+// analyzeScreenshot sends a recorded screenshot to captioning and OCR, once
+// its image is encoded
+func (r *Recorder) analyzeScreenshot(workflow *RecordedWorkflow, shot ScreenshotEvent) {
+	r.Mutex.RLock()
+	captioner, ocr := r.Captioner, r.OCR
+	r.Mutex.RUnlock()
+	if captioner != nil {
+		captioner.Submit(workflow, shot)
+	}
+	if ocr != nil {
+		ocr.Submit(workflow, shot)
+	}
+}
+
+// newRecordedWorkflow creates an empty workflow stamped with the current time
+func newRecordedWorkflow(name string) *RecordedWorkflow {
+	return &RecordedWorkflow{
+		SchemaVersion: SchemaVersion,
+		Name:          name,
+		StartTime:     captureTimestamp(),
+		Events:        []WorkflowEvent{},
+	}
+}
+
+// AppendEvent adds an event under the workflow lock so readers such as the
+// HTTP API can page through a recording while it is still being captured.
+// The event is given the next sequence number, and returned as recorded.
+func (w *RecordedWorkflow) AppendEvent(event WorkflowEvent) WorkflowEvent {
+	size := estimatedEventSize(event)
+
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	w.Size += size
+	if w.TypeSizes == nil {
+		w.TypeSizes = make(map[string]int64)
+	}
+	if raw, ok := event.(json.RawMessage); ok {
+		w.TypeSizes[rawEventType(raw)] += size
+	} else {
+		w.TypeSizes[auditEventType(event)] += size
+	}
+	if metadata, ok := eventMetadata(event); ok {
+		w.LastSequence++
+		metadata.Sequence = w.LastSequence
+		event = setEventMetadata(event, metadata)
+	}
+	w.Events = append(w.Events, event)
+	return event
+}
+
+// EstimatedSize returns roughly how large the saved recording will be
+func (w *RecordedWorkflow) EstimatedSize() int64 {
+	w.Mutex.RLock()
+	defer w.Mutex.RUnlock()
+
+	return w.Size
+}
+
+// EventCount returns the number of recorded events
+func (w *RecordedWorkflow) EventCount() int {
+	w.Mutex.RLock()
+	defer w.Mutex.RUnlock()
+
+	return len(w.Events)
+}
+
+// EventsPage returns up to limit events starting at offset, plus the total count
+func (w *RecordedWorkflow) EventsPage(offset, limit int) ([]WorkflowEvent, int) {
+	w.Mutex.RLock()
+	defer w.Mutex.RUnlock()
+
+	total := len(w.Events)
+	if offset >= total {
+		return []WorkflowEvent{}, total
+	}
+
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	page := make([]WorkflowEvent, end-offset)
+	copy(page, w.Events[offset:end])
+	return page, total
+}
+
+// EventsAfter returns up to limit events with sequence numbers above after,
+// and whether more follow them
+func (w *RecordedWorkflow) EventsAfter(after uint64, limit int) ([]WorkflowEvent, bool) {
+	w.Mutex.RLock()
+	defer w.Mutex.RUnlock()
+
+	// Sequence numbers only grow, so the events are sorted by them
+	start := sort.Search(len(w.Events), func(i int) bool {
+		metadata, _ := eventMetadata(w.Events[i])
+		return metadata.Sequence > after
+	})
+	end := min(start+limit, len(w.Events))
+
+	page := make([]WorkflowEvent, end-start)
+	copy(page, w.Events[start:end])
+	return page, end < len(w.Events)
+}
+
+// runCaptureLoop polls for events into the workflow until ctx is cancelled,
+// or until the watchdog abandons its generation. Polling is skipped while
+// the state machine is not in the Recording state.
+func (r *Recorder) runCaptureLoop(ctx context.Context, workflow *RecordedWorkflow, state *RecorderStateMachine, pauseHotkey *PauseHotkey,
+	watchdog *CaptureWatchdog, generation int) {
+	wasPaused := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			if !watchdog.Beat(generation) {
+				return
+			}
+			if pauseHotkey != nil && pauseHotkey.Pressed(isKeyPressed) {
+				togglePause(state)
+			}
+			// Only between Recording and Paused; starting and stopping are not pauses
+			if paused := state.Is(RecorderStatePaused); paused != wasPaused && (paused || state.IsCapturing()) {
+				r.markCaptureChange(workflow, state, !paused)
+				wasPaused = paused
+			}
+
+			if state.IsCapturing() && !r.pollIdle(workflow) {
+				started := time.Now()
+				r.processEnhancedEvents(workflow)
+				if telemetry := r.Telemetry; telemetry != nil {
+					telemetry.ObserveLatency(TelemetryCaptureLoop, time.Since(started))
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// saveRecordedWorkflow stamps the end time and writes the workflow to a
+// timestamped JSON file, returning the file name
+func (r *Recorder) saveRecordedWorkflow(workflow *RecordedWorkflow) (string, error) {
+	workflow.Mutex.Lock()
+	defer workflow.Mutex.Unlock()
+
+	workflow.SchemaVersion = SchemaVersion
+	workflow.EndTime = captureTimestamp()
+	config := r.currentConfig()
+	workflow.Segments = NewTaskSegmenter(config).Segment(workflow.Events, workflow.EndTime)
+	workflow.Steps = summarizeSteps(workflow.Events)
+
+	timestamp := time.Now().Format("20060102_150405")
+	if workflow.Interruptions > 0 {
+		// Named like the directory it was resumed from
+		timestamp = time.UnixMilli(int64(workflow.StartTime)).Format("20060102_150405")
+	}
+	filename := fmt.Sprintf("ui_recording_enhanced_%s.json", timestamp)
+	if workflow.Part > 0 {
+		filename = fmt.Sprintf("ui_recording_enhanced_%s_part%d.json", timestamp, workflow.Part)
+	}
+	if dir := config.OutputDirectory; dir != "" {
+		if err := EnsureDirectoryExists(dir); err != nil {
+			return "", err
+		}
+		filename = filepath.Join(dir, filename)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Screenshots go to the store first, so the recording never refers to
+	// an image that is not there
+	store := NewScreenshotStore(config)
+	var refs []string
+	if store != nil {
+		stored, storedRefs, err := storeScreenshots(store, workflow.Events)
+		if err != nil {
+			return "", err
+		}
+		events := workflow.Events
+		workflow.Events, refs = stored, storedRefs
+		workflow.ScreenshotStore, _ = filepath.Abs(store.Directory)
+		defer func() {
+			workflow.Events = events
+			workflow.ScreenshotStore = ""
+		}()
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(workflow); err != nil {
+		return "", err
+	}
+
+	if store != nil {
+		if err := store.AddReferences(filename, refs); err != nil {
+			return filename, NewWorkflowError(ErrorTypeFileIO, "Failed to save screenshot references", err)
+		}
+	}
+
+	return filename, nil
+}
+
+// commandLineOption looks for --name or --name=value among the program
+// arguments and returns the value and whether the option was present
+func commandLineOption(name string) (string, bool) {
+	for _, arg := range os.Args[1:] {
+		if arg == name {
+			return "", true
+		}
+		if strings.HasPrefix(arg, name+"=") {
+			return strings.TrimPrefix(arg, name+"="), true
+		}
+	}
+	return "", false
+}
+
+// Main runs the recorder as the ui_recorder command does, with the command
+// line in os.Args
+func Main() {
+	// An update staged by an earlier run is installed before anything starts
+	if executable, err := os.Executable(); err == nil {
+		installed, err := applyStagedUpdate(executable)
+		if err != nil {
+			logger("updater").Error("Update not installed", "error", err)
+		} else if installed {
+			logger("updater").Info("Installed a staged update, restarting")
+			os.Exit(relaunch(executable))
+		}
+	}
+
+	// Settings come from the defaults, then the --config file, then
+	// CLARAVERSE_* environment variables, then the command line
+	recorder := NewRecorder(DefaultConfig())
+	if err := loadCommandLineConfig(&recorder.Config); err != nil {
+		log.Fatal(err)
+	}
+
+	// Console output and reports follow --lang, else the Windows user locale
+	if locale, set := commandLineOption("--lang"); set {
+		recorder.Config.Locale = locale
+	}
+	SetLocale(recorder.Config.Locale)
+
+	command := cliCommand(os.Args)
+	if _, help := commandLineOption("--help"); help || command == "help" {
+		printUsage(os.Stdout)
+		return
+	}
+	if !isCLICommand(command) {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+
+	if command == "report" {
+		// report <recording.json> [--format=html|markdown]
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: report <recording.json> [--format=html|markdown]")
+		}
+		format := ReportFormatHTML
+		if value, set := commandLineOption("--format"); set && value != "" {
+			format = ReportFormat(value)
+		}
+		reportFile, err := exportRecordingReport(os.Args[2], format, recorder.Config.ScreenshotStore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgReportWritten, format, reportFile))
+		return
+	}
+
+	if command == "diff" {
+		// diff <before.json> <after.json> [--format=text|json]
+		if len(os.Args) < 4 || strings.HasPrefix(os.Args[2], "--") || strings.HasPrefix(os.Args[3], "--") {
+			log.Fatal("Usage: diff <before.json> <after.json> [--format=text|json]")
+		}
+		diff, err := diffRecordingFiles(os.Args[2], os.Args[3], recorder.Config.ScreenshotStore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if format, _ := commandLineOption("--format"); format == "json" {
+			data, _ := json.MarshalIndent(diff, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			fmt.Print(diff.Text())
+		}
+		return
+	}
+
+	if command == "merge" {
+		// merge <recording.json> <recording.json>... [--out=<file>] [--name=<name>]
+		var files []string
+		for _, arg := range os.Args[2:] {
+			if !strings.HasPrefix(arg, "--") {
+				files = append(files, arg)
+			}
+		}
+		if len(files) < 2 {
+			log.Fatal("Usage: merge <recording.json> <recording.json>... [--out=<file>] [--name=<name>]")
+		}
+		output, _ := commandLineOption("--out")
+		if output == "" {
+			output = mergedRecordingFile(".")
+		}
+		name, _ := commandLineOption("--name")
+		merged, err := mergeRecordingFiles(files, name, output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgRecordingsMerged, len(files), len(merged.Events), output))
+		return
+	}
+
+	if command == "import" {
+		// import <project.side|steps.mht> [--out=<file>]
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: import <project.side|steps.mht> [--out=<file>]")
+		}
+		output, _ := commandLineOption("--out")
+		if output == "" {
+			output = importedRecordingFile(".")
+		}
+		imported, summary, err := importRecordingFile(os.Args[2], output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgRecordingImported, summary.Steps, len(imported.Events), output))
+		if summary.Skipped > 0 {
+			fmt.Println(Msg(MsgImportSkipped, summary.Skipped))
+		}
+		return
+	}
+
+	if command == "size-report" {
+		// size-report <recording.json> [--format=text|json]
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: size-report <recording.json> [--format=text|json]")
+		}
+		report, err := buildSizeReport(os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if format, _ := commandLineOption("--format"); format == "json" {
+			data, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			fmt.Print(report.Text())
+		}
+		return
+	}
+
+	if command == "analytics" {
+		// analytics <recording.json>
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: analytics <recording.json>")
+		}
+		jsonFile, csvFile, err := exportRecordingAnalytics(os.Args[2], recorder.Config.ScreenshotStore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgAnalyticsWritten, jsonFile, csvFile))
+		return
+	}
+
+	if command == "clip" {
+		// clip <recording.json> [--format=gif|webm]
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: clip <recording.json> [--format=gif|webm]")
+		}
+		format := ClipFormatGIF
+		if value, set := commandLineOption("--format"); set && value != "" {
+			format = ClipFormat(value)
+		}
+		clipFile, err := exportRecordingClip(os.Args[2], format, recorder.Config.ScreenshotStore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgClipWritten, format, clipFile))
+		return
+	}
+
+	if command == "dataset" {
+		// dataset <directory> [--out=<directory>] [--format=jsonl|json] [--bbox=xywh|xyxy|normalized]
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: dataset <directory> [--out=<directory>] [--format=jsonl|json] [--bbox=xywh|xyxy|normalized]")
+		}
+		options := DatasetOptions{Format: DatasetFormatJSONL, BoxFormat: DatasetBoxXYWH, ScreenshotStore: recorder.Config.ScreenshotStore}
+		if value, set := commandLineOption("--format"); set && value != "" {
+			options.Format = DatasetFormat(value)
+		}
+		if value, set := commandLineOption("--bbox"); set && value != "" {
+			options.BoxFormat = DatasetBoxFormat(value)
+		}
+		outputDirectory := filepath.Join(os.Args[2], "dataset")
+		if value, set := commandLineOption("--out"); set && value != "" {
+			outputDirectory = value
+		}
+		summary, err := exportDataset(os.Args[2], outputDirectory, options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgDatasetWritten, summary.Samples, summary.Recordings, summary.Images, summary.File))
+		if summary.Skipped > 0 {
+			fmt.Println(Msg(MsgDatasetSkipped, summary.Skipped))
+		}
+		return
+	}
+
+	if command == "tables" {
+		// tables <recording.json|directory> [--out=<directory>] [--format=parquet|csv]
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: tables <recording.json|directory> [--out=<directory>] [--format=parquet|csv]")
+		}
+		format := TableFormatParquet
+		if value, set := commandLineOption("--format"); set && value != "" {
+			format = TableFormat(value)
+		}
+		outputDirectory := strings.TrimSuffix(os.Args[2], filepath.Ext(os.Args[2])) + "_tables"
+		if info, err := os.Stat(os.Args[2]); err == nil && info.IsDir() {
+			outputDirectory = filepath.Join(os.Args[2], "tables")
+		}
+		if value, set := commandLineOption("--out"); set && value != "" {
+			outputDirectory = value
+		}
+		summary, err := exportTables(os.Args[2], outputDirectory, format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgTablesWritten, summary.Rows, summary.Recordings, summary.Tables, summary.Directory))
+		return
+	}
+
+	if command == "replay" {
+		// replay <recording.json> [--speed=<factor>] [--verify] [--result=<file>] [--sandbox[=<folder>]]
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: replay <recording.json> [--speed=<factor>] [--verify] [--result=<file>] [--sandbox[=<folder>]]")
+		}
+		speed := 1.0
+		if value, set := commandLineOption("--speed"); set {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 {
+				log.Fatalf("Invalid --speed %q", value)
+			}
+			speed = parsed
+		}
+		_, verify := commandLineOption("--verify")
+		if _, sandboxed := commandLineOption("--sandbox"); sandboxed {
+			if err := runSandboxReplay(os.Args[2], speed, verify); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		resultFile, _ := commandLineOption("--result")
+		if err := runReplay(recorder, os.Args[2], speed, resultFile, verify); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == "screenshots gc" {
+		// screenshots gc [--screenshot-store=<directory>]
+		store := NewScreenshotStore(recorder.Config)
+		if store == nil {
+			log.Fatal("No screenshot store; pass --screenshot-store=<directory>")
+		}
+		stats, err := store.GC(screenshotGCGrace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgStoreCollected, stats.Removed, float64(stats.RemovedBytes)/(1<<20), stats.Images, stats.Recordings))
+		return
+	}
+
+	if command == "selectors check" {
+		// selectors check <recording.json> [--cdp=<url>] [--launch] [--out=<file>]
+		if len(os.Args) < 4 || strings.HasPrefix(os.Args[3], "--") {
+			log.Fatal("Usage: selectors check <recording.json> [--cdp=<url>] [--launch] [--out=<file>]")
+		}
+		drifted, err := runSelectorsCheck(os.Args[3], recorder.Config.ScreenshotStore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if drifted {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if command == "convert" {
+		// convert <recording.json> --to=script|llm|segments|rrweb [--format=<script format>] [--token-budget=<n>]
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "--") {
+			log.Fatal("Usage: convert <recording.json> --to=script|llm|segments|rrweb [--format=<script format>] [--token-budget=<n>]")
+		}
+		if err := runConvert(os.Args[2], recorder.Config.ScreenshotStore); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	controller := NewRecordingController(recorder)
+
+	if address, enabled := commandLineOption("--http"); enabled {
+		if address == "" {
+			address = defaultHTTPAPIAddress
+		}
+		recorder.Config.HTTPAPIAddress = address
+	}
+
+	if recording, enabled := commandLineOption("--export-segments"); enabled {
+		if recording != "" {
+			// Split an existing recording and exit
+			if err := runSegmentsExport(recording); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		recorder.Config.ExportSegments = true
+	}
+
+	if debuggingURL, enabled := commandLineOption("--cdp"); enabled {
+		if debuggingURL == "" {
+			debuggingURL = defaultCDPDebuggingURL
+		}
+		recorder.Config.CDPDebuggingURL = debuggingURL
+	}
+
+	if entities, enabled := commandLineOption("--mask-pii"); enabled {
+		recorder.Config.MaskPII = true
+		if entities != "" {
+			recorder.Config.PIIEntities = strings.Split(entities, ",")
+		}
+	}
+	if filename, set := commandLineOption("--pii-patterns"); set && filename != "" {
+		patterns, err := LoadPIIPatterns(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		recorder.Config.PIIPatterns = patterns
+	}
+
+	if filename, set := commandLineOption("--profiles"); set && filename != "" {
+		profiles, err := LoadApplicationProfiles(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		recorder.Config.ApplicationProfiles = profiles
+	}
+
+	if command, enabled := commandLineOption("--ocr"); enabled {
+		if command == "" {
+			command = defaultOCRCommand
+		}
+		recorder.Config.OCRCommand = command
+		if language, set := commandLineOption("--ocr-lang"); set && language != "" {
+			recorder.Config.OCRLanguage = language
+		}
+	}
+
+	if server, enabled := commandLineOption("--ntp"); enabled {
+		if server == "" {
+			server = defaultNTPServer
+		}
+		recorder.Config.NTPServer = server
+	}
+
+	if endpoint, enabled := commandLineOption("--vision"); enabled {
+		if endpoint == "" {
+			endpoint = defaultVisionEndpoint
+		}
+		recorder.Config.VisionEndpoint = endpoint
+		if key := os.Getenv("VISION_API_KEY"); key != "" {
+			recorder.Config.VisionAPIKey = key
+		}
+		if model, set := commandLineOption("--vision-model"); set && model != "" {
+			recorder.Config.VisionModel = model
+		}
+		if _, set := commandLineOption("--vision-crop"); set {
+			recorder.Config.VisionCropToElement = true
+		}
+	}
+
+	if endpoint, enabled := commandLineOption("--update-endpoint"); enabled && endpoint != "" {
+		recorder.Config.UpdateEndpoint = endpoint
+		if channel, set := commandLineOption("--update-channel"); set && channel != "" {
+			if channel != UpdateChannelStable && channel != UpdateChannelBeta {
+				log.Fatalf("Invalid --update-channel %q: must be %s or %s", channel, UpdateChannelStable, UpdateChannelBeta)
+			}
+			recorder.Config.UpdateChannel = channel
+		}
+		if key, set := commandLineOption("--update-key"); set && key != "" {
+			recorder.Config.UpdatePublicKey = key
+		}
+	}
+
+	// --pause-hotkey=none turns the hotkey off
+	if strings.EqualFold(recorder.Config.PauseHotkey, "none") {
+		recorder.Config.PauseHotkey = ""
+	}
+
+	if endpoint, enabled := commandLineOption("--telemetry"); enabled && endpoint != "" {
+		recorder.Config.TelemetryEndpoint = endpoint
+	}
+
+	if directory, set := commandLineOption("--output"); set && directory != "" {
+		recorder.Config.OutputDirectory = directory
+	}
+
+	if command == "serve" && recorder.Config.HTTPAPIAddress == "" {
+		recorder.Config.HTTPAPIAddress = defaultHTTPAPIAddress
+	}
+
+	// Installed options are checked as the daemon will run with them
+	if command == "daemon" || command == "daemon install" {
+		applyDaemonDefaults(&recorder.Config)
+	}
+
+	if command == "update" {
+		// update [options]: stage the channel's latest release now
+		updater, err := NewUpdater(recorder.Config)
+		if err == nil && updater == nil {
+			err = NewWorkflowError(ErrorTypeConfiguration, "No release endpoint; pass --update-endpoint=<url>", nil)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		version, err := updater.CheckAndStage()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if version == "" {
+			fmt.Println(Msg(MsgUpdateCurrent, recorderVersion, updater.Channel))
+			return
+		}
+		fmt.Println(Msg(MsgUpdateStaged, version))
+		return
+	}
+
+	if command == "config lint" {
+		// config lint [options]: check the configuration the options make
+		findings := LintConfig(recorder.Config)
+		for _, finding := range findings {
+			fmt.Printf("⚠️  [%s] %s\n", finding.Rule, finding.Message)
+		}
+		if len(findings) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println(Msg(MsgLintClean))
+		return
+	}
+
+	if recording, enabled := commandLineOption("--export-script"); enabled && recording != "" {
+		format, _ := commandLineOption("--script-format")
+		if err := runScriptExport(recording, ScriptFormat(format)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if recording, enabled := commandLineOption("--export-llm"); enabled && recording != "" {
+		if err := runLLMExport(recording, recorder.Config.ScreenshotStore); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := ValidateConfig(&recorder.Config); err != nil {
+		log.Fatal(err)
+	}
+	limit, err := recordingDuration()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if command == "daemon install" {
+		// daemon install [options]: start the daemon with these options at every login
+		installed, err := installDaemon(recorder.Config.OutputDirectory, os.Args[3:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(Msg(MsgDaemonInstalled, installed))
+		return
+	}
+
+	if command == "daemon uninstall" {
+		// daemon uninstall: stop starting the daemon at login
+		removed, err := uninstallDaemon()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if removed {
+			fmt.Println(Msg(MsgDaemonUninstalled))
+		} else {
+			fmt.Println(Msg(MsgDaemonNotInstalled))
+		}
+		return
+	}
+
+	logFile, err := NewRotatingLog(recorder.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// A daemon in the background has no console left to print to
+	_, background := commandLineOption("--background")
+	if background && command == "daemon" {
+		detachConsole()
+		recorder.Config.Silent = true
+	}
+	if logFile != nil {
+		setupLogging(recorder.Config, logFile)
+		defer logFile.Close()
+	} else {
+		setupLogging(recorder.Config, os.Stderr)
+	}
+	// Events are streamed to stdout, so the console messages go to stderr
+	if hasStdoutSink(recorder.Config.EventSinks) {
+		os.Stdout = os.Stderr
+	}
+
+	// Held until the process exits. Claimed before the HTTP API starts, so
+	// a takeover frees the API port first.
+	_, takeover := commandLineOption("--takeover")
+	guard, err := AcquireInstanceGuard(recorderInstanceName, takeover, takeoverTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Checked once this is the session's recorder, so a running recorder's
+	// autosave is never taken for a crashed one's. --resume carries on the
+	// latest unfinished recording instead of starting a new one, as a daemon
+	// always does.
+	unfinished := unfinishedRecordings(recorder.Config.OutputDirectory)
+	var resumeFrom string
+	if _, resume := commandLineOption("--resume"); (resume && command == "record") || command == "daemon" {
+		if len(unfinished) == 0 {
+			printConsole(Msg(MsgNothingToResume))
+		} else {
+			resumeFrom, unfinished = unfinished[len(unfinished)-1], unfinished[:len(unfinished)-1]
+		}
+	}
+	_, recoverAll := commandLineOption("--recover")
+	recoverUnfinishedRecordings(unfinished, recoverAll)
+
+	// Started once this is the session's recorder, so a refused second
+	// instance does not count as an unclean exit
+	if telemetry := NewTelemetry(recorder.Config); telemetry != nil {
+		recorder.Telemetry = telemetry
+		defer telemetry.Close()
+		go runTelemetry(telemetry)
+		logger("telemetry").Info("Sending anonymous health reports", "endpoint", telemetry.Endpoint)
+	}
+
+	// Counted across recordings, so a daily cap holds however often
+	// recording is started and stopped
+	recorder.Quotas = NewQuotaEnforcer(recorder.Config)
+
+	if recorder.Config.AutoUpdate {
+		updater, err := NewUpdater(recorder.Config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go runAutoUpdate(updater)
+	}
+
+	// Receives when a client asks through the HTTP API for the recorder to exit
+	var shutdowns <-chan struct{}
+	var apiServer *HTTPAPIServer
+	if address := recorder.Config.HTTPAPIAddress; address != "" {
+		apiServer = NewHTTPAPIServer(address, controller)
+		shutdowns = apiServer.ShutdownRequests()
+		if recorder.currentConfig().HTTPAPIToken == "" {
+			if path, err := saveHTTPAPIToken(apiServer.Token); err != nil {
+				logger("http").Error("Failed to save the HTTP API token", "error", err)
+			} else {
+				logger("http").Info("HTTP API token written", "file", path)
+			}
+		}
+		go func() {
+			if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger("http").Error("HTTP API server stopped", "error", err)
+			}
+		}()
+		logger("http").Info("HTTP API listening", "url", "http://"+address)
+		logger("http").Info("Live viewer", "url", "http://"+address+"/viewer")
+	}
+
+	if _, enabled := commandLineOption("--mcp"); enabled {
+		go func() {
+			<-guard.StopRequests()
+			stopForTakeover(controller)
+		}()
+		if err := runMCPServer(controller); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if _, skip := commandLineOption("--skip-self-check"); !skip {
+		results := RunSelfCheck(recorder.currentConfig(), recorder.Screenshots, ".")
+		printSelfCheck(results)
+		if !selfCheckPassed(results) {
+			log.Fatal("Self-check failed; fix the checks marked ❌ or pass --skip-self-check")
+		}
+	}
+
+	// Done on Ctrl+C or SIGTERM
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Receives when Exit is chosen from the tray icon
+	var trayExits <-chan struct{}
+	if tray := NewTrayIcon(recorder.currentConfig(), controller); tray != nil {
+		if err := tray.Start(); err != nil {
+			logger("tray").Warn("Tray icon unavailable", "error", err)
+		} else {
+			defer tray.Close()
+			trayExits = tray.ExitRequests()
+		}
+	}
+
+	// Fires at the --duration limit; never without one
+	var timeLimit <-chan time.Time
+	// Receives when a recording limit stops the recording this command started
+	var limitStops <-chan string
+
+	if command == "serve" {
+		printConsole(Msg(MsgServing, recorder.currentConfig().HTTPAPIAddress))
+	} else {
+		config := recorder.currentConfig()
+		printConsole(Msg(MsgStarted))
+		printConsole(Msg(MsgFeatures))
+		printConsole(Msg(MsgPerformanceMode, config.PerformanceMode))
+		printConsole(Msg(MsgScreenshots, config.CaptureScreenshots, config.ScreenshotFormat))
+		if config.DryRun {
+			printConsole(Msg(MsgDryRunBanner))
+		}
+		printConsole(Msg(MsgPressCtrlC))
+		if combination := config.PauseHotkey; combination != "" {
+			printConsole(Msg(MsgPauseHotkey, combination))
+		}
+		if limit > 0 {
+			printConsole(Msg(MsgDurationLimit, limit))
+			timeLimit = time.After(limit)
+		}
+
+		if resumeFrom != "" {
+			marker, err := controller.ResumeSession(resumeFrom)
+			if err != nil {
+				log.Fatal(err)
+			}
+			printConsole(Msg(MsgResumed, filepath.Dir(resumeFrom), marker.SessionInterrupted,
+				FormatDuration(time.Duration(marker.GapMs)*time.Millisecond)))
+		} else if err := controller.Start("Enhanced Workflow Recording"); err != nil {
+			log.Fatal(err)
+		}
+		limitStops = controller.LimitStops
+	}
+
+	select {
+	case <-signals.Done():
+		printConsole("\n" + Msg(MsgStopping))
+	case <-guard.StopRequests():
+		printConsole("\n" + Msg(MsgTakeover))
+	case <-shutdowns:
+		printConsole("\n" + Msg(MsgShutdownRequested))
+	case <-trayExits:
+		printConsole("\n" + Msg(MsgTrayExitChosen))
+	case <-timeLimit:
+		printConsole("\n" + Msg(MsgDurationReached, limit))
+	case <-limitStops:
+		// Already saved
+		recorder.Screenshots.Close()
+		return
+	}
+
+	// From here a second Ctrl+C exits at once, and saving gives up waiting
+	// on captions, OCR and the event sinks after shutdownTimeout
+	stopSignals()
+	shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if apiServer != nil {
+		defer apiServer.Shutdown(shutdown)
+	}
+
+	// The recording may already have been stopped remotely through the HTTP API
+	if !controller.IsRecording() {
+		recorder.Screenshots.Close()
+		printConsole(Msg(MsgNothingToSave))
+		return
+	}
+
+	if recorder.currentConfig().DryRun {
+		_, err := controller.StopContext(shutdown)
+		recorder.Screenshots.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	workflow, filename, err := controller.StopAndSaveContext(shutdown)
+	recorder.Screenshots.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	printConsole(Msg(MsgSaved, filename))
+	printConsole(Msg(MsgTotalEvents, workflow.EventCount()))
+	printConsole(Msg(MsgDuplicates, recorder.Deduplicator.GetSuppressedCount()))
+	printConsole(Msg(MsgDuration,
+		float64(workflow.EndTime-workflow.StartTime)/1000.0))
+}
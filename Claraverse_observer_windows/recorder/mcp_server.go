@@ -0,0 +1,420 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// MCP (Model Context Protocol) server exposing the recorder as agent tools
+// over JSON-RPC 2.0 on stdio, one message per line
+
+const mcpProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes
+const (
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+)
+
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+// MCPTool describes a tool in tools/list
+type MCPTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// MCPContent is one content block of a tool result
+type MCPContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// MCPToolResult is the result payload of tools/call
+type MCPToolResult struct {
+	Content []MCPContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// MCPServer serves MCP requests and drives recordings through a shared controller
+type MCPServer struct {
+	Input      io.Reader
+	Output     io.Writer
+	Controller *RecordingController
+
+	WriteMutex sync.Mutex
+}
+
+// NewMCPServer creates a server reading requests from in and writing responses to out
+func NewMCPServer(in io.Reader, out io.Writer, controller *RecordingController) *MCPServer {
+	return &MCPServer{
+		Input:      in,
+		Output:     out,
+		Controller: controller,
+	}
+}
+
+// runMCPServer serves MCP on stdio. Stdout carries the protocol, so console
+// output from the capture loop is redirected to stderr.
+func runMCPServer(controller *RecordingController) error {
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+
+	server := NewMCPServer(os.Stdin, protocolOut, controller)
+	logger("mcp").Info("MCP server listening on stdio")
+	return server.Serve()
+}
+
+// Serve reads requests until the input is closed
+func (s *MCPServer) Serve() error {
+	scanner := bufio.NewScanner(s.Input)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var request jsonRPCRequest
+		if err := json.Unmarshal([]byte(line), &request); err != nil {
+			s.writeError(json.RawMessage("null"), jsonRPCParseError, "Parse error: "+err.Error())
+			continue
+		}
+
+		s.handleRequest(request)
+	}
+
+	if s.Controller.IsRecording() {
+		if _, filename, err := s.Controller.StopAndSave(); err != nil {
+			logger("mcp").Error("Failed to save recording on shutdown", "error", err)
+		} else {
+			logger("mcp").Info("Recording saved", "file", filename)
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *MCPServer) handleRequest(request jsonRPCRequest) {
+	isNotification := len(request.ID) == 0
+
+	if request.JSONRPC != "2.0" {
+		if !isNotification {
+			s.writeError(request.ID, jsonRPCInvalidRequest, "Invalid request: jsonrpc must be 2.0")
+		}
+		return
+	}
+
+	var result interface{}
+	var rpcErr *jsonRPCError
+
+	switch request.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities": map[string]interface{}{
+				"tools": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{
+				"name":    "claraverse-observer",
+				"version": recorderVersion,
+			},
+		}
+	case "notifications/initialized", "notifications/cancelled":
+		return
+	case "ping":
+		result = map[string]interface{}{}
+	case "tools/list":
+		result = map[string]interface{}{"tools": mcpTools()}
+	case "tools/call":
+		result, rpcErr = s.handleToolCall(request.Params)
+	default:
+		rpcErr = &jsonRPCError{Code: jsonRPCMethodNotFound, Message: "Method not found: " + request.Method}
+	}
+
+	if isNotification {
+		return
+	}
+
+	if rpcErr != nil {
+		s.writeError(request.ID, rpcErr.Code, rpcErr.Message)
+		return
+	}
+
+	s.writeMessage(jsonRPCResponse{JSONRPC: "2.0", ID: request.ID, Result: result})
+}
+
+// mcpTools returns the tool catalogue
+func mcpTools() []MCPTool {
+	emptySchema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+
+	return []MCPTool{
+		{
+			Name:        "take_screenshot",
+			Description: "Capture the primary display and return it as an image",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"format": map[string]interface{}{"type": "string", "enum": []string{"png", "jpeg"}},
+				},
+			},
+		},
+		{
+			Name:        "click",
+			Description: "Move the cursor to screen coordinates and click",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"x":            map[string]interface{}{"type": "integer"},
+					"y":            map[string]interface{}{"type": "integer"},
+					"button":       map[string]interface{}{"type": "string", "enum": []string{"left", "right", "middle"}},
+					"double_click": map[string]interface{}{"type": "boolean"},
+				},
+				"required": []string{"x", "y"},
+			},
+		},
+		{
+			Name:        "type_text",
+			Description: "Type text into the focused control",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"text"},
+			},
+		},
+		{
+			Name:        "get_active_window",
+			Description: "Describe the foreground window and cursor position",
+			InputSchema: emptySchema,
+		},
+		{
+			Name:        "start_recording",
+			Description: "Start recording user activity into a workflow",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+		{
+			Name:        "stop_recording",
+			Description: "Stop the active recording and save it to disk",
+			InputSchema: emptySchema,
+		},
+	}
+}
+
+func (s *MCPServer) handleToolCall(params json.RawMessage) (interface{}, *jsonRPCError) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &jsonRPCError{Code: jsonRPCInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+	if len(call.Arguments) == 0 {
+		call.Arguments = json.RawMessage("{}")
+	}
+
+	switch call.Name {
+	case "take_screenshot":
+		return s.toolTakeScreenshot(call.Arguments), nil
+	case "click":
+		return s.toolClick(call.Arguments), nil
+	case "type_text":
+		return s.toolTypeText(call.Arguments), nil
+	case "get_active_window":
+		return s.toolGetActiveWindow(), nil
+	case "start_recording":
+		return s.toolStartRecording(call.Arguments), nil
+	case "stop_recording":
+		return s.toolStopRecording(), nil
+	default:
+		return nil, &jsonRPCError{Code: jsonRPCInvalidParams, Message: "Unknown tool: " + call.Name}
+	}
+}
+
+// Tool implementations
+
+func (s *MCPServer) toolTakeScreenshot(arguments json.RawMessage) MCPToolResult {
+	var args struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return mcpErrorResult("Invalid arguments: " + err.Error())
+	}
+
+	event := s.Controller.Recorder.Screenshots.CaptureNow(ScreenshotTriggerManual, args.Format)
+	if event == nil {
+		return mcpErrorResult("Screenshot capture failed")
+	}
+
+	mimeType := "image/png"
+	if event.ImageFormat == "jpeg" || event.ImageFormat == "jpg" {
+		mimeType = "image/jpeg"
+	}
+
+	return MCPToolResult{Content: []MCPContent{
+		{Type: "image", Data: event.ImageBase64, MimeType: mimeType},
+		{Type: "text", Text: fmt.Sprintf("%dx%d screenshot of %s", event.Width, event.Height, event.MonitorName)},
+	}}
+}
+
+func (s *MCPServer) toolClick(arguments json.RawMessage) MCPToolResult {
+	var args struct {
+		X           *int32 `json:"x"`
+		Y           *int32 `json:"y"`
+		Button      string `json:"button"`
+		DoubleClick bool   `json:"double_click"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return mcpErrorResult("Invalid arguments: " + err.Error())
+	}
+	if args.X == nil || args.Y == nil {
+		return mcpErrorResult("x and y are required")
+	}
+
+	button := MouseButtonLeft
+	switch strings.ToLower(args.Button) {
+	case "", "left":
+	case "right":
+		button = MouseButtonRight
+	case "middle":
+		button = MouseButtonMiddle
+	default:
+		return mcpErrorResult("Unknown button: " + args.Button)
+	}
+
+	position := Position{X: *args.X, Y: *args.Y}
+	if err := SimulateMouseClick(position, button, args.DoubleClick); err != nil {
+		return mcpErrorResult(err.Error())
+	}
+
+	return mcpTextResult(fmt.Sprintf("Clicked %s at (%d, %d)", button, position.X, position.Y))
+}
+
+func (s *MCPServer) toolTypeText(arguments json.RawMessage) MCPToolResult {
+	var args struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return mcpErrorResult("Invalid arguments: " + err.Error())
+	}
+
+	if err := SimulateTextInput(args.Text); err != nil {
+		return mcpErrorResult(err.Error())
+	}
+
+	return mcpTextResult(fmt.Sprintf("Typed %d characters", len([]rune(args.Text))))
+}
+
+func (s *MCPServer) toolGetActiveWindow() MCPToolResult {
+	element := getCurrentUIElement()
+
+	info := map[string]interface{}{
+		"window_title":     element.WindowTitle,
+		"application_name": element.ApplicationName,
+		"process_id":       element.ProcessID,
+		"url":              element.URL,
+		"cursor_position":  getMousePosition(),
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return mcpErrorResult(err.Error())
+	}
+
+	return mcpTextResult(string(data))
+}
+
+func (s *MCPServer) toolStartRecording(arguments json.RawMessage) MCPToolResult {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return mcpErrorResult("Invalid arguments: " + err.Error())
+	}
+	if args.Name == "" {
+		args.Name = "MCP Workflow Recording"
+	}
+
+	if err := s.Controller.Start(args.Name); err != nil {
+		return mcpErrorResult(err.Error())
+	}
+
+	return mcpTextResult("Recording started: " + args.Name)
+}
+
+func (s *MCPServer) toolStopRecording() MCPToolResult {
+	workflow, filename, err := s.Controller.StopAndSave()
+	if err != nil {
+		return mcpErrorResult(err.Error())
+	}
+
+	return mcpTextResult(fmt.Sprintf("Recording saved to %s (%d events, %.2f seconds)",
+		filename, workflow.EventCount(), float64(workflow.EndTime-workflow.StartTime)/1000.0))
+}
+
+// Message helpers
+
+func (s *MCPServer) writeMessage(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger("mcp").Error("Failed to marshal MCP message", "error", err)
+		return
+	}
+
+	s.WriteMutex.Lock()
+	defer s.WriteMutex.Unlock()
+
+	s.Output.Write(append(data, '\n'))
+}
+
+func (s *MCPServer) writeError(id json.RawMessage, code int, message string) {
+	s.writeMessage(jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &jsonRPCError{Code: code, Message: message},
+	})
+}
+
+func mcpTextResult(text string) MCPToolResult {
+	return MCPToolResult{Content: []MCPContent{{Type: "text", Text: text}}}
+}
+
+func mcpErrorResult(text string) MCPToolResult {
+	return MCPToolResult{Content: []MCPContent{{Type: "text", Text: text}}, IsError: true}
+}
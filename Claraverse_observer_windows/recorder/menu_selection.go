@@ -0,0 +1,319 @@
+package recorder
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Menu selections. With RecordMenuSelections set, a WinEvent hook on a
+// thread of its own follows the menus of every application: the menu bar
+// being entered, context and system menus opening, their submenus opening
+// and closing, and the item highlighted in them, which UI Automation names
+// as keyboard focus moves to it. When the menu closes on a click on the
+// highlighted item, or on Enter, a MenuItemSelectedEvent is recorded with
+// the path to the item, "File", "Save As", so a recording says which
+// command was run where the clicks alone only show two places on screen.
+// Items that open a submenu are part of the path, not a selection; a menu
+// dismissed with Escape, Alt or a click elsewhere records nothing, and an
+// item chosen by its access key alone is not seen.
+
+var (
+	menuSelectionCallback  uintptr
+	menuSelectionCallbacks sync.Once
+	activeMenuSelections   *MenuWatcher // Receives the hook's events
+)
+
+const (
+	EVENT_SYSTEM_MENUSTART      = 0x0004
+	EVENT_SYSTEM_MENUEND        = 0x0005
+	EVENT_SYSTEM_MENUPOPUPSTART = 0x0006
+	EVENT_SYSTEM_MENUPOPUPEND   = 0x0007
+	EVENT_OBJECT_FOCUS          = 0x8005
+	OBJID_SYSMENU               = -1
+	OBJID_MENU                  = -3
+	uiaMenuItemControlType      = 50011
+)
+
+// Kinds of menu
+const (
+	MenuBar     = "menu_bar"
+	ContextMenu = "context"
+	SystemMenu  = "system"
+)
+
+// MenuItemSelectedEvent records a menu item being chosen
+type MenuItemSelectedEvent struct {
+	MenuItem    string        `json:"menu_item"`
+	MenuPath    []string      `json:"menu_path"` // The items leading to it, then the item, e.g. File, Save As
+	MenuKind    string        `json:"menu_kind"` // menu_bar, context or system
+	Application string        `json:"application"`
+	WindowTitle string        `json:"window_title"`
+	Metadata    EventMetadata `json:"metadata"`
+}
+
+// menuItem is an item highlighted in a menu
+type menuItem struct {
+	Name   string
+	Bounds [4]int32 // x, y, width and height on screen
+	Opener bool     // Its submenu was opened
+}
+
+// MenuWatcher follows the menu open in front, if any, and the items chosen
+// from it
+type MenuWatcher struct {
+	Kind        string   // Kind of the open menu; empty when none is
+	Submenus    []string // Item each open menu level was opened from, outermost first; "" for the first level of a context menu
+	Highlighted menuItem
+	Application string
+	WindowTitle string
+	Events      []WorkflowEvent
+	hook        winEventHook
+	Mutex       sync.Mutex
+}
+
+// NewMenuWatcher creates a watcher and starts its hook, or returns nil when
+// RecordMenuSelections is off or the hook cannot be set
+func NewMenuWatcher(config WorkflowRecorderConfig) *MenuWatcher {
+	if !config.RecordMenuSelections {
+		return nil
+	}
+	watcher := &MenuWatcher{}
+	if err := watcher.start(); err != nil {
+		printConsoleWarning(Msg(MsgMenuSelectionsUnavailable, err))
+		return nil
+	}
+	return watcher
+}
+
+// OpenMenu notes a menu of kind opening in application's window titled
+// title. A menu already open stays as it is.
+func (m *MenuWatcher) OpenMenu(kind, application, title string) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	if m.Kind != "" {
+		return
+	}
+	m.Kind, m.Application, m.WindowTitle = kind, application, title
+	m.Submenus, m.Highlighted = nil, menuItem{}
+}
+
+// OpenSubmenu notes a menu level opening from the highlighted item, or, with
+// no menu open, a context menu
+func (m *MenuWatcher) OpenSubmenu(application, title string) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	if m.Kind == "" {
+		m.Kind, m.Application, m.WindowTitle = ContextMenu, application, title
+		m.Submenus, m.Highlighted = nil, menuItem{}
+	}
+	m.Submenus = append(m.Submenus, m.Highlighted.Name)
+	m.Highlighted = menuItem{}
+}
+
+// CloseSubmenu notes the innermost menu level closing. The menu closes
+// with it when chosen(item) reports the highlighted item was picked, or
+// when it is the first level of a context menu; otherwise the item it was
+// opened from is highlighted again.
+func (m *MenuWatcher) CloseSubmenu(chosen func(menuItem) bool, now time.Time) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	if len(m.Submenus) == 0 {
+		return
+	}
+	if m.choose(chosen, now) || (len(m.Submenus) == 1 && m.Kind == ContextMenu) {
+		m.Kind, m.Submenus, m.Highlighted = "", nil, menuItem{}
+		return
+	}
+	opener := m.Submenus[len(m.Submenus)-1]
+	m.Submenus = m.Submenus[:len(m.Submenus)-1]
+	if opener != "" {
+		m.Highlighted = menuItem{Name: opener, Opener: true}
+	}
+}
+
+// Highlight notes an item of the innermost menu level being highlighted
+func (m *MenuWatcher) Highlight(item menuItem) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	if m.Kind != "" && item.Name != "" {
+		m.Highlighted = item
+	}
+}
+
+// CloseMenu notes the menu closing, recording the highlighted item if
+// chosen(item) reports it was picked
+func (m *MenuWatcher) CloseMenu(chosen func(menuItem) bool, now time.Time) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	m.choose(chosen, now)
+	m.Kind, m.Submenus, m.Highlighted = "", nil, menuItem{}
+}
+
+// choose records the highlighted item if chosen(item) reports it was
+// picked, and reports whether it was; the caller holds the mutex
+func (m *MenuWatcher) choose(chosen func(menuItem) bool, now time.Time) bool {
+	item := m.Highlighted
+	if m.Kind == "" || item.Name == "" || item.Opener || !chosen(item) {
+		return false
+	}
+	var path []string
+	for _, opener := range m.Submenus {
+		if opener != "" {
+			path = append(path, opener)
+		}
+	}
+	m.Events = append(m.Events, MenuItemSelectedEvent{
+		MenuItem:    item.Name,
+		MenuPath:    append(path, item.Name),
+		MenuKind:    m.Kind,
+		Application: m.Application,
+		WindowTitle: m.WindowTitle,
+		Metadata:    EventMetadata{Timestamp: uint64(now.UnixMilli())},
+	})
+	return true
+}
+
+// IsOpen reports whether a menu is open
+func (m *MenuWatcher) IsOpen() bool {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	return m.Kind != ""
+}
+
+// Drain returns the selections recorded since the last call
+func (m *MenuWatcher) Drain() []WorkflowEvent {
+	if m == nil {
+		return nil
+	}
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	events := m.Events
+	m.Events = nil
+	return events
+}
+
+// describeMenuSelection describes a menu item being chosen in a recording's
+// steps
+func describeMenuSelection(path []string, kind, application string, quote func(string) string) string {
+	description := "Chose " + quote(strings.Join(path, " → "))
+	switch kind {
+	case ContextMenu:
+		description += " from the context menu"
+	case SystemMenu:
+		description += " from the window menu"
+	}
+	if application != "" {
+		description += " in " + application
+	}
+	return description
+}
+
+// menuItemChosen reports whether the menu is closing on item being picked:
+// Enter is down, or the pointer is over it with neither Escape nor Alt down
+func menuItemChosen(item menuItem) bool {
+	if isKeyPressed(VK_ESCAPE) || isKeyPressed(VK_MENU) {
+		return false
+	}
+	if isKeyPressed(VK_RETURN) {
+		return true
+	}
+	position := getMousePosition()
+	bounds := item.Bounds
+	return position.X >= bounds[0] && position.X < bounds[0]+bounds[2] &&
+		position.Y >= bounds[1] && position.Y < bounds[1]+bounds[3]
+}
+
+// focusedMenuItem returns the menu item with keyboard focus, if that is
+// what has it
+func focusedMenuItem() (menuItem, bool) {
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return menuItem{}, false
+	}
+	defer client.Close()
+
+	element, err := client.FocusedElement()
+	if err != nil {
+		return menuItem{}, false
+	}
+	defer element.Release()
+
+	if elementControlType(element) != uiaMenuItemControlType {
+		return menuItem{}, false
+	}
+	item := menuItem{Name: strings.TrimSpace(elementString(element, vtblElementGetCurrentName))}
+	if bounds, ok := elementBounds(element); ok {
+		item.Bounds = [4]int32{bounds.Left, bounds.Top, bounds.Right - bounds.Left, bounds.Bottom - bounds.Top}
+	}
+	return item, item.Name != ""
+}
+
+// start runs the hook on a thread of its own, whose message loop delivers
+// its events, and returns once it is set
+func (m *MenuWatcher) start() error {
+	menuSelectionCallbacks.Do(func() {
+		menuSelectionCallback = syscall.NewCallback(menuSelectionEventProc)
+	})
+	ranges := []winEventRange{
+		{EVENT_SYSTEM_MENUSTART, EVENT_SYSTEM_MENUPOPUPEND},
+		{EVENT_OBJECT_FOCUS, EVENT_OBJECT_FOCUS},
+	}
+	return m.hook.start(menuSelectionCallback, ranges, func() { activeMenuSelections = m }, nil)
+}
+
+// Close removes the hook and ends its thread
+func (m *MenuWatcher) Close() {
+	if m == nil {
+		return
+	}
+	m.hook.Close()
+}
+
+// menuSelectionEventProc receives the hook's events on its thread
+func menuSelectionEventProc(hook, event, hwnd, idObject, idChild, thread, eventTime uintptr) uintptr {
+	m := activeMenuSelections
+	if m == nil {
+		return 0
+	}
+	// The menu belongs to the window in front, not to its popup window
+	front := func() (string, string) {
+		title, processID := getCurrentWindow()
+		return applicationName(processID, title), title
+	}
+
+	switch event {
+	case EVENT_SYSTEM_MENUSTART:
+		kind := ContextMenu
+		switch int32(idObject) {
+		case OBJID_MENU:
+			kind = MenuBar
+		case OBJID_SYSMENU:
+			kind = SystemMenu
+		}
+		application, title := front()
+		m.OpenMenu(kind, application, title)
+	case EVENT_SYSTEM_MENUPOPUPSTART:
+		application, title := front()
+		m.OpenSubmenu(application, title)
+	case EVENT_SYSTEM_MENUPOPUPEND:
+		m.CloseSubmenu(menuItemChosen, time.Now())
+	case EVENT_SYSTEM_MENUEND:
+		m.CloseMenu(menuItemChosen, time.Now())
+	case EVENT_OBJECT_FOCUS:
+		if !m.IsOpen() {
+			return 0
+		}
+		if item, ok := focusedMenuItem(); ok {
+			m.Highlight(item)
+		}
+	}
+	return 0
+}
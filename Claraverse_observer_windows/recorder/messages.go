@@ -0,0 +1,653 @@
+package recorder
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Message catalog of user-facing output: console messages, the self-check,
+// config lint findings and report templates. The locale comes from --lang
+// or the Windows user locale, falling back to English. Recorded events, JSON
+// fields and diagnostic logs stay in English so recordings have the same
+// schema whatever the operator's language.
+
+var procGetUserDefaultLocaleName = kernel32.NewProc("GetUserDefaultLocaleName")
+
+const (
+	defaultLocale      = "en"
+	localeNameMaxChars = 85 // LOCALE_NAME_MAX_LENGTH
+)
+
+// MessageKey identifies a user-facing message
+type MessageKey string
+
+// Console messages
+const (
+	MsgStarted                   MessageKey = "console.started"
+	MsgFeatures                  MessageKey = "console.features"
+	MsgPerformanceMode           MessageKey = "console.performance_mode"
+	MsgScreenshots               MessageKey = "console.screenshots"
+	MsgDryRunBanner              MessageKey = "console.dry_run_banner"
+	MsgPressCtrlC                MessageKey = "console.press_ctrl_c"
+	MsgStopping                  MessageKey = "console.stopping"
+	MsgTakeover                  MessageKey = "console.takeover"
+	MsgNothingToSave             MessageKey = "console.nothing_to_save"
+	MsgSaved                     MessageKey = "console.saved"
+	MsgTotalEvents               MessageKey = "console.total_events"
+	MsgDuplicates                MessageKey = "console.duplicates"
+	MsgDuration                  MessageKey = "console.duration"
+	MsgClipboard                 MessageKey = "console.clipboard"
+	MsgAppSwitch                 MessageKey = "console.app_switch"
+	MsgProfile                   MessageKey = "console.profile"
+	MsgMouseMove                 MessageKey = "console.mouse_move"
+	MsgMouseButton               MessageKey = "console.mouse_button"
+	MsgIntervalScreenshot        MessageKey = "console.interval_screenshot"
+	MsgHotkey                    MessageKey = "console.hotkey"
+	MsgTextInput                 MessageKey = "console.text_input"
+	MsgBrowserNavigation         MessageKey = "console.browser_navigation"
+	MsgSelection                 MessageKey = "console.selection"
+	MsgDragDrop                  MessageKey = "console.drag_drop"
+	MsgCDPClicked                MessageKey = "console.cdp_clicked"
+	MsgCDPSubmitted              MessageKey = "console.cdp_submitted"
+	MsgMarkerSet                 MessageKey = "console.marker_set"
+	MsgRecordingPaused           MessageKey = "console.recording_paused"
+	MsgRecordingResumed          MessageKey = "console.recording_resumed"
+	MsgPauseHotkey               MessageKey = "console.pause_hotkey"
+	MsgMarkerRemoved             MessageKey = "console.marker_removed"
+	MsgNoMarker                  MessageKey = "console.no_marker"
+	MsgAnnotationAdded           MessageKey = "console.annotation_added"
+	MsgAnnotationNote            MessageKey = "console.annotation_note"
+	MsgAnnotationPrompt          MessageKey = "console.annotation_prompt"
+	MsgReplayStarting            MessageKey = "console.replay_starting"
+	MsgReplayStep                MessageKey = "console.replay_step"
+	MsgReplayFinished            MessageKey = "console.replay_finished"
+	MsgReplayDivergence          MessageKey = "console.replay_divergence"
+	MsgReplayVerified            MessageKey = "console.replay_verified"
+	MsgReplayFallback            MessageKey = "console.replay_fallback"
+	MsgSchemaRejected            MessageKey = "console.schema_rejected"
+	MsgWindowGeometryUnavailable MessageKey = "console.window_geometry_unavailable"
+	MsgFileWatchFailed           MessageKey = "console.file_watch_failed"
+	MsgProcessesUnavailable      MessageKey = "console.processes_unavailable"
+	MsgMenuSelectionsUnavailable MessageKey = "console.menu_selections_unavailable"
+	MsgDialogsUnavailable        MessageKey = "console.dialogs_unavailable"
+	MsgFocusChangesUnavailable   MessageKey = "console.focus_changes_unavailable"
+	MsgSandboxStarting           MessageKey = "console.sandbox_starting"
+	MsgSandboxFinished           MessageKey = "console.sandbox_finished"
+	MsgServing                   MessageKey = "console.serving"
+	MsgDurationLimit             MessageKey = "console.duration_limit"
+	MsgDurationReached           MessageKey = "console.duration_reached"
+	MsgRecordingRotated          MessageKey = "console.recording_rotated"
+	MsgLimitStopped              MessageKey = "console.recording_limit_stopped"
+	MsgQuotaExceeded             MessageKey = "console.quota_exceeded"
+	MsgAuditFirst                MessageKey = "console.audit_first"
+	MsgAuditFinished             MessageKey = "console.audit_finished"
+	MsgAuditSummary              MessageKey = "console.audit_summary"
+	MsgReportWritten             MessageKey = "console.report_written"
+	MsgClipWritten               MessageKey = "console.clip_written"
+	MsgAnalyticsWritten          MessageKey = "console.analytics_written"
+	MsgRecordingsMerged          MessageKey = "console.recordings_merged"
+	MsgRecordingImported         MessageKey = "console.recording_imported"
+	MsgImportSkipped             MessageKey = "console.import_skipped"
+	MsgDatasetWritten            MessageKey = "console.dataset_written"
+	MsgDatasetSkipped            MessageKey = "console.dataset_skipped"
+	MsgTablesWritten             MessageKey = "console.tables_written"
+	MsgSegmentsExported          MessageKey = "console.segments_exported"
+	MsgScriptExported            MessageKey = "console.script_exported"
+	MsgRRWebExported             MessageKey = "console.rrweb_exported"
+	MsgLLMExported               MessageKey = "console.llm_exported"
+	MsgLLMDropped                MessageKey = "console.llm_dropped"
+	MsgUpdateCurrent             MessageKey = "console.update_current"
+	MsgUpdateStaged              MessageKey = "console.update_staged"
+	MsgLintClean                 MessageKey = "console.lint_clean"
+	MsgSelectorsChecked          MessageKey = "console.selectors_checked"
+	MsgStoreCollected            MessageKey = "console.store_collected"
+	MsgUnfinished                MessageKey = "console.unfinished"
+	MsgRecovered                 MessageKey = "console.recovered"
+	MsgResumed                   MessageKey = "console.resumed"
+	MsgNothingToResume           MessageKey = "console.nothing_to_resume"
+	MsgDaemonInstalled           MessageKey = "console.daemon_installed"
+	MsgDaemonUninstalled         MessageKey = "console.daemon_uninstalled"
+	MsgDaemonNotInstalled        MessageKey = "console.daemon_not_installed"
+	MsgShutdownRequested         MessageKey = "console.shutdown_requested"
+	MsgCommandEntered            MessageKey = "console.command_entered"
+	MsgFullscreenEntered         MessageKey = "console.fullscreen_entered"
+	MsgFullscreenLeft            MessageKey = "console.fullscreen_left"
+	MsgWindowTitleChanged        MessageKey = "console.window_title_changed"
+	MsgIdleStarted               MessageKey = "console.idle_started"
+	MsgIdleEnded                 MessageKey = "console.idle_ended"
+	MsgRecorderRecovered         MessageKey = "console.recorder_recovered"
+	MsgBookmarkAdded             MessageKey = "console.bookmark_added"
+)
+
+// Self-check messages
+const (
+	MsgSelfCheckTitle       MessageKey = "selfcheck.title"
+	MsgCheckLayout          MessageKey = "selfcheck.layout"
+	MsgCheckInput           MessageKey = "selfcheck.input"
+	MsgCheckUIAutomation    MessageKey = "selfcheck.ui_automation"
+	MsgCheckScreen          MessageKey = "selfcheck.screen"
+	MsgCheckDuplication     MessageKey = "selfcheck.duplication"
+	MsgCheckWrite           MessageKey = "selfcheck.write"
+	MsgCheckDisk            MessageKey = "selfcheck.disk"
+	MsgCheckCursorAt        MessageKey = "selfcheck.cursor_at"
+	MsgCheckCursorFailed    MessageKey = "selfcheck.cursor_failed"
+	MsgCheckAvailable       MessageKey = "selfcheck.available"
+	MsgCheckBlackScreen     MessageKey = "selfcheck.black_screen"
+	MsgCheckDuplicationGDI  MessageKey = "selfcheck.duplication_gdi"
+	MsgCheckWriteFailed     MessageKey = "selfcheck.write_failed"
+	MsgCheckFreeSpaceFailed MessageKey = "selfcheck.free_space_failed"
+	MsgCheckFreeSpace       MessageKey = "selfcheck.free_space"
+	MsgCheckNeedSpace       MessageKey = "selfcheck.need_space"
+)
+
+// Config lint messages
+const (
+	MsgLintClipboard        MessageKey = "lint.clipboard"
+	MsgLintPasswordManagers MessageKey = "lint.password_managers"
+	MsgLintHTTPAPI          MessageKey = "lint.http_api"
+	MsgLintVision           MessageKey = "lint.vision"
+	MsgLintCDP              MessageKey = "lint.cdp"
+	MsgStrictPrivacy        MessageKey = "lint.strict_privacy"
+)
+
+// Report template messages
+const (
+	MsgReportRecorded      MessageKey = "report.recorded"
+	MsgReportDuration      MessageKey = "report.duration"
+	MsgReportCounts        MessageKey = "report.counts"
+	MsgReportSteps         MessageKey = "report.steps"
+	MsgReportSegmentDetail MessageKey = "report.segment_detail"
+	MsgReportScreenshotAt  MessageKey = "report.screenshot_at"
+)
+
+// Tray icon messages
+const (
+	MsgTrayTooltip     MessageKey = "tray.tooltip"
+	MsgTrayRecording   MessageKey = "tray.recording"
+	MsgTrayPaused      MessageKey = "tray.paused"
+	MsgTrayStopped     MessageKey = "tray.stopped"
+	MsgTrayPause       MessageKey = "tray.pause"
+	MsgTrayResume      MessageKey = "tray.resume"
+	MsgTrayStopAndSave MessageKey = "tray.stop_and_save"
+	MsgTrayOpenFolder  MessageKey = "tray.open_folder"
+	MsgTrayOpenReport  MessageKey = "tray.open_report"
+	MsgTrayExit        MessageKey = "tray.exit"
+	MsgTrayExitChosen  MessageKey = "tray.exit_chosen"
+)
+
+// messageCatalogs holds the messages of each locale. Formats take their
+// arguments in the English order; use %[n]v to reorder them.
+var messageCatalogs = map[string]map[MessageKey]string{
+	"en": {
+		MsgStarted:                   "🚀 Enhanced UI Workflow Recorder Started",
+		MsgFeatures:                  "📊 Features: Screenshots, Rate Limiting, Browser Navigation, Performance Modes",
+		MsgPerformanceMode:           "⚙️  Performance Mode: %v",
+		MsgScreenshots:               "📸 Screenshots: %v (Format: %s)",
+		MsgDryRunBanner:              "🔎 Dry run: events are counted and shown redacted, nothing is written",
+		MsgPressCtrlC:                "Press Ctrl+C to stop recording...",
+		MsgStopping:                  "🛑 Stopping recorder...",
+		MsgTakeover:                  "🔁 Another recorder instance is taking over, stopping...",
+		MsgNothingToSave:             "ℹ️  No active recording to save",
+		MsgSaved:                     "✅ Enhanced recording saved to %s",
+		MsgTotalEvents:               "📊 Total events recorded: %d",
+		MsgDuplicates:                "🔁 Duplicate events suppressed: %d",
+		MsgDuration:                  "⏱️  Recording duration: %.2f seconds",
+		MsgClipboard:                 "📋 Clipboard: %s",
+		MsgAppSwitch:                 "🔄 App Switch: %s -> %s",
+		MsgProfile:                   "🎛️  Profile: %s",
+		MsgMouseMove:                 "🖱️  Mouse: (%d, %d) in %s",
+		MsgMouseButton:               "🖱️  %s at (%d, %d) - %s (%s)",
+		MsgIntervalScreenshot:        "📸 Interval screenshot captured",
+		MsgHotkey:                    "⌨️  Hotkey: %s (%s)",
+		MsgTextInput:                 "⌨️  Text input: '%s' in %s",
+		MsgBrowserNavigation:         "🌐 Browser %s: %s",
+		MsgSelection:                 "🔤 Selection: '%s' via %s",
+		MsgDragDrop:                  "🖐️  Drag & drop: (%d, %d) -> (%d, %d)",
+		MsgCDPClicked:                "🌐 Clicked %s on %s",
+		MsgCDPSubmitted:              "🌐 Submitted %s to %s",
+		MsgMarkerSet:                 "🏁 %s marked",
+		MsgRecordingPaused:           "⏸️  Recording paused; nothing is captured until it resumes",
+		MsgRecordingResumed:          "▶️  Recording resumed",
+		MsgPauseHotkey:               "Press %s to pause or resume recording",
+		MsgMarkerRemoved:             "↩️  Last segment marker removed",
+		MsgNoMarker:                  "↩️  No segment marker to remove",
+		MsgAnnotationAdded:           "📌 Moment marked for review",
+		MsgAnnotationNote:            "📌 Note added: %s",
+		MsgAnnotationPrompt:          "Note for this moment (optional):",
+		MsgReplayStarting:            "▶️  Replaying %d actions in %.0f seconds; switch to the window to replay into",
+		MsgReplayStep:                "▶️  %d/%d %s",
+		MsgReplayFinished:            "✅ Replay finished",
+		MsgReplayDivergence:          "⚠️  Step %d: %s is %q, recorded %q",
+		MsgReplayVerified:            "✅ Replay finished; all %d steps matched the recording",
+		MsgReplayFallback:            "⚠️  Clicking the recorded position (%[2]d, %[3]d): %[1]v",
+		MsgSchemaRejected:            "🚫 Strict mode: leaving out %s events with %s",
+		MsgWindowGeometryUnavailable: "⚠️  Window moves and resizes will not be recorded: %v",
+		MsgFileWatchFailed:           "⚠️  Cannot watch %s for file changes: %v",
+		MsgProcessesUnavailable:      "⚠️  Application launches and exits will not be recorded: %v",
+		MsgMenuSelectionsUnavailable: "⚠️  Menu items chosen will not be recorded: %v",
+		MsgDialogsUnavailable:        "⚠️  Dialogs and message boxes will not be recorded: %v",
+		MsgFocusChangesUnavailable:   "⚠️  Focus moving between controls will not be recorded: %v",
+		MsgSandboxStarting:           "🧪 Replaying in a sandbox from %s",
+		MsgSandboxFinished:           "✅ Sandboxed replay finished %d of %d steps; results in %s",
+		MsgServing:                   "🌐 Waiting for recording requests on http://%s; press Ctrl+C to exit",
+		MsgDurationLimit:             "⏱️  Recording stops by itself after %s",
+		MsgDurationReached:           "⏱️  Recording time limit of %s reached",
+		MsgRecordingRotated:          "🔄 Recording reached its %s limit; saved %s and continuing in a new file",
+		MsgLimitStopped:              "⏹️  Recording reached its %s limit and was saved to %s",
+		MsgQuotaExceeded:             "🚦 Quota %q reached: no more %s of %s until %s",
+		MsgAuditFirst:                "🔎 First %s (redacted): %s",
+		MsgAuditFinished:             "🔎 Dry run finished, nothing was written",
+		MsgAuditSummary:              "Audit after %s: would capture %d events (%s)",
+		MsgReportWritten:             "📄 Wrote %s report to %s",
+		MsgClipWritten:               "🎞️  Wrote %s clip to %s",
+		MsgAnalyticsWritten:          "📊 Wrote analytics to %s and %s",
+		MsgRecordingsMerged:          "🔗 Merged %d recordings (%d events) into %s",
+		MsgRecordingImported:         "📥 Imported %d steps (%d events) into %s",
+		MsgImportSkipped:             "   %d commands that are not user actions were left out",
+		MsgDatasetWritten:            "🧠 Wrote %d samples from %d recordings (%d images) to %s",
+		MsgDatasetSkipped:            "   %d actions had no recent screenshot showing them and were left out",
+		MsgTablesWritten:             "📊 Wrote %d events from %d recordings as %d tables to %s",
+		MsgSegmentsExported:          "✂️  Exported %d segment(s) from %s",
+		MsgScriptExported:            "🧩 Exported %s script to %s",
+		MsgRRWebExported:             "🎞️  Exported %d rrweb events of %d pages to %s",
+		MsgLLMExported:               "🤖 Exported %d steps and %d screenshots (~%d of %d tokens) to %s",
+		MsgLLMDropped:                "   Dropped %d steps and %d screenshots, truncated %d texts",
+		MsgUpdateCurrent:             "✅ Recorder %s is up to date on the %s channel",
+		MsgUpdateStaged:              "⬇️  Update %s staged; it is installed the next time the recorder starts",
+		MsgLintClean:                 "✅ No privacy findings",
+		MsgSelectorsChecked:          "Checked %d selectors: %d ok, %d changed, %d missing, %d unchecked",
+		MsgStoreCollected:            "🧹 Removed %d unreferenced screenshots (%.1f MB); %d kept for %d recordings",
+		MsgUnfinished:                "⚠️  Found %d recording(s) left unsaved by a crash; start with --recover to save them or --resume to continue the latest",
+		MsgRecovered:                 "🩹 Recovered %d events of an unsaved recording to %s",
+		MsgResumed:                   "⏯️  Resumed the recording in %s after a %s; %s were not recorded",
+		MsgNothingToResume:           "No unfinished recording to resume; starting a new one",
+		MsgDaemonInstalled:           "✅ The daemon will start at every login with: %s",
+		MsgDaemonUninstalled:         "✅ The daemon will no longer start at login",
+		MsgDaemonNotInstalled:        "The daemon was not set to start at login",
+		MsgShutdownRequested:         "🛑 Shutdown requested through the HTTP API, stopping...",
+		MsgCommandEntered:            "⌨️  Command: '%s' in %s",
+		MsgFullscreenEntered:         "🎮 %s fullscreen in %s; screenshots through %s",
+		MsgFullscreenLeft:            "🎮 Left fullscreen",
+		MsgWindowTitleChanged:        "🪟 Window title: %q -> %q",
+		MsgIdleStarted:               "💤 No input for %s; capture stopped until the next",
+		MsgIdleEnded:                 "⏯️  Input again after %s idle; capture started again",
+		MsgRecorderRecovered:         "🩺 %s made no progress for %s; restarted it",
+		MsgBookmarkAdded:             "🔖 Bookmark: %s",
+
+		MsgSelfCheckTitle:       "🩺 Self-check:",
+		MsgCheckLayout:          "Win32 layout",
+		MsgCheckInput:           "Input polling",
+		MsgCheckUIAutomation:    "UI Automation",
+		MsgCheckScreen:          "Screen capture",
+		MsgCheckDuplication:     "Desktop duplication",
+		MsgCheckWrite:           "Write permission",
+		MsgCheckDisk:            "Disk space",
+		MsgCheckCursorAt:        "cursor at (%d, %d)",
+		MsgCheckCursorFailed:    "cannot read the cursor (%v); is this an interactive desktop session?",
+		MsgCheckAvailable:       "available",
+		MsgCheckBlackScreen:     "the captured screen is entirely black; is the session disconnected or locked?",
+		MsgCheckDuplicationGDI:  "%v; screenshots will be taken through GDI",
+		MsgCheckWriteFailed:     "cannot write to %s: %v",
+		MsgCheckFreeSpaceFailed: "cannot read free space: %v",
+		MsgCheckFreeSpace:       "%d MB free",
+		MsgCheckNeedSpace:       ", need %d MB",
+
+		MsgLintClipboard:        "clipboard contents are recorded without redaction, including copied passwords and tokens",
+		MsgLintPasswordManagers: "screenshots are captured and these password managers are not ignored: %s",
+		MsgLintHTTPAPI:          "HTTP API on %s serves recordings over the network without TLS",
+		MsgLintVision:           "screenshots are sent to vision endpoint %s without TLS",
+		MsgLintCDP:              "browser page contents are read from %s without TLS",
+		MsgStrictPrivacy:        "Strict privacy mode refuses to record: %s",
+
+		MsgReportRecorded:      "Recorded %s",
+		MsgReportDuration:      "Duration %s",
+		MsgReportCounts:        "%d steps, %d screenshots",
+		MsgReportSteps:         "Steps",
+		MsgReportSegmentDetail: "%s – %s, ended by %s",
+		MsgReportScreenshotAt:  "Screenshot at %s",
+
+		MsgTrayTooltip:     "ClaraVerse recorder: %s, %d events",
+		MsgTrayRecording:   "recording",
+		MsgTrayPaused:      "paused",
+		MsgTrayStopped:     "stopped",
+		MsgTrayPause:       "Pause",
+		MsgTrayResume:      "Resume",
+		MsgTrayStopAndSave: "Stop and save",
+		MsgTrayOpenFolder:  "Open output folder",
+		MsgTrayOpenReport:  "Open last report",
+		MsgTrayExit:        "Exit",
+		MsgTrayExitChosen:  "🛑 Exit chosen from the tray icon, stopping...",
+	},
+	"es": {
+		MsgStarted:                   "🚀 Grabador de flujos de trabajo iniciado",
+		MsgFeatures:                  "📊 Funciones: capturas de pantalla, límite de eventos, navegación del navegador, modos de rendimiento",
+		MsgPerformanceMode:           "⚙️  Modo de rendimiento: %v",
+		MsgScreenshots:               "📸 Capturas de pantalla: %v (formato: %s)",
+		MsgDryRunBanner:              "🔎 Simulación: los eventos se cuentan y se muestran censurados, no se escribe nada",
+		MsgPressCtrlC:                "Pulse Ctrl+C para detener la grabación...",
+		MsgStopping:                  "🛑 Deteniendo el grabador...",
+		MsgTakeover:                  "🔁 Otra instancia del grabador toma el control, deteniendo...",
+		MsgNothingToSave:             "ℹ️  No hay ninguna grabación activa que guardar",
+		MsgSaved:                     "✅ Grabación guardada en %s",
+		MsgTotalEvents:               "📊 Eventos grabados: %d",
+		MsgDuplicates:                "🔁 Eventos duplicados descartados: %d",
+		MsgDuration:                  "⏱️  Duración de la grabación: %.2f segundos",
+		MsgClipboard:                 "📋 Portapapeles: %s",
+		MsgAppSwitch:                 "🔄 Cambio de aplicación: %s -> %s",
+		MsgProfile:                   "🎛️  Perfil: %s",
+		MsgMouseMove:                 "🖱️  Ratón: (%d, %d) en %s",
+		MsgMouseButton:               "🖱️  %s en (%d, %d) - %s (%s)",
+		MsgIntervalScreenshot:        "📸 Captura periódica realizada",
+		MsgHotkey:                    "⌨️  Atajo: %s (%s)",
+		MsgTextInput:                 "⌨️  Texto introducido: '%s' en %s",
+		MsgBrowserNavigation:         "🌐 Navegador %s: %s",
+		MsgSelection:                 "🔤 Selección: '%s' mediante %s",
+		MsgDragDrop:                  "🖐️  Arrastrar y soltar: (%d, %d) -> (%d, %d)",
+		MsgCDPClicked:                "🌐 Clic en %s en %s",
+		MsgCDPSubmitted:              "🌐 Enviado %s a %s",
+		MsgMarkerSet:                 "🏁 Marcador %s establecido",
+		MsgRecordingPaused:           "⏸️  Grabación en pausa; no se captura nada hasta reanudarla",
+		MsgRecordingResumed:          "▶️  Grabación reanudada",
+		MsgPauseHotkey:               "Pulsa %s para pausar o reanudar la grabación",
+		MsgMarkerRemoved:             "↩️  Último marcador de segmento eliminado",
+		MsgNoMarker:                  "↩️  No hay marcador de segmento que eliminar",
+		MsgAnnotationAdded:           "📌 Momento marcado para revisión",
+		MsgAnnotationNote:            "📌 Nota añadida: %s",
+		MsgAnnotationPrompt:          "Nota para este momento (opcional):",
+		MsgReplayStarting:            "▶️  Reproduciendo %d acciones en %.0f segundos; cambie a la ventana donde reproducirlas",
+		MsgReplayStep:                "▶️  %d/%d %s",
+		MsgReplayFinished:            "✅ Reproducción terminada",
+		MsgReplayDivergence:          "⚠️  Paso %d: %s es %q, grabado %q",
+		MsgReplayVerified:            "✅ Reproducción terminada; los %d pasos coinciden con la grabación",
+		MsgReplayFallback:            "⚠️  Clic en la posición grabada (%[2]d, %[3]d): %[1]v",
+		MsgSchemaRejected:            "🚫 Modo estricto: se omiten eventos %s con %s",
+		MsgWindowGeometryUnavailable: "⚠️  No se grabarán los movimientos ni cambios de tamaño de ventanas: %v",
+		MsgFileWatchFailed:           "⚠️  No se pueden vigilar los cambios de archivos en %s: %v",
+		MsgProcessesUnavailable:      "⚠️  No se grabarán los inicios ni cierres de aplicaciones: %v",
+		MsgMenuSelectionsUnavailable: "⚠️  No se grabarán los elementos elegidos en los menús: %v",
+		MsgDialogsUnavailable:        "⚠️  No se grabarán los cuadros de diálogo ni de mensaje: %v",
+		MsgFocusChangesUnavailable:   "⚠️  No se grabarán los cambios de foco entre controles: %v",
+		MsgSandboxStarting:           "🧪 Reproduciendo en un entorno aislado desde %s",
+		MsgSandboxFinished:           "✅ Reproducción aislada terminada: %d de %d pasos; resultados en %s",
+		MsgServing:                   "🌐 Esperando solicitudes de grabación en http://%s; pulse Ctrl+C para salir",
+		MsgDurationLimit:             "⏱️  La grabación se detiene sola tras %s",
+		MsgDurationReached:           "⏱️  Se alcanzó el límite de grabación de %s",
+		MsgRecordingRotated:          "🔄 La grabación alcanzó su límite de %s; se guardó %s y continúa en un archivo nuevo",
+		MsgLimitStopped:              "⏹️  La grabación alcanzó su límite de %s y se guardó en %s",
+		MsgQuotaExceeded:             "🚦 Cuota %q alcanzada: no se graban más %s de %s hasta %s",
+		MsgAuditFirst:                "🔎 Primer %s (censurado): %s",
+		MsgAuditFinished:             "🔎 Simulación terminada, no se ha escrito nada",
+		MsgAuditSummary:              "Auditoría tras %s: se capturarían %d eventos (%s)",
+		MsgReportWritten:             "📄 Informe %s escrito en %s",
+		MsgClipWritten:               "🎞️  Clip %s escrito en %s",
+		MsgAnalyticsWritten:          "📊 Análisis escrito en %s y %s",
+		MsgRecordingsMerged:          "🔗 %d grabaciones (%d eventos) unidas en %s",
+		MsgRecordingImported:         "📥 %d pasos (%d eventos) importados en %s",
+		MsgImportSkipped:             "   %d comandos que no son acciones del usuario se omitieron",
+		MsgDatasetWritten:            "🧠 %d muestras de %d grabaciones (%d imágenes) escritas en %s",
+		MsgDatasetSkipped:            "   %d acciones sin una captura reciente que las muestre se omitieron",
+		MsgTablesWritten:             "📊 %d eventos de %d grabaciones escritos como %d tablas en %s",
+		MsgSegmentsExported:          "✂️  %d segmento(s) exportado(s) de %s",
+		MsgScriptExported:            "🧩 Script %s exportado a %s",
+		MsgRRWebExported:             "🎞️  %d eventos rrweb de %d páginas exportados a %s",
+		MsgLLMExported:               "🤖 %d pasos y %d capturas exportados (~%d de %d tokens) a %s",
+		MsgLLMDropped:                "   Descartados %d pasos y %d capturas, %d textos recortados",
+		MsgUpdateCurrent:             "✅ El grabador %s está actualizado en el canal %s",
+		MsgUpdateStaged:              "⬇️  Actualización %s preparada; se instalará la próxima vez que se inicie el grabador",
+		MsgLintClean:                 "✅ Sin problemas de privacidad",
+		MsgSelectorsChecked:          "%d selectores comprobados: %d correctos, %d cambiados, %d no encontrados, %d sin comprobar",
+		MsgStoreCollected:            "🧹 Se eliminaron %d capturas sin referencias (%.1f MB); se conservan %d para %d grabaciones",
+		MsgUnfinished:                "⚠️  Hay %d grabación(es) sin guardar por un fallo; inicie con --recover para guardarlas o con --resume para continuar la última",
+		MsgRecovered:                 "🩹 Se recuperaron %d eventos de una grabación sin guardar en %s",
+		MsgResumed:                   "⏯️  Se reanudó la grabación de %s tras un %s; no se grabaron %s",
+		MsgNothingToResume:           "No hay ninguna grabación sin terminar que reanudar; se inicia una nueva",
+		MsgDaemonInstalled:           "✅ El demonio se iniciará en cada inicio de sesión con: %s",
+		MsgDaemonUninstalled:         "✅ El demonio ya no se iniciará al iniciar sesión",
+		MsgDaemonNotInstalled:        "El demonio no estaba configurado para iniciarse al iniciar sesión",
+		MsgShutdownRequested:         "🛑 Se solicitó el cierre a través de la API HTTP, deteniendo...",
+		MsgCommandEntered:            "⌨️  Comando: '%s' en %s",
+		MsgFullscreenEntered:         "🎮 Pantalla completa %s en %s; capturas mediante %s",
+		MsgFullscreenLeft:            "🎮 Se salió de la pantalla completa",
+		MsgWindowTitleChanged:        "🪟 Título de la ventana: %q -> %q",
+		MsgIdleStarted:               "💤 Sin actividad durante %s; captura detenida hasta la próxima entrada",
+		MsgIdleEnded:                 "⏯️  Actividad de nuevo tras %s inactivo; captura reanudada",
+		MsgRecorderRecovered:         "🩺 %s no avanzó durante %s; se ha reiniciado",
+		MsgBookmarkAdded:             "🔖 Marcador: %s",
+
+		MsgSelfCheckTitle:       "🩺 Autocomprobación:",
+		MsgCheckLayout:          "Estructuras Win32",
+		MsgCheckInput:           "Lectura de entrada",
+		MsgCheckUIAutomation:    "UI Automation",
+		MsgCheckScreen:          "Captura de pantalla",
+		MsgCheckDuplication:     "Duplicación del escritorio",
+		MsgCheckWrite:           "Permiso de escritura",
+		MsgCheckDisk:            "Espacio en disco",
+		MsgCheckCursorAt:        "cursor en (%d, %d)",
+		MsgCheckCursorFailed:    "no se puede leer el cursor (%v); ¿es una sesión de escritorio interactiva?",
+		MsgCheckAvailable:       "disponible",
+		MsgCheckBlackScreen:     "la pantalla capturada es completamente negra; ¿está la sesión desconectada o bloqueada?",
+		MsgCheckDuplicationGDI:  "%v; las capturas se harán mediante GDI",
+		MsgCheckWriteFailed:     "no se puede escribir en %s: %v",
+		MsgCheckFreeSpaceFailed: "no se puede leer el espacio libre: %v",
+		MsgCheckFreeSpace:       "%d MB libres",
+		MsgCheckNeedSpace:       ", se necesitan %d MB",
+
+		MsgLintClipboard:        "el contenido del portapapeles se graba sin censurar, incluidas contraseñas y tokens copiados",
+		MsgLintPasswordManagers: "se toman capturas de pantalla y estos gestores de contraseñas no se ignoran: %s",
+		MsgLintHTTPAPI:          "la API HTTP en %s sirve grabaciones por la red sin TLS",
+		MsgLintVision:           "las capturas se envían al servicio de visión %s sin TLS",
+		MsgLintCDP:              "el contenido de las páginas se lee de %s sin TLS",
+		MsgStrictPrivacy:        "El modo de privacidad estricta impide grabar: %s",
+
+		MsgReportRecorded:      "Grabado el %s",
+		MsgReportDuration:      "Duración %s",
+		MsgReportCounts:        "%d pasos, %d capturas",
+		MsgReportSteps:         "Pasos",
+		MsgReportSegmentDetail: "%s – %s, terminado por %s",
+		MsgReportScreenshotAt:  "Captura en %s",
+
+		MsgTrayTooltip:     "Grabador ClaraVerse: %s, %d eventos",
+		MsgTrayRecording:   "grabando",
+		MsgTrayPaused:      "en pausa",
+		MsgTrayStopped:     "detenido",
+		MsgTrayPause:       "Pausar",
+		MsgTrayResume:      "Reanudar",
+		MsgTrayStopAndSave: "Detener y guardar",
+		MsgTrayOpenFolder:  "Abrir carpeta de salida",
+		MsgTrayOpenReport:  "Abrir último informe",
+		MsgTrayExit:        "Salir",
+		MsgTrayExitChosen:  "🛑 Se eligió Salir en el icono de la bandeja, deteniendo...",
+	},
+	"de": {
+		MsgStarted:                   "🚀 Workflow-Rekorder gestartet",
+		MsgFeatures:                  "📊 Funktionen: Screenshots, Ratenbegrenzung, Browser-Navigation, Leistungsmodi",
+		MsgPerformanceMode:           "⚙️  Leistungsmodus: %v",
+		MsgScreenshots:               "📸 Screenshots: %v (Format: %s)",
+		MsgDryRunBanner:              "🔎 Probelauf: Ereignisse werden gezählt und geschwärzt angezeigt, nichts wird gespeichert",
+		MsgPressCtrlC:                "Strg+C beendet die Aufzeichnung...",
+		MsgStopping:                  "🛑 Rekorder wird beendet...",
+		MsgTakeover:                  "🔁 Eine andere Rekorder-Instanz übernimmt, wird beendet...",
+		MsgNothingToSave:             "ℹ️  Keine aktive Aufzeichnung zu speichern",
+		MsgSaved:                     "✅ Aufzeichnung gespeichert unter %s",
+		MsgTotalEvents:               "📊 Aufgezeichnete Ereignisse: %d",
+		MsgDuplicates:                "🔁 Unterdrückte doppelte Ereignisse: %d",
+		MsgDuration:                  "⏱️  Dauer der Aufzeichnung: %.2f Sekunden",
+		MsgClipboard:                 "📋 Zwischenablage: %s",
+		MsgAppSwitch:                 "🔄 Anwendungswechsel: %s -> %s",
+		MsgProfile:                   "🎛️  Profil: %s",
+		MsgMouseMove:                 "🖱️  Maus: (%d, %d) in %s",
+		MsgMouseButton:               "🖱️  %s bei (%d, %d) - %s (%s)",
+		MsgIntervalScreenshot:        "📸 Intervall-Screenshot aufgenommen",
+		MsgHotkey:                    "⌨️  Tastenkürzel: %s (%s)",
+		MsgTextInput:                 "⌨️  Texteingabe: '%s' in %s",
+		MsgBrowserNavigation:         "🌐 Browser %s: %s",
+		MsgSelection:                 "🔤 Auswahl: '%s' per %s",
+		MsgDragDrop:                  "🖐️  Ziehen und Ablegen: (%d, %d) -> (%d, %d)",
+		MsgCDPClicked:                "🌐 %s auf %s angeklickt",
+		MsgCDPSubmitted:              "🌐 %s an %s gesendet",
+		MsgMarkerSet:                 "🏁 Markierung %s gesetzt",
+		MsgRecordingPaused:           "⏸️  Aufnahme pausiert; bis zur Fortsetzung wird nichts erfasst",
+		MsgRecordingResumed:          "▶️  Aufnahme fortgesetzt",
+		MsgPauseHotkey:               "%s drücken, um die Aufnahme zu pausieren oder fortzusetzen",
+		MsgMarkerRemoved:             "↩️  Letzte Segmentmarkierung entfernt",
+		MsgNoMarker:                  "↩️  Keine Segmentmarkierung zum Entfernen",
+		MsgAnnotationAdded:           "📌 Moment zur Überprüfung markiert",
+		MsgAnnotationNote:            "📌 Notiz hinzugefügt: %s",
+		MsgAnnotationPrompt:          "Notiz zu diesem Moment (optional):",
+		MsgReplayStarting:            "▶️  %d Aktionen werden in %.0f Sekunden abgespielt; wechseln Sie zum Zielfenster",
+		MsgReplayStep:                "▶️  %d/%d %s",
+		MsgReplayFinished:            "✅ Wiedergabe beendet",
+		MsgReplayDivergence:          "⚠️  Schritt %d: %s ist %q, aufgezeichnet %q",
+		MsgReplayVerified:            "✅ Wiedergabe beendet; alle %d Schritte stimmen mit der Aufzeichnung überein",
+		MsgReplayFallback:            "⚠️  Klick auf die aufgezeichnete Position (%[2]d, %[3]d): %[1]v",
+		MsgSchemaRejected:            "🚫 Strikter Modus: %s-Ereignisse mit %s werden ausgelassen",
+		MsgWindowGeometryUnavailable: "⚠️  Verschieben und Größenänderungen von Fenstern werden nicht aufgezeichnet: %v",
+		MsgFileWatchFailed:           "⚠️  Dateiänderungen in %s können nicht überwacht werden: %v",
+		MsgProcessesUnavailable:      "⚠️  Start und Beenden von Anwendungen werden nicht aufgezeichnet: %v",
+		MsgMenuSelectionsUnavailable: "⚠️  Gewählte Menüeinträge werden nicht aufgezeichnet: %v",
+		MsgDialogsUnavailable:        "⚠️  Dialoge und Meldungsfenster werden nicht aufgezeichnet: %v",
+		MsgFocusChangesUnavailable:   "⚠️  Fokuswechsel zwischen Steuerelementen werden nicht aufgezeichnet: %v",
+		MsgSandboxStarting:           "🧪 Wiedergabe in einer Sandbox aus %s",
+		MsgSandboxFinished:           "✅ Sandbox-Wiedergabe beendet: %d von %d Schritten; Ergebnisse in %s",
+		MsgServing:                   "🌐 Warte auf Aufnahmeanfragen unter http://%s; Strg+C zum Beenden",
+		MsgDurationLimit:             "⏱️  Die Aufnahme endet automatisch nach %s",
+		MsgDurationReached:           "⏱️  Aufnahmezeitlimit von %s erreicht",
+		MsgRecordingRotated:          "🔄 Aufnahme hat ihr %s-Limit erreicht; %s gespeichert, weiter in einer neuen Datei",
+		MsgLimitStopped:              "⏹️  Aufnahme hat ihr %s-Limit erreicht und wurde in %s gespeichert",
+		MsgQuotaExceeded:             "🚦 Kontingent %q erreicht: keine weiteren %s von %s bis %s",
+		MsgAuditFirst:                "🔎 Erstes %s (geschwärzt): %s",
+		MsgAuditFinished:             "🔎 Probelauf beendet, nichts wurde gespeichert",
+		MsgAuditSummary:              "Prüfung nach %s: %d Ereignisse würden aufgezeichnet (%s)",
+		MsgReportWritten:             "📄 %s-Bericht geschrieben nach %s",
+		MsgClipWritten:               "🎞️  %s-Clip geschrieben nach %s",
+		MsgAnalyticsWritten:          "📊 Auswertung geschrieben nach %s und %s",
+		MsgRecordingsMerged:          "🔗 %d Aufnahmen (%d Ereignisse) zusammengeführt in %s",
+		MsgRecordingImported:         "📥 %d Schritte (%d Ereignisse) importiert in %s",
+		MsgImportSkipped:             "   %d Befehle ohne Benutzeraktion wurden ausgelassen",
+		MsgDatasetWritten:            "🧠 %d Beispiele aus %d Aufnahmen (%d Bilder) geschrieben nach %s",
+		MsgDatasetSkipped:            "   %d Aktionen ohne aktuellen Screenshot wurden ausgelassen",
+		MsgTablesWritten:             "📊 %d Ereignisse aus %d Aufnahmen als %d Tabellen geschrieben nach %s",
+		MsgSegmentsExported:          "✂️  %d Segment(e) aus %s exportiert",
+		MsgScriptExported:            "🧩 %s-Skript exportiert nach %s",
+		MsgRRWebExported:             "🎞️  %d rrweb-Ereignisse von %d Seiten exportiert nach %s",
+		MsgLLMExported:               "🤖 %d Schritte und %d Screenshots (~%d von %d Tokens) exportiert nach %s",
+		MsgLLMDropped:                "   %d Schritte und %d Screenshots verworfen, %d Texte gekürzt",
+		MsgUpdateCurrent:             "✅ Rekorder %s ist im Kanal %s aktuell",
+		MsgUpdateStaged:              "⬇️  Update %s bereitgestellt; es wird beim nächsten Start des Rekorders installiert",
+		MsgLintClean:                 "✅ Keine Datenschutzbefunde",
+		MsgSelectorsChecked:          "%d Selektoren geprüft: %d in Ordnung, %d geändert, %d fehlen, %d nicht geprüft",
+		MsgStoreCollected:            "🧹 %d nicht referenzierte Screenshots entfernt (%.1f MB); %d für %d Aufnahmen behalten",
+		MsgUnfinished:                "⚠️  %d durch einen Absturz nicht gespeicherte Aufnahme(n) gefunden; mit --recover starten, um sie zu speichern, oder mit --resume, um die letzte fortzusetzen",
+		MsgRecovered:                 "🩹 %d Ereignisse einer nicht gespeicherten Aufnahme in %s wiederhergestellt",
+		MsgResumed:                   "⏯️  Aufnahme in %s nach einem %s fortgesetzt; %s wurden nicht aufgenommen",
+		MsgNothingToResume:           "Keine unfertige Aufnahme zum Fortsetzen; eine neue wird gestartet",
+		MsgDaemonInstalled:           "✅ Der Dienst startet bei jeder Anmeldung mit: %s",
+		MsgDaemonUninstalled:         "✅ Der Dienst startet nicht mehr bei der Anmeldung",
+		MsgDaemonNotInstalled:        "Der Dienst war nicht für den Start bei der Anmeldung eingerichtet",
+		MsgShutdownRequested:         "🛑 Beenden über die HTTP-API angefordert, wird beendet...",
+		MsgCommandEntered:            "⌨️  Befehl: '%s' in %s",
+		MsgFullscreenEntered:         "🎮 Vollbild (%s) in %s; Screenshots über %s",
+		MsgFullscreenLeft:            "🎮 Vollbild verlassen",
+		MsgWindowTitleChanged:        "🪟 Fenstertitel: %q -> %q",
+		MsgIdleStarted:               "💤 Seit %s keine Eingabe; Aufnahme bis zur nächsten angehalten",
+		MsgIdleEnded:                 "⏯️  Wieder Eingaben nach %s Leerlauf; Aufnahme läuft wieder",
+		MsgRecorderRecovered:         "🩺 %s kam %s lang nicht voran; neu gestartet",
+		MsgBookmarkAdded:             "🔖 Lesezeichen: %s",
+
+		MsgSelfCheckTitle:       "🩺 Selbsttest:",
+		MsgCheckLayout:          "Win32-Strukturen",
+		MsgCheckInput:           "Eingabeabfrage",
+		MsgCheckUIAutomation:    "UI Automation",
+		MsgCheckScreen:          "Bildschirmaufnahme",
+		MsgCheckDuplication:     "Desktop-Duplizierung",
+		MsgCheckWrite:           "Schreibrecht",
+		MsgCheckDisk:            "Speicherplatz",
+		MsgCheckCursorAt:        "Mauszeiger bei (%d, %d)",
+		MsgCheckCursorFailed:    "Mauszeiger nicht lesbar (%v); ist dies eine interaktive Desktop-Sitzung?",
+		MsgCheckAvailable:       "verfügbar",
+		MsgCheckBlackScreen:     "der aufgenommene Bildschirm ist vollständig schwarz; ist die Sitzung getrennt oder gesperrt?",
+		MsgCheckDuplicationGDI:  "%v; Bildschirmfotos werden über GDI aufgenommen",
+		MsgCheckWriteFailed:     "kann nicht nach %s schreiben: %v",
+		MsgCheckFreeSpaceFailed: "freier Speicherplatz nicht lesbar: %v",
+		MsgCheckFreeSpace:       "%d MB frei",
+		MsgCheckNeedSpace:       ", benötigt %d MB",
+
+		MsgLintClipboard:        "Inhalte der Zwischenablage werden ungeschwärzt aufgezeichnet, auch kopierte Passwörter und Tokens",
+		MsgLintPasswordManagers: "Screenshots werden aufgenommen und diese Passwortmanager werden nicht ignoriert: %s",
+		MsgLintHTTPAPI:          "die HTTP-API auf %s stellt Aufzeichnungen ohne TLS im Netzwerk bereit",
+		MsgLintVision:           "Screenshots werden ohne TLS an den Vision-Endpunkt %s gesendet",
+		MsgLintCDP:              "Seiteninhalte des Browsers werden ohne TLS von %s gelesen",
+		MsgStrictPrivacy:        "Der strenge Datenschutzmodus verweigert die Aufzeichnung: %s",
+
+		MsgReportRecorded:      "Aufgezeichnet am %s",
+		MsgReportDuration:      "Dauer %s",
+		MsgReportCounts:        "%d Schritte, %d Screenshots",
+		MsgReportSteps:         "Schritte",
+		MsgReportSegmentDetail: "%s – %s, beendet durch %s",
+		MsgReportScreenshotAt:  "Screenshot bei %s",
+
+		MsgTrayTooltip:     "ClaraVerse-Recorder: %s, %d Ereignisse",
+		MsgTrayRecording:   "nimmt auf",
+		MsgTrayPaused:      "pausiert",
+		MsgTrayStopped:     "gestoppt",
+		MsgTrayPause:       "Pausieren",
+		MsgTrayResume:      "Fortsetzen",
+		MsgTrayStopAndSave: "Beenden und speichern",
+		MsgTrayOpenFolder:  "Ausgabeordner öffnen",
+		MsgTrayOpenReport:  "Letzten Bericht öffnen",
+		MsgTrayExit:        "Beenden",
+		MsgTrayExitChosen:  "🛑 Beenden im Infobereich gewählt, wird beendet...",
+	},
+}
+
+// activeLocale is the catalog messages are taken from
+var activeLocale = defaultLocale
+
+// Msg formats the message for key in the active locale. Messages missing
+// from a catalog fall back to English.
+func Msg(key MessageKey, args ...interface{}) string {
+	format, ok := messageCatalogs[activeLocale][key]
+	if !ok {
+		format, ok = messageCatalogs[defaultLocale][key]
+	}
+	if !ok {
+		format = string(key)
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// SetLocale selects the catalog for a locale such as "de", "de-DE" or
+// "de_DE.UTF-8", or for the Windows user locale when locale is empty, and
+// returns the language used. Languages without a catalog use English.
+func SetLocale(locale string) string {
+	if locale == "" {
+		locale = systemLocale()
+	}
+
+	language := strings.ToLower(locale)
+	if i := strings.IndexAny(language, "-_."); i >= 0 {
+		language = language[:i]
+	}
+	if _, ok := messageCatalogs[language]; !ok {
+		language = defaultLocale
+	}
+
+	activeLocale = language
+	return language
+}
+
+// systemLocale returns the Windows user locale name, e.g. "de-DE", or ""
+func systemLocale() string {
+	buf := make([]uint16, localeNameMaxChars)
+	ret, _, _ := procGetUserDefaultLocaleName.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if ret == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf)
+}
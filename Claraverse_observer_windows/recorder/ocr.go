@@ -0,0 +1,214 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kbinani/screenshot"
+)
+
+// Optional OCR of screenshots with the Tesseract command line tool, so each
+// ScreenshotEvent can carry the text on screen with bounding boxes. Agents
+// can then find UI text without a vision model. Like captioning, OCR runs in
+// the background and the result is attached to the recorded event.
+
+const (
+	defaultOCRCommand    = "tesseract"
+	ocrMaxConcurrent     = 2
+	tesseractWordLevel   = 5
+	tesseractColumnCount = 12
+)
+
+// OCRRecognizer runs recorded screenshots through Tesseract and writes the
+// recognized text back into the workflow
+type OCRRecognizer struct {
+	Command         string
+	Language        string
+	MinConfidence   float64
+	Timeout         time.Duration
+	Slots           chan struct{}
+	Pending         sync.WaitGroup
+	RecognizedCount int64
+	FailedCount     int64
+	Redactor        *PIIRedactor // Masks PII in the recognized text, when set
+	Mutex           sync.Mutex
+}
+
+// NewOCRRecognizer creates a recognizer from config, or returns nil when OCR
+// is not enabled
+func NewOCRRecognizer(config WorkflowRecorderConfig) *OCRRecognizer {
+	if config.OCRCommand == "" {
+		return nil
+	}
+
+	return &OCRRecognizer{
+		Command:       config.OCRCommand,
+		Language:      config.OCRLanguage,
+		MinConfidence: config.OCRMinConfidence,
+		Timeout:       time.Duration(config.OCRTimeoutMs) * time.Millisecond,
+		Slots:         make(chan struct{}, ocrMaxConcurrent),
+	}
+}
+
+// Submit recognizes the text of shot in the background and stores it on the
+// matching screenshot event of workflow
+func (ocr *OCRRecognizer) Submit(workflow *RecordedWorkflow, shot ScreenshotEvent) {
+	ocr.Pending.Add(1)
+	go func() {
+		defer ocr.Pending.Done()
+
+		ocr.Slots <- struct{}{}
+		result := ocr.Recognize(shot, screenshot.GetDisplayBounds(0))
+		<-ocr.Slots
+		ocr.Redactor.MaskOCR(result)
+
+		ocr.Mutex.Lock()
+		if result.Error != "" {
+			ocr.FailedCount++
+		} else {
+			ocr.RecognizedCount++
+		}
+		ocr.Mutex.Unlock()
+
+		workflow.UpdateEvent(func(event WorkflowEvent) (WorkflowEvent, bool) {
+			recorded, ok := event.(ScreenshotEvent)
+			if !ok || recorded.CaptureID != shot.CaptureID {
+				return nil, false
+			}
+			recorded.OCR = result
+			return recorded, true
+		})
+	}()
+}
+
+// Wait blocks until submitted screenshots are recognized or timeout passes.
+// Returns false on timeout.
+func (ocr *OCRRecognizer) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		ocr.Pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Recognize runs Tesseract on shot, a capture of screen. Failures are
+// reported in the result's Error field.
+func (ocr *OCRRecognizer) Recognize(shot ScreenshotEvent, screen image.Rectangle) *OCRResult {
+	result := &OCRResult{Engine: "tesseract", Language: ocr.Language}
+
+	data, err := base64.StdEncoding.DecodeString(shot.ImageBase64)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ocr.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ocr.Command, "stdin", "stdout", "-l", ocr.Language, "tsv")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		result.Error = strings.TrimSpace(fmt.Sprintf("%v: %s", err, stderr.String()))
+		return result
+	}
+
+	result.Words, result.Text = parseTesseractTSV(stdout.String(), ocr.MinConfidence)
+	for i := range result.Words {
+		result.Words[i].ScreenBounds = ocrScreenBounds(result.Words[i].Bounds, screen, shot.Width, shot.Height)
+	}
+	return result
+}
+
+// GetStatistics returns OCR counters
+func (ocr *OCRRecognizer) GetStatistics() map[string]interface{} {
+	ocr.Mutex.Lock()
+	defer ocr.Mutex.Unlock()
+
+	return map[string]interface{}{
+		"command":          ocr.Command,
+		"language":         ocr.Language,
+		"recognized_count": ocr.RecognizedCount,
+		"failed_count":     ocr.FailedCount,
+	}
+}
+
+// parseTesseractTSV reads the words Tesseract is at least minConfidence
+// percent sure of from its TSV output, and the text they make line by line
+func parseTesseractTSV(tsv string, minConfidence float64) ([]OCRWord, string) {
+	var words []OCRWord
+	var lines []string
+	lineKey := ""
+
+	for i, row := range strings.Split(tsv, "\n") {
+		columns := strings.Split(strings.TrimRight(row, "\r"), "\t")
+		if i == 0 || len(columns) < tesseractColumnCount {
+			continue // Header or blank row
+		}
+		if level, _ := strconv.Atoi(columns[0]); level != tesseractWordLevel {
+			continue
+		}
+
+		text := strings.TrimSpace(strings.Join(columns[11:], "\t"))
+		confidence, err := strconv.ParseFloat(columns[10], 64)
+		if text == "" || err != nil || confidence < minConfidence {
+			continue
+		}
+
+		var bounds [4]int
+		for j := range bounds {
+			bounds[j], _ = strconv.Atoi(columns[6+j])
+		}
+
+		// Page, block, paragraph and line numbers identify the line
+		if key := strings.Join(columns[1:5], "."); key != lineKey {
+			lineKey = key
+			lines = append(lines, text)
+		} else {
+			lines[len(lines)-1] += " " + text
+		}
+
+		words = append(words, OCRWord{
+			Text:       text,
+			Confidence: confidence,
+			Bounds:     bounds,
+			Line:       len(lines) - 1,
+		})
+	}
+
+	return words, strings.Join(lines, "\n")
+}
+
+// ocrScreenBounds maps bounds on a width x height screenshot of screen to
+// screen coordinates
+func ocrScreenBounds(bounds [4]int, screen image.Rectangle, width, height int) [4]int {
+	if width <= 0 || height <= 0 {
+		return bounds
+	}
+
+	scaleX := float64(screen.Dx()) / float64(width)
+	scaleY := float64(screen.Dy()) / float64(height)
+	return [4]int{
+		screen.Min.X + int(float64(bounds[0])*scaleX),
+		screen.Min.Y + int(float64(bounds[1])*scaleY),
+		int(float64(bounds[2]) * scaleX),
+		int(float64(bounds[3]) * scaleY),
+	}
+}
@@ -0,0 +1,293 @@
+package recorder
+
+import (
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Office context. With OfficeContext set, events recorded in Excel, Word or
+// PowerPoint carry where in the document they happened: the workbook, the
+// active sheet and the selected range in Excel, the document in Word, the
+// presentation and the slide shown in PowerPoint. They are read through the
+// application's own object model, late bound through IDispatch, from the
+// document window in front; the window is probed at most every
+// officeProbeInterval, so a burst of events shares one read. Office refuses
+// these calls while a cell is being edited or a dialog is open, and events
+// then go without. The enrich stage of the event pipeline adds the context
+// to each event whose element belongs to the window in front, after PII
+// masking, so the names are masked here.
+
+var (
+	oleacc                         = syscall.NewLazyDLL("oleacc.dll")
+	procAccessibleObjectFromWindow = oleacc.NewProc("AccessibleObjectFromWindow")
+	procVariantClear               = oleaut32.NewProc("VariantClear")
+	procFindWindowEx               = user32.NewProc("FindWindowExW")
+
+	IID_IDispatch = GUID{0x00020400, 0x0000, 0x0000, [8]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}}
+	IID_NULL      = GUID{}
+)
+
+const (
+	OBJID_NATIVEOM       = -16
+	DISPATCH_PROPERTYGET = 0x2
+	LOCALE_USER_DEFAULT  = 0x0400
+	VT_DISPATCH          = 9
+
+	vtblDispatchGetIDsOfNames = 5
+	vtblDispatchInvoke        = 6
+
+	officeProbeInterval = 250 * time.Millisecond
+)
+
+// officeApplication is how to find an Office application's document window
+// and read its context: the classes of its frame window and the windows
+// down to its document window, and the properties of the document window's
+// object that hold each part of the context
+type officeApplication struct {
+	Name      string
+	Windows   []string // Classes from below the frame down to the document window
+	Document  []string
+	Sheet     []string
+	Selection []string
+	Slide     []string
+}
+
+// officeApplications are the Office applications probed, by the class of
+// their frame window
+var officeApplications = map[string]officeApplication{
+	"XLMAIN": {
+		Name:      "excel",
+		Windows:   []string{"XLDESK", "EXCEL7"},
+		Document:  []string{"Parent", "Name"},
+		Sheet:     []string{"ActiveSheet", "Name"},
+		Selection: []string{"RangeSelection", "Address"},
+	},
+	"OpusApp": {
+		Name:     "word",
+		Windows:  []string{"_WwF", "_WwB", "_WwG"},
+		Document: []string{"Document", "Name"},
+	},
+	"PPTFrameClass": {
+		Name:     "powerpoint",
+		Windows:  []string{"MDIClient", "mdiClass"},
+		Document: []string{"Presentation", "Name"},
+		Slide:    []string{"View", "Slide", "SlideIndex"},
+	},
+}
+
+// DISPPARAMS is the arguments of an IDispatch call
+type DISPPARAMS struct {
+	Args       uintptr
+	NamedArgs  uintptr
+	ArgCount   uint32
+	NamedCount uint32
+}
+
+// OfficeProbe reads the Office context of the window in front, keeping the
+// last read for officeProbeInterval
+type OfficeProbe struct {
+	Window     uintptr // The window last probed
+	Context    *OfficeContext
+	LastProbe  time.Time
+	Read       func(hwnd uintptr) *OfficeContext       // Reads a window's context; nil when it has none
+	Foreground func() (hwnd uintptr, processID uint32) // The window in front and its process
+	Mutex      sync.Mutex
+}
+
+// NewOfficeProbe creates a probe, or returns nil when OfficeContext is off
+func NewOfficeProbe(config WorkflowRecorderConfig) *OfficeProbe {
+	if !config.OfficeContext {
+		return nil
+	}
+	return &OfficeProbe{Read: readOfficeContext, Foreground: foregroundWindowProcess}
+}
+
+// Current returns the Office context of hwnd, read afresh if hwnd was not
+// the window last probed or the last read is older than
+// officeProbeInterval
+func (p *OfficeProbe) Current(hwnd uintptr, now time.Time) *OfficeContext {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+
+	if hwnd != p.Window || now.Sub(p.LastProbe) >= officeProbeInterval {
+		p.Window, p.LastProbe = hwnd, now
+		p.Context = p.Read(hwnd)
+	}
+	return p.Context
+}
+
+// withOfficeContext returns event with office as its context if its element
+// belongs to process processID
+func withOfficeContext(event WorkflowEvent, office *OfficeContext, processID uint32) WorkflowEvent {
+	metadata, ok := eventMetadata(event)
+	if !ok || office == nil || metadata.Office != nil || metadata.UIElement == nil || metadata.UIElement.ProcessID != processID {
+		return event
+	}
+	context := *office
+	metadata.Office = &context
+	return setEventMetadata(event, metadata)
+}
+
+// enrichOfficeContext adds the Office context of the window in front to
+// events recorded in it
+func (r *Recorder) enrichOfficeContext(ctx *EventContext, event WorkflowEvent) (WorkflowEvent, bool) {
+	r.Mutex.RLock()
+	probe, redactor := r.Office, r.PII
+	r.Mutex.RUnlock()
+	if probe == nil {
+		return event, true
+	}
+
+	hwnd, processID := probe.Foreground()
+	office := probe.Current(hwnd, ctx.Now)
+	if office != nil && redactor != nil {
+		masked := *office
+		masked.Document = redactor.Mask(masked.Document)
+		masked.Sheet = redactor.Mask(masked.Sheet)
+		office = &masked
+	}
+	return withOfficeContext(event, office, processID), true
+}
+
+// foregroundWindowProcess returns the window in front and its process
+func foregroundWindowProcess() (uintptr, uint32) {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	var processID uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&processID)))
+	return hwnd, processID
+}
+
+// readOfficeContext reads the context of an Office application's frame
+// window, or returns nil when hwnd is not one or it cannot be read
+func readOfficeContext(hwnd uintptr) *OfficeContext {
+	application, ok := officeApplications[getWindowClassName(hwnd)]
+	if !ok {
+		return nil
+	}
+	document := hwnd
+	for _, class := range application.Windows {
+		if document = findChildWindow(document, class); document == 0 {
+			return nil
+		}
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	hr, _, _ := procCoInitializeEx.Call(0, COINIT_MULTITHREADED)
+	if !failedHRESULT(hr) {
+		defer procCoUninitialize.Call()
+	} else if uint32(hr) != RPC_E_CHANGED_MODE {
+		return nil
+	}
+
+	var window comObject
+	objectID := int32(OBJID_NATIVEOM)
+	hr, _, _ = procAccessibleObjectFromWindow.Call(document, uintptr(objectID),
+		uintptr(unsafe.Pointer(&IID_IDispatch)), uintptr(unsafe.Pointer(&window)))
+	if failedHRESULT(hr) || window == 0 {
+		return nil
+	}
+	defer window.Release()
+
+	context := &OfficeContext{
+		Application: application.Name,
+		Document:    dispatchString(window, application.Document...),
+		Sheet:       dispatchString(window, application.Sheet...),
+		Selection:   dispatchString(window, application.Selection...),
+		Slide:       dispatchInt(window, application.Slide...),
+	}
+	if context.Document == "" {
+		return nil
+	}
+	return context
+}
+
+// findChildWindow returns the first child window of parent of class, or 0
+func findChildWindow(parent uintptr, class string) uintptr {
+	className, err := syscall.UTF16PtrFromString(class)
+	if err != nil {
+		return 0
+	}
+	child, _, _ := procFindWindowEx.Call(parent, 0, uintptr(unsafe.Pointer(className)), 0)
+	return child
+}
+
+// dispatchProperty reads the property at path from object, following each
+// name but the last to an object. The caller must VariantClear the result.
+func dispatchProperty(object comObject, path ...string) (VARIANT, bool) {
+	var result VARIANT
+	if len(path) == 0 {
+		return result, false
+	}
+	current := object
+	for i, name := range path {
+		if i > 0 {
+			if result.VT != VT_DISPATCH || result.Val[0] == 0 {
+				procVariantClear.Call(uintptr(unsafe.Pointer(&result)))
+				return VARIANT{}, false
+			}
+			// The object read last is now the one to read from
+			if current != object {
+				current.Release()
+			}
+			current, result = comObject(result.Val[0]), VARIANT{}
+		}
+		if !dispatchGet(current, name, &result) {
+			if current != object {
+				current.Release()
+			}
+			return VARIANT{}, false
+		}
+	}
+	if current != object {
+		current.Release()
+	}
+	return result, true
+}
+
+// dispatchGet reads the property name of object into result
+func dispatchGet(object comObject, name string, result *VARIANT) bool {
+	nameBuf, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return false
+	}
+	var dispatchID int32
+	hr := object.call(vtblDispatchGetIDsOfNames, uintptr(unsafe.Pointer(&IID_NULL)), uintptr(unsafe.Pointer(&nameBuf)), 1,
+		LOCALE_USER_DEFAULT, uintptr(unsafe.Pointer(&dispatchID)))
+	if failedHRESULT(hr) {
+		return false
+	}
+	var params DISPPARAMS
+	hr = object.call(vtblDispatchInvoke, uintptr(dispatchID), uintptr(unsafe.Pointer(&IID_NULL)), LOCALE_USER_DEFAULT,
+		DISPATCH_PROPERTYGET, uintptr(unsafe.Pointer(&params)), uintptr(unsafe.Pointer(result)), 0, 0)
+	return !failedHRESULT(hr)
+}
+
+// dispatchString reads the string property at path, or "" when it cannot
+func dispatchString(object comObject, path ...string) string {
+	value, ok := dispatchProperty(object, path...)
+	if !ok {
+		return ""
+	}
+	if value.VT != VT_BSTR {
+		procVariantClear.Call(uintptr(unsafe.Pointer(&value)))
+		return ""
+	}
+	return bstrToString(value.Val[0])
+}
+
+// dispatchInt reads the whole number property at path, or 0 when it cannot
+func dispatchInt(object comObject, path ...string) int {
+	value, ok := dispatchProperty(object, path...)
+	if !ok {
+		return 0
+	}
+	defer procVariantClear.Call(uintptr(unsafe.Pointer(&value)))
+	if value.VT != VT_I4 {
+		return 0
+	}
+	return int(int32(value.Val[0]))
+}
@@ -1,7 +1,10 @@
-package main
+package recorder
 
 import (
 	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
 	"strings"
 )
 
@@ -163,6 +166,12 @@ func applyAdvancedConfig(baseConfig WorkflowRecorderConfig, advancedConfig Advan
 		baseConfig.ScreenshotJPEGQuality = min(max(advancedConfig.ScreenshotCompressionLevel*10, 10), 90)
 	}
 
+	// Privacy
+	baseConfig.ExcludePasswordFields = advancedConfig.ExcludePasswordFields
+	if advancedConfig.AnonymizeUserData {
+		baseConfig.MaskPII = true
+	}
+
 	// Browser specific timeouts
 	if browserConfig, exists := advancedConfig.BrowserSpecificSettings["chrome"]; exists {
 		baseConfig.BrowserDetectionTimeoutMs = int64(browserConfig.DetectionTimeout)
@@ -195,8 +204,7 @@ func serializeEventAdvanced(event WorkflowEvent, config AdvancedWorkflowConfig)
 
 // Dual serialization for internal vs external use
 func serializeEventDual(event WorkflowEvent, config AdvancedWorkflowConfig) ([]byte, error) {
-	// Create internal representation (full data)
-	internalEvent := event
+	// The internal representation is the event itself (full data)
 
 	// Create external representation (filtered data)
 	externalEvent := event
@@ -301,36 +309,55 @@ func serializeMinimal(event WorkflowEvent) ([]byte, error) {
 	}
 }
 
-// Validate configuration settings
+// Validate configuration settings. Each problem names the setting as
+// config files spell it.
 func validateAdvancedConfig(config AdvancedWorkflowConfig) []string {
 	var errors []string
 
 	// Validate performance profile
 	validProfiles := []string{"speed", "quality", "balanced"}
 	if !contains(validProfiles, config.PerformanceProfile) {
-		errors = append(errors, "Invalid performance profile: "+config.PerformanceProfile)
+		errors = append(errors, fmt.Sprintf("performance_profile must be speed, quality or balanced, not %q", config.PerformanceProfile))
 	}
 
 	// Validate serialization mode
 	validModes := []string{"compact", "readable", "minimal"}
 	if !contains(validModes, config.SerializationMode) {
-		errors = append(errors, "Invalid serialization mode: "+config.SerializationMode)
+		errors = append(errors, fmt.Sprintf("serialization_mode must be compact, readable or minimal, not %q", config.SerializationMode))
 	}
 
 	// Validate validation level
 	validLevels := []string{"basic", "strict", "paranoid"}
 	if !contains(validLevels, config.ValidationLevel) {
-		errors = append(errors, "Invalid validation level: "+config.ValidationLevel)
+		errors = append(errors, fmt.Sprintf("validation_level must be basic, strict or paranoid, not %q", config.ValidationLevel))
+	}
+
+	// Validate report format
+	validFormats := []string{"json", "html", "xml"}
+	if !contains(validFormats, config.TestReportFormat) {
+		errors = append(errors, fmt.Sprintf("test_report_format must be json, html or xml, not %q", config.TestReportFormat))
 	}
 
 	// Validate compression level
 	if config.ScreenshotCompressionLevel < 1 || config.ScreenshotCompressionLevel > 9 {
-		errors = append(errors, "Screenshot compression level must be between 1 and 9")
+		errors = append(errors, fmt.Sprintf("screenshot_compression_level must be between 1 and 9, not %d", config.ScreenshotCompressionLevel))
 	}
 
 	// Validate event buffer size
 	if config.EventBufferSize < 100 || config.EventBufferSize > 10000 {
-		errors = append(errors, "Event buffer size must be between 100 and 10000")
+		errors = append(errors, fmt.Sprintf("event_buffer_size must be between 100 and 10000, not %d", config.EventBufferSize))
+	}
+
+	// Validate browser timeouts
+	browsers := make([]string, 0, len(config.BrowserSpecificSettings))
+	for browser := range config.BrowserSpecificSettings {
+		browsers = append(browsers, browser)
+	}
+	sort.Strings(browsers)
+	for _, browser := range browsers {
+		if timeout := config.BrowserSpecificSettings[browser].DetectionTimeout; timeout < 0 {
+			errors = append(errors, fmt.Sprintf("browser_specific_settings.%s.detection_timeout_ms cannot be negative, not %d", browser, timeout))
+		}
 	}
 
 	return errors
@@ -346,26 +373,32 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-// Load advanced configuration from file
+// Load advanced configuration: the defaults, then the JSON or YAML file
+// (none when filename is ""), then the settings' CLARAVERSE_* environment
+// variables and --options, checked once all are applied
 func loadAdvancedConfig(filename string) (AdvancedWorkflowConfig, error) {
 	config := getDefaultAdvancedConfig()
 
-	// In a real implementation, this would read from a file
-	// For now, return default config
+	if filename != "" {
+		if err := LoadConfigFile(filename, &config); err != nil {
+			return config, err
+		}
+	}
+	if err := applyConfigSettings(&config, os.LookupEnv, commandLineOption); err != nil {
+		return config, err
+	}
+
+	if problems := validateAdvancedConfig(config); len(problems) > 0 {
+		return config, NewWorkflowError(ErrorTypeConfiguration,
+			"Invalid advanced config: "+strings.Join(problems, "; "), nil)
+	}
 	return config, nil
 }
 
-// Save advanced configuration to file
+// Save advanced configuration as JSON, or as YAML when filename ends in
+// .yaml or .yml
 func saveAdvancedConfig(config AdvancedWorkflowConfig, filename string) error {
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	// In a real implementation, this would write to a file
-	// For now, just validate the JSON is correct
-	_ = data
-	return nil
+	return SaveConfigFile(config, filename)
 }
 
 // Get optimized configuration based on system resources
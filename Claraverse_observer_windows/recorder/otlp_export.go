@@ -0,0 +1,338 @@
+package recorder
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OpenTelemetry export. The otlp event sink turns a recording into a trace
+// that Jaeger, Grafana Tempo or any OTLP collector can show next to backend
+// traces: the recording is the root span, each stretch of time spent in one
+// application (from one ApplicationSwitchEvent to the next) is a child span,
+// and clicks, key presses and every other event become span events on the
+// span they happened in, with the event's fields and its UI element as
+// attributes. Screenshot images are left out. A span is exported once it
+// ends, so an application's span shows up when the user switches away, and
+// the rest when recording stops. Spans are POSTed as OTLP/HTTP JSON to
+// <url>/v1/traces in batches.
+
+const (
+	otlpTracesPath       = "/v1/traces"
+	otlpDefaultService   = "ui_recorder"
+	otlpMaxSpanEvents    = 1000 // Beyond this, span events are counted as dropped
+	otlpMaxAttributeSize = 1024
+	otlpSpanKindInternal = 1
+)
+
+// otlpAttribute is an OTLP key and value
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// otlpValue is an OTLP AnyValue; exactly one field is set
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 as a string, as OTLP JSON encodes it
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpSpanEvent is an event on a span
+type otlpSpanEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+// otlpSpan is a span as OTLP JSON encodes it
+type otlpSpan struct {
+	TraceID            string          `json:"traceId"`
+	SpanID             string          `json:"spanId"`
+	ParentSpanID       string          `json:"parentSpanId,omitempty"`
+	Name               string          `json:"name"`
+	Kind               int             `json:"kind"`
+	StartTimeUnixNano  string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano    string          `json:"endTimeUnixNano"`
+	Attributes         []otlpAttribute `json:"attributes,omitempty"`
+	Events             []otlpSpanEvent `json:"events,omitempty"`
+	DroppedEventsCount int             `json:"droppedEventsCount,omitempty"`
+
+	startMs, endMs uint64
+}
+
+// otlpSink exports the events of a recording as spans
+type otlpSink struct {
+	*batchSink
+	Recording   string // The recording the current trace is of
+	TraceID     string
+	Root        *otlpSpan // The recording's span
+	Application *otlpSpan // The application in front, nil before the first switch
+	Exported    int64     // Spans ended and handed to the batch sender
+	Mutex       sync.Mutex
+}
+
+// newOTLPSink exports spans to an OTLP/HTTP endpoint
+func newOTLPSink(config EventSinkConfig) (EventSink, error) {
+	url := strings.TrimSuffix(config.URL, "/")
+	if !strings.HasSuffix(url, otlpTracesPath) {
+		url += otlpTracesPath
+	}
+	service := config.ServiceName
+	if service == "" {
+		service = otlpDefaultService
+	}
+	resource := []otlpAttribute{otlpString("service.name", service)}
+	if host, err := os.Hostname(); err == nil {
+		resource = append(resource, otlpString("host.name", host))
+	}
+
+	client := &http.Client{Timeout: httpSinkTimeout}
+	return &otlpSink{batchSink: newBatchSink(config, func(batch [][]byte) error {
+		body, err := otlpTracesRequest(resource, batch)
+		if err != nil {
+			return err
+		}
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		for name, value := range config.Headers {
+			request.Header.Set(name, value)
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		io.Copy(io.Discard, response.Body)
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			return fmt.Errorf("%s answered %s", url, response.Status)
+		}
+		return nil
+	})}, nil
+}
+
+// otlpTracesRequest wraps encoded spans in an ExportTraceServiceRequest
+func otlpTracesRequest(resource []otlpAttribute, spans [][]byte) ([]byte, error) {
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": resource},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": otlpDefaultService, "version": recorderVersion},
+				"spans": json.RawMessage("[" + string(bytes.Join(spans, []byte(","))) + "]"),
+			}},
+		}},
+	}
+	return json.Marshal(request)
+}
+
+// Write adds the event to the trace, ending the application's span when the
+// user switches to another
+func (s *otlpSink) Write(event *SinkEvent) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	metadata, _ := eventMetadata(event.Event)
+	timestamp := metadata.Timestamp
+	if s.Root == nil || event.Recording != s.Recording {
+		s.endTrace()
+		s.Recording, s.TraceID = event.Recording, otlpID(16)
+		s.Root = s.startSpan(event.Recording, "", timestamp,
+			otlpString("recording.name", event.Recording))
+	}
+
+	if switched, ok := event.Event.(ApplicationSwitchEvent); ok {
+		s.endSpan(s.Application, timestamp)
+		s.Application = s.startSpan(switched.ToApplication, s.Root.SpanID, timestamp,
+			otlpString("app.name", switched.ToApplication),
+			otlpInt("app.process_id", int64(switched.ToProcessID)),
+			otlpString("app.switch_method", string(switched.SwitchMethod)),
+			otlpString("app.previous", switched.FromApplication))
+	}
+
+	span := s.Root
+	if s.Application != nil {
+		span = s.Application
+	}
+	span.endMs = max(span.endMs, timestamp)
+	if len(span.Events) >= otlpMaxSpanEvents {
+		span.DroppedEventsCount++
+		return nil
+	}
+	span.Events = append(span.Events, otlpSpanEvent{
+		TimeUnixNano: otlpNanos(timestamp),
+		Name:         otlpEventName(event.Event),
+		Attributes:   otlpEventAttributes(event.Event, metadata),
+	})
+	return nil
+}
+
+// Close ends the open spans and sends everything still buffered
+func (s *otlpSink) Close() error {
+	s.Mutex.Lock()
+	s.endTrace()
+	s.Mutex.Unlock()
+	return s.batchSink.Close()
+}
+
+// GetStatistics adds the spans exported to the batch counters
+func (s *otlpSink) GetStatistics() map[string]interface{} {
+	stats := s.batchSink.GetStatistics()
+	s.Mutex.Lock()
+	stats["spans"] = s.Exported
+	s.Mutex.Unlock()
+	return stats
+}
+
+// startSpan starts a span of the current trace
+func (s *otlpSink) startSpan(name, parent string, startMs uint64, attributes ...otlpAttribute) *otlpSpan {
+	return &otlpSpan{
+		TraceID:      s.TraceID,
+		SpanID:       otlpID(8),
+		ParentSpanID: parent,
+		Name:         name,
+		Kind:         otlpSpanKindInternal,
+		Attributes:   attributes,
+		startMs:      startMs,
+		endMs:        startMs,
+	}
+}
+
+// endSpan ends a span no earlier than endMs and queues it for export
+func (s *otlpSink) endSpan(span *otlpSpan, endMs uint64) {
+	if span == nil {
+		return
+	}
+	span.StartTimeUnixNano = otlpNanos(span.startMs)
+	span.EndTimeUnixNano = otlpNanos(max(span.endMs, endMs))
+	data, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+	s.enqueue(data)
+	s.Exported++
+}
+
+// endTrace ends the application's span and then the recording's
+func (s *otlpSink) endTrace() {
+	if s.Root == nil {
+		return
+	}
+	if s.Application != nil {
+		s.Root.endMs = max(s.Root.endMs, s.Application.endMs)
+		s.endSpan(s.Application, 0)
+	}
+	s.endSpan(s.Root, 0)
+	s.Root, s.Application = nil, nil
+}
+
+// otlpEventName names the span event for an event: clicks and key presses
+// by what happened, the rest by their type
+func otlpEventName(event WorkflowEvent) string {
+	switch e := event.(type) {
+	case MouseEvent:
+		return "mouse." + strings.ToLower(string(e.EventType))
+	case KeyboardEvent:
+		if e.IsKeyDown {
+			return "key.down"
+		}
+		return "key.up"
+	case ApplicationSwitchEvent:
+		return "app.switch"
+	}
+	return auditEventType(event)
+}
+
+// otlpEventAttributes flattens an event's fields into attributes, with its
+// UI element under "ui."
+func otlpEventAttributes(event WorkflowEvent, metadata EventMetadata) []otlpAttribute {
+	var attributes []otlpAttribute
+	if metadata.Sequence != 0 {
+		attributes = append(attributes, otlpInt("event.seq", int64(metadata.Sequence)))
+	}
+	if element := metadata.UIElement; element != nil {
+		attributes = append(attributes,
+			otlpString("ui.role", element.Role),
+			otlpString("ui.name", element.Name),
+			otlpString("ui.window_title", element.WindowTitle),
+			otlpString("ui.application_name", element.ApplicationName))
+		if element.URL != "" {
+			attributes = append(attributes, otlpString("ui.url", element.URL))
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return attributes
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(data, &fields) != nil {
+		return attributes
+	}
+	delete(fields, "metadata")
+	delete(fields, "image_base64")
+	return otlpFlatten(attributes, "", fields)
+}
+
+// otlpFlatten appends the scalar values in fields as attributes, nesting
+// object keys with dots; arrays are left out
+func otlpFlatten(attributes []otlpAttribute, prefix string, fields map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := prefix + key
+		switch v := fields[key].(type) {
+		case string:
+			attributes = append(attributes, otlpString(name, TruncateString(v, otlpMaxAttributeSize, "…")))
+		case bool:
+			attributes = append(attributes, otlpAttribute{Key: name, Value: otlpValue{BoolValue: &v}})
+		case float64:
+			if v == float64(int64(v)) {
+				attributes = append(attributes, otlpInt(name, int64(v)))
+			} else {
+				attributes = append(attributes, otlpAttribute{Key: name, Value: otlpValue{DoubleValue: &v}})
+			}
+		case map[string]interface{}:
+			attributes = otlpFlatten(attributes, name+".", v)
+		}
+	}
+	return attributes
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpAttribute {
+	encoded := strconv.FormatInt(value, 10)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &encoded}}
+}
+
+// otlpNanos converts a millisecond timestamp to OTLP's nanosecond string
+func otlpNanos(ms uint64) string {
+	return strconv.FormatUint(ms*1e6, 10)
+}
+
+// otlpID returns a random trace (16 bytes) or span (8 bytes) ID in hex
+func otlpID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,283 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Parquet files. The little of the Parquet format the tables command needs:
+// a flat schema of optional BOOLEAN, INT64, DOUBLE and UTF8 string columns,
+// written as one row group of uncompressed PLAIN pages, with the file
+// metadata in the footer in Thrift's compact protocol. pandas, DuckDB,
+// Spark and Arrow all read it; nothing here reads it back.
+
+// parquetType is a Parquet physical type
+type parquetType int32
+
+const (
+	parquetBoolean   parquetType = 0
+	parquetInt64     parquetType = 2
+	parquetDouble    parquetType = 5
+	parquetByteArray parquetType = 6 // Written as UTF8 strings
+)
+
+const (
+	parquetMagic    = "PAR1"
+	parquetPageRows = 16384 // Rows per data page
+
+	parquetPageData           = 0
+	parquetEncodingPlain      = 0
+	parquetEncodingRLE        = 3
+	parquetRepetitionOptional = 1
+	parquetConvertedUTF8      = 0
+	parquetCodecUncompressed  = 0
+)
+
+// Thrift compact protocol field types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetColumn is a column to write: a value per row, nil where the row
+// has none, as bool, int64, float64 or string to match Type
+type parquetColumn struct {
+	Name   string
+	Type   parquetType
+	Values []interface{}
+}
+
+// parquetChunk is where a column's pages were written
+type parquetChunk struct {
+	Offset int64
+	Size   int64
+}
+
+// writeParquet writes columns of equal length as a Parquet file
+func writeParquet(w io.Writer, columns []parquetColumn, createdBy string) error {
+	rows := 0
+	if len(columns) > 0 {
+		rows = len(columns[0].Values)
+	}
+
+	out := bufio.NewWriter(w)
+	out.WriteString(parquetMagic)
+	offset := int64(len(parquetMagic))
+
+	chunks := make([]parquetChunk, len(columns))
+	for i, column := range columns {
+		chunks[i].Offset = offset
+		// An empty column still has a page for data_page_offset to point at
+		for start := 0; start < rows || start == 0; start += parquetPageRows {
+			page := parquetPage(column, start, min(start+parquetPageRows, rows))
+			out.Write(page)
+			offset += int64(len(page))
+			chunks[i].Size += int64(len(page))
+		}
+	}
+
+	footer := parquetFooter(columns, chunks, rows, createdBy)
+	out.Write(footer)
+	binary.Write(out, binary.LittleEndian, uint32(len(footer)))
+	out.WriteString(parquetMagic)
+	return out.Flush()
+}
+
+// parquetPage encodes rows start to end of a column as a data page: its
+// header, the definition levels (1 where there is a value) and the values
+func parquetPage(column parquetColumn, start, end int) []byte {
+	count := end - start
+	defined := make([]byte, (count+7)/8)
+	var values bytes.Buffer
+	var booleans []bool
+	for i, value := range column.Values[start:end] {
+		if value == nil {
+			continue
+		}
+		defined[i/8] |= 1 << (i % 8)
+		switch v := value.(type) {
+		case bool:
+			booleans = append(booleans, v)
+		case int64:
+			binary.Write(&values, binary.LittleEndian, v)
+		case float64:
+			binary.Write(&values, binary.LittleEndian, math.Float64bits(v))
+		case string:
+			binary.Write(&values, binary.LittleEndian, uint32(len(v)))
+			values.WriteString(v)
+		}
+	}
+	if column.Type == parquetBoolean {
+		packed := make([]byte, (len(booleans)+7)/8)
+		for i, v := range booleans {
+			if v {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		values.Write(packed)
+	}
+
+	// The levels are one bit-packed run of the RLE/bit-packed hybrid
+	// encoding, prefixed with their length
+	var levels thriftWriter
+	levels.varint(uint64(len(defined))<<1 | 1)
+	levels.Write(defined)
+
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, uint32(levels.Len()))
+	data.Write(levels.Bytes())
+	data.Write(values.Bytes())
+
+	var header thriftWriter
+	header.begin()
+	header.i32(1, parquetPageData)
+	header.i32(2, int32(data.Len())) // Uncompressed size
+	header.i32(3, int32(data.Len())) // Compressed size
+	header.structField(5)            // DataPageHeader
+	header.i32(1, int32(count))
+	header.i32(2, parquetEncodingPlain)
+	header.i32(3, parquetEncodingRLE) // Definition levels
+	header.i32(4, parquetEncodingRLE) // Repetition levels
+	header.end()
+	header.end()
+
+	return append(header.Bytes(), data.Bytes()...)
+}
+
+// parquetFooter encodes the FileMetaData: the schema and the one row group
+func parquetFooter(columns []parquetColumn, chunks []parquetChunk, rows int, createdBy string) []byte {
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1) // Format version
+
+	t.list(2, thriftStruct, len(columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(columns)))
+	t.end()
+	for _, column := range columns {
+		t.begin()
+		t.i32(1, int32(column.Type))
+		t.i32(3, parquetRepetitionOptional)
+		t.binary(4, column.Name)
+		if column.Type == parquetByteArray {
+			t.i32(6, parquetConvertedUTF8)
+		}
+		t.end()
+	}
+	t.i64(3, int64(rows))
+
+	var total int64
+	t.list(4, thriftStruct, 1)
+	t.begin()
+	t.list(1, thriftStruct, len(columns))
+	for i, column := range columns {
+		t.begin()
+		t.i64(2, chunks[i].Offset)
+		t.structField(3) // ColumnMetaData
+		t.i32(1, int32(column.Type))
+		t.list(2, thriftI32, 2)
+		t.varint(zigzag(parquetEncodingPlain))
+		t.varint(zigzag(parquetEncodingRLE))
+		t.list(3, thriftBinary, 1)
+		t.varint(uint64(len(column.Name)))
+		t.WriteString(column.Name)
+		t.i32(4, parquetCodecUncompressed)
+		t.i64(5, int64(rows))
+		t.i64(6, chunks[i].Size)
+		t.i64(7, chunks[i].Size)
+		t.i64(9, chunks[i].Offset)
+		t.end()
+		t.end()
+		total += chunks[i].Size
+	}
+	t.i64(2, total)
+	t.i64(3, int64(rows))
+	t.end()
+
+	t.binary(6, createdBy)
+	t.end()
+	return t.Bytes()
+}
+
+// thriftWriter encodes Thrift structs in the compact protocol
+type thriftWriter struct {
+	bytes.Buffer
+	fields []int16 // Last field ID written in each open struct, innermost last
+}
+
+// begin opens a struct, as a list element or after structField
+func (t *thriftWriter) begin() {
+	t.fields = append(t.fields, 0)
+}
+
+// end closes the innermost struct
+func (t *thriftWriter) end() {
+	t.WriteByte(0)
+	t.fields = t.fields[:len(t.fields)-1]
+}
+
+// field writes a field header, as a delta from the last field when it can
+func (t *thriftWriter) field(id int16, kind byte) {
+	last := &t.fields[len(t.fields)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.WriteByte(kind)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(v)))
+	t.WriteString(v)
+}
+
+// list writes the header of a list of size elements of kind, which follow
+func (t *thriftWriter) list(id int16, kind byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size)<<4 | kind)
+	} else {
+		t.WriteByte(0xf0 | kind)
+		t.varint(uint64(size))
+	}
+}
+
+// structField opens a struct as field id
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// varint writes v in base 128, low bits first
+func (t *thriftWriter) varint(v uint64) {
+	for v >= 0x80 {
+		t.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	t.WriteByte(byte(v))
+}
+
+// zigzag maps signed integers to unsigned so small magnitudes stay short
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
@@ -0,0 +1,39 @@
+package recorder
+
+// Password field redaction. With ExcludePasswordFields set, UI Automation's
+// IsPassword property of the focused control decides whether typed
+// characters, text input completions and clipboard contents are recorded.
+// Redacted events keep their type and timing but carry no content.
+
+// isFocusedPasswordField reports whether the focused control is a password
+// field. Controls that cannot be asked are treated as ordinary fields.
+func isFocusedPasswordField() bool {
+	isPassword, err := getUIAFocusedIsPassword()
+	return err == nil && isPassword
+}
+
+// redactKeyboardEvent hides which character key was pressed
+func redactKeyboardEvent(event KeyboardEvent) KeyboardEvent {
+	event.KeyCode = 0
+	event.Character = nil
+	event.Redacted = true
+	return event
+}
+
+// redactTextInput hides the text of a completed input
+func redactTextInput(event TextInputCompletedEvent) TextInputCompletedEvent {
+	event.TextValue = ""
+	event.InitialValue = ""
+	event.Diff = nil
+	event.Redacted = true
+	return event
+}
+
+// redactClipboard hides clipboard contents, including their length
+func redactClipboard(event ClipboardEvent) ClipboardEvent {
+	event.Content = ""
+	event.ContentSize = 0
+	event.Truncated = false
+	event.Redacted = true
+	return event
+}
@@ -0,0 +1,140 @@
+package recorder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pausing a recording to keep sensitive moments out of it. The pause hotkey
+// (Ctrl+Alt+R by default) toggles capture from anywhere without restarting
+// the recorder. Because nothing is captured while paused, the hotkey is
+// polled directly rather than through the hotkey tracker. However a
+// recording is paused, the timeline is marked where capture stopped and
+// started again.
+
+// RecordingMarkerType is a change of capture within a recording
+type RecordingMarkerType string
+
+const (
+	RecordingPaused  RecordingMarkerType = "RecordingPaused"
+	RecordingResumed RecordingMarkerType = "RecordingResumed"
+)
+
+// RecordingMarkerEvent marks where capture was paused or resumed
+type RecordingMarkerEvent struct {
+	RecordingMarker RecordingMarkerType `json:"recording_marker"`
+	Metadata        EventMetadata       `json:"metadata"`
+}
+
+// PauseHotkey detects presses of the pause hotkey
+type PauseHotkey struct {
+	Combination string
+	Keys        []uint32
+	held        bool
+}
+
+// NewPauseHotkey parses a combination such as "Ctrl+Alt+R", or returns nil
+// when combination is empty
+func NewPauseHotkey(combination string) (*PauseHotkey, error) {
+	if combination == "" {
+		return nil, nil
+	}
+
+	keys, err := parseKeyCombination(combination)
+	if err != nil {
+		return nil, err
+	}
+	return &PauseHotkey{Combination: combination, Keys: keys}, nil
+}
+
+// Pressed reports whether all of the hotkey's keys have just gone down,
+// given which keys are down now. Holding them only counts once.
+func (h *PauseHotkey) Pressed(isDown func(uint32) bool) bool {
+	all := true
+	for _, key := range h.Keys {
+		if !isDown(key) {
+			all = false
+			break
+		}
+	}
+
+	pressed := all && !h.held
+	h.held = all
+	return pressed
+}
+
+// togglePause pauses a capturing recording or resumes a paused one
+func togglePause(state *RecorderStateMachine) {
+	switch {
+	case state.IsCapturing():
+		state.Transition(RecorderStatePaused)
+	case state.Is(RecorderStatePaused):
+		state.Transition(RecorderStateRecording)
+	}
+}
+
+// markCaptureChange marks the timeline where capture was paused or resumed.
+// On pause it first finishes text input in progress, so text typed before
+// the pause is never joined to text typed after it. Called by the capture
+// loop, which owns the trackers.
+func (r *Recorder) markCaptureChange(workflow *RecordedWorkflow, state *RecorderStateMachine, capturing bool) {
+	var events []WorkflowEvent
+	marker := RecordingResumed
+	if !capturing {
+		r.processTrackerEvents(workflow, &events, r.Trackers.Flush())
+		marker = RecordingPaused
+	}
+	events = append(events, RecordingMarkerEvent{
+		RecordingMarker: marker,
+		Metadata:        EventMetadata{Timestamp: uint64(state.GetEnteredAt().UnixMilli())},
+	})
+	r.appendWorkflowEvents(workflow, events)
+
+	if capturing {
+		printConsole(Msg(MsgRecordingResumed))
+	} else {
+		printConsole(Msg(MsgRecordingPaused))
+	}
+}
+
+// parseKeyCombination turns a combination such as "Ctrl+Shift+F9" into
+// virtual-key codes. Combinations need a modifier and at least one other key
+// so that ordinary typing never matches them.
+func parseKeyCombination(combination string) ([]uint32, error) {
+	keys, modifiers, err := parseKeyNames(combination)
+	if err != nil {
+		return nil, err
+	}
+	if modifiers == 0 || modifiers == len(keys) {
+		return nil, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Hotkey %q needs a modifier (Ctrl, Alt, Shift or Win) and another key", combination), nil)
+	}
+	return keys, nil
+}
+
+// parseKeyNames turns the key names of a combination into virtual-key codes
+// and counts the modifiers among them
+func parseKeyNames(combination string) ([]uint32, int, error) {
+	codes := make(map[string]uint32)
+	for code, name := range keyNames {
+		if existing, ok := codes[strings.ToLower(name)]; !ok || code < existing {
+			codes[strings.ToLower(name)] = code
+		}
+	}
+
+	var keys []uint32
+	modifiers := 0
+	for _, name := range strings.Split(combination, "+") {
+		code, ok := codes[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, 0, NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Unknown key %q in hotkey %q", name, combination), nil)
+		}
+		switch code {
+		case VK_CONTROL, VK_MENU, VK_SHIFT, VK_LWIN:
+			modifiers++
+		}
+		keys = append(keys, code)
+	}
+	return keys, modifiers, nil
+}
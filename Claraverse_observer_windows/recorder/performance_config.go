@@ -1,26 +1,10 @@
-package main
+package recorder
 
 import (
 	"fmt"
 	"time"
 )
 
-// Note: PerformanceMode is already defined in main_enhanced.go
-
-// String returns the string representation of PerformanceMode
-func (pm PerformanceMode) String() string {
-	switch pm {
-	case Normal:
-		return "Normal"
-	case Balanced:
-		return "Balanced"
-	case LowEnergy:
-		return "LowEnergy"
-	default:
-		return "Unknown"
-	}
-}
-
 // PerformanceSettings contains computed performance settings based on mode
 type PerformanceSettings struct {
 	EventProcessingDelayMs   uint64
@@ -200,11 +184,8 @@ func (c *EnhancedWorkflowRecorderConfig) GetEventDelay() time.Duration {
 func (c *EnhancedWorkflowRecorderConfig) CreateRateLimiter() *RateLimiter {
 	settings := c.GetEffectiveSettings()
 
-	if settings.MaxEventsPerSecond != nil {
-		return NewRateLimiter(*settings.MaxEventsPerSecond, time.Second)
-	}
-
-	return nil // No rate limiting
+	// nil when neither is set: no rate limiting
+	return NewConfigRateLimiter(settings.MaxEventsPerSecond, c.EventRateLimits)
 }
 
 // ValidateEnhancedConfig validates an enhanced configuration
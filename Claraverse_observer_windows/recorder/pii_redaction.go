@@ -0,0 +1,378 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PII masking. With MaskPII set, emails, payment card numbers, social
+// security numbers, phone numbers and any custom patterns are replaced by a
+// placeholder such as [EMAIL] in clipboard contents, completed text input
+// and OCR text before they are recorded. Individual keystrokes are not
+// masked; ExcludePasswordFields and RecordKeyboard cover those. The number
+// of matches masked per detector is saved with the recording.
+
+// Built-in PII entities
+const (
+	PIIEmail      = "email"
+	PIICreditCard = "credit_card"
+	PIISSN        = "ssn"
+	PIIPhone      = "phone"
+)
+
+// PIIDetector finds one kind of PII. Valid, when set, rejects regex matches
+// that are not really PII, such as numbers failing the card checksum.
+type PIIDetector struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Valid       func(match string) bool
+	Placeholder string
+}
+
+// builtinPIIDetectors are the built-in entities in the order they are
+// applied, so a card number is not masked as a phone number
+var builtinPIIDetectors = []PIIDetector{
+	{
+		Name:    PIIEmail,
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	{
+		Name:    PIICreditCard,
+		Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Valid:   luhnValid,
+	},
+	{
+		Name:    PIISSN,
+		Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		Valid:   ssnValid,
+	},
+	{
+		Name:    PIIPhone,
+		Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]?\d{3}[ .-]\d{4}\b`),
+	},
+}
+
+// PIIRedactor masks PII in recorded text and counts what it masked
+type PIIRedactor struct {
+	Detectors []PIIDetector
+	Counts    map[string]int
+	Mutex     sync.Mutex
+}
+
+// NewPIIRedactor creates a redactor with the detectors config enables, or
+// returns nil when PII masking is off
+func NewPIIRedactor(config WorkflowRecorderConfig) (*PIIRedactor, error) {
+	if !config.MaskPII {
+		return nil, nil
+	}
+
+	detectors, err := piiDetectors(config)
+	if err != nil {
+		return nil, err
+	}
+	return &PIIRedactor{
+		Detectors: detectors,
+		Counts:    make(map[string]int),
+	}, nil
+}
+
+// piiDetectors returns the built-in entities named by config, all of them if
+// none are named, followed by its custom patterns
+func piiDetectors(config WorkflowRecorderConfig) ([]PIIDetector, error) {
+	var detectors []PIIDetector
+	for _, detector := range builtinPIIDetectors {
+		if len(config.PIIEntities) == 0 || containsFold(config.PIIEntities, detector.Name) {
+			detector.Placeholder = piiPlaceholder(detector.Name)
+			detectors = append(detectors, detector)
+		}
+	}
+
+	for _, entity := range config.PIIEntities {
+		known := false
+		for _, detector := range builtinPIIDetectors {
+			known = known || strings.EqualFold(entity, detector.Name)
+		}
+		if !known {
+			return nil, NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Unknown PII entity %q", entity), nil)
+		}
+	}
+
+	for _, custom := range config.PIIPatterns {
+		if custom.Name == "" {
+			return nil, NewWorkflowError(ErrorTypeConfiguration, "PII pattern has no name", nil)
+		}
+		pattern, err := regexp.Compile(custom.Pattern)
+		if err != nil {
+			return nil, NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Invalid PII pattern %q", custom.Name), err)
+		}
+		detectors = append(detectors, PIIDetector{
+			Name:        custom.Name,
+			Pattern:     pattern,
+			Placeholder: piiPlaceholder(custom.Name),
+		})
+	}
+
+	return detectors, nil
+}
+
+// LoadPIIPatterns reads a JSON array of custom PII patterns
+func LoadPIIPatterns(filename string) ([]PIIPattern, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, NewWorkflowError(ErrorTypeFileIO, "Failed to read PII patterns file", err)
+	}
+
+	var patterns []PIIPattern
+	if err := json.Unmarshal(data, &patterns); err != nil {
+		return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to parse PII patterns file", err)
+	}
+	return patterns, nil
+}
+
+// piiMatch is a span of text matched by a detector
+type piiMatch struct {
+	Start    int
+	End      int
+	Detector *PIIDetector
+}
+
+// Mask replaces the PII in text with placeholders
+func (r *PIIRedactor) Mask(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+	return r.maskMatches(text, r.findPII(text))
+}
+
+// findPII returns the PII matches in text in order. Where matches overlap
+// the earlier detector wins.
+func (r *PIIRedactor) findPII(text string) []piiMatch {
+	var matches []piiMatch
+	for i := range r.Detectors {
+		detector := &r.Detectors[i]
+		for _, span := range detector.Pattern.FindAllStringIndex(text, -1) {
+			start, end := span[0], span[1]
+			if start == end || (detector.Valid != nil && !detector.Valid(text[start:end])) {
+				continue
+			}
+			overlaps := false
+			for _, match := range matches {
+				overlaps = overlaps || (start < match.End && match.Start < end)
+			}
+			if !overlaps {
+				matches = append(matches, piiMatch{Start: start, End: end, Detector: detector})
+			}
+		}
+	}
+
+	sort.Slice(matches, func(a, b int) bool { return matches[a].Start < matches[b].Start })
+	return matches
+}
+
+// maskMatches replaces matches in text with their placeholders and counts
+// them
+func (r *PIIRedactor) maskMatches(text string, matches []piiMatch) string {
+	if len(matches) == 0 {
+		return text
+	}
+
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+
+	var masked strings.Builder
+	last := 0
+	for _, match := range matches {
+		masked.WriteString(text[last:match.Start])
+		masked.WriteString(match.Detector.Placeholder)
+		last = match.End
+		r.Counts[match.Detector.Name]++
+	}
+	masked.WriteString(text[last:])
+	return masked.String()
+}
+
+// RedactEvent masks the PII in the text an event carries
+func (r *PIIRedactor) RedactEvent(event WorkflowEvent) WorkflowEvent {
+	if r == nil {
+		return event
+	}
+
+	switch e := event.(type) {
+	case ClipboardEvent:
+		e.Content = r.Mask(e.Content)
+		if !e.Truncated {
+			e.ContentSize = len(e.Content)
+		}
+		return e
+	case TextInputCompletedEvent:
+		e.TextValue = r.Mask(e.TextValue)
+		e.InitialValue = r.Mask(e.InitialValue)
+		if e.Diff != nil {
+			e.Diff = diffTextValues(e.InitialValue, e.TextValue)
+		}
+		return e
+	case CommandEnteredEvent:
+		e.Command = r.Mask(e.Command)
+		return e
+	case BookmarkEvent:
+		e.Bookmark = r.Mask(e.Bookmark)
+		e.Reference = r.Mask(e.Reference)
+		return e
+	case MouseEvent:
+		if e.ElementSelector != nil {
+			selector := *e.ElementSelector
+			selector.Name = r.Mask(selector.Name)
+			selector.WindowTitle = r.Mask(selector.WindowTitle)
+			e.ElementSelector = &selector
+		}
+		return e
+	case FileActivityEvent:
+		e.Path = r.Mask(e.Path)
+		e.PreviousPath = r.Mask(e.PreviousPath)
+		return e
+	case ProcessEvent:
+		e.ExecutablePath = r.Mask(e.ExecutablePath)
+		return e
+	case MenuItemSelectedEvent:
+		e.WindowTitle = r.Mask(e.WindowTitle)
+		return e
+	case DialogEvent:
+		e.DialogTitle = r.Mask(e.DialogTitle)
+		e.Message = r.Mask(e.Message)
+		return e
+	case FileDialogEvent:
+		e.FileDialog = r.Mask(e.FileDialog)
+		e.Folder = r.Mask(e.Folder)
+		paths := make([]string, len(e.Paths))
+		for i, path := range e.Paths {
+			paths[i] = r.Mask(path)
+		}
+		e.Paths = paths
+		return e
+	case FocusChangedEvent:
+		e.FocusName = r.Mask(e.FocusName)
+		e.WindowTitle = r.Mask(e.WindowTitle)
+		return e
+	case WindowTitleChangedEvent:
+		e.WindowTitle = r.Mask(e.WindowTitle)
+		e.PreviousTitle = r.Mask(e.PreviousTitle)
+		return e
+	default:
+		return event
+	}
+}
+
+// MaskOCR masks the PII in recognized text. A word is masked when any part
+// of it is, so matches spanning words, like a spaced card number, are
+// hidden from the word list too.
+func (r *PIIRedactor) MaskOCR(result *OCRResult) {
+	if r == nil || result == nil || result.Text == "" {
+		return
+	}
+
+	lines := strings.Split(result.Text, "\n")
+	lineWords := make(map[int][]int)
+	for i, word := range result.Words {
+		lineWords[word.Line] = append(lineWords[word.Line], i)
+	}
+
+	for line, text := range lines {
+		matches := r.findPII(text)
+		if len(matches) == 0 {
+			continue
+		}
+		lines[line] = r.maskMatches(text, matches)
+
+		// The line is its words joined by single spaces
+		start := 0
+		for _, i := range lineWords[line] {
+			end := start + len(result.Words[i].Text)
+			for _, match := range matches {
+				if match.Start < end && start < match.End {
+					result.Words[i].Text = match.Detector.Placeholder
+					break
+				}
+			}
+			start = end + 1
+		}
+	}
+	result.Text = strings.Join(lines, "\n")
+}
+
+// GetStatistics returns the number of matches masked per detector
+func (r *PIIRedactor) GetStatistics() map[string]int {
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+
+	counts := make(map[string]int, len(r.Counts))
+	for name, count := range r.Counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// describePIICounts formats redaction counts as "email 2, phone 1"
+func describePIICounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// piiPlaceholder returns the text masking a detector's matches
+func piiPlaceholder(name string) string {
+	return "[" + strings.ToUpper(name) + "]"
+}
+
+// luhnValid reports whether the digits of a card number pass the Luhn
+// checksum
+func luhnValid(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if digits%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// ssnValid rejects numbers the SSA never issues: area 000, 666 or 900-999,
+// group 00 and serial 0000
+func ssnValid(ssn string) bool {
+	area, group, serial := ssn[0:3], ssn[4:6], ssn[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Application launches and exits. With RecordProcesses set, the processes of
+// the user's session are listed from a toolhelp snapshot every
+// processPollInterval, and an application starting or ending is recorded as
+// a ProcessEvent with its executable and the process that launched it, so a
+// recording shows "Launched excel.exe from explorer.exe" where an
+// ApplicationSwitchEvent only shows focus moving. Services, the recorder
+// itself, ignored applications and the helper processes an application
+// starts from its own executable, such as a browser's renderers, are left
+// out. Processes are seen at most processPollInterval after they start or
+// end, and one that lives for less than that may be missed.
+
+var procProcessIdToSessionId = kernel32.NewProc("ProcessIdToSessionId")
+
+const processPollInterval = time.Second
+
+// Process changes
+const (
+	ApplicationLaunched = "launched"
+	ApplicationExited   = "exited"
+)
+
+// ProcessEvent records an application being launched or exiting
+type ProcessEvent struct {
+	Process           string        `json:"process"` // launched or exited
+	Application       string        `json:"application"`
+	ExecutablePath    string        `json:"executable_path,omitempty"`
+	ProcessID         uint32        `json:"process_id"`
+	ParentProcessID   uint32        `json:"parent_process_id"`
+	ParentApplication string        `json:"parent_application,omitempty"`
+	RanMs             uint64        `json:"ran_ms,omitempty"` // How long it ran, for applications launched while recording
+	Metadata          EventMetadata `json:"metadata"`
+}
+
+// processEntry is a process in a snapshot
+type processEntry struct {
+	ParentID   uint32
+	Executable string // e.g. "notepad.exe"
+}
+
+// trackedProcess is an application process whose exit will be recorded
+type trackedProcess struct {
+	Entry    processEntry
+	Path     string
+	Launched time.Time // Zero for processes running when recording started
+}
+
+// ProcessWatcher follows the processes of the user's session
+type ProcessWatcher struct {
+	Config    WorkflowRecorderConfig
+	Processes map[uint32]processEntry   // Every process in the last snapshot
+	Tracked   map[uint32]trackedProcess // Application processes, by PID
+	Pending   []ProcessEvent
+	Own       uint32                          // The recorder's process
+	Session   uint32                          // The user's session
+	SessionOf func(pid uint32) (uint32, bool) // Session a process runs in
+	Path      func(pid uint32) string         // Path of a process's executable
+	Snapshot  func() (map[uint32]processEntry, error)
+	stop      chan struct{}
+	Mutex     sync.Mutex
+}
+
+// NewProcessWatcher takes a first snapshot and starts polling, or returns
+// nil when RecordProcesses is off or processes cannot be listed
+func NewProcessWatcher(config WorkflowRecorderConfig) *ProcessWatcher {
+	if !config.RecordProcesses {
+		return nil
+	}
+	watcher := newProcessWatcher(config)
+	processes, err := watcher.Snapshot()
+	if err != nil {
+		printConsoleWarning(Msg(MsgProcessesUnavailable, err))
+		return nil
+	}
+	watcher.Update(processes, time.Now())
+	watcher.stop = make(chan struct{})
+	go watcher.poll(watcher.stop)
+	return watcher
+}
+
+// newProcessWatcher creates a watcher that has seen no processes yet
+func newProcessWatcher(config WorkflowRecorderConfig) *ProcessWatcher {
+	own := uint32(os.Getpid())
+	session, _ := processSession(own)
+	return &ProcessWatcher{
+		Config:    config,
+		Tracked:   make(map[uint32]trackedProcess),
+		Own:       own,
+		Session:   session,
+		SessionOf: processSession,
+		Path:      processImagePath,
+		Snapshot:  snapshotProcesses,
+	}
+}
+
+// poll takes a snapshot every processPollInterval until stop is closed
+func (w *ProcessWatcher) poll(stop chan struct{}) {
+	ticker := time.NewTicker(processPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if processes, err := w.Snapshot(); err == nil {
+				w.Update(processes, now)
+			}
+		}
+	}
+}
+
+// Update compares a snapshot taken now with the last one. The first
+// snapshot only notes the applications already running.
+func (w *ProcessWatcher) Update(processes map[uint32]processEntry, now time.Time) {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	first := w.Processes == nil
+	previous := w.Processes
+	w.Processes = processes
+
+	// A PID running another executable was reused after its process ended
+	for pid, tracked := range w.Tracked {
+		if entry, running := processes[pid]; running && entry == tracked.Entry {
+			continue
+		}
+		delete(w.Tracked, pid)
+		event := ProcessEvent{
+			Process:         ApplicationExited,
+			Application:     tracked.Entry.Executable,
+			ExecutablePath:  tracked.Path,
+			ProcessID:       pid,
+			ParentProcessID: tracked.Entry.ParentID,
+			Metadata:        EventMetadata{Timestamp: uint64(now.UnixMilli())},
+		}
+		if !tracked.Launched.IsZero() {
+			event.RanMs = uint64(now.Sub(tracked.Launched).Milliseconds())
+		}
+		w.Pending = append(w.Pending, event)
+	}
+
+	for pid, entry := range processes {
+		if seen, known := previous[pid]; known && seen == entry {
+			continue
+		}
+		if !w.isApplication(pid, entry, processes) {
+			continue
+		}
+		tracked := trackedProcess{Entry: entry, Path: w.Path(pid)}
+		if first {
+			w.Tracked[pid] = tracked
+			continue
+		}
+		tracked.Launched = now
+		w.Tracked[pid] = tracked
+		w.Pending = append(w.Pending, ProcessEvent{
+			Process:           ApplicationLaunched,
+			Application:       entry.Executable,
+			ExecutablePath:    tracked.Path,
+			ProcessID:         pid,
+			ParentProcessID:   entry.ParentID,
+			ParentApplication: processes[entry.ParentID].Executable,
+			Metadata:          EventMetadata{Timestamp: uint64(now.UnixMilli())},
+		})
+	}
+}
+
+// isApplication reports whether a process is one whose launch and exit are
+// recorded
+func (w *ProcessWatcher) isApplication(pid uint32, entry processEntry, processes map[uint32]processEntry) bool {
+	if pid == 0 || pid == w.Own || entry.Executable == "" {
+		return false
+	}
+	if parent, ok := processes[entry.ParentID]; ok && parent.Executable == entry.Executable {
+		return false
+	}
+	if ignoredByConfig(w.Config, entry.Executable, "") {
+		return false
+	}
+	session, ok := w.SessionOf(pid)
+	return ok && session == w.Session
+}
+
+// Drain returns the launches and exits since the last call, in order
+func (w *ProcessWatcher) Drain() []WorkflowEvent {
+	if w == nil {
+		return nil
+	}
+	w.Mutex.Lock()
+	pending := w.Pending
+	w.Pending = nil
+	w.Mutex.Unlock()
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].Metadata.Timestamp != pending[j].Metadata.Timestamp {
+			return pending[i].Metadata.Timestamp < pending[j].Metadata.Timestamp
+		}
+		return pending[i].ProcessID < pending[j].ProcessID
+	})
+	events := make([]WorkflowEvent, len(pending))
+	for i, event := range pending {
+		events[i] = event
+	}
+	return events
+}
+
+// Close stops polling
+func (w *ProcessWatcher) Close() {
+	if w == nil || w.stop == nil {
+		return
+	}
+	close(w.stop)
+	w.stop = nil
+}
+
+// snapshotProcesses lists the running processes
+func snapshotProcesses() (map[uint32]processEntry, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	processes := make(map[uint32]processEntry)
+	entry := syscall.ProcessEntry32{Size: uint32(unsafe.Sizeof(syscall.ProcessEntry32{}))}
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		processes[entry.ProcessID] = processEntry{
+			ParentID:   entry.ParentProcessID,
+			Executable: syscall.UTF16ToString(entry.ExeFile[:]),
+		}
+	}
+	if len(processes) == 0 {
+		return nil, err
+	}
+	return processes, nil
+}
+
+// processSession returns the session a process runs in
+func processSession(pid uint32) (uint32, bool) {
+	var session uint32
+	ret, _, _ := procProcessIdToSessionId.Call(uintptr(pid), uintptr(unsafe.Pointer(&session)))
+	return session, ret != 0
+}
+
+// describeProcess describes a launch or exit in a recording's steps
+func describeProcess(process, application, parent string, ranMs uint64) string {
+	if process == ApplicationExited {
+		if ranMs > 0 {
+			return fmt.Sprintf("Closed %s after %s", application, FormatDuration(time.Duration(ranMs)*time.Millisecond))
+		}
+		return "Closed " + application
+	}
+	if parent != "" {
+		return fmt.Sprintf("Launched %s from %s", application, parent)
+	}
+	return "Launched " + application
+}
@@ -0,0 +1,186 @@
+package recorder
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Recording quotas. A quota caps how much is captured from the applications
+// it matches in an hour or a day, e.g. at most 100 screenshots of Outlook a
+// day. Once a quota is used up, further screenshots or content events
+// (clipboard, completed text input and text selections) from that
+// application are dropped until the period ends, and a marker shows in the
+// timeline where capture stopped. Usage is counted for the life of the
+// recorder process, across recordings.
+
+// QuotaExceededEvent marks where a quota stopped capture from an application
+type QuotaExceededEvent struct {
+	QuotaExceeded string        `json:"quota_exceeded"` // Name of the quota
+	QuotaKind     string        `json:"quota_kind"`     // screenshots or content
+	QuotaLimit    int           `json:"quota_limit"`
+	QuotaPeriod   string        `json:"quota_period"`
+	ResumesAt     uint64        `json:"resumes_at"` // When the period ends, in ms
+	Metadata      EventMetadata `json:"metadata"`
+}
+
+// QuotaEnforcer counts capture against the configured quotas
+type QuotaEnforcer struct {
+	Quotas       []RecordingQuota
+	Usage        map[quotaKey]*quotaUsage
+	DroppedCount int64
+	Mutex        sync.Mutex
+}
+
+// quotaKey identifies what one quota has counted for one application
+type quotaKey struct {
+	Quota       int
+	Application string
+	Kind        string
+}
+
+// quotaUsage is the count for the current period
+type quotaUsage struct {
+	PeriodStart time.Time
+	Count       int
+	Exceeded    bool
+}
+
+// NewQuotaEnforcer returns an enforcer for the config's quotas, or nil when
+// there are none
+func NewQuotaEnforcer(config WorkflowRecorderConfig) *QuotaEnforcer {
+	if len(config.RecordingQuotas) == 0 {
+		return nil
+	}
+	return &QuotaEnforcer{
+		Quotas: config.RecordingQuotas,
+		Usage:  make(map[quotaKey]*quotaUsage),
+	}
+}
+
+// validateRecordingQuotas checks every quota is named, matches something and
+// limits something over a known period
+func validateRecordingQuotas(quotas []RecordingQuota) error {
+	for i, quota := range quotas {
+		if quota.Name == "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Recording quota %d has no name", i+1), nil)
+		}
+		if len(quota.Applications) == 0 && len(quota.WindowTitles) == 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Recording quota %q matches no applications or window titles", quota.Name), nil)
+		}
+		if quota.Period != QuotaPeriodHour && quota.Period != QuotaPeriodDay {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Recording quota %q period must be %s or %s, not %q",
+					quota.Name, QuotaPeriodHour, QuotaPeriodDay, quota.Period), nil)
+		}
+		if quota.MaxScreenshots < 0 || quota.MaxContent < 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Recording quota %q limits cannot be negative", quota.Name), nil)
+		}
+		if quota.MaxScreenshots == 0 && quota.MaxContent == 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Recording quota %q sets neither max_screenshots nor max_content", quota.Name), nil)
+		}
+	}
+	return nil
+}
+
+// quotaKind returns the kind of capture an event counts against, or "" for
+// events quotas do not limit
+func quotaKind(event WorkflowEvent) string {
+	switch event.(type) {
+	case ScreenshotEvent:
+		return QuotaScreenshots
+	case ClipboardEvent, TextInputCompletedEvent, TextSelectionEvent, CommandEnteredEvent:
+		return QuotaContent
+	default:
+		return ""
+	}
+}
+
+// Admit reports whether an event may be recorded at now. The first event a
+// quota refuses in a period also returns the marker to record in its place.
+func (q *QuotaEnforcer) Admit(event WorkflowEvent, now time.Time) (bool, *QuotaExceededEvent) {
+	kind := quotaKind(event)
+	if kind == "" {
+		return true, nil
+	}
+	metadata, ok := eventMetadata(event)
+	if !ok || metadata.UIElement == nil {
+		return true, nil
+	}
+	application := metadata.UIElement.ApplicationName
+
+	q.Mutex.Lock()
+	defer q.Mutex.Unlock()
+
+	for i := range q.Quotas {
+		quota := &q.Quotas[i]
+		match := ApplicationProfile{Applications: quota.Applications, WindowTitles: quota.WindowTitles}
+		limit := quota.Limit(kind)
+		if limit <= 0 || !match.Matches(application, metadata.UIElement.WindowTitle) {
+			continue
+		}
+
+		start, end := quota.PeriodBounds(now)
+		key := quotaKey{Quota: i, Application: application, Kind: kind}
+		usage := q.Usage[key]
+		if usage == nil || !usage.PeriodStart.Equal(start) {
+			usage = &quotaUsage{PeriodStart: start}
+			q.Usage[key] = usage
+		}
+
+		if usage.Count < limit {
+			usage.Count++
+			return true, nil
+		}
+
+		q.DroppedCount++
+		if usage.Exceeded {
+			return false, nil
+		}
+		usage.Exceeded = true
+		return false, &QuotaExceededEvent{
+			QuotaExceeded: quota.Name,
+			QuotaKind:     kind,
+			QuotaLimit:    limit,
+			QuotaPeriod:   quota.Period,
+			ResumesAt:     uint64(end.UnixMilli()),
+			Metadata:      metadata,
+		}
+	}
+	return true, nil
+}
+
+// GetStatistics returns how many events quotas dropped and which quotas are
+// used up for the current period
+func (q *QuotaEnforcer) GetStatistics() map[string]interface{} {
+	q.Mutex.Lock()
+	defer q.Mutex.Unlock()
+
+	now := time.Now()
+	exceeded := []map[string]interface{}{}
+	for key, usage := range q.Usage {
+		quota := &q.Quotas[key.Quota]
+		if start, _ := quota.PeriodBounds(now); !usage.Exceeded || !usage.PeriodStart.Equal(start) {
+			continue
+		}
+		exceeded = append(exceeded, map[string]interface{}{
+			"quota":       quota.Name,
+			"application": key.Application,
+			"kind":        key.Kind,
+		})
+	}
+	sort.Slice(exceeded, func(i, j int) bool {
+		return fmt.Sprint(exceeded[i]["quota"], exceeded[i]["application"], exceeded[i]["kind"]) <
+			fmt.Sprint(exceeded[j]["quota"], exceeded[j]["application"], exceeded[j]["kind"])
+	})
+
+	return map[string]interface{}{
+		"dropped_count": q.DroppedCount,
+		"exceeded":      exceeded,
+	}
+}
@@ -0,0 +1,107 @@
+package recorder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RecorderState is a stage of the recording lifecycle
+type RecorderState string
+
+const (
+	RecorderStateIdle      RecorderState = "Idle"
+	RecorderStateStarting  RecorderState = "Starting"
+	RecorderStateRecording RecorderState = "Recording"
+	RecorderStatePaused    RecorderState = "Paused"
+	RecorderStateStopping  RecorderState = "Stopping"
+	RecorderStateFinalized RecorderState = "Finalized"
+)
+
+// recorderTransitions lists the states reachable from each state. Starting may
+// fall back to Idle when a start fails, and a finalized recorder may start a
+// new recording.
+var recorderTransitions = map[RecorderState][]RecorderState{
+	RecorderStateIdle:      {RecorderStateStarting},
+	RecorderStateStarting:  {RecorderStateRecording, RecorderStateIdle},
+	RecorderStateRecording: {RecorderStatePaused, RecorderStateStopping},
+	RecorderStatePaused:    {RecorderStateRecording, RecorderStateStopping},
+	RecorderStateStopping:  {RecorderStateFinalized},
+	RecorderStateFinalized: {RecorderStateStarting},
+}
+
+// RecorderStateMachine tracks the recorder lifecycle and rejects invalid transitions
+type RecorderStateMachine struct {
+	State     RecorderState
+	EnteredAt time.Time
+	Mutex     sync.RWMutex
+}
+
+// NewRecorderStateMachine creates a state machine in the Idle state
+func NewRecorderStateMachine() *RecorderStateMachine {
+	return &RecorderStateMachine{
+		State:     RecorderStateIdle,
+		EnteredAt: time.Now(),
+	}
+}
+
+// Transition moves to the given state if the lifecycle allows it
+func (sm *RecorderStateMachine) Transition(to RecorderState) error {
+	sm.Mutex.Lock()
+	defer sm.Mutex.Unlock()
+
+	if !canTransition(sm.State, to) {
+		return NewWorkflowError(ErrorTypeRecording,
+			fmt.Sprintf("Invalid recorder state transition %s -> %s", sm.State, to), nil)
+	}
+
+	sm.State = to
+	sm.EnteredAt = time.Now()
+	return nil
+}
+
+// GetState returns the current state
+func (sm *RecorderStateMachine) GetState() RecorderState {
+	sm.Mutex.RLock()
+	defer sm.Mutex.RUnlock()
+
+	return sm.State
+}
+
+// GetEnteredAt returns when the current state was entered
+func (sm *RecorderStateMachine) GetEnteredAt() time.Time {
+	sm.Mutex.RLock()
+	defer sm.Mutex.RUnlock()
+
+	return sm.EnteredAt
+}
+
+// Is reports whether the current state is one of states
+func (sm *RecorderStateMachine) Is(states ...RecorderState) bool {
+	current := sm.GetState()
+	for _, state := range states {
+		if current == state {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCapturing reports whether events should currently be recorded
+func (sm *RecorderStateMachine) IsCapturing() bool {
+	return sm.Is(RecorderStateRecording)
+}
+
+// IsActive reports whether a recording is in progress, paused or not
+func (sm *RecorderStateMachine) IsActive() bool {
+	return sm.Is(RecorderStateStarting, RecorderStateRecording, RecorderStatePaused)
+}
+
+func canTransition(from, to RecorderState) bool {
+	for _, allowed := range recorderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,445 @@
+package recorder
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RecordingController owns the active capture loop so the console, MCP and
+// HTTP front ends start and stop recordings the same way. Every goroutine
+// of a recording runs under a context that stopping it cancels; a recording
+// started with StartContext is also stopped and saved when the context it
+// was given is cancelled. Stopping waits for captions, OCR and event sinks
+// no longer than the context passed to StopContext or StopAndSaveContext
+// allows.
+type RecordingController struct {
+	Recorder      *Recorder // Captures the recordings; it holds the active one's components
+	Recording     *RecordedWorkflow
+	LastSavedFile string
+	State         *RecorderStateMachine
+	LimitStops    chan string // Receives the limit each time one stops a recording
+
+	chunks        *ChunkWriter
+	parent        context.Context    // The context the recording was started with
+	cancelCapture context.CancelFunc // Stops the recording's goroutines
+	captureDone   chan struct{}
+	clockSynced   chan struct{}
+	Mutex         sync.Mutex
+}
+
+// shutdownTimeout bounds how long saving takes when the recorder exits
+const shutdownTimeout = 30 * time.Second
+
+// NewRecordingController creates a controller of recorder with no active
+// recording
+func NewRecordingController(recorder *Recorder) *RecordingController {
+	return &RecordingController{
+		Recorder:   recorder,
+		State:      NewRecorderStateMachine(),
+		LimitStops: make(chan string, 1),
+	}
+}
+
+// Start begins a new recording with the given name
+func (rc *RecordingController) Start(name string) error {
+	return rc.StartContext(context.Background(), name)
+}
+
+// StartContext begins a new recording with the given name, which is stopped
+// and saved when ctx is cancelled
+func (rc *RecordingController) StartContext(ctx context.Context, name string) error {
+	return rc.start(ctx, newRecordedWorkflow(name), nil)
+}
+
+// start begins capturing into workflow under ctx, writing chunks with the
+// given writer or, when nil, one made for the configuration
+func (rc *RecordingController) start(ctx context.Context, workflow *RecordedWorkflow, chunks *ChunkWriter) error {
+	rc.Mutex.Lock()
+	defer rc.Mutex.Unlock()
+
+	r := rc.Recorder
+	config := r.currentConfig()
+	if err := checkStrictPrivacy(config); err != nil {
+		return err
+	}
+	redactor, err := NewPIIRedactor(config)
+	if err != nil {
+		return err
+	}
+	pauseHotkey, err := NewPauseHotkey(config.PauseHotkey)
+	if err != nil {
+		return err
+	}
+	sinks, err := NewEventSinks(config.EventSinks)
+	if err != nil {
+		return err
+	}
+
+	if err := rc.State.Transition(RecorderStateStarting); err != nil {
+		sinks.Close()
+		return NewWorkflowError(ErrorTypeRecording, "Recording already in progress", err)
+	}
+
+	rc.Recording = workflow
+	rc.clockSynced = startClockSync(rc.Recording, config.NTPServer)
+	trackers, cdp := NewCaptureTrackers(config), connectCDP(config.CDPDebuggingURL)
+	ocr := NewOCRRecognizer(config)
+	if ocr != nil {
+		ocr.Redactor = redactor
+	}
+	captioner, auditor, validator := NewVisionCaptioner(config), NewCaptureAuditor(config), NewSchemaValidator(config)
+	geometry := NewWindowGeometryWatcher(config)
+	files, processes, menus := NewFileActivityWatcher(config), NewProcessWatcher(config), NewMenuWatcher(config)
+	dialogs, focus, office := NewDialogWatcher(config), NewFocusWatcher(config), NewOfficeProbe(config)
+	limiter := NewConfigRateLimiter(config.MaxEventsPerSecond, config.EventRateLimits)
+	encoder := NewScreenshotEncoder(config, r)
+	shots := NewActionScreenshots(config, r.Screenshots)
+	dedupe := NewEventDeduplicator(time.Duration(config.DedupeWindowMs) * time.Millisecond)
+	r.Clipboard.Configure(config)
+	trackers.Clipboard, trackers.Health.Telemetry = r.Clipboard, r.Telemetry
+	r.update(func(r *Recorder) {
+		r.Capture, r.Trackers, r.CDP = NewCaptureState(), trackers, cdp
+		r.Captioner, r.OCR, r.PII = captioner, ocr, redactor
+		r.Auditor, r.Schema = auditor, validator
+		r.WindowGeometry, r.FileActivity, r.Processes = geometry, files, processes
+		r.Menus, r.Dialogs, r.Focus, r.Office = menus, dialogs, focus, office
+		r.RateLimiter, r.Encoder, r.Sinks = limiter, encoder, sinks
+		r.ActionShots, r.Deduplicator = shots, dedupe
+		r.Analytics = NewDwellAnalytics()
+	})
+
+	capture, cancel := context.WithCancel(ctx)
+	rc.parent, rc.cancelCapture = ctx, cancel
+	rc.captureDone = make(chan struct{})
+
+	done := rc.captureDone
+	watchdog := NewCaptureWatchdog(config)
+	go func() {
+		defer close(done)
+		watchdog.Supervise(capture, trackers, func(generation int) {
+			r.runCaptureLoop(capture, workflow, rc.State, pauseHotkey, watchdog, generation)
+		}, func(event RecorderRecoveredEvent) {
+			if r.Telemetry != nil {
+				r.Telemetry.RecordRecovery(event.RecorderRecovered)
+			}
+			r.appendWorkflowEvents(workflow, []WorkflowEvent{event})
+		})
+	}()
+	if ctx.Done() != nil {
+		go rc.saveWhenCancelled(ctx, capture, workflow)
+	}
+	if config.MaxRecordingMinutes > 0 || config.MaxRecordingSizeMB > 0 {
+		go rc.watchLimits(capture, workflow)
+	}
+	rc.chunks = chunks
+	if rc.chunks == nil {
+		rc.chunks = NewChunkWriter(config, workflow)
+	}
+	if rc.chunks != nil {
+		go rc.chunks.Run(capture)
+		if !rc.chunks.Autosave {
+			logger("recording").Info("Writing the recording in chunks", "directory", rc.chunks.Directory)
+		}
+	}
+
+	return rc.State.Transition(RecorderStateRecording)
+}
+
+// Pause suspends event capture without ending the recording
+func (rc *RecordingController) Pause() error {
+	if err := rc.State.Transition(RecorderStatePaused); err != nil {
+		return NewWorkflowError(ErrorTypeRecording, "No running recording to pause", err)
+	}
+	return nil
+}
+
+// Resume continues a paused recording
+func (rc *RecordingController) Resume() error {
+	if !rc.State.Is(RecorderStatePaused) {
+		return NewWorkflowError(ErrorTypeRecording, "Recording is not paused", nil)
+	}
+	return rc.State.Transition(RecorderStateRecording)
+}
+
+// Stop ends the capture loop and returns the finished workflow without saving it
+func (rc *RecordingController) Stop() (*RecordedWorkflow, error) {
+	return rc.StopContext(context.Background())
+}
+
+// StopContext is Stop, waiting for background work no longer than ctx allows
+func (rc *RecordingController) StopContext(ctx context.Context) (*RecordedWorkflow, error) {
+	workflow, _, err := rc.finish(ctx, false)
+	return workflow, err
+}
+
+// StopAndSave ends the capture loop and writes the workflow to disk
+func (rc *RecordingController) StopAndSave() (*RecordedWorkflow, string, error) {
+	return rc.StopAndSaveContext(context.Background())
+}
+
+// StopAndSaveContext is StopAndSave, waiting for captions, OCR and the
+// event sinks no longer than ctx allows. The recording is saved either way.
+func (rc *RecordingController) StopAndSaveContext(ctx context.Context) (*RecordedWorkflow, string, error) {
+	return rc.finish(ctx, true)
+}
+
+// saveWhenCancelled stops and saves workflow once ctx, the context it was
+// started with, is cancelled. capture is cancelled as well when the
+// recording is stopped some other way, which leaves nothing to do.
+func (rc *RecordingController) saveWhenCancelled(ctx, capture context.Context, workflow *RecordedWorkflow) {
+	<-capture.Done()
+	if ctx.Err() == nil || rc.Active() != workflow {
+		return
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if _, filename, err := rc.StopAndSaveContext(shutdown); err != nil {
+		logger("recording").Error("Failed to save the recording on cancellation", "error", err)
+	} else {
+		logger("recording").Info("Recording saved on cancellation", "file", filename, "cause", ctx.Err())
+	}
+}
+
+// contextTimeout shortens timeout to the time left before ctx's deadline
+func contextTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < timeout {
+			return max(left, 0)
+		}
+	}
+	if ctx.Err() != nil {
+		return 0
+	}
+	return timeout
+}
+
+// finish walks the recording through Stopping to Finalized, optionally
+// saving it in between. Stopping keeps other starts and stops out, so
+// rc.Mutex is held only to hand the recording over and to record where it
+// was saved, not while its background work drains.
+func (rc *RecordingController) finish(ctx context.Context, save bool) (*RecordedWorkflow, string, error) {
+	rc.Mutex.Lock()
+	if err := rc.State.Transition(RecorderStateStopping); err != nil {
+		rc.Mutex.Unlock()
+		return nil, "", NewWorkflowError(ErrorTypeRecording, "No recording in progress", err)
+	}
+	workflow, chunks := rc.Recording, rc.chunks
+	cancelCapture, captureDone, clockSynced := rc.cancelCapture, rc.captureDone, rc.clockSynced
+	rc.Recording, rc.chunks = nil, nil
+	rc.cancelCapture, rc.captureDone, rc.clockSynced = nil, nil, nil
+	rc.Mutex.Unlock()
+
+	cancelCapture()
+	<-captureDone
+
+	// Tracker callbacks and the HTTP API still read the components, so
+	// they are cleared under the recorder's lock once done with
+	r := rc.Recorder
+	r.Mutex.RLock()
+	config, trackers, cdp, shots := r.Config, r.Trackers, r.CDP, r.ActionShots
+	geometry, files, processes := r.WindowGeometry, r.FileActivity, r.Processes
+	menus, dialogs, focus := r.Menus, r.Dialogs, r.Focus
+	encoder, sinks, captioner, ocr := r.Encoder, r.Sinks, r.Captioner, r.OCR
+	redactor, validator, auditor, telemetry := r.PII, r.Schema, r.Auditor, r.Telemetry
+	r.Mutex.RUnlock()
+
+	// Text input sessions still open at stop would otherwise be lost
+	var flushed []WorkflowEvent
+	r.processTrackerEvents(workflow, &flushed, trackers.Flush())
+	if cdp != nil {
+		cdp.Close()
+		r.processCDPEvents(&flushed, cdp.Drain())
+		r.update(func(r *Recorder) { r.CDP = nil })
+	}
+	if geometry != nil {
+		geometry.Close()
+		flushed = append(flushed, geometry.Drain(time.Now().Add(windowGeometrySettle))...)
+		r.update(func(r *Recorder) { r.WindowGeometry = nil })
+	}
+	if files != nil {
+		files.Close()
+		flushed = append(flushed, files.Drain()...)
+		r.update(func(r *Recorder) { r.FileActivity = nil })
+	}
+	if processes != nil {
+		processes.Close()
+		flushed = append(flushed, processes.Drain()...)
+		r.update(func(r *Recorder) { r.Processes = nil })
+	}
+	if menus != nil {
+		menus.Close()
+		flushed = append(flushed, menus.Drain()...)
+		r.update(func(r *Recorder) { r.Menus = nil })
+	}
+	if dialogs != nil {
+		dialogs.Close()
+		flushed = append(flushed, dialogs.Drain()...)
+		r.update(func(r *Recorder) { r.Dialogs = nil })
+	}
+	if focus != nil {
+		focus.Close()
+		flushed = append(flushed, focus.Drain()...)
+		r.update(func(r *Recorder) { r.Focus = nil })
+	}
+	if shots != nil {
+		if after := shots.Close(); after != nil {
+			flushed = append(flushed, *after)
+		}
+		r.update(func(r *Recorder) { r.ActionShots = nil })
+	}
+	r.appendWorkflowEvents(workflow, flushed)
+
+	// Screenshots still being encoded go on to captioning and OCR once done
+	if encoder != nil {
+		encoder.Close()
+		r.update(func(r *Recorder) { r.Encoder = nil })
+	}
+	// The last events are delivered before the recording is saved
+	if sinks != nil {
+		sinks.CloseContext(ctx)
+		r.update(func(r *Recorder) { r.Sinks = nil })
+	}
+	// Give screenshots still with the vision model a chance to be captioned
+	if captioner != nil {
+		timeout := time.Duration(config.VisionTimeoutMs) * time.Millisecond
+		if !captioner.Wait(contextTimeout(ctx, timeout)) {
+			logger("vision").Warn("Saving recording before all screenshots were captioned")
+		}
+		r.update(func(r *Recorder) { r.Captioner = nil })
+	}
+	if ocr != nil {
+		if !ocr.Wait(contextTimeout(ctx, ocr.Timeout)) {
+			logger("ocr").Warn("Saving recording before OCR finished on all screenshots")
+		}
+		r.update(func(r *Recorder) { r.OCR = nil })
+	}
+	if redactor != nil {
+		counts := redactor.GetStatistics()
+		workflow.Mutex.Lock()
+		workflow.Redactions = counts
+		workflow.Mutex.Unlock()
+		if len(counts) > 0 {
+			logger("recording").Info("Masked PII in the recording", "counts", describePIICounts(counts))
+		}
+		r.update(func(r *Recorder) { r.PII = nil })
+	}
+	if validator != nil {
+		counts := validator.Rejections()
+		workflow.Mutex.Lock()
+		workflow.SchemaRejections = counts
+		workflow.Mutex.Unlock()
+		if len(counts) > 0 {
+			logger("recording").Warn("Strict mode left events out of the recording", "rejected", describeRejections(counts))
+		}
+		r.update(func(r *Recorder) { r.Schema = nil })
+	}
+
+	// The clock measurement gives up on its own after a few seconds
+	<-clockSynced
+
+	if telemetry != nil {
+		telemetry.RecordRecording(trackers.Health)
+	}
+
+	// A dry run has nothing to save
+	if auditor != nil {
+		auditor.PrintSummary()
+		r.update(func(r *Recorder) { r.Auditor = nil })
+		save = false
+	}
+
+	var filename string
+	var saveErr error
+	if save {
+		filename, saveErr = r.saveRecordedWorkflow(workflow)
+		if saveErr == nil {
+			rc.Mutex.Lock()
+			rc.LastSavedFile = filename
+			rc.Mutex.Unlock()
+			config := r.currentConfig()
+			if config.ExportSegments {
+				rc.exportSegments(workflow, filename)
+			}
+			if config.ExportAnalytics {
+				rc.exportAnalytics(filename)
+			}
+		}
+	}
+
+	if chunks != nil {
+		var err error
+		switch {
+		case chunks.Autosave && save && saveErr != nil:
+			// Left unfinished for --recover
+			err = chunks.Flush()
+		case chunks.Autosave:
+			err = chunks.Discard()
+		default:
+			err = chunks.Finish(filename)
+		}
+		if err != nil {
+			logger("chunks").Error("Failed to write the last recording chunk", "error", err)
+		}
+	}
+
+	if err := rc.State.Transition(RecorderStateFinalized); err != nil {
+		return workflow, filename, err
+	}
+	if saveErr != nil {
+		return workflow, "", NewWorkflowError(ErrorTypeFileIO, "Failed to save recording", saveErr)
+	}
+
+	return workflow, filename, nil
+}
+
+// exportSegments writes the marked segments of a saved recording. A failure
+// here is logged rather than returned, since the full recording is saved.
+func (rc *RecordingController) exportSegments(workflow *RecordedWorkflow, filename string) {
+	files, err := saveWorkflowSegments(workflow, filename, segmentMarkerOf)
+	if err != nil {
+		logger("recording").Error("Failed to export recording segments", "error", err)
+	}
+	if len(files) > 0 {
+		logger("recording").Info("Exported recording segments", "segments", len(files), "recording", filename)
+	}
+}
+
+// connectCDP attaches to the browser debugging endpoint, if configured.
+// The recording goes ahead without browser events when the browser isn't
+// reachable.
+func connectCDP(debuggingURL string) *CDPClient {
+	if debuggingURL == "" {
+		return nil
+	}
+
+	client := NewCDPClient(debuggingURL)
+	if err := client.Connect(); err != nil {
+		logger("cdp").Warn("Browser DevTools unavailable", "url", debuggingURL, "error", err)
+		return nil
+	}
+	logger("cdp").Info("Recording browser events", "url", debuggingURL)
+	return client
+}
+
+// Active returns the workflow being recorded, or nil
+func (rc *RecordingController) Active() *RecordedWorkflow {
+	rc.Mutex.Lock()
+	defer rc.Mutex.Unlock()
+
+	return rc.Recording
+}
+
+// IsRecording reports whether a recording is in progress, including paused
+func (rc *RecordingController) IsRecording() bool {
+	return rc.State.IsActive()
+}
+
+// GetLastSavedFile returns the file written by the most recent StopAndSave
+func (rc *RecordingController) GetLastSavedFile() string {
+	rc.Mutex.Lock()
+	defer rc.Mutex.Unlock()
+
+	return rc.LastSavedFile
+}
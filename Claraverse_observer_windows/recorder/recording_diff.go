@@ -0,0 +1,359 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Comparing and merging recordings. A diff lines up the steps of two
+// recordings, e.g. the same task done by two people: first the stretches
+// spent in each application, matched by application in order, then the
+// steps within each matched stretch. Steps left over on both sides at the
+// same place are reported as changed when they are the same kind of step.
+// A merge joins recordings into one, their events in time order, so the
+// parts of a task recorded separately can be replayed and summarized as one.
+
+// Diff operations
+const (
+	DiffSame    = "same"
+	DiffChanged = "changed"
+	DiffRemoved = "removed" // Only in the first recording
+	DiffAdded   = "added"   // Only in the second recording
+)
+
+// DiffStep is one side of a diff entry
+type DiffStep struct {
+	Index       int    `json:"index"`
+	OffsetMs    uint64 `json:"offset_ms"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Application string `json:"application,omitempty"`
+}
+
+// DiffEntry is a step in one or both recordings
+type DiffEntry struct {
+	Op     string    `json:"op"`
+	Before *DiffStep `json:"before,omitempty"`
+	After  *DiffStep `json:"after,omitempty"`
+}
+
+// RecordingDiff is the comparison of two recordings
+type RecordingDiff struct {
+	Before         string      `json:"before"`
+	After          string      `json:"after"`
+	BeforeDuration uint64      `json:"before_duration_ms"`
+	AfterDuration  uint64      `json:"after_duration_ms"`
+	Same           int         `json:"same"`
+	Changed        int         `json:"changed"`
+	Removed        int         `json:"removed"`
+	Added          int         `json:"added"`
+	Entries        []DiffEntry `json:"entries"`
+}
+
+// stepRun is a stretch of steps in one application
+type stepRun struct {
+	Application string
+	Steps       []RecordingStep
+}
+
+// diffRecordings lines up the steps of two recordings
+func diffRecordings(before, after *SavedRecording) *RecordingDiff {
+	diff := &RecordingDiff{
+		Before:         before.Name,
+		After:          after.Name,
+		BeforeDuration: before.DurationMs(),
+		AfterDuration:  after.DurationMs(),
+		Entries:        []DiffEntry{},
+	}
+	beforeSteps, _ := before.Steps(0)
+	afterSteps, _ := after.Steps(0)
+	beforeRuns, afterRuns := applicationRuns(beforeSteps), applicationRuns(afterSteps)
+
+	i, j := 0, 0
+	for _, match := range alignSequences(len(beforeRuns), len(afterRuns), func(i, j int) bool {
+		return strings.EqualFold(beforeRuns[i].Application, afterRuns[j].Application)
+	}) {
+		for ; i < match[0]; i++ {
+			diff.add(beforeRuns[i].Steps, nil)
+		}
+		for ; j < match[1]; j++ {
+			diff.add(nil, afterRuns[j].Steps)
+		}
+		diff.add(beforeRuns[i].Steps, afterRuns[j].Steps)
+		i, j = i+1, j+1
+	}
+	for ; i < len(beforeRuns); i++ {
+		diff.add(beforeRuns[i].Steps, nil)
+	}
+	for ; j < len(afterRuns); j++ {
+		diff.add(nil, afterRuns[j].Steps)
+	}
+	return diff
+}
+
+// add lines up the steps of two matched stretches, either of which may be
+// empty
+func (d *RecordingDiff) add(before, after []RecordingStep) {
+	i, j := 0, 0
+	for _, match := range alignSequences(len(before), len(after), func(i, j int) bool {
+		return before[i].Kind == after[j].Kind && before[i].Description == after[j].Description
+	}) {
+		d.addGap(before[i:match[0]], after[j:match[1]])
+		d.addEntry(DiffSame, &before[match[0]], &after[match[1]])
+		i, j = match[0]+1, match[1]+1
+	}
+	d.addGap(before[i:], after[j:])
+}
+
+// addGap adds the steps between two matches, pairing those of the same kind
+// as changed
+func (d *RecordingDiff) addGap(before, after []RecordingStep) {
+	k := 0
+	for ; k < len(before) && k < len(after) && before[k].Kind == after[k].Kind; k++ {
+		d.addEntry(DiffChanged, &before[k], &after[k])
+	}
+	for _, step := range before[k:] {
+		d.addEntry(DiffRemoved, &step, nil)
+	}
+	for _, step := range after[k:] {
+		d.addEntry(DiffAdded, nil, &step)
+	}
+}
+
+// addEntry adds an entry and counts it
+func (d *RecordingDiff) addEntry(op string, before, after *RecordingStep) {
+	entry := DiffEntry{Op: op, Before: diffStepOf(before), After: diffStepOf(after)}
+	d.Entries = append(d.Entries, entry)
+	switch op {
+	case DiffSame:
+		d.Same++
+	case DiffChanged:
+		d.Changed++
+	case DiffRemoved:
+		d.Removed++
+	case DiffAdded:
+		d.Added++
+	}
+}
+
+// diffStepOf returns the diff side of a step, or nil for none
+func diffStepOf(step *RecordingStep) *DiffStep {
+	if step == nil {
+		return nil
+	}
+	return &DiffStep{
+		Index:       step.Index,
+		OffsetMs:    step.OffsetMs,
+		Kind:        step.Kind,
+		Description: step.Description,
+		Application: step.Application,
+	}
+}
+
+// Text renders the diff with a line per step: "  " for the same step, "- "
+// and "+ " for steps of one recording only and "~ " for changed steps
+func (d *RecordingDiff) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s (%s)\n+++ %s (%s)\n", d.Before, FormatDuration(time.Duration(d.BeforeDuration)*time.Millisecond),
+		d.After, FormatDuration(time.Duration(d.AfterDuration)*time.Millisecond))
+	line := func(prefix string, step *DiffStep) string {
+		if step.Application != "" {
+			return prefix + step.Application + ": " + step.Description
+		}
+		return prefix + step.Description
+	}
+	for _, entry := range d.Entries {
+		switch entry.Op {
+		case DiffSame:
+			b.WriteString(line("  ", entry.Before) + "\n")
+		case DiffChanged:
+			b.WriteString(line("~ ", entry.Before) + " => " + entry.After.Description + "\n")
+		case DiffRemoved:
+			b.WriteString(line("- ", entry.Before) + "\n")
+		case DiffAdded:
+			b.WriteString(line("+ ", entry.After) + "\n")
+		}
+	}
+	fmt.Fprintf(&b, "%d same, %d changed, %d only in %s, %d only in %s\n",
+		d.Same, d.Changed, d.Removed, d.Before, d.Added, d.After)
+	return b.String()
+}
+
+// applicationRuns splits steps where the application changes
+func applicationRuns(steps []RecordingStep) []stepRun {
+	var runs []stepRun
+	for _, step := range steps {
+		if len(runs) == 0 || !strings.EqualFold(runs[len(runs)-1].Application, step.Application) {
+			runs = append(runs, stepRun{Application: step.Application})
+		}
+		runs[len(runs)-1].Steps = append(runs[len(runs)-1].Steps, step)
+	}
+	return runs
+}
+
+// alignSequences returns the index pairs of a longest common subsequence of
+// two sequences of lengths n and m, in order
+func alignSequences(n, m int, equal func(i, j int) bool) [][2]int {
+	// lengths[i][j] is the longest common subsequence of the suffixes from
+	// i and j
+	lengths := make([][]int, n+1)
+	for i := range lengths {
+		lengths[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if equal(i, j) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var matches [][2]int
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case equal(i, j):
+			matches = append(matches, [2]int{i, j})
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
+
+// diffRecordingFiles compares two saved recordings
+func diffRecordingFiles(before, after, store string) (*RecordingDiff, error) {
+	beforeRecording, err := LoadSavedRecording(before, store)
+	if err != nil {
+		return nil, err
+	}
+	afterRecording, err := LoadSavedRecording(after, store)
+	if err != nil {
+		return nil, err
+	}
+	diff := diffRecordings(beforeRecording, afterRecording)
+	if diff.Before == "" {
+		diff.Before = filepath.Base(before)
+	}
+	if diff.After == "" {
+		diff.After = filepath.Base(after)
+	}
+	return diff, nil
+}
+
+// mergeRecordingFiles joins saved recordings into one, written to output.
+// Events keep their content and are numbered afresh in time order; events
+// at the same time keep the order of the recordings given.
+func mergeRecordingFiles(files []string, name, output string) (*RecordedWorkflow, error) {
+	if len(files) < 2 {
+		return nil, NewWorkflowError(ErrorTypeConfiguration, "Merging needs at least two recordings", nil)
+	}
+
+	type timedEvent struct {
+		Timestamp uint64
+		Raw       json.RawMessage
+	}
+	var events []timedEvent
+	var names []string
+	merged := &RecordedWorkflow{SchemaVersion: SchemaVersion}
+	for _, file := range files {
+		var saved struct {
+			Name      string            `json:"name"`
+			StartTime uint64            `json:"start_time"`
+			EndTime   uint64            `json:"end_time"`
+			Events    []json.RawMessage `json:"events"`
+			Chunks    []RecordingChunk  `json:"chunks"`
+			Store     string            `json:"screenshot_store"`
+		}
+		if err := LoadRecordingFile(file, &saved); err != nil {
+			return nil, err
+		}
+		if saved.Chunks != nil {
+			return nil, NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("%s is a chunk manifest; merge the recording it was saved as", file), nil)
+		}
+		if saved.Store != "" && merged.ScreenshotStore != "" && saved.Store != merged.ScreenshotStore {
+			return nil, NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("%s keeps its screenshots in %s, not %s", file, saved.Store, merged.ScreenshotStore), nil)
+		}
+		if saved.Store != "" {
+			merged.ScreenshotStore = saved.Store
+		}
+
+		if merged.StartTime == 0 || (saved.StartTime != 0 && saved.StartTime < merged.StartTime) {
+			merged.StartTime = saved.StartTime
+		}
+		merged.EndTime = max(merged.EndTime, saved.EndTime)
+		if saved.Name != "" {
+			names = append(names, saved.Name)
+		}
+		for _, raw := range saved.Events {
+			var probe struct {
+				Metadata EventMetadata `json:"metadata"`
+			}
+			json.Unmarshal(raw, &probe)
+			events = append(events, timedEvent{Timestamp: probe.Metadata.Timestamp, Raw: raw})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp < events[j].Timestamp })
+	merged.Events = make([]WorkflowEvent, len(events))
+	for i, event := range events {
+		raw, err := renumberEvent(event.Raw, uint64(i+1))
+		if err != nil {
+			return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to renumber a merged event", err)
+		}
+		merged.Events[i] = raw
+	}
+	merged.LastSequence = uint64(len(events))
+
+	merged.Name = name
+	if merged.Name == "" {
+		merged.Name = strings.Join(names, " + ")
+	}
+	if err := SaveJSONToFile(merged, output); err != nil {
+		return nil, err
+	}
+	if err := referenceStoredScreenshots(merged, output); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// renumberEvent returns a saved event with its sequence number set to seq
+func renumberEvent(raw json.RawMessage, seq uint64) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	var metadata map[string]json.RawMessage
+	if data, ok := fields["metadata"]; ok {
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return nil, err
+		}
+	}
+	if metadata == nil {
+		// Events without metadata have no place in the sequence
+		return raw, nil
+	}
+	metadata["seq"] = json.RawMessage(fmt.Sprint(seq))
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	fields["metadata"] = data
+	return json.Marshal(fields)
+}
+
+// mergedRecordingFile names a merged recording written to dir
+func mergedRecordingFile(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("%smerged_%s.json", recordingFilePrefix, time.Now().Format("20060102_150405")))
+}
@@ -0,0 +1,495 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Import of recordings made with other tools. `import <file>` converts a
+// Selenium IDE project (.side) or a Windows Steps Recorder capture (.mht)
+// into a recording, so the scripts and captures a team already has can be
+// reported on, converted, diffed and replayed like the recorder's own.
+//
+// Selenium IDE saves commands, not a timeline, so each command becomes the
+// events the recorder would have seen, a second apart. open is a
+// navigation; click a DevTools element click, its locator turned into a
+// CSS selector (id=, name=, css=) or an XPath one, which Playwright reads;
+// type and sendKeys a completed text input, after a click on the field
+// when it was not the last element clicked, with ${KEY_ENTER} completing
+// it with Enter; submit a form submit. Each test
+// of the project is a marked segment, after an annotation naming it.
+// Assertions, waits and the other commands that are not user actions are
+// left out.
+//
+// Steps Recorder saves a step's time, program, pointer position, a
+// description such as `User left click on "Save (push button)" in
+// "Untitled - Notepad"` and a screenshot. Clicks, drags and wheel turns
+// become mouse events on the element and window the description names, a
+// change of program an application switch, and keyboard input and comments
+// annotations, since Steps Recorder does not save the keys. Each step's
+// screenshot follows it.
+
+const (
+	ImportFormatSeleniumIDE   = "side"
+	ImportFormatStepsRecorder = "mht"
+
+	// importStepIntervalMs is how far apart the commands of a Selenium IDE
+	// test are placed
+	importStepIntervalMs = 1000
+)
+
+// ImportSummary counts what an import read
+type ImportSummary struct {
+	Format  string
+	Steps   int // Commands or steps imported
+	Skipped int // Commands that are not user actions
+}
+
+// importRecording converts a Selenium IDE project or Steps Recorder capture
+// into a recording, telling them apart by extension
+func importRecording(filename string) (*RecordedWorkflow, ImportSummary, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, ImportSummary{}, NewWorkflowError(ErrorTypeFileIO, "Failed to read recording to import", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+
+	var workflow *RecordedWorkflow
+	var summary ImportSummary
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".side":
+		workflow, summary, err = importSeleniumIDE(data, name, uint64(time.Now().UnixMilli()))
+	case ".mht", ".mhtml":
+		workflow, summary, err = importStepsRecorder(data, name)
+	default:
+		return nil, ImportSummary{}, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Cannot import %s: only Selenium IDE .side and Steps Recorder .mht files can be", filename), nil)
+	}
+	if err != nil {
+		return nil, summary, err
+	}
+
+	if count := len(workflow.Events); count > 0 {
+		first, _ := eventMetadata(workflow.Events[0])
+		last, _ := eventMetadata(workflow.Events[count-1])
+		workflow.StartTime, workflow.EndTime = first.Timestamp, last.Timestamp
+	}
+	workflow.Steps = summarizeSteps(workflow.Events)
+	return workflow, summary, nil
+}
+
+// importRecordingFile imports a recording and saves it to output
+func importRecordingFile(filename, output string) (*RecordedWorkflow, ImportSummary, error) {
+	workflow, summary, err := importRecording(filename)
+	if err != nil {
+		return nil, summary, err
+	}
+	if err := SaveJSONToFile(workflow, output); err != nil {
+		return nil, summary, err
+	}
+	return workflow, summary, nil
+}
+
+// importedRecordingFile names an imported recording written to dir
+func importedRecordingFile(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("%simported_%s.json", recordingFilePrefix, time.Now().Format("20060102_150405")))
+}
+
+// sideProject is the part of a Selenium IDE project the import reads
+type sideProject struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Tests []struct {
+		Name     string `json:"name"`
+		Commands []struct {
+			Command string `json:"command"`
+			Target  string `json:"target"`
+			Value   string `json:"value"`
+		} `json:"commands"`
+	} `json:"tests"`
+}
+
+// sideKeyPattern matches the special keys of sendKeys, e.g. ${KEY_ENTER}
+var sideKeyPattern = regexp.MustCompile(`\$\{KEY_[A-Z0-9_]+\}`)
+
+// importSeleniumIDE converts the tests of a Selenium IDE project, placing
+// its first command a second after start
+func importSeleniumIDE(data []byte, name string, start uint64) (*RecordedWorkflow, ImportSummary, error) {
+	summary := ImportSummary{Format: ImportFormatSeleniumIDE}
+	var project sideProject
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, summary, NewWorkflowError(ErrorTypeSerialization, "Failed to parse Selenium IDE project", err)
+	}
+	if len(project.Tests) == 0 {
+		return nil, summary, NewWorkflowError(ErrorTypeConfiguration, "The Selenium IDE project has no tests", nil)
+	}
+	if project.Name != "" {
+		name = project.Name
+	}
+
+	workflow := newRecordedWorkflow(name)
+	timestamp := start
+	var page, lastTarget string
+	typed := -1 // Index of the text input into lastTarget, if any
+	next := func() EventMetadata {
+		timestamp += importStepIntervalMs
+		return EventMetadata{Timestamp: timestamp}
+	}
+	click := func(target string) {
+		selector, text := sideSelector(target)
+		workflow.AppendEvent(BrowserCDPEvent{CDPEvent: CDPElementClicked, URL: page, Selector: selector, ElementText: text, Metadata: next()})
+		lastTarget, typed = target, -1
+	}
+
+	for _, test := range project.Tests {
+		workflow.AppendEvent(AnnotationEvent{Annotation: "Test " + test.Name, Metadata: next()})
+		workflow.AppendEvent(SegmentMarkerEvent{SegmentMarker: SegmentMarkerStart, Metadata: next()})
+		page, lastTarget, typed = "", "", -1
+
+		for _, command := range test.Commands {
+			switch command.Command {
+			case "open":
+				page = sideURL(project.URL, command.Target)
+				workflow.AppendEvent(BrowserCDPEvent{CDPEvent: CDPNavigation, URL: page, Metadata: next()})
+				lastTarget, typed = "", -1
+			case "click", "clickAt", "doubleClick", "doubleClickAt":
+				click(command.Target)
+			case "type", "sendKeys":
+				text := sideKeyPattern.ReplaceAllString(command.Value, "")
+				enter := strings.HasSuffix(command.Value, "${KEY_ENTER}")
+				if text == "" {
+					// Enter pressed in the field just typed into completes
+					// that input; other keys alone are not text
+					if !enter || typed < 0 || command.Target != lastTarget {
+						summary.Skipped++
+						continue
+					}
+					input := workflow.Events[typed].(TextInputCompletedEvent)
+					input.CompletionReason = "enter"
+					workflow.Events[typed] = input
+					break
+				}
+
+				if command.Target != lastTarget {
+					click(command.Target)
+				}
+				input := TextInputCompletedEvent{TextValue: text, FieldName: sideFieldName(command.Target), InputMethod: TextInputTyped,
+					KeystrokeCount: uint32(len([]rune(text))), Metadata: next()}
+				if enter {
+					input.CompletionReason = "enter"
+				}
+				if page != "" {
+					input.Metadata.UIElement = &UIElement{Role: "edit", Name: input.FieldName, URL: page}
+				}
+				workflow.AppendEvent(input)
+				typed = len(workflow.Events) - 1
+			case "submit":
+				selector, _ := sideSelector(command.Target)
+				workflow.AppendEvent(BrowserCDPEvent{CDPEvent: CDPFormSubmitted, URL: page, Selector: selector, Metadata: next()})
+			default:
+				summary.Skipped++
+				continue
+			}
+			summary.Steps++
+		}
+		workflow.AppendEvent(SegmentMarkerEvent{SegmentMarker: SegmentMarkerEnd, Metadata: next()})
+	}
+	return workflow, summary, nil
+}
+
+// sideURL resolves the target of open against the project's base URL
+func sideURL(base, target string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil || base == "" {
+		return target
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	return baseURL.ResolveReference(targetURL).String()
+}
+
+// sideSelector turns a Selenium locator into a CSS selector, or an XPath
+// one prefixed xpath=, and the link text it names if any
+func sideSelector(locator string) (string, string) {
+	strategy, value, found := strings.Cut(locator, "=")
+	if !found {
+		strategy, value = "", locator
+	}
+	switch strategy {
+	case "id":
+		return fmt.Sprintf(`[id="%s"]`, cssString(value)), ""
+	case "name":
+		return fmt.Sprintf(`[name="%s"]`, cssString(value)), ""
+	case "css":
+		return value, ""
+	case "xpath":
+		return "xpath=" + value, ""
+	case "linkText":
+		return fmt.Sprintf("xpath=//a[normalize-space()=%s]", xpathString(value)), value
+	case "partialLinkText":
+		return fmt.Sprintf("xpath=//a[contains(., %s)]", xpathString(value)), value
+	}
+	if strings.HasPrefix(locator, "//") {
+		return "xpath=" + locator, ""
+	}
+	return locator, ""
+}
+
+// sideFieldName names the field a locator finds by id or name
+func sideFieldName(locator string) string {
+	if strategy, value, _ := strings.Cut(locator, "="); strategy == "id" || strategy == "name" {
+		return value
+	}
+	return ""
+}
+
+// cssString escapes a value for a double-quoted CSS string
+func cssString(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+// psrSession is the step data Steps Recorder saves in its report
+type psrSession struct {
+	Sessions []struct {
+		Actions []psrAction `xml:"EachAction"`
+	} `xml:"RecordSession"`
+}
+
+// psrAction is one step of a Steps Recorder capture
+type psrAction struct {
+	Time        string `xml:"Time,attr"`
+	ProcessID   uint32 `xml:"Pid,attr"`
+	FileName    string `xml:"FileName,attr"`
+	Description string `xml:"Description"`
+	Action      string `xml:"Action"`
+	Cursor      string `xml:"CursorCoordsXY"`
+	Screen      string `xml:"ScreenCoordsXYWH"`
+	Screenshot  string `xml:"ScreenshotFileName"`
+}
+
+var (
+	// psrElementPattern finds the element and window in a description:
+	// on "Save (push button)" in "Untitled - Notepad"
+	psrElementPattern = regexp.MustCompile(`on "(.*?) \(([^()"]*)\)"`)
+	psrWindowPattern  = regexp.MustCompile(`\bin "([^"]*)"`)
+)
+
+// importStepsRecorder converts a Steps Recorder capture, an MHTML archive
+// of its report and screenshots
+func importStepsRecorder(data []byte, name string) (*RecordedWorkflow, ImportSummary, error) {
+	summary := ImportSummary{Format: ImportFormatStepsRecorder}
+	report, images, date, err := readStepsRecorderArchive(data)
+	if err != nil {
+		return nil, summary, err
+	}
+	start := bytes.Index(report, []byte("<UserActionData"))
+	end := bytes.Index(report, []byte("</UserActionData>"))
+	if start < 0 || end < start {
+		return nil, summary, NewWorkflowError(ErrorTypeConfiguration, "The archive is not a Steps Recorder capture", nil)
+	}
+	var session psrSession
+	if err := xml.Unmarshal(report[start:end+len("</UserActionData>")], &session); err != nil {
+		return nil, summary, NewWorkflowError(ErrorTypeSerialization, "Failed to parse Steps Recorder steps", err)
+	}
+
+	workflow := newRecordedWorkflow(name)
+	var timestamp uint64
+	var application ForegroundApplication
+	for _, recorded := range session.Sessions {
+		for _, action := range recorded.Actions {
+			timestamp = psrTimestamp(date, action.Time, timestamp)
+			metadata := EventMetadata{Timestamp: timestamp, UIElement: psrElement(action)}
+
+			if action.FileName != "" && action.FileName != application.Name {
+				if application.Name != "" {
+					workflow.AppendEvent(ApplicationSwitchEvent{
+						FromApplication: application.Name,
+						ToApplication:   action.FileName,
+						FromProcessID:   application.ProcessID,
+						ToProcessID:     action.ProcessID,
+						SwitchMethod:    AppSwitchOther,
+						DwellTimeMs:     timestamp - uint64(application.Since.UnixMilli()),
+						Metadata:        EventMetadata{Timestamp: timestamp},
+					})
+				}
+				application = ForegroundApplication{Name: action.FileName, ProcessID: action.ProcessID, Since: time.UnixMilli(int64(timestamp))}
+			}
+
+			trigger := ScreenshotTriggerMouseClick
+			if mouse, ok := psrMouseEvent(action, metadata); ok {
+				workflow.AppendEvent(mouse)
+			} else {
+				workflow.AppendEvent(AnnotationEvent{Annotation: action.Description, Metadata: metadata})
+				trigger = ScreenshotTriggerKeyboard
+			}
+			if shot, ok := psrScreenshot(images[strings.ToLower(action.Screenshot)], action, trigger, metadata); ok {
+				workflow.AppendEvent(shot)
+			}
+			summary.Steps++
+		}
+	}
+	return workflow, summary, nil
+}
+
+// readStepsRecorderArchive reads the HTML report and the images, by
+// lowercased file name, of an MHTML archive, and the date it was saved
+func readStepsRecorderArchive(data []byte) ([]byte, map[string][]byte, time.Time, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, time.Time{}, NewWorkflowError(ErrorTypeSerialization, "Failed to read MHTML archive", err)
+	}
+	date, err := message.Header.Date()
+	if err != nil {
+		date = time.Now()
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, nil, date, NewWorkflowError(ErrorTypeConfiguration, "The file is not an MHTML archive", err)
+	}
+
+	var report []byte
+	images := make(map[string][]byte)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, date, NewWorkflowError(ErrorTypeSerialization, "Failed to read MHTML archive", err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, date, NewWorkflowError(ErrorTypeSerialization, "Failed to read MHTML archive", err)
+		}
+		// Quoted-printable parts are decoded by the reader; base64 ones are not
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+			if body, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), "")); err != nil {
+				continue
+			}
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") && report == nil {
+			report = body
+		} else if location := part.Header.Get("Content-Location"); location != "" {
+			images[strings.ToLower(path.Base(location))] = body
+		}
+	}
+	return report, images, date, nil
+}
+
+// psrTimestamp places a step's time of day on the capture's date, after
+// the previous step: a time earlier than it is taken to be the next day
+func psrTimestamp(date time.Time, clock string, previous uint64) uint64 {
+	parsed, err := time.ParseInLocation("15:04:05", strings.TrimSpace(clock), date.Location())
+	if err != nil {
+		if previous == 0 {
+			return uint64(date.UnixMilli())
+		}
+		return previous + importStepIntervalMs
+	}
+	at := time.Date(date.Year(), date.Month(), date.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, date.Location())
+	for previous != 0 && uint64(at.UnixMilli()) < previous {
+		at = at.AddDate(0, 0, 1)
+	}
+	return uint64(at.UnixMilli())
+}
+
+// psrElement is the element and window a step's description names
+func psrElement(action psrAction) *UIElement {
+	element := &UIElement{Role: "window", ProcessID: action.ProcessID, ApplicationName: action.FileName}
+	if match := psrElementPattern.FindStringSubmatch(action.Description); match != nil {
+		element.Name, element.Role = match[1], match[2]
+	}
+	if match := psrWindowPattern.FindStringSubmatch(action.Description); match != nil {
+		element.WindowTitle = match[1]
+		if element.Name == "" {
+			element.Name = match[1]
+		}
+	}
+	return element
+}
+
+// psrMouseEvent converts a mouse step; false for keyboard input, comments
+// and the rest
+func psrMouseEvent(action psrAction, metadata EventMetadata) (MouseEvent, bool) {
+	numbers := psrNumbers(action.Cursor)
+	if len(numbers) < 2 {
+		return MouseEvent{}, false
+	}
+
+	event := MouseEvent{Button: MouseButtonLeft, Position: Position{X: numbers[0], Y: numbers[1]}, Metadata: metadata}
+	kind := strings.ToLower(action.Action)
+	switch {
+	case !strings.Contains(kind, "mouse"):
+		return MouseEvent{}, false
+	case strings.Contains(kind, "double"):
+		event.EventType = MouseDoubleClick
+	case strings.Contains(kind, "right"):
+		event.EventType, event.Button = MouseRightClick, MouseButtonRight
+	case strings.Contains(kind, "drag"):
+		event.EventType = MouseDrag
+	case strings.Contains(kind, "wheel"):
+		event.EventType, event.Button = MouseWheel, MouseButtonNone
+	case strings.Contains(kind, "click"):
+		event.EventType = MouseClick
+	default:
+		return MouseEvent{}, false
+	}
+	return event, true
+}
+
+// psrScreenshot converts a step's screenshot, if the archive has it and it
+// decodes
+func psrScreenshot(data []byte, action psrAction, trigger ScreenshotTrigger, metadata EventMetadata) (ScreenshotEvent, bool) {
+	if len(data) == 0 {
+		return ScreenshotEvent{}, false
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ScreenshotEvent{}, false
+	}
+	shot := ScreenshotEvent{
+		ImageBase64: base64.StdEncoding.EncodeToString(data),
+		ImageFormat: format,
+		Width:       config.Width,
+		Height:      config.Height,
+		MonitorName: "Primary",
+		Trigger:     trigger,
+		Metadata:    metadata,
+	}
+	if area := psrNumbers(action.Screen); len(area) == 4 && area[2] > 0 && area[3] > 0 {
+		shot.ScreenArea = &[4]int32{area[0], area[1], area[2], area[3]}
+	}
+	return shot, true
+}
+
+// psrNumbers parses comma-separated integers such as "599,311"
+func psrNumbers(text string) []int32 {
+	var numbers []int32
+	for _, field := range strings.Split(text, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(field), 10, 32)
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, int32(n))
+	}
+	return numbers
+}
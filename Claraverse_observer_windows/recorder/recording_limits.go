@@ -0,0 +1,170 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"time"
+)
+
+// Recording limits. MaxRecordingMinutes and MaxRecordingSizeMB keep an
+// unattended recorder from filling the disk. At a limit the recording is
+// saved and, with RotateRecording, a new part is started straight away; a
+// RecordingRotatedEvent ends one part and starts the next, naming the file
+// before it. Without RotateRecording the recording stops. Limits are not
+// checked while the recording is paused.
+
+const recordingLimitPollInterval = time.Second
+
+// Limits a recording can reach
+const (
+	RecordingLimitDuration = "duration"
+	RecordingLimitSize     = "size"
+)
+
+// RecordingRotatedEvent marks where a recording was split into parts
+type RecordingRotatedEvent struct {
+	RecordingRotated string        `json:"recording_rotated"`       // Limit reached: duration or size
+	Part             int           `json:"part"`                    // Part the event is in, from 1
+	PreviousFile     string        `json:"previous_file,omitempty"` // At the start of a part, the file of the part before
+	Metadata         EventMetadata `json:"metadata"`
+}
+
+// validateRecordingLimits checks the limits are usable
+func validateRecordingLimits(config *WorkflowRecorderConfig) error {
+	if config.MaxRecordingMinutes < 0 || config.MaxRecordingSizeMB < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"MaxRecordingMinutes and MaxRecordingSizeMB cannot be negative", nil)
+	}
+	if config.RotateRecording && config.MaxRecordingMinutes == 0 && config.MaxRecordingSizeMB == 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"RotateRecording needs MaxRecordingMinutes or MaxRecordingSizeMB", nil)
+	}
+	return nil
+}
+
+// estimatedEventSize approximates the bytes an event adds to a saved
+// recording. Screenshots are counted by their image alone, which is nearly
+// all of their size, so they are not encoded twice.
+func estimatedEventSize(event WorkflowEvent) int64 {
+	if shot, ok := event.(ScreenshotEvent); ok {
+		return int64(len(shot.ImageBase64)) + 512
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0
+	}
+	// Saved recordings are indented, roughly one more byte in three
+	return int64(len(data)) * 4 / 3
+}
+
+// recordingLimitReached returns the limit a recording has reached at now,
+// or "" for none
+func recordingLimitReached(config WorkflowRecorderConfig, workflow *RecordedWorkflow, now uint64) string {
+	if minutes := config.MaxRecordingMinutes; minutes > 0 &&
+		now >= workflow.StartTime+uint64(minutes)*uint64(time.Minute/time.Millisecond) {
+		return RecordingLimitDuration
+	}
+	if megabytes := config.MaxRecordingSizeMB; megabytes > 0 && workflow.EstimatedSize() >= int64(megabytes)<<20 {
+		return RecordingLimitSize
+	}
+	return ""
+}
+
+// watchLimits checks a recording against the limits until ctx is
+// cancelled, and stops or rotates it at one
+func (rc *RecordingController) watchLimits(ctx context.Context, workflow *RecordedWorkflow) {
+	ticker := time.NewTicker(recordingLimitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !rc.State.Is(RecorderStateRecording) {
+				continue
+			}
+			limit := recordingLimitReached(rc.Recorder.currentConfig(), workflow, captureTimestamp())
+			if limit == "" {
+				continue
+			}
+			// The recording may have been stopped while the limit was checked
+			if rc.Active() != workflow {
+				return
+			}
+			rc.limitReached(limit)
+			return
+		}
+	}
+}
+
+// limitReached rotates or stops the recording at a limit
+func (rc *RecordingController) limitReached(limit string) {
+	if rc.Recorder.currentConfig().RotateRecording {
+		filename, err := rc.Rotate(limit)
+		if err != nil {
+			logger("recording").Error("Failed to rotate the recording", "error", err)
+			return
+		}
+		printConsole(Msg(MsgRecordingRotated, limit, filename))
+		return
+	}
+
+	_, filename, err := rc.StopAndSave()
+	if err != nil {
+		logger("recording").Error("Failed to stop the recording at its limit", "limit", limit, "error", err)
+		return
+	}
+	printConsole(Msg(MsgLimitStopped, limit, filename))
+	select {
+	case rc.LimitStops <- limit:
+	default:
+	}
+}
+
+// Rotate saves the recording as a finished part, named for the limit it
+// reached, and carries on in a new part, under the same context. Returns
+// the saved part's file.
+func (rc *RecordingController) Rotate(limit string) (string, error) {
+	workflow := rc.Active()
+	if workflow == nil {
+		return "", NewWorkflowError(ErrorTypeRecording, "No recording in progress", nil)
+	}
+	rc.Mutex.Lock()
+	parent := rc.parent
+	rc.Mutex.Unlock()
+
+	workflow.Mutex.Lock()
+	workflow.Part = max(workflow.Part, 1)
+	part := workflow.Part
+	workflow.Mutex.Unlock()
+
+	rc.Recorder.appendWorkflowEvents(workflow, []WorkflowEvent{RecordingRotatedEvent{
+		RecordingRotated: limit,
+		Part:             part,
+		Metadata:         EventMetadata{Timestamp: captureTimestamp()},
+	}})
+	_, filename, err := rc.StopAndSave()
+	if err != nil {
+		return "", err
+	}
+
+	if err := rc.StartContext(parent, workflow.Name); err != nil {
+		return filename, err
+	}
+	next := rc.Active()
+	if next == nil {
+		return filename, nil
+	}
+	next.Mutex.Lock()
+	next.Part = part + 1
+	next.Mutex.Unlock()
+	rc.Recorder.appendWorkflowEvents(next, []WorkflowEvent{RecordingRotatedEvent{
+		RecordingRotated: limit,
+		Part:             part + 1,
+		PreviousFile:     filepath.Base(filename),
+		Metadata:         EventMetadata{Timestamp: next.StartTime},
+	}})
+	return filename, nil
+}
@@ -0,0 +1,493 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Readable steps from a saved recording, shared by the exporters that
+// summarize a recording for people or models rather than replay it.
+
+// Step priorities, used when a summary has to leave steps out
+const (
+	StepPriorityLow = iota
+	StepPriorityMedium
+	StepPriorityHigh
+)
+
+// RecordingStep is one user action of a saved recording in words
+type RecordingStep struct {
+	Index       int    // Position among the recording's events
+	OffsetMs    uint64 // Time since the recording started
+	Kind        string
+	Description string
+	Application string
+	Window      string
+	Priority    int
+}
+
+// RecordingScreenshot is a screenshot of a saved recording
+type RecordingScreenshot struct {
+	Index       int
+	OffsetMs    uint64
+	ImageBase64 string
+	ImageFormat string
+	Width       int
+	Height      int
+	Trigger     string
+	Caption     string
+	ScreenArea  *[4]int32 // Captured screen x, y, width and height, if saved
+}
+
+// SavedRecording is a recording loaded from disk for summarizing
+type SavedRecording struct {
+	Name      string
+	StartTime uint64
+	EndTime   uint64
+	Events    []savedEvent
+	Segments  []TaskSegment
+}
+
+// savedEvent holds the fields of any saved event type that the summaries
+// read. Event types are told apart by which fields are present.
+type savedEvent struct {
+	EventType       string           `json:"event_type"`
+	Position        *Position        `json:"position"`
+	DragStart       *Position        `json:"drag_start"`
+	KeyCode         *uint32          `json:"key_code"`
+	Action          string           `json:"action"`
+	Content         string           `json:"content"`
+	ContentSize     *int             `json:"content_size"`
+	Combination     *string          `json:"combination"`
+	ToApplication   *string          `json:"to_application"`
+	ButtonText      *string          `json:"button_text"`
+	ImageBase64     *string          `json:"image_base64"`
+	ImageRef        string           `json:"image_ref"`
+	ImageFormat     string           `json:"image_format"`
+	Width           int              `json:"width"`
+	Height          int              `json:"height"`
+	Trigger         string           `json:"trigger"`
+	ScreenArea      *[4]int32        `json:"screen_area"`
+	Vision          *VisionCaption   `json:"vision"`
+	TextValue       *string          `json:"text_value"`
+	Redacted        bool             `json:"redacted"`
+	FieldName       string           `json:"field_name"`
+	Browser         *string          `json:"browser"`
+	ToURL           string           `json:"to_url"`
+	ToTitle         string           `json:"to_title"`
+	CDPEvent        CDPEventType     `json:"cdp_event"`
+	URL             string           `json:"url"`
+	Selector        string           `json:"selector"`
+	ElementText     string           `json:"element_text"`
+	SelectedText    *string          `json:"selected_text"`
+	Success         *bool            `json:"success"`
+	StartPosition   *Position        `json:"start_position"`
+	EndPosition     *Position        `json:"end_position"`
+	SegmentMarker   string           `json:"segment_marker"`
+	RecordingMarker string           `json:"recording_marker"`
+	Annotation      *string          `json:"annotation"`
+	QuotaExceeded   string           `json:"quota_exceeded"`
+	QuotaKind       string           `json:"quota_kind"`
+	QuotaLimit      int              `json:"quota_limit"`
+	QuotaPeriod     string           `json:"quota_period"`
+	Rotated         string           `json:"recording_rotated"`
+	PreviousFile    string           `json:"previous_file"`
+	Interrupted     string           `json:"session_interrupted"`
+	GapMs           uint64           `json:"gap_ms"`
+	Command         *string          `json:"command"`
+	Complete        bool             `json:"complete"`
+	Fullscreen      *string          `json:"fullscreen"`
+	Application     string           `json:"application"`
+	Idle            string           `json:"idle"`
+	IdleMs          uint64           `json:"idle_ms"`
+	Bookmark        *string          `json:"bookmark"`
+	Source          string           `json:"source"`
+	Reference       string           `json:"reference"`
+	Recovered       string           `json:"recorder_recovered"`
+	StalledMs       uint64           `json:"stalled_ms"`
+	ElementSelector *ElementSelector `json:"element_selector"`
+	WindowChange    string           `json:"window_change"`
+	WindowTitle     string           `json:"window_title"`
+	After           *[4]int32        `json:"after"`
+	FileActivity    string           `json:"file_activity"`
+	Path            string           `json:"path"`
+	PreviousPath    string           `json:"previous_path"`
+	Process         string           `json:"process"`
+	ParentApp       string           `json:"parent_application"`
+	RanMs           uint64           `json:"ran_ms"`
+	MenuPath        []string         `json:"menu_path"`
+	MenuKind        string           `json:"menu_kind"`
+	Dialog          string           `json:"dialog"`
+	DialogKind      string           `json:"dialog_kind"`
+	DialogTitle     string           `json:"dialog_title"`
+	Message         string           `json:"message"`
+	DismissedBy     string           `json:"dismissed_by"`
+	DismissKey      string           `json:"dismiss_key"`
+	FileDialog      string           `json:"file_dialog"`
+	Paths           []string         `json:"paths"`
+	Filter          string           `json:"filter"`
+	FocusRole       string           `json:"focus_role"`
+	FocusName       string           `json:"focus_name"`
+	PreviousTitle   string           `json:"previous_title"`
+	Metadata        EventMetadata    `json:"metadata"`
+}
+
+// LoadSavedRecording reads a recording written by the recorder, or the
+// chunks a chunk manifest lists. store is the configured screenshot store,
+// looked in when the recording's own has moved; "" for none.
+func LoadSavedRecording(filename, store string) (*SavedRecording, error) {
+	var saved struct {
+		Name      string           `json:"name"`
+		StartTime uint64           `json:"start_time"`
+		EndTime   uint64           `json:"end_time"`
+		Events    []savedEvent     `json:"events"`
+		Segments  []TaskSegment    `json:"segments"`
+		Chunks    []RecordingChunk `json:"chunks"`
+		Store     string           `json:"screenshot_store"`
+	}
+	if err := LoadRecordingFile(filename, &saved); err != nil {
+		return nil, err
+	}
+	if saved.Chunks != nil {
+		return loadChunkedRecording(filename, ChunkManifest{
+			Name:      saved.Name,
+			StartTime: saved.StartTime,
+			EndTime:   saved.EndTime,
+			Chunks:    saved.Chunks,
+		})
+	}
+
+	// Moved stores are looked for where the configuration says. Without the
+	// store, e.g. in a replay sandbox, the screenshots load without images.
+	if saved.Store != "" {
+		found := &ScreenshotStore{Directory: saved.Store}
+		if _, err := os.Stat(found.Directory); err != nil && store != "" {
+			found.Directory = store
+		}
+		if _, err := os.Stat(found.Directory); err != nil {
+			logger("storage").Warn("Screenshot store not found; loading the recording without its screenshots", "store", saved.Store, "recording", filename)
+		} else if err := resolveScreenshots(found, saved.Events); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SavedRecording{
+		Name:      saved.Name,
+		StartTime: saved.StartTime,
+		EndTime:   saved.EndTime,
+		Events:    saved.Events,
+		Segments:  saved.Segments,
+	}, nil
+}
+
+// savedRecordingFromEvents builds a SavedRecording from live events by
+// round-tripping them through JSON, as if the recording had been saved
+func savedRecordingFromEvents(name string, startTime, endTime uint64, events []WorkflowEvent) (*SavedRecording, error) {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return nil, err
+	}
+
+	recording := &SavedRecording{Name: name, StartTime: startTime, EndTime: endTime}
+	if err := json.Unmarshal(data, &recording.Events); err != nil {
+		return nil, err
+	}
+	return recording, nil
+}
+
+// DurationMs returns the length of the recording
+func (r *SavedRecording) DurationMs() uint64 {
+	if r.EndTime < r.StartTime {
+		return 0
+	}
+	return r.EndTime - r.StartTime
+}
+
+// Steps describes the recording's user actions, cutting quoted text to
+// maxText runes (0 for no limit). Also returns how many texts were cut.
+func (r *SavedRecording) Steps(maxText int) ([]RecordingStep, int) {
+	var steps []RecordingStep
+	truncatedCount := 0
+
+	for i, event := range r.Events {
+		quote := func(text string) string {
+			text = strings.Join(strings.Fields(text), " ")
+			if maxText > 0 && len([]rune(text)) > maxText {
+				truncatedCount++
+				text = string([]rune(text)[:maxText]) + "…"
+			}
+			return fmt.Sprintf("%q", text)
+		}
+
+		kind, description, priority, ok := describeSavedEvent(event, quote)
+		if !ok {
+			continue
+		}
+
+		step := RecordingStep{
+			Index:       i,
+			OffsetMs:    r.offset(event.Metadata.Timestamp),
+			Kind:        kind,
+			Description: description,
+			Priority:    priority,
+		}
+		if element := event.Metadata.UIElement; element != nil {
+			step.Application = element.ApplicationName
+			step.Window = element.WindowTitle
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, truncatedCount
+}
+
+// Screenshots returns the recording's screenshots in order
+func (r *SavedRecording) Screenshots() []RecordingScreenshot {
+	var screenshots []RecordingScreenshot
+	for i, event := range r.Events {
+		if event.ImageBase64 == nil {
+			continue
+		}
+
+		screenshot := RecordingScreenshot{
+			Index:       i,
+			OffsetMs:    r.offset(event.Metadata.Timestamp),
+			ImageBase64: *event.ImageBase64,
+			ImageFormat: event.ImageFormat,
+			Width:       event.Width,
+			Height:      event.Height,
+			Trigger:     event.Trigger,
+			ScreenArea:  event.ScreenArea,
+		}
+		if event.Vision != nil {
+			screenshot.Caption = event.Vision.Caption
+		}
+		screenshots = append(screenshots, screenshot)
+	}
+	return screenshots
+}
+
+// area returns the screen x, y, width and height the screenshot covers,
+// given its decoded size. Screenshots saved without their screen area are
+// taken to be the unscaled primary display.
+func (s RecordingScreenshot) area(width, height int) [4]int32 {
+	if s.ScreenArea != nil && s.ScreenArea[2] > 0 && s.ScreenArea[3] > 0 {
+		return *s.ScreenArea
+	}
+	return [4]int32{0, 0, int32(width), int32(height)}
+}
+
+// offset converts an event timestamp to time since the recording started
+func (r *SavedRecording) offset(timestamp uint64) uint64 {
+	if timestamp < r.StartTime {
+		return 0
+	}
+	return timestamp - r.StartTime
+}
+
+// describeSavedEvent puts a user action into words. Low-level events that a
+// higher-level event already covers (pointer moves, raw keys, screenshots)
+// return false.
+func describeSavedEvent(e savedEvent, quote func(string) string) (kind, description string, priority int, ok bool) {
+	// target names the element under the pointer, if it is more than the window
+	target := func() string {
+		if element := e.Metadata.UIElement; element != nil && element.Name != "" && element.Role != "window" {
+			return fmt.Sprintf(" %s %s", element.Role, quote(element.Name))
+		}
+		return ""
+	}
+
+	switch {
+	case e.SegmentMarker != "":
+		return "SegmentMarker", "Marked " + e.SegmentMarker, StepPriorityMedium, true
+
+	case e.RecordingMarker != "":
+		if e.RecordingMarker == string(RecordingPaused) {
+			return "RecordingMarker", "Paused recording", StepPriorityMedium, true
+		}
+		return "RecordingMarker", "Resumed recording", StepPriorityMedium, true
+
+	case e.Annotation != nil:
+		if *e.Annotation == "" {
+			return "Annotation", "Marked this moment", StepPriorityHigh, true
+		}
+		return "Annotation", "Noted " + quote(*e.Annotation), StepPriorityHigh, true
+
+	case e.QuotaExceeded != "":
+		application := "the application"
+		if element := e.Metadata.UIElement; element != nil && element.ApplicationName != "" {
+			application = element.ApplicationName
+		}
+		return "QuotaMarker", fmt.Sprintf("Stopped recording %s of %s: quota %s of %d per %s reached",
+			e.QuotaKind, application, quote(e.QuotaExceeded), e.QuotaLimit, e.QuotaPeriod), StepPriorityMedium, true
+
+	case e.Rotated != "":
+		if e.PreviousFile != "" {
+			return "RecordingMarker", fmt.Sprintf("Continued from %s after its %s limit", e.PreviousFile, e.Rotated),
+				StepPriorityMedium, true
+		}
+		return "RecordingMarker", fmt.Sprintf("Reached the %s limit; continued in the next file", e.Rotated),
+			StepPriorityMedium, true
+
+	case e.Interrupted != "":
+		return "RecordingMarker", describeInterruption(e.Interrupted, e.GapMs), StepPriorityMedium, true
+
+	case e.Idle == string(IdleStart):
+		return "Idle", "Went idle", StepPriorityLow, true
+
+	case e.Idle == string(IdleEnd):
+		return "Idle", "Came back after " + FormatDuration(time.Duration(e.IdleMs)*time.Millisecond) + " idle", StepPriorityLow, true
+
+	case e.Recovered != "":
+		return "RecordingMarker", fmt.Sprintf("Restarted the recorder's %s after it made no progress for %s; events may be missing",
+			strings.ReplaceAll(e.Recovered, "_", " "), FormatDuration(time.Duration(e.StalledMs)*time.Millisecond)), StepPriorityMedium, true
+
+	case e.Bookmark != nil:
+		return "Bookmark", describeBookmark(*e.Bookmark, e.Source, e.Reference, quote), StepPriorityMedium, true
+
+	case e.Fullscreen != nil:
+		return "Fullscreen", describeFullscreen(*e.Fullscreen, e.Application), StepPriorityLow, true
+
+	case e.WindowChange != "":
+		return "WindowLayout", describeWindowChange(e.WindowChange, e.WindowTitle, e.After, quote), StepPriorityLow, true
+
+	case e.FileActivity != "":
+		return "File", describeFileActivity(e.FileActivity, e.Path, e.PreviousPath, quote), StepPriorityMedium, true
+
+	case e.Process != "":
+		return "AppLifecycle", describeProcess(e.Process, e.Application, e.ParentApp, e.RanMs), StepPriorityMedium, true
+
+	case e.MenuPath != nil:
+		return "Menu", describeMenuSelection(e.MenuPath, e.MenuKind, e.Application, quote), StepPriorityHigh, true
+
+	case e.Dialog == DialogOpened:
+		return "Dialog", describeDialog(e.Dialog, e.DialogKind, e.DialogTitle, e.Message, "", "", e.Application, quote), StepPriorityMedium, true
+
+	case e.Dialog == DialogClosed:
+		return "Dialog", describeDialog(e.Dialog, e.DialogKind, e.DialogTitle, "", e.DismissedBy, e.DismissKey, e.Application, quote), StepPriorityHigh, true
+
+	case e.FileDialog != "":
+		return "File", describeFileDialog(e.FileDialog, e.Paths, e.Filter, quote), StepPriorityHigh, true
+
+	case e.FocusRole != "":
+		return "Focus", describeFocusChange(e.FocusRole, e.FocusName, e.Application, quote), StepPriorityLow, true
+
+	case e.PreviousTitle != "":
+		return "WindowTitle", describeWindowTitleChange(e.PreviousTitle, e.WindowTitle, e.Application, quote), StepPriorityLow, true
+
+	case e.CDPEvent != "":
+		switch e.CDPEvent {
+		case CDPElementClicked:
+			description = "Clicked " + e.Selector
+			if e.ElementText != "" {
+				description += " " + quote(e.ElementText)
+			}
+			return "BrowserClick", description, StepPriorityHigh, true
+		case CDPFormSubmitted:
+			return "FormSubmit", "Submitted form " + e.Selector, StepPriorityHigh, true
+		case CDPNavigation:
+			return "Navigation", "Navigated to " + e.URL, StepPriorityHigh, true
+		case CDPTabCreated:
+			return "Tab", "Opened tab " + e.URL, StepPriorityMedium, true
+		default:
+			return "Tab", "Closed tab " + e.URL, StepPriorityMedium, true
+		}
+
+	case e.Command != nil:
+		description = "Ran " + quote(*e.Command)
+		if !e.Complete {
+			description += " (as typed; history or completion may have changed it)"
+		}
+		if element := e.Metadata.UIElement; element != nil && element.ApplicationName != "" {
+			description += " in " + element.ApplicationName
+		}
+		return "Command", description, StepPriorityHigh, true
+
+	case e.TextValue != nil:
+		description = "Typed " + quote(*e.TextValue)
+		if e.FieldName != "" {
+			description += " into " + quote(e.FieldName)
+		}
+		return "TextInput", description, StepPriorityHigh, true
+
+	case e.Browser != nil:
+		if e.ToURL == "" {
+			return "", "", 0, false
+		}
+		description = "Navigated to " + e.ToURL
+		if e.Action == string(TabSwitched) {
+			description = "Switched to tab " + e.ToURL
+		}
+		if e.ToTitle != "" {
+			description += " (" + quote(e.ToTitle) + ")"
+		}
+		return "Navigation", description, StepPriorityHigh, true
+
+	case e.ButtonText != nil:
+		if *e.ButtonText == "" {
+			return "Click", "Clicked" + target(), StepPriorityLow, true
+		}
+		return "ButtonClick", "Clicked button " + quote(*e.ButtonText), StepPriorityHigh, true
+
+	case e.ImageBase64 != nil:
+		return "", "", 0, false
+
+	case e.ToApplication != nil:
+		return "AppSwitch", "Switched to " + *e.ToApplication, StepPriorityMedium, true
+
+	case e.Combination != nil:
+		description = "Pressed " + *e.Combination
+		if e.Action != "" {
+			description += " (" + e.Action + ")"
+		}
+		return "Hotkey", description, StepPriorityHigh, true
+
+	case e.SelectedText != nil:
+		return "Selection", "Selected " + quote(*e.SelectedText), StepPriorityLow, true
+
+	case e.ContentSize != nil:
+		return "Clipboard", e.Action + " " + quote(e.Content), StepPriorityMedium, true
+
+	case e.Success != nil:
+		description = "Dragged"
+		if e.Content != "" {
+			description += " " + quote(e.Content)
+		}
+		if e.StartPosition != nil && e.EndPosition != nil {
+			description += fmt.Sprintf(" from (%d, %d) to (%d, %d)",
+				e.StartPosition.X, e.StartPosition.Y, e.EndPosition.X, e.EndPosition.Y)
+		}
+		return "DragDrop", description, StepPriorityMedium, true
+
+	case e.KeyCode != nil:
+		return "", "", 0, false
+
+	case e.EventType != "":
+		switch MouseEventType(e.EventType) {
+		case MouseClick, MouseDoubleClick, MouseRightClick:
+			description = map[MouseEventType]string{
+				MouseClick:       "Clicked",
+				MouseDoubleClick: "Double-clicked",
+				MouseRightClick:  "Right-clicked",
+			}[MouseEventType(e.EventType)]
+			if name := target(); name != "" {
+				description += name
+			} else if e.Position != nil {
+				description += fmt.Sprintf(" at (%d, %d)", e.Position.X, e.Position.Y)
+			}
+			return "Click", description, StepPriorityLow, true
+		case MouseDrag:
+			description = "Dragged the mouse"
+			if e.DragStart != nil && e.Position != nil {
+				description += fmt.Sprintf(" from (%d, %d) to (%d, %d)",
+					e.DragStart.X, e.DragStart.Y, e.Position.X, e.Position.Y)
+			}
+			return "Drag", description, StepPriorityLow, true
+		}
+	}
+
+	return "", "", 0, false
+}
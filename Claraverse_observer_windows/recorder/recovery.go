@@ -0,0 +1,131 @@
+package recorder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Crash recovery. A recorder that dies before saving leaves its autosave, or
+// its chunks, with a manifest not marked complete. The next start points them
+// out, and with --recover stitches each into a recording file,
+// ui_recording_enhanced_<start>_recovered.json, holding every event flushed
+// before the crash. A recovered autosave is then removed; recovered chunks
+// stay, with their manifest completed and naming the recovered file.
+
+// unfinishedRecordings returns the manifests in directory of recordings that
+// were never finished, oldest first
+func unfinishedRecordings(directory string) []string {
+	if directory == "" {
+		directory = "."
+	}
+	var manifests []string
+	for _, suffix := range []string{autosaveDirectorySuffix, chunkDirectorySuffix} {
+		matches, _ := filepath.Glob(filepath.Join(directory, "ui_recording_enhanced_*"+suffix, chunkManifestName))
+		for _, manifestFile := range matches {
+			var manifest ChunkManifest
+			if LoadJSONFromFile(manifestFile, &manifest) == nil && !manifest.Complete {
+				manifests = append(manifests, manifestFile)
+			}
+		}
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return filepath.Base(filepath.Dir(manifests[i])) < filepath.Base(filepath.Dir(manifests[j]))
+	})
+	return manifests
+}
+
+// recoverRecording stitches the chunks an unfinished manifest lists into a
+// recording file. Returns the file and its event count; no file is written
+// when no events were flushed.
+func recoverRecording(manifestFile string) (string, int, error) {
+	var manifest ChunkManifest
+	if err := LoadJSONFromFile(manifestFile, &manifest); err != nil {
+		return "", 0, err
+	}
+	directory := filepath.Dir(manifestFile)
+
+	workflow, err := loadFlushedWorkflow(directory, manifest)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var filename string
+	if len(workflow.Events) > 0 {
+		base := strings.TrimSuffix(strings.TrimSuffix(directory, autosaveDirectorySuffix), chunkDirectorySuffix)
+		filename = base + "_recovered.json"
+		if err := SaveJSONToFile(workflow, filename); err != nil {
+			return "", 0, err
+		}
+	}
+
+	if manifest.Autosave {
+		if err := os.RemoveAll(directory); err != nil {
+			return filename, len(workflow.Events), NewWorkflowError(ErrorTypeFileIO, "Failed to remove the recovered autosave", err)
+		}
+		return filename, len(workflow.Events), nil
+	}
+	manifest.EndTime = workflow.EndTime
+	manifest.Complete = true
+	if filename != "" {
+		if relative, err := filepath.Rel(directory, filename); err == nil {
+			manifest.Recording = filepath.ToSlash(relative)
+		}
+	}
+	writer := &ChunkWriter{Directory: directory, Manifest: manifest}
+	return filename, len(workflow.Events), writer.saveManifest()
+}
+
+// loadFlushedWorkflow reads the events a manifest's chunks hold into a
+// workflow. Events are kept raw, so they are saved exactly as flushed.
+func loadFlushedWorkflow(directory string, manifest ChunkManifest) (*RecordedWorkflow, error) {
+	workflow := &RecordedWorkflow{
+		SchemaVersion: SchemaVersion,
+		Name:          manifest.Name,
+		StartTime:     manifest.StartTime,
+		EndTime:       manifest.StartTime,
+		Events:        []WorkflowEvent{},
+		TypeSizes:     make(map[string]int64),
+	}
+	for _, chunk := range manifest.Chunks {
+		var content struct {
+			EndTime uint64            `json:"end_time"`
+			Events  []json.RawMessage `json:"events"`
+		}
+		if err := LoadRecordingFile(filepath.Join(directory, filepath.FromSlash(chunk.File)), &content); err != nil {
+			return nil, err
+		}
+		for _, event := range content.Events {
+			workflow.Events = append(workflow.Events, event)
+			workflow.Size += int64(len(event))
+			workflow.TypeSizes[rawEventType(event)] += int64(len(event))
+		}
+		workflow.EndTime = max(workflow.EndTime, content.EndTime)
+		workflow.LastSequence = max(workflow.LastSequence, chunk.LastSequence)
+	}
+	return workflow, nil
+}
+
+// recoverUnfinishedRecordings recovers the recordings of unfinished
+// manifests when recoverAll is set, and otherwise says how to
+func recoverUnfinishedRecordings(manifests []string, recoverAll bool) {
+	if len(manifests) == 0 {
+		return
+	}
+	if !recoverAll {
+		printConsole(Msg(MsgUnfinished, len(manifests)))
+		return
+	}
+	for _, manifestFile := range manifests {
+		filename, events, err := recoverRecording(manifestFile)
+		if err != nil {
+			logger("recovery").Error("Failed to recover recording", "directory", filepath.Dir(manifestFile), "error", err)
+			continue
+		}
+		if filename != "" {
+			printConsole(Msg(MsgRecovered, events, filename))
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Replaying recordings. The Player turns a saved recording's clicks, drags,
+// completed text input and hotkeys back into input, keeping the recorded
+// pace (scaled by Speed) but cutting idle gaps to MaxGap. Pointer moves, raw
+// keys and clipboard contents are not replayed, nor are recorder hotkeys, so
+// a replay never adds markers to a recording made of it. Clicks go to where
+// their recorded element is now (see element_selectors.go). --verify checks
+// each step against the recording as it goes (see replay_verify.go).
+
+const (
+	replayMaxGap     = 5 * time.Second
+	replayStartDelay = 3 * time.Second
+)
+
+// ReplayAction is an input action of a recording that can be played back
+type ReplayAction struct {
+	Index       int    // Position among the recording's events
+	OffsetMs    uint64 // Time since the recording started
+	Type        string // click, double_click, right_click, drag, type or hotkey
+	Position    Position
+	EndPosition Position // Where a drag ends
+	Text        string
+	Keys        []uint32         // Virtual keys of a hotkey, modifiers first
+	Selector    *ElementSelector // Recorded target of a click, looked up again before it is replayed
+	Description string
+}
+
+// ReplayResult is the outcome of a replay, written with --result
+type ReplayResult struct {
+	Recording      string             `json:"recording"`
+	StartedAt      string             `json:"started_at"`
+	FinishedAt     string             `json:"finished_at"`
+	Steps          int                `json:"steps"`
+	CompletedSteps int                `json:"completed_steps"`
+	Success        bool               `json:"success"`
+	Error          string             `json:"error,omitempty"`
+	Verified       bool               `json:"verified,omitempty"`    // Checked against the recording step by step
+	Divergences    []ReplayDivergence `json:"divergences,omitempty"` // Where it was not as recorded
+	Located        map[string]int     `json:"located,omitempty"`     // Clicks by how their target was found
+	Screenshot     string             `json:"screenshot,omitempty"`  // Image of the screen when the replay ended, beside the result
+}
+
+// Player plays recorded actions back
+type Player struct {
+	Speed  float64       // 2 plays twice as fast as recorded
+	MaxGap time.Duration // Longest wait between two actions
+}
+
+// NewPlayer creates a player at speed
+func NewPlayer(speed float64) *Player {
+	return &Player{Speed: speed, MaxGap: replayMaxGap}
+}
+
+// replayActions lists the actions of a recording that can be played back
+func replayActions(recording *SavedRecording) []ReplayAction {
+	quote := func(text string) string { return fmt.Sprintf("%q", text) }
+
+	var actions []ReplayAction
+	for i, event := range recording.Events {
+		action := ReplayAction{Index: i, OffsetMs: recording.offset(event.Metadata.Timestamp)}
+
+		switch {
+		case event.Redacted:
+			// Password text was never recorded, so it cannot be typed again
+			continue
+
+		case event.Success != nil:
+			// Drags are replayed from the drag-and-drop event, which has both ends
+			if event.StartPosition == nil || event.EndPosition == nil {
+				continue
+			}
+			action.Type, action.Position, action.EndPosition = "drag", *event.StartPosition, *event.EndPosition
+
+		case event.Combination != nil:
+			if isRecorderHotkeyAction(event.Action) {
+				continue
+			}
+			var steps [][]uint32
+			for _, step := range strings.Fields(*event.Combination) {
+				keys, err := parseKeyCombination(step)
+				if err != nil {
+					steps = nil
+					break
+				}
+				steps = append(steps, keys)
+			}
+			if len(steps) == 0 {
+				continue
+			}
+			// A chord is played one combination at a time
+			for j, keys := range steps[:len(steps)-1] {
+				step := action
+				step.Type, step.Keys = "hotkey", keys
+				step.Description = "Pressed " + strings.Fields(*event.Combination)[j]
+				actions = append(actions, step)
+			}
+			action.Type, action.Keys = "hotkey", steps[len(steps)-1]
+
+		default:
+			recorded, start, _, ok := datasetAction(event)
+			if !ok || recorded.Type == "drag" {
+				continue
+			}
+			action.Type, action.Text = recorded.Type, recorded.Text
+			if start != nil {
+				action.Position = *start
+			}
+			action.Selector = event.ElementSelector
+		}
+
+		action.Description = action.Type
+		if _, description, _, ok := describeSavedEvent(event, quote); ok {
+			action.Description = description
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// isRecorderHotkeyAction reports whether a hotkey controls the recorder
+// rather than the application being recorded
+func isRecorderHotkeyAction(action string) bool {
+	switch action {
+	case HotkeyActionSegmentStart, HotkeyActionSegmentEnd, HotkeyActionUndoMarker, HotkeyActionAnnotate:
+		return true
+	}
+	return false
+}
+
+// Play performs actions in order, waiting between them as recorded
+func (p *Player) Play(actions []ReplayAction, perform func(ReplayAction) error) error {
+	for i, action := range actions {
+		if i > 0 && action.OffsetMs > actions[i-1].OffsetMs {
+			time.Sleep(p.delay(action.OffsetMs - actions[i-1].OffsetMs))
+		}
+
+		fmt.Println(Msg(MsgReplayStep, i+1, len(actions), action.Description))
+		if err := perform(action); err != nil {
+			return NewWorkflowError(ErrorTypeSystem,
+				fmt.Sprintf("Replay stopped at step %d (%s)", i+1, action.Description), err)
+		}
+	}
+	return nil
+}
+
+// delay is how long to wait for a recorded gap of gapMs
+func (p *Player) delay(gapMs uint64) time.Duration {
+	delay := time.Duration(gapMs) * time.Millisecond
+	if p.Speed > 0 {
+		delay = time.Duration(float64(delay) / p.Speed)
+	}
+	if p.MaxGap > 0 && delay > p.MaxGap {
+		delay = p.MaxGap
+	}
+	return delay
+}
+
+// performReplayAction simulates an action's input
+func performReplayAction(action ReplayAction) error {
+	switch action.Type {
+	case "click":
+		return SimulateMouseClick(action.Position, MouseButtonLeft, false)
+	case "double_click":
+		return SimulateMouseClick(action.Position, MouseButtonLeft, true)
+	case "right_click":
+		return SimulateMouseClick(action.Position, MouseButtonRight, false)
+	case "drag":
+		return SimulateMouseDrag(action.Position, action.EndPosition)
+	case "type":
+		return SimulateTextInput(action.Text)
+	case "hotkey":
+		last := len(action.Keys) - 1
+		return SimulateKeyPress(action.Keys[last], action.Keys[:last]...)
+	default:
+		return NewWorkflowError(ErrorTypeSystem, fmt.Sprintf("Cannot replay %s actions", action.Type), nil)
+	}
+}
+
+// runReplay replays a recording with recorder's configuration and
+// screenshots and, when resultFile is set, writes how it went there along
+// with a screenshot of where it ended. With verify, each step is checked
+// against the recording and divergences fail the replay.
+func runReplay(recorder *Recorder, filename string, speed float64, resultFile string, verify bool) error {
+	recording, err := LoadSavedRecording(filename, recorder.currentConfig().ScreenshotStore)
+	if err != nil {
+		return err
+	}
+	actions := replayActions(recording)
+	fmt.Println(Msg(MsgReplayStarting, len(actions), replayStartDelay.Seconds()))
+	time.Sleep(replayStartDelay)
+
+	result := ReplayResult{
+		Recording: filepath.Base(filename),
+		StartedAt: time.Now().Format(time.RFC3339),
+		Steps:     len(actions),
+		Verified:  verify,
+	}
+	var verifier *ReplayVerifier
+	if verify {
+		verifier = NewReplayVerifier(recording, actions, recorder.Screenshots)
+	}
+	var performedAt time.Time
+	replayErr := NewPlayer(speed).Play(actions, func(action ReplayAction) error {
+		// A step is checked just before the next, once the screen has settled
+		if verifier != nil && result.CompletedSteps > 0 {
+			verifier.Verify(result.CompletedSteps-1, performedAt)
+		}
+		if action.Selector != nil {
+			var locatedBy string
+			action, locatedBy = locateReplayAction(action)
+			if result.Located == nil {
+				result.Located = make(map[string]int)
+			}
+			result.Located[locatedBy]++
+		}
+		if err := performReplayAction(action); err != nil {
+			return err
+		}
+		performedAt = time.Now()
+		result.CompletedSteps++
+		return nil
+	})
+	if verifier != nil {
+		if replayErr == nil && len(actions) > 0 {
+			verifier.Verify(len(actions)-1, performedAt)
+		}
+		result.Divergences = verifier.Divergences
+		if replayErr == nil && len(verifier.Divergences) > 0 {
+			replayErr = NewWorkflowError(ErrorTypeSystem, fmt.Sprintf("Replay diverged from the recording at %d of %d steps",
+				verifier.DivergedSteps(), len(actions)), nil)
+		}
+	}
+	result.FinishedAt = time.Now().Format(time.RFC3339)
+	result.Success = replayErr == nil
+	if replayErr != nil {
+		result.Error = replayErr.Error()
+	}
+
+	if resultFile != "" {
+		if err := writeReplayResult(result, resultFile, recorder.Screenshots); err != nil {
+			return err
+		}
+	}
+	if replayErr != nil {
+		return replayErr
+	}
+	if verify {
+		fmt.Println(Msg(MsgReplayVerified, len(actions)))
+	} else {
+		fmt.Println(Msg(MsgReplayFinished))
+	}
+	return nil
+}
+
+// writeReplayResult saves a screenshot taken through screenshots beside
+// resultFile, then the result. The result is written last and renamed into
+// place, so whoever waits for it finds the whole bundle once it appears.
+func writeReplayResult(result ReplayResult, resultFile string, screenshots *ScreenshotService) error {
+	if shot := screenshots.CaptureNow(ScreenshotTriggerManual, "png"); shot != nil {
+		if data, err := base64.StdEncoding.DecodeString(shot.ImageBase64); err == nil {
+			name := "screen." + shot.ImageFormat
+			if err := EnsureDirectoryExists(filepath.Dir(resultFile)); err != nil {
+				return NewWorkflowError(ErrorTypeFileIO, "Failed to create directory", err)
+			}
+			if err := os.WriteFile(filepath.Join(filepath.Dir(resultFile), name), data, 0644); err == nil {
+				result.Screenshot = name
+			}
+		}
+	}
+
+	partial := resultFile + ".partial"
+	if err := SaveJSONToFile(result, partial); err != nil {
+		return err
+	}
+	if err := os.Rename(partial, resultFile); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write replay result", err)
+	}
+	return nil
+}
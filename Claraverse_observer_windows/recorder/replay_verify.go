@@ -0,0 +1,229 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/kbinani/screenshot"
+)
+
+// Replay verification. replay --verify checks, before each next step and
+// after the last, that the screen shows what the recording saw at that
+// point: the foreground application, its window title, the page URL and,
+// where the recording has a screenshot from then, the screen itself by a
+// difference hash that tolerates small changes such as a clock ticking over.
+// Divergences are reported step by step and fail the replay, so a recording
+// doubles as a regression test of the task it shows.
+
+const (
+	replayVerifySettle     = 750 * time.Millisecond // Least wait after a step before checking it
+	replayScreenTolerance  = 10                     // Bits of 64 two screen hashes may differ by
+	replayScreenHashWidth  = 9
+	replayScreenHashHeight = 8
+	replayScreenSamples    = 4 // Samples across each hash cell, each way
+)
+
+// ReplayState is what the recording saw after a step, or what the screen
+// shows when the replay checks it
+type ReplayState struct {
+	Application string
+	WindowTitle string
+	URL         string
+	ScreenHash  uint64
+	ScreenArea  [4]int32 // Screen x, y, width and height the hash covers
+	HasScreen   bool
+}
+
+// ReplayDivergence is a way the replay differed from the recording
+type ReplayDivergence struct {
+	Step        int    `json:"step"` // From 1
+	Description string `json:"description"`
+	Check       string `json:"check"` // application, window_title, url or screen
+	Expected    string `json:"expected"`
+	Actual      string `json:"actual"`
+}
+
+// ReplayVerifier compares the screen with the recording step by step
+type ReplayVerifier struct {
+	Actions     []ReplayAction
+	Expected    []ReplayState // One per action
+	Divergences []ReplayDivergence
+	Observe     func(screen bool) ReplayState // Reads the screen; it is hashed only when screen is set
+}
+
+// NewReplayVerifier creates a verifier for a recording's actions that reads
+// the real screen through screenshots, or only the foreground window when
+// nil
+func NewReplayVerifier(recording *SavedRecording, actions []ReplayAction, screenshots *ScreenshotService) *ReplayVerifier {
+	return &ReplayVerifier{
+		Actions:  actions,
+		Expected: replayExpectations(recording, actions),
+		Observe:  func(screen bool) ReplayState { return observeReplayScreen(screenshots, screen) },
+	}
+}
+
+// replayExpectations works out what the recording saw after each action:
+// the last window seen before the next action, or by the next action itself,
+// and the last screenshot taken before it
+func replayExpectations(recording *SavedRecording, actions []ReplayAction) []ReplayState {
+	expectations := make([]ReplayState, len(actions))
+	for i, action := range actions {
+		end := len(recording.Events)
+		if i+1 < len(actions) {
+			end = actions[i+1].Index
+		}
+
+		expected := &expectations[i]
+		var element *UIElement
+		for _, event := range recording.Events[action.Index+1 : end] {
+			if event.Metadata.UIElement != nil {
+				element = event.Metadata.UIElement
+			}
+			if event.ImageBase64 == nil || *event.ImageBase64 == "" {
+				continue
+			}
+			if hash, area, err := decodeScreenHash(*event.ImageBase64, event.ScreenArea); err == nil {
+				expected.ScreenHash, expected.ScreenArea, expected.HasScreen = hash, area, true
+			}
+		}
+		if element == nil && end < len(recording.Events) {
+			element = recording.Events[end].Metadata.UIElement
+		}
+		if element != nil {
+			expected.Application, expected.WindowTitle, expected.URL = element.ApplicationName, element.WindowTitle, element.URL
+		}
+	}
+	return expectations
+}
+
+// Verify checks the screen after the step at index, performed at
+// performedAt, and reports how it differs from the recording
+func (v *ReplayVerifier) Verify(index int, performedAt time.Time) []ReplayDivergence {
+	time.Sleep(time.Until(performedAt.Add(replayVerifySettle)))
+
+	expected := v.Expected[index]
+	divergences := compareReplayState(index, v.Actions[index], expected, v.Observe(expected.HasScreen))
+	for _, divergence := range divergences {
+		fmt.Println(Msg(MsgReplayDivergence, divergence.Step, divergence.Check, divergence.Actual, divergence.Expected))
+	}
+	v.Divergences = append(v.Divergences, divergences...)
+	return divergences
+}
+
+// DivergedSteps counts the steps with divergences
+func (v *ReplayVerifier) DivergedSteps() int {
+	steps := make(map[int]bool)
+	for _, divergence := range v.Divergences {
+		steps[divergence.Step] = true
+	}
+	return len(steps)
+}
+
+// compareReplayState compares what the screen showed after a step with what
+// the recording saw. What the recording did not see is not checked.
+func compareReplayState(index int, action ReplayAction, expected, observed ReplayState) []ReplayDivergence {
+	var divergences []ReplayDivergence
+	diverge := func(check, expectedValue, actualValue string) {
+		divergences = append(divergences, ReplayDivergence{
+			Step:        index + 1,
+			Description: action.Description,
+			Check:       check,
+			Expected:    expectedValue,
+			Actual:      actualValue,
+		})
+	}
+
+	if expected.Application != "" && expected.Application != "Unknown" &&
+		!strings.EqualFold(expected.Application, observed.Application) {
+		diverge("application", expected.Application, observed.Application)
+	}
+	if expected.WindowTitle != "" && strings.TrimSpace(expected.WindowTitle) != strings.TrimSpace(observed.WindowTitle) {
+		diverge("window_title", expected.WindowTitle, observed.WindowTitle)
+	}
+	if expected.URL != "" && expected.URL != observed.URL {
+		diverge("url", expected.URL, observed.URL)
+	}
+	// Screens of another area, e.g. a different display, cannot be compared
+	if expected.HasScreen && observed.HasScreen && expected.ScreenArea == observed.ScreenArea {
+		if differing := bits.OnesCount64(expected.ScreenHash ^ observed.ScreenHash); differing > replayScreenTolerance {
+			diverge("screen", fmt.Sprintf("%016x", expected.ScreenHash),
+				fmt.Sprintf("%016x (%d of 64 bits differ)", observed.ScreenHash, differing))
+		}
+	}
+	return divergences
+}
+
+// screenHash is a difference hash of an image: each bit tells whether a
+// cell of a 9x8 grid is brighter than the cell to its right. Scaling and
+// small changes leave it mostly as it is.
+func screenHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return 0
+	}
+	columns, rows := replayScreenHashWidth*replayScreenSamples, replayScreenHashHeight*replayScreenSamples
+
+	var cells [replayScreenHashHeight][replayScreenHashWidth]uint32
+	for row := 0; row < rows; row++ {
+		y := bounds.Min.Y + (2*row+1)*bounds.Dy()/(2*rows)
+		for column := 0; column < columns; column++ {
+			x := bounds.Min.X + (2*column+1)*bounds.Dx()/(2*columns)
+			r, g, b, _ := img.At(x, y).RGBA()
+			cells[row/replayScreenSamples][column/replayScreenSamples] += (299*r + 587*g + 114*b) / 1000 >> 8
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < replayScreenHashHeight; y++ {
+		for x := 0; x < replayScreenHashWidth-1; x++ {
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1 << (y*(replayScreenHashWidth-1) + x)
+			}
+		}
+	}
+	return hash
+}
+
+// decodeScreenHash hashes a recorded screenshot and returns the screen area
+// it covers
+func decodeScreenHash(imageBase64 string, screenArea *[4]int32) (uint64, [4]int32, error) {
+	data, err := base64.StdEncoding.DecodeString(imageBase64)
+	if err != nil {
+		return 0, [4]int32{}, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, [4]int32{}, err
+	}
+	area := RecordingScreenshot{ScreenArea: screenArea}.area(img.Bounds().Dx(), img.Bounds().Dy())
+	return screenHash(img), area, nil
+}
+
+// observeReplayScreen reads the foreground window and, when screen is set,
+// hashes the primary display as screenshots captures it
+func observeReplayScreen(screenshots *ScreenshotService, screen bool) ReplayState {
+	windowTitle, processID := getCurrentWindow()
+	observed := ReplayState{
+		Application: applicationName(processID, windowTitle),
+		WindowTitle: windowTitle,
+		URL:         getCurrentURL(),
+	}
+	if !screen || screenshots == nil {
+		return observed
+	}
+
+	bounds := screenshot.GetDisplayBounds(0)
+	img, _, _, err := screenshots.captureScreen(bounds)
+	if err != nil {
+		return observed
+	}
+	defer releaseFrameBuffer(img)
+	observed.ScreenHash, observed.HasScreen = screenHash(img), true
+	observed.ScreenArea = [4]int32{int32(bounds.Min.X), int32(bounds.Min.Y), int32(bounds.Dx()), int32(bounds.Dy())}
+	return observed
+}
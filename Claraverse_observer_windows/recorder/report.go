@@ -0,0 +1,265 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Human-readable reports of a saved recording, for documentation and
+// standard operating procedures. Steps are grouped by detected task, timed
+// from the start of the recording, and shown with the screenshots taken
+// along the way.
+
+// ReportFormat is the document format of a report
+type ReportFormat string
+
+const (
+	ReportFormatHTML     ReportFormat = "html"
+	ReportFormatMarkdown ReportFormat = "markdown"
+)
+
+// reportSection is one detected task of a report
+type reportSection struct {
+	Title   string
+	Detail  string
+	Entries []reportEntry
+}
+
+// reportEntry is a step or a screenshot, in recording order
+type reportEntry struct {
+	Step       *RecordingStep
+	Screenshot *RecordingScreenshot
+	Number     int // Step number across the whole report
+}
+
+// buildReportSections groups steps and screenshots by the recording's task
+// segments, or into a single section when it has none
+func buildReportSections(recording *SavedRecording) []reportSection {
+	steps, _ := recording.Steps(0)
+	screenshots := recording.Screenshots()
+
+	var sections []reportSection
+	for _, segment := range recording.Segments {
+		sections = append(sections, reportSection{
+			Title: segment.Title,
+			Detail: Msg(MsgReportSegmentDetail,
+				formatReportOffset(recording.offset(segment.StartTime)),
+				formatReportOffset(recording.offset(segment.EndTime)),
+				strings.ReplaceAll(segment.EndReason, "_", " ")),
+		})
+	}
+	if len(sections) == 0 {
+		sections = []reportSection{{Title: Msg(MsgReportSteps)}}
+	}
+
+	// sectionOf finds the segment an event belongs to; anything past the
+	// last segment goes into it
+	sectionOf := func(index int) *reportSection {
+		for i, segment := range recording.Segments {
+			if index <= segment.LastEvent {
+				return &sections[i]
+			}
+		}
+		return &sections[len(sections)-1]
+	}
+
+	number := 0
+	for len(steps) > 0 || len(screenshots) > 0 {
+		if len(screenshots) == 0 || (len(steps) > 0 && steps[0].Index < screenshots[0].Index) {
+			number++
+			section := sectionOf(steps[0].Index)
+			section.Entries = append(section.Entries, reportEntry{Step: &steps[0], Number: number})
+			steps = steps[1:]
+		} else {
+			section := sectionOf(screenshots[0].Index)
+			section.Entries = append(section.Entries, reportEntry{Screenshot: &screenshots[0]})
+			screenshots = screenshots[1:]
+		}
+	}
+
+	return sections
+}
+
+// renderReport writes recording as a document in format. imageSource returns
+// the link or data URI a screenshot is shown from.
+func renderReport(recording *SavedRecording, format ReportFormat, imageSource func(RecordingScreenshot) (string, error)) (string, error) {
+	sections := buildReportSections(recording)
+
+	stepCount, screenshotCount := 0, 0
+	for _, section := range sections {
+		for _, entry := range section.Entries {
+			if entry.Step != nil {
+				stepCount++
+			} else {
+				screenshotCount++
+			}
+		}
+	}
+	summary := []string{
+		Msg(MsgReportRecorded, time.UnixMilli(int64(recording.StartTime)).Format("2006-01-02 15:04:05")),
+		Msg(MsgReportDuration, FormatDuration(time.Duration(recording.DurationMs())*time.Millisecond)),
+		Msg(MsgReportCounts, stepCount, screenshotCount),
+	}
+
+	var b strings.Builder
+	switch format {
+	case ReportFormatMarkdown:
+		fmt.Fprintf(&b, "# %s\n\n", markdownText(recording.Name))
+		for _, line := range summary {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+		for _, section := range sections {
+			fmt.Fprintf(&b, "\n## %s\n\n", markdownText(section.Title))
+			if section.Detail != "" {
+				fmt.Fprintf(&b, "_%s_\n\n", markdownText(section.Detail))
+			}
+			for _, entry := range section.Entries {
+				if entry.Step != nil {
+					fmt.Fprintf(&b, "%d. `%s` %s%s\n", entry.Number, formatReportOffset(entry.Step.OffsetMs),
+						markdownText(entry.Step.Description), markdownText(reportApplication(entry.Step.Application)))
+					continue
+				}
+				source, err := imageSource(*entry.Screenshot)
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&b, "\n   ![%s](%s)\n\n", markdownText(screenshotAltText(*entry.Screenshot)), source)
+			}
+		}
+
+	case ReportFormatHTML:
+		b.WriteString("<!DOCTYPE html>\n<html lang=\"" + activeLocale + "\">\n<head>\n<meta charset=\"utf-8\">\n")
+		fmt.Fprintf(&b, "<title>%s</title>\n", html.EscapeString(recording.Name))
+		b.WriteString("<style>\n" +
+			"body { font-family: sans-serif; max-width: 960px; margin: 2em auto; color: #222; }\n" +
+			".detail, .time, .app { color: #666; }\n" +
+			".time { font-family: monospace; margin-right: 0.5em; }\n" +
+			"figure { margin: 0.5em 0 1em; }\n" +
+			"figure img { max-width: 100%; border: 1px solid #ccc; }\n" +
+			"figcaption { color: #666; font-size: 0.9em; }\n" +
+			"</style>\n</head>\n<body>\n")
+		fmt.Fprintf(&b, "<h1>%s</h1>\n<ul>\n", html.EscapeString(recording.Name))
+		for _, line := range summary {
+			fmt.Fprintf(&b, "<li>%s</li>\n", html.EscapeString(line))
+		}
+		b.WriteString("</ul>\n")
+		for _, section := range sections {
+			fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(section.Title))
+			if section.Detail != "" {
+				fmt.Fprintf(&b, "<p class=\"detail\">%s</p>\n", html.EscapeString(section.Detail))
+			}
+			b.WriteString("<ol>\n")
+			for _, entry := range section.Entries {
+				if entry.Step != nil {
+					fmt.Fprintf(&b, "<li value=\"%d\"><span class=\"time\">%s</span>%s<span class=\"app\">%s</span></li>\n",
+						entry.Number, formatReportOffset(entry.Step.OffsetMs),
+						html.EscapeString(entry.Step.Description), html.EscapeString(reportApplication(entry.Step.Application)))
+					continue
+				}
+				source, err := imageSource(*entry.Screenshot)
+				if err != nil {
+					return "", err
+				}
+				alt := screenshotAltText(*entry.Screenshot)
+				fmt.Fprintf(&b, "<figure><img src=\"%s\" alt=\"%s\"><figcaption>%s</figcaption></figure>\n",
+					html.EscapeString(source), html.EscapeString(alt), html.EscapeString(alt))
+			}
+			b.WriteString("</ol>\n")
+		}
+		b.WriteString("</body>\n</html>\n")
+
+	default:
+		return "", NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Unknown report format %q (use html or markdown)", format), nil)
+	}
+
+	return b.String(), nil
+}
+
+// formatReportOffset formats time since the recording started as m:ss.s
+func formatReportOffset(offsetMs uint64) string {
+	return fmt.Sprintf("%d:%04.1f", offsetMs/60000, float64(offsetMs%60000)/1000)
+}
+
+// reportApplication is the application suffix of a step line
+func reportApplication(application string) string {
+	if application == "" {
+		return ""
+	}
+	return " — " + application
+}
+
+// screenshotAltText describes a screenshot by its caption, or by when and
+// why it was taken
+func screenshotAltText(screenshot RecordingScreenshot) string {
+	if screenshot.Caption != "" {
+		return screenshot.Caption
+	}
+	text := Msg(MsgReportScreenshotAt, formatReportOffset(screenshot.OffsetMs))
+	if screenshot.Trigger != "" {
+		text += " (" + strings.ReplaceAll(screenshot.Trigger, "_", " ") + ")"
+	}
+	return text
+}
+
+// markdownText escapes the characters Markdown would treat as formatting
+func markdownText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+		"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`,
+	).Replace(s)
+}
+
+// screenshotDataURI embeds a screenshot in the document itself
+func screenshotDataURI(screenshot RecordingScreenshot) (string, error) {
+	return fmt.Sprintf("data:image/%s;base64,%s", screenshot.ImageFormat, screenshot.ImageBase64), nil
+}
+
+// exportRecordingReport writes a saved recording as a report next to it,
+// named <base>_report.html or <base>_report.md, and returns the file
+// written. HTML reports embed their screenshots; Markdown reports link to
+// image files in <base>_report_files.
+func exportRecordingReport(filename string, format ReportFormat, store string) (string, error) {
+	recording, err := LoadSavedRecording(filename, store)
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename)) + "_report"
+	reportFile := base + ".html"
+	imageSource := screenshotDataURI
+
+	if format == ReportFormatMarkdown {
+		reportFile = base + ".md"
+		imagesDir := base + "_files"
+		imageSource = func(screenshot RecordingScreenshot) (string, error) {
+			data, err := base64.StdEncoding.DecodeString(screenshot.ImageBase64)
+			if err != nil {
+				return "", NewWorkflowError(ErrorTypeSerialization, "Failed to decode screenshot", err)
+			}
+			if err := EnsureDirectoryExists(imagesDir); err != nil {
+				return "", NewWorkflowError(ErrorTypeFileIO, "Failed to create report image directory", err)
+			}
+			name := fmt.Sprintf("screenshot_%d.%s", screenshot.Index, screenshot.ImageFormat)
+			if err := os.WriteFile(filepath.Join(imagesDir, name), data, 0644); err != nil {
+				return "", NewWorkflowError(ErrorTypeFileIO, "Failed to write report image", err)
+			}
+			return filepath.Base(imagesDir) + "/" + name, nil
+		}
+	}
+
+	report, err := renderReport(recording, format, imageSource)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(reportFile, []byte(report), 0644); err != nil {
+		return "", NewWorkflowError(ErrorTypeFileIO, "Failed to write report", err)
+	}
+	return reportFile, nil
+}
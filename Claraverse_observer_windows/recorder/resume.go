@@ -0,0 +1,113 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Session resume. record --resume reopens the most recent recording a crash
+// or reboot left unsaved: the events flushed to its autosave or chunks are
+// loaded back, a SessionInterruptedEvent records how long capture was
+// interrupted, and recording carries on into the same directory. The
+// recording is saved under the name of the session's start, as it would
+// have been.
+
+var procGetTickCount64 = kernel32.NewProc("GetTickCount64")
+
+// What interrupted a session
+const (
+	InterruptionReboot = "reboot"
+	InterruptionCrash  = "crash"
+)
+
+// SessionInterruptedEvent marks where a resumed recording was interrupted
+type SessionInterruptedEvent struct {
+	SessionInterrupted string        `json:"session_interrupted"` // reboot or crash
+	InterruptedAt      uint64        `json:"interrupted_at"`      // Last flush before the interruption, in ms
+	GapMs              uint64        `json:"gap_ms"`              // How long nothing was recorded
+	Metadata           EventMetadata `json:"metadata"`
+}
+
+// restoreSession loads the events an unfinished manifest's chunks hold and
+// returns the workflow, a chunk writer carrying on in the same directory and
+// when the last flush was
+func restoreSession(manifestFile string, config WorkflowRecorderConfig) (*RecordedWorkflow, *ChunkWriter, uint64, error) {
+	if config.DryRun {
+		return nil, nil, 0, NewWorkflowError(ErrorTypeConfiguration, "A dry run cannot resume a recording", nil)
+	}
+	var manifest ChunkManifest
+	if err := LoadJSONFromFile(manifestFile, &manifest); err != nil {
+		return nil, nil, 0, err
+	}
+	directory := filepath.Dir(manifestFile)
+	workflow, err := loadFlushedWorkflow(directory, manifest)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	interruptedAt := manifest.StartTime
+	for _, event := range workflow.Events {
+		var probe SessionInterruptedEvent
+		if json.Unmarshal(event.(json.RawMessage), &probe) == nil && probe.SessionInterrupted != "" {
+			workflow.Interruptions++
+		}
+	}
+	workflow.Interruptions++
+	if count := len(manifest.Chunks); count > 0 {
+		interruptedAt = max(manifest.Chunks[count-1].WrittenAt, workflow.EndTime)
+	}
+
+	// Flushed as now configured, or as by default when flushing is off
+	chunks := NewChunkWriter(config, workflow)
+	if chunks == nil {
+		chunks = NewChunkWriter(DefaultConfig(), workflow)
+	}
+	chunks.Directory = directory
+	chunks.Autosave = manifest.Autosave
+	chunks.Manifest = manifest
+	chunks.Written = len(workflow.Events)
+	return workflow, chunks, interruptedAt, nil
+}
+
+// interruptionCause tells a reboot from a crash by whether Windows started
+// after the last flush
+func interruptionCause(interruptedAt, now uint64) string {
+	uptime, _, _ := procGetTickCount64.Call()
+	if uint64(uptime) < now && now-uint64(uptime) > interruptedAt {
+		return InterruptionReboot
+	}
+	return InterruptionCrash
+}
+
+// ResumeSession carries on the unfinished recording a manifest describes and
+// returns the marker recorded for the interruption
+func (rc *RecordingController) ResumeSession(manifestFile string) (*SessionInterruptedEvent, error) {
+	workflow, chunks, interruptedAt, err := restoreSession(manifestFile, rc.Recorder.currentConfig())
+	if err != nil {
+		return nil, err
+	}
+	if err := rc.start(context.Background(), workflow, chunks); err != nil {
+		return nil, err
+	}
+
+	now := captureTimestamp()
+	marker := SessionInterruptedEvent{
+		SessionInterrupted: interruptionCause(interruptedAt, now),
+		InterruptedAt:      interruptedAt,
+		Metadata:           EventMetadata{Timestamp: now},
+	}
+	if now > interruptedAt {
+		marker.GapMs = now - interruptedAt
+	}
+	rc.Recorder.appendWorkflowEvents(workflow, []WorkflowEvent{marker})
+	return &marker, nil
+}
+
+// describeInterruption returns a one-line description of an interruption
+func describeInterruption(cause string, gapMs uint64) string {
+	return fmt.Sprintf("Resumed after a %s; %s were not recorded", cause,
+		FormatDuration(time.Duration(gapMs)*time.Millisecond))
+}
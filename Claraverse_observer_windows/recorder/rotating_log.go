@@ -0,0 +1,124 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Log file with rotation. With LogFile set, the recorder's log goes to that
+// file instead of the console. Once it reaches LogMaxSizeMB it is renamed to
+// <file>.1, older files move up to <file>.2 and so on, and the oldest beyond
+// LogMaxFiles is removed, so a recorder left running for months keeps a
+// bounded log.
+
+// RotatingLog is an io.Writer that appends to a file and rotates it by size
+type RotatingLog struct {
+	Filename string
+	MaxBytes int64 // Size the file is rotated at; 0 for never
+	MaxFiles int   // Rotated files kept besides the current one
+	file     *os.File
+	size     int64
+	Mutex    sync.Mutex
+}
+
+// NewRotatingLog opens the configured log file, or returns nil when the log
+// goes to the console
+func NewRotatingLog(config WorkflowRecorderConfig) (*RotatingLog, error) {
+	if config.LogFile == "" {
+		return nil, nil
+	}
+	l := &RotatingLog{
+		Filename: config.LogFile,
+		MaxBytes: int64(config.LogMaxSizeMB) * 1024 * 1024,
+		MaxFiles: config.LogMaxFiles,
+	}
+	if err := EnsureDirectoryExists(filepath.Dir(l.Filename)); err != nil {
+		return nil, NewWorkflowError(ErrorTypeFileIO, "Failed to create log directory", err)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// validateLogging checks the log limits are usable
+func validateLogging(config *WorkflowRecorderConfig) error {
+	if config.LogMaxSizeMB < 0 || config.LogMaxFiles < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration, "LogMaxSizeMB and LogMaxFiles cannot be negative", nil)
+	}
+	return validateLogLevels(config)
+}
+
+// open opens the log file for appending. Called with the lock held.
+func (l *RotatingLog) open() error {
+	file, err := os.OpenFile(l.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to open log file", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to open log file", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// Write appends p to the log, rotating first when p would take the file
+// past MaxBytes
+func (l *RotatingLog) Write(p []byte) (int, error) {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+
+	if l.file == nil {
+		return 0, os.ErrClosed
+	}
+	if l.MaxBytes > 0 && l.size > 0 && l.size+int64(len(p)) > l.MaxBytes {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate moves the log files up by one and starts a new file. Called with
+// the lock held.
+func (l *RotatingLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+
+	if l.MaxFiles > 0 {
+		os.Remove(rotatedLogName(l.Filename, l.MaxFiles))
+		for i := l.MaxFiles - 1; i >= 1; i-- {
+			os.Rename(rotatedLogName(l.Filename, i), rotatedLogName(l.Filename, i+1))
+		}
+		if err := os.Rename(l.Filename, rotatedLogName(l.Filename, 1)); err != nil {
+			return NewWorkflowError(ErrorTypeFileIO, "Failed to rotate log file", err)
+		}
+	} else if err := os.Remove(l.Filename); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to rotate log file", err)
+	}
+	return l.open()
+}
+
+// rotatedLogName returns the name of the index'th rotated file
+func rotatedLogName(filename string, index int) string {
+	return fmt.Sprintf("%s.%d", filename, index)
+}
+
+// Close closes the log file
+func (l *RotatingLog) Close() error {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,255 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rrweb export. `convert <recording.json> --to=rrweb` writes the browser
+// part of a recording as rrweb events, <recording>_rrweb.json, for
+// rrweb-player and the session replay tools built on rrweb. The recorder
+// does not capture the DOM, so the page shown is its screenshot: each page
+// the user visits is a full snapshot of a document holding one image the
+// size of the screen, each later screenshot replaces the image's src, and
+// the pointer moves and clicks over it where it did on screen. The user's
+// actions are also custom events with their description, so typing,
+// hotkeys and DevTools element clicks appear in the player's timeline. Only
+// the events that happened on a web page, those with a URL, are exported.
+
+// rrweb event types
+const (
+	rrwebFullSnapshot        = 2
+	rrwebIncrementalSnapshot = 3
+	rrwebMeta                = 4
+	rrwebCustom              = 5
+)
+
+// rrweb incremental snapshot sources
+const (
+	rrwebSourceMutation         = 0
+	rrwebSourceMouseMove        = 1
+	rrwebSourceMouseInteraction = 2
+	rrwebSourceViewportResize   = 4
+)
+
+// rrweb mouse interactions
+const (
+	rrwebClick       = 2
+	rrwebContextMenu = 3
+	rrwebDoubleClick = 4
+)
+
+// rrweb serialized node types
+const (
+	rrwebDocumentNode = 0
+	rrwebDoctypeNode  = 1
+	rrwebElementNode  = 2
+)
+
+const (
+	// rrwebImageNode is the ID of the screenshot's img element in every
+	// snapshot
+	rrwebImageNode = 6
+
+	rrwebDefaultWidth  = 1920
+	rrwebDefaultHeight = 1080
+)
+
+// RRWebEvent is an event of an rrweb recording
+type RRWebEvent struct {
+	Type      int         `json:"type"`
+	Data      interface{} `json:"data"`
+	Timestamp uint64      `json:"timestamp"`
+}
+
+// rrwebExport builds the rrweb events of a recording's web pages
+type rrwebExport struct {
+	Events []RRWebEvent
+	Pages  int
+	page   string
+	image  string   // Data URL of the latest screenshot
+	area   [4]int32 // Screen x, y, width and height the page is shown at
+}
+
+// savedPageURL returns the URL of the web page an event happened on, if any
+func savedPageURL(event savedEvent) string {
+	switch {
+	case event.CDPEvent != "":
+		return event.URL
+	case event.Browser != nil && event.ToURL != "":
+		return event.ToURL
+	case event.Metadata.UIElement != nil:
+		return event.Metadata.UIElement.URL
+	}
+	return ""
+}
+
+// savedScreenArea returns the screen x, y, width and height a saved
+// screenshot covers; without one saved, its image size at the origin
+func savedScreenArea(event savedEvent) [4]int32 {
+	if area := event.ScreenArea; area != nil && area[2] > 0 && area[3] > 0 {
+		return *area
+	}
+	return [4]int32{0, 0, int32(event.Width), int32(event.Height)}
+}
+
+// buildRRWebEvents converts the events of a recording that happened on web
+// pages
+func buildRRWebEvents(recording *SavedRecording) *rrwebExport {
+	export := &rrwebExport{area: [4]int32{0, 0, rrwebDefaultWidth, rrwebDefaultHeight}}
+	// The page is shown at the size of the first screenshot of a page
+	for _, event := range recording.Events {
+		if event.ImageBase64 != nil && event.Width > 0 && savedPageURL(event) != "" {
+			export.area = savedScreenArea(event)
+			break
+		}
+	}
+
+	for _, event := range recording.Events {
+		url := savedPageURL(event)
+		if url == "" {
+			continue
+		}
+		timestamp := event.Metadata.Timestamp
+		if url != export.page {
+			export.visit(url, timestamp)
+		}
+
+		switch {
+		case event.ImageBase64 != nil && *event.ImageBase64 != "":
+			export.screenshot(event, timestamp)
+		case event.EventType != "" && event.Position != nil:
+			export.pointer(event, timestamp)
+		}
+
+		if kind, description, _, ok := describeSavedEvent(event, func(text string) string { return fmt.Sprintf("%q", text) }); ok {
+			export.add(rrwebCustom, timestamp, map[string]interface{}{
+				"tag":     kind,
+				"payload": map[string]interface{}{"description": description, "url": url},
+			})
+		}
+	}
+	return export
+}
+
+// add appends an event
+func (x *rrwebExport) add(kind int, timestamp uint64, data interface{}) {
+	x.Events = append(x.Events, RRWebEvent{Type: kind, Data: data, Timestamp: timestamp})
+}
+
+// visit starts a page: its meta event, then a snapshot showing the latest
+// screenshot until the page's own
+func (x *rrwebExport) visit(url string, timestamp uint64) {
+	x.page = url
+	x.Pages++
+	x.add(rrwebMeta, timestamp, map[string]interface{}{"href": url, "width": x.area[2], "height": x.area[3]})
+	x.add(rrwebFullSnapshot, timestamp, map[string]interface{}{
+		"node":          rrwebSnapshot(x.image),
+		"initialOffset": map[string]int{"left": 0, "top": 0},
+	})
+}
+
+// screenshot shows a screenshot as the page, resizing the viewport when
+// it covers a different screen area
+func (x *rrwebExport) screenshot(event savedEvent, timestamp uint64) {
+	format := event.ImageFormat
+	if format == "" {
+		format = "png"
+	}
+	x.image = "data:image/" + format + ";base64," + *event.ImageBase64
+
+	if area := savedScreenArea(event); area[2] > 0 && area[3] > 0 && area != x.area {
+		if area[2] != x.area[2] || area[3] != x.area[3] {
+			x.add(rrwebIncrementalSnapshot, timestamp, map[string]interface{}{
+				"source": rrwebSourceViewportResize, "width": area[2], "height": area[3],
+			})
+		}
+		x.area = area
+	}
+	x.add(rrwebIncrementalSnapshot, timestamp, map[string]interface{}{
+		"source":     rrwebSourceMutation,
+		"texts":      []interface{}{},
+		"attributes": []interface{}{map[string]interface{}{"id": rrwebImageNode, "attributes": map[string]string{"src": x.image}}},
+		"removes":    []interface{}{},
+		"adds":       []interface{}{},
+	})
+}
+
+// pointer moves or clicks the pointer at the event's position on the page
+func (x *rrwebExport) pointer(event savedEvent, timestamp uint64) {
+	px, py := event.Position.X-x.area[0], event.Position.Y-x.area[1]
+	switch MouseEventType(event.EventType) {
+	case MouseMove:
+		x.add(rrwebIncrementalSnapshot, timestamp, map[string]interface{}{
+			"source":    rrwebSourceMouseMove,
+			"positions": []interface{}{map[string]interface{}{"x": px, "y": py, "id": rrwebImageNode, "timeOffset": 0}},
+		})
+	case MouseClick:
+		x.interaction(rrwebClick, px, py, timestamp)
+	case MouseDoubleClick:
+		x.interaction(rrwebDoubleClick, px, py, timestamp)
+	case MouseRightClick:
+		x.interaction(rrwebContextMenu, px, py, timestamp)
+	}
+}
+
+// interaction records a mouse interaction on the screenshot
+func (x *rrwebExport) interaction(kind int, px, py int32, timestamp uint64) {
+	x.add(rrwebIncrementalSnapshot, timestamp, map[string]interface{}{
+		"source": rrwebSourceMouseInteraction, "type": kind, "id": rrwebImageNode, "x": px, "y": py,
+	})
+}
+
+// rrwebSnapshot serializes the document a page is shown as: an img of the
+// screenshot filling the body
+func rrwebSnapshot(image string) map[string]interface{} {
+	element := func(id int, tag string, attributes map[string]string, children ...interface{}) map[string]interface{} {
+		if children == nil {
+			children = []interface{}{}
+		}
+		return map[string]interface{}{"type": rrwebElementNode, "id": id, "tagName": tag, "attributes": attributes, "childNodes": children}
+	}
+	img := map[string]string{"style": "display:block;width:100%"}
+	if image != "" {
+		img["src"] = image
+	}
+
+	return map[string]interface{}{
+		"type": rrwebDocumentNode,
+		"id":   1,
+		"childNodes": []interface{}{
+			map[string]interface{}{"type": rrwebDoctypeNode, "id": 2, "name": "html", "publicId": "", "systemId": ""},
+			element(3, "html", map[string]string{},
+				element(4, "head", map[string]string{}),
+				element(5, "body", map[string]string{"style": "margin:0"},
+					element(rrwebImageNode, "img", img))),
+		},
+	}
+}
+
+// exportRecordingRRWeb writes the web pages of a saved recording as
+// <recording>_rrweb.json, and returns the export and the file's name
+func exportRecordingRRWeb(filename, store string) (*rrwebExport, string, error) {
+	recording, err := LoadSavedRecording(filename, store)
+	if err != nil {
+		return nil, "", err
+	}
+	export := buildRRWebEvents(recording)
+	if export.Pages == 0 {
+		return nil, "", NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("%s has no events on web pages to export", filename), nil)
+	}
+
+	data, err := json.Marshal(export.Events)
+	if err != nil {
+		return nil, "", NewWorkflowError(ErrorTypeSerialization, "Failed to serialize rrweb events", err)
+	}
+	rrwebFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + "_rrweb.json"
+	if err := os.WriteFile(rrwebFile, data, 0644); err != nil {
+		return nil, "", NewWorkflowError(ErrorTypeFileIO, "Failed to write rrweb events", err)
+	}
+	return export, rrwebFile, nil
+}
@@ -0,0 +1,222 @@
+package recorder
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sandboxed replay. replay --sandbox stages a bundle folder holding the
+// recorder, the recording and a script that replays it, runs the script in a
+// fresh Windows Sandbox, and waits for the result bundle the replay writes
+// back to the folder: result.json, the replay's console log and a screenshot
+// of where it ended. The sandbox is thrown away afterwards, so a replay can
+// click and type freely without touching the host. --sandbox-command runs
+// the bundle some other way instead, e.g. a script that restores a VM
+// snapshot, copies the folder in and runs run_replay.cmd there.
+
+const (
+	sandboxFolder         = `C:\Replay` // Where the bundle appears inside Windows Sandbox
+	sandboxExecutable     = "recorder.exe"
+	sandboxRecording      = "recording.json"
+	sandboxScript         = "run_replay.cmd"
+	sandboxConfigFile     = "replay.wsb"
+	sandboxResultFolder   = "result"
+	sandboxResultFile     = "result.json"
+	sandboxDefaultTimeout = 30 * time.Minute
+	sandboxPollInterval   = 2 * time.Second
+)
+
+// SandboxReplay replays a recording away from the host
+type SandboxReplay struct {
+	Recording string        // Recording to replay
+	Folder    string        // Bundle folder on the host
+	Speed     float64       // Replay speed, as for replay --speed
+	Verify    bool          // Check each step against the recording, as for replay --verify
+	Command   string        // Program given the folder to run the bundle; "" for Windows Sandbox
+	Timeout   time.Duration // Longest wait for the result
+}
+
+// runSandboxReplay replays a recording in a sandbox as the command line's
+// --sandbox, --sandbox-command and --sandbox-timeout options say
+func runSandboxReplay(recording string, speed float64, verify bool) error {
+	sandbox := &SandboxReplay{
+		Recording: recording,
+		Folder:    strings.TrimSuffix(recording, filepath.Ext(recording)) + "_sandbox",
+		Speed:     speed,
+		Verify:    verify,
+		Timeout:   sandboxDefaultTimeout,
+	}
+	if folder, _ := commandLineOption("--sandbox"); folder != "" {
+		sandbox.Folder = folder
+	}
+	sandbox.Command, _ = commandLineOption("--sandbox-command")
+	if value, set := commandLineOption("--sandbox-timeout"); set {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Invalid --sandbox-timeout %q: use a time such as 10m", value), err)
+		}
+		sandbox.Timeout = timeout
+	}
+
+	fmt.Println(Msg(MsgSandboxStarting, sandbox.Folder))
+	result, err := sandbox.Run()
+	if err != nil {
+		return err
+	}
+	for _, divergence := range result.Divergences {
+		fmt.Println(Msg(MsgReplayDivergence, divergence.Step, divergence.Check, divergence.Actual, divergence.Expected))
+	}
+	if !result.Success {
+		return NewWorkflowError(ErrorTypeSystem, fmt.Sprintf("Sandboxed replay failed after %d of %d steps: %s",
+			result.CompletedSteps, result.Steps, result.Error), nil)
+	}
+	fmt.Println(Msg(MsgSandboxFinished, result.CompletedSteps, result.Steps, filepath.Join(sandbox.Folder, sandboxResultFolder)))
+	return nil
+}
+
+// Stage writes the bundle: the recorder, the recording, the script that
+// replays it and, for Windows Sandbox, the sandbox configuration. A result
+// left by an earlier run is removed.
+func (s *SandboxReplay) Stage() error {
+	folder, err := filepath.Abs(s.Folder)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Invalid sandbox folder", err)
+	}
+	s.Folder = folder
+	if err := os.RemoveAll(filepath.Join(folder, sandboxResultFolder)); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to clear the previous sandbox result", err)
+	}
+	if err := EnsureDirectoryExists(folder); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to create directory", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSystem, "Cannot locate the recorder executable", err)
+	}
+	if err := copyFile(executable, filepath.Join(folder, sandboxExecutable)); err != nil {
+		return err
+	}
+	if err := copyFile(s.Recording, filepath.Join(folder, sandboxRecording)); err != nil {
+		return err
+	}
+
+	replay := fmt.Sprintf("%s replay %s --speed=%s", sandboxExecutable, sandboxRecording, strconv.FormatFloat(s.Speed, 'f', -1, 64))
+	if s.Verify {
+		replay += " --verify"
+	}
+	// Given "shutdown", the script closes the sandbox once the result is written
+	script := strings.Join([]string{
+		"@echo off",
+		"rem Replays " + sandboxRecording + " and writes the result bundle to " + sandboxResultFolder,
+		`cd /d "%~dp0"`,
+		"mkdir " + sandboxResultFolder + " 2>nul",
+		fmt.Sprintf(`%s --result=%s\%s > %s\replay.log 2>&1`, replay, sandboxResultFolder, sandboxResultFile, sandboxResultFolder),
+		`if "%~1"=="shutdown" shutdown /s /t 0`,
+		"",
+	}, "\r\n")
+	if err := os.WriteFile(filepath.Join(folder, sandboxScript), []byte(script), 0644); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write the replay script", err)
+	}
+
+	if s.Command == "" {
+		if err := os.WriteFile(filepath.Join(folder, sandboxConfigFile), []byte(windowsSandboxConfig(folder)), 0644); err != nil {
+			return NewWorkflowError(ErrorTypeFileIO, "Failed to write the sandbox configuration", err)
+		}
+	}
+	return nil
+}
+
+// windowsSandboxConfig maps the bundle folder into the sandbox and runs the
+// replay script at logon
+func windowsSandboxConfig(folder string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(folder))
+	return "<Configuration>\r\n" +
+		"  <MappedFolders>\r\n" +
+		"    <MappedFolder>\r\n" +
+		"      <HostFolder>" + escaped.String() + "</HostFolder>\r\n" +
+		"      <SandboxFolder>" + sandboxFolder + "</SandboxFolder>\r\n" +
+		"      <ReadOnly>false</ReadOnly>\r\n" +
+		"    </MappedFolder>\r\n" +
+		"  </MappedFolders>\r\n" +
+		"  <LogonCommand>\r\n" +
+		"    <Command>" + sandboxFolder + `\` + sandboxScript + " shutdown</Command>\r\n" +
+		"  </LogonCommand>\r\n" +
+		"</Configuration>\r\n"
+}
+
+// Run stages the bundle, starts the replay and waits for its result
+func (s *SandboxReplay) Run() (*ReplayResult, error) {
+	if err := s.Stage(); err != nil {
+		return nil, err
+	}
+
+	if s.Command != "" {
+		command := exec.Command(s.Command, s.Folder)
+		command.Stdout, command.Stderr = os.Stdout, os.Stderr
+		if err := command.Run(); err != nil {
+			return nil, NewWorkflowError(ErrorTypeSystem, "Sandbox command failed", err)
+		}
+	} else if err := exec.Command("WindowsSandbox.exe", filepath.Join(s.Folder, sandboxConfigFile)).Start(); err != nil {
+		return nil, NewWorkflowError(ErrorTypeSystem,
+			"Failed to start Windows Sandbox; turn on the Windows Sandbox feature or pass --sandbox-command", err)
+	}
+
+	return waitForReplayResult(filepath.Join(s.Folder, sandboxResultFolder, sandboxResultFile), s.Timeout)
+}
+
+// waitForReplayResult reads the result a replay writes to resultFile,
+// waiting up to timeout for it to appear
+func waitForReplayResult(resultFile string, timeout time.Duration) (*ReplayResult, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := os.ReadFile(resultFile)
+		if err == nil {
+			var result ReplayResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to parse the replay result", err)
+			}
+			return &result, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, NewWorkflowError(ErrorTypeFileIO, "Failed to read the replay result", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, NewWorkflowError(ErrorTypeSystem,
+				fmt.Sprintf("No replay result in %s after %s; see replay.log beside it", resultFile, timeout), nil)
+		}
+		time.Sleep(sandboxPollInterval)
+	}
+}
+
+// copyFile copies a file's contents to destination
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to open "+source, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to create "+destination, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to copy "+source, err)
+	}
+	if err := out.Close(); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write "+destination, err)
+	}
+	return nil
+}
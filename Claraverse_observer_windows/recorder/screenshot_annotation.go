@@ -0,0 +1,86 @@
+package recorder
+
+import (
+	"image"
+	"image/color"
+)
+
+// Optional screenshot annotation: before a screenshot is scaled and encoded,
+// the bounds of the element under the cursor are outlined and the cursor is
+// marked, so a reviewer or vision model can see where the user acted.
+// Drawing happens at full resolution, with strokes sized to the screen so
+// they stay visible after downscaling.
+
+var (
+	annotationElementColor = color.RGBA{R: 255, G: 140, B: 0, A: 255}
+	annotationCursorColor  = color.RGBA{R: 230, G: 0, B: 40, A: 255}
+)
+
+// annotationStroke returns the line width used on a screenshot width pixels
+// wide
+func annotationStroke(width int) int {
+	return max(2, width/640)
+}
+
+// annotateScreenshot draws element's bounds and the cursor on img, a capture
+// of screen. Both are in screen coordinates. Returns whether anything was
+// drawn.
+func annotateScreenshot(img *image.RGBA, screen image.Rectangle, element *UIElement, cursor Position) bool {
+	stroke := annotationStroke(img.Rect.Dx())
+	offset := img.Rect.Min.Sub(screen.Min)
+	drawn := false
+
+	if element != nil && element.Bounds[2] > 0 && element.Bounds[3] > 0 {
+		x, y := int(element.Bounds[0]), int(element.Bounds[1])
+		rect := image.Rect(x, y, x+int(element.Bounds[2]), y+int(element.Bounds[3])).Add(offset)
+		if rect.Overlaps(img.Rect) {
+			drawRectOutline(img, rect.Inset(-stroke), stroke, annotationElementColor)
+			drawn = true
+		}
+	}
+
+	center := image.Pt(int(cursor.X), int(cursor.Y)).Add(offset)
+	if center.In(img.Rect) {
+		drawCursorMarker(img, center, stroke, annotationCursorColor)
+		drawn = true
+	}
+
+	return drawn
+}
+
+// drawRectOutline strokes the inside edge of rect with the given width
+func drawRectOutline(img *image.RGBA, rect image.Rectangle, width int, c color.RGBA) {
+	fillRect(img, image.Rect(rect.Min.X, rect.Min.Y, rect.Max.X, rect.Min.Y+width), c)
+	fillRect(img, image.Rect(rect.Min.X, rect.Max.Y-width, rect.Max.X, rect.Max.Y), c)
+	fillRect(img, image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+width, rect.Max.Y), c)
+	fillRect(img, image.Rect(rect.Max.X-width, rect.Min.Y, rect.Max.X, rect.Max.Y), c)
+}
+
+// drawCursorMarker draws a ring with a dot in the middle around center
+func drawCursorMarker(img *image.RGBA, center image.Point, stroke int, c color.RGBA) {
+	outer := stroke * 6
+	inner := outer - stroke
+	dot := stroke
+
+	area := image.Rect(center.X-outer, center.Y-outer, center.X+outer+1, center.Y+outer+1).Intersect(img.Rect)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			dx, dy := x-center.X, y-center.Y
+			distance := dx*dx + dy*dy
+			if (distance <= outer*outer && distance >= inner*inner) || distance <= dot*dot {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// fillRect fills the part of rect inside img
+func fillRect(img *image.RGBA, rect image.Rectangle, c color.RGBA) {
+	rect = rect.Intersect(img.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(rect.Min.X, y):]
+		for x := 0; x < rect.Dx(); x++ {
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
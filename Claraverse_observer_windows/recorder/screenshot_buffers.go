@@ -0,0 +1,237 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// GDI entry points for buffer-reusing capture
+var (
+	gdi32                  = syscall.NewLazyDLL("gdi32.dll")
+	procGetDC              = user32.NewProc("GetDC")
+	procReleaseDC          = user32.NewProc("ReleaseDC")
+	procGetDesktopWindow   = user32.NewProc("GetDesktopWindow")
+	procCreateCompatibleDC = gdi32.NewProc("CreateCompatibleDC")
+	procCreateDIBSection   = gdi32.NewProc("CreateDIBSection")
+	procSelectObject       = gdi32.NewProc("SelectObject")
+	procBitBlt             = gdi32.NewProc("BitBlt")
+	procDeleteObject       = gdi32.NewProc("DeleteObject")
+	procDeleteDC           = gdi32.NewProc("DeleteDC")
+)
+
+const (
+	SRCCOPY        = 0x00CC0020
+	DIB_RGB_COLORS = 0
+	BI_RGB         = 0
+)
+
+type BITMAPINFOHEADER struct {
+	BiSize          uint32
+	BiWidth         int32
+	BiHeight        int32
+	BiPlanes        uint16
+	BiBitCount      uint16
+	BiCompression   uint32
+	BiSizeImage     uint32
+	BiXPelsPerMeter int32
+	BiYPelsPerMeter int32
+	BiClrUsed       uint32
+	BiClrImportant  uint32
+}
+
+// FrameCapturer keeps a memory DC and a DIB section alive between frames so
+// repeated captures of the same size blit into one memory-mapped pixel buffer
+// instead of allocating a new bitmap per screenshot
+type FrameCapturer struct {
+	memDC     uintptr
+	bitmap    uintptr
+	oldBitmap uintptr
+	bits      unsafe.Pointer
+	width     int
+	height    int
+	Mutex     sync.Mutex
+}
+
+// Capture copies the given desktop rectangle into a pooled RGBA buffer.
+// Callers should hand the image back with releaseFrameBuffer once encoded.
+func (fc *FrameCapturer) Capture(rect image.Rectangle) (*image.RGBA, error) {
+	width, height := rect.Dx(), rect.Dy()
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("capture rectangle is empty")
+	}
+
+	fc.Mutex.Lock()
+	defer fc.Mutex.Unlock()
+
+	hwnd, _, _ := procGetDesktopWindow.Call()
+	hdc, _, _ := procGetDC.Call(hwnd)
+	if hdc == 0 {
+		return nil, errors.New("GetDC failed")
+	}
+	defer procReleaseDC.Call(hwnd, hdc)
+
+	if err := fc.ensureSurface(hdc, width, height); err != nil {
+		return nil, err
+	}
+
+	ret, _, _ := procBitBlt.Call(fc.memDC, 0, 0, uintptr(width), uintptr(height),
+		hdc, uintptr(rect.Min.X), uintptr(rect.Min.Y), SRCCOPY)
+	if ret == 0 {
+		return nil, errors.New("BitBlt failed")
+	}
+
+	img := acquireFrameBuffer(width, height)
+	src := unsafe.Slice((*byte)(fc.bits), width*height*4)
+	dst := img.Pix
+
+	// BGRA => RGBA, and set A to 255
+	for i := 0; i < len(src); i += 4 {
+		dst[i], dst[i+1], dst[i+2], dst[i+3] = src[i+2], src[i+1], src[i], 255
+	}
+
+	return img, nil
+}
+
+// ensureSurface (re)creates the DIB section when the capture size changes
+func (fc *FrameCapturer) ensureSurface(hdc uintptr, width, height int) error {
+	if fc.bitmap != 0 && fc.width == width && fc.height == height {
+		return nil
+	}
+
+	fc.releaseSurface()
+
+	memDC, _, _ := procCreateCompatibleDC.Call(hdc)
+	if memDC == 0 {
+		return errors.New("CreateCompatibleDC failed")
+	}
+
+	header := BITMAPINFOHEADER{
+		BiPlanes:      1,
+		BiBitCount:    32,
+		BiWidth:       int32(width),
+		BiHeight:      int32(-height), // Top-down rows
+		BiCompression: BI_RGB,
+	}
+	header.BiSize = uint32(unsafe.Sizeof(header))
+
+	var bits unsafe.Pointer
+	bitmap, _, _ := procCreateDIBSection.Call(hdc, uintptr(unsafe.Pointer(&header)),
+		DIB_RGB_COLORS, uintptr(unsafe.Pointer(&bits)), 0, 0)
+	if bitmap == 0 || bits == nil {
+		procDeleteDC.Call(memDC)
+		return errors.New("CreateDIBSection failed")
+	}
+
+	oldBitmap, _, _ := procSelectObject.Call(memDC, bitmap)
+
+	fc.memDC = memDC
+	fc.bitmap = bitmap
+	fc.oldBitmap = oldBitmap
+	fc.bits = bits
+	fc.width = width
+	fc.height = height
+
+	return nil
+}
+
+func (fc *FrameCapturer) releaseSurface() {
+	if fc.memDC != 0 {
+		if fc.oldBitmap != 0 {
+			procSelectObject.Call(fc.memDC, fc.oldBitmap)
+		}
+		procDeleteDC.Call(fc.memDC)
+	}
+	if fc.bitmap != 0 {
+		procDeleteObject.Call(fc.bitmap)
+	}
+
+	fc.memDC = 0
+	fc.bitmap = 0
+	fc.oldBitmap = 0
+	fc.bits = nil
+	fc.width = 0
+	fc.height = 0
+}
+
+// Close frees the GDI objects held between frames
+func (fc *FrameCapturer) Close() {
+	fc.Mutex.Lock()
+	defer fc.Mutex.Unlock()
+
+	fc.releaseSurface()
+}
+
+// Pooled RGBA frames, reused whenever the previous frame was at least as large
+var frameBufferPool sync.Pool
+
+func acquireFrameBuffer(width, height int) *image.RGBA {
+	size := width * height * 4
+
+	if v := frameBufferPool.Get(); v != nil {
+		img := v.(*image.RGBA)
+		if cap(img.Pix) >= size {
+			img.Pix = img.Pix[:size]
+			img.Stride = width * 4
+			img.Rect = image.Rect(0, 0, width, height)
+			return img
+		}
+	}
+
+	return image.NewRGBA(image.Rect(0, 0, width, height))
+}
+
+func releaseFrameBuffer(img *image.RGBA) {
+	if img != nil {
+		frameBufferPool.Put(img)
+	}
+}
+
+// pngEncoderBufferPool lets the PNG encoder keep its zlib writer and scanline
+// buffers across frames
+type pngEncoderBufferPool struct {
+	pool sync.Pool
+}
+
+func (p *pngEncoderBufferPool) Get() *png.EncoderBuffer {
+	if v := p.pool.Get(); v != nil {
+		return v.(*png.EncoderBuffer)
+	}
+	return nil
+}
+
+func (p *pngEncoderBufferPool) Put(b *png.EncoderBuffer) {
+	p.pool.Put(b)
+}
+
+var (
+	screenshotPNGEncoder = &png.Encoder{BufferPool: &pngEncoderBufferPool{}}
+	encodeBufferPool     = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+)
+
+// encodeScreenshotImage encodes an image through pooled buffers and returns the
+// base64 payload together with the raw encoded size in bytes
+func encodeScreenshotImage(img image.Image, format string, jpegQuality int) (string, int, error) {
+	buf := encodeBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer encodeBufferPool.Put(buf)
+
+	var err error
+	switch format {
+	case "jpeg", "jpg":
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: jpegQuality})
+	default:
+		err = screenshotPNGEncoder.Encode(buf, img)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), buf.Len(), nil
+}
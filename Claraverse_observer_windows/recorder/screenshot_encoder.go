@@ -0,0 +1,190 @@
+package recorder
+
+import (
+	"image"
+	"sync"
+)
+
+// Background screenshot encoding. PNG encoding a full-screen frame takes
+// tens of milliseconds, long enough for the capture loop to miss clicks and
+// key presses while it runs. With ScreenshotEncodeWorkers set, the capture
+// loop only grabs the frame: the ScreenshotEvent is recorded straight away
+// with image_pending set, and a fixed pool of workers takes the frames from
+// a bounded queue, scales and encodes them, and attaches each image to its
+// recorded event before handing it on to captioning and OCR. When the queue
+// is full the frame is encoded on the capture loop as before, so a burst of
+// screenshots slows capture down rather than losing images. The queue depth
+// is reported in /status.
+
+// screenshotQueuePerWorker is how many frames may wait for each worker
+const screenshotQueuePerWorker = 4
+
+// screenshotFrame is a captured frame and how to encode it
+type screenshotFrame struct {
+	Image       *image.RGBA // A pooled frame buffer, released once encoded
+	Format      string
+	JPEGQuality int
+	MaxWidth    *int
+	MaxHeight   *int
+}
+
+// encode scales the frame to fit and encodes it, returning the base64 image
+// and its size in pixels. The frame buffer is released.
+func (f *screenshotFrame) encode() (string, int, int, error) {
+	defer releaseFrameBuffer(f.Image)
+
+	img := f.Image
+	if scaled := scaleToFit(img, f.MaxWidth, f.MaxHeight); scaled != nil {
+		defer releaseFrameBuffer(scaled)
+		img = scaled
+	}
+
+	data, _, err := encodeScreenshotImage(img, f.Format, f.JPEGQuality)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return data, img.Rect.Dx(), img.Rect.Dy(), nil
+}
+
+// screenshotJob is a recorded screenshot waiting for its image
+type screenshotJob struct {
+	Workflow *RecordedWorkflow
+	Shot     ScreenshotEvent
+}
+
+// ScreenshotEncoder encodes the screenshots of a recording in the background
+type ScreenshotEncoder struct {
+	Workers       int
+	Queue         chan screenshotJob
+	Pending       sync.WaitGroup
+	EncodedCount  int64
+	InlineCount   int64 // Encoded on the capture loop as the queue was full
+	FailedCount   int64
+	MaxQueueDepth int
+	Mutex         sync.Mutex
+
+	recorder *Recorder // Sends the encoded screenshots on; nil to only attach them
+}
+
+// NewScreenshotEncoder starts the encoding workers for a recording of
+// recorder, or returns nil when screenshots are encoded on the capture loop
+func NewScreenshotEncoder(config WorkflowRecorderConfig, recorder *Recorder) *ScreenshotEncoder {
+	if !config.CaptureScreenshots || config.ScreenshotEncodeWorkers <= 0 {
+		return nil
+	}
+
+	se := &ScreenshotEncoder{
+		Workers:  config.ScreenshotEncodeWorkers,
+		Queue:    make(chan screenshotJob, config.ScreenshotEncodeWorkers*screenshotQueuePerWorker),
+		recorder: recorder,
+	}
+	for i := 0; i < se.Workers; i++ {
+		go func() {
+			for job := range se.Queue {
+				se.encode(job)
+			}
+		}()
+	}
+	return se
+}
+
+// Submit queues the frame of shot, recorded in workflow, for encoding, or
+// encodes it now when the queue is full
+func (se *ScreenshotEncoder) Submit(workflow *RecordedWorkflow, shot ScreenshotEvent) {
+	if shot.frame == nil {
+		return
+	}
+
+	job := screenshotJob{Workflow: workflow, Shot: shot}
+	se.Pending.Add(1)
+	select {
+	case se.Queue <- job:
+		se.Mutex.Lock()
+		se.MaxQueueDepth = max(se.MaxQueueDepth, len(se.Queue))
+		se.Mutex.Unlock()
+	default:
+		se.Mutex.Lock()
+		se.InlineCount++
+		se.Mutex.Unlock()
+		se.encode(job)
+	}
+}
+
+// encode encodes a queued frame and attaches the image to its event
+func (se *ScreenshotEncoder) encode(job screenshotJob) {
+	defer se.Pending.Done()
+
+	data, width, height, err := job.Shot.frame.encode()
+
+	se.Mutex.Lock()
+	if err != nil {
+		se.FailedCount++
+	} else {
+		se.EncodedCount++
+	}
+	se.Mutex.Unlock()
+
+	if err != nil {
+		logger("screenshots").Error("Failed to encode screenshot", "error", err)
+	}
+	shot, found := job.Workflow.attachScreenshot(job.Shot.CaptureID, data, width, height)
+	if !found || se.recorder == nil {
+		return
+	}
+	se.recorder.Mutex.RLock()
+	sinks := se.recorder.Sinks
+	se.recorder.Mutex.RUnlock()
+	sinks.Write(job.Workflow.Name, shot)
+	if err == nil {
+		se.recorder.analyzeScreenshot(job.Workflow, shot)
+	}
+}
+
+// Close waits for the queued frames to be encoded and stops the workers.
+// Nothing may be submitted afterwards.
+func (se *ScreenshotEncoder) Close() {
+	close(se.Queue)
+	se.Pending.Wait()
+}
+
+// GetStatistics returns the encoding counters and the current queue depth
+func (se *ScreenshotEncoder) GetStatistics() map[string]interface{} {
+	se.Mutex.Lock()
+	defer se.Mutex.Unlock()
+
+	return map[string]interface{}{
+		"workers":         se.Workers,
+		"queue_depth":     len(se.Queue),
+		"queue_capacity":  cap(se.Queue),
+		"max_queue_depth": se.MaxQueueDepth,
+		"encoded":         se.EncodedCount,
+		"encoded_inline":  se.InlineCount,
+		"failed":          se.FailedCount,
+	}
+}
+
+// attachScreenshot gives the pending screenshot captureID its encoded image,
+// counting the image in the recording's size, and returns the updated event
+func (w *RecordedWorkflow) attachScreenshot(captureID int64, data string, width, height int) (ScreenshotEvent, bool) {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	for i, event := range w.Events {
+		shot, ok := event.(ScreenshotEvent)
+		if !ok || !shot.ImagePending || shot.CaptureID != captureID {
+			continue
+		}
+		shot.ImageBase64, shot.Width, shot.Height = data, width, height
+		shot.ImagePending, shot.frame = false, nil
+		w.Events[i] = shot
+
+		size := int64(len(data))
+		w.Size += size
+		if w.TypeSizes == nil {
+			w.TypeSizes = make(map[string]int64)
+		}
+		w.TypeSizes[auditEventType(shot)] += size
+		return shot, true
+	}
+	return ScreenshotEvent{}, false
+}
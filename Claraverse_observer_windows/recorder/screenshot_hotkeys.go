@@ -0,0 +1,74 @@
+package recorder
+
+import (
+	"fmt"
+)
+
+// Screenshot hotkeys. ScreenshotOnKeyboardEvent takes a screenshot at every
+// recognized hotkey or none; ScreenshotHotkeys names the key presses that
+// matter instead, a shortcut such as Ctrl+S or a single key such as Enter,
+// each in every application or only in some, e.g. Enter in a browser. A
+// press matches when its key goes down with exactly the combination's
+// modifiers held, so Enter does not match Ctrl+Enter. The screenshots are
+// taken with the Hotkey trigger, whatever ScreenshotOnKeyboardEvent says.
+
+// ScreenshotTriggerHotkey marks a screenshot taken at one of the
+// ScreenshotHotkeys
+const ScreenshotTriggerHotkey ScreenshotTrigger = "Hotkey"
+
+// screenshotHotkeyPattern is a screenshot hotkey's key, the modifiers held
+// with it and the applications it applies in
+type screenshotHotkeyPattern struct {
+	Key          uint32
+	Modifiers    ModifierStates
+	Applications []string
+}
+
+// screenshotHotkeyPatterns turns the config's screenshot hotkeys into
+// patterns
+func screenshotHotkeyPatterns(hotkeys []ScreenshotHotkey) ([]screenshotHotkeyPattern, error) {
+	var patterns []screenshotHotkeyPattern
+	for i, hotkey := range hotkeys {
+		keys, modifiers, err := parseKeyNames(hotkey.Keys)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys)-modifiers != 1 {
+			return nil, NewWorkflowError(ErrorTypeConfiguration,
+				fmt.Sprintf("Screenshot hotkey %d (%q) needs one key besides its modifiers", i+1, hotkey.Keys), nil)
+		}
+
+		pattern := screenshotHotkeyPattern{Applications: hotkey.Applications}
+		for _, key := range keys {
+			switch key {
+			case VK_CONTROL:
+				pattern.Modifiers.Ctrl = true
+			case VK_MENU:
+				pattern.Modifiers.Alt = true
+			case VK_SHIFT:
+				pattern.Modifiers.Shift = true
+			case VK_LWIN:
+				pattern.Modifiers.Win = true
+			default:
+				pattern.Key = key
+			}
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// matchesScreenshotHotkey reports whether event is a press of one of
+// patterns in application
+func matchesScreenshotHotkey(patterns []screenshotHotkeyPattern, event WorkflowEvent, application string) bool {
+	key, ok := event.(KeyboardEvent)
+	if !ok || !key.IsKeyDown {
+		return false
+	}
+	for _, pattern := range patterns {
+		if key.KeyCode == pattern.Key && key.ModifierStates == pattern.Modifiers && appliesIn(pattern.Applications, application) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+package recorder
+
+import (
+	"image"
+	"sync"
+	"time"
+
+	"github.com/kbinani/screenshot"
+)
+
+// ScreenshotService is the single screenshot pipeline: trigger policy,
+// throttling, sizing and encoding all happen here so every caller (capture
+// loop, MCP, HTTP API) produces screenshots the same way
+type ScreenshotService struct {
+	Capturer           *FrameCapturer
+	Duplicator         *DesktopDuplicator // Captures what GDI cannot, such as fullscreen games
+	DuplicationFailing bool
+	DuplicationRetryAt time.Time // When to try duplication again after it failed
+	LastCaptureTime    time.Time
+	LastTriggerTime    map[ScreenshotTrigger]time.Time
+	CapturedCount      int64
+	ThrottledCount     int64
+	Mutex              sync.Mutex
+
+	recorder *Recorder // Whose configuration and recording the screenshots follow
+}
+
+// NewScreenshotService creates a service taking recorder's screenshots
+// through the given frame capturer
+func NewScreenshotService(recorder *Recorder, capturer *FrameCapturer) *ScreenshotService {
+	return &ScreenshotService{
+		recorder:        recorder,
+		Capturer:        capturer,
+		Duplicator:      &DesktopDuplicator{},
+		LastTriggerTime: make(map[ScreenshotTrigger]time.Time),
+	}
+}
+
+// Capture takes a screenshot for trigger if the trigger policy allows it and
+// the throttle window has passed. Returns nil when skipped or on failure.
+// While a recording has a ScreenshotEncoder, the screenshot is returned with
+// ImagePending set and its frame is encoded once it is recorded.
+func (ss *ScreenshotService) Capture(trigger ScreenshotTrigger) *ScreenshotEvent {
+	if !ss.ShouldCapture(trigger) || !ss.reserve(trigger, time.Now()) {
+		return nil
+	}
+
+	return ss.capture(trigger, "", ss.deferEncoding())
+}
+
+// deferEncoding reports whether the recording in progress encodes its
+// screenshots with a ScreenshotEncoder, rather than as they are taken
+func (ss *ScreenshotService) deferEncoding() bool {
+	ss.recorder.Mutex.RLock()
+	defer ss.recorder.Mutex.RUnlock()
+	return ss.recorder.Encoder != nil
+}
+
+// CaptureNow captures immediately, bypassing trigger policy and throttling,
+// for explicit requests. An empty format uses the configured one. The image
+// is always encoded before it returns.
+func (ss *ScreenshotService) CaptureNow(trigger ScreenshotTrigger, format string) *ScreenshotEvent {
+	return ss.capture(trigger, format, false)
+}
+
+// capture grabs a frame of the screen and, unless deferred, encodes it
+func (ss *ScreenshotService) capture(trigger ScreenshotTrigger, format string, deferred bool) *ScreenshotEvent {
+	if telemetry := ss.recorder.Telemetry; telemetry != nil {
+		defer func(started time.Time) { telemetry.ObserveLatency(TelemetryScreenshot, time.Since(started)) }(time.Now())
+	}
+
+	bounds := screenshot.GetDisplayBounds(0)
+	img, method, protected, err := ss.captureScreen(bounds)
+	if err != nil {
+		logger("screenshots").Error("Failed to capture screenshot", "error", err)
+		return nil
+	}
+	return ss.screenshotOf(img, bounds, method, protected, trigger, format, deferred, 0)
+}
+
+// screenshotOf makes a screenshot of img, a pooled frame of bounds taken
+// through method, and unless deferred encodes it. The screenshot gets
+// captureID, or a new one when 0.
+func (ss *ScreenshotService) screenshotOf(img *image.RGBA, bounds image.Rectangle, method string, protected bool,
+	trigger ScreenshotTrigger, format string, deferred bool, captureID int64) *ScreenshotEvent {
+	config := ss.recorder.currentConfig()
+	if format == "" {
+		format = config.ScreenshotFormat
+	}
+	if format == "jpg" {
+		format = "jpeg"
+	}
+
+	metadata := createEventMetadata()
+	annotated := false
+	if config.AnnotateScreenshots {
+		annotated = annotateScreenshot(img, bounds, metadata.UIElement, getMousePosition())
+	}
+
+	frame := &screenshotFrame{
+		Image:       img,
+		Format:      format,
+		JPEGQuality: config.ScreenshotJPEGQuality,
+		MaxWidth:    config.MaxScreenshotWidth,
+		MaxHeight:   config.MaxScreenshotHeight,
+	}
+	var base64Data string
+	var width, height int
+	if !deferred {
+		var err error
+		base64Data, width, height, err = frame.encode()
+		if err != nil {
+			logger("screenshots").Error("Failed to encode screenshot", "error", err)
+			return nil
+		}
+		frame = nil
+	}
+
+	if captureID == 0 {
+		captureID = ss.NextCaptureID()
+	}
+
+	if method == CaptureMethodGDI {
+		// Recorded only when it is not the usual one
+		method = ""
+	}
+
+	return &ScreenshotEvent{
+		ImageBase64:   base64Data,
+		ImageFormat:   format,
+		Width:         width,
+		Height:        height,
+		MonitorName:   "Primary",
+		Trigger:       trigger,
+		CaptureID:     captureID,
+		Annotated:     annotated,
+		CaptureMethod: method,
+		ScreenArea:    &[4]int32{int32(bounds.Min.X), int32(bounds.Min.Y), int32(bounds.Dx()), int32(bounds.Dy())},
+		Protected:     protected,
+		ImagePending:  deferred,
+		Metadata:      metadata,
+		frame:         frame,
+	}
+}
+
+// NextCaptureID counts a screenshot captured and returns its capture ID
+func (ss *ScreenshotService) NextCaptureID() int64 {
+	ss.Mutex.Lock()
+	defer ss.Mutex.Unlock()
+
+	ss.CapturedCount++
+	return ss.CapturedCount
+}
+
+// ShouldCapture reports whether the configuration enables screenshots for trigger
+func (ss *ScreenshotService) ShouldCapture(trigger ScreenshotTrigger) bool {
+	config := ss.recorder.recordingConfig()
+
+	if !config.CaptureScreenshots {
+		return false
+	}
+
+	switch trigger {
+	case ScreenshotTriggerMouseClick:
+		return config.ScreenshotOnMouseClick
+	case ScreenshotTriggerKeyboard:
+		return config.ScreenshotOnKeyboardEvent
+	case ScreenshotTriggerHotkey:
+		return len(config.ScreenshotHotkeys) > 0
+	case ScreenshotTriggerBeforeAction, ScreenshotTriggerAfterAction:
+		return config.ActionScreenshotPairs
+	case ScreenshotTriggerInterval:
+		return config.ScreenshotOnInterval
+	case ScreenshotTriggerAppSwitch:
+		return config.ScreenshotOnAppSwitch
+	case ScreenshotTriggerManual, ScreenshotTriggerUIChange:
+		return true
+	default:
+		return false
+	}
+}
+
+// reserve applies throttling and records the capture time when allowed.
+// Interval screenshots are spaced by ScreenshotIntervalMs; every trigger is
+// also spaced from the previous capture by ScreenshotThrottleMs, so a click
+// that switches applications yields one screenshot rather than two.
+func (ss *ScreenshotService) reserve(trigger ScreenshotTrigger, now time.Time) bool {
+	config := ss.recorder.currentConfig()
+
+	ss.Mutex.Lock()
+	defer ss.Mutex.Unlock()
+
+	if trigger == ScreenshotTriggerInterval {
+		last, captured := ss.LastTriggerTime[trigger]
+		if !captured {
+			// The first interval screenshot is due one interval after start
+			ss.LastTriggerTime[trigger] = now
+			return false
+		}
+		if now.Sub(last).Milliseconds() < config.ScreenshotIntervalMs {
+			return false
+		}
+	}
+
+	throttle := time.Duration(config.ScreenshotThrottleMs) * time.Millisecond
+	if !ss.LastCaptureTime.IsZero() && now.Sub(ss.LastCaptureTime) < throttle {
+		ss.ThrottledCount++
+		return false
+	}
+
+	ss.LastCaptureTime = now
+	ss.LastTriggerTime[trigger] = now
+	return true
+}
+
+// GetStatistics returns capture counters
+func (ss *ScreenshotService) GetStatistics() map[string]interface{} {
+	ss.Mutex.Lock()
+	defer ss.Mutex.Unlock()
+
+	return map[string]interface{}{
+		"screenshots_captured":  ss.CapturedCount,
+		"screenshots_throttled": ss.ThrottledCount,
+	}
+}
+
+// Close releases the capture surfaces
+func (ss *ScreenshotService) Close() {
+	ss.Capturer.Close()
+	ss.Duplicator.Close()
+}
+
+// scaleToFit downsamples img with a box filter so it fits within the given
+// maximum dimensions, preserving aspect ratio. Returns nil when no scaling is
+// needed; otherwise the result is a pooled frame buffer.
+func scaleToFit(img *image.RGBA, maxWidth, maxHeight *int) *image.RGBA {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+
+	scale := 1.0
+	if maxWidth != nil && *maxWidth > 0 && width > *maxWidth {
+		scale = float64(*maxWidth) / float64(width)
+	}
+	if maxHeight != nil && *maxHeight > 0 && height > *maxHeight {
+		if s := float64(*maxHeight) / float64(height); s < scale {
+			scale = s
+		}
+	}
+	if scale >= 1.0 {
+		return nil
+	}
+
+	dstWidth := max(1, int(float64(width)*scale))
+	dstHeight := max(1, int(float64(height)*scale))
+	dst := acquireFrameBuffer(dstWidth, dstHeight)
+
+	for dy := 0; dy < dstHeight; dy++ {
+		sy0 := dy * height / dstHeight
+		sy1 := max(sy0+1, (dy+1)*height/dstHeight)
+
+		for dx := 0; dx < dstWidth; dx++ {
+			sx0 := dx * width / dstWidth
+			sx1 := max(sx0+1, (dx+1)*width/dstWidth)
+
+			var r, g, b, count uint32
+			for sy := sy0; sy < sy1; sy++ {
+				row := img.Pix[sy*img.Stride:]
+				for sx := sx0; sx < sx1; sx++ {
+					r += uint32(row[sx*4])
+					g += uint32(row[sx*4+1])
+					b += uint32(row[sx*4+2])
+					count++
+				}
+			}
+
+			i := dy*dst.Stride + dx*4
+			dst.Pix[i] = uint8(r / count)
+			dst.Pix[i+1] = uint8(g / count)
+			dst.Pix[i+2] = uint8(b / count)
+			dst.Pix[i+3] = 255
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,115 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"ui_recorder/storage"
+)
+
+// Content-addressable screenshot store. With ScreenshotStore set, saved
+// recordings keep their screenshots in a shared directory, referring to them
+// by an image_ref such as "sha256:9f86..." (see the storage package). The
+// same dialog captured in fifty recordings is stored once. screenshots gc
+// removes the images no saved recording refers to any more.
+
+// screenshotGCGrace keeps images this new, as they may belong to a
+// recording being saved
+const screenshotGCGrace = time.Hour
+
+type (
+	ScreenshotStore      = storage.ScreenshotStore
+	ScreenshotStoreStats = storage.ScreenshotStoreStats
+)
+
+// NewScreenshotStore returns the configured store, or nil when screenshots
+// are kept in the recordings
+func NewScreenshotStore(config WorkflowRecorderConfig) *ScreenshotStore {
+	if config.ScreenshotStore == "" {
+		return nil
+	}
+	return &ScreenshotStore{Directory: config.ScreenshotStore}
+}
+
+// storeScreenshots puts the screenshots among events into a store and
+// returns the events with each image replaced by its reference, along with
+// the distinct references. The events passed in are not changed.
+func storeScreenshots(s *ScreenshotStore, events []WorkflowEvent) ([]WorkflowEvent, []string, error) {
+	stored := make([]WorkflowEvent, len(events))
+	var refs []string
+	seen := make(map[string]bool)
+	for i, event := range events {
+		stored[i] = event
+		shot, ok := event.(ScreenshotEvent)
+		if !ok || shot.ImageBase64 == "" {
+			continue
+		}
+		image, err := base64.StdEncoding.DecodeString(shot.ImageBase64)
+		if err != nil {
+			return nil, nil, NewWorkflowError(ErrorTypeSerialization, "Failed to decode screenshot", err)
+		}
+		ref, err := s.Put(image)
+		if err != nil {
+			return nil, nil, NewWorkflowError(ErrorTypeFileIO, "Failed to write screenshot to the store", err)
+		}
+		shot.ImageBase64 = ""
+		shot.ImageRef = ref
+		stored[i] = shot
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return stored, refs, nil
+}
+
+// referenceStoredScreenshots adds the reference list for a file written from
+// part of a saved recording, e.g. a segment, whose screenshots are in a store
+func referenceStoredScreenshots(workflow *RecordedWorkflow, filename string) error {
+	if workflow.ScreenshotStore == "" {
+		return nil
+	}
+	var refs []string
+	seen := make(map[string]bool)
+	for _, event := range workflow.Events {
+		var ref string
+		switch event := event.(type) {
+		case ScreenshotEvent:
+			ref = event.ImageRef
+		case json.RawMessage:
+			var probe struct {
+				ImageRef string `json:"image_ref"`
+			}
+			json.Unmarshal(event, &probe)
+			ref = probe.ImageRef
+		}
+		if ref != "" && !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	store := &ScreenshotStore{Directory: workflow.ScreenshotStore}
+	if err := store.AddReferences(filename, refs); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to save screenshot references", err)
+	}
+	return nil
+}
+
+// resolveScreenshots reads the images of screenshots saved as references
+// back into the events
+func resolveScreenshots(s *ScreenshotStore, events []savedEvent) error {
+	for i := range events {
+		event := &events[i]
+		if event.ImageRef == "" || (event.ImageBase64 != nil && *event.ImageBase64 != "") {
+			continue
+		}
+		image, err := s.Get(event.ImageRef)
+		if err != nil {
+			return NewWorkflowError(ErrorTypeFileIO, "Failed to read a stored screenshot", err)
+		}
+		encoded := base64.StdEncoding.EncodeToString(image)
+		event.ImageBase64 = &encoded
+	}
+	return nil
+}
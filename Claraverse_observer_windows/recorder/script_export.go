@@ -0,0 +1,345 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Export of the browser part of a recording as a runnable Python Playwright
+// or Selenium script. Element clicks recorded over the DevTools Protocol keep
+// their CSS selectors; without them, clicks and typing fall back to the
+// accessible button text and field name seen through UI Automation.
+
+// ScriptFormat is the automation framework a script is generated for
+type ScriptFormat string
+
+const (
+	ScriptFormatPlaywright ScriptFormat = "playwright"
+	ScriptFormatSelenium   ScriptFormat = "selenium"
+)
+
+// causedNavigationWindowMs is how soon after a click or Enter a navigation is
+// taken to be its result rather than a URL the user went to directly
+const causedNavigationWindowMs = 3000
+
+// ScriptStepAction is one browser automation action
+type ScriptStepAction string
+
+const (
+	ScriptGoto       ScriptStepAction = "goto"
+	ScriptClick      ScriptStepAction = "click"
+	ScriptFill       ScriptStepAction = "fill"
+	ScriptPressEnter ScriptStepAction = "press_enter"
+	ScriptNote       ScriptStepAction = "note"
+)
+
+// ScriptLocator finds an element by CSS selector, by role and accessible
+// name, or by field label, in that order of preference
+type ScriptLocator struct {
+	CSS   string
+	Role  string
+	Name  string
+	Label string
+}
+
+// ScriptStep is one action of an exported script
+type ScriptStep struct {
+	Action  ScriptStepAction
+	URL     string
+	Locator ScriptLocator
+	Text    string
+}
+
+// scriptSourceEvent holds the fields of a saved event that the exporter
+// reads. Event types are told apart by which fields are present.
+type scriptSourceEvent struct {
+	CDPEvent         CDPEventType  `json:"cdp_event"`
+	Selector         string        `json:"selector"`
+	URL              string        `json:"url"`
+	ToURL            *string       `json:"to_url"`
+	Method           string        `json:"method"`
+	TextValue        *string       `json:"text_value"`
+	FieldName        string        `json:"field_name"`
+	CompletionReason string        `json:"completion_reason"`
+	ButtonText       *string       `json:"button_text"`
+	Metadata         EventMetadata `json:"metadata"`
+}
+
+// pageURL returns the browser URL the event happened on, if any
+func (e scriptSourceEvent) pageURL() string {
+	if e.Metadata.UIElement != nil {
+		return e.Metadata.UIElement.URL
+	}
+	return ""
+}
+
+// buildScriptSteps turns recorded browser events into automation steps
+func buildScriptSteps(events []scriptSourceEvent) []ScriptStep {
+	hasCDP := false
+	for _, event := range events {
+		if event.CDPEvent != "" {
+			hasCDP = true
+			break
+		}
+	}
+
+	var steps []ScriptStep
+	var currentURL string
+	var focused *ScriptLocator
+	var lastActionTime uint64
+
+	navigate := func(url string, timestamp uint64, typed bool) {
+		if !isScriptableURL(url) || url == currentURL {
+			return
+		}
+		caused := !typed && currentURL != "" && lastActionTime > 0 &&
+			timestamp >= lastActionTime && timestamp-lastActionTime <= causedNavigationWindowMs
+		if caused {
+			steps = append(steps, ScriptStep{Action: ScriptNote, Text: "navigates to " + url})
+		} else {
+			steps = append(steps, ScriptStep{Action: ScriptGoto, URL: url})
+		}
+		currentURL = url
+		focused = nil
+	}
+
+	// The first action opens the page it happened on
+	openPage := func(url string) {
+		if currentURL == "" {
+			navigate(url, 0, true)
+		}
+	}
+
+	for _, event := range events {
+		timestamp := event.Metadata.Timestamp
+
+		switch {
+		case event.CDPEvent == CDPNavigation || event.CDPEvent == CDPTabCreated:
+			navigate(event.URL, timestamp, false)
+
+		case event.CDPEvent == CDPElementClicked:
+			if event.Selector == "" {
+				continue
+			}
+			openPage(event.URL)
+			locator := ScriptLocator{CSS: event.Selector}
+			steps = append(steps, ScriptStep{Action: ScriptClick, Locator: locator})
+			focused = &locator
+			lastActionTime = timestamp
+
+		case event.CDPEvent != "":
+			// Submits follow from a recorded click or Enter; tab closes
+			// don't need replaying
+
+		case event.ToURL != nil:
+			if !hasCDP {
+				navigate(*event.ToURL, timestamp, event.Method == string(TabNavigationAddressBar))
+			}
+
+		case event.ButtonText != nil:
+			if hasCDP || *event.ButtonText == "" || event.pageURL() == "" {
+				continue
+			}
+			openPage(event.pageURL())
+			steps = append(steps, ScriptStep{
+				Action:  ScriptClick,
+				Locator: ScriptLocator{Role: "button", Name: *event.ButtonText},
+			})
+			focused = nil
+			lastActionTime = timestamp
+
+		case event.TextValue != nil:
+			if event.pageURL() == "" {
+				continue
+			}
+			openPage(event.pageURL())
+
+			var locator ScriptLocator
+			switch {
+			case focused != nil:
+				locator = *focused
+			case event.FieldName != "":
+				locator = ScriptLocator{Label: event.FieldName}
+			default:
+				steps = append(steps, ScriptStep{Action: ScriptNote, Text: "typed into an unidentified field: " + *event.TextValue})
+				continue
+			}
+
+			steps = append(steps, ScriptStep{Action: ScriptFill, Locator: locator, Text: *event.TextValue})
+			if event.CompletionReason == "enter" {
+				steps = append(steps, ScriptStep{Action: ScriptPressEnter})
+			}
+			lastActionTime = timestamp
+		}
+	}
+
+	return steps
+}
+
+// isScriptableURL excludes browser-internal pages such as the new tab page
+func isScriptableURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") ||
+		strings.HasPrefix(url, "file://")
+}
+
+// renderScript writes steps as a Python script for format
+func renderScript(format ScriptFormat, name string, steps []ScriptStep) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by the ClaraVerse workflow recorder from recording %s\n", pythonString(name))
+
+	switch format {
+	case ScriptFormatPlaywright:
+		b.WriteString("from playwright.sync_api import sync_playwright\n\n")
+		b.WriteString("with sync_playwright() as p:\n")
+		b.WriteString("    browser = p.chromium.launch(headless=False)\n")
+		b.WriteString("    page = browser.new_page()\n")
+		for _, step := range steps {
+			b.WriteString("    " + playwrightStep(step) + "\n")
+		}
+		b.WriteString("    browser.close()\n")
+
+	case ScriptFormatSelenium:
+		b.WriteString("from selenium import webdriver\n")
+		b.WriteString("from selenium.webdriver.common.by import By\n")
+		b.WriteString("from selenium.webdriver.common.keys import Keys\n\n")
+		b.WriteString("driver = webdriver.Chrome()\n")
+		b.WriteString("driver.implicitly_wait(10)\n")
+		b.WriteString("try:\n")
+		for _, step := range steps {
+			for _, line := range seleniumStep(step) {
+				b.WriteString("    " + line + "\n")
+			}
+		}
+		if len(steps) == 0 {
+			b.WriteString("    pass\n")
+		}
+		b.WriteString("finally:\n")
+		b.WriteString("    driver.quit()\n")
+
+	default:
+		return "", NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Unknown script format %q (use playwright or selenium)", format), nil)
+	}
+
+	return b.String(), nil
+}
+
+// playwrightStep renders one step with the Playwright sync API
+func playwrightStep(step ScriptStep) string {
+	switch step.Action {
+	case ScriptGoto:
+		return fmt.Sprintf("page.goto(%s)", pythonString(step.URL))
+	case ScriptClick:
+		return playwrightLocator(step.Locator) + ".click()"
+	case ScriptFill:
+		return fmt.Sprintf("%s.fill(%s)", playwrightLocator(step.Locator), pythonString(step.Text))
+	case ScriptPressEnter:
+		return `page.keyboard.press("Enter")`
+	default:
+		return "# " + pythonComment(step.Text)
+	}
+}
+
+// playwrightLocator renders a locator with the Playwright sync API
+func playwrightLocator(locator ScriptLocator) string {
+	switch {
+	case locator.CSS != "":
+		return fmt.Sprintf("page.locator(%s)", pythonString(locator.CSS))
+	case locator.Role != "":
+		return fmt.Sprintf("page.get_by_role(%s, name=%s)", pythonString(locator.Role), pythonString(locator.Name))
+	default:
+		return fmt.Sprintf("page.get_by_label(%s)", pythonString(locator.Label))
+	}
+}
+
+// seleniumStep renders one step with Selenium WebDriver
+func seleniumStep(step ScriptStep) []string {
+	switch step.Action {
+	case ScriptGoto:
+		return []string{fmt.Sprintf("driver.get(%s)", pythonString(step.URL))}
+	case ScriptClick:
+		return []string{seleniumLocator(step.Locator) + ".click()"}
+	case ScriptFill:
+		return []string{
+			"element = " + seleniumLocator(step.Locator),
+			"element.clear()",
+			fmt.Sprintf("element.send_keys(%s)", pythonString(step.Text)),
+		}
+	case ScriptPressEnter:
+		return []string{"driver.switch_to.active_element.send_keys(Keys.ENTER)"}
+	default:
+		return []string{"# " + pythonComment(step.Text)}
+	}
+}
+
+// seleniumLocator renders a locator as a find_element call, using XPath for
+// the accessible name and label fallbacks
+func seleniumLocator(locator ScriptLocator) string {
+	switch {
+	case locator.CSS != "":
+		return fmt.Sprintf("driver.find_element(By.CSS_SELECTOR, %s)", pythonString(locator.CSS))
+	case locator.Role != "":
+		name := xpathString(locator.Name)
+		xpath := fmt.Sprintf("//button[normalize-space()=%s] | //*[@role=%s and normalize-space()=%s] | //input[@type='submit' and @value=%s]",
+			name, xpathString(locator.Role), name, name)
+		return fmt.Sprintf("driver.find_element(By.XPATH, %s)", pythonString(xpath))
+	default:
+		label := xpathString(locator.Label)
+		xpath := fmt.Sprintf("//*[@aria-label=%s or @placeholder=%s or @name=%s or @id=//label[normalize-space()=%s]/@for]",
+			label, label, label, label)
+		return fmt.Sprintf("driver.find_element(By.XPATH, %s)", pythonString(xpath))
+	}
+}
+
+// pythonString quotes s as a Python string literal. Go's quoting escapes are
+// a subset of Python's.
+func pythonString(s string) string {
+	return strconv.Quote(s)
+}
+
+// pythonComment keeps a comment on one line
+func pythonComment(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// xpathString quotes s as an XPath string literal, which has no escapes
+func xpathString(s string) string {
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`
+	}
+
+	parts := strings.Split(s, "'")
+	for i, part := range parts {
+		parts[i] = "'" + part + "'"
+	}
+	return "concat(" + strings.Join(parts, `, "'", `) + ")"
+}
+
+// exportRecordingScript writes a saved recording as a script next to it,
+// named <base>_<format>.py, and returns the file written
+func exportRecordingScript(filename string, format ScriptFormat) (string, error) {
+	var saved struct {
+		Name   string              `json:"name"`
+		Events []scriptSourceEvent `json:"events"`
+	}
+	if err := LoadRecordingFile(filename, &saved); err != nil {
+		return "", err
+	}
+
+	script, err := renderScript(format, saved.Name, buildScriptSteps(saved.Events))
+	if err != nil {
+		return "", err
+	}
+
+	scriptFile := fmt.Sprintf("%s_%s.py", strings.TrimSuffix(filename, filepath.Ext(filename)), format)
+	if err := os.WriteFile(scriptFile, []byte(script), 0644); err != nil {
+		return "", NewWorkflowError(ErrorTypeFileIO, "Failed to write script", err)
+	}
+	return scriptFile, nil
+}
@@ -0,0 +1,221 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SegmentMarkerType is a user-placed boundary of a task within a recording
+type SegmentMarkerType string
+
+const (
+	SegmentMarkerStart SegmentMarkerType = "SegmentStart"
+	SegmentMarkerEnd   SegmentMarkerType = "SegmentEnd"
+)
+
+// Recorder hotkey actions for segment markers
+const (
+	HotkeyActionSegmentStart = "Mark Segment Start"
+	HotkeyActionSegmentEnd   = "Mark Segment End"
+	HotkeyActionUndoMarker   = "Undo Segment Marker"
+)
+
+// SegmentMarkerEvent marks the start or end of a segment in the timeline
+type SegmentMarkerEvent struct {
+	SegmentMarker SegmentMarkerType `json:"segment_marker"`
+	Metadata      EventMetadata     `json:"metadata"`
+}
+
+// WorkflowSegment is the span of a recording between two markers
+type WorkflowSegment struct {
+	StartTime uint64
+	EndTime   uint64
+	Events    []WorkflowEvent
+}
+
+// handleRecorderHotkey applies segment marker and annotation hotkeys to the
+// recording.
+// Returns false for any other hotkey, which is recorded as usual.
+func (r *Recorder) handleRecorderHotkey(workflow *RecordedWorkflow, events *[]WorkflowEvent, event HotkeyEvent) bool {
+	switch event.Action {
+	case HotkeyActionSegmentStart, HotkeyActionSegmentEnd:
+		marker := SegmentMarkerStart
+		if event.Action == HotkeyActionSegmentEnd {
+			marker = SegmentMarkerEnd
+		}
+		*events = append(*events, SegmentMarkerEvent{SegmentMarker: marker, Metadata: event.Metadata})
+		printConsole(Msg(MsgMarkerSet, marker))
+	case HotkeyActionUndoMarker:
+		if undoSegmentMarker(workflow, events) {
+			printConsole(Msg(MsgMarkerRemoved))
+		} else {
+			printConsole(Msg(MsgNoMarker))
+		}
+	case HotkeyActionAnnotate:
+		r.addAnnotation(workflow, events, event)
+	default:
+		return false
+	}
+	return true
+}
+
+// undoSegmentMarker removes the most recent marker, looking first at events
+// not yet added to the workflow
+func undoSegmentMarker(workflow *RecordedWorkflow, events *[]WorkflowEvent) bool {
+	for i := len(*events) - 1; i >= 0; i-- {
+		if _, isMarker := (*events)[i].(SegmentMarkerEvent); isMarker {
+			*events = append((*events)[:i], (*events)[i+1:]...)
+			return true
+		}
+	}
+
+	if workflow == nil {
+		return false
+	}
+	return workflow.RemoveLastEvent(func(event WorkflowEvent) bool {
+		_, isMarker := event.(SegmentMarkerEvent)
+		return isMarker
+	})
+}
+
+// RemoveLastEvent removes the most recent event matching match
+func (w *RecordedWorkflow) RemoveLastEvent(match func(WorkflowEvent) bool) bool {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	for i := len(w.Events) - 1; i >= 0; i-- {
+		if match(w.Events[i]) {
+			w.Events = append(w.Events[:i], w.Events[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// splitSegments cuts events into the segments delimited by markers. A start
+// inside an open segment closes it and opens the next; an end with no open
+// segment is ignored; a segment still open at the end of the recording runs
+// to endTime. Events outside any segment and the markers themselves are
+// dropped. markerOf reports an event's marker type and timestamp, if any.
+func splitSegments(events []WorkflowEvent, endTime uint64, markerOf func(WorkflowEvent) (SegmentMarkerType, uint64, bool)) []WorkflowSegment {
+	var segments []WorkflowSegment
+	var current *WorkflowSegment
+
+	for _, event := range events {
+		marker, timestamp, isMarker := markerOf(event)
+		if !isMarker {
+			if current != nil {
+				current.Events = append(current.Events, event)
+			}
+			continue
+		}
+
+		if current != nil {
+			current.EndTime = timestamp
+			segments = append(segments, *current)
+			current = nil
+		}
+		if marker == SegmentMarkerStart {
+			current = &WorkflowSegment{StartTime: timestamp}
+		}
+	}
+
+	if current != nil {
+		current.EndTime = endTime
+		segments = append(segments, *current)
+	}
+
+	return segments
+}
+
+// segmentMarkerOf identifies marker events of a live recording
+func segmentMarkerOf(event WorkflowEvent) (SegmentMarkerType, uint64, bool) {
+	if marker, ok := event.(SegmentMarkerEvent); ok {
+		return marker.SegmentMarker, marker.Metadata.Timestamp, true
+	}
+	return "", 0, false
+}
+
+// savedSegmentMarkerOf identifies marker events of a recording loaded from
+// disk, where each event is still raw JSON
+func savedSegmentMarkerOf(event WorkflowEvent) (SegmentMarkerType, uint64, bool) {
+	raw, ok := event.(json.RawMessage)
+	if !ok {
+		return "", 0, false
+	}
+
+	var probe SegmentMarkerEvent
+	if err := json.Unmarshal(raw, &probe); err != nil || probe.SegmentMarker == "" {
+		return "", 0, false
+	}
+	return probe.SegmentMarker, probe.Metadata.Timestamp, true
+}
+
+// saveWorkflowSegments writes one workflow file per marked segment next to
+// filename, named <base>_segment_<n>.json, and returns the files written
+func saveWorkflowSegments(workflow *RecordedWorkflow, filename string, markerOf func(WorkflowEvent) (SegmentMarkerType, uint64, bool)) ([]string, error) {
+	workflow.Mutex.RLock()
+	segments := splitSegments(workflow.Events, workflow.EndTime, markerOf)
+	name := workflow.Name
+	workflow.Mutex.RUnlock()
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	var files []string
+	for i, segment := range segments {
+		segmentFile := fmt.Sprintf("%s_segment_%d.json", base, i+1)
+		segmentWorkflow := &RecordedWorkflow{
+			SchemaVersion: SchemaVersion,
+			Name:          fmt.Sprintf("%s (segment %d)", name, i+1),
+			StartTime:     segment.StartTime,
+			EndTime:       segment.EndTime,
+			Events:        segment.Events,
+			// Saved recordings' screenshots may be in a store
+			ScreenshotStore: workflow.ScreenshotStore,
+		}
+		if segmentWorkflow.Events == nil {
+			segmentWorkflow.Events = []WorkflowEvent{}
+		}
+
+		if err := SaveJSONToFile(segmentWorkflow, segmentFile); err != nil {
+			return files, err
+		}
+		if err := referenceStoredScreenshots(segmentWorkflow, segmentFile); err != nil {
+			return files, err
+		}
+		files = append(files, segmentFile)
+	}
+
+	return files, nil
+}
+
+// exportSavedRecordingSegments splits a saved recording file into one file
+// per marked segment
+func exportSavedRecordingSegments(filename string) ([]string, error) {
+	var saved struct {
+		Name      string            `json:"name"`
+		StartTime uint64            `json:"start_time"`
+		EndTime   uint64            `json:"end_time"`
+		Events    []json.RawMessage `json:"events"`
+		Store     string            `json:"screenshot_store"`
+	}
+	if err := LoadRecordingFile(filename, &saved); err != nil {
+		return nil, err
+	}
+
+	workflow := &RecordedWorkflow{
+		SchemaVersion:   SchemaVersion,
+		Name:            saved.Name,
+		StartTime:       saved.StartTime,
+		EndTime:         saved.EndTime,
+		Events:          make([]WorkflowEvent, len(saved.Events)),
+		ScreenshotStore: saved.Store,
+	}
+	for i, raw := range saved.Events {
+		workflow.Events[i] = raw
+	}
+
+	return saveWorkflowSegments(workflow, filename, savedSegmentMarkerOf)
+}
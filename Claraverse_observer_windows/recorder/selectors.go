@@ -0,0 +1,471 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Selector drift checks. selectors check opens the pages and applications a
+// recording used and looks up every element it recorded: the CSS selectors of
+// DevTools clicks, and the buttons and windows of desktop clicks. Each is
+// reported ok, changed (found, but its text or window title differs from the
+// recording), missing, or unchecked when there was no browser to ask, so a
+// library of recorded workflows can be fixed before a replay fails on them.
+
+var (
+	procEnumWindows     = user32.NewProc("EnumWindows")
+	procIsWindowVisible = user32.NewProc("IsWindowVisible")
+)
+
+const (
+	selectorPageTimeout   = 20 * time.Second
+	selectorLaunchTimeout = 10 * time.Second
+	selectorPollInterval  = 250 * time.Millisecond
+	selectorSettleDelay   = time.Second // For pages that render after load
+)
+
+// Kinds of recorded selector
+const (
+	SelectorCSS     = "css"
+	SelectorDesktop = "desktop"
+)
+
+// SelectorStatus is the outcome of checking one selector
+type SelectorStatus string
+
+const (
+	SelectorOK        SelectorStatus = "ok"
+	SelectorChanged   SelectorStatus = "changed"
+	SelectorMissing   SelectorStatus = "missing"
+	SelectorUnchecked SelectorStatus = "unchecked"
+)
+
+// RecordedSelector is an element a recording located, with what it showed
+// when recorded
+type RecordedSelector struct {
+	Kind        string `json:"kind"` // css or desktop
+	URL         string `json:"url,omitempty"`
+	Selector    string `json:"selector,omitempty"`
+	Application string `json:"application,omitempty"`
+	WindowTitle string `json:"window_title,omitempty"`
+	Role        string `json:"role,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Text        string `json:"text,omitempty"` // Element text, or the window title for windows
+	Uses        int    `json:"uses"`
+}
+
+// ResolvedElement is what a lookup found for a selector
+type ResolvedElement struct {
+	Found bool
+	Text  string
+}
+
+// SelectorCheck is the result for one selector
+type SelectorCheck struct {
+	Selector RecordedSelector `json:"selector"`
+	Status   SelectorStatus   `json:"status"`
+	Found    string           `json:"found,omitempty"`  // Text found now, when changed
+	Detail   string           `json:"detail,omitempty"` // Why a selector is missing or unchecked
+}
+
+// SelectorChecker looks selectors up. ResolvePage answers for every
+// selector of one page at once; a nil ResolvePage leaves CSS selectors
+// unchecked.
+type SelectorChecker struct {
+	ResolvePage   func(url string, selectors []string) ([]ResolvedElement, error)
+	ResolveWindow func(selector RecordedSelector) (ResolvedElement, error)
+}
+
+// runSelectorsCheck checks the selectors of a recording as the command
+// line's --cdp, --launch and --out options say, and reports whether any
+// drifted
+func runSelectorsCheck(filename, store string) (bool, error) {
+	recording, err := LoadSavedRecording(filename, store)
+	if err != nil {
+		return false, err
+	}
+	selectors := recordedSelectors(recording)
+
+	_, launch := commandLineOption("--launch")
+	desktop := &desktopSelectorResolver{Launch: launch, Launched: make(map[string]bool)}
+	checker := SelectorChecker{ResolveWindow: desktop.Resolve}
+
+	// Pages are opened in the browser at --cdp, as when recording
+	var pageError error
+	for _, selector := range selectors {
+		if selector.Kind == SelectorCSS {
+			debuggingURL, _ := commandLineOption("--cdp")
+			if debuggingURL == "" {
+				debuggingURL = defaultCDPDebuggingURL
+			}
+			cdp := NewCDPClient(debuggingURL)
+			if pageError = cdp.dial(); pageError == nil {
+				defer cdp.Close()
+				checker.ResolvePage = cdp.QuerySelectors
+			}
+			break
+		}
+	}
+
+	checks := checker.Check(selectors)
+	counts := make(map[SelectorStatus]int)
+	for _, check := range checks {
+		counts[check.Status]++
+		fmt.Println(describeSelectorCheck(check))
+	}
+	if pageError != nil {
+		fmt.Printf("⚠️  CSS selectors were not checked: %v\n", pageError)
+	}
+	fmt.Println(Msg(MsgSelectorsChecked, len(checks), counts[SelectorOK], counts[SelectorChanged],
+		counts[SelectorMissing], counts[SelectorUnchecked]))
+
+	if out, set := commandLineOption("--out"); set && out != "" {
+		report := map[string]interface{}{
+			"recording":  filename,
+			"checked_at": captureTimestamp(),
+			"selectors":  checks,
+		}
+		if err := SaveJSONToFile(report, out); err != nil {
+			return false, err
+		}
+	}
+	return counts[SelectorChanged]+counts[SelectorMissing] > 0, nil
+}
+
+// recordedSelectors collects the distinct elements a recording located, in
+// the order first used
+func recordedSelectors(recording *SavedRecording) []RecordedSelector {
+	var selectors []RecordedSelector
+	index := make(map[string]int)
+	add := func(key string, selector RecordedSelector) {
+		if i, seen := index[key]; seen {
+			selectors[i].Uses++
+			return
+		}
+		selector.Uses = 1
+		index[key] = len(selectors)
+		selectors = append(selectors, selector)
+	}
+
+	for _, event := range recording.Events {
+		switch {
+		case event.CDPEvent == CDPElementClicked && event.Selector != "":
+			add(SelectorCSS+"\x00"+event.URL+"\x00"+event.Selector, RecordedSelector{
+				Kind:     SelectorCSS,
+				URL:      event.URL,
+				Selector: event.Selector,
+				Text:     event.ElementText,
+			})
+
+		case event.ButtonText != nil && *event.ButtonText != "":
+			element := event.Metadata.UIElement
+			// Clicks in a browser are checked through their CSS selectors
+			if element == nil || element.URL != "" || element.ApplicationName == "" {
+				continue
+			}
+			selector := RecordedSelector{
+				Kind:        SelectorDesktop,
+				Application: element.ApplicationName,
+				WindowTitle: element.WindowTitle,
+				Role:        element.Role,
+				Name:        *event.ButtonText,
+			}
+			if selector.Role == "window" {
+				selector.Text = element.WindowTitle
+			}
+			add(strings.Join([]string{SelectorDesktop, selector.Application, selector.WindowTitle,
+				selector.Role, selector.Name}, "\x00"), selector)
+		}
+	}
+	return selectors
+}
+
+// Check looks up every selector. Each page is opened once for all of its
+// selectors.
+func (c SelectorChecker) Check(selectors []RecordedSelector) []SelectorCheck {
+	checks := make([]SelectorCheck, len(selectors))
+	pages := make(map[string][]int)
+	var urls []string
+	for i, selector := range selectors {
+		checks[i].Selector = selector
+		if selector.Kind == SelectorCSS {
+			if _, seen := pages[selector.URL]; !seen {
+				urls = append(urls, selector.URL)
+			}
+			pages[selector.URL] = append(pages[selector.URL], i)
+			continue
+		}
+		if c.ResolveWindow == nil {
+			checks[i].Status = SelectorUnchecked
+			checks[i].Detail = "no desktop to check with"
+			continue
+		}
+		resolved, err := c.ResolveWindow(selector)
+		checks[i].judge(resolved, err)
+	}
+
+	for _, url := range urls {
+		indexes := pages[url]
+		if c.ResolvePage == nil {
+			for _, i := range indexes {
+				checks[i].Status = SelectorUnchecked
+				checks[i].Detail = "no browser to check with"
+			}
+			continue
+		}
+		cssSelectors := make([]string, len(indexes))
+		for j, i := range indexes {
+			cssSelectors[j] = selectors[i].Selector
+		}
+		resolved, err := c.ResolvePage(url, cssSelectors)
+		for j, i := range indexes {
+			var element ResolvedElement
+			if j < len(resolved) {
+				element = resolved[j]
+			}
+			checks[i].judge(element, err)
+		}
+	}
+	return checks
+}
+
+// judge sets the status from a lookup's result
+func (check *SelectorCheck) judge(resolved ResolvedElement, err error) {
+	switch {
+	case err != nil:
+		check.Status = SelectorMissing
+		check.Detail = err.Error()
+	case !resolved.Found:
+		check.Status = SelectorMissing
+	case check.Selector.Text != "" && !sameSelectorText(check.Selector.Text, resolved.Text):
+		check.Status = SelectorChanged
+		check.Found = resolved.Text
+	default:
+		check.Status = SelectorOK
+	}
+}
+
+// sameSelectorText compares element texts, ignoring case and spacing
+func sameSelectorText(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// describeSelectorCheck returns a one-line console description of a check
+func describeSelectorCheck(check SelectorCheck) string {
+	selector := check.Selector
+	var what string
+	if selector.Kind == SelectorCSS {
+		what = fmt.Sprintf("%s on %s", selector.Selector, selector.URL)
+	} else {
+		what = fmt.Sprintf("%s %q in %s", selector.Role, selector.Name, selector.Application)
+	}
+
+	switch check.Status {
+	case SelectorOK:
+		return "✅ " + what
+	case SelectorChanged:
+		return fmt.Sprintf("🔀 %s: now %q, recorded %q", what, check.Found, selector.Text)
+	case SelectorMissing:
+		if check.Detail != "" {
+			return fmt.Sprintf("❌ %s: %s", what, check.Detail)
+		}
+		return fmt.Sprintf("❌ %s: not found", what)
+	default:
+		return fmt.Sprintf("⚪ %s: not checked, %s", what, check.Detail)
+	}
+}
+
+// selectorQueryScript resolves a JSON array of CSS selectors in the page and
+// returns each element's presence and text as JSON
+const selectorQueryScript = `((selectors) => JSON.stringify(selectors.map(s => {
+  let el = null;
+  try { el = document.querySelector(s); } catch (e) {}
+  return el ? {found: true, text: (el.innerText || el.value || '').trim().slice(0, 100)} : {found: false};
+})))(%s)`
+
+// QuerySelectors opens url in a new background tab, waits for it to load and
+// resolves the selectors in it. The tab is closed afterwards.
+func (c *CDPClient) QuerySelectors(url string, selectors []string) ([]ResolvedElement, error) {
+	result, err := c.call("", "Target.createTarget", map[string]interface{}{"url": url, "background": true})
+	if err != nil {
+		return nil, err
+	}
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	json.Unmarshal(result, &target)
+	defer c.call("", "Target.closeTarget", map[string]interface{}{"targetId": target.TargetID})
+
+	result, err = c.call("", "Target.attachToTarget", map[string]interface{}{"targetId": target.TargetID, "flatten": true})
+	if err != nil {
+		return nil, err
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	json.Unmarshal(result, &attached)
+
+	evaluate := func(expression string) (interface{}, error) {
+		result, err := c.call(attached.SessionID, "Runtime.evaluate",
+			map[string]interface{}{"expression": expression, "returnByValue": true})
+		if err != nil {
+			return nil, err
+		}
+		var evaluated struct {
+			Result struct {
+				Value interface{} `json:"value"`
+			} `json:"result"`
+			ExceptionDetails *struct {
+				Text string `json:"text"`
+			} `json:"exceptionDetails"`
+		}
+		if err := json.Unmarshal(result, &evaluated); err != nil {
+			return nil, err
+		}
+		if evaluated.ExceptionDetails != nil {
+			return nil, fmt.Errorf("%s", evaluated.ExceptionDetails.Text)
+		}
+		return evaluated.Result.Value, nil
+	}
+
+	// Evaluating fails while the page navigates, so errors are retried
+	deadline := time.Now().Add(selectorPageTimeout)
+	for {
+		loaded, err := evaluate(`location.href !== 'about:blank' && document.readyState === 'complete'`)
+		if err == nil && loaded == true {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("page did not load within %s", selectorPageTimeout)
+		}
+		time.Sleep(selectorPollInterval)
+	}
+	time.Sleep(selectorSettleDelay)
+
+	list, _ := json.Marshal(selectors)
+	value, err := evaluate(fmt.Sprintf(selectorQueryScript, list))
+	if err != nil {
+		return nil, err
+	}
+	text, _ := value.(string)
+	var found []struct {
+		Found bool   `json:"found"`
+		Text  string `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(text), &found); err != nil {
+		return nil, fmt.Errorf("unexpected selector result: %v", err)
+	}
+	resolved := make([]ResolvedElement, len(found))
+	for i, element := range found {
+		resolved[i] = ResolvedElement{Found: element.Found, Text: element.Text}
+	}
+	return resolved, nil
+}
+
+// topLevelWindow is a visible top-level window
+type topLevelWindow struct {
+	Handle      uintptr
+	Title       string
+	Application string
+}
+
+// topLevelWindows lists the visible top-level windows that have a title
+func topLevelWindows() []topLevelWindow {
+	var windows []topLevelWindow
+	callback := syscall.NewCallback(func(hwnd, _ uintptr) uintptr {
+		if visible, _, _ := procIsWindowVisible.Call(hwnd); visible == 0 {
+			return 1
+		}
+		textBuf := make([]uint16, 256)
+		procGetWindowText.Call(hwnd, uintptr(unsafe.Pointer(&textBuf[0])), 256)
+		title := syscall.UTF16ToString(textBuf)
+		if title == "" {
+			return 1
+		}
+		var processID uint32
+		procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&processID)))
+		windows = append(windows, topLevelWindow{
+			Handle:      hwnd,
+			Title:       title,
+			Application: applicationName(processID, title),
+		})
+		return 1
+	})
+	procEnumWindows.Call(callback, 0)
+	return windows
+}
+
+// desktopSelectorResolver finds recorded desktop elements in the running
+// applications, starting an application that is not running when Launch is
+// set
+type desktopSelectorResolver struct {
+	Launch   bool
+	Launched map[string]bool
+}
+
+// Resolve finds the selector's window, preferring one with the recorded
+// title, and the named element in it
+func (r *desktopSelectorResolver) Resolve(selector RecordedSelector) (ResolvedElement, error) {
+	windows := r.applicationWindows(selector.Application)
+	if len(windows) == 0 && r.Launch && !r.Launched[selector.Application] {
+		r.Launched[selector.Application] = true
+		if err := exec.Command(selector.Application).Start(); err != nil {
+			return ResolvedElement{}, fmt.Errorf("cannot start %s: %v", selector.Application, err)
+		}
+		for deadline := time.Now().Add(selectorLaunchTimeout); len(windows) == 0 && time.Now().Before(deadline); {
+			time.Sleep(selectorPollInterval)
+			windows = r.applicationWindows(selector.Application)
+		}
+	}
+	if len(windows) == 0 {
+		return ResolvedElement{}, fmt.Errorf("%s is not running", selector.Application)
+	}
+
+	window := windows[0]
+	for _, candidate := range windows {
+		if candidate.Title == selector.WindowTitle {
+			window = candidate
+			break
+		}
+	}
+	if selector.Role == "window" {
+		return ResolvedElement{Found: true, Text: window.Title}, nil
+	}
+
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return ResolvedElement{}, err
+	}
+	defer client.Close()
+
+	root, err := client.ElementFromHandle(window.Handle)
+	if err != nil {
+		return ResolvedElement{}, err
+	}
+	defer root.Release()
+
+	element, err := client.FindFirstByString(root, UIA_NamePropertyId, selector.Name)
+	if err != nil {
+		return ResolvedElement{Found: false}, nil
+	}
+	element.Release()
+	return ResolvedElement{Found: true, Text: selector.Name}, nil
+}
+
+// applicationWindows returns the application's windows, sorted by title
+func (r *desktopSelectorResolver) applicationWindows(application string) []topLevelWindow {
+	var windows []topLevelWindow
+	for _, window := range topLevelWindows() {
+		if strings.EqualFold(window.Application, application) {
+			windows = append(windows, window)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Title < windows[j].Title })
+	return windows
+}
@@ -0,0 +1,207 @@
+package recorder
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"github.com/kbinani/screenshot"
+)
+
+// Startup self-check: before recording, verify that the Win32 struct layouts
+// match this architecture, input can be read, UI Automation is available, the
+// screen can be captured in this session and the recording can be written,
+// and print a checklist. The recorder refuses
+// to start when a required check fails rather than silently recording
+// nothing, black screenshots or a file it cannot save.
+
+var procGetDiskFreeSpaceEx = kernel32.NewProc("GetDiskFreeSpaceExW")
+
+// minFreeDiskBytes is the free space needed to start saving a recording
+const minFreeDiskBytes = 100 << 20
+
+// SelfCheckResult is one line of the startup checklist
+type SelfCheckResult struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Required bool   `json:"required"`
+	Detail   string `json:"detail"`
+}
+
+// RunSelfCheck checks the prerequisites of recording with config, taking
+// screenshots through screenshots and saving to dir
+func RunSelfCheck(config WorkflowRecorderConfig, screenshots *ScreenshotService, dir string) []SelfCheckResult {
+	results := []SelfCheckResult{checkWin32Layout(), checkInputAccess(), checkUIAutomation()}
+	if config.CaptureScreenshots {
+		results = append(results, checkScreenCapture(screenshots.Capturer))
+		if config.ScreenshotCaptureMethod == CaptureMethodDesktopDuplication {
+			results = append(results, checkDesktopDuplication(screenshots.Duplicator))
+		}
+	}
+
+	// A dry run writes nothing
+	write, disk := checkWritePermission(dir), checkDiskSpace(dir, minFreeDiskBytes)
+	write.Required = !config.DryRun
+	disk.Required = !config.DryRun
+	return append(results, write, disk)
+}
+
+// selfCheckPassed reports whether every required check passed
+func selfCheckPassed(results []SelfCheckResult) bool {
+	for _, result := range results {
+		if result.Required && !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// printSelfCheck prints the checklist
+func printSelfCheck(results []SelfCheckResult) {
+	printConsole(Msg(MsgSelfCheckTitle))
+	for _, result := range results {
+		if result.Passed {
+			printConsole(fmt.Sprintf("   ✅ %s: %s", result.Name, result.Detail))
+			continue
+		}
+		mark := "⚠️ "
+		if result.Required {
+			mark = "❌"
+		}
+		printConsoleWarning(fmt.Sprintf("   %s %s: %s", mark, result.Name, result.Detail))
+	}
+}
+
+// checkInputAccess checks the cursor can be read, which fails without an
+// interactive desktop (a service session or the secure desktop)
+func checkInputAccess() SelfCheckResult {
+	result := SelfCheckResult{Name: Msg(MsgCheckInput), Required: true}
+
+	var point POINT
+	ret, _, err := procGetCursorPos.Call(uintptr(unsafe.Pointer(&point)))
+	if ret == 0 {
+		result.Detail = Msg(MsgCheckCursorFailed, err)
+		return result
+	}
+
+	result.Passed = true
+	result.Detail = Msg(MsgCheckCursorAt, point.X, point.Y)
+	return result
+}
+
+// checkUIAutomation checks a UI Automation client can be created. Without
+// it text selection and field values fall back to the clipboard.
+func checkUIAutomation() SelfCheckResult {
+	result := SelfCheckResult{Name: Msg(MsgCheckUIAutomation)}
+
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	client.Close()
+
+	result.Passed = true
+	result.Detail = Msg(MsgCheckAvailable)
+	return result
+}
+
+// checkScreenCapture captures the primary display and checks the image is
+// not blank, as it is in a disconnected remote session
+func checkScreenCapture(capturer *FrameCapturer) SelfCheckResult {
+	result := SelfCheckResult{Name: Msg(MsgCheckScreen), Required: true}
+
+	bounds := screenshot.GetDisplayBounds(0)
+	img, err := capturer.Capture(bounds)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	defer releaseFrameBuffer(img)
+
+	if isBlankImage(img) {
+		result.Detail = Msg(MsgCheckBlackScreen)
+		return result
+	}
+
+	result.Passed = true
+	result.Detail = fmt.Sprintf("%dx%d", bounds.Dx(), bounds.Dy())
+	return result
+}
+
+// checkDesktopDuplication checks the primary display can be duplicated.
+// Screenshots fall back to GDI when it cannot, so it is not required.
+func checkDesktopDuplication(duplicator *DesktopDuplicator) SelfCheckResult {
+	result := SelfCheckResult{Name: Msg(MsgCheckDuplication)}
+
+	bounds := screenshot.GetDisplayBounds(0)
+	img, _, err := duplicator.Capture(bounds)
+	if err != nil {
+		result.Detail = Msg(MsgCheckDuplicationGDI, err)
+		return result
+	}
+	defer releaseFrameBuffer(img)
+
+	result.Passed = true
+	result.Detail = fmt.Sprintf("%dx%d", bounds.Dx(), bounds.Dy())
+	return result
+}
+
+// checkWritePermission checks a file can be created in dir
+func checkWritePermission(dir string) SelfCheckResult {
+	result := SelfCheckResult{Name: Msg(MsgCheckWrite)}
+
+	absolute, _ := filepath.Abs(dir)
+	file, err := os.CreateTemp(dir, ".recorder-self-check-*")
+	if err != nil {
+		result.Detail = Msg(MsgCheckWriteFailed, absolute, err)
+		return result
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	result.Passed = true
+	result.Detail = absolute
+	return result
+}
+
+// checkDiskSpace checks the volume holding dir has at least minFree bytes
+// available
+func checkDiskSpace(dir string, minFree uint64) SelfCheckResult {
+	result := SelfCheckResult{Name: Msg(MsgCheckDisk)}
+
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	var available uint64
+	ret, _, err := procGetDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&available)), 0, 0)
+	if ret == 0 {
+		result.Detail = Msg(MsgCheckFreeSpaceFailed, err)
+		return result
+	}
+
+	result.Detail = Msg(MsgCheckFreeSpace, available>>20)
+	if available < minFree {
+		result.Detail += Msg(MsgCheckNeedSpace, minFree>>20)
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// isBlankImage reports whether every sampled pixel of img is black
+func isBlankImage(img *image.RGBA) bool {
+	const sampleStep = 7 // Pixels, so rows are not sampled in the same columns
+	for i := 0; i+3 < len(img.Pix); i += sampleStep * 4 {
+		if img.Pix[i] != 0 || img.Pix[i+1] != 0 || img.Pix[i+2] != 0 {
+			return false
+		}
+	}
+	return true
+}
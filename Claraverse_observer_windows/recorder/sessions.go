@@ -0,0 +1,342 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Named recording sessions. A SessionManager keeps any number of sessions
+// for the life of the process, each with its own config snapshot, output
+// directory and statistics, and records them through the shared
+// RecordingController. Input is captured once per desktop, so one session
+// records at a time; while it does, its config is the recorder's config.
+// Sessions are created over the control API, which only clients holding
+// its token can reach (see http_api_auth.go). A token is not a licence to
+// run anything, though, so a session may only change sessionConfigFields:
+// what is recorded and how, never a command to run, an endpoint to send to
+// or a file outside the recorder's output directory.
+
+// sessionConfigFields are the config fields a session may set
+var sessionConfigFields = map[string]bool{
+	"RecordMouse": true, "RecordKeyboard": true, "CaptureUIElements": true, "RecordClipboard": true,
+	"RecordHotkeys": true, "RecordTextInputCompletion": true, "TextInputCompletionTimeoutMs": true,
+	"RecordApplicationSwitches": true, "RecordBrowserTabNavigation": true, "RecordTextSelection": true,
+	"RecordDragDrop": true, "RecordWindowGeometry": true, "RecordWindowTitles": true, "RecordProcesses": true,
+	"RecordMenuSelections": true, "RecordDialogs": true, "RecordFocusChanges": true, "OfficeContext": true,
+	"MaxClipboardContentLength": true, "ExcludePasswordFields": true, "StrictPrivacy": true, "MaskPII": true,
+	"PIIEntities": true, "MaxRecordingMinutes": true, "MaxRecordingSizeMB": true, "RotateRecording": true,
+	"KeyboardMode": true, "MouseMoveThrottleMs": true, "MinDragDistance": true, "DedupeWindowMs": true,
+	"FilterMouseNoise": true, "FilterKeyboardNoise": true, "ReduceUIElementCapture": true,
+	"CaptureScreenshots": true, "ScreenshotOnMouseClick": true, "ActionScreenshotPairs": true,
+	"ActionScreenshotSettleMs": true, "ScreenshotOnKeyboardEvent": true, "ScreenshotHotkeys": true,
+	"ScreenshotOnInterval": true, "ScreenshotIntervalMs": true, "ScreenshotThrottleMs": true,
+	"ScreenshotOnAppSwitch": true, "ScreenshotFormat": true, "ScreenshotJPEGQuality": true,
+	"AnnotateScreenshots": true, "MaxScreenshotWidth": true, "MaxScreenshotHeight": true,
+	"IgnoreFocusPatterns": true, "IgnoreWindowTitles": true, "IgnoreApplications": true,
+	"OutputDirectory": true,
+}
+
+// SessionStatistics totals the recordings a session has saved
+type SessionStatistics struct {
+	Recordings int    `json:"recordings"`
+	Events     int    `json:"events"`
+	DurationMs uint64 `json:"duration_ms"`
+	LastFile   string `json:"last_file,omitempty"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// RecordingSession is a named set of recording settings
+type RecordingSession struct {
+	Name      string
+	Config    WorkflowRecorderConfig
+	CreatedAt time.Time
+	Stats     SessionStatistics
+}
+
+// SessionInfo describes a session in the control API
+type SessionInfo struct {
+	Name            string            `json:"name"`
+	OutputDirectory string            `json:"output_directory"`
+	CreatedAt       string            `json:"created_at"`
+	Recording       bool              `json:"recording"`
+	Statistics      SessionStatistics `json:"statistics"`
+}
+
+// SessionManager creates, records and removes named sessions
+type SessionManager struct {
+	Controller *RecordingController
+	Sessions   map[string]*RecordingSession
+	Active     string // Session being recorded, if any
+
+	// baseConfig is the recorder's config before the active session
+	// replaced it
+	baseConfig WorkflowRecorderConfig
+	Mutex      sync.Mutex
+}
+
+// NewSessionManager creates a manager with no sessions
+func NewSessionManager(controller *RecordingController) *SessionManager {
+	return &SessionManager{
+		Controller: controller,
+		Sessions:   make(map[string]*RecordingSession),
+	}
+}
+
+// Create adds a session whose config is the recorder's current config with
+// overrides applied. overrides is a JSON object of sessionConfigFields, e.g.
+// {"CaptureScreenshots": false, "OutputDirectory": "a"}, or nil. The output
+// directory is taken within the recorder's own.
+func (m *SessionManager) Create(name string, overrides json.RawMessage) (SessionInfo, error) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.settle()
+
+	if name == "" {
+		return SessionInfo{}, NewWorkflowError(ErrorTypeConfiguration, "Session name is required", nil)
+	}
+	if _, exists := m.Sessions[name]; exists {
+		return SessionInfo{}, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Session %q already exists", name), nil)
+	}
+
+	config := m.Controller.Recorder.currentConfig()
+	if m.Active != "" {
+		config = m.baseConfig
+	}
+	if len(overrides) > 0 {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(overrides, &fields); err != nil {
+			return SessionInfo{}, NewWorkflowError(ErrorTypeConfiguration, "Invalid session config", err)
+		}
+		for field := range fields {
+			if !sessionConfigFields[field] {
+				return SessionInfo{}, NewWorkflowError(ErrorTypeConfiguration,
+					fmt.Sprintf("A session cannot set %s", field), nil)
+			}
+		}
+		base := config.OutputDirectory
+		decoder := json.NewDecoder(bytes.NewReader(overrides))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return SessionInfo{}, NewWorkflowError(ErrorTypeConfiguration, "Invalid session config", err)
+		}
+		if _, set := fields["OutputDirectory"]; set {
+			directory, err := sessionOutputDirectory(base, config.OutputDirectory)
+			if err != nil {
+				return SessionInfo{}, err
+			}
+			config.OutputDirectory = directory
+		}
+	}
+	if err := ValidateConfig(&config); err != nil {
+		return SessionInfo{}, err
+	}
+
+	session := &RecordingSession{Name: name, Config: config, CreatedAt: time.Now()}
+	m.Sessions[name] = session
+	return m.info(session), nil
+}
+
+// Start records the named session under its own config
+func (m *SessionManager) Start(name string) error {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.settle()
+
+	session, ok := m.Sessions[name]
+	if !ok {
+		return NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("No session named %q", name), nil)
+	}
+	if m.Active != "" {
+		return NewWorkflowError(ErrorTypeRecording,
+			fmt.Sprintf("Session %q is recording; stop it before starting %q", m.Active, name), nil)
+	}
+	if m.Controller.IsRecording() {
+		return NewWorkflowError(ErrorTypeRecording, "Recording already in progress", nil)
+	}
+
+	m.baseConfig = m.Controller.Recorder.currentConfig()
+	m.Controller.Recorder.setConfig(session.Config)
+	if err := m.Controller.Start(name); err != nil {
+		m.Controller.Recorder.setConfig(m.baseConfig)
+		return err
+	}
+	m.Active = name
+	return nil
+}
+
+// Stop saves the named session's recording to its output directory and
+// adds it to the session's statistics
+func (m *SessionManager) Stop(name string) (*RecordedWorkflow, string, error) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.settle()
+
+	session, ok := m.Sessions[name]
+	if !ok {
+		return nil, "", NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("No session named %q", name), nil)
+	}
+	if m.Active != name {
+		return nil, "", NewWorkflowError(ErrorTypeRecording, fmt.Sprintf("Session %q is not recording", name), nil)
+	}
+
+	workflow, filename, err := m.Controller.StopAndSave()
+	m.Controller.Recorder.setConfig(m.baseConfig)
+	m.Active = ""
+
+	if err != nil {
+		session.Stats.LastError = err.Error()
+		return workflow, "", err
+	}
+	session.Stats.Recordings++
+	session.Stats.Events += workflow.EventCount()
+	session.Stats.DurationMs += workflow.EndTime - workflow.StartTime
+	session.Stats.LastFile = filename
+	session.Stats.LastError = ""
+	return workflow, filename, nil
+}
+
+// Remove deletes a session that is not recording
+func (m *SessionManager) Remove(name string) error {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.settle()
+
+	if _, ok := m.Sessions[name]; !ok {
+		return NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf("No session named %q", name), nil)
+	}
+	if m.Active == name {
+		return NewWorkflowError(ErrorTypeRecording, fmt.Sprintf("Session %q is recording", name), nil)
+	}
+	delete(m.Sessions, name)
+	return nil
+}
+
+// Get describes the named session
+func (m *SessionManager) Get(name string) (SessionInfo, bool) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.settle()
+
+	session, ok := m.Sessions[name]
+	if !ok {
+		return SessionInfo{}, false
+	}
+	return m.info(session), true
+}
+
+// List describes all sessions, by name
+func (m *SessionManager) List() []SessionInfo {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.settle()
+
+	sessions := make([]SessionInfo, 0, len(m.Sessions))
+	for _, session := range m.Sessions {
+		sessions = append(sessions, m.info(session))
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+	return sessions
+}
+
+// ActiveSession returns the name of the session being recorded, or ""
+func (m *SessionManager) ActiveSession() string {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.settle()
+
+	return m.Active
+}
+
+// OutputDirectories returns where saved recordings are: the recorder's own
+// output directory, then each session's within it
+func (m *SessionManager) OutputDirectories() []string {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.settle()
+
+	base := m.Controller.Recorder.currentConfig().OutputDirectory
+	if m.Active != "" {
+		base = m.baseConfig.OutputDirectory
+	}
+	names := make([]string, 0, len(m.Sessions))
+	for name := range m.Sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	directories := []string{base}
+	if base == "" {
+		directories[0] = "."
+	}
+	for _, name := range names {
+		requested := m.Sessions[name].Config.OutputDirectory
+		if requested == base {
+			continue
+		}
+		// A session made before the recorder's own directory changed may
+		// no longer be within it
+		if directory, err := sessionOutputDirectory(base, requested); err == nil && !slices.Contains(directories, directory) {
+			directories = append(directories, directory)
+		}
+	}
+	return directories
+}
+
+// sessionOutputDirectory resolves a session's output directory, relative
+// to base, the recorder's own, to an absolute path, and refuses one
+// outside base
+func sessionOutputDirectory(base, requested string) (string, error) {
+	if base == "" {
+		base = "."
+	}
+	directory := requested
+	if !filepath.IsAbs(directory) {
+		directory = filepath.Join(base, directory)
+	}
+	baseAbs, err := filepath.Abs(base)
+	if err != nil {
+		return "", NewWorkflowError(ErrorTypeConfiguration, "Invalid output directory", err)
+	}
+	directoryAbs, err := filepath.Abs(directory)
+	if err != nil {
+		return "", NewWorkflowError(ErrorTypeConfiguration, "Invalid session output directory", err)
+	}
+	if rel, err := filepath.Rel(baseAbs, directoryAbs); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Session output directory %q is outside %q", requested, base), nil)
+	}
+	return directoryAbs, nil
+}
+
+// settle restores the base config when the active session's recording was
+// stopped other than through the manager, e.g. from the console. Such a
+// recording is not added to the session's statistics.
+func (m *SessionManager) settle() {
+	if m.Active != "" && !m.Controller.IsRecording() {
+		m.Controller.Recorder.setConfig(m.baseConfig)
+		m.Active = ""
+	}
+}
+
+// info describes a session
+func (m *SessionManager) info(session *RecordingSession) SessionInfo {
+	outputDirectory := session.Config.OutputDirectory
+	if outputDirectory == "" {
+		outputDirectory = "."
+	}
+	return SessionInfo{
+		Name:            session.Name,
+		OutputDirectory: outputDirectory,
+		CreatedAt:       session.CreatedAt.Format(time.RFC3339),
+		Recording:       m.Active == session.Name,
+		Statistics:      session.Stats,
+	}
+}
@@ -0,0 +1,195 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Single-instance guard: two recorders in the same session would capture
+// every event twice. The first instance holds a named mutex and listens on a
+// named stop event. A later instance refuses to start unless given
+// --takeover, in which case it signals the event, the running instance stops
+// and saves its recording as on Ctrl+C, and the new one starts once the
+// mutex is gone.
+
+var (
+	procCreateMutex         = kernel32.NewProc("CreateMutexW")
+	procCreateEvent         = kernel32.NewProc("CreateEventW")
+	procOpenEvent           = kernel32.NewProc("OpenEventW")
+	procSetEvent            = kernel32.NewProc("SetEvent")
+	procWaitForSingleObject = kernel32.NewProc("WaitForSingleObject")
+)
+
+const (
+	ERROR_ALREADY_EXISTS = 183
+	EVENT_MODIFY_STATE   = 0x0002
+	WAIT_OBJECT_0        = 0
+	INFINITE             = 0xFFFFFFFF
+
+	// Local\ names are per session, so other users' recorders are unaffected
+	recorderInstanceName = `Local\ClaraVerseWorkflowRecorder`
+
+	takeoverTimeout      = 30 * time.Second
+	takeoverPollInterval = 200 * time.Millisecond
+)
+
+// InstanceGuard marks this process as the session's recorder until closed
+type InstanceGuard struct {
+	Name      string
+	mutex     uintptr
+	stopEvent uintptr
+	stop      chan struct{}
+}
+
+// AcquireInstanceGuard claims the named instance. When another process holds
+// it, takeover asks that process to stop and waits up to timeout for it to
+// exit; otherwise an error is returned.
+func AcquireInstanceGuard(name string, takeover bool, timeout time.Duration) (*InstanceGuard, error) {
+	mutex, exists, err := createNamedMutex(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		procCloseHandle.Call(mutex)
+		if !takeover {
+			return nil, NewWorkflowError(ErrorTypeInitialization,
+				"Another recorder is already running in this session; pass --takeover to stop it and start this one", nil)
+		}
+		if err := requestInstanceStop(name); err != nil {
+			return nil, err
+		}
+		if mutex, err = waitForInstanceExit(name, timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	stopEvent, err := createNamedEvent(name + "Stop")
+	if err != nil {
+		procCloseHandle.Call(mutex)
+		return nil, err
+	}
+
+	guard := &InstanceGuard{
+		Name:      name,
+		mutex:     mutex,
+		stopEvent: stopEvent,
+		stop:      make(chan struct{}),
+	}
+	go guard.waitForStopRequest()
+	return guard, nil
+}
+
+// StopRequests is closed when another instance takes over
+func (g *InstanceGuard) StopRequests() <-chan struct{} {
+	return g.stop
+}
+
+// Close gives up the instance so another recorder can start
+func (g *InstanceGuard) Close() {
+	if g.mutex != 0 {
+		procCloseHandle.Call(g.mutex)
+		g.mutex = 0
+	}
+}
+
+// stopForTakeover saves the active recording and exits, for front ends such
+// as MCP that have no console loop to return to
+func stopForTakeover(controller *RecordingController) {
+	logger("instance").Info("Another recorder instance is taking over, stopping")
+	if controller.IsRecording() {
+		if _, filename, err := controller.StopAndSave(); err != nil {
+			logger("instance").Error("Failed to save recording before takeover", "error", err)
+		} else {
+			logger("instance").Info("Recording saved", "file", filename)
+		}
+	}
+	controller.Recorder.Screenshots.Close()
+	if telemetry := controller.Recorder.Telemetry; telemetry != nil {
+		telemetry.Close()
+	}
+	os.Exit(0)
+}
+
+// waitForStopRequest closes the stop channel when the stop event is set.
+// The event handle stays open for the life of the process so the wait is
+// never cut short.
+func (g *InstanceGuard) waitForStopRequest() {
+	ret, _, _ := procWaitForSingleObject.Call(g.stopEvent, INFINITE)
+	if ret == WAIT_OBJECT_0 {
+		close(g.stop)
+	}
+}
+
+// requestInstanceStop sets the running instance's stop event
+func requestInstanceStop(name string) error {
+	eventName, err := syscall.UTF16PtrFromString(name + "Stop")
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSystem, "Invalid instance name", err)
+	}
+
+	event, _, err := procOpenEvent.Call(EVENT_MODIFY_STATE, 0, uintptr(unsafe.Pointer(eventName)))
+	if event == 0 {
+		return NewWorkflowError(ErrorTypeSystem, "The running recorder cannot be asked to stop", err)
+	}
+	defer procCloseHandle.Call(event)
+
+	if ret, _, err := procSetEvent.Call(event); ret == 0 {
+		return NewWorkflowError(ErrorTypeSystem, "Failed to ask the running recorder to stop", err)
+	}
+	return nil
+}
+
+// waitForInstanceExit polls until no other process holds the named mutex and
+// returns a handle to it
+func waitForInstanceExit(name string, timeout time.Duration) (uintptr, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(takeoverPollInterval)
+
+		mutex, exists, err := createNamedMutex(name)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return mutex, nil
+		}
+		procCloseHandle.Call(mutex)
+	}
+
+	return 0, NewWorkflowError(ErrorTypeInitialization,
+		fmt.Sprintf("The running recorder did not stop within %v", timeout), nil)
+}
+
+// createNamedMutex opens or creates the named mutex and reports whether it
+// already existed. Only the mutex's existence is used, not its ownership,
+// which Windows ties to an OS thread rather than a goroutine.
+func createNamedMutex(name string) (uintptr, bool, error) {
+	mutexName, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, false, NewWorkflowError(ErrorTypeSystem, "Invalid instance name", err)
+	}
+
+	mutex, _, err := procCreateMutex.Call(0, 0, uintptr(unsafe.Pointer(mutexName)))
+	if mutex == 0 {
+		return 0, false, NewWorkflowError(ErrorTypeSystem, "Failed to create the instance mutex", err)
+	}
+	return mutex, err == syscall.Errno(ERROR_ALREADY_EXISTS), nil
+}
+
+// createNamedEvent creates an auto-reset event, initially not set
+func createNamedEvent(name string) (uintptr, error) {
+	eventName, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, NewWorkflowError(ErrorTypeSystem, "Invalid instance name", err)
+	}
+
+	event, _, err := procCreateEvent.Call(0, 0, 0, uintptr(unsafe.Pointer(eventName)))
+	if event == 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "Failed to create the instance stop event", err)
+	}
+	return event, nil
+}
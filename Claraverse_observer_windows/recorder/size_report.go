@@ -0,0 +1,215 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"ui_recorder/storage"
+)
+
+// Size accounting. Each event's serialized size is added up per event type
+// as it is recorded, for /status, and the size-report command breaks a saved
+// recording down the same way, with hints at the options that shrink its
+// largest part, so a user whose file is nearly all screenshots can see it
+// and tune the capture.
+
+// sizeHintShare is the share of a recording above which a part gets a hint
+const sizeHintShare = 30.0
+
+// savedEventTypes tell the types of saved events apart by a field only that
+// type has, checked in order
+var savedEventTypes = []struct{ Field, Type string }{
+	{"image_base64", "ScreenshotEvent"},
+	{"key_code", "KeyboardEvent"},
+	{"event_type", "MouseEvent"},
+	{"content_size", "ClipboardEvent"},
+	{"combination", "HotkeyEvent"},
+	{"to_application", "ApplicationSwitchEvent"},
+	{"button_text", "ButtonClickEvent"},
+	{"text_value", "TextInputCompletedEvent"},
+	{"selected_text", "TextSelectionEvent"},
+	{"start_position", "DragDropEvent"},
+	{"cdp_event", "BrowserCDPEvent"},
+	{"browser", "BrowserTabNavigationEvent"},
+	{"segment_marker", "SegmentMarkerEvent"},
+	{"recording_marker", "RecordingMarkerEvent"},
+	{"annotation", "AnnotationEvent"},
+	{"quota_exceeded", "QuotaExceededEvent"},
+	{"recording_rotated", "RecordingRotatedEvent"},
+	{"session_interrupted", "SessionInterruptedEvent"},
+	{"command", "CommandEnteredEvent"},
+	{"fullscreen", "FullscreenChangedEvent"},
+	{"idle", "IdleEvent"},
+	{"bookmark", "BookmarkEvent"},
+	{"recorder_recovered", "RecorderRecoveredEvent"},
+	{"window_change", "WindowGeometryEvent"},
+	{"file_activity", "FileActivityEvent"},
+	{"process", "ProcessEvent"},
+	{"menu_path", "MenuItemSelectedEvent"},
+	{"dialog", "DialogEvent"},
+	{"file_dialog", "FileDialogEvent"},
+	{"focus_role", "FocusChangedEvent"},
+	{"previous_title", "WindowTitleChangedEvent"},
+}
+
+// sizeHints are the options that make each kind of event smaller or rarer
+var sizeHints = map[string]string{
+	"ScreenshotEvent": "--screenshot-format=jpeg, a lower --screenshot-jpeg-quality, --max-screenshot-width, " +
+		"a longer --screenshot-interval-ms, or --screenshot-store to keep images out of the file",
+	"MouseEvent":     "--filter-mouse-noise or a longer --mouse-move-throttle-ms",
+	"KeyboardEvent":  "--filter-keyboard-noise, leaving typed text to the text input events",
+	"ClipboardEvent": "a lower --max-clipboard-content-length",
+}
+
+// SizeReportEntry is the size of one kind of event, or of another part of
+// the recording file
+type SizeReportEntry struct {
+	Part  string  `json:"part"` // Event type, or a recording field such as "segments"
+	Count int     `json:"count,omitempty"`
+	Bytes int64   `json:"bytes"`
+	Share float64 `json:"share"` // Percent of the file
+}
+
+// SizeReport breaks a saved recording down by size
+type SizeReport struct {
+	File                  string            `json:"file"`
+	TotalBytes            int64             `json:"total_bytes"`
+	Parts                 []SizeReportEntry `json:"parts"`
+	StoredScreenshots     int               `json:"stored_screenshots,omitempty"`      // Kept in the screenshot store instead
+	StoredScreenshotBytes int64             `json:"stored_screenshot_bytes,omitempty"` // Their size in the store, where found
+	Hints                 []string          `json:"hints,omitempty"`
+}
+
+// savedEventType names the type of a saved event from its fields
+func savedEventType(fields map[string]json.RawMessage) string {
+	for _, candidate := range savedEventTypes {
+		if _, ok := fields[candidate.Field]; ok {
+			return candidate.Type
+		}
+	}
+	return "other events"
+}
+
+// rawEventType names the type of a saved event
+func rawEventType(raw json.RawMessage) string {
+	var fields map[string]json.RawMessage
+	json.Unmarshal(raw, &fields)
+	return savedEventType(fields)
+}
+
+// buildSizeReport breaks a saved recording file down by size
+func buildSizeReport(filename string) (*SizeReport, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, NewWorkflowError(ErrorTypeFileIO, "Failed to read recording", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to parse recording", err)
+	}
+	if _, ok := fields["chunks"]; ok {
+		return nil, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("%s is a chunk manifest; report on the recording it was saved as", filename), nil)
+	}
+	var events []json.RawMessage
+	if err := json.Unmarshal(fields["events"], &events); err != nil {
+		return nil, NewWorkflowError(ErrorTypeSerialization, "Failed to parse recording events", err)
+	}
+	var store string
+	json.Unmarshal(fields["screenshot_store"], &store)
+
+	report := &SizeReport{File: filename, TotalBytes: int64(len(data))}
+	parts := make(map[string]*SizeReportEntry)
+	add := func(part string, bytes int64) {
+		if parts[part] == nil {
+			parts[part] = &SizeReportEntry{Part: part}
+		}
+		parts[part].Count++
+		parts[part].Bytes += bytes
+	}
+
+	storedRefs := make(map[string]bool)
+	var counted int64
+	for _, raw := range events {
+		var eventFields map[string]json.RawMessage
+		json.Unmarshal(raw, &eventFields)
+		add(savedEventType(eventFields), int64(len(raw)))
+		counted += int64(len(raw))
+
+		var ref string
+		if json.Unmarshal(eventFields["image_ref"], &ref) == nil && ref != "" && !storedRefs[ref] {
+			storedRefs[ref] = true
+			report.StoredScreenshots++
+			if hash, ok := storage.RefHash(ref); ok && store != "" {
+				if info, err := os.Stat((&ScreenshotStore{Directory: store}).ObjectPath(hash)); err == nil {
+					report.StoredScreenshotBytes += info.Size()
+				}
+			}
+		}
+	}
+	for field, raw := range fields {
+		if field != "events" && len(raw) > 0 {
+			add(field, int64(len(raw)))
+			parts[field].Count = 0
+			counted += int64(len(raw))
+		}
+	}
+	if layout := report.TotalBytes - counted; layout > 0 {
+		add("layout", layout)
+		parts["layout"].Count = 0
+	}
+
+	for _, entry := range parts {
+		if report.TotalBytes > 0 {
+			entry.Share = float64(entry.Bytes) * 100 / float64(report.TotalBytes)
+		}
+		report.Parts = append(report.Parts, *entry)
+		if hint, ok := sizeHints[entry.Part]; ok && entry.Share >= sizeHintShare {
+			report.Hints = append(report.Hints, fmt.Sprintf("%s are %.0f%% of the file: %s", entry.Part, entry.Share, hint))
+		}
+	}
+	sort.Slice(report.Parts, func(i, j int) bool {
+		if report.Parts[i].Bytes != report.Parts[j].Bytes {
+			return report.Parts[i].Bytes > report.Parts[j].Bytes
+		}
+		return report.Parts[i].Part < report.Parts[j].Part
+	})
+	sort.Strings(report.Hints)
+	return report, nil
+}
+
+// Text renders the report as a table, largest part first
+func (r *SizeReport) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", r.File, FormatBytes(r.TotalBytes))
+	for _, part := range r.Parts {
+		count := ""
+		if part.Count > 0 {
+			count = fmt.Sprintf("%d", part.Count)
+		}
+		fmt.Fprintf(&b, "  %-28s %8s %10s %6.1f%%\n", part.Part, count, FormatBytes(part.Bytes), part.Share)
+	}
+	if r.StoredScreenshots > 0 {
+		fmt.Fprintf(&b, "  %d screenshot(s) kept in the screenshot store, %s there\n",
+			r.StoredScreenshots, FormatBytes(r.StoredScreenshotBytes))
+	}
+	for _, hint := range r.Hints {
+		b.WriteString("Hint: " + hint + "\n")
+	}
+	return b.String()
+}
+
+// EventSizes returns the estimated serialized bytes recorded per event type
+func (w *RecordedWorkflow) EventSizes() map[string]int64 {
+	w.Mutex.RLock()
+	defer w.Mutex.RUnlock()
+
+	sizes := make(map[string]int64, len(w.TypeSizes))
+	for eventType, size := range w.TypeSizes {
+		sizes[eventType] = size
+	}
+	return sizes
+}
@@ -0,0 +1,213 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Post-processing pass that collapses the raw events of a recording into
+// high-level steps, saved as "steps" next to the events. The several events
+// one physical click produces (mouse click, button click, browser click) and
+// the click that focused a field before typing into it become one step.
+
+// stepMergeWindowMs is how close together events must be to count as the
+// same action
+const stepMergeWindowMs = 500
+
+// Sources of a click step; one physical click produces at most one of each
+const (
+	clickFromMouse = 1 << iota
+	clickFromButton
+	clickFromBrowser
+)
+
+// friendlyApplicationNames names common applications the way users do
+var friendlyApplicationNames = map[string]string{
+	"chrome.exe":   "Chrome",
+	"msedge.exe":   "Edge",
+	"firefox.exe":  "Firefox",
+	"brave.exe":    "Brave",
+	"opera.exe":    "Opera",
+	"winword.exe":  "Word",
+	"excel.exe":    "Excel",
+	"powerpnt.exe": "PowerPoint",
+	"outlook.exe":  "Outlook",
+	"onenote.exe":  "OneNote",
+	"notepad.exe":  "Notepad",
+	"explorer.exe": "File Explorer",
+	"code.exe":     "VS Code",
+	"teams.exe":    "Teams",
+	"slack.exe":    "Slack",
+}
+
+// SemanticStep is one high-level user action. Event indices refer to the
+// recording's events array and are inclusive.
+type SemanticStep struct {
+	Description string `json:"description"`
+	Kind        string `json:"kind"`
+	Application string `json:"application,omitempty"`
+	Window      string `json:"window,omitempty"`
+	StartTime   uint64 `json:"start_time"`
+	EndTime     uint64 `json:"end_time"`
+	FirstEvent  int    `json:"first_event"`
+	LastEvent   int    `json:"last_event"`
+	EventCount  int    `json:"event_count"`
+
+	action   string // Description without the application
+	position *Position
+	target   string // Name of the element acted on
+	field    string // Name of the field typed into
+	sources  int    // Which click events the step is made of
+}
+
+// summarizeSteps collapses events into high-level steps
+func summarizeSteps(events []WorkflowEvent) []SemanticStep {
+	var steps []SemanticStep
+	quote := func(text string) string {
+		return fmt.Sprintf("%q", strings.Join(strings.Fields(text), " "))
+	}
+
+	for i, event := range events {
+		saved, ok := summarySourceEvent(event)
+		if !ok {
+			continue
+		}
+		kind, action, _, ok := describeSavedEvent(saved, quote)
+		if !ok {
+			continue
+		}
+
+		step := SemanticStep{
+			Kind:       kind,
+			StartTime:  saved.Metadata.Timestamp,
+			EndTime:    saved.Metadata.Timestamp,
+			FirstEvent: i,
+			LastEvent:  i,
+			EventCount: 1,
+			action:     action,
+			position:   saved.Position,
+			field:      saved.FieldName,
+		}
+		switch {
+		case kind == "BrowserClick":
+			step.sources = clickFromBrowser
+		case saved.ButtonText != nil:
+			step.sources = clickFromButton
+		case kind == "Click":
+			step.sources = clickFromMouse
+		}
+		if element := saved.Metadata.UIElement; element != nil {
+			step.Application = element.ApplicationName
+			step.Window = element.WindowTitle
+			step.target = element.Name
+		}
+
+		if len(steps) > 0 && mergeStep(&steps[len(steps)-1], step) {
+			continue
+		}
+		steps = append(steps, step)
+	}
+
+	for i := range steps {
+		steps[i].Description = steps[i].action
+		if steps[i].Application != "" && steps[i].Kind != "AppSwitch" {
+			steps[i].Description += " in " + friendlyApplicationName(steps[i].Application)
+		}
+	}
+	return steps
+}
+
+// mergeStep folds next into last when they are parts of the same action,
+// and reports whether it did
+func mergeStep(last *SemanticStep, next SemanticStep) bool {
+	adjacent := next.StartTime >= last.EndTime && next.StartTime-last.EndTime <= stepMergeWindowMs
+
+	switch {
+	// One physical click: the mouse click and the button click share a
+	// position, and a browser click arrives over CDP alongside them
+	case isClickStep(last.Kind) && isClickStep(next.Kind) && adjacent && last.sources&next.sources == 0 &&
+		(samePosition(last.position, next.position) || (last.sources|next.sources)&clickFromBrowser != 0):
+		if clickDetail(next.Kind) > clickDetail(last.Kind) {
+			last.Kind, last.action = next.Kind, next.action
+		}
+		last.sources |= next.sources
+
+	// Clicking into a field and then typing there is one step
+	case isClickStep(last.Kind) && next.Kind == "TextInput" && last.target != "" && next.field == last.target:
+		last.Kind, last.action = next.Kind, next.action
+
+	// Cycling through windows with Alt+Tab ends on the one switched to
+	case last.Kind == "AppSwitch" && next.Kind == "AppSwitch" && adjacent:
+		last.action = next.action
+
+	// The tab tracker and CDP both report the same navigation
+	case last.Kind == "Navigation" && next.Kind == "Navigation" && last.action == next.action:
+
+	default:
+		return false
+	}
+
+	if next.Application != "" {
+		last.Application, last.Window = next.Application, next.Window
+	}
+	last.EndTime = next.EndTime
+	last.LastEvent = next.LastEvent
+	last.EventCount += next.EventCount
+	return true
+}
+
+// isClickStep reports whether a step kind is a click
+func isClickStep(kind string) bool {
+	return kind == "Click" || kind == "ButtonClick" || kind == "BrowserClick"
+}
+
+// clickDetail ranks click descriptions: a named button reads best, then a
+// browser element, then a bare click
+func clickDetail(kind string) int {
+	switch kind {
+	case "ButtonClick":
+		return 2
+	case "BrowserClick":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// samePosition reports whether two optional positions are known and equal
+func samePosition(a, b *Position) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+// friendlyApplicationName turns a process name into the application's name
+func friendlyApplicationName(application string) string {
+	if name, ok := friendlyApplicationNames[strings.ToLower(application)]; ok {
+		return name
+	}
+
+	name := strings.TrimSuffix(application, ".exe")
+	if name == "" {
+		return application
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// summarySourceEvent converts a live event to the saved form the step
+// descriptions read. Screenshots are not converted, to save encoding their
+// images again.
+func summarySourceEvent(event WorkflowEvent) (savedEvent, bool) {
+	if _, isScreenshot := event.(ScreenshotEvent); isScreenshot {
+		return savedEvent{}, false
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return savedEvent{}, false
+	}
+	var saved savedEvent
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return savedEvent{}, false
+	}
+	return saved, true
+}
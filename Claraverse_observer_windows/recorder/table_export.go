@@ -0,0 +1,333 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Analytics tables. `tables <recording.json|directory>` flattens the events
+// of a recording, or of every recording in a directory, into one table per
+// event type (mouse.parquet, keyboard.parquet, application_switch.parquet
+// and so on) for pandas, DuckDB or a spreadsheet to load as they are. A row
+// is an event: the recording it is from, its seq, timestamp and offset into
+// the recording, its UI element's fields under ui_, then its own fields,
+// nested objects joined with underscores (position_x) and arrays as JSON.
+// Screenshot images are left out; a stored screenshot's image_ref stays. A
+// column that is all integers, all numbers or all booleans gets that type,
+// and one that mixes them is text.
+
+// TableFormat is the file format of exported tables
+type TableFormat string
+
+const (
+	TableFormatParquet TableFormat = "parquet"
+	TableFormatCSV     TableFormat = "csv"
+)
+
+// tableLeadingColumns come first in every table, in this order; the rest
+// are sorted by name
+var tableLeadingColumns = []string{"recording", "seq", "timestamp", "offset_ms"}
+
+// TableSummary counts what a table export wrote
+type TableSummary struct {
+	Directory  string
+	Recordings int
+	Tables     int
+	Rows       int
+}
+
+// eventTable is the rows of one event type
+type eventTable struct {
+	Name  string
+	Types map[string]parquetType // Type of each column seen
+	Rows  []map[string]interface{}
+}
+
+// add adds a row, widening the types of its columns to fit it
+func (t *eventTable) add(row map[string]interface{}) {
+	for column, value := range row {
+		kind := tableValueType(value)
+		if seen, ok := t.Types[column]; ok && seen != kind {
+			if (seen == parquetInt64 && kind == parquetDouble) || (seen == parquetDouble && kind == parquetInt64) {
+				kind = parquetDouble
+			} else {
+				kind = parquetByteArray
+			}
+		}
+		t.Types[column] = kind
+	}
+	t.Rows = append(t.Rows, row)
+}
+
+// Columns returns the table's columns, each row's value converted to the
+// column's type
+func (t *eventTable) Columns() []parquetColumn {
+	names := make([]string, 0, len(t.Types))
+	for name := range t.Types {
+		names = append(names, name)
+	}
+	leading := make(map[string]int, len(tableLeadingColumns))
+	for i, name := range tableLeadingColumns {
+		leading[name] = i + 1
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := leading[names[i]], leading[names[j]]
+		if a != b {
+			return a != 0 && (b == 0 || a < b)
+		}
+		return names[i] < names[j]
+	})
+
+	columns := make([]parquetColumn, len(names))
+	for i, name := range names {
+		column := parquetColumn{Name: name, Type: t.Types[name], Values: make([]interface{}, len(t.Rows))}
+		for row, fields := range t.Rows {
+			value, ok := fields[name]
+			if !ok {
+				continue
+			}
+			switch column.Type {
+			case parquetByteArray:
+				column.Values[row] = tableString(value)
+			case parquetDouble:
+				if integer, ok := value.(int64); ok {
+					value = float64(integer)
+				}
+				column.Values[row] = value
+			default:
+				column.Values[row] = value
+			}
+		}
+		columns[i] = column
+	}
+	return columns
+}
+
+// tableValueType is the column type a value fits
+func tableValueType(value interface{}) parquetType {
+	switch value.(type) {
+	case bool:
+		return parquetBoolean
+	case int64:
+		return parquetInt64
+	case float64:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// tableString writes a value as text
+func tableString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// tableName names the table of a saved event type: MouseEvent is mouse,
+// BrowserCDPEvent browser_cdp
+func tableName(eventType string) string {
+	name := []rune(strings.TrimSuffix(eventType, "Event"))
+	var table strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(name[i-1]) || (i+1 < len(name) && unicode.IsLower(name[i+1]))) {
+			table.WriteByte('_')
+		}
+		table.WriteRune(unicode.ToLower(r))
+	}
+	return strings.ReplaceAll(table.String(), " ", "_")
+}
+
+// tableRow flattens a saved event into a row of the table it belongs in.
+// startTime is the recording's, for offset_ms.
+func tableRow(recording string, startTime uint64, raw json.RawMessage) (string, map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return "", nil, err
+	}
+	metadata, _ := fields["metadata"].(map[string]interface{})
+	element, _ := metadata["ui_element"].(map[string]interface{})
+	delete(fields, "metadata")
+	delete(fields, "image_base64")
+	delete(metadata, "ui_element")
+
+	// The common columns win over an event field of the same name
+	row := make(map[string]interface{})
+	flattenTableFields(row, "", fields)
+	flattenTableFields(row, "ui_", element)
+	flattenTableFields(row, "", metadata)
+	row["recording"] = recording
+	if timestamp, ok := row["timestamp"].(int64); ok && startTime > 0 && uint64(timestamp) >= startTime {
+		row["offset_ms"] = int64(uint64(timestamp) - startTime)
+	}
+	return tableName(rawEventType(raw)), row, nil
+}
+
+// flattenTableFields adds fields to row under prefix, nesting object keys
+// with underscores and writing arrays as JSON
+func flattenTableFields(row map[string]interface{}, prefix string, fields map[string]interface{}) {
+	for key, value := range fields {
+		name := prefix + key
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenTableFields(row, name+"_", v)
+		case []interface{}:
+			data, _ := json.Marshal(v)
+			row[name] = string(data)
+		case json.Number:
+			if integer, err := v.Int64(); err == nil {
+				row[name] = integer
+			} else if number, err := v.Float64(); err == nil {
+				row[name] = number
+			} else {
+				row[name] = v.String()
+			}
+		case string, bool:
+			row[name] = v
+		}
+	}
+}
+
+// loadTableEvents reads the start time and saved events of a recording
+// file, or of the chunks a manifest lists
+func loadTableEvents(filename string) (uint64, []json.RawMessage, error) {
+	var saved struct {
+		StartTime uint64            `json:"start_time"`
+		Events    []json.RawMessage `json:"events"`
+		Chunks    []RecordingChunk  `json:"chunks"`
+	}
+	if err := LoadRecordingFile(filename, &saved); err != nil {
+		return 0, nil, err
+	}
+	for _, chunk := range saved.Chunks {
+		var content struct {
+			Events []json.RawMessage `json:"events"`
+		}
+		if err := LoadRecordingFile(filepath.Join(filepath.Dir(filename), filepath.FromSlash(chunk.File)), &content); err != nil {
+			return 0, nil, err
+		}
+		saved.Events = append(saved.Events, content.Events...)
+	}
+	return saved.StartTime, saved.Events, nil
+}
+
+// exportTables writes the events of a recording, or of every recording in
+// a directory, to outputDirectory as one file per event type
+func exportTables(source, outputDirectory string, format TableFormat) (TableSummary, error) {
+	if format != TableFormatParquet && format != TableFormatCSV {
+		return TableSummary{}, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Unknown table format %q (use parquet or csv)", format), nil)
+	}
+
+	files := []string{source}
+	if info, err := os.Stat(source); err != nil {
+		return TableSummary{}, NewWorkflowError(ErrorTypeFileIO, "Failed to read recordings", err)
+	} else if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(source, "*.json")); err != nil {
+			return TableSummary{}, NewWorkflowError(ErrorTypeFileIO, "Invalid recordings directory", err)
+		}
+	}
+
+	tables := make(map[string]*eventTable)
+	summary := TableSummary{Directory: outputDirectory}
+	for _, file := range files {
+		if segmentFilePattern.MatchString(file) {
+			continue
+		}
+		startTime, events, err := loadTableEvents(file)
+		if err != nil {
+			logger("tables").Warn("Skipping recording", "file", file, "error", err)
+			continue
+		}
+		if len(events) == 0 {
+			continue
+		}
+
+		recording := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		for i, raw := range events {
+			name, row, err := tableRow(recording, startTime, raw)
+			if err != nil {
+				logger("tables").Warn("Skipping event", "file", file, "index", i, "error", err)
+				continue
+			}
+			table, ok := tables[name]
+			if !ok {
+				table = &eventTable{Name: name, Types: make(map[string]parquetType)}
+				tables[name] = table
+			}
+			table.add(row)
+			summary.Rows++
+		}
+		summary.Recordings++
+	}
+
+	if err := EnsureDirectoryExists(outputDirectory); err != nil {
+		return summary, NewWorkflowError(ErrorTypeFileIO, "Failed to create tables directory", err)
+	}
+	for _, table := range tables {
+		filename := filepath.Join(outputDirectory, table.Name+"."+string(format))
+		if err := writeEventTable(filename, table, format); err != nil {
+			return summary, err
+		}
+		summary.Tables++
+	}
+	return summary, nil
+}
+
+// writeEventTable writes a table as Parquet or as CSV with a header row
+func writeEventTable(filename string, table *eventTable, format TableFormat) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to create table file", err)
+	}
+	defer file.Close()
+
+	columns := table.Columns()
+	if format == TableFormatParquet {
+		err = writeParquet(file, columns, "ui_recorder version "+recorderVersion)
+	} else {
+		err = writeTableCSV(csv.NewWriter(file), columns, len(table.Rows))
+	}
+	if err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write table file", err)
+	}
+	return nil
+}
+
+// writeTableCSV writes columns as CSV, missing values as empty fields
+func writeTableCSV(writer *csv.Writer, columns []parquetColumn, rows int) error {
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.Name
+	}
+	writer.Write(record)
+	for row := 0; row < rows; row++ {
+		for i, column := range columns {
+			record[i] = ""
+			if value := column.Values[row]; value != nil {
+				record[i] = tableString(value)
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,373 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Task segment end reasons
+const (
+	TaskEndIdleGap      = "idle_gap"
+	TaskEndAppSwitch    = "app_switch"
+	TaskEndSave         = "save"
+	TaskEndSubmit       = "submit"
+	TaskEndRecordingEnd = "recording_end"
+)
+
+// TaskSegment is a candidate task detected in a recording. Event indices
+// refer to the recording's events array and are inclusive.
+type TaskSegment struct {
+	Title       string         `json:"title"`
+	StartTime   uint64         `json:"start_time"`
+	EndTime     uint64         `json:"end_time"`
+	FirstEvent  int            `json:"first_event"`
+	LastEvent   int            `json:"last_event"`
+	EventCount  int            `json:"event_count"`
+	Application string         `json:"application,omitempty"`
+	EndReason   string         `json:"end_reason"`
+	Fullscreen  FullscreenMode `json:"fullscreen,omitempty"` // Set when the task ran in a fullscreen application
+
+	windowTitle   string
+	activityCount int
+}
+
+// TaskSegmenter splits a session into candidate tasks using heuristics: a
+// long idle gap or a switch to another application starts a new task, and a
+// save (Ctrl+S) or submit click ends the current one
+type TaskSegmenter struct {
+	IdleGapMs uint64
+}
+
+// NewTaskSegmenter creates a segmenter using the configured idle gap
+func NewTaskSegmenter(config WorkflowRecorderConfig) *TaskSegmenter {
+	return &TaskSegmenter{IdleGapMs: uint64(max(config.TaskIdleGapMs, 0))}
+}
+
+// Segment returns the candidate tasks in events. Segments without any user
+// activity (only mouse moves and screenshots) are folded into the previous
+// segment.
+func (ts *TaskSegmenter) Segment(events []WorkflowEvent, endTime uint64) []TaskSegment {
+	var segments []TaskSegment
+	var current *TaskSegment
+	var lastTimestamp uint64
+	fullscreen := FullscreenNone
+
+	closeCurrent := func(reason string) {
+		if current == nil {
+			return
+		}
+		current.EndReason = reason
+		segments = appendTaskSegment(segments, *current)
+		current = nil
+	}
+
+	for i, event := range events {
+		metadata, hasMetadata := eventMetadata(event)
+		timestamp := lastTimestamp
+		if hasMetadata && metadata.Timestamp > 0 {
+			timestamp = metadata.Timestamp
+		}
+
+		if current != nil && ts.IdleGapMs > 0 && timestamp > lastTimestamp && timestamp-lastTimestamp > ts.IdleGapMs {
+			closeCurrent(TaskEndIdleGap)
+		}
+
+		if switchEvent, isSwitch := event.(ApplicationSwitchEvent); isSwitch && current != nil &&
+			current.Application != "" && current.Application != switchEvent.ToApplication {
+			closeCurrent(TaskEndAppSwitch)
+		}
+
+		if current == nil {
+			current = &TaskSegment{FirstEvent: i, StartTime: timestamp}
+		}
+
+		if change, isChange := event.(FullscreenChangedEvent); isChange {
+			fullscreen = change.Fullscreen
+		}
+
+		current.LastEvent = i
+		current.EndTime = timestamp
+		current.EventCount++
+		if fullscreen != FullscreenNone && current.Fullscreen != FullscreenExclusive {
+			current.Fullscreen = fullscreen
+		}
+		if isTaskActivity(event) {
+			current.activityCount++
+		}
+
+		if switchEvent, isSwitch := event.(ApplicationSwitchEvent); isSwitch && current.Application == "" {
+			current.Application = switchEvent.ToApplication
+		}
+		if element := metadata.UIElement; hasMetadata && element != nil {
+			if current.Application == "" {
+				current.Application = element.ApplicationName
+			}
+			if current.windowTitle == "" {
+				current.windowTitle = element.WindowTitle
+			}
+		}
+
+		lastTimestamp = timestamp
+
+		switch e := event.(type) {
+		case HotkeyEvent:
+			if e.Action == "Save" {
+				closeCurrent(TaskEndSave)
+			}
+		case ButtonClickEvent:
+			if e.InteractionType == ButtonSubmit {
+				closeCurrent(TaskEndSubmit)
+			}
+		case BrowserCDPEvent:
+			if e.CDPEvent == CDPFormSubmitted {
+				closeCurrent(TaskEndSubmit)
+			}
+		}
+	}
+
+	if current != nil {
+		if endTime > current.EndTime {
+			current.EndTime = endTime
+		}
+		closeCurrent(TaskEndRecordingEnd)
+	}
+
+	for i := range segments {
+		segments[i].Title = taskTitle(segments[i], i+1)
+	}
+
+	return segments
+}
+
+// appendTaskSegment adds segment, or folds it into the previous one when it
+// contains no user activity. A folded segment keeps the previous end reason.
+func appendTaskSegment(segments []TaskSegment, segment TaskSegment) []TaskSegment {
+	if segment.activityCount > 0 || len(segments) == 0 {
+		return append(segments, segment)
+	}
+
+	previous := &segments[len(segments)-1]
+	previous.LastEvent = segment.LastEvent
+	previous.EndTime = segment.EndTime
+	previous.EventCount += segment.EventCount
+	if previous.Fullscreen != FullscreenExclusive && segment.Fullscreen != FullscreenNone {
+		previous.Fullscreen = segment.Fullscreen
+	}
+	return segments
+}
+
+// taskTitle names a segment after where it happened and how it ended
+func taskTitle(segment TaskSegment, number int) string {
+	place := segment.windowTitle
+	if place == "" {
+		place = segment.Application
+	}
+	if place == "" {
+		return fmt.Sprintf("Task %d", number)
+	}
+	place = TruncateString(place, 60, "...")
+
+	switch segment.EndReason {
+	case TaskEndSave:
+		return "Save in " + place
+	case TaskEndSubmit:
+		return "Submit in " + place
+	default:
+		return place
+	}
+}
+
+// isTaskActivity reports whether an event is deliberate user activity rather
+// than pointer motion or a periodic capture
+func isTaskActivity(event WorkflowEvent) bool {
+	switch e := event.(type) {
+	case MouseEvent:
+		return e.EventType != MouseMove
+	case ScreenshotEvent, SegmentMarkerEvent, RecordingMarkerEvent, AnnotationEvent, QuotaExceededEvent, RecordingRotatedEvent,
+		SessionInterruptedEvent, FullscreenChangedEvent, IdleEvent, BookmarkEvent, RecorderRecoveredEvent, WindowGeometryEvent,
+		FileActivityEvent, ProcessEvent:
+		return false
+	default:
+		return true
+	}
+}
+
+// eventMetadata returns the metadata common to all recorded event types
+func eventMetadata(event WorkflowEvent) (EventMetadata, bool) {
+	switch e := event.(type) {
+	case MouseEvent:
+		return e.Metadata, true
+	case KeyboardEvent:
+		return e.Metadata, true
+	case ClipboardEvent:
+		return e.Metadata, true
+	case HotkeyEvent:
+		return e.Metadata, true
+	case ApplicationSwitchEvent:
+		return e.Metadata, true
+	case ButtonClickEvent:
+		return e.Metadata, true
+	case ScreenshotEvent:
+		return e.Metadata, true
+	case TextInputCompletedEvent:
+		return e.Metadata, true
+	case BrowserTabNavigationEvent:
+		return e.Metadata, true
+	case TextSelectionEvent:
+		return e.Metadata, true
+	case DragDropEvent:
+		return e.Metadata, true
+	case SegmentMarkerEvent:
+		return e.Metadata, true
+	case RecordingMarkerEvent:
+		return e.Metadata, true
+	case AnnotationEvent:
+		return e.Metadata, true
+	case QuotaExceededEvent:
+		return e.Metadata, true
+	case RecordingRotatedEvent:
+		return e.Metadata, true
+	case SessionInterruptedEvent:
+		return e.Metadata, true
+	case CommandEnteredEvent:
+		return e.Metadata, true
+	case FullscreenChangedEvent:
+		return e.Metadata, true
+	case IdleEvent:
+		return e.Metadata, true
+	case BookmarkEvent:
+		return e.Metadata, true
+	case RecorderRecoveredEvent:
+		return e.Metadata, true
+	case WindowGeometryEvent:
+		return e.Metadata, true
+	case FileActivityEvent:
+		return e.Metadata, true
+	case ProcessEvent:
+		return e.Metadata, true
+	case MenuItemSelectedEvent:
+		return e.Metadata, true
+	case DialogEvent:
+		return e.Metadata, true
+	case FileDialogEvent:
+		return e.Metadata, true
+	case FocusChangedEvent:
+		return e.Metadata, true
+	case WindowTitleChangedEvent:
+		return e.Metadata, true
+	case BrowserCDPEvent:
+		return e.Metadata, true
+	case json.RawMessage:
+		// Events restored from chunks, e.g. by a resume
+		var probe struct {
+			Metadata *EventMetadata `json:"metadata"`
+		}
+		if json.Unmarshal(e, &probe) == nil && probe.Metadata != nil {
+			return *probe.Metadata, true
+		}
+		return EventMetadata{}, false
+	default:
+		return EventMetadata{}, false
+	}
+}
+
+// setEventMetadata returns event with its metadata replaced
+func setEventMetadata(event WorkflowEvent, metadata EventMetadata) WorkflowEvent {
+	switch e := event.(type) {
+	case MouseEvent:
+		e.Metadata = metadata
+		return e
+	case KeyboardEvent:
+		e.Metadata = metadata
+		return e
+	case ClipboardEvent:
+		e.Metadata = metadata
+		return e
+	case HotkeyEvent:
+		e.Metadata = metadata
+		return e
+	case ApplicationSwitchEvent:
+		e.Metadata = metadata
+		return e
+	case ButtonClickEvent:
+		e.Metadata = metadata
+		return e
+	case ScreenshotEvent:
+		e.Metadata = metadata
+		return e
+	case TextInputCompletedEvent:
+		e.Metadata = metadata
+		return e
+	case BrowserTabNavigationEvent:
+		e.Metadata = metadata
+		return e
+	case TextSelectionEvent:
+		e.Metadata = metadata
+		return e
+	case DragDropEvent:
+		e.Metadata = metadata
+		return e
+	case SegmentMarkerEvent:
+		e.Metadata = metadata
+		return e
+	case RecordingMarkerEvent:
+		e.Metadata = metadata
+		return e
+	case AnnotationEvent:
+		e.Metadata = metadata
+		return e
+	case QuotaExceededEvent:
+		e.Metadata = metadata
+		return e
+	case RecordingRotatedEvent:
+		e.Metadata = metadata
+		return e
+	case SessionInterruptedEvent:
+		e.Metadata = metadata
+		return e
+	case CommandEnteredEvent:
+		e.Metadata = metadata
+		return e
+	case FullscreenChangedEvent:
+		e.Metadata = metadata
+		return e
+	case IdleEvent:
+		e.Metadata = metadata
+		return e
+	case BookmarkEvent:
+		e.Metadata = metadata
+		return e
+	case RecorderRecoveredEvent:
+		e.Metadata = metadata
+		return e
+	case WindowGeometryEvent:
+		e.Metadata = metadata
+		return e
+	case FileActivityEvent:
+		e.Metadata = metadata
+		return e
+	case ProcessEvent:
+		e.Metadata = metadata
+		return e
+	case MenuItemSelectedEvent:
+		e.Metadata = metadata
+		return e
+	case DialogEvent:
+		e.Metadata = metadata
+		return e
+	case FileDialogEvent:
+		e.Metadata = metadata
+		return e
+	case FocusChangedEvent:
+		e.Metadata = metadata
+		return e
+	case WindowTitleChangedEvent:
+		e.Metadata = metadata
+		return e
+	case BrowserCDPEvent:
+		e.Metadata = metadata
+		return e
+	default:
+		return event
+	}
+}
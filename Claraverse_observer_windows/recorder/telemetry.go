@@ -0,0 +1,334 @@
+package recorder
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Opt-in health telemetry. With --telemetry=<url> the recorder posts a
+// report of its own health every telemetryInterval and on exit: unclean
+// exits, recovered panics, watchdog restarts and tracker errors, sampled capture latencies and
+// which features are switched on. Reports are built only from counters and
+// timings, never from events, so nothing captured (text, window titles,
+// URLs, screenshots, file names) is ever sent. Installs are told apart by a
+// random ID that is not derived from the machine or the user.
+
+// Latency metrics
+const (
+	TelemetryCaptureLoop = "capture_loop"
+	TelemetryScreenshot  = "screenshot"
+)
+
+const (
+	telemetryInterval      = time.Hour
+	telemetryTimeout       = 10 * time.Second
+	telemetryReservoirSize = 256
+)
+
+// TelemetryReport is everything a telemetry report sends
+type TelemetryReport struct {
+	InstallID     string                    `json:"install_id"`
+	Version       string                    `json:"version"`
+	Platform      string                    `json:"platform"`
+	PeriodSeconds int64                     `json:"period_seconds"`
+	Recordings    int                       `json:"recordings"`
+	UncleanExits  int                       `json:"unclean_exits"`
+	Panics        map[string]int64          `json:"panics,omitempty"`
+	Recoveries    map[string]int64          `json:"recoveries,omitempty"` // Watchdog restarts per component
+	TrackerErrors map[string]int64          `json:"tracker_errors,omitempty"`
+	LatenciesMs   map[string]LatencySummary `json:"latencies_ms,omitempty"`
+	Features      map[string]bool           `json:"features"`
+}
+
+// LatencySummary describes the timings of one operation over a period
+type LatencySummary struct {
+	Count int64   `json:"count"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	Max   float64 `json:"max"`
+}
+
+// latencySampler keeps a uniform sample of at most telemetryReservoirSize
+// timings, so a busy capture loop costs constant memory
+type latencySampler struct {
+	Count   int64
+	Max     time.Duration
+	Samples []time.Duration
+}
+
+// telemetryState is what telemetry keeps on disk between runs
+type telemetryState struct {
+	InstallID string `json:"install_id"`
+	Running   bool   `json:"running"` // Still set at the next start when the recorder did not exit cleanly
+}
+
+// Telemetry collects recorder health and sends it to Endpoint
+type Telemetry struct {
+	Endpoint  string
+	StateFile string
+	InstallID string
+	Features  map[string]bool
+	Client    *http.Client
+
+	periodStart   time.Time
+	recordings    int
+	uncleanExits  int
+	panics        map[string]int64
+	recoveries    map[string]int64
+	trackerErrors map[string]int64
+	latencies     map[string]*latencySampler
+	Mutex         sync.Mutex
+}
+
+// NewTelemetry starts collecting health for config, or returns nil when no
+// telemetry endpoint is configured
+func NewTelemetry(config WorkflowRecorderConfig) *Telemetry {
+	if config.TelemetryEndpoint == "" {
+		return nil
+	}
+	return openTelemetry(config.TelemetryEndpoint, telemetryStateFile(), telemetryFeatures(config))
+}
+
+// openTelemetry loads the install ID from stateFile, counts an unclean exit
+// if the last run did not close telemetry, and marks this run as running
+func openTelemetry(endpoint, stateFile string, features map[string]bool) *Telemetry {
+	var state telemetryState
+	if data, err := os.ReadFile(stateFile); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			logger("telemetry").Warn("Telemetry state unreadable, starting afresh", "error", err)
+		}
+	}
+
+	t := &Telemetry{
+		Endpoint:      endpoint,
+		StateFile:     stateFile,
+		InstallID:     state.InstallID,
+		Features:      features,
+		Client:        &http.Client{Timeout: telemetryTimeout},
+		periodStart:   time.Now(),
+		panics:        make(map[string]int64),
+		recoveries:    make(map[string]int64),
+		trackerErrors: make(map[string]int64),
+		latencies:     make(map[string]*latencySampler),
+	}
+	if t.InstallID == "" {
+		t.InstallID = newInstallID()
+	}
+	if state.Running {
+		t.uncleanExits = 1
+	}
+	t.saveState(true)
+	return t
+}
+
+// ObserveLatency adds a timing of the named operation
+func (t *Telemetry) ObserveLatency(name string, d time.Duration) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	sampler, ok := t.latencies[name]
+	if !ok {
+		sampler = &latencySampler{}
+		t.latencies[name] = sampler
+	}
+	sampler.Count++
+	sampler.Max = max(sampler.Max, d)
+	if len(sampler.Samples) < telemetryReservoirSize {
+		sampler.Samples = append(sampler.Samples, d)
+	} else if i := mathrand.Int63n(sampler.Count); i < telemetryReservoirSize {
+		sampler.Samples[i] = d
+	}
+}
+
+// RecordPanic counts a panic recovered in the named component
+func (t *Telemetry) RecordPanic(component string) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.panics[component]++
+}
+
+// RecordRecovery counts a watchdog restart of the named component
+func (t *Telemetry) RecordRecovery(component string) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.recoveries[component]++
+}
+
+// RecordRecording counts a finished recording and its tracker errors
+func (t *Telemetry) RecordRecording(health *TrackerHealthMonitor) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.recordings++
+	if health == nil {
+		return
+	}
+	health.Mutex.RLock()
+	defer health.Mutex.RUnlock()
+	for name, tracker := range health.Trackers {
+		if tracker.ErrorCount > 0 {
+			t.trackerErrors[name] += tracker.ErrorCount
+		}
+	}
+}
+
+// TakeReport returns the report for the period so far and starts a new one
+func (t *Telemetry) TakeReport() TelemetryReport {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	now := time.Now()
+	report := TelemetryReport{
+		InstallID:     t.InstallID,
+		Version:       recorderVersion,
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
+		PeriodSeconds: int64(now.Sub(t.periodStart).Seconds()),
+		Recordings:    t.recordings,
+		UncleanExits:  t.uncleanExits,
+		Panics:        t.panics,
+		Recoveries:    t.recoveries,
+		TrackerErrors: t.trackerErrors,
+		LatenciesMs:   make(map[string]LatencySummary, len(t.latencies)),
+		Features:      t.Features,
+	}
+	for name, sampler := range t.latencies {
+		report.LatenciesMs[name] = sampler.summary()
+	}
+
+	t.periodStart = now
+	t.recordings, t.uncleanExits = 0, 0
+	t.panics = make(map[string]int64)
+	t.recoveries = make(map[string]int64)
+	t.trackerErrors = make(map[string]int64)
+	t.latencies = make(map[string]*latencySampler)
+	return report
+}
+
+// Send posts the period's report. A report that cannot be sent is dropped.
+func (t *Telemetry) Send() error {
+	data, err := json.Marshal(t.TakeReport())
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSerialization, "Failed to encode telemetry report", err)
+	}
+
+	resp, err := t.Client.Post(t.Endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSystem, "Failed to send telemetry report", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return NewWorkflowError(ErrorTypeSystem, fmt.Sprintf("Telemetry endpoint returned %s", resp.Status), nil)
+	}
+	return nil
+}
+
+// Close sends the last report and marks the run as having exited cleanly
+func (t *Telemetry) Close() {
+	if err := t.Send(); err != nil {
+		logger("telemetry").Warn("Sending health report failed", "error", err)
+	}
+	t.saveState(false)
+}
+
+// saveState records the install ID and whether the recorder is running
+func (t *Telemetry) saveState(running bool) {
+	if t.StateFile == "" {
+		return
+	}
+	if err := SaveJSONToFile(telemetryState{InstallID: t.InstallID, Running: running}, t.StateFile); err != nil {
+		logger("telemetry").Warn("Failed to save telemetry state", "error", err)
+	}
+}
+
+// runTelemetry sends a report every telemetryInterval
+func runTelemetry(t *Telemetry) {
+	for {
+		time.Sleep(telemetryInterval)
+		if err := t.Send(); err != nil {
+			logger("telemetry").Warn("Sending health report failed", "error", err)
+		}
+	}
+}
+
+// summary describes the sampled timings in milliseconds
+func (s *latencySampler) summary() LatencySummary {
+	sorted := append([]time.Duration{}, s.Samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	percentile := func(p int) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		return ms(sorted[(len(sorted)-1)*p/100])
+	}
+	return LatencySummary{Count: s.Count, P50: percentile(50), P95: percentile(95), Max: ms(s.Max)}
+}
+
+// telemetryFeatures reports which features config switches on, as flags
+// only: no endpoints, paths, patterns or other values
+func telemetryFeatures(config WorkflowRecorderConfig) map[string]bool {
+	return map[string]bool{
+		"screenshots":          config.CaptureScreenshots,
+		"annotate_screenshots": config.AnnotateScreenshots,
+		"action_screenshots":   config.ActionScreenshotPairs,
+		"clipboard":            config.RecordClipboard,
+		"text_input":           config.RecordTextInputCompletion,
+		"text_selection":       config.RecordTextSelection,
+		"browser_navigation":   config.RecordBrowserTabNavigation,
+		"drag_drop":            config.RecordDragDrop,
+		"window_geometry":      config.RecordWindowGeometry,
+		"window_titles":        config.RecordWindowTitles,
+		"file_activity":        len(config.WatchFolders) > 0,
+		"processes":            config.RecordProcesses,
+		"menu_selections":      config.RecordMenuSelections,
+		"dialogs":              config.RecordDialogs,
+		"focus_changes":        config.RecordFocusChanges,
+		"office_context":       config.OfficeContext,
+		"cdp":                  config.CDPDebuggingURL != "",
+		"http_api":             config.HTTPAPIAddress != "",
+		"vision":               config.VisionEndpoint != "",
+		"ocr":                  config.OCRCommand != "",
+		"ntp":                  config.NTPServer != "",
+		"mask_pii":             config.MaskPII,
+		"exclude_passwords":    config.ExcludePasswordFields,
+		"strict_privacy":       config.StrictPrivacy,
+		"dry_run":              config.DryRun,
+		"strict":               config.Strict,
+		"export_segments":      config.ExportSegments,
+		"export_analytics":     config.ExportAnalytics,
+		"watchdog":             config.WatchdogTimeoutSeconds > 0,
+		"app_profiles":         len(config.ApplicationProfiles) > 0,
+		"auto_update":          config.AutoUpdate,
+	}
+}
+
+// telemetryStateFile is where telemetry state is kept, or "" when there is
+// no per-user config directory
+func telemetryStateFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ClaraVerse", "telemetry.json")
+}
+
+// newInstallID returns a random install ID
+func newInstallID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
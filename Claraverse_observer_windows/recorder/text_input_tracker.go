@@ -1,7 +1,6 @@
-package main
+package recorder
 
 import (
-	"log"
 	"strings"
 	"sync"
 	"time"
@@ -26,9 +25,27 @@ type TextInputCompletedEvent struct {
 	InputMethod      TextInputMethod `json:"input_method"`
 	TypingDurationMs uint64          `json:"typing_duration_ms"`
 	KeystrokeCount   uint32          `json:"keystroke_count"`
+	InitialValue     string          `json:"initial_value,omitempty"`
+	Diff             *TextValueDiff  `json:"diff,omitempty"`
+	CompletionReason string          `json:"completion_reason,omitempty"`
+	Redacted         bool            `json:"redacted,omitempty"` // Typed into a password field
+	Caret            *Position       `json:"caret,omitempty"`    // Where the text caret was while typing
+	Scroll           *ScrollPosition `json:"scroll,omitempty"`   // How far the focused container was scrolled
 	Metadata         EventMetadata   `json:"metadata"`
 }
 
+// TextValueDiff is the single edit turning a field's initial value into its
+// final value: Removed was replaced by Inserted at rune offset Position
+type TextValueDiff struct {
+	Position int    `json:"position"`
+	Removed  string `json:"removed,omitempty"`
+	Inserted string `json:"inserted,omitempty"`
+}
+
+// textValueRefreshDelay is how long after a keystroke the field value is
+// re-read, giving the application time to apply the key
+const textValueRefreshDelay = 150 * time.Millisecond
+
 // TextInputTracker tracks text input sessions to generate completion events
 type TextInputTracker struct {
 	Element         *UIElement
@@ -37,8 +54,13 @@ type TextInputTracker struct {
 	KeystrokeCount  uint32
 	InitialText     string
 	CurrentText     string
+	ValueReadable   bool   // InitialText came from the control rather than being assumed empty
+	ReadValue       string // Value last read from the control while it had focus
+	ValueRefreshed  bool
 	InputMethod     TextInputMethod
+	Secure          bool // Typed into a password field
 	CompletionTimer *time.Timer
+	ValueTimer      *time.Timer
 	Mutex           sync.RWMutex
 }
 
@@ -47,6 +69,7 @@ type TextInputManager struct {
 	ActiveInputs      map[string]*TextInputTracker
 	CompletionTimeout time.Duration
 	EventCallback     func(TextInputCompletedEvent)
+	ValueReader       func() (string, bool) // Reads the focused control's value
 	Mutex             sync.RWMutex
 }
 
@@ -56,6 +79,7 @@ func NewTextInputManager(completionTimeout time.Duration, callback func(TextInpu
 		ActiveInputs:      make(map[string]*TextInputTracker),
 		CompletionTimeout: completionTimeout,
 		EventCallback:     callback,
+		ValueReader:       readFocusedTextValue,
 	}
 }
 
@@ -76,13 +100,15 @@ func (tim *TextInputManager) StartTextInput(element *UIElement) {
 	}
 
 	// Start new session
+	initialText, readable := tim.readValue()
 	tracker := &TextInputTracker{
 		Element:        element,
 		StartTime:      time.Now(),
 		LastKeystroke:  time.Now(),
 		KeystrokeCount: 0,
-		InitialText:    tim.getCurrentText(element),
-		CurrentText:    tim.getCurrentText(element),
+		InitialText:    initialText,
+		CurrentText:    initialText,
+		ValueReadable:  readable,
 		InputMethod:    TextInputTyped,
 	}
 
@@ -93,8 +119,14 @@ func (tim *TextInputManager) StartTextInput(element *UIElement) {
 	tim.ActiveInputs[elementKey] = tracker
 }
 
-// HandleKeystroke processes a keystroke for text input tracking
+// HandleKeystroke processes a keystroke for text input tracking. Enter and
+// Tab complete the session, since they submit the field or move focus on.
 func (tim *TextInputManager) HandleKeystroke(keyCode uint32, char string) {
+	if reason := textInputBoundaryReason(keyCode); reason != "" {
+		tim.CompleteActiveInputs(reason)
+		return
+	}
+
 	tim.Mutex.Lock()
 	defer tim.Mutex.Unlock()
 
@@ -105,6 +137,15 @@ func (tim *TextInputManager) HandleKeystroke(keyCode uint32, char string) {
 			tracker.LastKeystroke = time.Now()
 			tracker.KeystrokeCount++
 
+			// Keep a typed copy of the text for controls whose value can't be read back
+			if keyCode == 0x08 { // Backspace
+				if runes := []rune(tracker.CurrentText); len(runes) > 0 {
+					tracker.CurrentText = string(runes[:len(runes)-1])
+				}
+			} else {
+				tracker.CurrentText += char
+			}
+
 			// Update input method based on typing pattern
 			if tracker.KeystrokeCount == 1 {
 				tracker.InputMethod = TextInputTyped
@@ -122,12 +163,62 @@ func (tim *TextInputManager) HandleKeystroke(keyCode uint32, char string) {
 				tim.CompleteTextInput(tim.getElementKey(tracker.Element), "timeout")
 			})
 
+			// Re-read the value once typing pauses, while focus is still on the field
+			if tracker.ValueReadable {
+				if tracker.ValueTimer != nil {
+					tracker.ValueTimer.Stop()
+				}
+				tracker.ValueTimer = time.AfterFunc(textValueRefreshDelay, func() {
+					tim.refreshValue(tracker)
+				})
+			}
+
 			tracker.Mutex.Unlock()
 			break
 		}
 	}
 }
 
+// HandleComposition adds text an IME committed to the session in progress,
+// with the control's value after it
+func (tim *TextInputManager) HandleComposition(text, value string) {
+	tim.Mutex.Lock()
+	defer tim.Mutex.Unlock()
+
+	for _, tracker := range tim.ActiveInputs {
+		if tim.isElementFocused(tracker.Element) {
+			tracker.Mutex.Lock()
+			tracker.CurrentText += text
+			if tracker.ValueReadable {
+				tracker.ReadValue, tracker.ValueRefreshed = value, true
+			}
+			tracker.Mutex.Unlock()
+			break
+		}
+	}
+}
+
+// MarkSecure flags the open sessions as typed into a password field, so
+// their text is redacted when they complete
+func (tim *TextInputManager) MarkSecure() {
+	tim.Mutex.Lock()
+	defer tim.Mutex.Unlock()
+
+	for _, tracker := range tim.ActiveInputs {
+		tracker.Mutex.Lock()
+		tracker.Secure = true
+		tracker.Mutex.Unlock()
+	}
+}
+
+// HasActiveInputs reports whether any text input session is open
+func (tim *TextInputManager) HasActiveInputs() bool {
+	tim.Mutex.RLock()
+	defer tim.Mutex.RUnlock()
+
+	return len(tim.ActiveInputs) > 0
+}
+
 // CompleteTextInput finishes a text input session
 func (tim *TextInputManager) CompleteTextInput(elementKey string, reason string) {
 	tim.Mutex.Lock()
@@ -141,11 +232,17 @@ func (tim *TextInputManager) CompleteTextInput(elementKey string, reason string)
 
 // CompleteAllActiveInputs completes all active text input sessions
 func (tim *TextInputManager) CompleteAllActiveInputs() {
+	tim.CompleteActiveInputs("session_end")
+}
+
+// CompleteActiveInputs completes all active text input sessions, logging
+// reason as the trigger (e.g. "focus_change", "submit_click")
+func (tim *TextInputManager) CompleteActiveInputs(reason string) {
 	tim.Mutex.Lock()
 	defer tim.Mutex.Unlock()
 
 	for elementKey, tracker := range tim.ActiveInputs {
-		tim.completeTextInputInternal(tracker, "session_end")
+		tim.completeTextInputInternal(tracker, reason)
 		delete(tim.ActiveInputs, elementKey)
 	}
 }
@@ -159,13 +256,15 @@ func (tim *TextInputManager) completeTextInputInternal(tracker *TextInputTracker
 	tracker.Mutex.Lock()
 	defer tracker.Mutex.Unlock()
 
-	// Stop the completion timer
+	// Stop the timers
 	if tracker.CompletionTimer != nil {
 		tracker.CompletionTimer.Stop()
 	}
+	if tracker.ValueTimer != nil {
+		tracker.ValueTimer.Stop()
+	}
 
-	// Get final text value
-	finalText := tim.getCurrentText(tracker.Element)
+	finalText := tim.finalValue(tracker, reason)
 
 	// Only emit event if text actually changed
 	if finalText != tracker.InitialText && strings.TrimSpace(finalText) != "" {
@@ -178,6 +277,9 @@ func (tim *TextInputManager) completeTextInputInternal(tracker *TextInputTracker
 			InputMethod:      tracker.InputMethod,
 			TypingDurationMs: uint64(duration),
 			KeystrokeCount:   tracker.KeystrokeCount,
+			InitialValue:     tracker.InitialText,
+			Diff:             diffTextValues(tracker.InitialText, finalText),
+			CompletionReason: reason,
 			Metadata:         createEventMetadata(),
 		}
 
@@ -185,14 +287,31 @@ func (tim *TextInputManager) completeTextInputInternal(tracker *TextInputTracker
 		if tracker.Element != nil {
 			event.Metadata.UIElement = tracker.Element
 		}
+		if tracker.Secure {
+			event = redactTextInput(event)
+			finalText = "(redacted)"
+		}
 
 		// Call the callback to emit the event
 		if tim.EventCallback != nil {
 			go tim.EventCallback(event)
 		}
 
-		log.Printf("Text input completed: '%s' (%d keystrokes, %dms, %s, reason: %s)",
-			finalText, tracker.KeystrokeCount, duration, tracker.InputMethod, reason)
+		logger("trackers").Debug("Text input completed", "text", finalText, "keystrokes", tracker.KeystrokeCount,
+			"duration_ms", duration, "method", tracker.InputMethod, "reason", reason)
+	}
+}
+
+// textInputBoundaryReason returns the completion reason for keys that end a
+// text input session, or "" for other keys
+func textInputBoundaryReason(keyCode uint32) string {
+	switch keyCode {
+	case 0x0D: // Enter
+		return "enter"
+	case 0x09: // Tab
+		return "tab"
+	default:
+		return ""
 	}
 }
 
@@ -204,13 +323,86 @@ func (tim *TextInputManager) getElementKey(element *UIElement) string {
 	return element.Role + "|" + element.Name + "|" + element.WindowTitle
 }
 
-func (tim *TextInputManager) getCurrentText(element *UIElement) string {
-	if element == nil {
-		return ""
+// readValue reads the focused control's value. ok is false when the control
+// exposes no value.
+func (tim *TextInputManager) readValue() (string, bool) {
+	if tim.ValueReader == nil {
+		return "", false
+	}
+	return tim.ValueReader()
+}
+
+// refreshValue stores the focused control's current value on the tracker
+func (tim *TextInputManager) refreshValue(tracker *TextInputTracker) {
+	value, ok := tim.readValue()
+	if !ok {
+		return
+	}
+
+	tracker.Mutex.Lock()
+	defer tracker.Mutex.Unlock()
+
+	tracker.ReadValue = value
+	tracker.ValueRefreshed = true
+}
+
+// finalValue picks the best available final value for a session (must be
+// called with the tracker mutex held). The control is read directly only
+// when focus is known to still be on it; after Tab, a focus change or a
+// click the last value read while typing is used instead. Without a
+// readable control, the typed reconstruction is used.
+func (tim *TextInputManager) finalValue(tracker *TextInputTracker, reason string) string {
+	if !tracker.ValueReadable {
+		return tracker.CurrentText
+	}
+
+	switch reason {
+	case "timeout", "enter", "session_end":
+		if value, ok := tim.readValue(); ok {
+			return value
+		}
+	}
+
+	if tracker.ValueRefreshed {
+		return tracker.ReadValue
+	}
+	return tracker.CurrentText
+}
+
+// readFocusedTextValue reads the focused control's value through UI Automation
+func readFocusedTextValue() (string, bool) {
+	value, err := getUIAFocusedValue()
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// diffTextValues returns the edit between before and after as the span that
+// differs once the common prefix and suffix are removed, or nil if equal
+func diffTextValues(before, after string) *TextValueDiff {
+	if before == after {
+		return nil
+	}
+
+	oldRunes, newRunes := []rune(before), []rune(after)
+
+	prefix := 0
+	for prefix < len(oldRunes) && prefix < len(newRunes) && oldRunes[prefix] == newRunes[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(oldRunes)-prefix && suffix < len(newRunes)-prefix &&
+		oldRunes[len(oldRunes)-1-suffix] == newRunes[len(newRunes)-1-suffix] {
+		suffix++
+	}
+
+	return &TextValueDiff{
+		Position: prefix,
+		Removed:  string(oldRunes[prefix : len(oldRunes)-suffix]),
+		Inserted: string(newRunes[prefix : len(newRunes)-suffix]),
 	}
-	// This would need to be implemented using Windows accessibility APIs
-	// For now, return empty string as a placeholder
-	return ""
 }
 
 func (tim *TextInputManager) getFieldName(element *UIElement) string {
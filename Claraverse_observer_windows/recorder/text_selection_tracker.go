@@ -1,7 +1,6 @@
-package main
+package recorder
 
 import (
-	"log"
 	"math"
 	"sync"
 	"time"
@@ -37,6 +36,9 @@ type TextSelectionTracker struct {
 	LastClickTime      time.Time
 	LastClickPos       Position
 	ClickCount         int
+	ClipboardFallback  bool                   // Copy the selection via Ctrl+C when UI Automation can't read it
+	ReadSelection      func() (string, error) // Reads the focused element's selection through UI Automation
+	CopySelection      func() string          // Copies the selection through the clipboard; nil for none
 	EventCallback      func(TextSelectionEvent)
 	Mutex              sync.RWMutex
 }
@@ -44,6 +46,7 @@ type TextSelectionTracker struct {
 // NewTextSelectionTracker creates a new text selection tracker
 func NewTextSelectionTracker(callback func(TextSelectionEvent)) *TextSelectionTracker {
 	return &TextSelectionTracker{
+		ReadSelection: getUIASelectedText,
 		EventCallback: callback,
 		ClickCount:    0,
 	}
@@ -131,63 +134,48 @@ func (tst *TextSelectionTracker) HandleMouseUp(position Position, button MouseBu
 		}
 	}
 
-	// Get selected text from clipboard or UI automation
+	// Reading the selection can block on the target application, so do it
+	// off the caller's goroutine
+	go tst.emitSelection(tst.SelectionStartPos, position, method)
+}
+
+// HandleKeyboardShortcut processes keyboard shortcuts that might indicate text selection
+func (tst *TextSelectionTracker) HandleKeyboardShortcut(combination string) {
+	if !tst.isSelectionHotkey(combination) {
+		return
+	}
+
+	// Wait a moment for the selection to complete
+	time.AfterFunc(100*time.Millisecond, func() {
+		// Get current cursor position (approximate)
+		currentPos := getMousePosition()
+		tst.emitSelection(currentPos, currentPos, SelectionKeyboardShortcut)
+	})
+}
+
+// emitSelection reads the selected text and emits a selection event if any
+// text is selected
+func (tst *TextSelectionTracker) emitSelection(start, end Position, method SelectionMethod) {
 	selectedText := tst.getSelectedText()
 	if selectedText == "" {
 		return // No text was actually selected
 	}
 
-	// Create selection event
 	event := TextSelectionEvent{
 		SelectedText:    selectedText,
-		StartPosition:   tst.SelectionStartPos,
-		EndPosition:     position,
+		StartPosition:   start,
+		EndPosition:     end,
 		SelectionMethod: method,
 		SelectionLength: uint32(len(selectedText)),
 		Metadata:        createEventMetadata(),
 	}
 
-	// Emit the event
 	if tst.EventCallback != nil {
 		go tst.EventCallback(event)
 	}
 
-	log.Printf("Text selection detected: '%s' (%s, %d chars)",
-		truncateString(selectedText, 50), method, len(selectedText))
-}
-
-// HandleKeyboardShortcut processes keyboard shortcuts that might indicate text selection
-func (tst *TextSelectionTracker) HandleKeyboardShortcut(combination string) {
-	if !tst.isSelectionHotkey(combination) {
-		return
-	}
-
-	// Wait a moment for the selection to complete
-	time.AfterFunc(100*time.Millisecond, func() {
-		selectedText := tst.getSelectedText()
-		if selectedText == "" {
-			return
-		}
-
-		// Get current cursor position (approximate)
-		currentPos := getMousePosition()
-
-		event := TextSelectionEvent{
-			SelectedText:    selectedText,
-			StartPosition:   currentPos,
-			EndPosition:     currentPos,
-			SelectionMethod: SelectionKeyboardShortcut,
-			SelectionLength: uint32(len(selectedText)),
-			Metadata:        createEventMetadata(),
-		}
-
-		if tst.EventCallback != nil {
-			go tst.EventCallback(event)
-		}
-
-		log.Printf("Keyboard text selection detected: '%s' (%s)",
-			truncateString(selectedText, 50), combination)
-	})
+	logger("trackers").Debug("Text selection detected",
+		"text", truncateString(selectedText, 50), "method", method, "chars", len(selectedText))
 }
 
 // Helper methods
@@ -209,25 +197,21 @@ func (tst *TextSelectionTracker) calculateDistance(p1, p2 Position) float64 {
 	return math.Sqrt(dx*dx + dy*dy)
 }
 
+// getSelectedText reads the focused element's selection through UI
+// Automation, falling back to a clipboard round trip when enabled
 func (tst *TextSelectionTracker) getSelectedText() string {
-	// Try to get selected text from clipboard
-	// This is a simple approach - in a real implementation you'd want
-	// to use UI Automation or other APIs to get the selected text directly
-
-	// Store original clipboard content
-	originalClipboard := getClipboardContent()
-
-	// Simulate Ctrl+C to copy selection
-	// Note: This is a simplified approach. A production implementation
-	// would use proper UI Automation APIs
-
-	// For now, return empty string - this would need proper implementation
-	// using Windows UI Automation or similar APIs
+	if text, err := tst.ReadSelection(); err == nil && text != "" {
+		return text
+	}
 
-	// Restore original clipboard content if we modified it
-	_ = originalClipboard
+	tst.Mutex.RLock()
+	clipboardFallback := tst.ClipboardFallback
+	tst.Mutex.RUnlock()
 
-	return "" // Placeholder - would need proper UI Automation implementation
+	if clipboardFallback && tst.CopySelection != nil {
+		return tst.CopySelection()
+	}
+	return ""
 }
 
 func (tst *TextSelectionTracker) isSelectionHotkey(combination string) bool {
@@ -0,0 +1,234 @@
+package recorder
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tracker names, matching the event_types keys reported by GetStatistics
+const (
+	TrackerTextInput     = "text_input"
+	TrackerBrowserTabs   = "browser_navigation"
+	TrackerHotkeys       = "hotkey"
+	TrackerTextSelection = "text_selection"
+	TrackerDragDrop      = "drag_drop"
+)
+
+// trackerNames lists every tracker the capture loop drives
+var trackerNames = []string{TrackerTextInput, TrackerBrowserTabs, TrackerHotkeys, TrackerTextSelection, TrackerDragDrop, TrackerCommands}
+
+// TrackerHealth is the activity and failure record of one tracker
+type TrackerHealth struct {
+	Enabled       bool
+	EventCount    int64
+	ErrorCount    int64
+	LastEventTime time.Time
+	LastError     string
+	Running       int       // Calls in progress
+	RunningSince  time.Time // When the calls in progress began, for the watchdog
+	Restarts      int64     // Times the watchdog replaced the tracker
+}
+
+// TrackerHealthMonitor records per-tracker health so a tracker that is
+// disabled, failing or simply never triggered can be told apart
+type TrackerHealthMonitor struct {
+	Trackers  map[string]*TrackerHealth
+	Telemetry *Telemetry // Told of tracker panics; nil for none
+	Mutex     sync.RWMutex
+}
+
+// NewTrackerHealthMonitor creates a monitor with each tracker enabled or
+// disabled according to config
+func NewTrackerHealthMonitor(config WorkflowRecorderConfig) *TrackerHealthMonitor {
+	monitor := &TrackerHealthMonitor{
+		Trackers: make(map[string]*TrackerHealth),
+	}
+
+	for _, name := range trackerNames {
+		monitor.Trackers[name] = &TrackerHealth{Enabled: trackerEnabledInConfig(name, config)}
+	}
+
+	return monitor
+}
+
+// IsEnabled reports whether the named tracker is enabled
+func (thm *TrackerHealthMonitor) IsEnabled(name string) bool {
+	thm.Mutex.RLock()
+	defer thm.Mutex.RUnlock()
+
+	health, exists := thm.Trackers[name]
+	return exists && health.Enabled
+}
+
+// Run calls fn if the named tracker is enabled, counting a panic in fn as a
+// tracker error instead of letting it end the capture loop
+func (thm *TrackerHealthMonitor) Run(name string, fn func()) {
+	if !thm.IsEnabled(name) {
+		return
+	}
+
+	restarts := thm.enter(name)
+	defer func() {
+		thm.leave(name, restarts)
+		if r := recover(); r != nil {
+			thm.RecordError(name, fmt.Errorf("panic: %v", r))
+			if telemetry := thm.Telemetry; telemetry != nil {
+				telemetry.RecordPanic(name)
+			}
+		}
+	}()
+
+	fn()
+}
+
+// enter marks a call into the named tracker as in progress, returning its
+// restart count for leave
+func (thm *TrackerHealthMonitor) enter(name string) int64 {
+	thm.Mutex.Lock()
+	defer thm.Mutex.Unlock()
+
+	health := thm.Trackers[name]
+	if health.Running == 0 {
+		health.RunningSince = time.Now()
+	}
+	health.Running++
+	return health.Restarts
+}
+
+// leave marks a call into the named tracker as done. A call into a tracker
+// restarted since it began no longer counts.
+func (thm *TrackerHealthMonitor) leave(name string, restarts int64) {
+	thm.Mutex.Lock()
+	defer thm.Mutex.Unlock()
+
+	if health := thm.Trackers[name]; health.Restarts == restarts && health.Running > 0 {
+		health.Running--
+	}
+}
+
+// Stalled returns the trackers a call has been in for longer than timeout,
+// as of now
+func (thm *TrackerHealthMonitor) Stalled(now time.Time, timeout time.Duration) []string {
+	thm.Mutex.RLock()
+	defer thm.Mutex.RUnlock()
+
+	var stalled []string
+	for _, name := range trackerNames {
+		if health, exists := thm.Trackers[name]; exists && health.Running > 0 && now.Sub(health.RunningSince) > timeout {
+			stalled = append(stalled, name)
+		}
+	}
+	return stalled
+}
+
+// Restarted notes that the named tracker was replaced, leaving calls into
+// the old one behind
+func (thm *TrackerHealthMonitor) Restarted(name string) {
+	thm.Mutex.Lock()
+	defer thm.Mutex.Unlock()
+
+	if health, exists := thm.Trackers[name]; exists {
+		health.Running = 0
+		health.RunningSince = time.Time{}
+		health.Restarts++
+	}
+}
+
+// RecordEvent notes that the named tracker emitted an event
+func (thm *TrackerHealthMonitor) RecordEvent(name string) {
+	thm.Mutex.Lock()
+	defer thm.Mutex.Unlock()
+
+	if health, exists := thm.Trackers[name]; exists {
+		health.EventCount++
+		health.LastEventTime = time.Now()
+	}
+}
+
+// RecordError notes a failure in the named tracker
+func (thm *TrackerHealthMonitor) RecordError(name string, err error) {
+	thm.Mutex.Lock()
+	defer thm.Mutex.Unlock()
+
+	if health, exists := thm.Trackers[name]; exists {
+		health.ErrorCount++
+		health.LastError = err.Error()
+	}
+
+	logger("trackers").Warn("Tracker error", "tracker", name, "error", err)
+}
+
+// GetStatistics returns the health of every tracker keyed by name
+func (thm *TrackerHealthMonitor) GetStatistics() map[string]interface{} {
+	thm.Mutex.RLock()
+	defer thm.Mutex.RUnlock()
+
+	names := make([]string, 0, len(thm.Trackers))
+	for name := range thm.Trackers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		health := thm.Trackers[name]
+
+		lastEventTime := ""
+		if !health.LastEventTime.IsZero() {
+			lastEventTime = health.LastEventTime.Format(time.RFC3339)
+		}
+
+		stats[name] = map[string]interface{}{
+			"enabled":         health.Enabled,
+			"event_count":     health.EventCount,
+			"error_count":     health.ErrorCount,
+			"last_event_time": lastEventTime,
+			"last_error":      health.LastError,
+			"restarts":        health.Restarts,
+		}
+	}
+
+	return stats
+}
+
+// trackerEnabledInConfig maps a tracker to its config toggle
+func trackerEnabledInConfig(name string, config WorkflowRecorderConfig) bool {
+	switch name {
+	case TrackerTextInput:
+		return config.RecordTextInputCompletion
+	case TrackerBrowserTabs:
+		return config.RecordBrowserTabNavigation
+	case TrackerHotkeys:
+		return config.RecordHotkeys
+	case TrackerTextSelection:
+		return config.RecordTextSelection
+	case TrackerDragDrop:
+		return config.RecordDragDrop
+	case TrackerCommands:
+		return keyboardModeEnabled(config)
+	default:
+		return false
+	}
+}
+
+// trackerForEvent returns the name of the tracker that emits event, or ""
+func trackerForEvent(event WorkflowEvent) string {
+	switch event.(type) {
+	case TextInputCompletedEvent:
+		return TrackerTextInput
+	case BrowserTabNavigationEvent:
+		return TrackerBrowserTabs
+	case HotkeyEvent:
+		return TrackerHotkeys
+	case TextSelectionEvent:
+		return TrackerTextSelection
+	case DragDropEvent:
+		return TrackerDragDrop
+	case CommandEnteredEvent:
+		return TrackerCommands
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,401 @@
+package recorder
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Notification area icon. With TrayIcon set, an icon shows whether the
+// recorder is recording, paused or stopped, and its tooltip the state and
+// the number of events recorded. Its menu pauses or resumes the recording,
+// stops and saves it, opens the output folder, opens the report of the last
+// saved recording (writing it first if need be) and exits as Ctrl+C would.
+// The icon has its own thread, since its hidden window needs a message loop.
+
+var (
+	shell32                 = syscall.NewLazyDLL("shell32.dll")
+	procShellNotifyIcon     = shell32.NewProc("Shell_NotifyIconW")
+	procRegisterClassEx     = user32.NewProc("RegisterClassExW")
+	procCreateWindowEx      = user32.NewProc("CreateWindowExW")
+	procDefWindowProc       = user32.NewProc("DefWindowProcW")
+	procDestroyWindow       = user32.NewProc("DestroyWindow")
+	procGetMessage          = user32.NewProc("GetMessageW")
+	procTranslateMessage    = user32.NewProc("TranslateMessage")
+	procDispatchMessage     = user32.NewProc("DispatchMessageW")
+	procPostMessage         = user32.NewProc("PostMessageW")
+	procPostQuitMessage     = user32.NewProc("PostQuitMessage")
+	procSetTimer            = user32.NewProc("SetTimer")
+	procCreatePopupMenu     = user32.NewProc("CreatePopupMenu")
+	procAppendMenu          = user32.NewProc("AppendMenuW")
+	procTrackPopupMenu      = user32.NewProc("TrackPopupMenu")
+	procDestroyMenu         = user32.NewProc("DestroyMenu")
+	procSetForegroundWindow = user32.NewProc("SetForegroundWindow")
+	procLoadIcon            = user32.NewProc("LoadIconW")
+	procRegisterWindowMsg   = user32.NewProc("RegisterWindowMessageW")
+	procGetModuleHandle     = kernel32.NewProc("GetModuleHandleW")
+)
+
+const (
+	WM_NULL         = 0x0000
+	WM_DESTROY      = 0x0002
+	WM_CLOSE        = 0x0010
+	WM_TIMER        = 0x0113
+	WM_LBUTTONUP    = 0x0202
+	WM_RBUTTONUP    = 0x0205
+	WM_APP          = 0x8000
+	NIM_ADD         = 0
+	NIM_MODIFY      = 1
+	NIM_DELETE      = 2
+	NIF_MESSAGE     = 0x1
+	NIF_ICON        = 0x2
+	NIF_TIP         = 0x4
+	MF_STRING       = 0x0
+	MF_GRAYED       = 0x1
+	MF_SEPARATOR    = 0x800
+	TPM_RETURNCMD   = 0x100
+	TPM_RIGHTBTN    = 0x2
+	IDI_APPLICATION = 32512
+	IDI_WARNING     = 32515
+	IDI_INFORMATION = 32516
+
+	trayClassName       = "ClaraVerseRecorderTray"
+	trayCallbackMessage = WM_APP + 1
+	trayRefreshMs       = 1000
+)
+
+// Tray menu commands
+const (
+	trayCommandPause = iota + 1
+	trayCommandStopAndSave
+	trayCommandOpenFolder
+	trayCommandOpenReport
+	trayCommandExit
+)
+
+// NOTIFYICONDATAW is the Win32 structure Shell_NotifyIconW takes
+type NOTIFYICONDATAW struct {
+	cbSize           uint32
+	hWnd             uintptr
+	uID              uint32
+	uFlags           uint32
+	uCallbackMessage uint32
+	hIcon            uintptr
+	szTip            [128]uint16
+	dwState          uint32
+	dwStateMask      uint32
+	szInfo           [256]uint16
+	uVersion         uint32
+	szInfoTitle      [64]uint16
+	dwInfoFlags      uint32
+	guidItem         [16]byte
+	hBalloonIcon     uintptr
+}
+
+// WNDCLASSEXW is the Win32 structure RegisterClassExW takes
+type WNDCLASSEXW struct {
+	cbSize        uint32
+	style         uint32
+	lpfnWndProc   uintptr
+	cbClsExtra    int32
+	cbWndExtra    int32
+	hInstance     uintptr
+	hIcon         uintptr
+	hCursor       uintptr
+	hbrBackground uintptr
+	lpszMenuName  *uint16
+	lpszClassName *uint16
+	hIconSm       uintptr
+}
+
+// MSG is the Win32 structure GetMessageW fills
+type MSG struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      POINT
+}
+
+// TrayIcon is the recorder's icon in the notification area
+type TrayIcon struct {
+	Controller      *RecordingController
+	OutputDirectory string
+	Events          int    // Events in the current or last recording
+	Tip             string // Tooltip shown
+	icon            uintptr
+	hwnd            uintptr
+	taskbarCreated  uintptr
+	exits           chan struct{}
+}
+
+// activeTrayIcon receives the messages of the tray window
+var activeTrayIcon *TrayIcon
+
+// NewTrayIcon creates the tray icon for controller, or returns nil when
+// TrayIcon is off
+func NewTrayIcon(config WorkflowRecorderConfig, controller *RecordingController) *TrayIcon {
+	if !config.TrayIcon {
+		return nil
+	}
+	return &TrayIcon{
+		Controller:      controller,
+		OutputDirectory: config.OutputDirectory,
+		exits:           make(chan struct{}, 1),
+	}
+}
+
+// ExitRequests receives when Exit is chosen from the menu
+func (t *TrayIcon) ExitRequests() <-chan struct{} {
+	return t.exits
+}
+
+// Start shows the icon and runs its message loop until Close
+func (t *TrayIcon) Start() error {
+	ready := make(chan error, 1)
+	go t.run(ready)
+	return <-ready
+}
+
+// Close removes the icon
+func (t *TrayIcon) Close() {
+	procPostMessage.Call(t.hwnd, WM_CLOSE, 0, 0)
+}
+
+// run creates the hidden window and icon, reports on ready, and dispatches
+// the window's messages. Windows belong to the thread that creates them, so
+// it keeps its thread.
+func (t *TrayIcon) run(ready chan<- error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	instance, _, _ := procGetModuleHandle.Call(0)
+	className, _ := syscall.UTF16PtrFromString(trayClassName)
+	class := WNDCLASSEXW{
+		lpfnWndProc:   syscall.NewCallback(trayWindowProc),
+		hInstance:     instance,
+		lpszClassName: className,
+	}
+	class.cbSize = uint32(unsafe.Sizeof(class))
+	if ret, _, err := procRegisterClassEx.Call(uintptr(unsafe.Pointer(&class))); ret == 0 {
+		ready <- NewWorkflowError(ErrorTypeSystem, "Failed to register the tray window class", err)
+		return
+	}
+
+	activeTrayIcon = t
+	hwnd, _, err := procCreateWindowEx.Call(0, uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+		0, 0, 0, 0, 0, 0, 0, instance, 0)
+	if hwnd == 0 {
+		ready <- NewWorkflowError(ErrorTypeSystem, "Failed to create the tray window", err)
+		return
+	}
+	t.hwnd = hwnd
+	taskbarCreated, _ := syscall.UTF16PtrFromString("TaskbarCreated")
+	t.taskbarCreated, _, _ = procRegisterWindowMsg.Call(uintptr(unsafe.Pointer(taskbarCreated)))
+
+	t.refresh()
+	if !t.notify(NIM_ADD) {
+		procDestroyWindow.Call(hwnd)
+		ready <- NewWorkflowError(ErrorTypeSystem, "Failed to add the tray icon", nil)
+		return
+	}
+	procSetTimer.Call(hwnd, 1, trayRefreshMs, 0)
+	ready <- nil
+
+	var msg MSG
+	for {
+		if ret, _, _ := procGetMessage.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0); ret == 0 || int32(ret) == -1 {
+			return
+		}
+		procTranslateMessage.Call(uintptr(unsafe.Pointer(&msg)))
+		procDispatchMessage.Call(uintptr(unsafe.Pointer(&msg)))
+	}
+}
+
+// trayWindowProc handles the messages of the tray window
+func trayWindowProc(hwnd, message, wParam, lParam uintptr) uintptr {
+	t := activeTrayIcon
+	switch {
+	case t == nil:
+	case message == WM_TIMER:
+		if t.refresh() {
+			t.notify(NIM_MODIFY)
+		}
+		return 0
+	case message == trayCallbackMessage && (lParam == WM_RBUTTONUP || lParam == WM_LBUTTONUP):
+		t.showMenu()
+		return 0
+	case message == t.taskbarCreated && t.taskbarCreated != 0:
+		// Explorer restarted and lost its icons
+		t.notify(NIM_ADD)
+		return 0
+	case message == WM_CLOSE:
+		t.notify(NIM_DELETE)
+		procDestroyWindow.Call(hwnd)
+		return 0
+	case message == WM_DESTROY:
+		procPostQuitMessage.Call(0)
+		return 0
+	}
+	ret, _, _ := procDefWindowProc.Call(hwnd, message, wParam, lParam)
+	return ret
+}
+
+// trayStateName returns the state the icon shows for a recorder state
+func trayStateName(state RecorderState) MessageKey {
+	switch state {
+	case RecorderStateStarting, RecorderStateRecording:
+		return MsgTrayRecording
+	case RecorderStatePaused:
+		return MsgTrayPaused
+	default:
+		return MsgTrayStopped
+	}
+}
+
+// refresh reads the recorder's state into the icon and tooltip, returning
+// whether either changed
+func (t *TrayIcon) refresh() bool {
+	if workflow := t.Controller.Active(); workflow != nil {
+		t.Events = workflow.EventCount()
+	}
+	state := trayStateName(t.Controller.State.GetState())
+	iconID := uintptr(IDI_APPLICATION)
+	switch state {
+	case MsgTrayRecording:
+		iconID = IDI_INFORMATION
+	case MsgTrayPaused:
+		iconID = IDI_WARNING
+	}
+	icon, _, _ := procLoadIcon.Call(0, iconID)
+	tip := Msg(MsgTrayTooltip, Msg(state), t.Events)
+
+	changed := icon != t.icon || tip != t.Tip
+	t.icon, t.Tip = icon, tip
+	return changed
+}
+
+// notify passes the icon to Shell_NotifyIconW with action, returning
+// whether it succeeded
+func (t *TrayIcon) notify(action uintptr) bool {
+	data := NOTIFYICONDATAW{
+		hWnd:             t.hwnd,
+		uID:              1,
+		uFlags:           NIF_MESSAGE | NIF_ICON | NIF_TIP,
+		uCallbackMessage: trayCallbackMessage,
+		hIcon:            t.icon,
+	}
+	data.cbSize = uint32(unsafe.Sizeof(data))
+	tip, _ := syscall.UTF16FromString(t.Tip)
+	copy(data.szTip[:len(data.szTip)-1], tip)
+	ret, _, _ := procShellNotifyIcon.Call(action, uintptr(unsafe.Pointer(&data)))
+	return ret != 0
+}
+
+// showMenu shows the menu at the cursor and carries out the command chosen
+func (t *TrayIcon) showMenu() {
+	menu, _, _ := procCreatePopupMenu.Call()
+	if menu == 0 {
+		return
+	}
+	defer procDestroyMenu.Call(menu)
+
+	state := t.Controller.State.GetState()
+	recording := state == RecorderStateRecording || state == RecorderStatePaused
+	pauseLabel := MsgTrayPause
+	if state == RecorderStatePaused {
+		pauseLabel = MsgTrayResume
+	}
+	appendTrayMenuItem(menu, trayCommandPause, Msg(pauseLabel), recording)
+	appendTrayMenuItem(menu, trayCommandStopAndSave, Msg(MsgTrayStopAndSave), recording)
+	procAppendMenu.Call(menu, MF_SEPARATOR, 0, 0)
+	appendTrayMenuItem(menu, trayCommandOpenFolder, Msg(MsgTrayOpenFolder), true)
+	appendTrayMenuItem(menu, trayCommandOpenReport, Msg(MsgTrayOpenReport), t.Controller.GetLastSavedFile() != "")
+	procAppendMenu.Call(menu, MF_SEPARATOR, 0, 0)
+	appendTrayMenuItem(menu, trayCommandExit, Msg(MsgTrayExit), true)
+
+	// Without the foreground the menu stays open when clicked away from
+	var point POINT
+	procGetCursorPos.Call(uintptr(unsafe.Pointer(&point)))
+	procSetForegroundWindow.Call(t.hwnd)
+	command, _, _ := procTrackPopupMenu.Call(menu, TPM_RETURNCMD|TPM_RIGHTBTN,
+		uintptr(point.X), uintptr(point.Y), 0, t.hwnd, 0)
+	procPostMessage.Call(t.hwnd, WM_NULL, 0, 0)
+
+	// Saving and reports take a while; the menu must not wait for them
+	go t.runCommand(int(command))
+}
+
+// appendTrayMenuItem adds a command to the menu, grayed unless enabled
+func appendTrayMenuItem(menu uintptr, command int, label string, enabled bool) {
+	flags := uintptr(MF_STRING)
+	if !enabled {
+		flags |= MF_GRAYED
+	}
+	text, _ := syscall.UTF16PtrFromString(label)
+	procAppendMenu.Call(menu, flags, uintptr(command), uintptr(unsafe.Pointer(text)))
+}
+
+// runCommand carries out a menu command
+func (t *TrayIcon) runCommand(command int) {
+	switch command {
+	case trayCommandPause:
+		togglePause(t.Controller.State)
+	case trayCommandStopAndSave:
+		workflow, filename, err := t.Controller.StopAndSave()
+		if err != nil {
+			logger("tray").Error("Failed to stop the recording from the tray", "error", err)
+			return
+		}
+		if filename != "" {
+			printConsole(Msg(MsgSaved, filename))
+			printConsole(Msg(MsgTotalEvents, workflow.EventCount()))
+		}
+	case trayCommandOpenFolder:
+		if err := EnsureDirectoryExists(t.OutputDirectory); err != nil {
+			logger("tray").Error("Failed to create the output folder", "error", err)
+			return
+		}
+		openWithShell(t.OutputDirectory)
+	case trayCommandOpenReport:
+		if reportFile, err := lastRecordingReport(t.Controller.GetLastSavedFile(), t.Controller.Recorder.currentConfig().ScreenshotStore); err != nil {
+			logger("tray").Error("Failed to write the report", "error", err)
+		} else {
+			openWithShell(reportFile)
+		}
+	case trayCommandExit:
+		select {
+		case t.exits <- struct{}{}:
+		default:
+			// Already asked
+		}
+	}
+}
+
+// lastRecordingReport returns the HTML report of a saved recording, writing
+// it when there is none yet
+func lastRecordingReport(filename, store string) (string, error) {
+	if filename == "" {
+		return "", NewWorkflowError(ErrorTypeRecording, "No recording has been saved", nil)
+	}
+	reportFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + "_report.html"
+	if _, err := os.Stat(reportFile); err == nil {
+		return reportFile, nil
+	}
+	return exportRecordingReport(filename, ReportFormatHTML, store)
+}
+
+// openWithShell opens a folder or file as if it were double-clicked
+func openWithShell(path string) {
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+	if err := exec.Command("explorer.exe", path).Start(); err != nil {
+		logger("tray").Error("Failed to open", "path", path, "error", err)
+	}
+}
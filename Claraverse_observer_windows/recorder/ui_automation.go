@@ -0,0 +1,640 @@
+package recorder
+
+import (
+	"runtime"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// Windows API for COM and UI Automation
+var (
+	ole32                = syscall.NewLazyDLL("ole32.dll")
+	oleaut32             = syscall.NewLazyDLL("oleaut32.dll")
+	procCoInitializeEx   = ole32.NewProc("CoInitializeEx")
+	procCoUninitialize   = ole32.NewProc("CoUninitialize")
+	procCoCreateInstance = ole32.NewProc("CoCreateInstance")
+	procSysAllocString   = oleaut32.NewProc("SysAllocString")
+	procSysStringLen     = oleaut32.NewProc("SysStringLen")
+	procSysFreeString    = oleaut32.NewProc("SysFreeString")
+
+	procSafeArrayGetUBound    = oleaut32.NewProc("SafeArrayGetUBound")
+	procSafeArrayAccessData   = oleaut32.NewProc("SafeArrayAccessData")
+	procSafeArrayUnaccessData = oleaut32.NewProc("SafeArrayUnaccessData")
+	procSafeArrayDestroy      = oleaut32.NewProc("SafeArrayDestroy")
+)
+
+const (
+	COINIT_MULTITHREADED = 0x0
+	CLSCTX_INPROC_SERVER = 0x1
+	RPC_E_CHANGED_MODE   = 0x80010106
+
+	UIA_ValuePatternId             = 10002
+	UIA_ScrollPatternId            = 10004
+	UIA_TextPatternId              = 10014
+	UIA_LegacyIAccessiblePatternId = 10018
+	UIA_TextPattern2Id             = 10024
+
+	UIA_ControlTypePropertyId  = 30003
+	UIA_NamePropertyId         = 30005
+	UIA_AutomationIdPropertyId = 30011
+	UIA_ClassNamePropertyId    = 30012
+
+	TreeScope_Descendants = 0x4
+
+	TextUnit_Character = 0
+
+	VT_I4   = 3
+	VT_BSTR = 8
+)
+
+// GUID is the Windows GUID layout
+type GUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+var (
+	CLSID_CUIAutomation                       = GUID{0xff48dba4, 0x60ef, 0x4201, [8]byte{0xaa, 0x87, 0x54, 0x10, 0x3e, 0xef, 0x59, 0x4e}}
+	IID_IUIAutomation                         = GUID{0x30cbe57d, 0xd9d0, 0x452a, [8]byte{0xab, 0x13, 0x7a, 0xc5, 0xac, 0x48, 0x25, 0xee}}
+	IID_IUIAutomationTextPattern              = GUID{0x32eba289, 0x3583, 0x42c9, [8]byte{0x9c, 0x59, 0x3b, 0x6d, 0x9a, 0x1e, 0x9b, 0x46}}
+	IID_IUIAutomationValuePattern             = GUID{0xa94cd8b1, 0x0844, 0x4cd6, [8]byte{0x9d, 0x2d, 0x64, 0x05, 0x37, 0xab, 0x39, 0xe9}}
+	IID_IUIAutomationLegacyIAccessiblePattern = GUID{0x828055ad, 0x355b, 0x4435, [8]byte{0x86, 0xd5, 0x3b, 0x51, 0xc1, 0x4a, 0x9b, 0x1b}}
+	IID_IUIAutomationTextPattern2             = GUID{0x506a921a, 0xfcc9, 0x409f, [8]byte{0xb2, 0x3b, 0x37, 0xeb, 0x74, 0x10, 0x68, 0x72}}
+	IID_IUIAutomationScrollPattern            = GUID{0x88f4d42a, 0xe881, 0x459d, [8]byte{0xa7, 0x7c, 0x73, 0xbb, 0xbb, 0x7e, 0x02, 0xdc}}
+)
+
+// Vtable slots of the UI Automation interfaces used here, counted from the
+// IUnknown methods at 0-2
+const (
+	vtblRelease = 2
+
+	vtblAutomationCompareElements         = 3
+	vtblAutomationElementFromHandle       = 6
+	vtblAutomationElementFromPoint        = 7
+	vtblAutomationGetFocusedElement       = 8
+	vtblAutomationGetControlViewWalker    = 14
+	vtblAutomationCreatePropertyCondition = 23
+	vtblAutomationCreateAndCondition      = 25
+
+	vtblElementFindFirst = 5
+
+	vtblElementGetCurrentPatternAs         = 14
+	vtblElementGetCurrentControlType       = 21
+	vtblElementGetCurrentName              = 23
+	vtblElementGetCurrentIsEnabled         = 28
+	vtblElementGetCurrentAutomationId      = 29
+	vtblElementGetCurrentClassName         = 30
+	vtblElementGetCurrentIsPassword        = 35
+	vtblElementGetCurrentBoundingRectangle = 43
+
+	vtblTreeWalkerGetParentElement      = 3
+	vtblTreeWalkerGetFirstChildElement  = 4
+	vtblTreeWalkerGetNextSiblingElement = 6
+
+	vtblTextPatternGetSelection   = 5
+	vtblTextPattern2GetCaretRange = 10
+
+	vtblRangeArrayGetLength  = 3
+	vtblRangeArrayGetElement = 4
+
+	vtblTextRangeExpandToEnclosingUnit = 6
+	vtblTextRangeGetBoundingRectangles = 10
+	vtblTextRangeGetText               = 12
+
+	vtblScrollPatternGetHorizontalPercent = 5
+	vtblScrollPatternGetVerticalPercent   = 6
+
+	vtblValuePatternGetCurrentValue = 4
+
+	vtblLegacyPatternGetCurrentValue = 8
+)
+
+// VARIANT is the OLE VARIANT layout: a type tag and a two-word value union,
+// 16 bytes on 32-bit Windows and 24 on 64-bit
+type VARIANT struct {
+	VT        uint16
+	reserved1 uint16
+	reserved2 uint16
+	reserved3 uint16
+	Val       [2]uintptr
+}
+
+// args returns the VARIANT as by-value call arguments. 64-bit calling
+// conventions pass a struct of this size by reference, 32-bit ones on the
+// stack word by word.
+func (v *VARIANT) args() []uintptr {
+	if unsafe.Sizeof(*v) > 16 {
+		return []uintptr{uintptr(unsafe.Pointer(v))}
+	}
+	words := (*[4]uintptr)(unsafe.Pointer(v))
+	return words[:]
+}
+
+// comObject is a raw COM interface pointer
+type comObject uintptr
+
+// call invokes the method in the given vtable slot and returns its HRESULT
+func (obj comObject) call(slot int, args ...uintptr) uintptr {
+	// COM objects and their vtables are allocated by COM, not Go, and live
+	// as long as the reference the caller holds
+	vtbl := *(*uintptr)(unsafe.Pointer(obj))
+	method := *(*uintptr)(unsafe.Pointer(vtbl + uintptr(slot)*unsafe.Sizeof(vtbl)))
+
+	ret, _, _ := syscall.SyscallN(method, append([]uintptr{uintptr(obj)}, args...)...)
+	return ret
+}
+
+// Release drops the reference held on the object
+func (obj comObject) Release() {
+	if obj != 0 {
+		obj.call(vtblRelease)
+	}
+}
+
+func failedHRESULT(hr uintptr) bool {
+	return int32(hr) < 0
+}
+
+// UIAutomationClient is a UI Automation client bound to the calling OS
+// thread. Create one per operation and Close it on the same goroutine.
+type UIAutomationClient struct {
+	Automation   comObject
+	uninitialize bool
+}
+
+// NewUIAutomationClient joins the multithreaded COM apartment and creates the
+// UI Automation object
+func NewUIAutomationClient() (*UIAutomationClient, error) {
+	runtime.LockOSThread()
+
+	client := &UIAutomationClient{}
+
+	hr, _, _ := procCoInitializeEx.Call(0, COINIT_MULTITHREADED)
+	switch {
+	case !failedHRESULT(hr):
+		client.uninitialize = true
+	case uint32(hr) == RPC_E_CHANGED_MODE:
+		// The thread already has a single-threaded apartment; use it as is
+	default:
+		runtime.UnlockOSThread()
+		return nil, NewWorkflowError(ErrorTypeSystem, "CoInitializeEx failed", syscall.Errno(hr))
+	}
+
+	var automation comObject
+	hr, _, _ = procCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&CLSID_CUIAutomation)),
+		0,
+		CLSCTX_INPROC_SERVER,
+		uintptr(unsafe.Pointer(&IID_IUIAutomation)),
+		uintptr(unsafe.Pointer(&automation)))
+	if failedHRESULT(hr) || automation == 0 {
+		client.Close()
+		return nil, NewWorkflowError(ErrorTypeSystem, "Failed to create UI Automation client", syscall.Errno(hr))
+	}
+	client.Automation = automation
+
+	return client, nil
+}
+
+// Close releases the automation object and leaves the COM apartment
+func (c *UIAutomationClient) Close() {
+	c.Automation.Release()
+	c.Automation = 0
+
+	if c.uninitialize {
+		procCoUninitialize.Call()
+		c.uninitialize = false
+	}
+	runtime.UnlockOSThread()
+}
+
+// FocusedElement returns the element with keyboard focus. The caller must
+// Release it.
+func (c *UIAutomationClient) FocusedElement() (comObject, error) {
+	var element comObject
+	hr := c.Automation.call(vtblAutomationGetFocusedElement, uintptr(unsafe.Pointer(&element)))
+	if failedHRESULT(hr) || element == 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "No focused UI Automation element", syscall.Errno(hr))
+	}
+	return element, nil
+}
+
+// ElementFromHandle returns the element for a window. The caller must
+// Release it.
+func (c *UIAutomationClient) ElementFromHandle(hwnd uintptr) (comObject, error) {
+	var element comObject
+	hr := c.Automation.call(vtblAutomationElementFromHandle, hwnd, uintptr(unsafe.Pointer(&element)))
+	if failedHRESULT(hr) || element == 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "No UI Automation element for window", syscall.Errno(hr))
+	}
+	return element, nil
+}
+
+// ElementFromPoint returns the element at a screen position. The caller
+// must Release it.
+func (c *UIAutomationClient) ElementFromPoint(position Position) (comObject, error) {
+	var element comObject
+	args := append(pointArgs(position), uintptr(unsafe.Pointer(&element)))
+	hr := c.Automation.call(vtblAutomationElementFromPoint, args...)
+	if failedHRESULT(hr) || element == 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "No UI Automation element at point", syscall.Errno(hr))
+	}
+	return element, nil
+}
+
+// pointArgs returns a POINT as by-value call arguments: one register on
+// 64-bit Windows, two stack words on 32-bit
+func pointArgs(position Position) []uintptr {
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		return []uintptr{uintptr(uint64(uint32(position.X)) | uint64(uint32(position.Y))<<32)}
+	}
+	return []uintptr{uintptr(uint32(position.X)), uintptr(uint32(position.Y))}
+}
+
+// ControlViewWalker returns a walker over the control view of the element
+// tree. The caller must Release it.
+func (c *UIAutomationClient) ControlViewWalker() (comObject, error) {
+	var walker comObject
+	hr := c.Automation.call(vtblAutomationGetControlViewWalker, uintptr(unsafe.Pointer(&walker)))
+	if failedHRESULT(hr) || walker == 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "No UI Automation tree walker", syscall.Errno(hr))
+	}
+	return walker, nil
+}
+
+// SameElement reports whether two element objects are the same element
+func (c *UIAutomationClient) SameElement(a, b comObject) bool {
+	var same int32
+	hr := c.Automation.call(vtblAutomationCompareElements, uintptr(a), uintptr(b), uintptr(unsafe.Pointer(&same)))
+	return !failedHRESULT(hr) && same != 0
+}
+
+// walkerStep moves a tree walker from element to its parent, first child
+// or next sibling, given the walker method's slot. It returns 0 when there
+// is none; otherwise the caller must Release the result.
+func walkerStep(walker comObject, slot int, element comObject) comObject {
+	var next comObject
+	if hr := walker.call(slot, uintptr(element), uintptr(unsafe.Pointer(&next))); failedHRESULT(hr) {
+		return 0
+	}
+	return next
+}
+
+// elementString reads one of an element's BSTR property getters, given its
+// slot
+func elementString(element comObject, slot int) string {
+	var bstr uintptr
+	if hr := element.call(slot, uintptr(unsafe.Pointer(&bstr))); failedHRESULT(hr) {
+		return ""
+	}
+	return bstrToString(bstr)
+}
+
+// elementControlType returns an element's control type ID, or 0
+func elementControlType(element comObject) int32 {
+	var controlType int32
+	if hr := element.call(vtblElementGetCurrentControlType, uintptr(unsafe.Pointer(&controlType))); failedHRESULT(hr) {
+		return 0
+	}
+	return controlType
+}
+
+// elementEnabled reports whether an element is enabled; true when UI
+// Automation cannot tell
+func elementEnabled(element comObject) bool {
+	var enabled int32
+	if hr := element.call(vtblElementGetCurrentIsEnabled, uintptr(unsafe.Pointer(&enabled))); failedHRESULT(hr) {
+		return true
+	}
+	return enabled != 0
+}
+
+// elementBounds returns an element's bounding rectangle on the screen.
+// ok is false for elements with no size, such as hidden ones.
+func elementBounds(element comObject) (bounds RECT, ok bool) {
+	if hr := element.call(vtblElementGetCurrentBoundingRectangle, uintptr(unsafe.Pointer(&bounds))); failedHRESULT(hr) {
+		return RECT{}, false
+	}
+	return bounds, bounds.Right > bounds.Left && bounds.Bottom > bounds.Top
+}
+
+// StringCondition creates a condition matching elements whose string
+// property equals value. The caller must Release it.
+func (c *UIAutomationClient) StringCondition(propertyID uintptr, value string) (comObject, error) {
+	bstr := sysAllocString(value)
+	if bstr == 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "SysAllocString failed", nil)
+	}
+	defer procSysFreeString.Call(bstr)
+
+	variant := VARIANT{VT: VT_BSTR}
+	variant.Val[0] = bstr
+	return c.propertyCondition(propertyID, variant)
+}
+
+// IntCondition creates a condition matching elements whose integer
+// property equals value. The caller must Release it.
+func (c *UIAutomationClient) IntCondition(propertyID uintptr, value int32) (comObject, error) {
+	variant := VARIANT{VT: VT_I4}
+	variant.Val[0] = uintptr(uint32(value))
+	return c.propertyCondition(propertyID, variant)
+}
+
+// propertyCondition creates a condition matching a property value
+func (c *UIAutomationClient) propertyCondition(propertyID uintptr, variant VARIANT) (comObject, error) {
+	var condition comObject
+	args := append(append([]uintptr{propertyID}, variant.args()...), uintptr(unsafe.Pointer(&condition)))
+	hr := c.Automation.call(vtblAutomationCreatePropertyCondition, args...)
+	if failedHRESULT(hr) || condition == 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "Failed to create UI Automation condition", syscall.Errno(hr))
+	}
+	return condition, nil
+}
+
+// FindFirst returns the first descendant of root matching all conditions.
+// The caller must Release it.
+func (c *UIAutomationClient) FindFirst(root comObject, conditions ...comObject) (comObject, error) {
+	condition := conditions[0]
+	for _, next := range conditions[1:] {
+		var both comObject
+		hr := c.Automation.call(vtblAutomationCreateAndCondition, uintptr(condition), uintptr(next), uintptr(unsafe.Pointer(&both)))
+		if condition != conditions[0] {
+			condition.Release()
+		}
+		if failedHRESULT(hr) || both == 0 {
+			return 0, NewWorkflowError(ErrorTypeSystem, "Failed to create UI Automation condition", syscall.Errno(hr))
+		}
+		condition = both
+	}
+	if condition != conditions[0] {
+		defer condition.Release()
+	}
+
+	var found comObject
+	hr := root.call(vtblElementFindFirst, TreeScope_Descendants, uintptr(condition), uintptr(unsafe.Pointer(&found)))
+	if failedHRESULT(hr) || found == 0 {
+		return 0, NewWorkflowError(ErrorTypeSystem, "No matching UI Automation element", syscall.Errno(hr))
+	}
+	return found, nil
+}
+
+// FindFirstByString returns the first descendant of root whose string
+// property equals value. The caller must Release it.
+func (c *UIAutomationClient) FindFirstByString(root comObject, propertyID uintptr, value string) (comObject, error) {
+	condition, err := c.StringCondition(propertyID, value)
+	if err != nil {
+		return 0, err
+	}
+	defer condition.Release()
+
+	return c.FindFirst(root, condition)
+}
+
+// SelectedText returns the text selected in the element through its
+// TextPattern. Multiple selected ranges are joined with newlines.
+func (c *UIAutomationClient) SelectedText(element comObject) (string, error) {
+	var pattern comObject
+	hr := element.call(vtblElementGetCurrentPatternAs, UIA_TextPatternId,
+		uintptr(unsafe.Pointer(&IID_IUIAutomationTextPattern)), uintptr(unsafe.Pointer(&pattern)))
+	if failedHRESULT(hr) || pattern == 0 {
+		return "", NewWorkflowError(ErrorTypeSystem, "Element does not support TextPattern", nil)
+	}
+	defer pattern.Release()
+
+	var ranges comObject
+	hr = pattern.call(vtblTextPatternGetSelection, uintptr(unsafe.Pointer(&ranges)))
+	if failedHRESULT(hr) || ranges == 0 {
+		return "", NewWorkflowError(ErrorTypeSystem, "TextPattern selection unavailable", syscall.Errno(hr))
+	}
+	defer ranges.Release()
+
+	var count int32
+	if hr = ranges.call(vtblRangeArrayGetLength, uintptr(unsafe.Pointer(&count))); failedHRESULT(hr) {
+		return "", NewWorkflowError(ErrorTypeSystem, "TextPattern selection unavailable", syscall.Errno(hr))
+	}
+
+	var parts []string
+	for i := int32(0); i < count; i++ {
+		var textRange comObject
+		if hr = ranges.call(vtblRangeArrayGetElement, uintptr(i), uintptr(unsafe.Pointer(&textRange))); failedHRESULT(hr) || textRange == 0 {
+			continue
+		}
+
+		var bstr uintptr
+		maxLength := int32(-1)
+		hr = textRange.call(vtblTextRangeGetText, uintptr(maxLength), uintptr(unsafe.Pointer(&bstr)))
+		textRange.Release()
+		if failedHRESULT(hr) {
+			continue
+		}
+
+		if text := bstrToString(bstr); text != "" {
+			parts = append(parts, text)
+		}
+	}
+
+	return strings.Join(parts, "\n"), nil
+}
+
+// CaretBounds returns the screen rectangle of the text caret in the element
+// through its TextPattern2, for controls that draw their own caret
+func (c *UIAutomationClient) CaretBounds(element comObject) (left, top, width, height float64, err error) {
+	var pattern comObject
+	hr := element.call(vtblElementGetCurrentPatternAs, UIA_TextPattern2Id,
+		uintptr(unsafe.Pointer(&IID_IUIAutomationTextPattern2)), uintptr(unsafe.Pointer(&pattern)))
+	if failedHRESULT(hr) || pattern == 0 {
+		return 0, 0, 0, 0, NewWorkflowError(ErrorTypeSystem, "Element does not support TextPattern2", nil)
+	}
+	defer pattern.Release()
+
+	var active int32
+	var caret comObject
+	hr = pattern.call(vtblTextPattern2GetCaretRange, uintptr(unsafe.Pointer(&active)), uintptr(unsafe.Pointer(&caret)))
+	if failedHRESULT(hr) || caret == 0 {
+		return 0, 0, 0, 0, NewWorkflowError(ErrorTypeSystem, "No caret range", syscall.Errno(hr))
+	}
+	defer caret.Release()
+
+	rects := textRangeRectangles(caret)
+	if len(rects) < 4 {
+		// Many controls give an empty caret range no rectangle; the
+		// character after it has one
+		caret.call(vtblTextRangeExpandToEnclosingUnit, TextUnit_Character)
+		rects = textRangeRectangles(caret)
+	}
+	if len(rects) < 4 {
+		return 0, 0, 0, 0, NewWorkflowError(ErrorTypeSystem, "Caret has no position on screen", nil)
+	}
+	return rects[0], rects[1], rects[2], rects[3], nil
+}
+
+// textRangeRectangles returns a text range's rectangles on screen, as left,
+// top, width and height for each
+func textRangeRectangles(textRange comObject) []float64 {
+	var array uintptr
+	if hr := textRange.call(vtblTextRangeGetBoundingRectangles, uintptr(unsafe.Pointer(&array))); failedHRESULT(hr) || array == 0 {
+		return nil
+	}
+	defer procSafeArrayDestroy.Call(array)
+
+	var upper int32
+	if hr, _, _ := procSafeArrayGetUBound.Call(array, 1, uintptr(unsafe.Pointer(&upper))); failedHRESULT(hr) || upper < 0 {
+		return nil
+	}
+	var data uintptr
+	if hr, _, _ := procSafeArrayAccessData.Call(array, uintptr(unsafe.Pointer(&data))); failedHRESULT(hr) {
+		return nil
+	}
+	defer procSafeArrayUnaccessData.Call(array)
+
+	// SafeArrayAccessData locks the array's upper+1 elements in place until
+	// the deferred unaccess; they are copied out before then
+	return append([]float64(nil), unsafe.Slice((*float64)(unsafe.Pointer(data)), upper+1)...)
+}
+
+// ScrollPercents returns how far the element is scrolled each way, in
+// percent, through its ScrollPattern. A way it does not scroll is -1.
+func (c *UIAutomationClient) ScrollPercents(element comObject) (horizontal, vertical float64, err error) {
+	var pattern comObject
+	hr := element.call(vtblElementGetCurrentPatternAs, UIA_ScrollPatternId,
+		uintptr(unsafe.Pointer(&IID_IUIAutomationScrollPattern)), uintptr(unsafe.Pointer(&pattern)))
+	if failedHRESULT(hr) || pattern == 0 {
+		return 0, 0, NewWorkflowError(ErrorTypeSystem, "Element does not support ScrollPattern", nil)
+	}
+	defer pattern.Release()
+
+	if hr = pattern.call(vtblScrollPatternGetHorizontalPercent, uintptr(unsafe.Pointer(&horizontal))); failedHRESULT(hr) {
+		return 0, 0, NewWorkflowError(ErrorTypeSystem, "Scroll position unavailable", syscall.Errno(hr))
+	}
+	if hr = pattern.call(vtblScrollPatternGetVerticalPercent, uintptr(unsafe.Pointer(&vertical))); failedHRESULT(hr) {
+		return 0, 0, NewWorkflowError(ErrorTypeSystem, "Scroll position unavailable", syscall.Errno(hr))
+	}
+	return horizontal, vertical, nil
+}
+
+// Value returns the element's value through its ValuePattern, falling back
+// to the legacy IAccessible value for controls that only expose MSAA
+func (c *UIAutomationClient) Value(element comObject) (string, error) {
+	if value, ok := patternStringProperty(element, UIA_ValuePatternId,
+		&IID_IUIAutomationValuePattern, vtblValuePatternGetCurrentValue); ok {
+		return value, nil
+	}
+
+	if value, ok := patternStringProperty(element, UIA_LegacyIAccessiblePatternId,
+		&IID_IUIAutomationLegacyIAccessiblePattern, vtblLegacyPatternGetCurrentValue); ok {
+		return value, nil
+	}
+
+	return "", NewWorkflowError(ErrorTypeSystem, "Element exposes no readable value", nil)
+}
+
+// patternStringProperty reads a BSTR property getter from one of the
+// element's control patterns. ok is false if the pattern is unsupported.
+func patternStringProperty(element comObject, patternID uintptr, iid *GUID, slot int) (string, bool) {
+	var pattern comObject
+	hr := element.call(vtblElementGetCurrentPatternAs, patternID,
+		uintptr(unsafe.Pointer(iid)), uintptr(unsafe.Pointer(&pattern)))
+	if failedHRESULT(hr) || pattern == 0 {
+		return "", false
+	}
+	defer pattern.Release()
+
+	var bstr uintptr
+	if hr = pattern.call(slot, uintptr(unsafe.Pointer(&bstr))); failedHRESULT(hr) {
+		return "", false
+	}
+	return bstrToString(bstr), true
+}
+
+// IsPassword reports whether the element is a password field, whose
+// content should not be recorded
+func (c *UIAutomationClient) IsPassword(element comObject) (bool, error) {
+	var isPassword int32
+	if hr := element.call(vtblElementGetCurrentIsPassword, uintptr(unsafe.Pointer(&isPassword))); failedHRESULT(hr) {
+		return false, NewWorkflowError(ErrorTypeSystem, "IsPassword unavailable", syscall.Errno(hr))
+	}
+	return isPassword != 0, nil
+}
+
+// getUIAFocusedIsPassword reports whether the focused element is a password
+// field
+func getUIAFocusedIsPassword() (bool, error) {
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	element, err := client.FocusedElement()
+	if err != nil {
+		return false, err
+	}
+	defer element.Release()
+
+	return client.IsPassword(element)
+}
+
+// getUIAFocusedValue returns the value of the focused element
+func getUIAFocusedValue() (string, error) {
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	element, err := client.FocusedElement()
+	if err != nil {
+		return "", err
+	}
+	defer element.Release()
+
+	return client.Value(element)
+}
+
+// getUIASelectedText returns the text selected in the focused element
+func getUIASelectedText() (string, error) {
+	client, err := NewUIAutomationClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	element, err := client.FocusedElement()
+	if err != nil {
+		return "", err
+	}
+	defer element.Release()
+
+	return client.SelectedText(element)
+}
+
+// sysAllocString allocates a BSTR copy of s, to be freed with SysFreeString
+func sysAllocString(s string) uintptr {
+	ptr, err := syscall.UTF16PtrFromString(s)
+	if err != nil {
+		return 0
+	}
+	bstr, _, _ := procSysAllocString.Call(uintptr(unsafe.Pointer(ptr)))
+	return bstr
+}
+
+// bstrToString converts a BSTR to a Go string and frees it
+func bstrToString(bstr uintptr) string {
+	if bstr == 0 {
+		return ""
+	}
+	defer procSysFreeString.Call(bstr)
+
+	length, _, _ := procSysStringLen.Call(bstr)
+	if length == 0 {
+		return ""
+	}
+
+	// A BSTR points at its length UTF-16 units and is freed only by the
+	// deferred SysFreeString
+	return string(utf16.Decode(unsafe.Slice((*uint16)(unsafe.Pointer(bstr)), length)))
+}
@@ -0,0 +1,266 @@
+package recorder
+
+import (
+	"cmp"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Built-in updater for unattended installs. The release endpoint serves one
+// manifest per channel, <endpoint>/<channel>.json, naming the latest version
+// and where to download it. A newer binary is only accepted with a valid
+// Ed25519 signature from the release key over the channel, version and
+// binary digest, so an old release cannot be replayed as a new one. The
+// verified binary is staged next to the executable and swapped in the next
+// time the recorder starts, never under a running recording.
+
+// recorderVersion is the running version. Release builds set it with
+// -ldflags "-X ui_recorder/recorder.recorderVersion=1.2.3".
+var recorderVersion = "1.0.0"
+
+// updatePublicKey is the base64 Ed25519 key releases are signed with,
+// set at build time with -ldflags "-X ui_recorder/recorder.updatePublicKey=..."
+var updatePublicKey = ""
+
+const (
+	updateCheckInterval = 6 * time.Hour
+	updateTimeout       = 5 * time.Minute
+	maxUpdateSize       = 256 << 20
+	updateStagedSuffix  = ".update"
+	updateOldSuffix     = ".old"
+)
+
+// ReleaseManifest describes the latest release on a channel
+type ReleaseManifest struct {
+	Channel   string `json:"channel"`
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	Signature string `json:"signature"` // Base64 Ed25519 signature of releaseSigningMessage
+	Notes     string `json:"notes,omitempty"`
+}
+
+// Updater checks a release endpoint and stages verified updates of
+// Executable
+type Updater struct {
+	Endpoint   string
+	Channel    string
+	PublicKey  ed25519.PublicKey
+	Executable string
+	Client     *http.Client
+}
+
+// NewUpdater creates an updater from config, or returns nil when no update
+// endpoint is configured
+func NewUpdater(config WorkflowRecorderConfig) (*Updater, error) {
+	if config.UpdateEndpoint == "" {
+		return nil, nil
+	}
+
+	key := config.UpdatePublicKey
+	if key == "" {
+		key = updatePublicKey
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, NewWorkflowError(ErrorTypeConfiguration,
+			"Updates need the base64 Ed25519 public key releases are signed with", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, NewWorkflowError(ErrorTypeSystem, "Cannot locate the recorder executable", err)
+	}
+
+	return &Updater{
+		Endpoint:   strings.TrimSuffix(config.UpdateEndpoint, "/"),
+		Channel:    config.UpdateChannel,
+		PublicKey:  ed25519.PublicKey(publicKey),
+		Executable: executable,
+		Client:     &http.Client{Timeout: updateTimeout},
+	}, nil
+}
+
+// Check fetches the channel's manifest and reports whether it is newer than
+// the running version
+func (u *Updater) Check() (*ReleaseManifest, bool, error) {
+	resp, err := u.Client.Get(u.Endpoint + "/" + u.Channel + ".json")
+	if err != nil {
+		return nil, false, NewWorkflowError(ErrorTypeSystem, "Failed to reach the update endpoint", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, NewWorkflowError(ErrorTypeSystem,
+			fmt.Sprintf("Update endpoint returned %s", resp.Status), nil)
+	}
+
+	var manifest ReleaseManifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&manifest); err != nil {
+		return nil, false, NewWorkflowError(ErrorTypeSerialization, "Failed to parse the release manifest", err)
+	}
+	if manifest.Channel != u.Channel || manifest.Version == "" || manifest.URL == "" {
+		return nil, false, NewWorkflowError(ErrorTypeSerialization,
+			fmt.Sprintf("Release manifest is not for the %s channel or is incomplete", u.Channel), nil)
+	}
+
+	return &manifest, compareVersions(manifest.Version, recorderVersion) > 0, nil
+}
+
+// Stage downloads the release, verifies its signature and writes it next to
+// the executable, where applyStagedUpdate picks it up on the next start
+func (u *Updater) Stage(manifest *ReleaseManifest) error {
+	resp, err := u.Client.Get(manifest.URL)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSystem, "Failed to download the update", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return NewWorkflowError(ErrorTypeSystem, fmt.Sprintf("Update download returned %s", resp.Status), nil)
+	}
+	binary, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateSize+1))
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSystem, "Failed to download the update", err)
+	}
+	if len(binary) > maxUpdateSize {
+		return NewWorkflowError(ErrorTypeSystem, "Update is larger than the size limit", nil)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil || !ed25519.Verify(u.PublicKey, releaseSigningMessage(manifest.Channel, manifest.Version, binary), signature) {
+		return NewWorkflowError(ErrorTypeSystem,
+			fmt.Sprintf("Update %s has an invalid signature and was discarded", manifest.Version), err)
+	}
+
+	// Written under a temporary name so a partial file is never swapped in
+	staged := u.Executable + updateStagedSuffix
+	if err := os.WriteFile(staged+".part", binary, 0755); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write the update", err)
+	}
+	if err := os.Rename(staged+".part", staged); err != nil {
+		os.Remove(staged + ".part")
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to stage the update", err)
+	}
+	return nil
+}
+
+// CheckAndStage stages the channel's release if it is newer and returns its
+// version, or "" when the recorder is up to date
+func (u *Updater) CheckAndStage() (string, error) {
+	manifest, newer, err := u.Check()
+	if err != nil || !newer {
+		return "", err
+	}
+	if err := u.Stage(manifest); err != nil {
+		return "", err
+	}
+	return manifest.Version, nil
+}
+
+// runAutoUpdate checks for updates now and every updateCheckInterval
+func runAutoUpdate(updater *Updater) {
+	for {
+		if version, err := updater.CheckAndStage(); err != nil {
+			logger("updater").Warn("Update check failed", "error", err)
+		} else if version != "" {
+			logger("updater").Info("Update staged; it is installed the next time the recorder starts", "version", version)
+		}
+		time.Sleep(updateCheckInterval)
+	}
+}
+
+// releaseSigningMessage is what a release signature covers
+func releaseSigningMessage(channel, version string, binary []byte) []byte {
+	return []byte(fmt.Sprintf("claraverse-recorder\n%s\n%s\n%x", channel, version, sha256.Sum256(binary)))
+}
+
+// applyStagedUpdate replaces executable with a staged update, keeping the
+// running file under the .old suffix, which Windows allows. Returns whether
+// an update was installed.
+func applyStagedUpdate(executable string) (bool, error) {
+	staged, old := executable+updateStagedSuffix, executable+updateOldSuffix
+
+	// Left by the last update; still locked while that process runs
+	os.Remove(old)
+
+	if _, err := os.Stat(staged); err != nil {
+		return false, nil
+	}
+	if err := os.Rename(executable, old); err != nil {
+		return false, NewWorkflowError(ErrorTypeFileIO, "Failed to move the old recorder aside", err)
+	}
+	if err := os.Rename(staged, executable); err != nil {
+		os.Rename(old, executable)
+		return false, NewWorkflowError(ErrorTypeFileIO, "Failed to install the update", err)
+	}
+	return true, nil
+}
+
+// relaunch runs executable with this process's arguments and returns its
+// exit code. The child shares the console, so interrupts are left to it.
+func relaunch(executable string) int {
+	signal.Ignore(os.Interrupt, syscall.SIGTERM)
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		logger("updater").Error("Failed to start the updated recorder", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// compareVersions compares versions such as 1.4.0 and 1.5.0-beta.2,
+// returning -1, 0 or 1. A prerelease sorts before its release.
+func compareVersions(a, b string) int {
+	coreA, preA, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	coreB, preB, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+	if c := compareDotted(coreA, coreB); c != 0 {
+		return c
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareDotted(preA, preB)
+}
+
+// compareDotted compares dot-separated identifiers in turn, as numbers when
+// both are numeric. When one runs out first it sorts first.
+func compareDotted(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < min(len(partsA), len(partsB)); i++ {
+		numberA, errA := strconv.Atoi(partsA[i])
+		numberB, errB := strconv.Atoi(partsB[i])
+		if errA == nil && errB == nil {
+			if c := cmp.Compare(numberA, numberB); c != 0 {
+				return c
+			}
+		} else if c := strings.Compare(partsA[i], partsB[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(partsA), len(partsB))
+}
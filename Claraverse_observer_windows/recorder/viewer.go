@@ -0,0 +1,406 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Live viewer. The HTTP API serves a web page at /viewer that follows a
+// recording as it is made, or browses a saved one, as a timeline with its
+// screenshots, and saves trimmed copies. The page talks to the recorder over
+// a WebSocket at /viewer/ws, with the subprotocol viewerWebSocketProtocol,
+// using JSON messages told apart by "type":
+//
+//	recorder → page: hello, state, events, ended, trimmed, error
+//	page → recorder: subscribe {recording, after}, trim {recording, from_seq, to_seq}
+//
+// Screenshots are fetched separately from /recordings/{id}/screenshots/{seq}.
+// The page itself is served to anyone; it asks for the API token, and sends
+// it with every request and as a second subprotocol of the WebSocket.
+
+const (
+	viewerWebSocketProtocol = "claraverse-viewer"
+	viewerProtocolVersion   = 1
+	viewerPollInterval      = 500 * time.Millisecond
+)
+
+// ViewerEntry is one timeline entry of the viewer
+type ViewerEntry struct {
+	Seq         uint64 `json:"seq"`
+	OffsetMs    uint64 `json:"offset_ms"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Application string `json:"application,omitempty"`
+	Window      string `json:"window,omitempty"`
+	Priority    int    `json:"priority"`
+	Screenshot  bool   `json:"screenshot,omitempty"`
+}
+
+// ViewerMessage is a message between the viewer page and the recorder
+type ViewerMessage struct {
+	Type      string        `json:"type"`
+	Protocol  int           `json:"protocol,omitempty"`
+	Recording string        `json:"recording,omitempty"`
+	Name      string        `json:"name,omitempty"`
+	After     uint64        `json:"after,omitempty"`
+	Cursor    uint64        `json:"cursor,omitempty"`
+	Events    []ViewerEntry `json:"events,omitempty"`
+	FromSeq   uint64        `json:"from_seq,omitempty"`
+	ToSeq     uint64        `json:"to_seq,omitempty"`
+	Count     int           `json:"count,omitempty"`
+	State     RecorderState `json:"state,omitempty"`
+	File      string        `json:"file,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// viewerSession is one connected viewer page
+type viewerSession struct {
+	server    *HTTPAPIServer
+	ws        *WebSocketConn
+	recording string        // Recording followed, "" for none
+	cursor    uint64        // Last sequence number sent
+	startTime uint64        // Start time of the active recording followed
+	state     RecorderState // Recorder state last sent
+}
+
+// handleViewer serves the viewer page
+func (s *HTTPAPIServer) handleViewer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(viewerPage))
+}
+
+// handleViewerSocket runs the viewer protocol until the page disconnects
+func (s *HTTPAPIServer) handleViewerSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := UpgradeWebSocket(w, r, viewerWebSocketProtocol)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	session := &viewerSession{server: s, ws: ws}
+	if err := session.send(ViewerMessage{Type: "hello", Protocol: viewerProtocolVersion}); err != nil {
+		return
+	}
+
+	messages := make(chan ViewerMessage)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(messages)
+		for {
+			data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var message ViewerMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				message = ViewerMessage{Type: "invalid", Error: err.Error()}
+			}
+			select {
+			case messages <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(viewerPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			err = session.handle(message)
+		case <-ticker.C:
+			err = session.poll()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// send writes a message to the page
+func (v *viewerSession) send(message ViewerMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return v.ws.WriteText(data)
+}
+
+// sendError reports a failed request to the page
+func (v *viewerSession) sendError(message string) error {
+	return v.send(ViewerMessage{Type: "error", Error: message})
+}
+
+// handle answers a message from the page. Only failures to write to the page
+// are returned.
+func (v *viewerSession) handle(message ViewerMessage) error {
+	switch message.Type {
+	case "subscribe":
+		return v.subscribe(message.Recording, message.After)
+
+	case "trim":
+		// Rewrites files; the connection was let in with the API token
+		path, ok := v.server.recordingPath(message.Recording)
+		if !ok {
+			return v.sendError("Only saved recordings can be trimmed")
+		}
+		file, count, err := trimSavedRecording(path, message.FromSeq, message.ToSeq)
+		if err != nil {
+			return v.sendError(err.Error())
+		}
+		return v.send(ViewerMessage{
+			Type:      "trimmed",
+			Recording: strings.TrimSuffix(filepath.Base(file), ".json"),
+			File:      file,
+			Count:     count,
+		})
+
+	case "invalid":
+		return v.sendError("Invalid message: " + message.Error)
+
+	default:
+		return v.sendError(fmt.Sprintf("Unknown message type %q", message.Type))
+	}
+}
+
+// subscribe sends the events of a recording after a sequence number. The
+// active recording is then followed until it ends.
+func (v *viewerSession) subscribe(id string, after uint64) error {
+	v.recording, v.cursor = "", after
+
+	if id == activeRecordingID {
+		workflow := v.server.Controller.Active()
+		if workflow == nil {
+			return v.sendError("No recording in progress")
+		}
+		v.recording, v.startTime = id, workflow.StartTime
+		return v.poll()
+	}
+
+	path, ok := v.server.recordingPath(id)
+	if !ok {
+		return v.sendError("Invalid recording id")
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return v.sendError("Recording not found: " + id)
+	}
+	recording, err := LoadSavedRecording(path, v.server.Controller.Recorder.currentConfig().ScreenshotStore)
+	if err != nil {
+		return v.sendError(err.Error())
+	}
+
+	entries := []ViewerEntry{}
+	for _, entry := range viewerEntries(recording) {
+		if entry.Seq > after {
+			entries = append(entries, entry)
+			v.cursor = entry.Seq
+		}
+	}
+	return v.send(ViewerMessage{Type: "events", Recording: id, Name: recording.Name, Cursor: v.cursor, Events: entries})
+}
+
+// poll sends recorder state changes and the followed recording's new events
+func (v *viewerSession) poll() error {
+	if state := v.server.Controller.State.GetState(); state != v.state {
+		v.state = state
+		if err := v.send(ViewerMessage{Type: "state", State: state}); err != nil {
+			return err
+		}
+	}
+
+	if v.recording != activeRecordingID {
+		return nil
+	}
+	workflow := v.server.Controller.Active()
+	if workflow == nil || workflow.StartTime != v.startTime {
+		v.recording = ""
+		return v.send(ViewerMessage{Type: "ended", File: v.server.Controller.GetLastSavedFile()})
+	}
+
+	for {
+		page, hasMore := workflow.EventsAfter(v.cursor, maxEventPageSize)
+		if len(page) == 0 {
+			return nil
+		}
+		recording, err := savedRecordingFromEvents(workflow.Name, workflow.StartTime, 0, page)
+		if err != nil {
+			return v.sendError(err.Error())
+		}
+		metadata, _ := eventMetadata(page[len(page)-1])
+		v.cursor = metadata.Sequence
+
+		entries := viewerEntries(recording)
+		if entries == nil {
+			entries = []ViewerEntry{}
+		}
+		message := ViewerMessage{Type: "events", Recording: activeRecordingID, Name: workflow.Name, Cursor: v.cursor, Events: entries}
+		if err := v.send(message); err != nil || !hasMore {
+			return err
+		}
+	}
+}
+
+// viewerEntries lists a recording's described actions and screenshots
+func viewerEntries(recording *SavedRecording) []ViewerEntry {
+	quote := func(text string) string { return fmt.Sprintf("%q", text) }
+
+	var entries []ViewerEntry
+	for i, event := range recording.Events {
+		entry := ViewerEntry{
+			Seq:      savedEventSequence(event, i),
+			OffsetMs: recording.offset(event.Metadata.Timestamp),
+		}
+
+		if event.ImageBase64 != nil {
+			screenshot := RecordingScreenshot{OffsetMs: entry.OffsetMs, Trigger: event.Trigger}
+			if event.Vision != nil {
+				screenshot.Caption = event.Vision.Caption
+			}
+			entry.Kind, entry.Description, entry.Screenshot = "Screenshot", screenshotAltText(screenshot), true
+		} else if kind, description, priority, ok := describeSavedEvent(event, quote); ok {
+			entry.Kind, entry.Description, entry.Priority = kind, description, priority
+		} else {
+			continue
+		}
+
+		if element := event.Metadata.UIElement; element != nil {
+			entry.Application = element.ApplicationName
+			entry.Window = element.WindowTitle
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// savedEventSequence returns an event's sequence number. Recordings from
+// before sequence numbers count from 1 in order.
+func savedEventSequence(event savedEvent, index int) uint64 {
+	if event.Metadata.Sequence != 0 {
+		return event.Metadata.Sequence
+	}
+	return uint64(index + 1)
+}
+
+// handleRecordingScreenshot serves the image of a recording's screenshot
+// event
+func (s *HTTPAPIServer) handleRecordingScreenshot(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	seq, err := strconv.ParseUint(r.PathValue("seq"), 10, 64)
+	if err != nil || seq == 0 {
+		writeJSONError(w, http.StatusBadRequest, "seq must be a positive integer")
+		return
+	}
+
+	var recording *SavedRecording
+	if id == activeRecordingID {
+		workflow := s.Controller.Active()
+		if workflow == nil {
+			writeJSONError(w, http.StatusNotFound, "No recording in progress")
+			return
+		}
+		page, _ := workflow.EventsAfter(seq-1, 1)
+		recording, err = savedRecordingFromEvents(workflow.Name, workflow.StartTime, 0, page)
+	} else {
+		path, ok := s.recordingPath(id)
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "Invalid recording id")
+			return
+		}
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+			writeJSONError(w, http.StatusNotFound, "Recording not found: "+id)
+			return
+		}
+		recording, err = LoadSavedRecording(path, s.Controller.Recorder.currentConfig().ScreenshotStore)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i, event := range recording.Events {
+		if savedEventSequence(event, i) != seq || event.ImageBase64 == nil {
+			continue
+		}
+		image, err := base64.StdEncoding.DecodeString(*event.ImageBase64)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Screenshot is not valid base64")
+			return
+		}
+		format := event.ImageFormat
+		if format == "" {
+			format = "png"
+		}
+		w.Header().Set("Content-Type", "image/"+format)
+		w.Write(image)
+		return
+	}
+	writeJSONError(w, http.StatusNotFound, fmt.Sprintf("No screenshot with seq %d", seq))
+}
+
+// trimSavedRecording saves the events of a recording file with sequence
+// numbers from fromSeq to toSeq as <base>_trimmed.json, timed from the first
+// kept event. Segments and steps are left out, since they describe the whole
+// recording. Returns the file written and how many events it holds.
+func trimSavedRecording(filename string, fromSeq, toSeq uint64) (string, int, error) {
+	if toSeq < fromSeq {
+		return "", 0, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("Trim end %d is before its start %d", toSeq, fromSeq), nil)
+	}
+
+	var saved struct {
+		Name       string            `json:"name"`
+		Clock      *ClockSync        `json:"clock"`
+		Events     []json.RawMessage `json:"events"`
+		Redactions map[string]int    `json:"pii_redactions"`
+		Store      string            `json:"screenshot_store"`
+	}
+	if err := LoadRecordingFile(filename, &saved); err != nil {
+		return "", 0, err
+	}
+
+	trimmed := &RecordedWorkflow{
+		SchemaVersion:   SchemaVersion,
+		Name:            saved.Name + " (trimmed)",
+		Clock:           saved.Clock,
+		Events:          []WorkflowEvent{},
+		Redactions:      saved.Redactions,
+		ScreenshotStore: saved.Store,
+	}
+	for i, raw := range saved.Events {
+		var event savedEvent
+		json.Unmarshal(raw, &event)
+		if seq := savedEventSequence(event, i); seq < fromSeq || seq > toSeq {
+			continue
+		}
+		if len(trimmed.Events) == 0 {
+			trimmed.StartTime = event.Metadata.Timestamp
+		}
+		trimmed.EndTime = event.Metadata.Timestamp
+		trimmed.Events = append(trimmed.Events, raw)
+	}
+	if len(trimmed.Events) == 0 {
+		return "", 0, NewWorkflowError(ErrorTypeConfiguration,
+			fmt.Sprintf("No events between seq %d and %d", fromSeq, toSeq), nil)
+	}
+
+	file := strings.TrimSuffix(filename, filepath.Ext(filename)) + "_trimmed.json"
+	if err := SaveJSONToFile(trimmed, file); err != nil {
+		return "", 0, err
+	}
+	if err := referenceStoredScreenshots(trimmed, file); err != nil {
+		return "", 0, err
+	}
+	return file, len(trimmed.Events), nil
+}
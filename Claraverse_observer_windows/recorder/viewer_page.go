@@ -0,0 +1,252 @@
+package recorder
+
+// viewerPage is the live viewer, a single page with no external resources.
+// See viewer.go for the protocol it speaks.
+const viewerPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ClaraVerse Recorder Viewer</title>
+<style>
+body { font-family: sans-serif; margin: 0; color: #222; display: flex; flex-direction: column; height: 100vh; }
+header, .filters, .trim { display: flex; gap: 0.5em; align-items: center; padding: 0.5em 1em; border-bottom: 1px solid #ddd; flex-wrap: wrap; }
+header h1 { font-size: 1.1em; margin: 0 1em 0 0; }
+#status { color: #666; margin-left: auto; }
+main { display: flex; flex: 1; min-height: 0; }
+#timeline { flex: 1; overflow-y: auto; margin: 0; padding: 0; list-style: none; border-right: 1px solid #ddd; }
+#timeline li { padding: 0.3em 1em; cursor: pointer; border-bottom: 1px solid #f2f2f2; }
+#timeline li:hover { background: #f5f8ff; }
+#timeline li.selected { background: #dde8ff; }
+#timeline li.trimmed-out { opacity: 0.4; }
+#timeline li.screenshot { color: #555; font-style: italic; }
+.time { font-family: monospace; color: #666; margin-right: 0.5em; }
+.app { color: #666; }
+#panel { flex: 1; display: flex; flex-direction: column; align-items: center; justify-content: center; padding: 1em; }
+#panel img { max-width: 100%; max-height: 90%; border: 1px solid #ccc; }
+#caption { color: #666; font-size: 0.9em; margin-top: 0.5em; }
+</style>
+</head>
+<body>
+<header>
+<h1>ClaraVerse Recorder</h1>
+<label>Recording <select id="recording"></select></label>
+<button id="refresh">Refresh</button>
+<span id="status">Connecting…</span>
+</header>
+<div class="filters">
+<label>Kind <select id="kind"><option value="">All</option></select></label>
+<label>Application <select id="application"><option value="">All</option></select></label>
+<label>Search <input id="search" type="search"></label>
+<label><input id="important" type="checkbox"> Important steps only</label>
+</div>
+<div class="trim">
+<button id="trim-start">Start here</button>
+<button id="trim-end">End here</button>
+<span id="trim-range">Select a step, then mark where the trimmed copy starts and ends</span>
+<button id="trim-save" disabled>Save trimmed copy</button>
+</div>
+<main>
+<ol id="timeline"></ol>
+<div id="panel"><img id="image" alt="" hidden><div id="caption">No screenshot selected</div></div>
+</main>
+<script>
+"use strict";
+var entries = [], recording = "", selected = null, trimFrom = null, trimTo = null, socket = null;
+var $ = function (id) { return document.getElementById(id); };
+
+// The API token, from #token=... in the address or asked for once per tab
+function apiToken(ask) {
+  var match = /[#&]token=([^&]+)/.exec(location.hash);
+  if (match) {
+    sessionStorage.setItem("token", decodeURIComponent(match[1]));
+    history.replaceState(null, "", location.pathname);
+  }
+  var token = sessionStorage.getItem("token") || "";
+  if (!token && ask) {
+    token = (prompt("API token (--http-api-token, or the http_api_token file in %AppData%\\ClaraVerse)") || "").trim();
+    sessionStorage.setItem("token", token);
+  }
+  return token;
+}
+
+function api(path) {
+  return fetch(path, { headers: { Authorization: "Bearer " + apiToken(false) } }).then(function (r) {
+    if (r.status === 401) {
+      sessionStorage.removeItem("token");
+      throw new Error("Wrong API token");
+    }
+    return r;
+  });
+}
+
+function formatOffset(ms) {
+  var seconds = (ms % 60000) / 1000;
+  return Math.floor(ms / 60000) + ":" + (seconds < 10 ? "0" : "") + seconds.toFixed(1);
+}
+
+function setStatus(text) { $("status").textContent = text; }
+
+function loadRecordings(choose) {
+  api("/recordings").then(function (r) { return r.json(); }).then(function (data) {
+    var select = $("recording"), current = choose || select.value;
+    select.innerHTML = "";
+    (data.recordings || []).forEach(function (info) {
+      var option = document.createElement("option");
+      option.value = info.id;
+      option.textContent = info.active ? "● " + info.name + " (live)" : info.id;
+      select.appendChild(option);
+    });
+    if (current && Array.prototype.some.call(select.options, function (o) { return o.value === current; })) {
+      select.value = current;
+    }
+    if (select.value !== recording) { subscribe(select.value); }
+  }).catch(function (error) { setStatus(error.message); });
+}
+
+function subscribe(id) {
+  recording = id;
+  entries = [];
+  selected = trimFrom = trimTo = null;
+  updateTrim();
+  render();
+  if (id && socket && socket.readyState === WebSocket.OPEN) {
+    socket.send(JSON.stringify({ type: "subscribe", recording: id, after: 0 }));
+  }
+}
+
+function addOption(select, value) {
+  if (!value || Array.prototype.some.call(select.options, function (o) { return o.value === value; })) { return; }
+  var option = document.createElement("option");
+  option.value = option.textContent = value;
+  select.appendChild(option);
+}
+
+function visible(entry) {
+  var kind = $("kind").value, application = $("application").value;
+  var search = $("search").value.toLowerCase();
+  if (kind && entry.kind !== kind) { return false; }
+  if (application && entry.application !== application) { return false; }
+  if ($("important").checked && !entry.screenshot && entry.priority < 2) { return false; }
+  if (search && (entry.description + " " + (entry.window || "")).toLowerCase().indexOf(search) < 0) { return false; }
+  return true;
+}
+
+function render() {
+  var list = $("timeline"), follow = list.scrollTop + list.clientHeight >= list.scrollHeight - 4;
+  list.innerHTML = "";
+  entries.forEach(function (entry) {
+    if (!visible(entry)) { return; }
+    var item = document.createElement("li"), time = document.createElement("span"), app = document.createElement("span");
+    time.className = "time";
+    time.textContent = formatOffset(entry.offset_ms);
+    app.className = "app";
+    app.textContent = entry.application ? " — " + entry.application : "";
+    item.appendChild(time);
+    item.appendChild(document.createTextNode(entry.description));
+    item.appendChild(app);
+    if (entry.screenshot) { item.classList.add("screenshot"); }
+    if (selected === entry) { item.classList.add("selected"); }
+    if ((trimFrom !== null && entry.seq < trimFrom) || (trimTo !== null && entry.seq > trimTo)) { item.classList.add("trimmed-out"); }
+    item.onclick = function () { select(entry); };
+    list.appendChild(item);
+  });
+  if (follow) { list.scrollTop = list.scrollHeight; }
+}
+
+function select(entry) {
+  selected = entry;
+  // Show the entry's screenshot, or the latest one taken before it
+  var shot = null;
+  entries.forEach(function (e) { if (e.screenshot && e.seq <= entry.seq) { shot = e; } });
+  if (shot) {
+    // Fetched rather than linked, since an image link cannot carry the token
+    api("/recordings/" + encodeURIComponent(recording) + "/screenshots/" + shot.seq).then(function (r) {
+      return r.ok ? r.blob() : null;
+    }).then(function (blob) {
+      if (!blob || selected !== entry) { return; }
+      if ($("image").src) { URL.revokeObjectURL($("image").src); }
+      $("image").src = URL.createObjectURL(blob);
+    }).catch(function (error) { setStatus(error.message); });
+    $("image").hidden = false;
+    $("caption").textContent = formatOffset(shot.offset_ms) + " " + shot.description;
+  } else {
+    $("image").hidden = true;
+    $("caption").textContent = "No screenshot before this step";
+  }
+  render();
+}
+
+function updateTrim() {
+  var live = recording === "active";
+  $("trim-start").disabled = $("trim-end").disabled = live;
+  $("trim-save").disabled = live || trimFrom === null || trimTo === null || trimTo < trimFrom;
+  if (live) {
+    $("trim-range").textContent = "Live recordings can be trimmed once saved";
+  } else if (trimFrom !== null || trimTo !== null) {
+    $("trim-range").textContent = "Keeping steps " + (trimFrom === null ? "from the start" : "from #" + trimFrom) +
+      " " + (trimTo === null ? "to the end" : "to #" + trimTo);
+  }
+}
+
+function handle(message) {
+  switch (message.type) {
+  case "hello":
+    setStatus("Connected");
+    loadRecordings();
+    break;
+  case "state":
+    setStatus("Recorder " + message.state);
+    break;
+  case "events":
+    if (message.recording !== recording) { return; }
+    (message.events || []).forEach(function (entry) {
+      entries.push(entry);
+      addOption($("kind"), entry.kind);
+      addOption($("application"), entry.application);
+    });
+    render();
+    break;
+  case "ended":
+    setStatus(message.file ? "Recording saved to " + message.file : "Recording stopped");
+    loadRecordings(message.file ? message.file.replace(/^.*[\\/]/, "").replace(/\.json$/, "") : "");
+    break;
+  case "trimmed":
+    setStatus("Saved " + message.count + " events to " + message.file);
+    loadRecordings(message.recording);
+    break;
+  case "error":
+    setStatus(message.error);
+    break;
+  }
+}
+
+function connect() {
+  // Check the token first, since a refused WebSocket does not say why
+  apiToken(true);
+  api("/status").then(function () {
+    socket = new WebSocket("ws://" + location.host + "/viewer/ws", ["claraverse-viewer", "bearer." + apiToken(false)]);
+    socket.onmessage = function (event) { handle(JSON.parse(event.data)); };
+    socket.onclose = function () {
+      setStatus("Disconnected, reconnecting…");
+      recording = "";
+      setTimeout(connect, 2000);
+    };
+  }).catch(function (error) {
+    setStatus(error.message + ", retrying…");
+    setTimeout(connect, 2000);
+  });
+}
+
+$("recording").onchange = function () { subscribe(this.value); };
+$("refresh").onclick = function () { loadRecordings(); };
+["kind", "application", "search", "important"].forEach(function (id) { $(id).oninput = render; });
+$("trim-start").onclick = function () { if (selected) { trimFrom = selected.seq; if (trimTo === null && entries.length) { trimTo = entries[entries.length - 1].seq; } updateTrim(); render(); } };
+$("trim-end").onclick = function () { if (selected) { trimTo = selected.seq; if (trimFrom === null && entries.length) { trimFrom = entries[0].seq; } updateTrim(); render(); } };
+$("trim-save").onclick = function () {
+  socket.send(JSON.stringify({ type: "trim", recording: recording, from_seq: trimFrom, to_seq: trimTo }));
+};
+connect();
+</script>
+</body>
+</html>
+`
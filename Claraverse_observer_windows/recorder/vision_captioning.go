@@ -0,0 +1,300 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kbinani/screenshot"
+)
+
+// Optional captioning of screenshots by a vision model. Screenshots are sent
+// in the background to an OpenAI-compatible chat completions endpoint (a
+// local Ollama or LM Studio works) and the reply is attached to the recorded
+// ScreenshotEvent, so the capture loop never waits on the model.
+
+const (
+	defaultVisionEndpoint = "http://127.0.0.1:11434/v1/chat/completions"
+	visionMaxConcurrent   = 2
+	visionMaxTokens       = 300
+	// visionCropPadding is the context kept around the element, in screen pixels
+	visionCropPadding = 200
+)
+
+// VisionCaptioner sends recorded screenshots to the vision endpoint and
+// writes the captions back into the workflow
+type VisionCaptioner struct {
+	Endpoint       string
+	Model          string
+	APIKey         string
+	CropToElement  bool
+	JPEGQuality    int // Of crops of JPEG screenshots
+	Client         *http.Client
+	Slots          chan struct{}
+	Pending        sync.WaitGroup
+	CaptionedCount int64
+	FailedCount    int64
+	Mutex          sync.Mutex
+}
+
+// NewVisionCaptioner creates a captioner from config, or returns nil when no
+// vision endpoint is configured
+func NewVisionCaptioner(config WorkflowRecorderConfig) *VisionCaptioner {
+	if config.VisionEndpoint == "" {
+		return nil
+	}
+
+	return &VisionCaptioner{
+		Endpoint:      config.VisionEndpoint,
+		Model:         config.VisionModel,
+		APIKey:        config.VisionAPIKey,
+		CropToElement: config.VisionCropToElement,
+		JPEGQuality:   config.ScreenshotJPEGQuality,
+		Client:        &http.Client{Timeout: time.Duration(config.VisionTimeoutMs) * time.Millisecond},
+		Slots:         make(chan struct{}, visionMaxConcurrent),
+	}
+}
+
+// Submit captions shot in the background and stores the result on the
+// matching screenshot event of workflow
+func (vc *VisionCaptioner) Submit(workflow *RecordedWorkflow, shot ScreenshotEvent) {
+	vc.Pending.Add(1)
+	go func() {
+		defer vc.Pending.Done()
+
+		vc.Slots <- struct{}{}
+		caption := vc.Caption(shot)
+		<-vc.Slots
+
+		vc.Mutex.Lock()
+		if caption.Error != "" {
+			vc.FailedCount++
+		} else {
+			vc.CaptionedCount++
+		}
+		vc.Mutex.Unlock()
+
+		workflow.UpdateEvent(func(event WorkflowEvent) (WorkflowEvent, bool) {
+			recorded, ok := event.(ScreenshotEvent)
+			if !ok || recorded.CaptureID != shot.CaptureID {
+				return nil, false
+			}
+			recorded.Vision = caption
+			return recorded, true
+		})
+	}()
+}
+
+// Wait blocks until submitted screenshots are captioned or timeout passes.
+// Returns false on timeout.
+func (vc *VisionCaptioner) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		vc.Pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Caption asks the vision model to describe shot, cropped to the element
+// under the cursor when configured. Failures are reported in the caption's
+// Error field.
+func (vc *VisionCaptioner) Caption(shot ScreenshotEvent) *VisionCaption {
+	caption := &VisionCaption{Model: vc.Model}
+
+	imageBase64, format := shot.ImageBase64, shot.ImageFormat
+	if vc.CropToElement && shot.Metadata.UIElement != nil {
+		cropped, err := cropScreenshot(shot, shot.Metadata.UIElement.Bounds, screenshot.GetDisplayBounds(0), vc.JPEGQuality)
+		if err != nil {
+			logger("vision").Warn("Cropping screenshot failed, sending it whole", "error", err)
+		} else if cropped != "" {
+			imageBase64 = cropped
+			caption.Cropped = true
+		}
+	}
+
+	reply, err := vc.complete(visionPrompt(shot.Metadata.UIElement), imageBase64, format)
+	if err != nil {
+		caption.Error = err.Error()
+		return caption
+	}
+
+	caption.Caption, caption.Elements = parseVisionReply(reply)
+	return caption
+}
+
+// complete sends one chat completion request with the image attached and
+// returns the model's reply
+func (vc *VisionCaptioner) complete(prompt, imageBase64, format string) (string, error) {
+	request := map[string]interface{}{
+		"model":      vc.Model,
+		"max_tokens": visionMaxTokens,
+		"messages": []map[string]interface{}{{
+			"role": "user",
+			"content": []map[string]interface{}{
+				{"type": "text", "text": prompt},
+				{"type": "image_url", "image_url": map[string]string{
+					"url": fmt.Sprintf("data:image/%s;base64,%s", format, imageBase64),
+				}},
+			},
+		}},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, vc.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if vc.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+vc.APIKey)
+	}
+
+	resp, err := vc.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vision endpoint returned %s", resp.Status)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("vision endpoint returned no choices")
+	}
+
+	return completion.Choices[0].Message.Content, nil
+}
+
+// GetStatistics returns captioning counters
+func (vc *VisionCaptioner) GetStatistics() map[string]interface{} {
+	vc.Mutex.Lock()
+	defer vc.Mutex.Unlock()
+
+	return map[string]interface{}{
+		"endpoint":        vc.Endpoint,
+		"model":           vc.Model,
+		"captioned_count": vc.CaptionedCount,
+		"failed_count":    vc.FailedCount,
+	}
+}
+
+// UpdateEvent replaces the first event for which update returns true
+func (w *RecordedWorkflow) UpdateEvent(update func(WorkflowEvent) (WorkflowEvent, bool)) bool {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	for i, event := range w.Events {
+		if updated, ok := update(event); ok {
+			w.Events[i] = updated
+			return true
+		}
+	}
+	return false
+}
+
+// visionPrompt asks for a JSON description, giving the model the window the
+// screenshot was taken in
+func visionPrompt(element *UIElement) string {
+	prompt := "This screenshot was taken while recording a desktop workflow."
+	if element != nil && element.WindowTitle != "" {
+		prompt += fmt.Sprintf(" The active window is %q in %s.", element.WindowTitle, element.ApplicationName)
+	}
+	return prompt + ` Reply with JSON only, in the form {"caption": "one sentence on what is on screen and what the user appears to be doing", "elements": ["short description of each notable UI element"]}.`
+}
+
+// parseVisionReply reads the caption and elements from the model's reply,
+// using the whole reply as the caption when it isn't the requested JSON
+func parseVisionReply(reply string) (string, []string) {
+	text := strings.TrimSpace(reply)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+	text = strings.TrimSpace(text)
+
+	var parsed struct {
+		Caption  string   `json:"caption"`
+		Elements []string `json:"elements"`
+	}
+	if err := json.Unmarshal([]byte(text), &parsed); err == nil && parsed.Caption != "" {
+		return parsed.Caption, parsed.Elements
+	}
+
+	return strings.TrimSpace(reply), nil
+}
+
+// cropScreenshot cuts the region around bounds out of the screenshot and
+// returns it encoded in the screenshot's format, or "" when the element is
+// not on the image
+func cropScreenshot(shot ScreenshotEvent, bounds [4]float64, screen image.Rectangle, jpegQuality int) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(shot.ImageBase64)
+	if err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	rect, ok := visionCropRect(bounds, screen, img.Bounds().Size())
+	if !ok {
+		return "", nil
+	}
+
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return "", fmt.Errorf("cannot crop %T", img)
+	}
+
+	encoded, _, err := encodeScreenshotImage(sub.SubImage(rect.Add(img.Bounds().Min)), shot.ImageFormat, jpegQuality)
+	return encoded, err
+}
+
+// visionCropRect maps element bounds (x, y, width, height in screen
+// coordinates) onto a screenshot of the screen scaled to imageSize, padded
+// for context. Returns false when the region misses the image.
+func visionCropRect(bounds [4]float64, screen image.Rectangle, imageSize image.Point) (image.Rectangle, bool) {
+	if screen.Dx() <= 0 || screen.Dy() <= 0 {
+		return image.Rectangle{}, false
+	}
+
+	scaleX := float64(imageSize.X) / float64(screen.Dx())
+	scaleY := float64(imageSize.Y) / float64(screen.Dy())
+
+	left := (bounds[0] - float64(screen.Min.X) - visionCropPadding) * scaleX
+	top := (bounds[1] - float64(screen.Min.Y) - visionCropPadding) * scaleY
+	right := (bounds[0] + bounds[2] - float64(screen.Min.X) + visionCropPadding) * scaleX
+	bottom := (bounds[1] + bounds[3] - float64(screen.Min.Y) + visionCropPadding) * scaleY
+
+	rect := image.Rect(int(left), int(top), int(right), int(bottom)).
+		Intersect(image.Rect(0, 0, imageSize.X, imageSize.Y))
+	return rect, !rect.Empty()
+}
@@ -0,0 +1,172 @@
+package recorder
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Capture watchdog. With WatchdogTimeoutSeconds set, the capture loop beats
+// on every pass and tracker calls are timed. When the loop has not beaten
+// for that long, or a call into a tracker has not returned, the watchdog
+// logs every goroutine's stack, replaces the stuck trackers, starts a new
+// capture loop in place of a stuck one, and records a RecorderRecoveredEvent
+// so the gap shows in the recording. A stuck goroutine cannot be stopped;
+// the abandoned loop ends at its next pass if it ever gets there.
+
+const (
+	watchdogCaptureLoop = "capture_loop" // Component name of the capture loop
+	watchdogStackBytes  = 1 << 20        // Most goroutine stacks logged
+)
+
+// RecorderRecoveredEvent marks where the watchdog restarted a component
+// that had stopped making progress
+type RecorderRecoveredEvent struct {
+	RecorderRecovered string        `json:"recorder_recovered"` // capture_loop or a tracker name
+	StalledMs         uint64        `json:"stalled_ms"`         // How long it had made no progress
+	Restarts          int           `json:"restarts"`           // Restarts of any component so far
+	Metadata          EventMetadata `json:"metadata"`
+}
+
+// CaptureWatchdog restarts the capture loop and trackers when they hang
+type CaptureWatchdog struct {
+	Timeout    time.Duration
+	LastBeat   time.Time
+	Generation int // Capture loop currently running; earlier ones are abandoned
+	Restarts   int
+	Mutex      sync.Mutex
+}
+
+// NewCaptureWatchdog creates a watchdog for the configured timeout, or
+// returns nil when the watchdog is off
+func NewCaptureWatchdog(config WorkflowRecorderConfig) *CaptureWatchdog {
+	if config.WatchdogTimeoutSeconds <= 0 {
+		return nil
+	}
+	return &CaptureWatchdog{Timeout: time.Duration(config.WatchdogTimeoutSeconds) * time.Second}
+}
+
+// Beat records a pass of the capture loop of generation. It reports false
+// when that loop has been abandoned and should end.
+func (w *CaptureWatchdog) Beat(generation int) bool {
+	if w == nil {
+		return true
+	}
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	if generation != w.Generation {
+		return false
+	}
+	w.LastBeat = time.Now()
+	return true
+}
+
+// Supervise runs the capture loop, given its generation, until it returns,
+// running a new one whenever it stops beating. Stuck trackers are replaced
+// and each recovery is passed to recovered. Without a watchdog the loop
+// simply runs.
+func (w *CaptureWatchdog) Supervise(ctx context.Context, trackers *CaptureTrackers, loop func(generation int), recovered func(RecorderRecoveredEvent)) {
+	if w == nil {
+		loop(0)
+		return
+	}
+	for {
+		generation := w.nextGeneration()
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+			loop(generation)
+		}()
+		if !w.watch(ctx, exited, trackers, recovered) {
+			return
+		}
+	}
+}
+
+// nextGeneration abandons the capture loop running, if any, and returns
+// the generation of the next
+func (w *CaptureWatchdog) nextGeneration() int {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	w.Generation++
+	w.LastBeat = time.Now()
+	return w.Generation
+}
+
+// watch checks on the capture loop until it exits, returning true when it
+// has to be replaced
+func (w *CaptureWatchdog) watch(ctx context.Context, exited <-chan struct{}, trackers *CaptureTrackers, recovered func(RecorderRecoveredEvent)) bool {
+	ticker := time.NewTicker(w.Timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exited:
+			return false
+		case <-ctx.Done():
+			select {
+			case <-exited:
+			case <-time.After(w.Timeout):
+				logger("watchdog").Error("The capture loop did not stop in time; leaving it behind", "timeout", w.Timeout)
+			}
+			return false
+		case now := <-ticker.C:
+			if w.check(now, trackers, recovered) {
+				return true
+			}
+		}
+	}
+}
+
+// check restarts the trackers stuck as of now and reports whether the
+// capture loop is stuck too
+func (w *CaptureWatchdog) check(now time.Time, trackers *CaptureTrackers, recovered func(RecorderRecoveredEvent)) bool {
+	var stalled []string
+	if trackers != nil {
+		stalled = trackers.Health.Stalled(now, w.Timeout)
+	}
+	w.Mutex.Lock()
+	loopStalled := now.Sub(w.LastBeat)
+	w.Mutex.Unlock()
+	if len(stalled) == 0 && loopStalled <= w.Timeout {
+		return false
+	}
+
+	logWatchdogDiagnostics(stalled, loopStalled)
+	for _, name := range stalled {
+		trackers.Restart(name)
+		w.recover(name, w.Timeout, now, recovered)
+	}
+	if loopStalled <= w.Timeout {
+		return false
+	}
+	w.recover(watchdogCaptureLoop, loopStalled, now, recovered)
+	return true
+}
+
+// recover counts a restart of component and reports it
+func (w *CaptureWatchdog) recover(component string, stalled time.Duration, now time.Time, recovered func(RecorderRecoveredEvent)) {
+	w.Mutex.Lock()
+	w.Restarts++
+	restarts := w.Restarts
+	w.Mutex.Unlock()
+
+	printConsoleWarning(Msg(MsgRecorderRecovered, component, FormatDuration(stalled)))
+	recovered(RecorderRecoveredEvent{
+		RecorderRecovered: component,
+		StalledMs:         uint64(stalled.Milliseconds()),
+		Restarts:          restarts,
+		Metadata:          EventMetadata{Timestamp: uint64(now.UnixMilli())},
+	})
+}
+
+// logWatchdogDiagnostics logs what is stuck and where every goroutine is
+func logWatchdogDiagnostics(trackers []string, loopStalled time.Duration) {
+	logger("watchdog").Warn("Capture loop stalled", "last_progress", FormatDuration(loopStalled), "stuck_trackers", trackers)
+	stacks := make([]byte, watchdogStackBytes)
+	stacks = stacks[:runtime.Stack(stacks, true)]
+	logger("watchdog").Warn("Goroutines", "stacks", string(stacks))
+}
@@ -0,0 +1,321 @@
+package recorder
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal RFC 6455 WebSocket client and server, enough to talk to the Chrome
+// DevTools Protocol and to serve the live viewer without an external
+// dependency. Only unfragmented writes of text messages are supported;
+// fragmented and control frames are handled on read.
+
+const webSocketAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket frame opcodes
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// maxWebSocketMessage bounds a reassembled message. DevTools messages carrying
+// page state can be large, but never this large.
+const maxWebSocketMessage = 64 << 20
+
+// WebSocketConn is a WebSocket connection, dialed or accepted
+type WebSocketConn struct {
+	Conn       net.Conn
+	Reader     *bufio.Reader
+	Server     bool // Accepted connections send unmasked frames
+	WriteMutex sync.Mutex
+}
+
+// DialWebSocket opens a WebSocket connection to a ws:// URL, offering
+// protocols as its subprotocols
+func DialWebSocket(rawURL string, timeout time.Duration, protocols ...string) (*WebSocketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("unsupported WebSocket scheme %q", u.Scheme)
+	}
+
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+		Host: u.Host,
+	}
+	if len(protocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake failed: bad accept key")
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &WebSocketConn{Conn: conn, Reader: reader}, nil
+}
+
+// UpgradeWebSocket accepts a WebSocket handshake on an HTTP request. Pages
+// from other sites are refused, since any page the user visits could
+// otherwise connect to a loopback server. protocol is the subprotocol
+// accepted when the client offers it, "" for none.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request, protocol string) (*WebSocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, fmt.Errorf("not a WebSocket handshake")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "Cross-origin WebSocket refused", http.StatusForbidden)
+			return nil, fmt.Errorf("WebSocket origin %q refused", origin)
+		}
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket upgrade not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("connection cannot be hijacked")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n"
+	if offersWebSocketProtocol(r, protocol) {
+		// A browser drops a connection that does not pick one it offered
+		response += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	response += "\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &WebSocketConn{Conn: conn, Reader: buffered.Reader, Server: true}, nil
+}
+
+// offersWebSocketProtocol reports whether a handshake offers protocol
+func offersWebSocketProtocol(r *http.Request, protocol string) bool {
+	if protocol == "" {
+		return false
+	}
+	for _, protocols := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, offered := range strings.Split(protocols, ",") {
+			if strings.TrimSpace(offered) == protocol {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// webSocketAccept computes the Sec-WebSocket-Accept value for a key
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// WriteText sends a text message
+func (ws *WebSocketConn) WriteText(data []byte) error {
+	return ws.writeFrame(wsOpText, data)
+}
+
+// writeFrame sends a single frame, masked as clients must and unmasked as
+// servers must
+func (ws *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	ws.WriteMutex.Lock()
+	defer ws.WriteMutex.Unlock()
+
+	maskBit := byte(0x80)
+	if ws.Server {
+		maskBit = 0
+	}
+
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, maskBit|byte(length))
+	case length <= 0xFFFF:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if ws.Server {
+		_, err := ws.Conn.Write(append(header, payload...))
+		return err
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	header = append(header, mask...)
+
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+
+	if _, err := ws.Conn.Write(append(header, masked...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings on
+// the way. Returns io.EOF once the other end closes the connection.
+func (ws *WebSocketConn) ReadMessage() ([]byte, error) {
+	var message []byte
+
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			ws.writeFrame(wsOpClose, nil)
+			return nil, io.EOF
+		}
+
+		message = append(message, payload...)
+		if len(message) > maxWebSocketMessage {
+			return nil, fmt.Errorf("WebSocket message exceeds %d bytes", maxWebSocketMessage)
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads one frame and unmasks its payload
+func (ws *WebSocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(ws.Reader, head[:]); err != nil {
+		return
+	}
+
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(ws.Reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(ws.Reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxWebSocketMessage {
+		err = fmt.Errorf("WebSocket frame exceeds %d bytes", maxWebSocketMessage)
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(ws.Reader, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.Reader, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return
+}
+
+// Close sends a close frame and closes the connection
+func (ws *WebSocketConn) Close() error {
+	ws.writeFrame(wsOpClose, nil)
+	return ws.Conn.Close()
+}
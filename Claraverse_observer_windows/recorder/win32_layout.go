@@ -0,0 +1,71 @@
+package recorder
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// Win32 struct layouts. The structs handed to Windows mirror C layouts, some
+// of which change size with the pointer width, so the recorder builds for
+// windows/amd64, windows/arm64 and windows/386 and checks its layouts against
+// the Windows SDK sizes of the architecture it runs on. A mismatch would make
+// SendInput, GetMonitorInfo or a UI Automation call read garbage.
+
+// win32Layout is a size or offset with its Windows SDK value on 32- and
+// 64-bit Windows
+type win32Layout struct {
+	Name   string
+	Got    uintptr
+	Want32 uintptr
+	Want64 uintptr
+}
+
+func win32Layouts() []win32Layout {
+	return []win32Layout{
+		{"sizeof(POINT)", unsafe.Sizeof(POINT{}), 8, 8},
+		{"sizeof(RECT)", unsafe.Sizeof(RECT{}), 16, 16},
+		{"sizeof(MONITORINFO)", unsafe.Sizeof(MONITORINFO{}), 40, 40},
+		{"sizeof(BITMAPINFOHEADER)", unsafe.Sizeof(BITMAPINFOHEADER{}), 40, 40},
+		{"sizeof(MOUSEINPUT)", unsafe.Sizeof(MOUSEINPUT{}), 24, 32},
+		{"sizeof(KEYBDINPUT)", unsafe.Sizeof(KEYBDINPUT{}), 16, 24},
+		{"sizeof(INPUT) mouse", unsafe.Sizeof(mouseInput{}), 28, 40},
+		{"sizeof(INPUT) keyboard", unsafe.Sizeof(keyboardInput{}), 28, 40},
+		{"offsetof(INPUT, mi)", unsafe.Offsetof(mouseInput{}.Mi), 4, 8},
+		{"offsetof(INPUT, ki)", unsafe.Offsetof(keyboardInput{}.Ki), 4, 8},
+		{"sizeof(VARIANT)", unsafe.Sizeof(VARIANT{}), 16, 24},
+		{"offsetof(VARIANT, val)", unsafe.Offsetof(VARIANT{}.Val), 8, 8},
+	}
+}
+
+// win32LayoutMismatches returns the layouts that differ from the Windows SDK
+// on this architecture
+func win32LayoutMismatches() []string {
+	is64Bit := unsafe.Sizeof(uintptr(0)) == 8
+
+	var mismatches []string
+	for _, layout := range win32Layouts() {
+		want := layout.Want32
+		if is64Bit {
+			want = layout.Want64
+		}
+		if layout.Got != want {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %d, Windows expects %d", layout.Name, layout.Got, want))
+		}
+	}
+	return mismatches
+}
+
+// checkWin32Layout checks the Win32 struct layouts for this architecture
+func checkWin32Layout() SelfCheckResult {
+	result := SelfCheckResult{Name: Msg(MsgCheckLayout), Required: true}
+
+	if mismatches := win32LayoutMismatches(); len(mismatches) > 0 {
+		result.Detail = fmt.Sprintf("%s: %v", runtime.GOARCH, mismatches)
+		return result
+	}
+
+	result.Passed = true
+	result.Detail = runtime.GOARCH
+	return result
+}
@@ -0,0 +1,87 @@
+package recorder
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// WinEvent hooks. The window geometry, menu, dialog and focus watchers each
+// hear about other applications through SetWinEventHook, whose events are
+// only delivered to the thread that set the hook while it pumps messages.
+// winEventHook runs that thread: it sets the hooks, runs the message loop
+// until Close, and removes them again as it ends.
+
+var (
+	procSetWinEventHook    = user32.NewProc("SetWinEventHook")
+	procUnhookWinEvent     = user32.NewProc("UnhookWinEvent")
+	procPostThreadMessage  = user32.NewProc("PostThreadMessageW")
+	procGetCurrentThreadId = kernel32.NewProc("GetCurrentThreadId")
+)
+
+const (
+	WINEVENT_OUTOFCONTEXT   = 0x0000
+	WINEVENT_SKIPOWNPROCESS = 0x0002
+	WM_QUIT                 = 0x0012
+)
+
+// winEventRange is a range of events, first to last, for one hook
+type winEventRange struct {
+	Min, Max uintptr
+}
+
+// winEventHook is the thread of a watcher's hooks
+type winEventHook struct {
+	threadID uintptr
+	Mutex    sync.Mutex
+}
+
+// start sets a hook delivering each range of events to callback, on a thread
+// of its own, and returns once they are set. onThread is called on the
+// thread before the hooks are set, and onExit, if not nil, as it ends.
+func (h *winEventHook) start(callback uintptr, ranges []winEventRange, onThread, onExit func()) error {
+	ready := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		onThread()
+		flags := uintptr(WINEVENT_OUTOFCONTEXT | WINEVENT_SKIPOWNPROCESS)
+		for _, events := range ranges {
+			hook, _, err := procSetWinEventHook.Call(events.Min, events.Max, 0, callback, 0, 0, flags)
+			if hook == 0 {
+				ready <- err
+				return
+			}
+			defer procUnhookWinEvent.Call(hook)
+		}
+		if onExit != nil {
+			defer onExit()
+		}
+
+		h.Mutex.Lock()
+		h.threadID, _, _ = procGetCurrentThreadId.Call()
+		h.Mutex.Unlock()
+		ready <- nil
+
+		var msg MSG
+		for {
+			if ret, _, _ := procGetMessage.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0); ret == 0 || int32(ret) == -1 {
+				return
+			}
+			procTranslateMessage.Call(uintptr(unsafe.Pointer(&msg)))
+			procDispatchMessage.Call(uintptr(unsafe.Pointer(&msg)))
+		}
+	}()
+	return <-ready
+}
+
+// Close removes the hooks and ends their thread
+func (h *winEventHook) Close() {
+	h.Mutex.Lock()
+	threadID := h.threadID
+	h.Mutex.Unlock()
+	if threadID != 0 {
+		procPostThreadMessage.Call(threadID, WM_QUIT, 0, 0)
+	}
+}
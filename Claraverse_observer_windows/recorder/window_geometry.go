@@ -0,0 +1,299 @@
+package recorder
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Window geometry. With RecordWindowGeometry set, a WinEvent hook on a
+// thread of its own follows every visible top-level window as it is moved,
+// resized, minimized, maximized or restored, and a WindowGeometryEvent with
+// its rectangle before and after is recorded, so the recording shows how the
+// layout changed between actions. A drag produces a stream of location
+// changes; they are coalesced into one event once the window has kept still
+// for windowGeometrySettle or the drag ends.
+
+var (
+	procIsIconic            = user32.NewProc("IsIconic")
+	procIsZoomed            = user32.NewProc("IsZoomed")
+	procGetAncestor         = user32.NewProc("GetAncestor")
+	procGetWindowTextLength = user32.NewProc("GetWindowTextLengthW")
+	windowGeometryCallback  uintptr
+	windowGeometryCallbacks sync.Once
+	activeWindowGeometry    *WindowGeometryWatcher // Receives the hook's events
+)
+
+const (
+	EVENT_SYSTEM_MOVESIZEEND     = 0x000B
+	EVENT_SYSTEM_MINIMIZEEND     = 0x0017
+	EVENT_OBJECT_LOCATIONCHANGE  = 0x800B
+	OBJID_WINDOW                 = 0
+	GA_ROOT                      = 2
+	windowGeometrySettle         = 300 * time.Millisecond
+	windowGeometryMinimizedLimit = -30000 // Windows parks minimized windows at -32000
+)
+
+// Window changes
+const (
+	WindowMoved     = "moved"
+	WindowResized   = "resized"
+	WindowMinimized = "minimized"
+	WindowMaximized = "maximized"
+	WindowRestored  = "restored"
+)
+
+// Window show states
+const (
+	windowNormal    = "normal"
+	windowMinimized = "minimized"
+	windowMaximized = "maximized"
+)
+
+// WindowGeometryEvent records a window moving, resizing, or being minimized,
+// maximized or restored
+type WindowGeometryEvent struct {
+	WindowChange string        `json:"window_change"` // moved, resized, minimized, maximized or restored
+	WindowTitle  string        `json:"window_title"`
+	Application  string        `json:"application"`
+	Before       *[4]int32     `json:"before,omitempty"` // x, y, width and height; absent when not known
+	After        *[4]int32     `json:"after,omitempty"`  // Absent when minimized
+	Metadata     EventMetadata `json:"metadata"`
+}
+
+// windowGeometry is a window's rectangle, as x, y, width and height, and
+// show state
+type windowGeometry struct {
+	Rect  [4]int32
+	State string
+}
+
+// pendingWindowChange is a window's change not yet recorded
+type pendingWindowChange struct {
+	Before     windowGeometry
+	After      windowGeometry
+	LastChange time.Time
+	Settled    bool // The drag ended, so it can be recorded at once
+}
+
+// WindowGeometryWatcher follows the geometry of the top-level windows
+type WindowGeometryWatcher struct {
+	Windows  map[uintptr]windowGeometry // Last recorded geometry of each window
+	Pending  map[uintptr]*pendingWindowChange
+	Describe func(hwnd uintptr) (title, application string)
+	hook     winEventHook
+	Mutex    sync.Mutex
+}
+
+// NewWindowGeometryWatcher creates a watcher of the windows open now and
+// starts its hook, or returns nil when RecordWindowGeometry is off or the
+// hook cannot be set
+func NewWindowGeometryWatcher(config WorkflowRecorderConfig) *WindowGeometryWatcher {
+	if !config.RecordWindowGeometry {
+		return nil
+	}
+	watcher := newWindowGeometryWatcher()
+	for _, window := range topLevelWindows() {
+		if geometry, ok := readWindowGeometry(window.Handle); ok {
+			watcher.Windows[window.Handle] = geometry
+		}
+	}
+	if err := watcher.start(); err != nil {
+		printConsoleWarning(Msg(MsgWindowGeometryUnavailable, err))
+		return nil
+	}
+	return watcher
+}
+
+// newWindowGeometryWatcher creates a watcher that knows no windows yet
+func newWindowGeometryWatcher() *WindowGeometryWatcher {
+	return &WindowGeometryWatcher{
+		Windows:  make(map[uintptr]windowGeometry),
+		Pending:  make(map[uintptr]*pendingWindowChange),
+		Describe: describeWindow,
+	}
+}
+
+// Observe notes a window's geometry as of now. ended is set when a move or
+// resize has finished.
+func (w *WindowGeometryWatcher) Observe(hwnd uintptr, geometry windowGeometry, ended bool, now time.Time) {
+	w.Mutex.Lock()
+	defer w.Mutex.Unlock()
+
+	pending := w.Pending[hwnd]
+	if pending == nil {
+		previous, known := w.Windows[hwnd]
+		if !known {
+			// A window opening; geometry is recorded from its first change
+			w.Windows[hwnd] = geometry
+			return
+		}
+		if previous == geometry {
+			return
+		}
+		pending = &pendingWindowChange{Before: previous}
+		w.Pending[hwnd] = pending
+	}
+	pending.After, pending.LastChange = geometry, now
+	pending.Settled = ended || geometry.State != pending.Before.State
+}
+
+// Drain returns the changes of windows that have kept still since, or
+// whose move or resize has ended
+func (w *WindowGeometryWatcher) Drain(now time.Time) []WorkflowEvent {
+	if w == nil {
+		return nil
+	}
+	w.Mutex.Lock()
+	var ready []uintptr
+	changes := make(map[uintptr]pendingWindowChange)
+	for hwnd, pending := range w.Pending {
+		if !pending.Settled && now.Sub(pending.LastChange) < windowGeometrySettle {
+			continue
+		}
+		delete(w.Pending, hwnd)
+		w.Windows[hwnd] = pending.After
+		if pending.After != pending.Before {
+			ready = append(ready, hwnd)
+			changes[hwnd] = *pending
+		}
+	}
+	w.Mutex.Unlock()
+	sort.Slice(ready, func(i, j int) bool { return changes[ready[i]].LastChange.Before(changes[ready[j]].LastChange) })
+
+	var events []WorkflowEvent
+	for _, hwnd := range ready {
+		change := changes[hwnd]
+		title, application := w.Describe(hwnd)
+		event := WindowGeometryEvent{
+			WindowChange: windowChange(change.Before, change.After),
+			WindowTitle:  title,
+			Application:  application,
+			Metadata:     EventMetadata{Timestamp: uint64(change.LastChange.UnixMilli())},
+		}
+		if change.Before.State != windowMinimized {
+			before := change.Before.Rect
+			event.Before = &before
+		}
+		if change.After.State != windowMinimized {
+			after := change.After.Rect
+			event.After = &after
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// windowChange names how a window's geometry changed
+func windowChange(before, after windowGeometry) string {
+	switch {
+	case after.State == windowMinimized:
+		return WindowMinimized
+	case after.State == windowMaximized && before.State != windowMaximized:
+		return WindowMaximized
+	case after.State != before.State:
+		return WindowRestored
+	case after.Rect[2] != before.Rect[2] || after.Rect[3] != before.Rect[3]:
+		return WindowResized
+	default:
+		return WindowMoved
+	}
+}
+
+// describeWindowChange describes a window's change in a recording's steps
+func describeWindowChange(change, title string, after *[4]int32, quote func(string) string) string {
+	verb := map[string]string{
+		WindowMoved:     "Moved",
+		WindowResized:   "Resized",
+		WindowMinimized: "Minimized",
+		WindowMaximized: "Maximized",
+		WindowRestored:  "Restored",
+	}[change]
+	if verb == "" {
+		verb = "Changed"
+	}
+	description := verb + " window " + quote(title)
+	switch {
+	case after == nil:
+	case change == WindowMoved:
+		description += fmt.Sprintf(" to (%d, %d)", after[0], after[1])
+	case change == WindowResized:
+		description += fmt.Sprintf(" to %dx%d", after[2], after[3])
+	}
+	return description
+}
+
+// readWindowGeometry reads a top-level window's rectangle and show state.
+// ok is false for windows that are hidden, untitled, such as menus and
+// tooltips, or not top-level.
+func readWindowGeometry(hwnd uintptr) (windowGeometry, bool) {
+	if root, _, _ := procGetAncestor.Call(hwnd, GA_ROOT); root != hwnd {
+		return windowGeometry{}, false
+	}
+	if visible, _, _ := procIsWindowVisible.Call(hwnd); visible == 0 {
+		return windowGeometry{}, false
+	}
+	if length, _, _ := procGetWindowTextLength.Call(hwnd); length == 0 {
+		return windowGeometry{}, false
+	}
+	var rect RECT
+	if ret, _, _ := procGetWindowRect.Call(hwnd, uintptr(unsafe.Pointer(&rect))); ret == 0 {
+		return windowGeometry{}, false
+	}
+	geometry := windowGeometry{
+		Rect:  [4]int32{rect.Left, rect.Top, rect.Right - rect.Left, rect.Bottom - rect.Top},
+		State: windowNormal,
+	}
+	if iconic, _, _ := procIsIconic.Call(hwnd); iconic != 0 || rect.Left <= windowGeometryMinimizedLimit {
+		geometry.State = windowMinimized
+	} else if zoomed, _, _ := procIsZoomed.Call(hwnd); zoomed != 0 {
+		geometry.State = windowMaximized
+	}
+	return geometry, true
+}
+
+// describeWindow returns a window's title and application
+func describeWindow(hwnd uintptr) (string, string) {
+	textBuf := make([]uint16, 256)
+	procGetWindowText.Call(hwnd, uintptr(unsafe.Pointer(&textBuf[0])), 256)
+	title := syscall.UTF16ToString(textBuf)
+	var processID uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&processID)))
+	return title, applicationName(processID, title)
+}
+
+// start runs the hook on a thread of its own, whose message loop delivers
+// its events, and returns once it is set
+func (w *WindowGeometryWatcher) start() error {
+	windowGeometryCallbacks.Do(func() {
+		windowGeometryCallback = syscall.NewCallback(windowGeometryEventProc)
+	})
+	ranges := []winEventRange{
+		{EVENT_SYSTEM_MOVESIZEEND, EVENT_SYSTEM_MINIMIZEEND},
+		{EVENT_OBJECT_LOCATIONCHANGE, EVENT_OBJECT_LOCATIONCHANGE},
+	}
+	return w.hook.start(windowGeometryCallback, ranges, func() { activeWindowGeometry = w }, nil)
+}
+
+// Close removes the hook and ends its thread
+func (w *WindowGeometryWatcher) Close() {
+	if w == nil {
+		return
+	}
+	w.hook.Close()
+}
+
+// windowGeometryEventProc receives the hook's events on its thread
+func windowGeometryEventProc(hook, event, hwnd, idObject, idChild, thread, eventTime uintptr) uintptr {
+	w := activeWindowGeometry
+	if w == nil || hwnd == 0 || int32(idObject) != OBJID_WINDOW || idChild != 0 {
+		return 0
+	}
+	if geometry, ok := readWindowGeometry(hwnd); ok {
+		w.Observe(hwnd, geometry, event == EVENT_SYSTEM_MOVESIZEEND, time.Now())
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package recorder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Window titles. With RecordWindowTitles set, the capture loop follows the
+// title of the window in front, and a WindowTitleChangedEvent with the
+// title before and after is recorded when it changes while that window stays
+// in front: another document opened in the same window, an asterisk for
+// unsaved changes appearing or going, a page loaded in an application that
+// is not a browser. A title must hold for windowTitleSettle before it is
+// recorded, so the titles a window passes through while loading, or a
+// progress count ticking over, are not each recorded; a window coming to
+// the front is an application switch, not a title change, and a window
+// that came to the front without a title is not renamed by getting one.
+
+// windowTitleSettle is how long a new title must hold to be recorded
+const windowTitleSettle = 500 * time.Millisecond
+
+// WindowTitleChangedEvent records the title of the window in front changing
+type WindowTitleChangedEvent struct {
+	WindowTitle   string        `json:"window_title"`   // The title after
+	PreviousTitle string        `json:"previous_title"` // The title before
+	Application   string        `json:"application"`
+	Metadata      EventMetadata `json:"metadata"`
+}
+
+// WindowTitleTracker follows the title of the window in front
+type WindowTitleTracker struct {
+	Window       uintptr // The window in front
+	Title        string  // Its title as last recorded
+	Pending      string  // A new title, not yet held for windowTitleSettle
+	PendingSince time.Time
+	Mutex        sync.Mutex
+}
+
+// NewWindowTitleTracker creates a tracker, or returns nil when
+// RecordWindowTitles is off
+func NewWindowTitleTracker(config WorkflowRecorderConfig) *WindowTitleTracker {
+	if !config.RecordWindowTitles {
+		return nil
+	}
+	return &WindowTitleTracker{}
+}
+
+// Update takes the window in front and element, which carries its title,
+// and returns an event when a new title of the same window has held for
+// windowTitleSettle
+func (wt *WindowTitleTracker) Update(hwnd uintptr, element *UIElement, now time.Time) *WindowTitleChangedEvent {
+	if wt == nil {
+		return nil
+	}
+	wt.Mutex.Lock()
+	defer wt.Mutex.Unlock()
+
+	title := element.WindowTitle
+	switch {
+	case hwnd != wt.Window:
+		wt.Window, wt.Title, wt.Pending = hwnd, title, ""
+		return nil
+	case title == "" || title == wt.Title:
+		// A window briefly without a title has not been renamed
+		wt.Pending = ""
+		return nil
+	case wt.Title == "":
+		// A window that came to the front without a title has not been
+		// renamed when it gets one; that is the title it starts with
+		wt.Title = title
+		return nil
+	case title != wt.Pending:
+		wt.Pending, wt.PendingSince = title, now
+		return nil
+	case now.Sub(wt.PendingSince) < windowTitleSettle:
+		return nil
+	}
+
+	focused := *element
+	event := &WindowTitleChangedEvent{
+		WindowTitle:   title,
+		PreviousTitle: wt.Title,
+		Application:   element.ApplicationName,
+		Metadata:      EventMetadata{UIElement: &focused, Timestamp: uint64(now.UnixMilli())},
+	}
+	wt.Title, wt.Pending = title, ""
+	return event
+}
+
+// HandleWindowTitle follows the title of the window in front
+func (ct *CaptureTrackers) HandleWindowTitle(element *UIElement) {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if event := ct.Titles.Update(hwnd, element, time.Now()); event != nil {
+		ct.enqueue(*event)
+	}
+}
+
+// describeWindowTitleChange describes a window's title changing in a
+// recording's steps
+func describeWindowTitleChange(before, after, application string, quote func(string) string) string {
+	description := fmt.Sprintf("Window %s became %s", quote(before), quote(after))
+	if application != "" {
+		description += " in " + application
+	}
+	return description
+}
@@ -0,0 +1,711 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"ui_recorder/storage"
+)
+
+// WorkflowRecorderError represents errors from the workflow recorder
+type WorkflowRecorderError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Cause   error  `json:"cause,omitempty"`
+}
+
+func (e *WorkflowRecorderError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s (caused by: %v)", e.Type, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// NewWorkflowError creates a new workflow error
+func NewWorkflowError(errorType, message string, cause error) *WorkflowRecorderError {
+	return &WorkflowRecorderError{
+		Type:    errorType,
+		Message: message,
+		Cause:   cause,
+	}
+}
+
+// Common error types
+const (
+	ErrorTypeConfiguration  = "Configuration"
+	ErrorTypeInitialization = "Initialization"
+	ErrorTypeRecording      = "Recording"
+	ErrorTypeSerialization  = "Serialization"
+	ErrorTypeFileIO         = "FileIO"
+	ErrorTypeSystem         = "System"
+)
+
+// Enhanced utility functions for workflow management
+
+// IsEmptyString checks if a string is empty or contains only null-like values
+func IsEmptyString(s *string) bool {
+	if s == nil {
+		return true
+	}
+
+	// Fast path for completely empty strings
+	if *s == "" {
+		return true
+	}
+
+	// Fast path for whitespace-only strings
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return true
+	}
+
+	// Check against common null-like values (case-insensitive)
+	if len(trimmed) <= 20 { // Reasonable max length for null-like values
+		lower := strings.ToLower(trimmed)
+		nullValues := []string{
+			"null", "nil", "undefined", "(null)", "<null>",
+			"n/a", "na", "unknown", "<unknown>", "(unknown)",
+			"none", "<none>", "(none)", "empty", "<empty>", "(empty)",
+			"bstr()", "variant()", "variant(empty)",
+		}
+
+		for _, nullVal := range nullValues {
+			if lower == nullVal {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// FilterEmptyString returns nil if the string is empty or null-like
+func FilterEmptyString(s string) *string {
+	if IsEmptyString(&s) {
+		return nil
+	}
+	return &s
+}
+
+// TruncateString truncates a string to a maximum length
+func TruncateString(s string, maxLen int, suffix string) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen-len(suffix)] + suffix
+}
+
+// SafeStringPtr safely converts a string to a pointer, returning nil for empty strings
+func SafeStringPtr(s string) *string {
+	return FilterEmptyString(s)
+}
+
+// SafeUint32Ptr returns nil for zero values
+func SafeUint32Ptr(n uint32) *uint32 {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// SafeUint64Ptr returns nil for zero values
+func SafeUint64Ptr(n uint64) *uint64 {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// Timing utilities
+
+// GetCurrentTimestamp returns the current timestamp in milliseconds since epoch
+func GetCurrentTimestamp() uint64 {
+	return uint64(time.Now().UnixNano() / int64(time.Millisecond))
+}
+
+// FormatDuration formats a duration in a human-readable way
+func FormatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	} else if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	} else if d < time.Hour {
+		return fmt.Sprintf("%.1fm", d.Minutes())
+	}
+	return fmt.Sprintf("%.1fh", d.Hours())
+}
+
+// FormatBytes formats a size in bytes in human-readable form
+func FormatBytes(bytes int64) string {
+	if bytes < 1<<10 {
+		return fmt.Sprintf("%d B", bytes)
+	} else if bytes < 1<<20 {
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	} else if bytes < 1<<30 {
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	}
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+}
+
+// File and path utilities
+
+// EnsureDirectoryExists creates a directory if it doesn't exist
+func EnsureDirectoryExists(path string) error {
+	return storage.EnsureDir(path)
+}
+
+// GenerateWorkflowFilename generates a timestamped filename for workflow files
+func GenerateWorkflowFilename(name string, format string) string {
+	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	safeName := regexp.MustCompile(`[^\w\-_\s]`).ReplaceAllString(name, "_")
+	safeName = strings.ReplaceAll(safeName, " ", "_")
+	return fmt.Sprintf("%s_%s.%s", safeName, timestamp, format)
+}
+
+// GetFileSize returns the size of a file in bytes
+func GetFileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// JSON utilities
+
+// PrettyPrintJSON formats JSON with indentation
+func PrettyPrintJSON(v interface{}) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SaveJSONToFile saves a struct as JSON to a file
+func SaveJSONToFile(v interface{}, filename string) error {
+	if err := storage.SaveJSON(filename, v); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to write file", err)
+	}
+	return nil
+}
+
+// LoadJSONFromFile loads JSON from a file into a struct
+func LoadJSONFromFile(filename string, v interface{}) error {
+	if err := storage.LoadJSON(filename, v); err != nil {
+		return NewWorkflowError(ErrorTypeFileIO, "Failed to read file", err)
+	}
+	return nil
+}
+
+// LoadRecordingFile loads a saved recording, or a chunk of one, into v,
+// upgrading it to the current schema version first
+func LoadRecordingFile(filename string, v interface{}) error {
+	version, err := storage.LoadRecording(filename, v)
+	if err != nil {
+		return NewWorkflowError(ErrorTypeSerialization, "Failed to load recording", err)
+	}
+	if version > SchemaVersion {
+		logger("recording").Warn("Recording is from a newer recorder; what it added is ignored",
+			"file", filename, "schema_version", version, "supported", SchemaVersion)
+	}
+	return nil
+}
+
+// String processing utilities
+
+// SanitizeFilename removes or replaces invalid characters for filenames
+func SanitizeFilename(filename string) string {
+	// Replace invalid characters with underscores
+	re := regexp.MustCompile(`[<>:"/\\|?*]`)
+	sanitized := re.ReplaceAllString(filename, "_")
+
+	// Trim spaces and dots from the end
+	sanitized = strings.TrimRight(sanitized, " .")
+
+	// Ensure it's not empty
+	if sanitized == "" {
+		sanitized = "unnamed"
+	}
+
+	return sanitized
+}
+
+// ExtractNumbers extracts all numbers from a string
+func ExtractNumbers(s string) []int {
+	re := regexp.MustCompile(`\d+`)
+	matches := re.FindAllString(s, -1)
+
+	var numbers []int
+	for _, match := range matches {
+		if num, err := strconv.Atoi(match); err == nil {
+			numbers = append(numbers, num)
+		}
+	}
+
+	return numbers
+}
+
+// ContainsAnyIgnoreCase checks if a string contains any of the provided substrings (case-insensitive)
+func ContainsAnyIgnoreCase(s string, substrings []string) bool {
+	sLower := strings.ToLower(s)
+	for _, substr := range substrings {
+		if strings.Contains(sLower, strings.ToLower(substr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// System information utilities
+
+// GetProcessNameFromPID returns the executable name (e.g. chrome.exe) of the
+// process with the given PID, or "" when it cannot be opened
+func GetProcessNameFromPID(pid uint32) string {
+	if path := processImagePath(pid); path != "" {
+		return filepath.Base(path)
+	}
+	return ""
+}
+
+// processImagePath returns the full path of a process's executable, or ""
+// when the process cannot be opened
+func processImagePath(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+
+	handle, _, _ := procOpenProcess.Call(PROCESS_QUERY_LIMITED_INFORMATION, 0, uintptr(pid))
+	if handle == 0 {
+		return ""
+	}
+	defer procCloseHandle.Call(handle)
+
+	buf := make([]uint16, 1024)
+	size := uint32(len(buf))
+	ret, _, _ := procQueryFullProcessImageName.Call(handle, 0,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if ret == 0 {
+		return ""
+	}
+
+	return syscall.UTF16ToString(buf[:size])
+}
+
+// IsValidURL checks if a string is a valid URL
+func IsValidURL(s string) bool {
+	urlPattern := regexp.MustCompile(`^https?://[^\s/$.?#].[^\s]*$`)
+	return urlPattern.MatchString(s)
+}
+
+// ExtractDomainFromURL extracts the domain from a URL
+func ExtractDomainFromURL(url string) string {
+	re := regexp.MustCompile(`^https?://([^/]+)`)
+	matches := re.FindStringSubmatch(url)
+	if len(matches) >= 2 {
+		return matches[1]
+	}
+	return ""
+}
+
+// Performance utilities
+
+// MeasureExecutionTime measures the execution time of a function
+func MeasureExecutionTime(name string, fn func()) time.Duration {
+	start := time.Now()
+	fn()
+	duration := time.Since(start)
+	return duration
+}
+
+// Rate limiting utilities
+
+// Rate limit categories
+const (
+	RateCategoryMouseMove  = "mouse_move"
+	RateCategoryMouse      = "mouse"
+	RateCategoryKeyboard   = "keyboard"
+	RateCategoryScreenshot = "screenshot"
+	RateCategoryClipboard  = "clipboard"
+	RateCategoryOther      = "other"
+)
+
+// rateCategories lists the categories EventRateLimits can name
+var rateCategories = []string{
+	RateCategoryMouseMove, RateCategoryMouse, RateCategoryKeyboard,
+	RateCategoryScreenshot, RateCategoryClipboard, RateCategoryOther,
+}
+
+// rateLimit is how many events a category allows per window; zero events
+// means unlimited
+type rateLimit struct {
+	Events int32
+	Window time.Duration
+}
+
+// RateLimiter limits events with a token bucket per category, so a flood of
+// mouse moves cannot use up the allowance of clipboard events. Each bucket
+// holds up to its limit's events and refills steadily over its window; an
+// event takes a token. Unlike a fixed window, which lets twice the limit
+// through around the moment it resets, the rate never exceeds the limit
+// beyond the first full bucket. Categories without a limit of their own
+// allow MaxEvents per WindowSize, or everything when MaxEvents is zero.
+type RateLimiter struct {
+	MaxEvents  int32
+	WindowSize time.Duration
+	Limits     map[string]rateLimit
+	Buckets    map[string]*tokenBucket
+	Dropped    map[string]int64 // Events refused, by category
+	Now        func() time.Time
+	Mutex      sync.Mutex
+}
+
+// tokenBucket is the allowance left for one category of events
+type tokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing maxEvents per windowSize in
+// each category
+func NewRateLimiter(maxEvents int32, windowSize time.Duration) *RateLimiter {
+	return &RateLimiter{
+		MaxEvents:  maxEvents,
+		WindowSize: windowSize,
+		Limits:     make(map[string]rateLimit),
+		Buckets:    make(map[string]*tokenBucket),
+		Dropped:    make(map[string]int64),
+		Now:        time.Now,
+	}
+}
+
+// NewConfigRateLimiter creates a rate limiter for MaxEventsPerSecond and
+// EventRateLimits, or returns nil when neither is set
+func NewConfigRateLimiter(maxEventsPerSecond *int32, limits map[string]string) *RateLimiter {
+	if maxEventsPerSecond == nil && len(limits) == 0 {
+		return nil
+	}
+	limiter := NewRateLimiter(0, time.Second)
+	if maxEventsPerSecond != nil {
+		limiter.MaxEvents = *maxEventsPerSecond
+	}
+	// Checked when the config was loaded
+	limiter.Limits, _ = parseEventRateLimits(limits)
+	return limiter
+}
+
+// Allow checks if an event is allowed under the rate limit of its category
+func (rl *RateLimiter) Allow(event interface{}) bool {
+	return rl.AllowCategory(rateCategory(event))
+}
+
+// AllowCategory takes a token from a category's bucket if one is left
+func (rl *RateLimiter) AllowCategory(category string) bool {
+	rl.Mutex.Lock()
+	defer rl.Mutex.Unlock()
+
+	limit, ok := rl.Limits[category]
+	if !ok {
+		limit = rateLimit{Events: rl.MaxEvents, Window: rl.WindowSize}
+	}
+	if limit.Events <= 0 {
+		return true
+	}
+
+	now := rl.Now()
+	capacity := float64(limit.Events)
+	bucket, ok := rl.Buckets[category]
+	if !ok {
+		bucket = &tokenBucket{Tokens: capacity, Updated: now}
+		rl.Buckets[category] = bucket
+	}
+	if elapsed := now.Sub(bucket.Updated); elapsed > 0 && limit.Window > 0 {
+		bucket.Tokens = math.Min(capacity, bucket.Tokens+capacity*float64(elapsed)/float64(limit.Window))
+	}
+	bucket.Updated = now
+
+	if bucket.Tokens < 1 {
+		rl.Dropped[category]++
+		return false
+	}
+	bucket.Tokens--
+	return true
+}
+
+// GetStatistics returns the events refused by category
+func (rl *RateLimiter) GetStatistics() map[string]int64 {
+	rl.Mutex.Lock()
+	defer rl.Mutex.Unlock()
+
+	dropped := make(map[string]int64, len(rl.Dropped))
+	for category, count := range rl.Dropped {
+		dropped[category] = count
+	}
+	return dropped
+}
+
+// parseEventRateLimits reads EventRateLimits: each category's limit is a
+// count per duration, such as "10/s", "1/5s" or "100/min", or "unlimited"
+func parseEventRateLimits(limits map[string]string) (map[string]rateLimit, error) {
+	parsed := make(map[string]rateLimit, len(limits))
+	for category, spec := range limits {
+		known := false
+		for _, name := range rateCategories {
+			known = known || name == category
+		}
+		if !known {
+			return nil, NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf(
+				"Unknown event rate limit category %q: use %s", category, strings.Join(rateCategories, ", ")), nil)
+		}
+
+		spec = strings.ToLower(strings.TrimSpace(spec))
+		if spec == "unlimited" {
+			parsed[category] = rateLimit{}
+			continue
+		}
+		count, per, _ := strings.Cut(spec, "/")
+		events, err := strconv.ParseInt(strings.TrimSpace(count), 10, 32)
+		window := time.Second
+		if per = strings.TrimSpace(per); err == nil && per != "" {
+			per = strings.TrimSuffix(per, "in") // "min" is a minute, as "m"
+			if per[0] < '0' || per[0] > '9' {
+				per = "1" + per // "/s" is per one second
+			}
+			window, err = time.ParseDuration(per)
+		}
+		if err != nil || events < 1 || window <= 0 {
+			return nil, NewWorkflowError(ErrorTypeConfiguration, fmt.Sprintf(
+				"Event rate limit %q for %s must be a count per duration, such as 10/s or 1/5s, or unlimited", spec, category), nil)
+		}
+		parsed[category] = rateLimit{Events: int32(events), Window: window}
+	}
+	return parsed, nil
+}
+
+// rateCategory returns the rate limit category of an event
+func rateCategory(event interface{}) string {
+	switch e := event.(type) {
+	case MouseEvent:
+		return mouseRateCategory(e.EventType)
+	case *MouseEvent:
+		return mouseRateCategory(e.EventType)
+	case KeyboardEvent, *KeyboardEvent:
+		return RateCategoryKeyboard
+	case ScreenshotEvent, *ScreenshotEvent:
+		return RateCategoryScreenshot
+	case ClipboardEvent, *ClipboardEvent:
+		return RateCategoryClipboard
+	default:
+		return RateCategoryOther
+	}
+}
+
+// mouseRateCategory separates pointer moves and wheel turns, which come in
+// floods, from clicks and drags
+func mouseRateCategory(eventType MouseEventType) string {
+	if eventType == MouseMove || eventType == MouseWheel {
+		return RateCategoryMouseMove
+	}
+	return RateCategoryMouse
+}
+
+// Configuration validation utilities
+
+// ValidateConfig validates a workflow recorder configuration
+func ValidateConfig(config *WorkflowRecorderConfig) error {
+	if config == nil {
+		return NewWorkflowError(ErrorTypeConfiguration, "Configuration is nil", nil)
+	}
+
+	// Validate screenshot settings
+	if config.CaptureScreenshots {
+		if config.ScreenshotFormat != "png" && config.ScreenshotFormat != "jpeg" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Invalid screenshot format: must be 'png' or 'jpeg'", nil)
+		}
+
+		if config.ScreenshotFormat == "jpeg" && (config.ScreenshotJPEGQuality < 1 || config.ScreenshotJPEGQuality > 100) {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"JPEG quality must be between 1 and 100", nil)
+		}
+
+		switch config.ScreenshotCaptureMethod {
+		case "", CaptureMethodAuto, CaptureMethodGDI, CaptureMethodDesktopDuplication:
+		default:
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Invalid screenshot capture method: must be 'auto', 'gdi' or 'desktop_duplication'", nil)
+		}
+
+		if config.ScreenshotEncodeWorkers < 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Screenshot encode workers cannot be negative", nil)
+		}
+	}
+
+	// Validate timeouts and thresholds
+	if config.MouseMoveThrottleMs < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Mouse move throttle cannot be negative", nil)
+	}
+
+	if config.MinDragDistance < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Minimum drag distance cannot be negative", nil)
+	}
+
+	if config.DedupeWindowMs < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Dedupe window cannot be negative", nil)
+	}
+
+	if config.ScreenshotThrottleMs < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Screenshot throttle cannot be negative", nil)
+	}
+
+	if config.ActionScreenshotSettleMs < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Action screenshot settle time cannot be negative", nil)
+	}
+
+	if config.IdleThresholdSeconds < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Idle threshold cannot be negative", nil)
+	}
+
+	if config.WatchdogTimeoutSeconds < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Watchdog timeout cannot be negative", nil)
+	}
+
+	if config.RecordTextInputCompletion && config.TextInputCompletionTimeoutMs <= 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Text input completion timeout must be positive", nil)
+	}
+
+	if err := validateApplicationProfiles(config.ApplicationProfiles); err != nil {
+		return err
+	}
+
+	if err := validateEventSinks(config.EventSinks); err != nil {
+		return err
+	}
+
+	if err := validateRecordingQuotas(config.RecordingQuotas); err != nil {
+		return err
+	}
+
+	if err := validateRecordingLimits(config); err != nil {
+		return err
+	}
+
+	if err := validateChunking(config); err != nil {
+		return err
+	}
+
+	if err := validateLogging(config); err != nil {
+		return err
+	}
+
+	if config.MaskPII {
+		if _, err := piiDetectors(*config); err != nil {
+			return err
+		}
+	}
+
+	if config.CDPDebuggingURL != "" {
+		if u, err := url.Parse(config.CDPDebuggingURL); err != nil || u.Scheme != "http" || u.Host == "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Browser debugging URL must be an http:// address", err)
+		}
+	}
+
+	for _, folder := range config.WatchFolders {
+		if strings.TrimSpace(folder) == "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Watched folders cannot be empty", nil)
+		}
+	}
+
+	if config.VisionEndpoint != "" {
+		if u, err := url.Parse(config.VisionEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Vision endpoint must be an http:// or https:// URL", err)
+		}
+		if config.VisionTimeoutMs <= 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Vision timeout must be positive", nil)
+		}
+	}
+
+	if config.OCRCommand != "" {
+		if config.OCRLanguage == "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"OCR language cannot be empty", nil)
+		}
+		if config.OCRMinConfidence < 0 || config.OCRMinConfidence > 100 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"OCR minimum confidence must be between 0 and 100", nil)
+		}
+		if config.OCRTimeoutMs <= 0 {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"OCR timeout must be positive", nil)
+		}
+	}
+
+	if config.UpdateEndpoint != "" {
+		if u, err := url.Parse(config.UpdateEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Update endpoint must be an http:// or https:// URL", err)
+		}
+		if config.UpdateChannel != UpdateChannelStable && config.UpdateChannel != UpdateChannelBeta {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Update channel must be stable or beta", nil)
+		}
+	}
+
+	if config.AutoUpdate && config.UpdateEndpoint == "" {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Automatic updates need an update endpoint", nil)
+	}
+
+	if config.PauseHotkey != "" {
+		if _, err := parseKeyCombination(config.PauseHotkey); err != nil {
+			return err
+		}
+	}
+	if _, _, err := customHotkeyPatterns(config.CustomHotkeys); err != nil {
+		return err
+	}
+	if _, err := screenshotHotkeyPatterns(config.ScreenshotHotkeys); err != nil {
+		return err
+	}
+	if _, err := parseEventRateLimits(config.EventRateLimits); err != nil {
+		return err
+	}
+
+	if config.TelemetryEndpoint != "" {
+		if u, err := url.Parse(config.TelemetryEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return NewWorkflowError(ErrorTypeConfiguration,
+				"Telemetry endpoint must be an http:// or https:// URL", err)
+		}
+	}
+
+	if config.TaskIdleGapMs < 0 {
+		return NewWorkflowError(ErrorTypeConfiguration,
+			"Task idle gap cannot be negative", nil)
+	}
+
+	return nil
+}
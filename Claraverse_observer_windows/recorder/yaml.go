@@ -0,0 +1,467 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The YAML that config files need, without an external dependency: block
+// mappings and sequences, plain and quoted scalars, [a, b] lists, {} and
+// comments. Anchors, tags, multi-line scalars and multiple documents are
+// rejected. Parsed documents are turned into JSON so config files decode
+// the same whichever format they are written in.
+
+// yamlLine is a line of a YAML document that holds content
+type yamlLine struct {
+	Number int
+	Indent int
+	Text   string
+}
+
+// yamlEntry is one key of a mapping being written, which keeps its order
+type yamlEntry struct {
+	Key   string
+	Value interface{}
+}
+
+// yamlNumber matches the plain scalars read as numbers
+var yamlNumber = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// yamlToJSON converts a YAML document to JSON
+func yamlToJSON(data []byte) ([]byte, error) {
+	value, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// parseYAML parses a YAML document into maps, slices and scalars. An empty
+// document is an empty mapping.
+func parseYAML(data []byte) (interface{}, error) {
+	lines, err := yamlLines(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].Indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].Number)
+	}
+	return value, nil
+}
+
+// yamlLines splits a document into its content lines, without comments
+func yamlLines(data []byte) ([]yamlLine, error) {
+	var lines []yamlLine
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		content := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+1)
+		}
+		content = strings.TrimRight(stripYAMLComment(content), " \t")
+		if content == "" || content == "---" {
+			continue
+		}
+		if content == "..." {
+			break
+		}
+		lines = append(lines, yamlLine{Number: i + 1, Indent: len(line) - len(strings.TrimLeft(line, " ")), Text: content})
+	}
+	return lines, nil
+}
+
+// stripYAMLComment removes a # comment that is not inside quotes
+func stripYAMLComment(s string) string {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" [{,", s[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// isYAMLSequenceItem reports whether a line starts a sequence item
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseYAMLBlock parses the mapping or sequence starting at lines[i] and
+// returns the index of the line after it
+func parseYAMLBlock(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	if isYAMLSequenceItem(lines[i].Text) {
+		return parseYAMLSequence(lines, i, indent)
+	}
+	return parseYAMLMapping(lines, i, indent)
+}
+
+// parseYAMLSequence parses the items of a sequence at indent
+func parseYAMLSequence(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	items := []interface{}{}
+	for i < len(lines) && lines[i].Indent == indent && isYAMLSequenceItem(lines[i].Text) {
+		line := lines[i]
+		rest := strings.TrimLeft(strings.TrimPrefix(line.Text, "-"), " ")
+
+		if rest == "" {
+			// The item is the block indented below the dash, or null
+			i++
+			if i < len(lines) && lines[i].Indent > indent {
+				value, next, err := parseYAMLBlock(lines, i, lines[i].Indent)
+				if err != nil {
+					return nil, 0, err
+				}
+				items, i = append(items, value), next
+			} else {
+				items = append(items, nil)
+			}
+			continue
+		}
+
+		if _, _, isKey := splitYAMLKey(rest); isKey || isYAMLSequenceItem(rest) {
+			// The item is a block that starts on the dash's line
+			lines[i] = yamlLine{Number: line.Number, Indent: indent + len(line.Text) - len(rest), Text: rest}
+			value, next, err := parseYAMLBlock(lines, i, lines[i].Indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			items, i = append(items, value), next
+			continue
+		}
+
+		value, err := parseYAMLScalar(rest, line.Number)
+		if err != nil {
+			return nil, 0, err
+		}
+		items, i = append(items, value), i+1
+	}
+	if i < len(lines) && lines[i].Indent > indent {
+		return nil, 0, fmt.Errorf("line %d: unexpected indentation", lines[i].Number)
+	}
+	return items, i, nil
+}
+
+// parseYAMLMapping parses the keys of a mapping at indent
+func parseYAMLMapping(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	mapping := map[string]interface{}{}
+	for i < len(lines) && lines[i].Indent == indent {
+		line := lines[i]
+		if isYAMLSequenceItem(line.Text) {
+			return nil, 0, fmt.Errorf("line %d: expected a key, found a list item", line.Number)
+		}
+		key, value, ok := splitYAMLKey(line.Text)
+		if !ok {
+			return nil, 0, fmt.Errorf("line %d: expected \"key: value\"", line.Number)
+		}
+		if _, duplicate := mapping[key]; duplicate {
+			return nil, 0, fmt.Errorf("line %d: %s is set twice", line.Number, key)
+		}
+		i++
+
+		var err error
+		switch {
+		case value != "":
+			mapping[key], err = parseYAMLScalar(value, line.Number)
+		case i < len(lines) && lines[i].Indent > indent:
+			mapping[key], i, err = parseYAMLBlock(lines, i, lines[i].Indent)
+		case i < len(lines) && lines[i].Indent == indent && isYAMLSequenceItem(lines[i].Text):
+			// A sequence may sit at its key's indentation
+			mapping[key], i, err = parseYAMLSequence(lines, i, indent)
+		default:
+			mapping[key] = nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if i < len(lines) && lines[i].Indent > indent {
+		return nil, 0, fmt.Errorf("line %d: unexpected indentation", lines[i].Number)
+	}
+	return mapping, i, nil
+}
+
+// splitYAMLKey splits "key: value" into its key and value
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := quotedYAMLEnd(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		parsed, err := parseYAMLScalar(text[:end+1], 0)
+		if err != nil {
+			return "", "", false
+		}
+		key, rest := fmt.Sprint(parsed), text[end+2:]
+		if rest != "" && rest[0] != ' ' {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest), true
+	}
+
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true
+	}
+	colon := strings.Index(text, ": ")
+	if colon <= 0 || strings.ContainsAny(text[:colon], "[{") {
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:colon]), strings.TrimSpace(text[colon+2:]), true
+}
+
+// quotedYAMLEnd returns the index of the quote closing the string text
+// starts with, or -1
+func quotedYAMLEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++ // '' is an escaped quote
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLScalar parses a value written on one line
+func parseYAMLScalar(text string, lineNumber int) (interface{}, error) {
+	switch text[0] {
+	case '"':
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", lineNumber, text)
+		}
+		return value, nil
+	case '\'':
+		if quotedYAMLEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", lineNumber, text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: unclosed list %s", lineNumber, text)
+		}
+		items := []interface{}{}
+		for _, item := range splitYAMLFlow(text[1 : len(text)-1]) {
+			value, err := parseYAMLScalar(item, lineNumber)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case '{':
+		if len(text) < 2 || !strings.HasSuffix(text, "}") || strings.TrimSpace(text[1:len(text)-1]) != "" {
+			return nil, fmt.Errorf("line %d: write mappings one key per line", lineNumber)
+		}
+		return map[string]interface{}{}, nil
+	case '|', '>', '&', '*', '!', '%', '@', '`':
+		return nil, fmt.Errorf("line %d: unsupported YAML %s; quote the value", lineNumber, text)
+	}
+
+	switch text {
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if yamlNumber.MatchString(text) {
+		// Numbers are rewritten as JSON spells them, so 007 is 7
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return json.Number(strconv.FormatInt(n, 10)), nil
+		}
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+		}
+	}
+	return text, nil
+}
+
+// splitYAMLFlow splits the inside of a [a, b] list at commas outside quotes
+func splitYAMLFlow(text string) []string {
+	var items []string
+	start, quote := 0, byte(0)
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) {
+			c := text[i]
+			if quote != 0 {
+				if c == '\\' && quote == '"' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '"' || c == '\'' {
+				quote = c
+				continue
+			}
+			if c != ',' {
+				continue
+			}
+		}
+		if item := strings.TrimSpace(text[start:i]); item != "" {
+			items = append(items, item)
+		}
+		start = i + 1
+	}
+	return items
+}
+
+// marshalYAML writes a value as a YAML document, keeping the order of its
+// JSON encoding
+func marshalYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeOrderedJSON(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	if isYAMLBlock(value) {
+		writeYAMLBlock(&b, value, 0)
+	} else {
+		b.WriteString(yamlScalar(value) + "\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// decodeOrderedJSON decodes the next JSON value, with objects as ordered
+// []yamlEntry
+func decodeOrderedJSON(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	if delim == '{' {
+		entries := []yamlEntry{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, yamlEntry{Key: key.(string), Value: value})
+		}
+		_, err = decoder.Token()
+		return entries, err
+	}
+
+	items := []interface{}{}
+	for decoder.More() {
+		value, err := decodeOrderedJSON(decoder)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+	_, err = decoder.Token()
+	return items, err
+}
+
+// isYAMLBlock reports whether a value is written as an indented block
+func isYAMLBlock(value interface{}) bool {
+	switch value := value.(type) {
+	case []yamlEntry:
+		return len(value) > 0
+	case []interface{}:
+		return len(value) > 0
+	}
+	return false
+}
+
+// writeYAMLBlock writes a non-empty mapping or sequence at indent
+func writeYAMLBlock(b *strings.Builder, value interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+	writeValue := func(value interface{}) {
+		if isYAMLBlock(value) {
+			b.WriteString("\n")
+			writeYAMLBlock(b, value, indent+2)
+		} else {
+			b.WriteString(" " + yamlScalar(value) + "\n")
+		}
+	}
+
+	switch value := value.(type) {
+	case []yamlEntry:
+		for _, entry := range value {
+			b.WriteString(pad + yamlString(entry.Key) + ":")
+			writeValue(entry.Value)
+		}
+	case []interface{}:
+		for _, item := range value {
+			b.WriteString(pad + "-")
+			writeValue(item)
+		}
+	}
+}
+
+// yamlScalar writes a value that fits on one line
+func yamlScalar(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(value)
+	case json.Number:
+		return value.String()
+	case string:
+		return yamlString(value)
+	case []yamlEntry:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	return fmt.Sprint(value)
+}
+
+// yamlString writes a string plainly when it would read back as the same
+// string, and quoted otherwise
+func yamlString(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s, "#:,[]{}\"'\\\n\t") {
+		return strconv.Quote(s)
+	}
+	if parsed, err := parseYAMLScalar(s, 0); err != nil || parsed != s || isYAMLSequenceItem(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
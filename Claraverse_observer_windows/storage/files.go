@@ -0,0 +1,66 @@
+// Package storage reads and writes what the ClaraVerse UI recorder keeps on
+// disk: recordings and other JSON files, and the content-addressable store
+// saved recordings can keep their screenshots in. It has no Windows
+// dependencies, so programs that process recordings elsewhere can use it.
+// Errors wrap those of the os and encoding/json packages.
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ui_recorder/events"
+)
+
+// EnsureDir creates a directory, and any parents, if it doesn't exist
+func EnsureDir(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return os.MkdirAll(path, 0755)
+	}
+	return nil
+}
+
+// SaveJSON writes v to a file as indented JSON, creating its directory
+func SaveJSON(filename string, v interface{}) error {
+	if err := EnsureDir(filepath.Dir(filename)); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", filename, err)
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// LoadJSON reads a JSON file into v
+func LoadJSON(filename string, v interface{}) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode %s: %w", filename, err)
+	}
+	return nil
+}
+
+// LoadRecording reads a saved recording, or a chunk of one, into v,
+// upgrading it to events.SchemaVersion first. It returns the version the
+// recording was saved in; past events.SchemaVersion, what the newer
+// recorder added is ignored.
+func LoadRecording(filename string, v interface{}) (int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	data, version, err := events.Migrate(data)
+	if err != nil {
+		return 0, fmt.Errorf("migrate %s: %w", filename, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return version, fmt.Errorf("decode %s: %w", filename, err)
+	}
+	return version, nil
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Content-addressable screenshot store. Saved recordings can keep their
+// screenshots in a shared directory, one file per distinct image named by
+// its SHA-256, and refer to them by an image_ref such as "sha256:9f86...".
+// The same dialog captured in fifty recordings is stored once. Each saved
+// recording also leaves a reference list in the store; GC counts the
+// references of recordings that still exist and removes the images nothing
+// refers to.
+
+const (
+	RefPrefix  = "sha256:" // Starts every image reference
+	ObjectsDir = "objects" // Holds the images, under the first two digits of their hash
+	RefsDir    = "refs"    // Holds the reference list of each recording
+)
+
+// ScreenshotStore keeps screenshot images by content hash
+type ScreenshotStore struct {
+	Directory string
+	Mutex     sync.Mutex
+}
+
+// screenshotReferences is the reference list a saved recording leaves in the
+// store
+type screenshotReferences struct {
+	Recording string   `json:"recording"` // Absolute path of the recording file
+	Images    []string `json:"images"`
+}
+
+// ScreenshotStoreStats describes a garbage collection of the store
+type ScreenshotStoreStats struct {
+	Recordings   int   `json:"recordings"`    // Recordings still referring to the store
+	References   int   `json:"references"`    // Their references to images
+	Images       int   `json:"images"`        // Images kept
+	Removed      int   `json:"removed"`       // Images removed
+	RemovedBytes int64 `json:"removed_bytes"` // Space the removed images took
+}
+
+// ObjectPath returns where the image with the given hash is kept, fanned
+// out by its first two digits
+func (s *ScreenshotStore) ObjectPath(hash string) string {
+	return filepath.Join(s.Directory, ObjectsDir, hash[:2], hash)
+}
+
+// Put stores an image and returns its reference. An image already in the
+// store is not written again.
+func (s *ScreenshotStore) Put(image []byte) (string, error) {
+	sum := sha256.Sum256(image)
+	hash := hex.EncodeToString(sum[:])
+	path := s.ObjectPath(hash)
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		// Touched so a collection running alongside keeps it
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return RefPrefix + hash, nil
+	}
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path+".partial", image, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path+".partial", path); err != nil {
+		return "", err
+	}
+	return RefPrefix + hash, nil
+}
+
+// Get reads the image a reference names
+func (s *ScreenshotStore) Get(ref string) ([]byte, error) {
+	hash, ok := RefHash(ref)
+	if !ok {
+		return nil, fmt.Errorf("invalid screenshot reference %q", ref)
+	}
+	image, err := os.ReadFile(s.ObjectPath(hash))
+	if err != nil {
+		return nil, fmt.Errorf("screenshot %s missing from the store: %w", ref, err)
+	}
+	return image, nil
+}
+
+// RefHash returns the hash a reference names
+func RefHash(ref string) (string, bool) {
+	hash := strings.TrimPrefix(ref, RefPrefix)
+	if hash == ref || len(hash) != sha256.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+// AddReferences records that a saved recording refers to images, replacing
+// any list the recording left before
+func (s *ScreenshotStore) AddReferences(recording string, refs []string) error {
+	absolute, err := filepath.Abs(recording)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(absolute)))
+	filename := filepath.Join(s.Directory, RefsDir, hex.EncodeToString(sum[:8])+".json")
+	return SaveJSON(filename, screenshotReferences{Recording: absolute, Images: refs})
+}
+
+// GC removes the reference lists of recordings that no longer exist, then
+// the images no remaining recording refers to. Images newer than grace are
+// kept, as their recording may still be being saved.
+func (s *ScreenshotStore) GC(grace time.Duration) (ScreenshotStoreStats, error) {
+	var stats ScreenshotStoreStats
+	counts := make(map[string]int)
+
+	refFiles, err := filepath.Glob(filepath.Join(s.Directory, RefsDir, "*.json"))
+	if err != nil {
+		return stats, err
+	}
+	for _, refFile := range refFiles {
+		var references screenshotReferences
+		if err := LoadJSON(refFile, &references); err != nil {
+			return stats, err
+		}
+		if _, err := os.Stat(references.Recording); os.IsNotExist(err) {
+			if err := os.Remove(refFile); err != nil {
+				return stats, err
+			}
+			continue
+		}
+		stats.Recordings++
+		for _, ref := range references.Images {
+			if hash, ok := RefHash(ref); ok {
+				counts[hash]++
+				stats.References++
+			}
+		}
+	}
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	cutoff := time.Now().Add(-grace)
+	objects, err := filepath.Glob(filepath.Join(s.Directory, ObjectsDir, "*", "*"))
+	if err != nil {
+		return stats, err
+	}
+	for _, object := range objects {
+		info, err := os.Stat(object)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if counts[filepath.Base(object)] > 0 || info.ModTime().After(cutoff) {
+			stats.Images++
+			continue
+		}
+		if err := os.Remove(object); err != nil {
+			return stats, err
+		}
+		stats.Removed++
+		stats.RemovedBytes += info.Size()
+	}
+	return stats, nil
+}